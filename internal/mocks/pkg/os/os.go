@@ -54,6 +54,20 @@ func (m *MockOS) EXPECT() *MockOSMockRecorder {
 	return m.recorder
 }
 
+// Chmod mocks base method.
+func (m *MockOS) Chmod(arg0 string, arg1 fs.FileMode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Chmod", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Chmod indicates an expected call of Chmod.
+func (mr *MockOSMockRecorder) Chmod(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Chmod", reflect.TypeOf((*MockOS)(nil).Chmod), arg0, arg1)
+}
+
 // CreateTemp mocks base method.
 func (m *MockOS) CreateTemp(arg0, arg1 string) (*os.File, error) {
 	m.ctrl.T.Helper()
@@ -112,6 +126,20 @@ func (mr *MockOSMockRecorder) IsNotExist(arg0 any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsNotExist", reflect.TypeOf((*MockOS)(nil).IsNotExist), arg0)
 }
 
+// MkdirAll mocks base method.
+func (m *MockOS) MkdirAll(arg0 string, arg1 fs.FileMode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MkdirAll", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MkdirAll indicates an expected call of MkdirAll.
+func (mr *MockOSMockRecorder) MkdirAll(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MkdirAll", reflect.TypeOf((*MockOS)(nil).MkdirAll), arg0, arg1)
+}
+
 // MkdirTemp mocks base method.
 func (m *MockOS) MkdirTemp(arg0, arg1 string) (string, error) {
 	m.ctrl.T.Helper()
@@ -213,3 +241,17 @@ func (mr *MockOSMockRecorder) TempDir() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TempDir", reflect.TypeOf((*MockOS)(nil).TempDir))
 }
+
+// WriteFile mocks base method.
+func (m *MockOS) WriteFile(arg0 string, arg1 []byte, arg2 fs.FileMode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteFile", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteFile indicates an expected call of WriteFile.
+func (mr *MockOSMockRecorder) WriteFile(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteFile", reflect.TypeOf((*MockOS)(nil).WriteFile), arg0, arg1, arg2)
+}
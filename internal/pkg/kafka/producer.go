@@ -0,0 +1,332 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package kafka implements a minimal Kafka producer: it only sends uncompressed record batches, with
+// optional TLS and SASL/PLAIN authentication.
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Config configures a Producer.
+type Config struct {
+	Brokers  []string
+	Topic    string
+	ClientID string
+	// TLS enables TLS when not nil
+	TLS *tls.Config
+	// SASLUsername enables SASL/PLAIN authentication when not empty
+	SASLUsername string
+	SASLPassword string
+	// Timeout bounds the time brokers wait for the replicas to acknowledge the messages
+	Timeout time.Duration
+}
+
+// Producer sends messages to the partition leaders of a topic, picking the partition from the message key.
+type Producer struct {
+	config Config
+
+	mtx           sync.Mutex
+	conns         map[string]*conn
+	metadata      *metadata
+	correlationID int32
+}
+
+type conn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func NewProducer(c Config) (*Producer, error) {
+	if len(c.Brokers) == 0 {
+		return nil, errors.New("kafka: no brokers")
+	}
+
+	if c.Topic == "" {
+		return nil, errors.New("kafka: no topic")
+	}
+
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+
+	return &Producer{
+		config: c,
+		conns:  map[string]*conn{},
+	}, nil
+}
+
+// Produce sends the messages and waits for all the in-sync replicas to acknowledge them. On retriable
+// errors, e.g. when a leader moved, the metadata is refreshed and the messages are sent once more.
+func (p *Producer) Produce(ctx context.Context, messages []Message) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	err := p.produce(ctx, messages)
+
+	var kafkaErr Error
+	if err != nil && (!errors.As(err, &kafkaErr) || kafkaErr.Retriable()) {
+		p.reset()
+		err = p.produce(ctx, messages)
+	}
+
+	if err != nil {
+		p.reset()
+	}
+
+	return err
+}
+
+func (p *Producer) produce(ctx context.Context, messages []Message) error {
+	if p.metadata == nil {
+		m, err := p.fetchMetadata(ctx)
+		if err != nil {
+			return err
+		}
+		p.metadata = m
+	}
+
+	if p.metadata.err != nil {
+		return fmt.Errorf("kafka: topic '%s' unavailable; err: %w", p.config.Topic, p.metadata.err)
+	}
+
+	if len(p.metadata.partitions) == 0 {
+		return fmt.Errorf("kafka: topic '%s' has no partitions", p.config.Topic)
+	}
+
+	// Group the messages by partition, then the partitions by leader
+	byPartition := map[int32][]Message{}
+	for _, msg := range messages {
+		partition := p.metadata.partitions[partitionForKey(msg.Key, len(p.metadata.partitions))]
+		if partition.err != nil {
+			return fmt.Errorf("kafka: partition %d unavailable; err: %w", partition.id, partition.err)
+		}
+		byPartition[partition.id] = append(byPartition[partition.id], msg)
+	}
+
+	leaders := map[int32]map[int32][]byte{}
+	timestamp := time.Now().UnixMilli()
+	for _, partition := range p.metadata.partitions {
+		if msgs, exists := byPartition[partition.id]; exists {
+			if leaders[partition.leader] == nil {
+				leaders[partition.leader] = map[int32][]byte{}
+			}
+			leaders[partition.leader][partition.id] = encodeRecordBatch(msgs, timestamp)
+		}
+	}
+
+	for leader, batches := range leaders {
+		b, exists := p.metadata.brokers[leader]
+		if !exists {
+			return Error(5) // LEADER_NOT_AVAILABLE
+		}
+
+		req := encodeProduceRequest(p.config.Topic, -1, int32(p.config.Timeout.Milliseconds()), batches)
+		resp, err := p.roundTrip(ctx, b.addr, apiKeyProduce, produceVersion, req)
+		if err != nil {
+			return err
+		}
+
+		errs, err := decodeProduceResponse(resp)
+		if err != nil {
+			return err
+		}
+
+		for partition, err := range errs {
+			if err != nil {
+				return fmt.Errorf("kafka: failed to produce to partition %d; err: %w", partition, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *Producer) fetchMetadata(ctx context.Context) (*metadata, error) {
+	var lastErr error
+
+	for _, addr := range p.config.Brokers {
+		resp, err := p.roundTrip(ctx, addr, apiKeyMetadata, metadataVersion, encodeMetadataRequest(p.config.Topic))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		return decodeMetadataResponse(resp, p.config.Topic)
+	}
+
+	return nil, fmt.Errorf("kafka: failed to fetch metadata from any broker; err: %w", lastErr)
+}
+
+func (p *Producer) roundTrip(ctx context.Context, addr string, apiKey, apiVersion int16, body []byte) ([]byte, error) {
+	c, err := p.conn(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.send(ctx, c, apiKey, apiVersion, body)
+	if err != nil {
+		c.Close()
+		delete(p.conns, addr)
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (p *Producer) conn(ctx context.Context, addr string) (*conn, error) {
+	if c, exists := p.conns[addr]; exists {
+		return c, nil
+	}
+
+	var dialer net.Dialer
+	netConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: failed to connect to broker '%s'; err: %w", addr, err)
+	}
+
+	if p.config.TLS != nil {
+		tlsConfig := p.config.TLS.Clone()
+		if tlsConfig.ServerName == "" {
+			host, _, _ := net.SplitHostPort(addr)
+			tlsConfig.ServerName = host
+		}
+
+		tlsConn := tls.Client(netConn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("kafka: TLS handshake with broker '%s' failed; err: %w", addr, err)
+		}
+		netConn = tlsConn
+	}
+
+	c := &conn{Conn: netConn, reader: bufio.NewReader(netConn)}
+
+	if p.config.SASLUsername != "" {
+		if err := p.authenticate(ctx, c); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("kafka: SASL authentication with broker '%s' failed; err: %w", addr, err)
+		}
+	}
+
+	p.conns[addr] = c
+
+	return c, nil
+}
+
+func (p *Producer) authenticate(ctx context.Context, c *conn) error {
+	var handshake encoder
+	handshake.string("PLAIN")
+
+	resp, err := p.send(ctx, c, apiKeySaslHandshake, saslHandshakeVersion, handshake.b)
+	if err != nil {
+		return err
+	}
+
+	d := decoder{b: resp}
+	if err := errorCode(d.int16()); err != nil {
+		return err
+	}
+
+	var auth encoder
+	auth.bytes([]byte("\x00" + p.config.SASLUsername + "\x00" + p.config.SASLPassword))
+
+	resp, err = p.send(ctx, c, apiKeySaslAuthenticate, saslAuthenticateVersion, auth.b)
+	if err != nil {
+		return err
+	}
+
+	d = decoder{b: resp}
+	code := d.int16()
+	msg := d.string()
+	if err := errorCode(code); err != nil {
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+
+	return d.err
+}
+
+// send writes a request and reads its response, without the response header.
+func (p *Producer) send(ctx context.Context, c *conn, apiKey, apiVersion int16, body []byte) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.SetDeadline(deadline)
+	} else {
+		_ = c.SetDeadline(time.Time{})
+	}
+
+	p.correlationID++
+	correlationID := p.correlationID
+
+	clientID := p.config.ClientID
+
+	var req encoder
+	req.int32(0) // size, set below
+	req.int16(apiKey)
+	req.int16(apiVersion)
+	req.int32(correlationID)
+	req.nullableString(&clientID)
+	req.b = append(req.b, body...)
+	binary.BigEndian.PutUint32(req.b, uint32(len(req.b)-4))
+
+	if _, err := c.Write(req.b); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(c.reader, size[:]); err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(c.reader, resp); err != nil {
+		return nil, err
+	}
+
+	d := decoder{b: resp}
+	if got := d.int32(); got != correlationID || d.err != nil {
+		return nil, fmt.Errorf("kafka: unexpected correlation ID %d, expected %d", got, correlationID)
+	}
+
+	return d.b, nil
+}
+
+// reset drops the connections and the metadata, they are fetched again on the next call.
+func (p *Producer) reset() {
+	for addr, c := range p.conns {
+		c.Close()
+		delete(p.conns, addr)
+	}
+	p.metadata = nil
+}
+
+func (p *Producer) Close() error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.reset()
+
+	return nil
+}
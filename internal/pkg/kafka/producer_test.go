@@ -0,0 +1,370 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBroker is a single broker cluster leading every partition of its topic.
+type fakeBroker struct {
+	t          *testing.T
+	listener   net.Listener
+	topic      string
+	partitions int32
+	username   string
+	password   string
+	// produceErrors are returned, in order, to the produce requests
+	produceErrors []int16
+
+	mtx      sync.Mutex
+	messages map[int32][]Message
+	apiKeys  []int16
+}
+
+func newFakeBroker(t *testing.T, topic string, partitions int32, opts ...func(*fakeBroker)) *fakeBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	b := &fakeBroker{
+		t:          t,
+		listener:   listener,
+		topic:      topic,
+		partitions: partitions,
+		messages:   map[int32][]Message{},
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	go b.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return b
+}
+
+func (b *fakeBroker) addr() string {
+	return b.listener.Addr().String()
+}
+
+func (b *fakeBroker) serve() {
+	for {
+		c, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(c)
+	}
+}
+
+func (b *fakeBroker) handle(c net.Conn) {
+	defer c.Close()
+
+	authenticated := b.username == ""
+
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(c, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(c, req); err != nil {
+			return
+		}
+
+		d := decoder{b: req}
+		apiKey := d.int16()
+		_ = d.int16() // version
+		correlationID := d.int32()
+		_ = d.string() // client ID
+
+		b.mtx.Lock()
+		b.apiKeys = append(b.apiKeys, apiKey)
+		b.mtx.Unlock()
+
+		var resp encoder
+		resp.int32(correlationID)
+
+		switch apiKey {
+		case apiKeySaslHandshake:
+			mechanism := d.string()
+			assert.Equal(b.t, "PLAIN", mechanism)
+			resp.int16(0)
+			resp.int32(1)
+			resp.string("PLAIN")
+		case apiKeySaslAuthenticate:
+			auth := string(d.bytes())
+			if auth == "\x00"+b.username+"\x00"+b.password {
+				authenticated = true
+				resp.int16(0)
+				resp.nullableString(nil)
+			} else {
+				msg := "invalid credentials"
+				resp.int16(58) // SASL_AUTHENTICATION_FAILED
+				resp.nullableString(&msg)
+			}
+			resp.bytes(nil)
+		case apiKeyMetadata:
+			if !authenticated {
+				return
+			}
+			host, port, _ := net.SplitHostPort(b.addr())
+			portNum, _ := strconv.Atoi(port)
+
+			resp.int32(1)
+			resp.int32(1) // node ID
+			resp.string(host)
+			resp.int32(int32(portNum))
+			resp.nullableString(nil)
+			resp.int32(1) // controller ID
+			resp.int32(1)
+			resp.int16(0)
+			resp.string(b.topic)
+			resp.int8(0)
+			resp.int32(b.partitions)
+			// Partitions are listed in reverse order, the producer must sort them
+			for i := b.partitions - 1; i >= 0; i-- {
+				resp.int16(0)
+				resp.int32(i)
+				resp.int32(1) // leader
+				resp.int32(1)
+				resp.int32(1)
+				resp.int32(1)
+				resp.int32(1)
+			}
+		case apiKeyProduce:
+			if !authenticated {
+				return
+			}
+			_ = d.string() // transactional ID
+			assert.Equal(b.t, int16(-1), d.int16())
+			_ = d.int32() // timeout
+
+			var code int16
+			b.mtx.Lock()
+			if len(b.produceErrors) > 0 {
+				code = b.produceErrors[0]
+				b.produceErrors = b.produceErrors[1:]
+			}
+			b.mtx.Unlock()
+
+			resp.int32(1)
+			for i, n := 0, d.arrayLen(); i < n; i++ {
+				topic := d.string()
+				resp.string(topic)
+
+				pn := d.arrayLen()
+				resp.int32(int32(pn))
+				for j := 0; j < pn; j++ {
+					partition := d.int32()
+					messages := decodeRecordBatch(b.t, d.bytes())
+					if code == 0 {
+						b.mtx.Lock()
+						b.messages[partition] = append(b.messages[partition], messages...)
+						b.mtx.Unlock()
+					}
+
+					resp.int32(partition)
+					resp.int16(code)
+					resp.int64(0)
+					resp.int64(-1)
+				}
+			}
+			resp.int32(0) // throttle time
+		default:
+			b.t.Errorf("unexpected API key %d", apiKey)
+			return
+		}
+
+		require.NoError(b.t, d.err)
+
+		var out encoder
+		out.bytes(resp.b)
+		if _, err := c.Write(out.b); err != nil {
+			return
+		}
+	}
+}
+
+func decodeRecordBatch(t *testing.T, b []byte) []Message {
+	t.Helper()
+
+	d := decoder{b: b}
+	_ = d.int64() // base offset
+	length := d.int32()
+	require.Equal(t, int(length), len(d.b))
+	_ = d.int32() // partition leader epoch
+	require.Equal(t, recordBatchMagic, d.int8())
+	crc := uint32(d.int32())
+	require.Equal(t, crc32.Checksum(d.b, crc32c), crc)
+	_ = d.int16() // attributes
+	_ = d.int32() // last offset delta
+	_ = d.int64() // first timestamp
+	_ = d.int64() // max timestamp
+	_ = d.int64() // producer ID
+	_ = d.int16() // producer epoch
+	_ = d.int32() // base sequence
+
+	var messages []Message
+	for i, n := 0, int(d.int32()); i < n; i++ {
+		_ = d.varint() // length
+		_ = d.int8()   // attributes
+		_ = d.varint() // timestamp delta
+		require.Equal(t, int64(i), d.varint())
+		key := d.varintBytes()
+		value := d.varintBytes()
+		require.Equal(t, int64(0), d.varint())
+		messages = append(messages, Message{Key: key, Value: value})
+	}
+	require.NoError(t, d.err)
+	require.Empty(t, d.b)
+
+	return messages
+}
+
+func TestProducer_Produce(t *testing.T) {
+	broker := newFakeBroker(t, "gpu-metrics", 4)
+
+	producer, err := NewProducer(Config{
+		Brokers:  []string{"127.0.0.1:1", broker.addr()},
+		Topic:    "gpu-metrics",
+		ClientID: "dcgm-exporter",
+	})
+	require.NoError(t, err)
+	defer producer.Close()
+
+	messages := []Message{
+		{Key: []byte("GPU-0"), Value: []byte("a")},
+		{Key: []byte("GPU-2"), Value: []byte("b")},
+		{Key: []byte("GPU-0"), Value: []byte("c")},
+	}
+	require.NoError(t, producer.Produce(context.Background(), messages))
+
+	broker.mtx.Lock()
+	defer broker.mtx.Unlock()
+
+	gpu0 := int32(partitionForKey([]byte("GPU-0"), 4))
+	gpu2 := int32(partitionForKey([]byte("GPU-2"), 4))
+	require.NotEqual(t, gpu0, gpu2)
+	assert.Equal(t, []Message{messages[0], messages[2]}, broker.messages[gpu0])
+	assert.Equal(t, []Message{messages[1]}, broker.messages[gpu2])
+}
+
+func TestProducer_RetriesAfterLeaderChange(t *testing.T) {
+	broker := newFakeBroker(t, "gpu-metrics", 1, func(b *fakeBroker) {
+		b.produceErrors = []int16{6} // NOT_LEADER_OR_FOLLOWER
+	})
+
+	producer, err := NewProducer(Config{Brokers: []string{broker.addr()}, Topic: "gpu-metrics"})
+	require.NoError(t, err)
+	defer producer.Close()
+
+	require.NoError(t, producer.Produce(context.Background(), []Message{{Key: []byte("GPU-0"), Value: []byte("a")}}))
+
+	broker.mtx.Lock()
+	defer broker.mtx.Unlock()
+	assert.Equal(t, []int16{apiKeyMetadata, apiKeyProduce, apiKeyMetadata, apiKeyProduce}, broker.apiKeys)
+	assert.Len(t, broker.messages[0], 1)
+}
+
+func TestProducer_NonRetriableError(t *testing.T) {
+	broker := newFakeBroker(t, "gpu-metrics", 1, func(b *fakeBroker) {
+		b.produceErrors = []int16{10} // MESSAGE_TOO_LARGE
+	})
+
+	producer, err := NewProducer(Config{Brokers: []string{broker.addr()}, Topic: "gpu-metrics"})
+	require.NoError(t, err)
+	defer producer.Close()
+
+	err = producer.Produce(context.Background(), []Message{{Key: []byte("GPU-0"), Value: []byte("a")}})
+	assert.ErrorIs(t, err, Error(10))
+}
+
+func TestProducer_SASL(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{name: "valid credentials", password: "secret"},
+		{name: "invalid credentials", password: "wrong", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := newFakeBroker(t, "gpu-metrics", 1, func(b *fakeBroker) {
+				b.username = "user"
+				b.password = "secret"
+			})
+
+			producer, err := NewProducer(Config{
+				Brokers:      []string{broker.addr()},
+				Topic:        "gpu-metrics",
+				SASLUsername: "user",
+				SASLPassword: tt.password,
+			})
+			require.NoError(t, err)
+			defer producer.Close()
+
+			err = producer.Produce(context.Background(), []Message{{Key: []byte("GPU-0"), Value: []byte("a")}})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			broker.mtx.Lock()
+			defer broker.mtx.Unlock()
+			assert.Equal(t, []int16{apiKeySaslHandshake, apiKeySaslAuthenticate, apiKeyMetadata, apiKeyProduce},
+				broker.apiKeys)
+		})
+	}
+}
+
+func TestMurmur2(t *testing.T) {
+	// Test vectors of the Java client
+	tests := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+
+	for key, want := range tests {
+		assert.Equal(t, want, murmur2([]byte(key)), key)
+	}
+}
+
+func TestNewProducer_InvalidConfig(t *testing.T) {
+	_, err := NewProducer(Config{Topic: "gpu-metrics"})
+	assert.Error(t, err)
+
+	_, err = NewProducer(Config{Brokers: []string{"localhost:9092"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,435 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// API keys and versions of the requests sent by the producer.
+const (
+	apiKeyProduce          int16 = 0
+	apiKeyMetadata         int16 = 3
+	apiKeySaslHandshake    int16 = 17
+	apiKeySaslAuthenticate int16 = 36
+
+	produceVersion          int16 = 3
+	metadataVersion         int16 = 1
+	saslHandshakeVersion    int16 = 1
+	saslAuthenticateVersion int16 = 0
+
+	recordBatchMagic int8 = 2
+)
+
+var (
+	crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+	errShortBuffer = errors.New("kafka: short buffer")
+)
+
+// Error is an error code returned by a broker.
+type Error int16
+
+func (e Error) Error() string {
+	return fmt.Sprintf("kafka: broker error code %d", int16(e))
+}
+
+// Retriable reports whether the request may succeed after refreshing the metadata, e.g. when the leader of
+// a partition moved.
+func (e Error) Retriable() bool {
+	switch e {
+	case 3, // UNKNOWN_TOPIC_OR_PARTITION
+		5,  // LEADER_NOT_AVAILABLE
+		6,  // NOT_LEADER_OR_FOLLOWER
+		7,  // REQUEST_TIMED_OUT
+		8,  // BROKER_NOT_AVAILABLE
+		19, // NOT_ENOUGH_REPLICAS
+		20: // NOT_ENOUGH_REPLICAS_AFTER_APPEND
+		return true
+	}
+
+	return false
+}
+
+func errorCode(code int16) error {
+	if code == 0 {
+		return nil
+	}
+
+	return Error(code)
+}
+
+// encoder appends the primitive types of the Kafka protocol to a buffer.
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) int8(v int8) {
+	e.b = append(e.b, byte(v))
+}
+
+func (e *encoder) int16(v int16) {
+	e.b = binary.BigEndian.AppendUint16(e.b, uint16(v))
+}
+
+func (e *encoder) int32(v int32) {
+	e.b = binary.BigEndian.AppendUint32(e.b, uint32(v))
+}
+
+func (e *encoder) int64(v int64) {
+	e.b = binary.BigEndian.AppendUint64(e.b, uint64(v))
+}
+
+func (e *encoder) varint(v int64) {
+	e.b = binary.AppendVarint(e.b, v)
+}
+
+func (e *encoder) string(v string) {
+	e.int16(int16(len(v)))
+	e.b = append(e.b, v...)
+}
+
+func (e *encoder) nullableString(v *string) {
+	if v == nil {
+		e.int16(-1)
+		return
+	}
+	e.string(*v)
+}
+
+func (e *encoder) bytes(v []byte) {
+	e.int32(int32(len(v)))
+	e.b = append(e.b, v...)
+}
+
+func (e *encoder) varintBytes(v []byte) {
+	if v == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(v)))
+	e.b = append(e.b, v...)
+}
+
+// decoder reads the primitive types of the Kafka protocol, the first error is kept and later reads
+// return zero values.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errShortBuffer
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) int8() int8 {
+	v := d.read(1)
+	if v == nil {
+		return 0
+	}
+	return int8(v[0])
+}
+
+func (d *decoder) int16() int16 {
+	v := d.read(2)
+	if v == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(v))
+}
+
+func (d *decoder) int32() int32 {
+	v := d.read(4)
+	if v == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(v))
+}
+
+func (d *decoder) int64() int64 {
+	v := d.read(8)
+	if v == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(v))
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errShortBuffer
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.read(int(n)))
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.read(int(n))
+}
+
+func (d *decoder) varintBytes() []byte {
+	n := d.varint()
+	if n < 0 {
+		return nil
+	}
+	return d.read(int(n))
+}
+
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 {
+		return 0
+	}
+	// Every array element is at least one byte long
+	if int(n) > len(d.b) {
+		d.err = errShortBuffer
+		return 0
+	}
+	return int(n)
+}
+
+// Message is a record produced to a topic.
+type Message struct {
+	Key   []byte
+	Value []byte
+}
+
+// encodeRecordBatch encodes the messages as a v2 record batch without compression.
+func encodeRecordBatch(messages []Message, timestamp int64) []byte {
+	var records encoder
+	for i, msg := range messages {
+		var record encoder
+		record.int8(0) // attributes
+		record.varint(0)
+		record.varint(int64(i))
+		record.varintBytes(msg.Key)
+		record.varintBytes(msg.Value)
+		record.varint(0) // headers
+
+		records.varint(int64(len(record.b)))
+		records.b = append(records.b, record.b...)
+	}
+
+	// The CRC covers everything from the attributes to the end of the batch
+	var crcd encoder
+	crcd.int16(0) // attributes
+	crcd.int32(int32(len(messages) - 1))
+	crcd.int64(timestamp)
+	crcd.int64(timestamp)
+	crcd.int64(-1) // producer ID
+	crcd.int16(-1) // producer epoch
+	crcd.int32(-1) // base sequence
+	crcd.int32(int32(len(messages)))
+	crcd.b = append(crcd.b, records.b...)
+
+	var batch encoder
+	batch.int64(0)                              // base offset
+	batch.int32(int32(4 + 1 + 4 + len(crcd.b))) // batch length
+	batch.int32(-1)                             // partition leader epoch
+	batch.int8(recordBatchMagic)
+	batch.b = binary.BigEndian.AppendUint32(batch.b, crc32.Checksum(crcd.b, crc32c))
+	batch.b = append(batch.b, crcd.b...)
+
+	return batch.b
+}
+
+type broker struct {
+	id   int32
+	addr string
+}
+
+type partitionMetadata struct {
+	id     int32
+	leader int32
+	err    error
+}
+
+type metadata struct {
+	brokers    map[int32]broker
+	partitions []partitionMetadata
+	err        error
+}
+
+func encodeMetadataRequest(topic string) []byte {
+	var e encoder
+	e.int32(1)
+	e.string(topic)
+	return e.b
+}
+
+func decodeMetadataResponse(b []byte, topic string) (*metadata, error) {
+	d := decoder{b: b}
+	m := &metadata{brokers: map[int32]broker{}}
+
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		_ = d.string() // rack
+		m.brokers[id] = broker{id: id, addr: net.JoinHostPort(host, strconv.Itoa(int(port)))}
+	}
+
+	_ = d.int32() // controller ID
+
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		code := d.int16()
+		name := d.string()
+		_ = d.int8() // is internal
+
+		var partitions []partitionMetadata
+		for j, pn := 0, d.arrayLen(); j < pn; j++ {
+			partitionCode := d.int16()
+			id := d.int32()
+			leader := d.int32()
+			for k, rn := 0, d.arrayLen(); k < rn; k++ {
+				_ = d.int32() // replicas
+			}
+			for k, in := 0, d.arrayLen(); k < in; k++ {
+				_ = d.int32() // in-sync replicas
+			}
+			partitions = append(partitions, partitionMetadata{id: id, leader: leader, err: errorCode(partitionCode)})
+		}
+
+		if name == topic {
+			// The partitioner picks partitions by ID
+			sort.Slice(partitions, func(i, j int) bool { return partitions[i].id < partitions[j].id })
+			m.err = errorCode(code)
+			m.partitions = partitions
+		}
+	}
+
+	if d.err != nil {
+		return nil, fmt.Errorf("kafka: invalid metadata response; err: %w", d.err)
+	}
+
+	return m, nil
+}
+
+func encodeProduceRequest(topic string, acks int16, timeoutMs int32, batches map[int32][]byte) []byte {
+	var e encoder
+	e.nullableString(nil) // transactional ID
+	e.int16(acks)
+	e.int32(timeoutMs)
+	e.int32(1)
+	e.string(topic)
+	e.int32(int32(len(batches)))
+	for partition, batch := range batches {
+		e.int32(partition)
+		e.bytes(batch)
+	}
+	return e.b
+}
+
+func decodeProduceResponse(b []byte) (map[int32]error, error) {
+	d := decoder{b: b}
+	errs := map[int32]error{}
+
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		_ = d.string() // topic
+		for j, pn := 0, d.arrayLen(); j < pn; j++ {
+			partition := d.int32()
+			code := d.int16()
+			_ = d.int64() // base offset
+			_ = d.int64() // log append time
+			errs[partition] = errorCode(code)
+		}
+	}
+	_ = d.int32() // throttle time
+
+	if d.err != nil {
+		return nil, fmt.Errorf("kafka: invalid produce response; err: %w", d.err)
+	}
+
+	return errs, nil
+}
+
+// murmur2 is the hash used by the default partitioner of the Java client, so messages with the same key
+// land in the same partition whatever the client producing them.
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+
+	return int32(h)
+}
+
+// partitionForKey returns the partition of a key like the default partitioner of the Java client.
+func partitionForKey(key []byte, partitions int) int {
+	return int(murmur2(key)&0x7fffffff) % partitions
+}
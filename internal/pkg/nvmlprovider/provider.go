@@ -17,6 +17,7 @@
 package nvmlprovider
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"strconv"
@@ -24,10 +25,15 @@ import (
 	"sync"
 
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
-var nvmlOnce *sync.Once = new(sync.Once)
+var (
+	nvmlOnce *sync.Once = new(sync.Once)
+	// nvmlInitErr is the error of the initialization of NVML, returned to every caller
+	nvmlInitErr error
+)
 
 type MIGDeviceInfo struct {
 	ParentUUID        string
@@ -35,18 +41,46 @@ type MIGDeviceInfo struct {
 	ComputeInstanceID int
 }
 
-// GetMIGDeviceInfoByID returns information about MIG DEVICE by ID
-func GetMIGDeviceInfoByID(uuid string) (*MIGDeviceInfo, error) {
-	var err error
-
+func initNVML() error {
 	nvmlOnce.Do(func() {
 		ret := nvml.Init()
-		if ret != nvml.SUCCESS {
-			err = errors.New(nvml.ErrorString(ret))
+		if ret == nvml.ERROR_LIBRARY_NOT_FOUND {
+			// The error string is read from the library
+			nvmlInitErr = errors.New("the NVML library was not found")
+		} else if ret != nvml.SUCCESS {
+			nvmlInitErr = errors.New(nvml.ErrorString(ret))
+		}
+
+		if nvmlInitErr != nil {
 			logrus.Error("Can not init NVML library.")
 		}
 	})
-	if err != nil {
+
+	return nvmlInitErr
+}
+
+// GetMemoryTotalByUUID returns the total memory of the GPU in bytes
+func GetMemoryTotalByUUID(uuid string) (uint64, error) {
+	if err := initNVML(); err != nil {
+		return 0, err
+	}
+
+	device, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return 0, errors.New(nvml.ErrorString(ret))
+	}
+
+	memory, ret := device.GetMemoryInfo()
+	if ret != nvml.SUCCESS {
+		return 0, errors.New(nvml.ErrorString(ret))
+	}
+
+	return memory.Total, nil
+}
+
+// GetMIGDeviceInfoByID returns information about MIG DEVICE by ID
+func GetMIGDeviceInfoByID(uuid string) (*MIGDeviceInfo, error) {
+	if err := initNVML(); err != nil {
 		return nil, err
 	}
 
@@ -112,3 +146,528 @@ func GetMIGDeviceInfoByID(uuid string) (*MIGDeviceInfo, error) {
 		ComputeInstanceID: ci,
 	}, nil
 }
+
+// GPUFabricInfo is the registration of the GPU with the fabric manager
+type GPUFabricInfo struct {
+	// State is one of the nvml.GPU_FABRIC_STATE_* values
+	State uint8
+	// Error describes why the registration failed, it is empty when the registration is not completed or succeeded
+	Error string
+}
+
+// GetGPUFabricInfo returns the registration of the GPU with the fabric manager, available on NVSwitch systems
+// since Hopper
+func GetGPUFabricInfo(uuid string) (*GPUFabricInfo, error) {
+	if err := initNVML(); err != nil {
+		return nil, err
+	}
+
+	device, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+
+	fabricInfo, ret := device.GetGpuFabricInfo()
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		return &GPUFabricInfo{State: nvml.GPU_FABRIC_STATE_NOT_SUPPORTED}, nil
+	}
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+
+	info := &GPUFabricInfo{State: fabricInfo.State}
+	if fabricInfo.State == nvml.GPU_FABRIC_STATE_COMPLETED && nvml.Return(fabricInfo.Status) != nvml.SUCCESS {
+		info.Error = nvml.ErrorString(nvml.Return(fabricInfo.Status))
+	}
+
+	return info, nil
+}
+
+// GetFabricClusterUUID returns the UUID of the NVLink domain the GPUs are registered in by the fabric manager, it is
+// empty when no GPU completed its registration, e.g. without NVSwitches
+func GetFabricClusterUUID() (string, error) {
+	if err := initNVML(); err != nil {
+		return "", err
+	}
+
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return "", errors.New(nvml.ErrorString(ret))
+	}
+
+	for i := 0; i < count; i++ {
+		device, ret := nvml.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			return "", errors.New(nvml.ErrorString(ret))
+		}
+
+		fabricInfo, ret := device.GetGpuFabricInfo()
+		if ret != nvml.SUCCESS || fabricInfo.State != nvml.GPU_FABRIC_STATE_COMPLETED {
+			continue
+		}
+
+		var clusterUUID uuid.UUID
+		for j, b := range fabricInfo.ClusterUuid {
+			clusterUUID[j] = byte(b)
+		}
+		if clusterUUID != uuid.Nil {
+			return clusterUUID.String(), nil
+		}
+	}
+
+	return "", nil
+}
+
+// VGPUInstanceInfo is the state of a vGPU instance running on the GPU of a vGPU host
+type VGPUInstanceInfo struct {
+	ID   uint32
+	UUID string
+	// VMID identifies the VM owning the vGPU, either a domain ID or a UUID depending on the hypervisor
+	VMID string
+	// FBUsage is the framebuffer memory used by the vGPU in bytes
+	FBUsage uint64
+	// LicenseStatus is 1 when the vGPU is licensed
+	LicenseStatus int
+	// SMUtil is the latest utilization of the SMs by the vGPU in %
+	SMUtil uint64
+}
+
+// GetVGPUInstances returns the vGPU instances running on the GPU, it is empty when the GPU is not used by a vGPU
+// host
+func GetVGPUInstances(uuid string) ([]VGPUInstanceInfo, error) {
+	if err := initNVML(); err != nil {
+		return nil, err
+	}
+
+	device, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+
+	vgpus, ret := device.GetActiveVgpus()
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		return nil, nil
+	}
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+	if len(vgpus) == 0 {
+		return nil, nil
+	}
+
+	// The samples are sorted by time, the latest sample of every vGPU is kept
+	samples := map[uint32]nvml.VgpuInstanceUtilizationSample{}
+	valueType, utilization, ret := device.GetVgpuUtilization(0)
+	if ret != nvml.SUCCESS && ret != nvml.ERROR_NOT_FOUND {
+		logrus.Debugf("Unable to get the vGPU utilization of GPU %s: %s", uuid, nvml.ErrorString(ret))
+	}
+	for _, sample := range utilization {
+		if sample.TimeStamp >= samples[sample.VgpuInstance].TimeStamp {
+			samples[sample.VgpuInstance] = sample
+		}
+	}
+
+	instances := make([]VGPUInstanceInfo, 0, len(vgpus))
+	for _, vgpu := range vgpus {
+		instance := VGPUInstanceInfo{ID: uint32(vgpu)}
+
+		if instance.UUID, ret = vgpu.GetUUID(); ret != nvml.SUCCESS {
+			return nil, errors.New(nvml.ErrorString(ret))
+		}
+		if instance.VMID, _, ret = vgpu.GetVmID(); ret != nvml.SUCCESS {
+			return nil, errors.New(nvml.ErrorString(ret))
+		}
+		if instance.FBUsage, ret = vgpu.GetFbUsage(); ret != nvml.SUCCESS {
+			return nil, errors.New(nvml.ErrorString(ret))
+		}
+		if instance.LicenseStatus, ret = vgpu.GetLicenseStatus(); ret != nvml.SUCCESS {
+			return nil, errors.New(nvml.ErrorString(ret))
+		}
+
+		if sample, exists := samples[instance.ID]; exists {
+			instance.SMUtil = sampleValue(valueType, sample.SmUtil)
+		}
+
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
+
+// sampleValue decodes the value of a NVML sample
+func sampleValue(valueType nvml.ValueType, value [8]byte) uint64 {
+	switch valueType {
+	case nvml.VALUE_TYPE_UNSIGNED_LONG, nvml.VALUE_TYPE_UNSIGNED_LONG_LONG, nvml.VALUE_TYPE_SIGNED_LONG_LONG:
+		return binary.LittleEndian.Uint64(value[:])
+	}
+	return uint64(binary.LittleEndian.Uint32(value[:4]))
+}
+
+// GetRunningProcessIDs returns the PIDs of the compute and graphics processes running on the GPU
+func GetRunningProcessIDs(uuid string) ([]uint32, error) {
+	if err := initNVML(); err != nil {
+		return nil, err
+	}
+
+	device, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+
+	var pids []uint32
+	for _, getProcesses := range []func() ([]nvml.ProcessInfo, nvml.Return){
+		device.GetComputeRunningProcesses,
+		device.GetGraphicsRunningProcesses,
+	} {
+		processes, ret := getProcesses()
+		if ret == nvml.ERROR_NOT_SUPPORTED {
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			return nil, errors.New(nvml.ErrorString(ret))
+		}
+
+		for _, process := range processes {
+			pids = append(pids, process.Pid)
+		}
+	}
+
+	return pids, nil
+}
+
+// SetDrainState drains the GPU, so that the driver stops accepting new work on it, or returns it to service. It
+// requires root privileges.
+func SetDrainState(uuid string, drained bool) error {
+	if err := initNVML(); err != nil {
+		return err
+	}
+
+	device, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return errors.New(nvml.ErrorString(ret))
+	}
+
+	pciInfo, ret := device.GetPciInfo()
+	if ret != nvml.SUCCESS {
+		return errors.New(nvml.ErrorString(ret))
+	}
+
+	state := nvml.FEATURE_DISABLED
+	if drained {
+		state = nvml.FEATURE_ENABLED
+	}
+	if ret := nvml.DeviceModifyDrainState(&pciInfo, state); ret != nvml.SUCCESS {
+		return errors.New(nvml.ErrorString(ret))
+	}
+
+	return nil
+}
+
+// GPUInstanceProfileInfo is the capacity of the profile of a MIG GPU instance
+type GPUInstanceProfileInfo struct {
+	// MemorySizeMB is the framebuffer memory of the GPU instance in MiB
+	MemorySizeMB        uint64
+	MultiprocessorCount uint32
+}
+
+// GetGPUInstanceProfileInfo returns the capacity of the profile of the GPU instance of the MIG enabled GPU
+func GetGPUInstanceProfileInfo(uuid string, gpuInstanceID uint) (*GPUInstanceProfileInfo, error) {
+	if err := initNVML(); err != nil {
+		return nil, err
+	}
+
+	device, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+
+	instance, ret := device.GetGpuInstanceById(int(gpuInstanceID))
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+
+	instanceInfo, ret := instance.GetInfo()
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+
+	// The instance has the ID of its profile, the profiles are listed by index
+	for i := 0; i < nvml.GPU_INSTANCE_PROFILE_COUNT; i++ {
+		profile, ret := device.GetGpuInstanceProfileInfo(i)
+		if ret != nvml.SUCCESS || profile.Id != instanceInfo.ProfileId {
+			continue
+		}
+
+		return &GPUInstanceProfileInfo{
+			MemorySizeMB:        profile.MemorySizeMB,
+			MultiprocessorCount: profile.MultiprocessorCount,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown profile %d of GPU instance %d", instanceInfo.ProfileId, gpuInstanceID)
+}
+
+// PCIeLinkInfo is the generation and the width of the PCIe link of the GPU, as trained and at most
+type PCIeLinkInfo struct {
+	Gen      int
+	MaxGen   int
+	Width    int
+	MaxWidth int
+}
+
+// GetPCIeLinkInfo returns the current and the maximum generation and width of the PCIe link of the GPU
+func GetPCIeLinkInfo(uuid string) (*PCIeLinkInfo, error) {
+	if err := initNVML(); err != nil {
+		return nil, err
+	}
+
+	device, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+
+	var info PCIeLinkInfo
+	for _, field := range []struct {
+		value *int
+		get   func() (int, nvml.Return)
+	}{
+		{&info.Gen, device.GetCurrPcieLinkGeneration},
+		{&info.MaxGen, device.GetMaxPcieLinkGeneration},
+		{&info.Width, device.GetCurrPcieLinkWidth},
+		{&info.MaxWidth, device.GetMaxPcieLinkWidth},
+	} {
+		*field.value, ret = field.get()
+		if ret != nvml.SUCCESS {
+			return nil, errors.New(nvml.ErrorString(ret))
+		}
+	}
+
+	return &info, nil
+}
+
+// GetBoardPartNumber returns the part number of the board of the GPU, it is empty when the board doesn't report it
+func GetBoardPartNumber(uuid string) (string, error) {
+	if err := initNVML(); err != nil {
+		return "", err
+	}
+
+	device, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return "", errors.New(nvml.ErrorString(ret))
+	}
+
+	partNumber, ret := device.GetBoardPartNumber()
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		return "", nil
+	}
+	if ret != nvml.SUCCESS {
+		return "", errors.New(nvml.ErrorString(ret))
+	}
+
+	return partNumber, nil
+}
+
+// DriverInfo is the version of the driver, of NVML and of CUDA supported by the driver
+type DriverInfo struct {
+	DriverVersion string
+	NVMLVersion   string
+	CUDAVersion   string
+}
+
+// GetDriverInfo returns the versions of the driver, of NVML and of CUDA supported by the driver, e.g. 12.4
+func GetDriverInfo() (*DriverInfo, error) {
+	if err := initNVML(); err != nil {
+		return nil, err
+	}
+
+	var info DriverInfo
+	var ret nvml.Return
+
+	info.DriverVersion, ret = nvml.SystemGetDriverVersion()
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+
+	info.NVMLVersion, ret = nvml.SystemGetNVMLVersion()
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+
+	cudaVersion, ret := nvml.SystemGetCudaDriverVersion()
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+	info.CUDAVersion = fmt.Sprintf("%d.%d", cudaVersion/1000, cudaVersion%1000/10)
+
+	return &info, nil
+}
+
+// DeviceInfo identifies a GPU found by NVML
+type DeviceInfo struct {
+	Index    int
+	UUID     string
+	Name     string
+	PCIBusID string
+}
+
+// GetDevices returns the GPUs found by NVML, by index
+func GetDevices() ([]DeviceInfo, error) {
+	if err := initNVML(); err != nil {
+		return nil, err
+	}
+
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+
+	devices := make([]DeviceInfo, 0, count)
+	for i := 0; i < count; i++ {
+		device, ret := nvml.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			return nil, errors.New(nvml.ErrorString(ret))
+		}
+
+		info := DeviceInfo{Index: i}
+		info.UUID, ret = device.GetUUID()
+		if ret != nvml.SUCCESS {
+			return nil, errors.New(nvml.ErrorString(ret))
+		}
+		// The name and the PCI bus are missing on some integrated GPUs
+		if name, ret := device.GetName(); ret == nvml.SUCCESS {
+			info.Name = name
+		}
+		if pciInfo, ret := device.GetPciInfo(); ret == nvml.SUCCESS {
+			info.PCIBusID = int8ArrayToString(pciInfo.BusId[:])
+		}
+
+		devices = append(devices, info)
+	}
+
+	return devices, nil
+}
+
+// DeviceMetrics holds the core metrics of a GPU read with NVML, the metrics that are not supported by the GPU are
+// nil
+type DeviceMetrics struct {
+	// GPUUtil and MemoryUtil are the utilization of the GPU and of its memory in %
+	GPUUtil    *uint32
+	MemoryUtil *uint32
+	// MemoryUsed and MemoryFree are in bytes
+	MemoryUsed *uint64
+	MemoryFree *uint64
+	// Temperature is in C
+	Temperature *uint32
+	// PowerUsage is in mW
+	PowerUsage *uint32
+	// TotalEnergy is the energy consumed since the driver was loaded, in mJ
+	TotalEnergy *uint64
+}
+
+// GetDeviceMetrics returns the core metrics of the GPU
+func GetDeviceMetrics(uuid string) (*DeviceMetrics, error) {
+	if err := initNVML(); err != nil {
+		return nil, err
+	}
+
+	device, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+
+	var metrics DeviceMetrics
+	if utilization, ret := device.GetUtilizationRates(); ret == nvml.SUCCESS {
+		metrics.GPUUtil = &utilization.Gpu
+		metrics.MemoryUtil = &utilization.Memory
+	}
+	if memory, ret := device.GetMemoryInfo(); ret == nvml.SUCCESS {
+		metrics.MemoryUsed = &memory.Used
+		metrics.MemoryFree = &memory.Free
+	}
+	if temperature, ret := device.GetTemperature(nvml.TEMPERATURE_GPU); ret == nvml.SUCCESS {
+		metrics.Temperature = &temperature
+	}
+	if power, ret := device.GetPowerUsage(); ret == nvml.SUCCESS {
+		metrics.PowerUsage = &power
+	}
+	if energy, ret := device.GetTotalEnergyConsumption(); ret == nvml.SUCCESS {
+		metrics.TotalEnergy = &energy
+	}
+
+	return &metrics, nil
+}
+
+// XidEvents reads the XID errors of the GPUs from the NVML events
+type XidEvents struct {
+	set nvml.EventSet
+}
+
+// NewXidEvents registers the XID errors of the GPUs, the GPUs that don't support the events are ignored
+func NewXidEvents(uuids []string) (*XidEvents, error) {
+	if err := initNVML(); err != nil {
+		return nil, err
+	}
+
+	set, ret := nvml.EventSetCreate()
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+
+	for _, uuid := range uuids {
+		device, ret := nvml.DeviceGetHandleByUUID(uuid)
+		if ret != nvml.SUCCESS {
+			set.Free()
+			return nil, errors.New(nvml.ErrorString(ret))
+		}
+
+		ret = device.RegisterEvents(nvml.EventTypeXidCriticalError, set)
+		if ret == nvml.ERROR_NOT_SUPPORTED {
+			logrus.Warnf("The XID errors of GPU %s are not supported by NVML", uuid)
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			set.Free()
+			return nil, errors.New(nvml.ErrorString(ret))
+		}
+	}
+
+	return &XidEvents{set: set}, nil
+}
+
+// Read returns the last XID error of the GPUs that got one since the previous read, by UUID, without waiting
+func (e *XidEvents) Read() (map[string]uint64, error) {
+	xids := map[string]uint64{}
+	for {
+		event, ret := e.set.Wait(0)
+		if ret == nvml.ERROR_TIMEOUT {
+			return xids, nil
+		}
+		if ret != nvml.SUCCESS {
+			return xids, errors.New(nvml.ErrorString(ret))
+		}
+		if event.EventType != nvml.EventTypeXidCriticalError {
+			continue
+		}
+
+		uuid, ret := event.Device.GetUUID()
+		if ret != nvml.SUCCESS {
+			return xids, errors.New(nvml.ErrorString(ret))
+		}
+		xids[uuid] = event.EventData
+	}
+}
+
+func (e *XidEvents) Close() {
+	e.set.Free()
+}
+
+func int8ArrayToString(chars []int8) string {
+	var b strings.Builder
+	for _, c := range chars {
+		if c == 0 {
+			break
+		}
+		b.WriteByte(byte(c))
+	}
+	return b.String()
+}
@@ -33,6 +33,9 @@ type OS interface {
 	Stat(name string) (os.FileInfo, error)
 	TempDir() string
 	ReadDir(name string) ([]os.DirEntry, error)
+	Chmod(name string, mode os.FileMode) error
+	MkdirAll(path string, perm os.FileMode) error
+	WriteFile(name string, data []byte, perm os.FileMode) error
 }
 
 type RealOS struct{}
@@ -80,3 +83,15 @@ func (RealOS) Remove(name string) error {
 func (RealOS) ReadDir(name string) ([]os.DirEntry, error) {
 	return os.ReadDir(name)
 }
+
+func (RealOS) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (RealOS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (RealOS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
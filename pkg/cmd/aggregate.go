@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/NVIDIA/dcgm-exporter/pkg/dcgmexporter"
+)
+
+var (
+	aggregateMinBackoff = time.Second
+	aggregateMaxBackoff = time.Minute
+)
+
+// aggregateChildArgs returns the arguments of the exporter collecting the metrics of the hostengine: the arguments of
+// the aggregating exporter, connecting to the hostengine and serving the metrics on the socket only.
+func aggregateChildArgs(args []string, hostengine, socket string) []string {
+	var childArgs []string
+
+	// The values of a list are appended, the hostengines are removed rather than overridden
+	for i := 0; i < len(args); i++ {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || name != CLIRemoteHostengines {
+			childArgs = append(childArgs, args[i])
+			continue
+		}
+		if !hasValue {
+			// The value is the next argument
+			i++
+		}
+	}
+
+	// The last value of a flag overrides the previous ones, the empty list disables the aggregation in the
+	// configuration file
+	childArgs = append(childArgs,
+		"--"+CLIRemoteHostengines+"=",
+		"--"+CLIRemoteHEInfo+"="+hostengine,
+		"--"+CLIWebListenUnixSocket+"="+socket,
+		"--"+CLIWebConfigFile+"=",
+		"--"+CLIWebTLSCert+"=",
+		"--"+CLIWebTLSKey+"=",
+		"--"+CLIWebTLSClientCA+"=",
+		"--"+CLIWebBasicAuthUsersFile+"=",
+		"--"+CLIWebBearerTokenFile+"=",
+	)
+	if runtime.GOOS == "linux" {
+		childArgs = append(childArgs, "--"+CLIWebSystemdSocket+"=false")
+	}
+
+	return childArgs
+}
+
+// aggregateChildEnv returns the environment of the exporter collecting the metrics of a hostengine, without the
+// hostengines to aggregate.
+func aggregateChildEnv(env []string) []string {
+	var childEnv []string
+	for _, variable := range env {
+		if !strings.HasPrefix(variable, "DCGM_EXPORTER_REMOTE_HOSTENGINES=") {
+			childEnv = append(childEnv, variable)
+		}
+	}
+
+	return childEnv
+}
+
+// aggregateHostname returns the hostname of the hostengine, labelling the metrics of its exporter.
+func aggregateHostname(hostengine string) string {
+	host, _, err := net.SplitHostPort(hostengine)
+	if err != nil {
+		return hostengine
+	}
+
+	return host
+}
+
+// runAggregateDCGMExporter runs an exporter per remote hostengine, as DCGM connects to a single hostengine per
+// process, and serves their metrics merged, until the exporter is stopped.
+func runAggregateDCGMExporter(config *dcgmexporter.Config, sigs chan os.Signal) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the executable of the exporter: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "dcgm-exporter-aggregate-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		targets []dcgmexporter.AggregateTarget
+		wg      sync.WaitGroup
+	)
+	stop := make(chan interface{})
+
+	for i, hostengine := range config.RemoteHostengines {
+		target := dcgmexporter.AggregateTarget{
+			Hostengine: hostengine,
+			Socket:     filepath.Join(dir, fmt.Sprintf("hostengine-%d.sock", i)),
+		}
+		targets = append(targets, target)
+
+		wg.Add(1)
+		go runAggregateChild(executable, target, stop, &wg)
+	}
+
+	logrus.Infof("Aggregating the metrics of the hostengines: %s", strings.Join(config.RemoteHostengines, ", "))
+
+	ch := make(chan string, 10)
+
+	wg.Add(1)
+	go dcgmexporter.NewAggregator(config, targets).Run(ch, stop, &wg)
+
+	server, cleanup, err := dcgmexporter.NewMetricsServer(config, ch, dcgmexporter.NewRegistry())
+	defer cleanup()
+	if err != nil {
+		close(stop)
+		wg.Wait()
+		return err
+	}
+
+	wg.Add(1)
+	go server.Run(stop, &wg)
+
+	for sig := range sigs {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		logrus.Info("Reload is not supported when aggregating hostengines, ignoring SIGHUP")
+	}
+
+	close(stop)
+	return dcgmexporter.WaitWithTimeout(&wg, 5*time.Second)
+}
+
+// runAggregateChild runs the exporter of the hostengine, and starts it again with an exponential backoff when it
+// exits, e.g. while the hostengine is unreachable.
+func runAggregateChild(executable string, target dcgmexporter.AggregateTarget, stop chan interface{},
+	wg *sync.WaitGroup,
+) {
+	defer wg.Done()
+
+	var backoff time.Duration
+	for {
+		cmd := exec.Command(executable, aggregateChildArgs(os.Args[1:], target.Hostengine, target.Socket)...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(aggregateChildEnv(os.Environ()), "NODE_NAME="+aggregateHostname(target.Hostengine))
+
+		started := time.Now()
+		err := cmd.Start()
+		if err == nil {
+			done := make(chan error, 1)
+			go func() {
+				done <- cmd.Wait()
+			}()
+
+			select {
+			case <-stop:
+				_ = cmd.Process.Signal(syscall.SIGTERM)
+				<-done
+				return
+			case err = <-done:
+			}
+		}
+
+		// The backoff starts again when the exporter ran long enough to be considered healthy
+		if time.Since(started) > aggregateMaxBackoff {
+			backoff = 0
+		}
+		if backoff == 0 {
+			backoff = aggregateMinBackoff
+		} else {
+			backoff = min(2*backoff, aggregateMaxBackoff)
+		}
+
+		logrus.WithError(err).Errorf("The exporter of hostengine '%s' exited, restarting it in %s",
+			target.Hostengine, backoff)
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/NVIDIA/dcgm-exporter/pkg/dcgmexporter"
+)
+
+func TestAggregateChildArgs(t *testing.T) {
+	args := aggregateChildArgs([]string{"-f", "/etc/counters.csv", "--remote-hostengines", "node-1:5555,node-2:5555",
+		"--web-config-file", "/etc/web.yaml", "--remote-hostengines=node-3:5555"}, "node-2:5555", "/tmp/hostengine-1.sock")
+
+	// The exporter of the hostengine is configured as the aggregating exporter, except for the hostengine and the
+	// listener
+	var config *dcgmexporter.Config
+	app := NewApp()
+	app.Action = func(c *cli.Context) (err error) {
+		config, err = contextToConfig(c)
+		return err
+	}
+	require.NoError(t, app.Run(append([]string{"dcgm-exporter"}, args...)))
+
+	assert.Equal(t, "/etc/counters.csv", config.CollectorsFile)
+	assert.Empty(t, config.RemoteHostengines)
+	assert.True(t, config.UseRemoteHE)
+	assert.Equal(t, "node-2:5555", config.RemoteHEInfo)
+	assert.Equal(t, "/tmp/hostengine-1.sock", config.WebListenUnixSocket)
+	assert.Empty(t, config.WebConfigFile)
+}
+
+func TestAggregateChildEnv(t *testing.T) {
+	assert.Equal(t, []string{"PATH=/usr/bin", "NODE_NAME=node"},
+		aggregateChildEnv([]string{"PATH=/usr/bin", "DCGM_EXPORTER_REMOTE_HOSTENGINES=node-1:5555", "NODE_NAME=node"}))
+}
+
+func TestAggregateHostname(t *testing.T) {
+	assert.Equal(t, "node-1", aggregateHostname("node-1:5555"))
+	assert.Equal(t, "10.0.0.1", aggregateHostname("10.0.0.1:5555"))
+	assert.Equal(t, "node-1", aggregateHostname("node-1"))
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"runtime/debug"
 	"slices"
@@ -43,6 +44,7 @@ const (
                              This is our recommended option for single or mixed MIG Strategies.
 		{{.MajorKey}}:0,1 = monitor GPUs 0 and 1
 		{{.MinorKey}}:0,2-4 = monitor GPU instances 0, 2, 3, and 4.
+		0,2,GPU-<uuid>,MIG-<uuid> = monitor GPUs 0 and 2, the GPU and the GPU instance with these UUIDs.
 
 	NOTE 1: -i cannot be specified unless MIG mode is enabled.
 	NOTE 2: Any time indices are specified, those indices must exist on the system.
@@ -74,6 +76,129 @@ const (
 	CLIDCGMLogLevel               = "dcgm-log-level"
 	CLIPodResourcesKubeletSocket  = "pod-resources-kubelet-socket"
 	CLIHPCJobMappingDir           = "hpc-job-mapping-dir"
+	CLIKubernetesPodLabels        = "kubernetes-pod-labels"
+	CLIKubernetesPodAnnotations   = "kubernetes-pod-annotations"
+	CLIKubernetesPodOwner         = "kubernetes-pod-owner"
+	CLIKubernetesGPUAllocation    = "kubernetes-gpu-allocation"
+	CLIDevicePluginConfig         = "device-plugin-config"
+	CLIKubernetesDeviceIDParsers  = "kubernetes-device-id-parsers"
+	CLIKubernetesNamespaces       = "kubernetes-namespace-allowlist"
+	CLIKubernetesPodLabelSelector = "kubernetes-pod-label-selector"
+	CLIKubernetesPodFilterMode    = "kubernetes-pod-filter-mode"
+	CLIKubernetesPodAggregation   = "kubernetes-pod-aggregation"
+	CLIKubernetesVirtualGPUs      = "kubernetes-virtual-gpus"
+	CLIRemoteWriteURL             = "remote-write-url"
+	CLIRemoteWriteBearerTokenFile = "remote-write-bearer-token-file"
+	CLIRemoteWriteUsername        = "remote-write-username"
+	CLIRemoteWritePasswordFile    = "remote-write-password-file"
+	CLIRemoteWriteTLSCAFile       = "remote-write-tls-ca-file"
+	CLIRemoteWriteTLSCertFile     = "remote-write-tls-cert-file"
+	CLIRemoteWriteTLSKeyFile      = "remote-write-tls-key-file"
+	CLIRemoteWriteMaxRetries      = "remote-write-max-retries"
+	CLIOTLPEndpoint               = "otlp-endpoint"
+	CLIOTLPProtocol               = "otlp-protocol"
+	CLIOTLPInsecure               = "otlp-insecure"
+	CLIOTLPHeaders                = "otlp-headers"
+	CLIOTLPClusterName            = "otlp-cluster-name"
+	CLIOTLPResourceAttributes     = "otlp-resource-attributes"
+	CLIStatsDAddress              = "statsd-address"
+	CLIStatsDPrefix               = "statsd-prefix"
+	CLIStatsDTags                 = "statsd-tags"
+	CLIKafkaBrokers               = "kafka-brokers"
+	CLIKafkaTopic                 = "kafka-topic"
+	CLIKafkaFormat                = "kafka-format"
+	CLIKafkaTLS                   = "kafka-tls"
+	CLIKafkaTLSCAFile             = "kafka-tls-ca-file"
+	CLIKafkaTLSCertFile           = "kafka-tls-cert-file"
+	CLIKafkaTLSKeyFile            = "kafka-tls-key-file"
+	CLIKafkaSASLUsername          = "kafka-sasl-username"
+	CLIKafkaSASLPasswordFile      = "kafka-sasl-password-file"
+	CLIKubernetesExemplars        = "kubernetes-exemplars"
+	CLIOpenMetrics                = "openmetrics"
+	CLIRelabelConfig              = "relabel-config"
+	CLILabelAllowlist             = "label-allowlist"
+	CLIJobStats                   = "job-stats"
+	CLISlurmJobMapping            = "slurm-job-mapping"
+	CLISlurmJobLabels             = "slurm-job-labels"
+	CLIJobMapDir                  = "job-map-dir"
+	CLIContainerMapping           = "container-mapping"
+	CLIDockerSocket               = "docker-socket"
+	CLIContainerdStateDir         = "containerd-state-dir"
+	CLIWebTLSCert                 = "web-tls-cert"
+	CLIWebTLSKey                  = "web-tls-key"
+	CLIWebTLSClientCA             = "web-tls-client-ca"
+	CLIWebBasicAuthUsersFile      = "web-basic-auth-users-file"
+	CLIWebBearerTokenFile         = "web-bearer-token-file"
+	CLIEnableDebugEndpoints       = "enable-debug-endpoints"
+	CLIWebListenUnixSocket        = "web-listen-unix-socket"
+	CLIWebListenUnixSocketMode    = "web-listen-unix-socket-mode"
+	CLIWatchCollectors            = "watch-collectors"
+	CLIWebEnableReload            = "web-enable-reload"
+	CLIConfigFile                 = "config"
+	CLISimulate                   = "simulate"
+	CLIRecord                     = "record"
+	CLIReplay                     = "replay"
+	CLILogSampleInterval          = "log-sample-interval"
+	CLIMonotonicCounters          = "monotonic-counters"
+	CLIDerivedMetrics             = "derived-metrics"
+	CLIUtilizationMode            = "utilization-mode"
+	CLIMIGRefreshInterval         = "mig-refresh-interval"
+	CLIDCGMCheckInterval          = "dcgm-check-interval"
+	CLIRemoteHostengines          = "remote-hostengines"
+	CLICollectWorkers             = "collect-workers"
+	CLIScrapeCacheMaxAge          = "scrape-cache-max-age"
+	CLIBackgroundCollection       = "background-collection"
+	CLIGPUTopologyLabels          = "gpu-topology-labels"
+	CLIEnergyCounters             = "energy-counters"
+	CLIEnergyAveragePower         = "energy-average-power"
+	CLIDiag                       = "diag"
+	CLIDiagInterval               = "diag-interval"
+	CLIDiagLevel                  = "diag-level"
+	CLIKubernetesEvents           = "kubernetes-events"
+	CLIWebhookURLs                = "webhook-urls"
+	CLIWebhookSecretFile          = "webhook-secret-file"
+	CLIWebhookMaxRetries          = "webhook-max-retries"
+	CLIReadinessGating            = "readiness-gating"
+	CLINVMLFallback               = "nvml-fallback"
+	CLITegrastats                 = "tegrastats"
+	CLINoResourceDetection        = "kubernetes-no-resource-detection"
+	CLIKubernetesSharingMetrics   = "kubernetes-sharing-metrics"
+	CLIKubernetesMappingAPI       = "kubernetes-mapping-api"
+	CLITransformPlugins           = "transform-plugins"
+	CLITransformHooks             = "transform-hooks"
+	CLIWebMaxRequestsInFlight     = "web-max-requests-in-flight"
+	CLIWebClientRateLimit         = "web-client-rate-limit"
+	CLIWebClientRateBurst         = "web-client-rate-burst"
+	CLIHostname                   = "hostname"
+	CLIExternalLabels             = "external-labels"
+	CLIHostengineDetection        = "hostengine-detection"
+	CLIDCGMUpdateFreq             = "dcgm-update-freq"
+	CLIDCGMMaxKeepAge             = "dcgm-max-keep-age"
+	CLIDCGMMaxKeepSamples         = "dcgm-max-keep-samples"
+	CLIProfilingMultiplexing      = "profiling-multiplexing"
+	CLIHealthScoreRules           = "health-score-rules"
+	CLIStateFile                  = "state-file"
+	CLIStateRetention             = "state-retention"
+	CLIMetricNames                = "metric-names"
+	CLIExternalLabelsDir          = "external-labels-dir"
+	CLIMIGStrategy                = "mig-strategy"
+	CLIKubeletCallTimeout         = "kubelet-call-timeout"
+	CLIKubeletKeepalive           = "kubelet-keepalive"
+	CLIKubernetesAttributeNames   = "kubernetes-attribute-names"
+	CLIProfile                    = "profile"
+	CLISampleTimestamps           = "sample-timestamps"
+	CLISampleAge                  = "sample-age"
+	CLIMIGRollup                  = "mig-rollup"
+	CLIShard                      = "shard"
+	CLIShardBy                    = "shard-by"
+	CLIWebCompression             = "web-compression"
+	CLIFabricLeaderElection       = "fabric-leader-election"
+	CLIFabricLease                = "fabric-lease"
+	CLIKubernetesConfig           = "kubernetes-config"
+	CLIKubernetesConfigKind       = "kubernetes-config-kind"
+	CLIAdminAPI                   = "admin-api"
+	CLIAdminAPITokenFile          = "admin-api-token-file"
+	CLIKubernetesPodAllocation    = "kubernetes-pod-allocation"
 )
 
 func NewApp(buildVersion ...string) *cli.App {
@@ -91,11 +216,11 @@ func NewApp(buildVersion ...string) *cli.App {
 	DeviceUsageStr := deviceUsageBuffer.String()
 
 	c.Flags = []cli.Flag{
-		&cli.StringFlag{
+		&cli.StringSliceFlag{
 			Name:    CLIFieldsFile,
 			Aliases: []string{"f"},
-			Usage:   "Path to the file, that contains the DCGM fields to collect",
-			Value:   "/etc/dcgm-exporter/default-counters.csv",
+			Usage:   "Path to the file, that contains the DCGM fields to collect. When set several times, the fields of a file override those of the previous files.",
+			Value:   cli.NewStringSlice("/etc/dcgm-exporter/default-counters.csv"),
 			EnvVars: []string{"DCGM_EXPORTER_COLLECTORS"},
 		},
 		&cli.StringFlag{
@@ -237,169 +362,1429 @@ func NewApp(buildVersion ...string) *cli.App {
 			Usage:   "Path to HPC job mapping file directory used for mapping GPUs to jobs.",
 			EnvVars: []string{"DCGM_HPC_JOB_MAPPING_DIR"},
 		},
-	}
-
-	if runtime.GOOS == "linux" {
-		c.Flags = append(c.Flags, &cli.BoolFlag{
-			Name:    CLIWebSystemdSocket,
+		&cli.StringSliceFlag{
+			Name:    CLIKubernetesPodLabels,
+			Usage:   "Comma-separated list of pod label keys to attach to metrics as 'label_<key>' attributes when kubernetes mapping is enabled.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_POD_LABELS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIKubernetesPodAnnotations,
+			Usage:   "Comma-separated list of pod annotation keys to attach to metrics as 'annotation_<key>' attributes when kubernetes mapping is enabled.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_POD_ANNOTATIONS"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIKubernetesPodOwner,
 			Value:   false,
-			Usage:   "Use systemd socket activation listeners instead of port listeners (Linux only).",
-			EnvVars: []string{"DCGM_EXPORTER_SYSTEMD_SOCKET"},
-		})
-	} else {
-		err := "dcgm-exporter is only supported on Linux."
-		logrus.Fatal(err)
-		return nil
-	}
-
-	c.Action = func(c *cli.Context) error {
-		return action(c)
-	}
-
-	return c
-}
-
-func newOSWatcher(sigs ...os.Signal) chan os.Signal {
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, sigs...)
-
-	return sigChan
-}
-
-func action(c *cli.Context) (err error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	return stdout.Capture(ctx, func() error {
-		// The purpose of this function is to capture any panic that may occur
-		// during initialization and return an error.
-		defer func() {
-			if r := recover(); r != nil {
-				logrus.WithField(dcgmexporter.LoggerStackTrace, string(debug.Stack())).Error("Encountered a failure.")
-				err = fmt.Errorf("encountered a failure; err: %v", r)
-			}
-		}()
-		return startDCGMExporter(c, cancel)
-	})
-}
-
-func startDCGMExporter(c *cli.Context, cancel context.CancelFunc) error {
-restart:
+			Usage:   "Attach the kind and name of the pod's top-level owner (e.g. Deployment, StatefulSet, Job) to metrics when kubernetes mapping is enabled.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_POD_OWNER"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIKubernetesGPUAllocation,
+			Value:   false,
+			Usage:   "Query the kubelet for allocatable GPUs, emit DCGM_EXPORTER_GPU_ALLOCATED and mark GPUs not assigned to any pod with allocated=\"false\" when kubernetes mapping is enabled.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_GPU_ALLOCATION"},
+		},
+		&cli.StringFlag{
+			Name:    CLIDevicePluginConfig,
+			Value:   "",
+			Usage:   "Path to the NVIDIA device plugin config file, used to attribute GPUs shared with MPS and to report the MPS limits of every pod.",
+			EnvVars: []string{"DCGM_EXPORTER_DEVICE_PLUGIN_CONFIG"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIKubernetesDeviceIDParsers,
+			Usage:   "Comma-separated list of device ID parsers used to attribute GPUs shared by third-party device plugins. Possible values: hami, volcano.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_DEVICE_ID_PARSERS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIKubernetesNamespaces,
+			Usage:   "Comma-separated list of namespaces whose pods GPU metrics are attributed to. All namespaces are allowed when empty.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_NAMESPACE_ALLOWLIST"},
+		},
+		&cli.StringFlag{
+			Name:    CLIKubernetesPodLabelSelector,
+			Value:   "",
+			Usage:   "Label selector (e.g. 'team=ml,tier!=system') of the pods GPU metrics are attributed to.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_POD_LABEL_SELECTOR"},
+		},
+		&cli.StringFlag{
+			Name:  CLIKubernetesPodFilterMode,
+			Value: string(dcgmexporter.PodFilterModeAttribute),
+			Usage: fmt.Sprintf("Choose what happens to the metrics of GPUs used by pods not matching the namespace allowlist and the label selector. Possible values: '%s' (exported without pod attributes), '%s' (not exported)",
+				dcgmexporter.PodFilterModeAttribute, dcgmexporter.PodFilterModeDrop),
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_POD_FILTER_MODE"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIKubernetesPodAggregation,
+			Value:   false,
+			Usage:   "Emit pod-level rollups (e.g. DCGM_POD_GPU_UTIL, DCGM_POD_FB_USED) of the metrics of the GPUs held by each pod when kubernetes mapping is enabled.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_POD_AGGREGATION"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIKubernetesVirtualGPUs,
+			Value:   false,
+			Usage:   "Attribute the metrics of a GPU shared between pods (time-slicing, MPS, GKE time-sharing) to every pod using it, with a vgpu label holding the replica, instead of a single pod.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_VIRTUAL_GPUS"},
+		},
+		&cli.StringFlag{
+			Name:    CLIRemoteWriteURL,
+			Value:   "",
+			Usage:   "Push the metrics to this Prometheus remote_write endpoint on every collection interval, e.g. for nodes that can't be scraped.",
+			EnvVars: []string{"DCGM_EXPORTER_REMOTE_WRITE_URL"},
+		},
+		&cli.StringFlag{
+			Name:    CLIRemoteWriteBearerTokenFile,
+			Value:   "",
+			Usage:   "File containing the bearer token sent to the remote_write endpoint.",
+			EnvVars: []string{"DCGM_EXPORTER_REMOTE_WRITE_BEARER_TOKEN_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    CLIRemoteWriteUsername,
+			Value:   "",
+			Usage:   "Username for basic authentication to the remote_write endpoint.",
+			EnvVars: []string{"DCGM_EXPORTER_REMOTE_WRITE_USERNAME"},
+		},
+		&cli.StringFlag{
+			Name:    CLIRemoteWritePasswordFile,
+			Value:   "",
+			Usage:   "File containing the password for basic authentication to the remote_write endpoint.",
+			EnvVars: []string{"DCGM_EXPORTER_REMOTE_WRITE_PASSWORD_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    CLIRemoteWriteTLSCAFile,
+			Value:   "",
+			Usage:   "CA certificate used to verify the remote_write endpoint.",
+			EnvVars: []string{"DCGM_EXPORTER_REMOTE_WRITE_TLS_CA_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    CLIRemoteWriteTLSCertFile,
+			Value:   "",
+			Usage:   "Client certificate for mTLS authentication to the remote_write endpoint.",
+			EnvVars: []string{"DCGM_EXPORTER_REMOTE_WRITE_TLS_CERT_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    CLIRemoteWriteTLSKeyFile,
+			Value:   "",
+			Usage:   "Client key for mTLS authentication to the remote_write endpoint.",
+			EnvVars: []string{"DCGM_EXPORTER_REMOTE_WRITE_TLS_KEY_FILE"},
+		},
+		&cli.UintFlag{
+			Name:    CLIRemoteWriteMaxRetries,
+			Value:   3,
+			Usage:   "Number of times a failed push is retried, with an exponential backoff, before it is dropped.",
+			EnvVars: []string{"DCGM_EXPORTER_REMOTE_WRITE_MAX_RETRIES"},
+		},
+		&cli.StringFlag{
+			Name:    CLIOTLPEndpoint,
+			Value:   "",
+			Usage:   "Push the metrics to this OpenTelemetry collector endpoint on every collection interval, e.g. 'collector:4317' for gRPC or 'http://collector:4318/v1/metrics' for HTTP.",
+			EnvVars: []string{"DCGM_EXPORTER_OTLP_ENDPOINT"},
+		},
+		&cli.StringFlag{
+			Name:  CLIOTLPProtocol,
+			Value: string(dcgmexporter.OTLPProtocolGRPC),
+			Usage: fmt.Sprintf("Protocol used to push the metrics to the OpenTelemetry collector. Possible values: '%s', '%s'",
+				dcgmexporter.OTLPProtocolGRPC, dcgmexporter.OTLPProtocolHTTP),
+			EnvVars: []string{"DCGM_EXPORTER_OTLP_PROTOCOL"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIOTLPInsecure,
+			Value:   false,
+			Usage:   "Disable TLS for the gRPC connection to the OpenTelemetry collector.",
+			EnvVars: []string{"DCGM_EXPORTER_OTLP_INSECURE"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIOTLPHeaders,
+			Usage:   "Comma-separated list of key=value headers sent to the OpenTelemetry collector, e.g. for authentication.",
+			EnvVars: []string{"DCGM_EXPORTER_OTLP_HEADERS"},
+		},
+		&cli.StringFlag{
+			Name:    CLIOTLPClusterName,
+			Value:   "",
+			Usage:   "Cluster name added to the OTLP resource as k8s.cluster.name.",
+			EnvVars: []string{"DCGM_EXPORTER_OTLP_CLUSTER_NAME"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIOTLPResourceAttributes,
+			Usage:   "Comma-separated list of key=value attributes added to the OTLP resource.",
+			EnvVars: []string{"DCGM_EXPORTER_OTLP_RESOURCE_ATTRIBUTES"},
+		},
+		&cli.StringFlag{
+			Name:    CLIStatsDAddress,
+			Value:   "",
+			Usage:   "Send the metrics to this StatsD server on every collection interval, e.g. 'udp://localhost:8125' or 'unix:///var/run/datadog/dsd.socket'.",
+			EnvVars: []string{"DCGM_EXPORTER_STATSD_ADDRESS"},
+		},
+		&cli.StringFlag{
+			Name:    CLIStatsDPrefix,
+			Value:   "",
+			Usage:   "Prefix added to the name of the metrics sent to StatsD, e.g. 'gpu.'.",
+			EnvVars: []string{"DCGM_EXPORTER_STATSD_PREFIX"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIStatsDTags,
+			Usage:   "Comma-separated list of key:value tags added to every metric sent to StatsD.",
+			EnvVars: []string{"DCGM_EXPORTER_STATSD_TAGS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIKafkaBrokers,
+			Usage:   "Comma-separated list of Kafka brokers the metrics are produced to on every collection interval, e.g. 'kafka-0:9092,kafka-1:9092'.",
+			EnvVars: []string{"DCGM_EXPORTER_KAFKA_BROKERS"},
+		},
+		&cli.StringFlag{
+			Name:    CLIKafkaTopic,
+			Value:   "dcgm-exporter",
+			Usage:   "Kafka topic the metrics are produced to.",
+			EnvVars: []string{"DCGM_EXPORTER_KAFKA_TOPIC"},
+		},
+		&cli.StringFlag{
+			Name:    CLIKafkaFormat,
+			Value:   string(dcgmexporter.KafkaFormatJSON),
+			Usage:   "Format of the Kafka messages; possible values: 'json', 'avro'.",
+			EnvVars: []string{"DCGM_EXPORTER_KAFKA_FORMAT"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIKafkaTLS,
+			Value:   false,
+			Usage:   "Connect to the Kafka brokers with TLS.",
+			EnvVars: []string{"DCGM_EXPORTER_KAFKA_TLS"},
+		},
+		&cli.StringFlag{
+			Name:    CLIKafkaTLSCAFile,
+			Value:   "",
+			Usage:   "CA certificate used to verify the Kafka brokers.",
+			EnvVars: []string{"DCGM_EXPORTER_KAFKA_TLS_CA_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    CLIKafkaTLSCertFile,
+			Value:   "",
+			Usage:   "Client certificate used to authenticate with the Kafka brokers.",
+			EnvVars: []string{"DCGM_EXPORTER_KAFKA_TLS_CERT_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    CLIKafkaTLSKeyFile,
+			Value:   "",
+			Usage:   "Client key used to authenticate with the Kafka brokers.",
+			EnvVars: []string{"DCGM_EXPORTER_KAFKA_TLS_KEY_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    CLIKafkaSASLUsername,
+			Value:   "",
+			Usage:   "Username used for SASL/PLAIN authentication with the Kafka brokers.",
+			EnvVars: []string{"DCGM_EXPORTER_KAFKA_SASL_USERNAME"},
+		},
+		&cli.StringFlag{
+			Name:    CLIKafkaSASLPasswordFile,
+			Value:   "",
+			Usage:   "File containing the password used for SASL/PLAIN authentication with the Kafka brokers.",
+			EnvVars: []string{"DCGM_EXPORTER_KAFKA_SASL_PASSWORD_FILE"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIKubernetesExemplars,
+			Value:   false,
+			Usage:   "Attach exemplars with the pod UID and container ID to the metrics of GPUs assigned to pods, served to scrapers that accept the OpenMetrics format.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_EXEMPLARS"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIOpenMetrics,
+			Value:   false,
+			Usage:   "Serve the OpenMetrics format, with _created series for counters, to scrapers that accept it.",
+			EnvVars: []string{"DCGM_EXPORTER_OPENMETRICS"},
+		},
+		&cli.StringFlag{
+			Name:    CLIRelabelConfig,
+			Value:   "",
+			Usage:   "Path to a YAML file of rules to rename, relabel or drop the GPU metrics before they are exported.",
+			EnvVars: []string{"DCGM_EXPORTER_RELABEL_CONFIG"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLILabelAllowlist,
+			Usage:   "Comma-separated list of the labels kept on the GPU metrics, either a label name for all the fields or FIELD:label for one field, e.g. gpu,UUID,DCGM_FI_DEV_GPU_UTIL:pod. The labels of a field replace the global ones.",
+			EnvVars: []string{"DCGM_EXPORTER_LABEL_ALLOWLIST"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIJobStats,
+			Value:   false,
+			Usage:   "Serve /jobs/start and /jobs/stop to bracket jobs, and export the energy, utilization and memory summaries of the jobs.",
+			EnvVars: []string{"DCGM_EXPORTER_JOB_STATS"},
+		},
+		&cli.BoolFlag{
+			Name:    CLISlurmJobMapping,
+			Value:   false,
+			Usage:   "Add the Slurm jobs running on the GPUs of the node to the metric labels, read with squeue and scontrol.",
+			EnvVars: []string{"DCGM_EXPORTER_SLURM_JOB_MAPPING"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLISlurmJobLabels,
+			Usage:   "Comma-separated list of the Slurm job labels added to the metrics, among job_id, user and partition. All of them by default.",
+			EnvVars: []string{"DCGM_EXPORTER_SLURM_JOB_LABELS"},
+		},
+		&cli.StringFlag{
+			Name:    CLIJobMapDir,
+			Value:   "",
+			Usage:   "Path to a directory of files named after GPU UUIDs, holding key=value labels added to the metrics of the GPUs, e.g. /var/run/dcgm-exporter/job-maps.",
+			EnvVars: []string{"DCGM_EXPORTER_JOB_MAP_DIR"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIContainerMapping,
+			Value:   false,
+			Usage:   "Add the name and the image of the Docker or containerd containers running processes on the GPUs to the metric labels, when no kubelet socket is present.",
+			EnvVars: []string{"DCGM_EXPORTER_CONTAINER_MAPPING"},
+		},
+		&cli.StringFlag{
+			Name:    CLIDockerSocket,
+			Value:   "/var/run/docker.sock",
+			Usage:   "Path to the Docker socket used to inspect the containers. Empty to disable Docker.",
+			EnvVars: []string{"DCGM_EXPORTER_DOCKER_SOCKET"},
+		},
+		&cli.StringFlag{
+			Name:    CLIContainerdStateDir,
+			Value:   "/run/containerd/io.containerd.runtime.v2.task",
+			Usage:   "Path to the directory of the containerd task bundles used to inspect the containers. Empty to disable containerd.",
+			EnvVars: []string{"DCGM_EXPORTER_CONTAINERD_STATE_DIR"},
+		},
+		&cli.StringFlag{
+			Name:    CLIWebTLSCert,
+			Value:   "",
+			Usage:   "Path to the TLS certificate of the metrics endpoint, instead of a web config file.",
+			EnvVars: []string{"DCGM_EXPORTER_WEB_TLS_CERT"},
+		},
+		&cli.StringFlag{
+			Name:    CLIWebTLSKey,
+			Value:   "",
+			Usage:   "Path to the TLS key of the metrics endpoint, instead of a web config file.",
+			EnvVars: []string{"DCGM_EXPORTER_WEB_TLS_KEY"},
+		},
+		&cli.StringFlag{
+			Name:    CLIWebTLSClientCA,
+			Value:   "",
+			Usage:   "Path to the CA certificates verifying the client certificates required by the metrics endpoint (mTLS).",
+			EnvVars: []string{"DCGM_EXPORTER_WEB_TLS_CLIENT_CA"},
+		},
+		&cli.StringFlag{
+			Name:    CLIWebBasicAuthUsersFile,
+			Value:   "",
+			Usage:   "Path to a YAML file with the 'basic_auth_users' of the web config format, mapping the users allowed to scrape the metrics endpoint to their bcrypt hashed passwords.",
+			EnvVars: []string{"DCGM_EXPORTER_WEB_BASIC_AUTH_USERS_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    CLIWebBearerTokenFile,
+			Value:   "",
+			Usage:   "Path to a file with the bearer token allowed to scrape the metrics endpoint.",
+			EnvVars: []string{"DCGM_EXPORTER_WEB_BEARER_TOKEN_FILE"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnableDebugEndpoints,
+			Value:   false,
+			Usage:   "Serve the pprof profiles under /debug/pprof and the state of the collectors and of the pod mapping under /debug/status.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_DEBUG_ENDPOINTS"},
+		},
+		&cli.StringFlag{
+			Name:    CLIWebListenUnixSocket,
+			Value:   "",
+			Usage:   "Path of a Unix domain socket to serve the metrics on instead of the TCP address.",
+			EnvVars: []string{"DCGM_EXPORTER_WEB_LISTEN_UNIX_SOCKET"},
+		},
+		&cli.StringFlag{
+			Name:    CLIWebListenUnixSocketMode,
+			Value:   "0660",
+			Usage:   "Octal permissions of the Unix domain socket.",
+			EnvVars: []string{"DCGM_EXPORTER_WEB_LISTEN_UNIX_SOCKET_MODE"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIWatchCollectors,
+			Value:   false,
+			Usage:   "Reload the counters when the collectors file changes.",
+			EnvVars: []string{"DCGM_EXPORTER_WATCH_COLLECTORS"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIWebEnableReload,
+			Value:   false,
+			Usage:   "Serve the POST /-/reload endpoint reloading the counters.",
+			EnvVars: []string{"DCGM_EXPORTER_WEB_ENABLE_RELOAD"},
+		},
+		&cli.StringFlag{
+			Name:    CLIConfigFile,
+			Value:   "",
+			Usage:   "Path to a YAML configuration file setting the options by name, the command line and the environment take precedence.",
+			EnvVars: []string{"DCGM_EXPORTER_CONFIG"},
+		},
+		&cli.StringFlag{
+			Name:    CLISimulate,
+			Value:   "",
+			Usage:   "Path to a YAML spec of simulated GPUs; DCGM is not used and the metrics have generated values, for testing purposes only.",
+			EnvVars: []string{"DCGM_EXPORTER_SIMULATE"},
+		},
+		&cli.StringFlag{
+			Name:    CLIRecord,
+			Value:   "",
+			Usage:   "Directory where the field values read from DCGM and the system info are written at every collection, for debugging.",
+			EnvVars: []string{"DCGM_EXPORTER_RECORD"},
+		},
+		&cli.StringFlag{
+			Name:    CLIReplay,
+			Value:   "",
+			Usage:   "Directory of a recording to serve in a loop instead of the values read from DCGM, for debugging.",
+			EnvVars: []string{"DCGM_EXPORTER_REPLAY"},
+		},
+		&cli.IntFlag{
+			Name:    CLILogSampleInterval,
+			Value:   int(dcgmexporter.DefaultLogSampleInterval.Milliseconds()),
+			Usage:   "Interval in milliseconds (ms) of the messages logged at every collection when they are unchanged; 0 logs all of them.",
+			EnvVars: []string{"DCGM_EXPORTER_LOG_SAMPLE_INTERVAL"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIMonotonicCounters,
+			Value:   false,
+			Usage:   "Export the cumulative DCGM fields as counters with a _total suffix, increasing across GPU resets.",
+			EnvVars: []string{"DCGM_EXPORTER_MONOTONIC_COUNTERS"},
+		},
+		&cli.StringFlag{
+			Name:    CLIDerivedMetrics,
+			Value:   "",
+			Usage:   "Path to a YAML file of metrics computed from the other metrics of every GPU, at every collection.",
+			EnvVars: []string{"DCGM_EXPORTER_DERIVED_METRICS"},
+		},
+		&cli.StringFlag{
+			Name:  CLIUtilizationMode,
+			Value: string(dcgmexporter.UtilizationModeLegacy),
+			Usage: fmt.Sprintf("Choose the utilization fields exported when the GPUs support the profiling fields. Possible values: '%s' (the fields of the counters file), '%s' (DCGM_FI_DEV_GPU_UTIL and DCGM_FI_DEV_MEM_COPY_UTIL replaced by DCGM_FI_PROF_GR_ENGINE_ACTIVE and DCGM_FI_PROF_DRAM_ACTIVE), '%s' (both of them)",
+				dcgmexporter.UtilizationModeLegacy, dcgmexporter.UtilizationModeProfiling, dcgmexporter.UtilizationModeBoth),
+			EnvVars: []string{"DCGM_EXPORTER_UTILIZATION_MODE"},
+		},
+		&cli.IntFlag{
+			Name:    CLIMIGRefreshInterval,
+			Value:   int(dcgmexporter.DefaultMIGRefreshInterval.Milliseconds()),
+			Usage:   "Interval in milliseconds (ms) at which the MIG instances are checked for changes, reloading the exporter when they are created or destroyed; 0 disables it.",
+			EnvVars: []string{"DCGM_EXPORTER_MIG_REFRESH_INTERVAL"},
+		},
+		&cli.IntFlag{
+			Name:    CLIDCGMCheckInterval,
+			Value:   int(dcgmexporter.DefaultDCGMCheckInterval.Milliseconds()),
+			Usage:   "Interval in milliseconds (ms) at which the connection to DCGM and the GPUs are checked, reinitializing DCGM when the connection is lost or the GPUs change, e.g. after a driver reload or a GPU reset; 0 disables it.",
+			EnvVars: []string{"DCGM_EXPORTER_DCGM_CHECK_INTERVAL"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIRemoteHostengines,
+			Usage:   "Comma-separated list of remote hostengines <HOST>:<PORT> to collect from concurrently, serving their metrics from this exporter, labelled with the host of the hostengine.",
+			EnvVars: []string{"DCGM_EXPORTER_REMOTE_HOSTENGINES"},
+		},
+		&cli.IntFlag{
+			Name:    CLICollectWorkers,
+			Value:   dcgmexporter.DefaultCollectWorkers,
+			Usage:   "Number of GPUs, MIG instances and NvSwitches whose field values are read concurrently in a collection; 1 reads them one after the other.",
+			EnvVars: []string{"DCGM_EXPORTER_COLLECT_WORKERS"},
+		},
+		&cli.IntFlag{
+			Name:    CLIScrapeCacheMaxAge,
+			Value:   0,
+			Usage:   "Age in milliseconds (ms) under which the exporter metrics (DCGM_EXP_*) gathered by a scrape are served again to the next scrapes, e.g. when several Prometheus servers scrape the exporter; 0 gathers them on every scrape.",
+			EnvVars: []string{"DCGM_EXPORTER_SCRAPE_CACHE_MAX_AGE"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIBackgroundCollection,
+			Value:   false,
+			Usage:   "Gather the exporter metrics (DCGM_EXP_*) with the DCGM metrics on every collect interval, serving the last collection to the scrapes and pushing it to the sinks, instead of gathering them on every scrape.",
+			EnvVars: []string{"DCGM_EXPORTER_BACKGROUND_COLLECTION"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIGPUTopologyLabels,
+			Value:   false,
+			Usage:   "Add the NUMA node and the CPU affinity of the GPU to its metrics, as the numa_node and cpu_affinity labels.",
+			EnvVars: []string{"DCGM_EXPORTER_GPU_TOPOLOGY_LABELS"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnergyCounters,
+			Value:   false,
+			Usage:   "Export the energy consumption in J as the DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_JOULES_total counter, increasing across driver reloads.",
+			EnvVars: []string{"DCGM_EXPORTER_ENERGY_COUNTERS"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnergyAveragePower,
+			Value:   false,
+			Usage:   "Export the average power draw since the last collection, from the energy counters, as the DCGM_EXP_AVERAGE_POWER_WATTS gauge.",
+			EnvVars: []string{"DCGM_EXPORTER_ENERGY_AVERAGE_POWER"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIDiag,
+			Value:   false,
+			Usage:   "Run the DCGM diagnostic on the idle GPUs on POST requests to /diag/run and export the results of the tests.",
+			EnvVars: []string{"DCGM_EXPORTER_DIAG"},
+		},
+		&cli.IntFlag{
+			Name:    CLIDiagInterval,
+			Value:   0,
+			Usage:   "Interval in milliseconds at which the diagnostic runs on the idle GPUs with --diag. 0 runs it only on request.",
+			EnvVars: []string{"DCGM_EXPORTER_DIAG_INTERVAL"},
+		},
+		&cli.IntFlag{
+			Name:    CLIDiagLevel,
+			Value:   dcgmexporter.DefaultDiagLevel,
+			Usage:   "Level of the diagnostic, from 1 (quick) to 4 (extended), like dcgmi diag -r.",
+			EnvVars: []string{"DCGM_EXPORTER_DIAG_LEVEL"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIKubernetesEvents,
+			Value:   false,
+			Usage:   "Create Kubernetes events on the node, and on the pods using the GPU, on XID errors, double bit ECC errors and health watch failures.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_EVENTS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIWebhookURLs,
+			Usage:   "Comma-separated list of URLs receiving a JSON payload on XID errors, double bit ECC errors, thermal violations and health watch changes.",
+			EnvVars: []string{"DCGM_EXPORTER_WEBHOOK_URLS"},
+		},
+		&cli.StringFlag{
+			Name:    CLIWebhookSecretFile,
+			Value:   "",
+			Usage:   "File containing the secret signing the webhook payloads with HMAC-SHA256, in the X-DCGM-Exporter-Signature header.",
+			EnvVars: []string{"DCGM_EXPORTER_WEBHOOK_SECRET_FILE"},
+		},
+		&cli.UintFlag{
+			Name:    CLIWebhookMaxRetries,
+			Value:   3,
+			Usage:   "Number of times a failed webhook post is retried, with an exponential backoff, before it is dropped.",
+			EnvVars: []string{"DCGM_EXPORTER_WEBHOOK_MAX_RETRIES"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIReadinessGating,
+			Value:   false,
+			Usage:   "Report the exporter as not ready on /ready, and fail the scrapes, until the first complete collection and, with -k, the first pod mapping.",
+			EnvVars: []string{"DCGM_EXPORTER_READINESS_GATING"},
+		},
+		&cli.BoolFlag{
+			Name:    CLINVMLFallback,
+			Value:   false,
+			Usage:   "Collect the utilization, memory, temperature, power, energy and XID errors of the GPUs with NVML, labeled with source=\"nvml\", when DCGM can't be initialized.",
+			EnvVars: []string{"DCGM_EXPORTER_NVML_FALLBACK"},
+		},
+		&cli.StringFlag{
+			Name:    CLITegrastats,
+			Value:   "",
+			Usage:   "Collect the utilization, memory, temperature and power of the integrated GPU of Jetson modules from this tegrastats binary, e.g. '/usr/bin/tegrastats', instead of DCGM.",
+			EnvVars: []string{"DCGM_EXPORTER_TEGRASTATS"},
+		},
+		&cli.BoolFlag{
+			Name:    CLINoResourceDetection,
+			Value:   false,
+			Usage:   "Only attribute the GPUs of the nvidia.com/gpu, nvidia.com/mig-*, MPS and device ID parser resources, instead of every nvidia.com resource whose device IDs are GPU or MIG device IDs, e.g. renamed by a time-slicing config.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_NO_RESOURCE_DETECTION"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIKubernetesSharingMetrics,
+			Value:   false,
+			Usage:   "Emit DCGM_EXPORTER_GPU_SHARING_REPLICAS, the replicas of the GPUs shared with MPS or time-slicing in the device plugin config, and DCGM_EXPORTER_CONTAINER_GPU_MEMORY_QUOTA_MIB, the memory quota of the containers sharing a GPU with MPS or HAMi, when kubernetes mapping is enabled.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_SHARING_METRICS"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIKubernetesMappingAPI,
+			Value:   false,
+			Usage:   "Serve the attribution of the GPUs and MIG instances to the pods as JSON on GET /v1/mapping, when kubernetes mapping is enabled.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_MAPPING_API"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLITransformPlugins,
+			Usage:   "Comma-separated list of Go plugins exporting a NewTransform func(*dcgmexporter.Config) (dcgmexporter.Transform, error), whose transforms run after the built-in mappings.",
+			EnvVars: []string{"DCGM_EXPORTER_TRANSFORM_PLUGINS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLITransformHooks,
+			Usage:   "Comma-separated list of executables run on every collection after the built-in mappings, reading the metrics as JSON on their stdin and writing them back with their new attributes on their stdout.",
+			EnvVars: []string{"DCGM_EXPORTER_TRANSFORM_HOOKS"},
+		},
+		&cli.IntFlag{
+			Name:    CLIWebMaxRequestsInFlight,
+			Value:   0,
+			Usage:   "Maximum number of requests served concurrently, the others get a 503 response. 0 means no limit.",
+			EnvVars: []string{"DCGM_EXPORTER_WEB_MAX_REQUESTS_IN_FLIGHT"},
+		},
+		&cli.Float64Flag{
+			Name:    CLIWebClientRateLimit,
+			Value:   0,
+			Usage:   "Maximum number of requests per second of every client IP address, the others get a 429 response. 0 means no limit.",
+			EnvVars: []string{"DCGM_EXPORTER_WEB_CLIENT_RATE_LIMIT"},
+		},
+		&cli.IntFlag{
+			Name:    CLIWebClientRateBurst,
+			Value:   5,
+			Usage:   "Number of requests a client may send at once above its rate limit.",
+			EnvVars: []string{"DCGM_EXPORTER_WEB_CLIENT_RATE_BURST"},
+		},
+		&cli.StringFlag{
+			Name:    CLIHostname,
+			Value:   "",
+			Usage:   "Hostname label of the metrics, instead of the NODE_NAME environment variable or the hostname.",
+			EnvVars: []string{"DCGM_EXPORTER_HOSTNAME"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIExternalLabels,
+			Usage:   "Comma-separated list of name=value labels added to every metric, e.g. cluster=prod,region=us-east-1.",
+			EnvVars: []string{"DCGM_EXPORTER_EXTERNAL_LABELS"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIHostengineDetection,
+			Value:   true,
+			Usage:   "Attach to a running nv-hostengine, when -r is not set, instead of running an embedded hostengine.",
+			EnvVars: []string{"DCGM_EXPORTER_HOSTENGINE_DETECTION"},
+		},
+		&cli.IntFlag{
+			Name:  CLIDCGMUpdateFreq,
+			Value: 0,
+			Usage: "How often DCGM samples the fields of every field group, in milliseconds (ms), when shorter than the " +
+				"collect interval of the group. Tighter sampling makes the profiling metrics, averaged over the sample " +
+				"period, follow the workload closely at the cost of hostengine CPU. 0 samples at the collect interval.",
+			EnvVars: []string{"DCGM_EXPORTER_DCGM_UPDATE_FREQ"},
+		},
+		&cli.Float64Flag{
+			Name:  CLIDCGMMaxKeepAge,
+			Value: 0,
+			Usage: "How long DCGM keeps the samples of every field group, in seconds. Every kept sample uses " +
+				"hostengine memory. 0 means no limit, the samples are bounded by --" + CLIDCGMMaxKeepSamples + " alone.",
+			EnvVars: []string{"DCGM_EXPORTER_DCGM_MAX_KEEP_AGE"},
+		},
+		&cli.IntFlag{
+			Name:  CLIDCGMMaxKeepSamples,
+			Value: 1,
+			Usage: "How many samples DCGM keeps for every field of every field group. The exporter reads the latest " +
+				"sample, more samples use hostengine memory for every field and entity. 0 means no limit, the samples " +
+				"are bounded by --" + CLIDCGMMaxKeepAge + " alone, and a single sample is kept when both are 0.",
+			EnvVars: []string{"DCGM_EXPORTER_DCGM_MAX_KEEP_SAMPLES"},
+		},
+		&cli.StringFlag{
+			Name:  CLIProfilingMultiplexing,
+			Value: string(dcgmexporter.ProfilingMultiplexingWarn),
+			Usage: fmt.Sprintf("Choose what happens to the profiling fields that the GPUs cannot sample together, which DCGM time-slices at the cost of their accuracy. Possible values: '%s' (log them and keep them multiplexed), '%s' (drop them)",
+				dcgmexporter.ProfilingMultiplexingWarn, dcgmexporter.ProfilingMultiplexingDrop),
+			EnvVars: []string{"DCGM_EXPORTER_PROFILING_MULTIPLEXING"},
+		},
+		&cli.StringFlag{
+			Name:    CLIHealthScoreRules,
+			Value:   "",
+			Usage:   "Path to a YAML file of health rules scoring every GPU, exported by DCGM_EXP_GPU_HEALTH_SCORE, at every collection.",
+			EnvVars: []string{"DCGM_EXPORTER_HEALTH_SCORE_RULES"},
+		},
+		&cli.StringFlag{
+			Name:    CLIStateFile,
+			Value:   "",
+			Usage:   "Path to a file persisting the cumulative counters, e.g. of --monotonic-counters and DCGM_HEALTH_INCIDENTS_TOTAL, across restarts. Its directory must be writable and kept across restarts, e.g. a hostPath volume.",
+			EnvVars: []string{"DCGM_EXPORTER_STATE_FILE"},
+		},
+		&cli.IntFlag{
+			Name:    CLIStateRetention,
+			Value:   720,
+			Usage:   "Interval of time after which the counters of --state-file that are not updated are dropped, e.g. of the GPUs moved to another node. Unit is hours; 0 keeps them forever.",
+			EnvVars: []string{"DCGM_EXPORTER_STATE_RETENTION"},
+		},
+		&cli.StringFlag{
+			Name:  CLIMetricNames,
+			Value: string(dcgmexporter.MetricNamesLegacy),
+			Usage: fmt.Sprintf("Choose how the fields are named. Possible values: '%s' (the names and the units of the counters file), '%s' (the values converted to base units, e.g. MiB to bytes, and the names suffixed with their unit, e.g. DCGM_FI_DEV_FB_USED_bytes, and with _total for the counters)",
+				dcgmexporter.MetricNamesLegacy, dcgmexporter.MetricNamesPrometheus),
+			EnvVars: []string{"DCGM_EXPORTER_METRIC_NAMES"},
+		},
+		&cli.StringFlag{
+			Name:    CLIExternalLabelsDir,
+			Value:   "",
+			Usage:   "Directory whose files are added as labels to every metric, named after the file and valued with its content, e.g. a downward API volume. The labels of --external-labels take precedence.",
+			EnvVars: []string{"DCGM_EXPORTER_EXTERNAL_LABELS_DIR"},
+		},
+		&cli.StringFlag{
+			Name:  CLIMIGStrategy,
+			Value: "",
+			Usage: fmt.Sprintf("MIG strategy of the device plugin, read from --%s when it is not set. Possible values: '%s' (the MIG instances are attributed to the pods of their GPU), '%s', '%s'",
+				CLIDevicePluginConfig, dcgmexporter.MIGStrategyNone, dcgmexporter.MIGStrategySingle,
+				dcgmexporter.MIGStrategyMixed),
+			EnvVars: []string{"DCGM_EXPORTER_MIG_STRATEGY"},
+		},
+		&cli.IntFlag{
+			Name:    CLIKubeletCallTimeout,
+			Value:   10000,
+			Usage:   "Timeout of the calls to the kubelet pod-resources API, apart from the 10s connection timeout. Unit is milliseconds (ms).",
+			EnvVars: []string{"DCGM_EXPORTER_KUBELET_CALL_TIMEOUT"},
+		},
+		&cli.IntFlag{
+			Name:    CLIKubeletKeepalive,
+			Value:   0,
+			Usage:   "Interval of the keepalive pings of the calls to the kubelet pod-resources API, the kubelet closes the connections pinged more often than every 5 minutes. Unit is milliseconds (ms); 0 disables them.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBELET_KEEPALIVE"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIKubernetesAttributeNames,
+			Usage:   "Comma-separated list of name=new_name renames of the attributes describing the pods, e.g. pod=k8s_pod_name,namespace=k8s_namespace_name. The names are those exported without renames, e.g. pod_name with the old namespace.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_ATTRIBUTE_NAMES"},
+		},
+		&cli.StringFlag{
+			Name:    CLIProfile,
+			Usage:   "Built-in counter profile to collect, one of: minimal, default, dcp, debug. The profiling fields are only collected on the GPUs supporting them. The files of --collectors, when set, override the fields of the profile.",
+			EnvVars: []string{"DCGM_EXPORTER_PROFILE"},
+		},
+		&cli.StringFlag{
+			Name:  CLISampleTimestamps,
+			Value: string(dcgmexporter.SampleTimestampsNone),
+			Usage: fmt.Sprintf("Choose how the time DCGM sampled the values is exported. Possible values: '%s', '%s' (the timestamp of the exemplars of the GPU metrics, served to scrapers that accept the OpenMetrics format), '%s' (a sibling <metric>_timestamp_seconds gauge)",
+				dcgmexporter.SampleTimestampsNone, dcgmexporter.SampleTimestampsExemplar,
+				dcgmexporter.SampleTimestampsMetric),
+			EnvVars: []string{"DCGM_EXPORTER_SAMPLE_TIMESTAMPS"},
+		},
+		&cli.BoolFlag{
+			Name:    CLISampleAge,
+			Value:   false,
+			Usage:   "Export the age of the values read from DCGM in DCGM_EXP_SAMPLE_AGE_SECONDS, labeled with their field, to detect the stale values of the hostengine.",
+			EnvVars: []string{"DCGM_EXPORTER_SAMPLE_AGE"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIMIGRollup,
+			Value:   false,
+			Usage:   "Add a series per GPU, labeled aggregated=\"true\", rolling up the framebuffer and profiling metrics of its MIG instances: the framebuffer is summed, the activities are weighted by the SMs or the memory of the instances.",
+			EnvVars: []string{"DCGM_EXPORTER_MIG_ROLLUP"},
+		},
+		&cli.StringFlag{
+			Name:    CLIShard,
+			Value:   "",
+			Usage:   "Shard collected by the exporter among the exporters of the node, as <index>/<count>, e.g. 2/4. The shards partition the GPUs or the fields of --shard-by without coordination, and the metrics are labeled with the shard.",
+			EnvVars: []string{"DCGM_EXPORTER_SHARD"},
+		},
+		&cli.StringFlag{
+			Name:  CLIShardBy,
+			Value: string(dcgmexporter.ShardByGPU),
+			Usage: fmt.Sprintf("Choose what --shard partitions. Possible values: '%s' (the GPUs whose index modulo the number of shards is the index of the shard minus 1, with their MIG instances; the other entities are collected by the first shard), '%s' (the fields of the counters files, in their order; the label fields are collected by every shard and the exporter metrics by the first one)",
+				dcgmexporter.ShardByGPU, dcgmexporter.ShardByField),
+			EnvVars: []string{"DCGM_EXPORTER_SHARD_BY"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIWebCompression,
+			Value:   cli.NewStringSlice("gzip", "zstd"),
+			Usage:   "Comma-separated list of the content encodings, gzip or zstd, compressing the HTTP responses for the clients accepting them, in order of preference. none disables the compression.",
+			EnvVars: []string{"DCGM_EXPORTER_WEB_COMPRESSION"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIFabricLeaderElection,
+			Value:   false,
+			Usage:   "Publish the metrics of the NVSwitches and their links only from the exporter elected with a Kubernetes Lease among the exporters of the NVSwitch domain.",
+			EnvVars: []string{"DCGM_EXPORTER_FABRIC_LEADER_ELECTION"},
+		},
+		&cli.StringFlag{
+			Name:    CLIFabricLease,
+			Value:   "",
+			Usage:   "Lease <NAMESPACE>:<NAME> of the fabric leader election, shared by the exporters of the NVSwitch domain. Defaults to the Lease dcgm-exporter-fabric-<cluster UUID of the NVLink domain> in the namespace of the exporter, or dcgm-exporter-fabric-<node name> when the GPUs are not registered in a fabric.",
+			EnvVars: []string{"DCGM_EXPORTER_FABRIC_LEASE"},
+		},
+		&cli.StringFlag{
+			Name:    CLIKubernetesConfig,
+			Value:   "",
+			Usage:   "Kubernetes object <NAMESPACE>:<NAME> overriding the counters, the label policies and the sinks, watched to apply its changes without restarting the exporter.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_CONFIG"},
+		},
+		&cli.StringFlag{
+			Name:    CLIKubernetesConfigKind,
+			Value:   string(dcgmexporter.KubernetesConfigKindCRD),
+			Usage:   "Kind of the object of --kubernetes-config. Possible values: DCGMExporterConfig, ConfigMap.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_CONFIG_KIND"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIAdminAPI,
+			Value:   false,
+			Usage:   "Serve the POST /v1/gpus/{uuid}/reset and the POST and DELETE /v1/gpus/{uuid}/drain endpoints resetting and draining the GPUs, authenticated by the admin token on top of the authentication of the server. Requires --admin-api-token-file and nvidia-smi.",
+			EnvVars: []string{"DCGM_EXPORTER_ADMIN_API"},
+		},
+		&cli.StringFlag{
+			Name:    CLIAdminAPITokenFile,
+			Value:   "",
+			Usage:   "File holding the admin token, presented in the X-Admin-Token header of the admin API requests.",
+			EnvVars: []string{"DCGM_EXPORTER_ADMIN_API_TOKEN_FILE"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIKubernetesPodAllocation,
+			Value:   false,
+			Usage:   "Emit DCGM_EXP_POD_GPU_ALLOCATION_SECONDS, the time since the GPUs and MIG instances were allocated to the containers, when kubernetes mapping is enabled.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_POD_ALLOCATION"},
+		},
+	}
+
+	if runtime.GOOS == "linux" {
+		c.Flags = append(c.Flags, &cli.BoolFlag{
+			Name:    CLIWebSystemdSocket,
+			Value:   false,
+			Usage:   "Use systemd socket activation listeners instead of port listeners (Linux only).",
+			EnvVars: []string{"DCGM_EXPORTER_SYSTEMD_SOCKET"},
+		})
+	} else {
+		err := "dcgm-exporter is only supported on Linux."
+		logrus.Fatal(err)
+		return nil
+	}
+
+	c.Commands = []*cli.Command{
+		newValidateCommand(),
+		newListFieldsCommand(),
+	}
+
+	c.Before = func(c *cli.Context) error {
+		return loadConfigFile(c)
+	}
+
+	c.Action = func(c *cli.Context) error {
+		return action(c)
+	}
+
+	return c
+}
+
+func newOSWatcher(sigs ...os.Signal) chan os.Signal {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, sigs...)
+
+	return sigChan
+}
+
+func action(c *cli.Context) (err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	return stdout.Capture(ctx, func() error {
+		// The purpose of this function is to capture any panic that may occur
+		// during initialization and return an error.
+		defer func() {
+			if r := recover(); r != nil {
+				logrus.WithField(dcgmexporter.LoggerStackTrace, string(debug.Stack())).Error("Encountered a failure.")
+				err = fmt.Errorf("encountered a failure; err: %v", r)
+			}
+		}()
+		return startDCGMExporter(c, cancel)
+	})
+}
+
+func startDCGMExporter(c *cli.Context, cancel context.CancelFunc) error {
+	defer cancel()
+
+	config, err := contextToConfig(c)
+	if err != nil {
+		return err
+	}
+
+	enableDebugLogging(config)
+
+	dcgmexporter.SetBuildInfo(c.App.Version)
+
+	if len(config.RemoteHostengines) > 0 {
+		sigs := newOSWatcher(syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
+		return runAggregateDCGMExporter(config, sigs)
+	}
+
+	if config.StateFile != "" {
+		cleanupState, err := dcgmexporter.OpenStateStore(config.StateFile,
+			time.Duration(config.StateRetention)*time.Hour)
+		if err != nil {
+			return err
+		}
+		defer cleanupState()
+	}
+
+	var supervisor *dcgmexporter.DCGMSupervisor
+	cleanupDCGM := func() {}
+	defer func() {
+		cleanupDCGM()
+	}()
+
+	// useNVML is set when DCGM is unavailable, it is kept across the reloads
+	useNVML := false
+
+	if config.Simulate == "" && config.Replay == "" && config.Tegrastats == "" {
+		// DCGM is initialized once, the reloads keep the history of the watched fields, unless it is reinitialized
+		cleanupDCGM, supervisor, useNVML, err = initCollection(config)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	} else if config.Simulate != "" {
+		logrus.Warnf("Simulating the GPUs of '%s', the metrics are not collected from DCGM", config.Simulate)
+	} else if config.Tegrastats != "" {
+		logrus.Infof("Collecting the metrics of the integrated GPU from '%s'", config.Tegrastats)
+	} else {
+		logrus.Warnf("Replaying the recording of '%s', the metrics are not collected from DCGM", config.Replay)
+	}
+
+	// The configuration of the cluster is watched across the reloads, its changes reload the exporter
+	var kubernetesConfig *dcgmexporter.KubernetesConfig
+	if config.KubernetesConfig != "" {
+		kubernetesConfig, err = dcgmexporter.NewKubernetesConfig(config)
+		if err != nil {
+			return err
+		}
+		if err := kubernetesConfig.Start(); err != nil {
+			return err
+		}
+		defer kubernetesConfig.Stop()
+	}
+
+	sigs := newOSWatcher(syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
+
+	for {
+		config.UseNVML = useNVML
+		if kubernetesConfig != nil {
+			kubernetesConfig.Apply(config)
+		}
+
+		reload, err := runDCGMExporter(config, sigs, supervisor, kubernetesConfig)
+		if err != nil || !reload {
+			return err
+		}
+
+		if supervisor != nil && supervisor.Lost() {
+			cleanupDCGM()
+			cleanupDCGM = func() {}
+
+			cleanup, ok := reinitDCGM(config, sigs, supervisor)
+			if !ok {
+				return nil
+			}
+			cleanupDCGM = cleanup
+		}
+
+		logrus.Info("Reloading dcgm-exporter")
+
+		config, err = contextToConfig(c)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// initCollection initializes DCGM, or falls back to NVML when DCGM is unavailable and the NVML fallback is enabled.
+// It returns the cleanup function of DCGM and its supervisor, which is nil with NVML, and whether NVML is used.
+func initCollection(config *dcgmexporter.Config) (func(), *dcgmexporter.DCGMSupervisor, bool, error) {
+	cleanup, err := connectDCGMHook(config)
+	if err != nil {
+		if !config.NVMLFallback {
+			return nil, nil, false, err
+		}
+
+		logrus.WithError(err).Warn("DCGM is unavailable, collecting a subset of the metrics with NVML")
+		dcgmexporter.UpdateDriverInfo()
+		return func() {}, nil, true, nil
+	}
+
+	logrus.Info("DCGM successfully initialized!")
+	dcgmexporter.UpdateDriverInfo()
+
+	dcgm.FieldsInit()
+	return func() {
+		dcgm.FieldsTerm()
+		cleanup()
+	}, dcgmexporter.NewDCGMSupervisor(config), false, nil
+}
+
+// runDCGMExporter runs the collectors and the server until the exporter is stopped or reloaded, it returns true
+// when it is reloaded.
+func runDCGMExporter(
+	config *dcgmexporter.Config, sigs chan os.Signal, supervisor *dcgmexporter.DCGMSupervisor,
+	kubernetesConfig *dcgmexporter.KubernetesConfig,
+) (bool, error) {
+	logrus.Info("Starting dcgm-exporter")
+
+	dcgmexporter.SetLogSampleInterval(time.Duration(config.LogSampleInterval) * time.Millisecond)
+
+	if config.Simulate != "" || config.Replay != "" || config.UseNVML || config.Tegrastats != "" {
+		return runOfflineDCGMExporter(config, sigs, kubernetesConfig)
+	}
+
+	fillConfigMetricGroups(config)
+
+	cs := getCounters(config)
+
+	fieldEntityGroupTypeSystemInfo := getFieldEntityGroupTypeSystemInfo(cs, config)
+
+	hostname, err := dcgmexporter.GetHostname(config)
+	if err != nil {
+		return false, err
+	}
+
+	newDCGMCollector := dcgmexporter.NewDCGMCollector
+	if config.Record != "" {
+		if err := dcgmexporter.WriteRecordedCounters(config.Record, recordedCounters(cs)); err != nil {
+			return false, fmt.Errorf("failed to write the counters to '%s': %w", config.Record, err)
+		}
+		newDCGMCollector = dcgmexporter.NewRecordingCollector(config.Record)
+		logrus.Infof("Recording the field values to '%s'", config.Record)
+	}
+
+	pipeline, cleanup, err := dcgmexporter.NewMetricsPipeline(config,
+		cs.DCGMCounters,
+		hostname,
+		newDCGMCollector,
+		fieldEntityGroupTypeSystemInfo,
+	)
+	defer cleanup()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	cRegistry := dcgmexporter.NewRegistry()
+
+	enableDCGMExpXIDErrorsCountCollector(cs, fieldEntityGroupTypeSystemInfo, hostname, config, cRegistry)
+
+	enableDCGMExpClockEventsCount(cs, fieldEntityGroupTypeSystemInfo, hostname, config, cRegistry)
+
+	enableDCGMHealthCollector(cs, fieldEntityGroupTypeSystemInfo, hostname, config, cRegistry)
+
+	enableDCGMExpFabricManagerStatusCollector(cs, fieldEntityGroupTypeSystemInfo, hostname, config, cRegistry)
+
+	enableDCGMExpVGPUCollector(cs, fieldEntityGroupTypeSystemInfo, hostname, config, cRegistry)
+
+	enableDCGMExpMIGProfileInfoCollector(cs, fieldEntityGroupTypeSystemInfo, hostname, config, cRegistry)
+
+	enableDCGMExpPCIeLinkCollector(cs, fieldEntityGroupTypeSystemInfo, hostname, config, cRegistry)
+
+	enableDCGMExpPowerLimitCollector(cs, fieldEntityGroupTypeSystemInfo, hostname, config, cRegistry)
+
+	enableDCGMExpGPUInfoCollector(cs, fieldEntityGroupTypeSystemInfo, hostname, config, cRegistry)
+
+	enableDCGMExpGPUPCICollector(cs, fieldEntityGroupTypeSystemInfo, hostname, config, cRegistry)
+
+	return serveDCGMExporter(config, sigs, pipeline, cRegistry, fieldEntityGroupTypeSystemInfo, supervisor,
+		kubernetesConfig)
+}
+
+// runOfflineDCGMExporter runs the exporter with the GPUs of the simulation spec, of the recording, of NVML or of
+// tegrastats, the DCGM_EXP metrics are not collected as their collectors query DCGM directly.
+func runOfflineDCGMExporter(
+	config *dcgmexporter.Config, sigs chan os.Signal, kubernetesConfig *dcgmexporter.KubernetesConfig,
+) (bool, error) {
+	config.CollectDCP = true
+	config.MetricGroups = dcgmexporter.ProfilingMetricGroups()
+
+	cs := getCounters(config)
+	for _, counter := range cs.ExporterCounters {
+		if counter.PromType != "label" {
+			logrus.Warnf("Not collecting %s metrics without DCGM", counter.FieldName)
+		}
+	}
+
+	var (
+		newDCGMCollector               dcgmexporter.DCGMCollectorConstructor
+		fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo
+	)
+	if config.UseNVML {
+		var err error
+		fieldEntityGroupTypeSystemInfo, err = dcgmexporter.NewNVMLEntityGroupTypeSystemInfo(cs.DCGMCounters, config)
+		if err != nil {
+			return false, err
+		}
+		newDCGMCollector = dcgmexporter.NewNVMLCollector()
+	} else if config.Tegrastats != "" {
+		var err error
+		fieldEntityGroupTypeSystemInfo, err = dcgmexporter.NewTegrastatsEntityGroupTypeSystemInfo(cs.DCGMCounters,
+			config)
+		if err != nil {
+			return false, err
+		}
+		newDCGMCollector = dcgmexporter.NewTegrastatsCollector(config.Tegrastats)
+	} else if config.Simulate != "" {
+		spec, err := dcgmexporter.LoadSimulationSpec(config.Simulate)
+		if err != nil {
+			return false, err
+		}
+
+		fieldEntityGroupTypeSystemInfo, err = dcgmexporter.NewSimulatedEntityGroupTypeSystemInfo(cs.DCGMCounters, config, spec)
+		if err != nil {
+			return false, err
+		}
+		newDCGMCollector = dcgmexporter.NewSimulatedCollector(spec)
+	} else {
+		var err error
+		fieldEntityGroupTypeSystemInfo, err = dcgmexporter.NewReplayEntityGroupTypeSystemInfo(config.Replay,
+			cs.DCGMCounters, config)
+		if err != nil {
+			return false, err
+		}
+		newDCGMCollector = dcgmexporter.NewReplayCollector(config.Replay)
+	}
+
+	hostname, err := dcgmexporter.GetHostname(config)
+	if err != nil {
+		return false, err
+	}
+
+	pipeline, cleanup, err := dcgmexporter.NewMetricsPipeline(config,
+		cs.DCGMCounters,
+		hostname,
+		newDCGMCollector,
+		fieldEntityGroupTypeSystemInfo,
+	)
+	defer cleanup()
+	if err != nil {
+		return false, err
+	}
+
+	return serveDCGMExporter(config, sigs, pipeline, dcgmexporter.NewRegistry(), nil, nil, kubernetesConfig)
+}
+
+// recordedCounters returns the counters of the counters file, without the labels copied to the exporter counters.
+func recordedCounters(cs *dcgmexporter.CounterSet) []dcgmexporter.Counter {
+	counters := slices.Clone(cs.DCGMCounters)
+	for _, counter := range cs.ExporterCounters {
+		if counter.PromType != "label" {
+			counters = append(counters, counter)
+		}
+	}
+
+	return counters
+}
+
+// serveDCGMExporter runs the pipeline, the server and the sinks until the exporter is stopped or reloaded. The MIG
+// instances and the GPUs of the system info are watched when it is not nil.
+func serveDCGMExporter(
+	config *dcgmexporter.Config, sigs chan os.Signal, pipeline *dcgmexporter.MetricsPipeline,
+	cRegistry *dcgmexporter.Registry, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo,
+	supervisor *dcgmexporter.DCGMSupervisor, kubernetesConfig *dcgmexporter.KubernetesConfig,
+) (bool, error) {
+	var jobStats *dcgmexporter.JobStats
+	if config.JobStats {
+		jobStats = dcgmexporter.NewJobStats()
+		pipeline.AddSink(jobStats)
+		cRegistry.Register(jobStats)
+	}
+
+	var diagnostics *dcgmexporter.Diagnostics
+	if config.Diag {
+		diagnostics = dcgmexporter.NewDiagnostics(config)
+		pipeline.AddSink(diagnostics)
+		cRegistry.Register(diagnostics)
+	}
+
+	if config.KubernetesEvents {
+		kubernetesEvents, err := dcgmexporter.NewKubernetesEvents(config)
+		if err != nil {
+			return false, err
+		}
+		pipeline.AddSink(kubernetesEvents)
+	}
+
+	if config.BackgroundCollection {
+		pipeline.GatherRegistry(cRegistry)
+	}
+
+	defer func() {
+		cRegistry.Cleanup()
+	}()
+
+	ch := make(chan string, 10)
+
+	var wg sync.WaitGroup
+	stop := make(chan interface{})
+
+	var startup *dcgmexporter.Startup
+	if config.ReadinessGating {
+		startup = dcgmexporter.NewStartup(config)
+		pipeline.SetStartup(startup)
+	}
+
+	if config.FabricLeaderElection {
+		fabricLeader, err := dcgmexporter.NewFabricLeader(config)
+		if err != nil {
+			return false, err
+		}
+		pipeline.SetFabricLeader(fabricLeader)
+
+		wg.Add(1)
+		go fabricLeader.Run(stop, &wg)
+	}
+
+	wg.Add(1)
+	go pipeline.Run(ch, stop, &wg)
+
+	wg.Add(1)
+
+	server, cleanup, err := dcgmexporter.NewMetricsServer(config, ch, cRegistry)
+	defer cleanup()
+	if err != nil {
+		return false, err
+	}
+
+	if startup != nil {
+		server.SetStartup(startup)
+	}
+
+	if jobStats != nil {
+		server.HandleJobs(jobStats)
+	}
+
+	if diagnostics != nil {
+		server.HandleDiag(diagnostics)
+
+		if config.DiagInterval > 0 {
+			wg.Add(1)
+			go diagnostics.Run(stop, &wg)
+		}
+	}
+
+	if config.EnableDebugEndpoints {
+		server.HandleDebug(pipeline)
+	}
+
+	if config.AdminAPI {
+		adminAPI, err := dcgmexporter.NewAdminAPI(config)
+		if err != nil {
+			return false, err
+		}
+		server.HandleAdmin(adminAPI)
+	}
+
+	if podMapper := pipeline.PodMapper(); podMapper != nil && config.KubernetesMappingAPI {
+		server.HandleMapping(podMapper)
+	}
+
+	reloader := dcgmexporter.NewReloader(config)
+	if config.WebEnableReload {
+		server.HandleReload(reloader)
+	}
+
+	go server.Run(stop, &wg)
+
+	if config.RemoteWriteURL != "" {
+		remoteWriter, err := dcgmexporter.NewRemoteWriter(config, server.WriteMetrics)
+		if err != nil {
+			return false, err
+		}
+
+		wg.Add(1)
+		go remoteWriter.Run(stop, &wg)
+	}
+
+	if config.WatchCollectors {
+		wg.Add(1)
+		go reloader.Watch(stop, &wg)
+	}
+
+	if config.MIGRefreshInterval > 0 && fieldEntityGroupTypeSystemInfo != nil {
+		if item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU); exists {
+			wg.Add(1)
+			go reloader.WatchGPUInstances(item.SystemInfo, stop, &wg)
+		}
+	}
+
+	var supervisorC chan struct{}
+	if supervisor != nil && config.DCGMCheckInterval > 0 && !config.UseFakeGPUs && fieldEntityGroupTypeSystemInfo != nil {
+		if item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU); exists {
+			supervisorC = supervisor.C
+			wg.Add(1)
+			go supervisor.Watch(item, stop, &wg)
+		}
+	}
+
+	var kubernetesConfigC chan struct{}
+	if kubernetesConfig != nil {
+		kubernetesConfigC = kubernetesConfig.C
+	}
+
+	reload := waitForReload(sigs, reloader, supervisorC, kubernetesConfigC)
+	close(stop)
+	err = dcgmexporter.WaitWithTimeout(&wg, time.Second*2)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	return reload, nil
+}
+
+// waitForReload waits for a signal stopping the exporter or for a reload, requested by SIGHUP, by the reloader, by
+// the supervisor of DCGM or by a change of the Kubernetes configuration.
+func waitForReload(
+	sigs chan os.Signal, reloader *dcgmexporter.Reloader, supervisorC chan struct{}, kubernetesConfigC chan struct{},
+) bool {
+	for {
+		select {
+		case sig := <-sigs:
+			if sig != syscall.SIGHUP {
+				return false
+			}
+
+			if err := reloader.Request(); err != nil {
+				logrus.WithError(err).Error("Unable to reload dcgm-exporter")
+			}
+		case <-reloader.C:
+			return true
+		case <-supervisorC:
+			return true
+		case <-kubernetesConfigC:
+			return true
+		}
+	}
+}
+
+func enableDCGMExpClockEventsCount(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) {
+	if dcgmexporter.IsDCGMExpClockEventsCountEnabled(cs.ExporterCounters) {
+		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
+		if !exists {
+			logrus.Fatalf("%s collector cannot be initialized", dcgmexporter.DCGMClockEventsCount.String())
+		}
+		clocksThrottleReasonsCollector, err := dcgmexporter.NewClockEventsCollector(
+			cs.ExporterCounters, hostname, config, item)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		cRegistry.Register(clocksThrottleReasonsCollector)
+
+		logrus.Infof("%s collector initialized", dcgmexporter.DCGMClockEventsCount.String())
+	}
+}
+
+func enableDCGMExpXIDErrorsCountCollector(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) {
+	if dcgmexporter.IsDCGMExpXIDErrorsCountEnabled(cs.ExporterCounters) {
+		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
+		if !exists {
+			logrus.Fatalf("%s collector cannot be initialized", dcgmexporter.DCGMXIDErrorsCount.String())
+		}
+
+		xidCollector, err := dcgmexporter.NewXIDCollector(cs.ExporterCounters, hostname, config, item)
+		if err != nil {
+			logrus.Fatal(err)
+		}
 
-	logrus.Info("Starting dcgm-exporter")
+		cRegistry.Register(xidCollector)
 
-	config, err := contextToConfig(c)
-	if err != nil {
-		return err
+		logrus.Infof("%s collector initialized", dcgmexporter.DCGMXIDErrorsCount.String())
 	}
+}
 
-	enableDebugLogging(config)
+func enableDCGMHealthCollector(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) {
+	if dcgmexporter.IsDCGMHealthEnabled(cs.ExporterCounters) {
+		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
+		if !exists {
+			logrus.Fatalf("%s collector cannot be initialized", dcgmexporter.DCGMHealthStatus.String())
+		}
 
-	cleanupDCGM := initDCGM(config)
-	defer cleanupDCGM()
+		healthCollector, err := dcgmexporter.NewHealthCollector(cs.ExporterCounters, hostname, config, item)
+		if err != nil {
+			logrus.Fatal(err)
+		}
 
-	logrus.Info("DCGM successfully initialized!")
+		cRegistry.Register(healthCollector)
 
-	dcgm.FieldsInit()
-	defer dcgm.FieldsTerm()
+		logrus.Infof("%s collector initialized", dcgmexporter.DCGMHealthStatus.String())
+	}
+}
 
-	fillConfigMetricGroups(config)
+func enableDCGMExpFabricManagerStatusCollector(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) {
+	if dcgmexporter.IsDCGMExpFabricManagerStatusEnabled(cs.ExporterCounters) {
+		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
+		if !exists {
+			logrus.Fatalf("%s collector cannot be initialized", dcgmexporter.DCGMFabricManagerStatus.String())
+		}
 
-	cs := getCounters(config)
+		fabricManagerCollector, err := dcgmexporter.NewFabricManagerCollector(cs.ExporterCounters, hostname, config, item)
+		if err != nil {
+			logrus.Fatal(err)
+		}
 
-	fieldEntityGroupTypeSystemInfo := getFieldEntityGroupTypeSystemInfo(cs, config)
+		cRegistry.Register(fabricManagerCollector)
 
-	hostname, err := dcgmexporter.GetHostname(config)
-	if err != nil {
-		return err
+		logrus.Infof("%s collector initialized", dcgmexporter.DCGMFabricManagerStatus.String())
 	}
+}
 
-	pipeline, cleanup, err := dcgmexporter.NewMetricsPipeline(config,
-		cs.DCGMCounters,
-		hostname,
-		dcgmexporter.NewDCGMCollector,
-		fieldEntityGroupTypeSystemInfo,
-	)
-	defer cleanup()
-	if err != nil {
-		logrus.Fatal(err)
-	}
+func enableDCGMExpVGPUCollector(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) {
+	if dcgmexporter.IsDCGMExpVGPUEnabled(cs.ExporterCounters) {
+		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
+		if !exists {
+			logrus.Fatalf("%s collector cannot be initialized", dcgmexporter.DCGMVGPUUtilization.String())
+		}
 
-	cRegistry := dcgmexporter.NewRegistry()
+		vgpuCollector, err := dcgmexporter.NewVGPUCollector(cs.ExporterCounters, hostname, config, item)
+		if err != nil {
+			logrus.Fatal(err)
+		}
 
-	enableDCGMExpXIDErrorsCountCollector(cs, fieldEntityGroupTypeSystemInfo, hostname, config, cRegistry)
+		cRegistry.Register(vgpuCollector)
 
-	enableDCGMExpClockEventsCount(cs, fieldEntityGroupTypeSystemInfo, hostname, config, cRegistry)
+		logrus.Infof("%s collector initialized", dcgmexporter.DCGMVGPUUtilization.String())
+	}
+}
 
-	defer func() {
-		cRegistry.Cleanup()
-	}()
+func enableDCGMExpMIGProfileInfoCollector(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) {
+	if dcgmexporter.IsDCGMExpMIGProfileInfoEnabled(cs.ExporterCounters) {
+		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
+		if !exists {
+			logrus.Fatalf("%s collector cannot be initialized", dcgmexporter.DCGMMIGProfileInfo.String())
+		}
 
-	ch := make(chan string, 10)
+		migProfileInfoCollector, err := dcgmexporter.NewMIGProfileInfoCollector(cs.ExporterCounters, hostname, config, item)
+		if err != nil {
+			logrus.Fatal(err)
+		}
 
-	var wg sync.WaitGroup
-	stop := make(chan interface{})
+		cRegistry.Register(migProfileInfoCollector)
 
-	wg.Add(1)
-	go pipeline.Run(ch, stop, &wg)
+		logrus.Infof("%s collector initialized", dcgmexporter.DCGMMIGProfileInfo.String())
+	}
+}
 
-	wg.Add(1)
+func enableDCGMExpPCIeLinkCollector(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) {
+	if dcgmexporter.IsDCGMExpPCIeLinkDegradedEnabled(cs.ExporterCounters) {
+		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
+		if !exists {
+			logrus.Fatalf("%s collector cannot be initialized", dcgmexporter.DCGMPCIeLinkDegraded.String())
+		}
 
-	server, cleanup, err := dcgmexporter.NewMetricsServer(config, ch, cRegistry)
-	defer cleanup()
-	if err != nil {
-		return err
-	}
+		pcieLinkCollector, err := dcgmexporter.NewPCIeLinkCollector(cs.ExporterCounters, hostname, config, item)
+		if err != nil {
+			logrus.Fatal(err)
+		}
 
-	go server.Run(stop, &wg)
+		cRegistry.Register(pcieLinkCollector)
 
-	sigs := newOSWatcher(syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
-	sig := <-sigs
-	close(stop)
-	cancel()
-	err = dcgmexporter.WaitWithTimeout(&wg, time.Second*2)
-	if err != nil {
-		logrus.Fatal(err)
+		logrus.Infof("%s collector initialized", dcgmexporter.DCGMPCIeLinkDegraded.String())
 	}
+}
 
-	if sig == syscall.SIGHUP {
-		goto restart
-	}
+func enableDCGMExpPowerLimitCollector(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) {
+	if dcgmexporter.IsDCGMExpPowerLimitChangesEnabled(cs.ExporterCounters) {
+		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
+		if !exists {
+			logrus.Fatalf("%s collector cannot be initialized", dcgmexporter.DCGMPowerLimitChanges.String())
+		}
+
+		powerLimitCollector, err := dcgmexporter.NewPowerLimitCollector(cs.ExporterCounters, hostname, config, item)
+		if err != nil {
+			logrus.Fatal(err)
+		}
 
-	return nil
+		cRegistry.Register(powerLimitCollector)
+
+		logrus.Infof("%s collector initialized", dcgmexporter.DCGMPowerLimitChanges.String())
+	}
 }
 
-func enableDCGMExpClockEventsCount(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) {
-	if dcgmexporter.IsDCGMExpClockEventsCountEnabled(cs.ExporterCounters) {
+func enableDCGMExpGPUInfoCollector(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) {
+	if dcgmexporter.IsDCGMExpGPUInfoEnabled(cs.ExporterCounters) {
 		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
 		if !exists {
-			logrus.Fatalf("%s collector cannot be initialized", dcgmexporter.DCGMClockEventsCount.String())
+			logrus.Fatalf("%s collector cannot be initialized", dcgmexporter.DCGMGPUInfo.String())
 		}
-		clocksThrottleReasonsCollector, err := dcgmexporter.NewClockEventsCollector(
-			cs.ExporterCounters, hostname, config, item)
+
+		gpuInfoCollector, err := dcgmexporter.NewGPUInfoCollector(cs.ExporterCounters, hostname, config, item)
 		if err != nil {
 			logrus.Fatal(err)
 		}
 
-		cRegistry.Register(clocksThrottleReasonsCollector)
+		cRegistry.Register(gpuInfoCollector)
 
-		logrus.Infof("%s collector initialized", dcgmexporter.DCGMClockEventsCount.String())
+		logrus.Infof("%s collector initialized", dcgmexporter.DCGMGPUInfo.String())
 	}
 }
 
-func enableDCGMExpXIDErrorsCountCollector(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) {
-	if dcgmexporter.IsDCGMExpXIDErrorsCountEnabled(cs.ExporterCounters) {
+func enableDCGMExpGPUPCICollector(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) {
+	if dcgmexporter.IsDCGMExpGPUPCIInfoEnabled(cs.ExporterCounters) {
 		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
 		if !exists {
-			logrus.Fatalf("%s collector cannot be initialized", dcgmexporter.DCGMXIDErrorsCount.String())
+			logrus.Fatalf("%s collector cannot be initialized", dcgmexporter.DCGMGPUPCIInfo.String())
 		}
 
-		xidCollector, err := dcgmexporter.NewXIDCollector(cs.ExporterCounters, hostname, config, item)
+		gpuPCICollector, err := dcgmexporter.NewGPUPCICollector(cs.ExporterCounters, hostname, config, item)
 		if err != nil {
 			logrus.Fatal(err)
 		}
 
-		cRegistry.Register(xidCollector)
+		cRegistry.Register(gpuPCICollector)
 
-		logrus.Infof("%s collector initialized", dcgmexporter.DCGMXIDErrorsCount.String())
+		logrus.Infof("%s collector initialized", dcgmexporter.DCGMGPUPCIInfo.String())
 	}
 }
 
@@ -410,6 +1795,7 @@ func getFieldEntityGroupTypeSystemInfo(cs *dcgmexporter.CounterSet, config *dcgm
 
 	allCounters = appendDCGMXIDErrorsCountDependency(allCounters, cs)
 	allCounters = appendDCGMClockEventsCountDependency(cs, allCounters)
+	allCounters = appendDCGMPowerLimitChangesDependency(cs, allCounters)
 
 	fieldEntityGroupTypeSystemInfo := dcgmexporter.NewEntityGroupTypeSystemInfo(allCounters, config)
 
@@ -450,6 +1836,20 @@ func appendDCGMXIDErrorsCountDependency(allCounters []dcgmexporter.Counter, cs *
 	return allCounters
 }
 
+// appendDCGMPowerLimitChangesDependency appends DCGM counters required for the DCGM_EXP_POWER_LIMIT_CHANGES_TOTAL metric
+func appendDCGMPowerLimitChangesDependency(cs *dcgmexporter.CounterSet, allCounters []dcgmexporter.Counter) []dcgmexporter.Counter {
+	if len(cs.ExporterCounters) > 0 {
+		if containsField(cs.ExporterCounters, dcgmexporter.DCGMPowerLimitChanges) &&
+			!containsField(allCounters, dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT) {
+			allCounters = append(allCounters,
+				dcgmexporter.Counter{
+					FieldID: dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT,
+				})
+		}
+	}
+	return allCounters
+}
+
 func containsField(slice []dcgmexporter.Counter, fieldID dcgmexporter.ExporterCounter) bool {
 	return slices.ContainsFunc(slice, func(counter dcgmexporter.Counter) bool {
 		return counter.FieldID == dcgm.Short(fieldID)
@@ -462,12 +1862,25 @@ func getCounters(config *dcgmexporter.Config) *dcgmexporter.CounterSet {
 		logrus.Fatal(err)
 	}
 
+	mode := dcgmexporter.ApplyUtilizationMode(cs, config)
+	logrus.Infof("Utilization mode: %s", mode)
+
+	dcgmexporter.ApplyProfilingMultiplexing(cs, config)
+
+	dcgmexporter.ApplyShard(cs, config)
+
 	// Copy labels from DCGM Counters to ExporterCounters
 	for i := range cs.DCGMCounters {
 		if cs.DCGMCounters[i].PromType == "label" {
 			cs.ExporterCounters = append(cs.ExporterCounters, cs.DCGMCounters[i])
 		}
 	}
+
+	config.FieldCollectIntervals = cs.CollectIntervals
+	config.FieldAggregations = cs.Aggregations
+	config.FieldHistograms = cs.Histograms
+	config.CounterGroups = cs.Groups
+
 	return cs
 }
 
@@ -481,6 +1894,43 @@ func fillConfigMetricGroups(config *dcgmexporter.Config) {
 		logrus.Info("Collecting DCP Metrics")
 		config.MetricGroups = groups
 	}
+
+	if config.CounterProfile != "" {
+		fillGPUProfilingFields(config)
+	}
+}
+
+// fillGPUProfilingFields reads the profiling fields supported by every GPU, so that the fields of the counter profile
+// are collected on the GPUs supporting them. The metric groups of the GPUs are merged, a profiling field is collected
+// when one of the GPUs supports it.
+func fillGPUProfilingFields(config *dcgmexporter.Config) {
+	gpus, err := dcgm.GetSupportedDevices()
+	if err != nil {
+		logrus.WithError(err).Warn("Unable to list the GPUs, the profiling fields are collected as on the first GPU")
+		return
+	}
+
+	config.GPUProfilingFields = map[uint][]uint{}
+	for _, gpu := range gpus {
+		groups, err := dcgm.GetSupportedMetricGroups(gpu)
+		if err != nil {
+			logrus.WithError(err).Infof("No profiling fields on GPU %d", gpu)
+			config.GPUProfilingFields[gpu] = []uint{}
+			continue
+		}
+
+		for _, group := range groups {
+			config.GPUProfilingFields[gpu] = append(config.GPUProfilingFields[gpu], group.FieldIds...)
+
+			if !slices.ContainsFunc(config.MetricGroups, func(g dcgm.MetricGroup) bool {
+				return g.Major == group.Major && g.Minor == group.Minor && slices.Equal(g.FieldIds, group.FieldIds)
+			}) {
+				config.MetricGroups = append(config.MetricGroups, group)
+			}
+		}
+	}
+
+	config.CollectDCP = len(config.MetricGroups) > 0
 }
 
 func enableDebugLogging(config *dcgmexporter.Config) {
@@ -496,16 +1946,41 @@ func enableDebugLogging(config *dcgmexporter.Config) {
 }
 
 func initDCGM(config *dcgmexporter.Config) func() {
+	cleanup, err := connectDCGM(config)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	return cleanup
+}
+
+// connectDCGMHook connects to DCGM, it is replaced by the tests.
+var connectDCGMHook = connectDCGM
+
+// connectDCGM initializes DCGM, it returns the cleanup function of DCGM, which is nil when it fails.
+func connectDCGM(config *dcgmexporter.Config) (func(), error) {
 	if config.UseRemoteHE {
 		logrus.Info("Attemping to connect to remote hostengine at ", config.RemoteHEInfo)
 		cleanup, err := dcgm.Init(dcgm.Standalone, config.RemoteHEInfo, "0")
 		if err != nil {
-			cleanup()
-			logrus.Fatal(err)
+			return nil, err
 		}
-		return cleanup
+		dcgmexporter.SetHostengineMode(dcgmexporter.HostengineModeStandalone)
+		return cleanup, nil
 	} else {
 
+		if config.HostengineDetection {
+			if hostengine, ok := detectHostengine(); ok {
+				logrus.Info("Attaching to the running hostengine at ", hostengine.address)
+				cleanup, err := dcgm.Init(dcgm.Standalone, hostengine.address, hostengine.isSocket())
+				if err == nil {
+					dcgmexporter.SetHostengineMode(dcgmexporter.HostengineModeStandalone)
+					return cleanup, nil
+				}
+				logrus.WithError(err).Warn("Unable to attach to the running hostengine, starting an embedded hostengine")
+			}
+		}
+
 		if config.EnableDCGMLog {
 			os.Setenv("__DCGM_DBG_FILE", "-")
 			os.Setenv("__DCGM_DBG_LVL", config.DCGMLogLevel)
@@ -513,12 +1988,89 @@ func initDCGM(config *dcgmexporter.Config) func() {
 
 		cleanup, err := dcgm.Init(dcgm.Embedded)
 		if err != nil {
-			cleanup()
-			logrus.Fatal(err)
+			return nil, err
+		}
+
+		dcgmexporter.SetHostengineMode(dcgmexporter.HostengineModeEmbedded)
+		return cleanup, nil
+	}
+}
+
+// reinitDCGM initializes DCGM again until it succeeds, waiting with an exponential backoff between the attempts, e.g.
+// while the driver is reloaded. It returns false when the exporter is stopped in the meantime.
+func reinitDCGM(
+	config *dcgmexporter.Config, sigs chan os.Signal, supervisor *dcgmexporter.DCGMSupervisor,
+) (func(), bool) {
+	if delay := supervisor.CrashLoopDelay(); delay > 0 {
+		select {
+		case sig := <-sigs:
+			if sig != syscall.SIGHUP {
+				return nil, false
+			}
+		case <-time.After(delay):
+		}
+	}
+
+	for {
+		cleanup, err := connectDCGMHook(config)
+		if err == nil {
+			dcgm.FieldsInit()
+			supervisor.Reconnected()
+
+			logrus.Info("DCGM successfully reinitialized!")
+			dcgmexporter.UpdateDriverInfo()
+
+			return func() {
+				dcgm.FieldsTerm()
+				cleanup()
+			}, true
+		}
+
+		backoff := supervisor.Backoff()
+		logrus.WithError(err).Errorf("Unable to reinitialize DCGM, retrying in %s", backoff)
+
+		select {
+		case sig := <-sigs:
+			if sig != syscall.SIGHUP {
+				return nil, false
+			}
+		case <-time.After(backoff):
 		}
+	}
+}
+
+// parseDeviceIndices parses a list of indices and ranges of indices, e.g. 0 and 2-4.
+func parseDeviceIndices(numbers []string) ([]int, error) {
+	var indices []int
+	for _, numberOrRange := range numbers {
+		rangeTokens := strings.Split(numberOrRange, "-")
+		rangeTokenCount := len(rangeTokens)
+		if rangeTokenCount > 2 {
+			return nil, fmt.Errorf("range can only be '<number>-<number>', but found '%s'", numberOrRange)
+		} else if rangeTokenCount == 1 {
+			number, err := strconv.Atoi(rangeTokens[0])
+			if err != nil {
+				return nil, err
+			}
+			indices = append(indices, number)
+		} else {
+			start, err := strconv.Atoi(rangeTokens[0])
+			if err != nil {
+				return nil, err
+			}
+			end, err := strconv.Atoi(rangeTokens[1])
+			if err != nil {
+				return nil, err
+			}
 
-		return cleanup
+			// Add the range to the indices
+			for i := start; i <= end; i++ {
+				indices = append(indices, i)
+			}
+		}
 	}
+
+	return indices, nil
 }
 
 func parseDeviceOptions(devices string) (dcgmexporter.DeviceOptions, error) {
@@ -542,33 +2094,10 @@ func parseDeviceOptions(devices string) (dcgmexporter.DeviceOptions, error) {
 			// No range means all present devices of the type
 			indices = append(indices, -1)
 		} else {
-			numbers := strings.Split(letterAndRange[1], ",")
-			for _, numberOrRange := range numbers {
-				rangeTokens := strings.Split(numberOrRange, "-")
-				rangeTokenCount := len(rangeTokens)
-				if rangeTokenCount > 2 {
-					return dOpt, fmt.Errorf("range can only be '<number>-<number>', but found '%s'", numberOrRange)
-				} else if rangeTokenCount == 1 {
-					number, err := strconv.Atoi(rangeTokens[0])
-					if err != nil {
-						return dOpt, err
-					}
-					indices = append(indices, number)
-				} else {
-					start, err := strconv.Atoi(rangeTokens[0])
-					if err != nil {
-						return dOpt, err
-					}
-					end, err := strconv.Atoi(rangeTokens[1])
-					if err != nil {
-						return dOpt, err
-					}
-
-					// Add the range to the indices
-					for i := start; i <= end; i++ {
-						indices = append(indices, i)
-					}
-				}
+			var err error
+			indices, err = parseDeviceIndices(strings.Split(letterAndRange[1], ","))
+			if err != nil {
+				return dOpt, err
 			}
 		}
 
@@ -577,6 +2106,26 @@ func parseDeviceOptions(devices string) (dcgmexporter.DeviceOptions, error) {
 		} else {
 			dOpt.MinorRange = indices
 		}
+	} else if count == 1 {
+		// A list of GPU indices and GPU or MIG instance UUIDs
+		var numbers []string
+		for _, id := range strings.Split(letter, ",") {
+			id = strings.TrimSpace(id)
+			if strings.HasPrefix(id, dcgmexporter.GPU_UUID_PREFIX) ||
+				strings.HasPrefix(id, dcgmexporter.MIG_UUID_PREFIX) {
+				dOpt.UUIDs = append(dOpt.UUIDs, id)
+			} else {
+				numbers = append(numbers, id)
+			}
+		}
+
+		if len(numbers) > 0 {
+			indices, err := parseDeviceIndices(numbers)
+			if err != nil {
+				return dOpt, fmt.Errorf("invalid device option '%s': %w", devices, err)
+			}
+			dOpt.MajorRange = indices
+		}
 	} else {
 		return dOpt, fmt.Errorf("the only valid options preceding ':<range>' are 'g' or 'i', but found '%s'", letter)
 	}
@@ -584,6 +2133,23 @@ func parseDeviceOptions(devices string) (dcgmexporter.DeviceOptions, error) {
 	return dOpt, nil
 }
 
+// parseShard parses the <index>/<count> shard of the exporter, the index counting from 1. It returns a count of 0 when
+// the shard is empty.
+func parseShard(value string) (int, int, error) {
+	if value == "" {
+		return 0, 0, nil
+	}
+
+	index, count, found := strings.Cut(value, "/")
+	shardIndex, indexErr := strconv.Atoi(strings.TrimSpace(index))
+	shardCount, countErr := strconv.Atoi(strings.TrimSpace(count))
+	if !found || indexErr != nil || countErr != nil || shardCount < 1 || shardIndex < 1 || shardIndex > shardCount {
+		return 0, 0, fmt.Errorf("invalid %s parameter value: %s; expected <index>/<count>, e.g. 2/4", CLIShard, value)
+	}
+
+	return shardIndex, shardCount, nil
+}
+
 func contextToConfig(c *cli.Context) (*dcgmexporter.Config, error) {
 	gOpt, err := parseDeviceOptions(c.String(CLIGPUDevices))
 	if err != nil {
@@ -600,13 +2166,165 @@ func contextToConfig(c *cli.Context) (*dcgmexporter.Config, error) {
 		return nil, err
 	}
 
+	if len(sOpt.UUIDs) > 0 || len(cOpt.UUIDs) > 0 {
+		return nil, fmt.Errorf("UUIDs can only be used in --%s", CLIGPUDevices)
+	}
+
+	shardIndex, shardCount, err := parseShard(c.String(CLIShard))
+	if err != nil {
+		return nil, err
+	}
+
+	switch dcgmexporter.ShardBy(c.String(CLIShardBy)) {
+	case dcgmexporter.ShardByGPU, dcgmexporter.ShardByField:
+	default:
+		return nil, fmt.Errorf("invalid %s parameter value: %s", CLIShardBy, c.String(CLIShardBy))
+	}
+
+	switch dcgmexporter.KubernetesConfigKind(c.String(CLIKubernetesConfigKind)) {
+	case dcgmexporter.KubernetesConfigKindCRD, dcgmexporter.KubernetesConfigKindConfigMap:
+	default:
+		return nil, fmt.Errorf("invalid %s parameter value: %s", CLIKubernetesConfigKind,
+			c.String(CLIKubernetesConfigKind))
+	}
+
 	dcgmLogLevel := c.String(CLIDCGMLogLevel)
 	if !slices.Contains(dcgmexporter.DCGMDbgLvlValues, dcgmLogLevel) {
 		return nil, fmt.Errorf("invalid %s parameter value: %s", CLIDCGMLogLevel, dcgmLogLevel)
 	}
 
+	switch dcgmexporter.UtilizationMode(c.String(CLIUtilizationMode)) {
+	case dcgmexporter.UtilizationModeLegacy, dcgmexporter.UtilizationModeProfiling, dcgmexporter.UtilizationModeBoth:
+	default:
+		return nil, fmt.Errorf("invalid %s parameter value: %s", CLIUtilizationMode, c.String(CLIUtilizationMode))
+	}
+
+	switch dcgmexporter.ProfilingMultiplexing(c.String(CLIProfilingMultiplexing)) {
+	case dcgmexporter.ProfilingMultiplexingWarn, dcgmexporter.ProfilingMultiplexingDrop:
+	default:
+		return nil, fmt.Errorf("invalid %s parameter value: %s", CLIProfilingMultiplexing,
+			c.String(CLIProfilingMultiplexing))
+	}
+
+	switch dcgmexporter.MetricNames(c.String(CLIMetricNames)) {
+	case dcgmexporter.MetricNamesLegacy, dcgmexporter.MetricNamesPrometheus:
+	default:
+		return nil, fmt.Errorf("invalid %s parameter value: %s", CLIMetricNames, c.String(CLIMetricNames))
+	}
+
+	switch dcgmexporter.SampleTimestamps(c.String(CLISampleTimestamps)) {
+	case dcgmexporter.SampleTimestampsNone, dcgmexporter.SampleTimestampsExemplar, dcgmexporter.SampleTimestampsMetric:
+	default:
+		return nil, fmt.Errorf("invalid %s parameter value: %s", CLISampleTimestamps, c.String(CLISampleTimestamps))
+	}
+
+	switch dcgmexporter.MIGStrategy(c.String(CLIMIGStrategy)) {
+	case "", dcgmexporter.MIGStrategyNone, dcgmexporter.MIGStrategySingle, dcgmexporter.MIGStrategyMixed:
+	default:
+		return nil, fmt.Errorf("invalid %s parameter value: %s", CLIMIGStrategy, c.String(CLIMIGStrategy))
+	}
+
+	if c.Int(CLICollectWorkers) < 1 {
+		return nil, fmt.Errorf("invalid %s parameter value: %d", CLICollectWorkers, c.Int(CLICollectWorkers))
+	}
+
+	if c.Bool(CLIEnergyAveragePower) && !c.Bool(CLIEnergyCounters) {
+		return nil, fmt.Errorf("--%s requires --%s", CLIEnergyAveragePower, CLIEnergyCounters)
+	}
+
+	if c.Int(CLIDiagInterval) < 0 {
+		return nil, fmt.Errorf("invalid %s parameter value: %d", CLIDiagInterval, c.Int(CLIDiagInterval))
+	}
+
+	if c.Int(CLIDiagLevel) < dcgmexporter.DefaultDiagLevel || c.Int(CLIDiagLevel) > dcgmexporter.MaxDiagLevel {
+		return nil, fmt.Errorf("invalid %s parameter value: %d", CLIDiagLevel, c.Int(CLIDiagLevel))
+	}
+
+	if c.Int(CLIKubeletCallTimeout) < 1 {
+		return nil, fmt.Errorf("invalid %s parameter value: %d", CLIKubeletCallTimeout, c.Int(CLIKubeletCallTimeout))
+	}
+
+	if c.Int(CLIKubeletKeepalive) < 0 {
+		return nil, fmt.Errorf("invalid %s parameter value: %d", CLIKubeletKeepalive, c.Int(CLIKubeletKeepalive))
+	}
+
+	if c.Int(CLIStateRetention) < 0 {
+		return nil, fmt.Errorf("invalid %s parameter value: %d", CLIStateRetention, c.Int(CLIStateRetention))
+	}
+
+	if c.Int(CLIDCGMUpdateFreq) < 0 {
+		return nil, fmt.Errorf("invalid %s parameter value: %d", CLIDCGMUpdateFreq, c.Int(CLIDCGMUpdateFreq))
+	}
+
+	if c.Float64(CLIDCGMMaxKeepAge) < 0 {
+		return nil, fmt.Errorf("invalid %s parameter value: %v", CLIDCGMMaxKeepAge, c.Float64(CLIDCGMMaxKeepAge))
+	}
+
+	if c.Int(CLIDCGMMaxKeepSamples) < 0 {
+		return nil, fmt.Errorf("invalid %s parameter value: %d", CLIDCGMMaxKeepSamples, c.Int(CLIDCGMMaxKeepSamples))
+	}
+
+	offlineModes := 0
+	for _, mode := range []string{CLISimulate, CLIRecord, CLIReplay} {
+		if c.String(mode) != "" {
+			offlineModes++
+		}
+	}
+	if offlineModes > 1 {
+		return nil, fmt.Errorf("only one of --%s, --%s and --%s can be set", CLISimulate, CLIRecord, CLIReplay)
+	}
+	if c.Bool(CLIDiag) && (c.String(CLISimulate) != "" || c.String(CLIReplay) != "") {
+		return nil, fmt.Errorf("--%s cannot be used with --%s or --%s", CLIDiag, CLISimulate, CLIReplay)
+	}
+
+	// The exporters of the hostengines are run with an empty list
+	var remoteHostengines []string
+	for _, hostengine := range c.StringSlice(CLIRemoteHostengines) {
+		if hostengine = strings.TrimSpace(hostengine); hostengine != "" {
+			remoteHostengines = append(remoteHostengines, hostengine)
+		}
+	}
+	if len(remoteHostengines) > 0 && (offlineModes > 0 || c.Bool(CLINoHostname)) {
+		return nil, fmt.Errorf("--%s cannot be used with --%s, --%s, --%s or --%s",
+			CLIRemoteHostengines, CLISimulate, CLIRecord, CLIReplay, CLINoHostname)
+	}
+
+	if len(remoteHostengines) > 0 && c.String(CLIHostname) != "" {
+		return nil, fmt.Errorf("--%s cannot be used with --%s, the hostengines label their metrics",
+			CLIRemoteHostengines, CLIHostname)
+	}
+
+	if len(remoteHostengines) > 0 && c.String(CLIStateFile) != "" {
+		return nil, fmt.Errorf("--%s cannot be used with --%s, the exporters of the hostengines would share the file",
+			CLIRemoteHostengines, CLIStateFile)
+	}
+
+	if c.String(CLITegrastats) != "" && (offlineModes > 0 || len(remoteHostengines) > 0 || c.Bool(CLIDiag)) {
+		return nil, fmt.Errorf("--%s cannot be used with --%s, --%s, --%s, --%s or --%s",
+			CLITegrastats, CLISimulate, CLIRecord, CLIReplay, CLIRemoteHostengines, CLIDiag)
+	}
+
+	collectorsFiles := c.StringSlice(CLIFieldsFile)
+	if c.String(CLIReplay) != "" && !c.IsSet(CLIFieldsFile) && c.String(CLIProfile) == "" {
+		// The replay exports the counters of the recording by default
+		collectorsFiles = []string{filepath.Join(c.String(CLIReplay), dcgmexporter.RecordedCountersFile)}
+	}
+	if len(collectorsFiles) == 0 || slices.Contains(collectorsFiles, "") {
+		return nil, fmt.Errorf("invalid %s parameter value: %s", CLIFieldsFile, strings.Join(collectorsFiles, ","))
+	}
+
+	if profile := c.String(CLIProfile); profile != "" {
+		if !slices.Contains(dcgmexporter.CounterProfiles, profile) {
+			return nil, fmt.Errorf("invalid %s parameter value: %s", CLIProfile, profile)
+		}
+		// The counters files override the profile when they are set, the default one is replaced by the profile
+		if !c.IsSet(CLIFieldsFile) {
+			collectorsFiles = []string{""}
+		}
+	}
+
 	return &dcgmexporter.Config{
-		CollectorsFile:             c.String(CLIFieldsFile),
+		CollectorsFile:             collectorsFiles[0],
 		Address:                    c.String(CLIAddress),
 		CollectInterval:            c.Int(CLICollectInterval),
 		Kubernetes:                 c.Bool(CLIKubernetes),
@@ -631,5 +2349,129 @@ func contextToConfig(c *cli.Context) (*dcgmexporter.Config, error) {
 		DCGMLogLevel:               dcgmLogLevel,
 		PodResourcesKubeletSocket:  c.String(CLIPodResourcesKubeletSocket),
 		HPCJobMappingDir:           c.String(CLIHPCJobMappingDir),
+		KubernetesPodLabels:        c.StringSlice(CLIKubernetesPodLabels),
+		KubernetesPodAnnotations:   c.StringSlice(CLIKubernetesPodAnnotations),
+		KubernetesPodOwner:         c.Bool(CLIKubernetesPodOwner),
+		KubernetesGPUAllocation:    c.Bool(CLIKubernetesGPUAllocation),
+		DevicePluginConfig:         c.String(CLIDevicePluginConfig),
+		KubernetesDeviceIDParsers:  c.StringSlice(CLIKubernetesDeviceIDParsers),
+		KubernetesNamespaces:       c.StringSlice(CLIKubernetesNamespaces),
+		KubernetesPodLabelSelector: c.String(CLIKubernetesPodLabelSelector),
+		KubernetesPodFilterMode:    dcgmexporter.KubernetesPodFilterMode(c.String(CLIKubernetesPodFilterMode)),
+		KubernetesPodAggregation:   c.Bool(CLIKubernetesPodAggregation),
+		KubernetesVirtualGPUs:      c.Bool(CLIKubernetesVirtualGPUs),
+		RemoteWriteURL:             c.String(CLIRemoteWriteURL),
+		RemoteWriteBearerTokenFile: c.String(CLIRemoteWriteBearerTokenFile),
+		RemoteWriteUsername:        c.String(CLIRemoteWriteUsername),
+		RemoteWritePasswordFile:    c.String(CLIRemoteWritePasswordFile),
+		RemoteWriteTLSCAFile:       c.String(CLIRemoteWriteTLSCAFile),
+		RemoteWriteTLSCertFile:     c.String(CLIRemoteWriteTLSCertFile),
+		RemoteWriteTLSKeyFile:      c.String(CLIRemoteWriteTLSKeyFile),
+		RemoteWriteMaxRetries:      c.Uint(CLIRemoteWriteMaxRetries),
+		OTLPEndpoint:               c.String(CLIOTLPEndpoint),
+		OTLPProtocol:               dcgmexporter.OTLPProtocol(c.String(CLIOTLPProtocol)),
+		OTLPInsecure:               c.Bool(CLIOTLPInsecure),
+		OTLPHeaders:                c.StringSlice(CLIOTLPHeaders),
+		OTLPClusterName:            c.String(CLIOTLPClusterName),
+		OTLPResourceAttributes:     c.StringSlice(CLIOTLPResourceAttributes),
+		StatsDAddress:              c.String(CLIStatsDAddress),
+		StatsDPrefix:               c.String(CLIStatsDPrefix),
+		StatsDTags:                 c.StringSlice(CLIStatsDTags),
+		KafkaBrokers:               c.StringSlice(CLIKafkaBrokers),
+		KafkaTopic:                 c.String(CLIKafkaTopic),
+		KafkaFormat:                dcgmexporter.KafkaFormat(c.String(CLIKafkaFormat)),
+		KafkaTLS:                   c.Bool(CLIKafkaTLS),
+		KafkaTLSCAFile:             c.String(CLIKafkaTLSCAFile),
+		KafkaTLSCertFile:           c.String(CLIKafkaTLSCertFile),
+		KafkaTLSKeyFile:            c.String(CLIKafkaTLSKeyFile),
+		KafkaSASLUsername:          c.String(CLIKafkaSASLUsername),
+		KafkaSASLPasswordFile:      c.String(CLIKafkaSASLPasswordFile),
+		KubernetesExemplars:        c.Bool(CLIKubernetesExemplars),
+		OpenMetrics:                c.Bool(CLIOpenMetrics),
+		RelabelConfig:              c.String(CLIRelabelConfig),
+		LabelAllowlist:             c.StringSlice(CLILabelAllowlist),
+		JobStats:                   c.Bool(CLIJobStats),
+		SlurmJobMapping:            c.Bool(CLISlurmJobMapping),
+		SlurmJobLabels:             c.StringSlice(CLISlurmJobLabels),
+		JobMapDir:                  c.String(CLIJobMapDir),
+		ContainerMapping:           c.Bool(CLIContainerMapping),
+		DockerSocket:               c.String(CLIDockerSocket),
+		ContainerdStateDir:         c.String(CLIContainerdStateDir),
+		WebTLSCertFile:             c.String(CLIWebTLSCert),
+		WebTLSKeyFile:              c.String(CLIWebTLSKey),
+		WebTLSClientCAFile:         c.String(CLIWebTLSClientCA),
+		WebBasicAuthUsersFile:      c.String(CLIWebBasicAuthUsersFile),
+		WebBearerTokenFile:         c.String(CLIWebBearerTokenFile),
+		EnableDebugEndpoints:       c.Bool(CLIEnableDebugEndpoints),
+		WebListenUnixSocket:        c.String(CLIWebListenUnixSocket),
+		WebListenUnixSocketMode:    c.String(CLIWebListenUnixSocketMode),
+		WatchCollectors:            c.Bool(CLIWatchCollectors),
+		WebEnableReload:            c.Bool(CLIWebEnableReload),
+		Simulate:                   c.String(CLISimulate),
+		Record:                     c.String(CLIRecord),
+		Replay:                     c.String(CLIReplay),
+		LogSampleInterval:          c.Int(CLILogSampleInterval),
+		MonotonicCounters:          c.Bool(CLIMonotonicCounters),
+		DerivedMetrics:             c.String(CLIDerivedMetrics),
+		UtilizationMode:            dcgmexporter.UtilizationMode(c.String(CLIUtilizationMode)),
+		MIGRefreshInterval:         c.Int(CLIMIGRefreshInterval),
+		DCGMCheckInterval:          c.Int(CLIDCGMCheckInterval),
+		RemoteHostengines:          remoteHostengines,
+		CollectWorkers:             c.Int(CLICollectWorkers),
+		ScrapeCacheMaxAge:          c.Int(CLIScrapeCacheMaxAge),
+		BackgroundCollection:       c.Bool(CLIBackgroundCollection),
+		GPUTopologyLabels:          c.Bool(CLIGPUTopologyLabels),
+		EnergyCounters:             c.Bool(CLIEnergyCounters),
+		EnergyAveragePower:         c.Bool(CLIEnergyAveragePower),
+		Diag:                       c.Bool(CLIDiag),
+		DiagInterval:               c.Int(CLIDiagInterval),
+		DiagLevel:                  c.Int(CLIDiagLevel),
+		KubernetesEvents:           c.Bool(CLIKubernetesEvents),
+		WebhookURLs:                c.StringSlice(CLIWebhookURLs),
+		WebhookSecretFile:          c.String(CLIWebhookSecretFile),
+		WebhookMaxRetries:          c.Uint(CLIWebhookMaxRetries),
+		ReadinessGating:            c.Bool(CLIReadinessGating),
+		NVMLFallback:               c.Bool(CLINVMLFallback),
+		Tegrastats:                 c.String(CLITegrastats),
+		NoResourceDetection:        c.Bool(CLINoResourceDetection),
+		KubernetesSharingMetrics:   c.Bool(CLIKubernetesSharingMetrics),
+		KubernetesMappingAPI:       c.Bool(CLIKubernetesMappingAPI),
+		TransformPlugins:           c.StringSlice(CLITransformPlugins),
+		TransformHooks:             c.StringSlice(CLITransformHooks),
+		WebMaxRequestsInFlight:     c.Int(CLIWebMaxRequestsInFlight),
+		WebClientRateLimit:         c.Float64(CLIWebClientRateLimit),
+		WebClientRateBurst:         c.Int(CLIWebClientRateBurst),
+		Hostname:                   c.String(CLIHostname),
+		ExternalLabels:             c.StringSlice(CLIExternalLabels),
+		HostengineDetection:        c.Bool(CLIHostengineDetection),
+		DCGMUpdateFreq:             c.Int(CLIDCGMUpdateFreq),
+		DCGMMaxKeepAge:             c.Float64(CLIDCGMMaxKeepAge),
+		DCGMMaxKeepSamples:         c.Int(CLIDCGMMaxKeepSamples),
+		ProfilingMultiplexing:      dcgmexporter.ProfilingMultiplexing(c.String(CLIProfilingMultiplexing)),
+		HealthScoreRules:           c.String(CLIHealthScoreRules),
+		StateFile:                  c.String(CLIStateFile),
+		StateRetention:             c.Int(CLIStateRetention),
+		MetricNames:                dcgmexporter.MetricNames(c.String(CLIMetricNames)),
+		ExternalLabelsDir:          c.String(CLIExternalLabelsDir),
+		MIGStrategy:                dcgmexporter.MIGStrategy(c.String(CLIMIGStrategy)),
+		KubeletCallTimeout:         c.Int(CLIKubeletCallTimeout),
+		KubeletKeepalive:           c.Int(CLIKubeletKeepalive),
+		KubernetesAttributeNames:   c.StringSlice(CLIKubernetesAttributeNames),
+		CollectorsOverlays:         collectorsFiles[1:],
+		CounterProfile:             c.String(CLIProfile),
+		SampleTimestamps:           dcgmexporter.SampleTimestamps(c.String(CLISampleTimestamps)),
+		SampleAge:                  c.Bool(CLISampleAge),
+		MIGRollup:                  c.Bool(CLIMIGRollup),
+		ShardIndex:                 shardIndex,
+		ShardCount:                 shardCount,
+		ShardBy:                    dcgmexporter.ShardBy(c.String(CLIShardBy)),
+		WebCompression:             c.StringSlice(CLIWebCompression),
+		FabricLeaderElection:       c.Bool(CLIFabricLeaderElection),
+		FabricLease:                c.String(CLIFabricLease),
+		KubernetesConfig:           c.String(CLIKubernetesConfig),
+		KubernetesConfigKind:       dcgmexporter.KubernetesConfigKind(c.String(CLIKubernetesConfigKind)),
+		AdminAPI:                   c.Bool(CLIAdminAPI),
+		AdminAPITokenFile:          c.String(CLIAdminAPITokenFile),
+		KubernetesPodAllocation:    c.Bool(CLIKubernetesPodAllocation),
 	}, nil
 }
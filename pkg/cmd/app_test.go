@@ -17,11 +17,17 @@
 package cmd
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
 
 	"github.com/NVIDIA/dcgm-exporter/internal/pkg/testutils"
 	"github.com/NVIDIA/dcgm-exporter/pkg/dcgmexporter"
@@ -193,3 +199,159 @@ func Test_getFieldEntityGroupTypeSystemInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestContextToConfig_OfflineModes(t *testing.T) {
+	runWithArgs := func(args ...string) (*dcgmexporter.Config, error) {
+		var config *dcgmexporter.Config
+		app := NewApp()
+		app.Action = func(c *cli.Context) (err error) {
+			config, err = contextToConfig(c)
+			return err
+		}
+
+		err := app.Run(append([]string{"dcgm-exporter"}, args...))
+
+		return config, err
+	}
+
+	// The replay exports the counters of the recording by default
+	config, err := runWithArgs("--replay", "/tmp/recording")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/tmp/recording", dcgmexporter.RecordedCountersFile), config.CollectorsFile)
+
+	config, err = runWithArgs("--replay", "/tmp/recording", "-f", "/tmp/counters.csv")
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/counters.csv", config.CollectorsFile)
+	assert.Empty(t, config.CollectorsOverlays)
+
+	// The later counters files override the first one
+	config, err = runWithArgs("-f", "/tmp/base.csv", "-f", "/tmp/h100.csv", "-f", "/tmp/node.csv")
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/base.csv", config.CollectorsFile)
+	assert.Equal(t, []string{"/tmp/h100.csv", "/tmp/node.csv"}, config.CollectorsOverlays)
+
+	_, err = runWithArgs("--record", "/tmp/recording", "--simulate", "simulation.yaml")
+	assert.ErrorContains(t, err, "only one of --simulate, --record and --replay can be set")
+
+	config, err = runWithArgs("--remote-hostengines", "node-1:5555, node-2:5555")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"node-1:5555", "node-2:5555"}, config.RemoteHostengines)
+
+	_, err = runWithArgs("--remote-hostengines", "node-1:5555", "--replay", "/tmp/recording")
+	assert.ErrorContains(t, err, "--remote-hostengines cannot be used with")
+
+	_, err = runWithArgs("--tegrastats", "/usr/bin/tegrastats", "--simulate", "simulation.yaml")
+	assert.ErrorContains(t, err, "--tegrastats cannot be used with")
+}
+
+func TestParseDeviceOptions(t *testing.T) {
+	dOpt, err := parseDeviceOptions("g:0,2-3")
+	require.NoError(t, err)
+	assert.Equal(t, dcgmexporter.DeviceOptions{MajorRange: []int{0, 2, 3}}, dOpt)
+
+	// The GPUs can be listed by their index and UUID, and the GPU instances by their UUID
+	dOpt, err = parseDeviceOptions("0,2, GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5,MIG-4ad5f66e-6e4c-5a5a-a7e6-1b6e2e6e0e77")
+	require.NoError(t, err)
+	assert.Equal(t, dcgmexporter.DeviceOptions{
+		MajorRange: []int{0, 2},
+		UUIDs: []string{
+			"GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5",
+			"MIG-4ad5f66e-6e4c-5a5a-a7e6-1b6e2e6e0e77",
+		},
+	}, dOpt)
+
+	_, err = parseDeviceOptions("0,gpu")
+	assert.ErrorContains(t, err, "invalid device option '0,gpu'")
+
+	_, err = parseDeviceOptions("x:0")
+	assert.ErrorContains(t, err, "the only valid options preceding ':<range>' are 'g' or 'i'")
+}
+
+func TestParseShard(t *testing.T) {
+	index, count, err := parseShard("2/4")
+	require.NoError(t, err)
+	assert.Equal(t, 2, index)
+	assert.Equal(t, 4, count)
+
+	index, count, err = parseShard("")
+	require.NoError(t, err)
+	assert.Equal(t, 0, index)
+	assert.Equal(t, 0, count)
+
+	for _, value := range []string{"2", "0/4", "5/4", "1/0", "a/b", "-1/2"} {
+		_, _, err = parseShard(value)
+		assert.ErrorContains(t, err, "invalid shard parameter value: "+value, value)
+	}
+}
+
+func TestConnectDCGM_Failure(t *testing.T) {
+	// A failed connection returns the error, without a cleanup function to call
+	cleanup, err := connectDCGM(&dcgmexporter.Config{UseRemoteHE: true, RemoteHEInfo: "127.0.0.1:1"})
+	assert.Error(t, err)
+	assert.Nil(t, cleanup)
+}
+
+func TestReinitDCGM(t *testing.T) {
+	defer func() {
+		connectDCGMHook = connectDCGM
+	}()
+
+	attempts := make(chan struct{}, 1)
+	connectDCGMHook = func(*dcgmexporter.Config) (func(), error) {
+		attempts <- struct{}{}
+		return nil, errors.New("libdcgm.so not Found")
+	}
+
+	config := &dcgmexporter.Config{}
+	sigs := make(chan os.Signal, 1)
+	done := make(chan bool)
+	go func() {
+		_, ok := reinitDCGM(config, sigs, dcgmexporter.NewDCGMSupervisor(config))
+		done <- ok
+	}()
+
+	waitForAttempt := func() {
+		t.Helper()
+		select {
+		case <-attempts:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "DCGM was not connected again")
+		}
+	}
+
+	// The failed connections are retried after the backoff, which SIGHUP skips
+	for i := 0; i < 3; i++ {
+		waitForAttempt()
+		sigs <- syscall.SIGHUP
+	}
+	waitForAttempt()
+
+	sigs <- syscall.SIGTERM
+	select {
+	case ok := <-done:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "the reinitialization was not stopped")
+	}
+}
+
+func TestInitCollection_NVMLFallback(t *testing.T) {
+	defer func() {
+		connectDCGMHook = connectDCGM
+	}()
+
+	connectDCGMHook = func(*dcgmexporter.Config) (func(), error) {
+		return nil, errors.New("libdcgm.so not Found")
+	}
+
+	// The exporter doesn't start without DCGM, unless it falls back to NVML
+	_, _, _, err := initCollection(&dcgmexporter.Config{})
+	assert.ErrorContains(t, err, "libdcgm.so not Found")
+
+	cleanup, supervisor, useNVML, err := initCollection(&dcgmexporter.Config{NVMLFallback: true})
+	require.NoError(t, err)
+	assert.True(t, useNVML)
+	assert.Nil(t, supervisor)
+	require.NotNil(t, cleanup)
+	cleanup()
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// configFileSections maps the sections of the configuration file to the prefix of the names of their flags. The
+// keys of the other maps are joined to the name of their parent with a dash, and the "enabled" key names the
+// parent itself, e.g. kubernetes.enabled is the kubernetes flag and sinks.kafka.tls.enabled the kafka-tls flag.
+var configFileSections = map[string]string{
+	"kubernetes": "kubernetes",
+	"tls":        "web-tls",
+	"sinks":      "",
+	"transforms": "",
+}
+
+// loadConfigFile sets the flags that are not set on the command line or in the environment to the values of the
+// configuration file. The environment variables referenced in the file, e.g. ${NODE_NAME}, are expanded.
+func loadConfigFile(c *cli.Context) error {
+	path := c.String(CLIConfigFile)
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read the configuration file; err: %w", err)
+	}
+
+	values, err := parseConfigFile(data)
+	if err != nil {
+		return fmt.Errorf("invalid configuration file '%s'; err: %w", path, err)
+	}
+
+	flagNames := map[string]bool{}
+	for _, flag := range c.App.Flags {
+		for _, name := range flag.Names() {
+			flagNames[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !flagNames[name] || name == CLIConfigFile {
+			return fmt.Errorf("invalid configuration file '%s'; err: unknown option '%s'", path, name)
+		}
+
+		if c.IsSet(name) {
+			logrus.Debugf("Option '%s' of the configuration file is overridden by the command line or the environment", name)
+			continue
+		}
+
+		for _, value := range values[name] {
+			if err := c.Set(name, value); err != nil {
+				return fmt.Errorf("invalid configuration file '%s'; err: invalid value '%s' of option '%s': %w",
+					path, value, name, err)
+			}
+		}
+	}
+
+	logrus.Infof("Configuration loaded from '%s'", path)
+
+	return nil
+}
+
+// parseConfigFile returns the values of the configuration file by flag name, lists hold one value per item.
+func parseConfigFile(data []byte) (map[string][]string, error) {
+	var document map[string]interface{}
+	if err := yaml.UnmarshalStrict([]byte(os.ExpandEnv(string(data))), &document); err != nil {
+		return nil, err
+	}
+
+	values := map[string][]string{}
+	for key, value := range document {
+		prefix, isSection := configFileSections[key]
+		if !isSection {
+			prefix = key
+		}
+
+		if err := flattenConfigValue(values, prefix, value, isSection); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+func flattenConfigValue(values map[string][]string, name string, value interface{}, isSection bool) error {
+	if children, ok := value.(map[string]interface{}); ok {
+		for key, child := range children {
+			childName := joinConfigName(name, key)
+			if key == "enabled" {
+				childName = name
+			}
+
+			if err := flattenConfigValue(values, childName, child, false); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if isSection {
+		return fmt.Errorf("the section '%s' must be a map", name)
+	}
+
+	if _, exists := values[name]; exists {
+		return fmt.Errorf("option '%s' is set twice", name)
+	}
+
+	items, isList := value.([]interface{})
+	if !isList {
+		items = []interface{}{value}
+	}
+
+	values[name] = []string{}
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			values[name] = append(values[name], v)
+		case bool:
+			values[name] = append(values[name], strconv.FormatBool(v))
+		case float64:
+			values[name] = append(values[name], strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			return fmt.Errorf("unsupported value of option '%s'", name)
+		}
+	}
+
+	return nil
+}
+
+func joinConfigName(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "-" + key
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/NVIDIA/dcgm-exporter/pkg/dcgmexporter"
+)
+
+func runWithConfigFile(t *testing.T, content string, args ...string) (*dcgmexporter.Config, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	var config *dcgmexporter.Config
+	app := NewApp()
+	app.Action = func(c *cli.Context) error {
+		var err error
+		config, err = contextToConfig(c)
+		return err
+	}
+
+	err := app.Run(append([]string{"dcgm-exporter", "--config", path}, args...))
+
+	return config, err
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	t.Setenv("DCGM_EXPORTER_TEST_CLUSTER", "dgx-a")
+
+	config, err := runWithConfigFile(t, `
+address: ":9500"
+collect-interval: 15000
+kubernetes:
+  enabled: true
+  gpu-id-type: device-name
+  pod-labels: [app, team]
+tls:
+  cert: /etc/tls/tls.crt
+  key: /etc/tls/tls.key
+sinks:
+  remote-write:
+    url: https://prometheus.example.com/api/v1/write
+  otlp:
+    resource-attributes:
+      - cluster=${DCGM_EXPORTER_TEST_CLUSTER}
+  kafka:
+    brokers: [kafka-0:9092]
+    tls:
+      enabled: true
+transforms:
+  label-allowlist: [pod, namespace]
+`, "--address", ":9600")
+	require.NoError(t, err)
+
+	// The command line takes precedence
+	assert.Equal(t, ":9600", config.Address)
+	assert.Equal(t, 15000, config.CollectInterval)
+	assert.True(t, config.Kubernetes)
+	assert.Equal(t, dcgmexporter.DeviceName, config.KubernetesGPUIdType)
+	assert.Equal(t, []string{"app", "team"}, config.KubernetesPodLabels)
+	assert.Equal(t, "/etc/tls/tls.crt", config.WebTLSCertFile)
+	assert.Equal(t, "/etc/tls/tls.key", config.WebTLSKeyFile)
+	assert.Equal(t, "https://prometheus.example.com/api/v1/write", config.RemoteWriteURL)
+	assert.Equal(t, []string{"cluster=dgx-a"}, config.OTLPResourceAttributes)
+	assert.Equal(t, []string{"kafka-0:9092"}, config.KafkaBrokers)
+	assert.True(t, config.KafkaTLS)
+	assert.Equal(t, []string{"pod", "namespace"}, config.LabelAllowlist)
+}
+
+func TestLoadConfigFile_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "unknown option",
+			content: "adress: :9400\n",
+			wantErr: "unknown option 'adress'",
+		},
+		{
+			name:    "unknown option in a section",
+			content: "kubernetes:\n  pod-label: [app]\n",
+			wantErr: "unknown option 'kubernetes-pod-label'",
+		},
+		{
+			name:    "invalid value",
+			content: "collect-interval: often\n",
+			wantErr: "option 'collect-interval'",
+		},
+		{
+			name:    "option set twice",
+			content: "kubernetes: {enabled: true}\ntransforms: {kubernetes: true}\n",
+			wantErr: "set twice",
+		},
+		{
+			name:    "section not a map",
+			content: "sinks: remote-write\n",
+			wantErr: "must be a map",
+		},
+		{
+			name:    "duplicated key",
+			content: "address: :9400\naddress: :9500\n",
+			wantErr: "address",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runWithConfigFile(t, tt.content)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
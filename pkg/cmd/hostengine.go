@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"net"
+	"time"
+)
+
+// hostengineAddress is the address of a nv-hostengine, either a TCP address or the path of a domain socket.
+type hostengineAddress struct {
+	address string
+	socket  bool
+}
+
+func (a hostengineAddress) network() string {
+	if a.socket {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// isSocket is the argument of dcgm.Init telling whether the address is a domain socket.
+func (a hostengineAddress) isSocket() string {
+	if a.socket {
+		return "1"
+	}
+	return "0"
+}
+
+var (
+	// hostengineProbes are the addresses a nv-hostengine started with its defaults listens on, e.g. by the
+	// nvidia-dcgm service of DGX OS
+	hostengineProbes = []hostengineAddress{
+		{address: "/tmp/nv-hostengine", socket: true},
+		{address: "localhost:5555"},
+	}
+	hostengineProbeTimeout = time.Second
+)
+
+// detectHostengine returns the address of a running nv-hostengine, so that the exporter attaches to it instead of
+// running an embedded hostengine next to it.
+func detectHostengine() (hostengineAddress, bool) {
+	for _, probe := range hostengineProbes {
+		conn, err := net.DialTimeout(probe.network(), probe.address, hostengineProbeTimeout)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+
+		return probe, true
+	}
+
+	return hostengineAddress{}, false
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectHostengine(t *testing.T) {
+	defer func(probes []hostengineAddress) {
+		hostengineProbes = probes
+	}(hostengineProbes)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	socketPath := filepath.Join(t.TempDir(), "nv-hostengine")
+	socket, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	defer socket.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed.Close()
+
+	// The first hostengine listening is attached to
+	hostengineProbes = []hostengineAddress{
+		{address: filepath.Join(t.TempDir(), "missing"), socket: true},
+		{address: closed.Addr().String()},
+		{address: listener.Addr().String()},
+		{address: socketPath, socket: true},
+	}
+	hostengine, ok := detectHostengine()
+	require.True(t, ok)
+	assert.Equal(t, listener.Addr().String(), hostengine.address)
+	assert.Equal(t, "0", hostengine.isSocket())
+
+	hostengineProbes = []hostengineAddress{{address: socketPath, socket: true}}
+	hostengine, ok = detectHostengine()
+	require.True(t, ok)
+	assert.Equal(t, "1", hostengine.isSocket())
+
+	// The exporter runs an embedded hostengine when none is running
+	hostengineProbes = []hostengineAddress{{address: closed.Addr().String()}}
+	_, ok = detectHostengine()
+	assert.False(t, ok)
+}
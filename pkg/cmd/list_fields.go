@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/urfave/cli/v2"
+
+	"github.com/NVIDIA/dcgm-exporter/pkg/dcgmexporter"
+)
+
+const CLIListFieldsFormat = "format"
+
+func newListFieldsCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "list-fields",
+		Usage: "Lists the DCGM fields and whether the GPUs of this node support them",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    CLIRemoteHEInfo,
+				Aliases: []string{"r"},
+				Value:   "localhost:5555",
+				Usage:   "Connect to remote hostengine at <HOST>:<PORT>",
+				EnvVars: []string{"DCGM_REMOTE_HOSTENGINE_INFO"},
+			},
+			&cli.StringFlag{
+				Name:    CLIListFieldsFormat,
+				Aliases: []string{"o"},
+				Value:   dcgmexporter.FieldsFormatTable,
+				Usage: fmt.Sprintf("Output format, one of: %s, %s, %s",
+					dcgmexporter.FieldsFormatTable, dcgmexporter.FieldsFormatJSON, dcgmexporter.FieldsFormatCSV),
+			},
+		},
+		Action: listFields,
+	}
+}
+
+func listFields(c *cli.Context) error {
+	format := c.String(CLIListFieldsFormat)
+	switch format {
+	case dcgmexporter.FieldsFormatTable, dcgmexporter.FieldsFormatJSON, dcgmexporter.FieldsFormatCSV:
+	default:
+		return cli.Exit(fmt.Sprintf("unknown format '%s'", format), 1)
+	}
+
+	var (
+		cleanup func()
+		err     error
+	)
+	if c.IsSet(CLIRemoteHEInfo) {
+		cleanup, err = dcgm.Init(dcgm.Standalone, c.String(CLIRemoteHEInfo), "0")
+	} else {
+		cleanup, err = dcgm.Init(dcgm.Embedded)
+	}
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("failed to connect to DCGM: %v", err), 1)
+	}
+	defer cleanup()
+
+	dcgm.FieldsInit()
+	defer dcgm.FieldsTerm()
+
+	fields, err := dcgmexporter.ListFields()
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	return dcgmexporter.WriteFields(c.App.Writer, fields, format)
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestListFields_UnknownFormat(t *testing.T) {
+	defer func(exiter func(int)) {
+		cli.OsExiter = exiter
+	}(cli.OsExiter)
+	cli.OsExiter = func(int) {}
+
+	var output bytes.Buffer
+	app := NewApp()
+	app.Writer = &output
+	app.ErrWriter = &output
+
+	err := app.Run([]string{"dcgm-exporter", "list-fields", "--" + CLIListFieldsFormat, "yaml"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown format 'yaml'")
+	assert.Empty(t, output.String())
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/urfave/cli/v2"
+
+	"github.com/NVIDIA/dcgm-exporter/pkg/dcgmexporter"
+)
+
+const CLIValidateNoGPU = "no-gpu"
+
+func newValidateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "validate",
+		Usage: "Validates the configuration file and the counters file, and exits with an error when they are invalid",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:    CLIFieldsFile,
+				Aliases: []string{"f"},
+				Usage:   "Path to the file, that contains the DCGM fields to collect, it can be set several times",
+				Value:   cli.NewStringSlice("/etc/dcgm-exporter/default-counters.csv"),
+			},
+			&cli.StringFlag{
+				Name:  CLIConfigFile,
+				Usage: "Path to the YAML configuration file",
+			},
+			&cli.StringFlag{
+				Name:  CLIProfile,
+				Usage: "Built-in counter profile the counters files override",
+			},
+			&cli.BoolFlag{
+				Name:  CLIValidateNoGPU,
+				Usage: "Skip the checks that need DCGM, e.g. in CI, the profiling fields are not checked",
+			},
+		},
+		Action: validate,
+	}
+}
+
+func validate(c *cli.Context) error {
+	// The options are parsed by the exporter itself, so that they are validated like at startup
+	args := []string{c.App.Name}
+	if c.IsSet(CLIConfigFile) {
+		args = append(args, "--"+CLIConfigFile, c.String(CLIConfigFile))
+	}
+	if c.IsSet(CLIProfile) {
+		args = append(args, "--"+CLIProfile, c.String(CLIProfile))
+	}
+	if c.IsSet(CLIFieldsFile) || (!c.IsSet(CLIConfigFile) && !c.IsSet(CLIProfile)) {
+		for _, file := range c.StringSlice(CLIFieldsFile) {
+			args = append(args, "--"+CLIFieldsFile, file)
+		}
+	}
+
+	var config *dcgmexporter.Config
+	app := NewApp()
+	app.Writer = c.App.Writer
+	app.ErrWriter = c.App.ErrWriter
+	app.Action = func(c *cli.Context) (err error) {
+		config, err = contextToConfig(c)
+		return err
+	}
+
+	if err := app.Run(args); err != nil {
+		return cli.Exit(fmt.Sprintf("invalid configuration: %v", err), 1)
+	}
+
+	fmt.Fprintf(c.App.Writer, "Configuration is valid\n")
+
+	gpuDetected := false
+	if !c.Bool(CLIValidateNoGPU) {
+		var (
+			cleanup func()
+			err     error
+		)
+		if config.UseRemoteHE {
+			cleanup, err = dcgm.Init(dcgm.Standalone, config.RemoteHEInfo, "0")
+		} else {
+			cleanup, err = dcgm.Init(dcgm.Embedded)
+		}
+
+		if err != nil {
+			fmt.Fprintf(c.App.Writer, "DCGM not available, the profiling fields are not checked: %v\n", err)
+		} else {
+			defer cleanup()
+
+			gpuDetected = true
+			config.MetricGroups, err = dcgm.GetSupportedMetricGroups(0)
+			config.CollectDCP = err == nil
+		}
+	}
+
+	// The built-in profile, if any, is valid, only the files overriding it are checked
+	files := config.CollectorsOverlays
+	if config.CollectorsFile != "" {
+		files = append([]string{config.CollectorsFile}, files...)
+	}
+
+	errors := 0
+	for _, file := range dcgmexporter.CounterFiles(files) {
+		issues, err := dcgmexporter.ValidateCountersFile(file, config, gpuDetected)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("failed to read the counters file '%s': %v", file, err), 1)
+		}
+
+		for _, issue := range issues {
+			fmt.Fprintf(c.App.Writer, "%s:%s\n", file, issue)
+			if !issue.Warning {
+				errors++
+			}
+		}
+	}
+
+	if errors > 0 {
+		return cli.Exit(fmt.Sprintf("%d errors found in the counters file '%s'", errors, strings.Join(files, "', '")), 1)
+	}
+
+	// The counters redefined by the overlays and the includes are reported, the conflicts being the likely mistakes
+	_, overrides, err := dcgmexporter.ReadCounterFiles(files)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("failed to merge the counters files: %v", err), 1)
+	}
+	for _, override := range overrides {
+		fmt.Fprintf(c.App.Writer, "%s\n", override)
+	}
+
+	if len(files) > 0 {
+		fmt.Fprintf(c.App.Writer, "Counters file '%s' is valid\n", strings.Join(files, "', '"))
+	}
+
+	return nil
+}
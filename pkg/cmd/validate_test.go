@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestValidate(t *testing.T) {
+	defer func(exiter func(int)) {
+		cli.OsExiter = exiter
+	}(cli.OsExiter)
+	cli.OsExiter = func(int) {}
+
+	dir := t.TempDir()
+	validCounters := filepath.Join(dir, "valid.csv")
+	require.NoError(t, os.WriteFile(validCounters, []byte("DCGM_FI_DEV_GPU_TEMP, gauge, GPU temperature (in C).\n"), 0o644))
+	invalidCounters := filepath.Join(dir, "invalid.csv")
+	require.NoError(t, os.WriteFile(invalidCounters, []byte("DCGM_FI_DEV_GPU_TEMPERATURE, gauge, GPU temperature (in C).\n"), 0o644))
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("collectors: "+validCounters+"\n"), 0o644))
+	overlayCounters := filepath.Join(dir, "overlay.csv")
+	require.NoError(t, os.WriteFile(overlayCounters, []byte("DCGM_FI_DEV_GPU_TEMP, gauge, GPU temperature (in C)., 30s\n"), 0o644))
+	invalidConfigFile := filepath.Join(dir, "invalid.yaml")
+	require.NoError(t, os.WriteFile(invalidConfigFile, []byte("collect-interval: often\n"), 0o644))
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantErr    bool
+		wantOutput string
+	}{
+		{
+			name:       "valid counters",
+			args:       []string{"-f", validCounters},
+			wantOutput: "Counters file '" + validCounters + "' is valid",
+		},
+		{
+			name:       "invalid counters",
+			args:       []string{"-f", invalidCounters},
+			wantErr:    true,
+			wantOutput: invalidCounters + ":line 1: error: DCGM_FI_DEV_GPU_TEMPERATURE: unknown DCGM field",
+		},
+		{
+			name:       "counters of the configuration file",
+			args:       []string{"--config", configFile},
+			wantOutput: "Counters file '" + validCounters + "' is valid",
+		},
+		{
+			name:       "counters overlays",
+			args:       []string{"-f", validCounters, "-f", overlayCounters},
+			wantOutput: overlayCounters + ":1: DCGM_FI_DEV_GPU_TEMP: overrides the counter defined at " + validCounters + ":1",
+		},
+		{
+			name:       "counter profile",
+			args:       []string{"--profile", "dcp"},
+			wantOutput: "Configuration is valid",
+		},
+		{
+			name:    "unknown counter profile",
+			args:    []string{"--profile", "everything"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid configuration file",
+			args:    []string{"--config", invalidConfigFile, "-f", validCounters},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			app := NewApp()
+			app.Writer = &output
+			app.ErrWriter = &output
+
+			err := app.Run(append([]string{"dcgm-exporter", "validate", "--" + CLIValidateNoGPU}, tt.args...))
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Contains(t, output.String(), tt.wantOutput)
+		})
+	}
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+const (
+	dcgmExporterAdminActionsTotal = "DCGM_EXPORTER_ADMIN_ACTIONS_TOTAL"
+
+	adminAPIPathPrefix = "/v1/gpus/"
+	// adminTokenHeader holds the admin token, the Authorization header being left to the authentication of the server
+	adminTokenHeader = "X-Admin-Token"
+
+	adminActionReset   = "reset"
+	adminActionDrain   = "drain"
+	adminActionUndrain = "undrain"
+)
+
+var (
+	// gpuResetTimeout bounds the reset of a GPU
+	gpuResetTimeout = 2 * time.Minute
+
+	nvmlSetDrainStateHook = nvmlprovider.SetDrainState
+	resetGPUHook          = resetGPU
+	lookPathHook          = exec.LookPath
+)
+
+// AdminAPI serves the endpoints resetting and draining the GPUs, so that the remediation automation acts through the
+// agent it already trusts. It is disabled by default, and its requests must pass the authentication of the server
+// and present the admin token. The actions are run one at a time.
+type AdminAPI struct {
+	token string
+	// nvidiaSMI is the path of the nvidia-smi binary resetting the GPUs
+	nvidiaSMI string
+
+	actionMtx sync.Mutex
+}
+
+func NewAdminAPI(c *Config) (*AdminAPI, error) {
+	if c.AdminAPITokenFile == "" {
+		return nil, errors.New("the admin API requires an admin token file")
+	}
+
+	data, err := readAuthFile(c.AdminAPITokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the admin token file; err: %w", err)
+	}
+
+	api := &AdminAPI{token: strings.TrimSpace(string(data))}
+	if api.token == "" {
+		return nil, fmt.Errorf("the admin token file '%s' is empty", c.AdminAPITokenFile)
+	}
+
+	// Neither DCGM nor NVML expose the reset of a GPU, it is run by nvidia-smi, which the image must provide
+	api.nvidiaSMI, err = lookPathHook("nvidia-smi")
+	if err != nil {
+		return nil, fmt.Errorf("the admin API requires nvidia-smi to reset the GPUs; err: %w", err)
+	}
+
+	logrus.Warnf("Admin API enabled, resetting the GPUs with '%s'", api.nvidiaSMI)
+
+	return api, nil
+}
+
+// authenticate returns whether the request presents the admin token.
+func (a *AdminAPI) authenticate(r *http.Request) bool {
+	token := strings.TrimSpace(r.Header.Get(adminTokenHeader))
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+// handle authenticates the requests of the action and checks that the GPU is known to NVML.
+func (a *AdminAPI) handle(action string, run func(uuid string) (int, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.authenticate(r) {
+			recordAdminAction(action, "unauthorized")
+			http.Error(w, "missing or invalid admin token", http.StatusForbidden)
+			return
+		}
+
+		uuid := mux.Vars(r)["uuid"]
+		if !strings.HasPrefix(uuid, "GPU-") {
+			recordAdminAction(action, "rejected")
+			http.Error(w, fmt.Sprintf("invalid GPU UUID '%s'", uuid), http.StatusBadRequest)
+			return
+		}
+
+		devices, err := nvmlGetDevicesHook()
+		if err != nil {
+			recordAdminAction(action, "failed")
+			http.Error(w, fmt.Sprintf("failed to list the GPUs; err: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !hasDevice(devices, uuid) {
+			recordAdminAction(action, "rejected")
+			http.Error(w, fmt.Sprintf("unknown GPU '%s'", uuid), http.StatusNotFound)
+			return
+		}
+
+		a.actionMtx.Lock()
+		defer a.actionMtx.Unlock()
+
+		logrus.Warnf("Admin API: %s of the GPU '%s' requested by %s", action, uuid, r.RemoteAddr)
+
+		code, err := run(uuid)
+		if err != nil {
+			logrus.WithError(err).Errorf("Admin API: %s of the GPU '%s' failed", action, uuid)
+			if code == http.StatusConflict {
+				recordAdminAction(action, "rejected")
+			} else {
+				recordAdminAction(action, "failed")
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+
+		recordAdminAction(action, "success")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func hasDevice(devices []nvmlprovider.DeviceInfo, uuid string) bool {
+	for _, device := range devices {
+		if device.UUID == uuid {
+			return true
+		}
+	}
+	return false
+}
+
+// reset resets the GPU, which must not run any process.
+func (a *AdminAPI) reset(uuid string) (int, error) {
+	pids, err := nvmlGetRunningProcessIDsHook(uuid)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to list the processes of the GPU; err: %w", err)
+	}
+	if len(pids) > 0 {
+		return http.StatusConflict, fmt.Errorf("the GPU '%s' runs %d processes, drain it first", uuid, len(pids))
+	}
+
+	if err := resetGPUHook(a.nvidiaSMI, uuid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+func (a *AdminAPI) drain(drained bool) func(uuid string) (int, error) {
+	return func(uuid string) (int, error) {
+		if err := nvmlSetDrainStateHook(uuid, drained); err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("failed to set the drain state of the GPU; err: %w", err)
+		}
+		return http.StatusOK, nil
+	}
+}
+
+// resetGPU resets the GPU with nvidia-smi, as neither DCGM nor NVML expose the reset of a GPU.
+func resetGPU(nvidiaSMI, uuid string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), gpuResetTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, nvidiaSMI, "--gpu-reset", "--id="+uuid).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to reset the GPU; err: %w, output: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+func recordAdminAction(action, result string) {
+	selfMetrics.AddCounter(dcgmExporterAdminActionsTotal, "Number of actions requested to the admin API.",
+		map[string]string{"action": action, "result": result}, 1)
+}
+
+// HandleAdmin serves the endpoints of the admin API: POST /v1/gpus/{uuid}/reset resets the GPU, POST
+// /v1/gpus/{uuid}/drain drains it and DELETE /v1/gpus/{uuid}/drain returns it to service.
+func (s *MetricsServer) HandleAdmin(api *AdminAPI) {
+	s.router.HandleFunc(adminAPIPathPrefix+"{uuid}/reset", api.handle(adminActionReset, api.reset)).
+		Methods(http.MethodPost)
+	s.router.HandleFunc(adminAPIPathPrefix+"{uuid}/drain", api.handle(adminActionDrain, api.drain(true))).
+		Methods(http.MethodPost)
+	s.router.HandleFunc(adminAPIPathPrefix+"{uuid}/drain", api.handle(adminActionUndrain, api.drain(false))).
+		Methods(http.MethodDelete)
+}
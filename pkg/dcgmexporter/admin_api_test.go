@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	sysOS "os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+func TestNewAdminAPI(t *testing.T) {
+	_, err := NewAdminAPI(&Config{AdminAPI: true})
+	assert.ErrorContains(t, err, "the admin API requires an admin token file")
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, sysOS.WriteFile(tokenFile, []byte("\n"), 0o600))
+	_, err = NewAdminAPI(&Config{AdminAPI: true, AdminAPITokenFile: tokenFile})
+	assert.ErrorContains(t, err, "is empty")
+
+	// The client certificates don't grant access to the admin API
+	_, err = NewAdminAPI(&Config{AdminAPI: true, WebTLSClientCAFile: "/etc/tls/ca.crt"})
+	assert.ErrorContains(t, err, "the admin API requires an admin token file")
+
+	require.NoError(t, sysOS.WriteFile(tokenFile, []byte("secret\n"), 0o600))
+	lookPathHook = func(string) (string, error) {
+		return "", errors.New("executable file not found in $PATH")
+	}
+	defer func() {
+		lookPathHook = exec.LookPath
+	}()
+	_, err = NewAdminAPI(&Config{AdminAPI: true, AdminAPITokenFile: tokenFile})
+	assert.ErrorContains(t, err, "the admin API requires nvidia-smi to reset the GPUs")
+
+	lookPathHook = func(string) (string, error) {
+		return "/usr/bin/nvidia-smi", nil
+	}
+	api, err := NewAdminAPI(&Config{AdminAPI: true, AdminAPITokenFile: tokenFile})
+	require.NoError(t, err)
+	assert.Equal(t, "secret", api.token)
+	assert.Equal(t, "/usr/bin/nvidia-smi", api.nvidiaSMI)
+}
+
+func TestAdminAPI(t *testing.T) {
+	const gpu = "GPU-00000000-0000-0000-0000-000000000000"
+
+	nvmlGetDevicesHook = func() ([]nvmlprovider.DeviceInfo, error) {
+		return []nvmlprovider.DeviceInfo{{UUID: gpu}}, nil
+	}
+	var pids []uint32
+	nvmlGetRunningProcessIDsHook = func(string) ([]uint32, error) {
+		return pids, nil
+	}
+	var actions []string
+	nvmlSetDrainStateHook = func(uuid string, drained bool) error {
+		if drained {
+			actions = append(actions, "drain "+uuid)
+		} else {
+			actions = append(actions, "undrain "+uuid)
+		}
+		return nil
+	}
+	resetGPUHook = func(nvidiaSMI, uuid string) error {
+		actions = append(actions, nvidiaSMI+" reset "+uuid)
+		return nil
+	}
+	lookPathHook = func(string) (string, error) {
+		return "/usr/bin/nvidia-smi", nil
+	}
+	defer func() {
+		nvmlGetDevicesHook = nvmlprovider.GetDevices
+		nvmlGetRunningProcessIDsHook = nvmlprovider.GetRunningProcessIDs
+		nvmlSetDrainStateHook = nvmlprovider.SetDrainState
+		resetGPUHook = resetGPU
+		lookPathHook = exec.LookPath
+	}()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, sysOS.WriteFile(tokenFile, []byte("secret\n"), 0o600))
+	api, err := NewAdminAPI(&Config{AdminAPI: true, AdminAPITokenFile: tokenFile})
+	require.NoError(t, err)
+
+	server := &MetricsServer{router: mux.NewRouter()}
+	server.HandleAdmin(api)
+
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set(adminTokenHeader, token)
+		}
+		rec := httptest.NewRecorder()
+		server.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(http.MethodPost, "/v1/gpus/"+gpu+"/reset", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = request(http.MethodPost, "/v1/gpus/"+gpu+"/reset", "wrong")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = request(http.MethodPost, "/v1/gpus/MIG-00000000-0000-0000-0000-000000000000/reset", "secret")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = request(http.MethodPost, "/v1/gpus/GPU-11111111-1111-1111-1111-111111111111/reset", "secret")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// The GPUs running processes are not reset
+	pids = []uint32{42}
+	rec = request(http.MethodPost, "/v1/gpus/"+gpu+"/reset", "secret")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "runs 1 processes")
+	assert.Empty(t, actions)
+
+	rec = request(http.MethodPost, "/v1/gpus/"+gpu+"/drain", "secret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	pids = nil
+	rec = request(http.MethodPost, "/v1/gpus/"+gpu+"/reset", "secret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = request(http.MethodDelete, "/v1/gpus/"+gpu+"/drain", "secret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = request(http.MethodGet, "/v1/gpus/"+gpu+"/reset", "secret")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	assert.Equal(t, []string{"drain " + gpu, "/usr/bin/nvidia-smi reset " + gpu, "undrain " + gpu}, actions)
+
+	value, _ := selfMetrics.Value(dcgmExporterAdminActionsTotal,
+		map[string]string{"action": adminActionReset, "result": "rejected"})
+	assert.Equal(t, float64(3), value)
+}
+
+func TestAuthHandler_AdminAPI(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, sysOS.WriteFile(tokenFile, []byte("scrape"), 0o600))
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler, err := newAuthHandler(&Config{WebBearerTokenFile: tokenFile, AdminAPI: true}, ok)
+	require.NoError(t, err)
+
+	// The endpoints of the admin API are behind the authentication of the server, the admin token aside
+	req := httptest.NewRequest(http.MethodPost, "/v1/gpus/GPU-0/reset", nil)
+	req.Header.Set(adminTokenHeader, "secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req.Header.Set("Authorization", "Bearer scrape")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
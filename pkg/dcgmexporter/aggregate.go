@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	dcgmExporterAggregateTargetUp = "DCGM_EXPORTER_AGGREGATE_TARGET_UP"
+
+	aggregateHostengineLabel = "hostengine"
+
+	// selfMetricsPrefix is the prefix of the metrics describing an exporter, those of the aggregated exporters are
+	// not merged
+	selfMetricsPrefix = "DCGM_EXPORTER_"
+)
+
+// AggregateTarget is the exporter collecting the metrics of a remote hostengine, serving them on a Unix domain socket.
+type AggregateTarget struct {
+	Hostengine string
+	Socket     string
+}
+
+// Aggregator scrapes the exporters of the remote hostengines concurrently at every collect interval, and merges
+// their metrics.
+type Aggregator struct {
+	targets  []AggregateTarget
+	interval time.Duration
+	clients  []*http.Client
+}
+
+func NewAggregator(c *Config, targets []AggregateTarget) *Aggregator {
+	a := &Aggregator{
+		targets:  targets,
+		interval: time.Duration(c.CollectInterval) * time.Millisecond,
+	}
+
+	for _, target := range targets {
+		socket := target.Socket
+		a.clients = append(a.clients, &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		})
+	}
+
+	return a
+}
+
+// Run sends the merged metrics to the channel at every collect interval until it is stopped.
+func (a *Aggregator) Run(out chan string, stop chan interface{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	t := time.NewTicker(a.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			ctx, cancel := context.WithTimeout(context.Background(), a.interval)
+			out <- a.collect(ctx)
+			cancel()
+		}
+	}
+}
+
+// collect scrapes every target and returns their metrics in the text exposition format, the targets that cannot be
+// scraped are left out.
+func (a *Aggregator) collect(ctx context.Context) string {
+	results := make([]map[string]*dto.MetricFamily, len(a.targets))
+
+	var wg sync.WaitGroup
+	for i := range a.targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			families, err := a.scrape(ctx, i)
+			up := 1.0
+			if err != nil {
+				logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(),
+					"Unable to scrape the exporter of hostengine '%s'", a.targets[i].Hostengine)
+				up = 0
+			}
+			selfMetrics.SetGauge(dcgmExporterAggregateTargetUp,
+				"Whether the exporter of the remote hostengine was scraped at the last collection (1) or not (0).",
+				map[string]string{aggregateHostengineLabel: a.targets[i].Hostengine}, up)
+
+			results[i] = families
+		}(i)
+	}
+	wg.Wait()
+
+	// The families are merged in the order of the targets, so that the output is stable
+	merged := map[string]*dto.MetricFamily{}
+	for _, families := range results {
+		for name, family := range families {
+			if strings.HasPrefix(name, selfMetricsPrefix) {
+				continue
+			}
+
+			if existing, exists := merged[name]; exists {
+				existing.Metric = append(existing.Metric, family.Metric...)
+			} else {
+				merged[name] = family
+			}
+		}
+	}
+
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		if _, err := expfmt.MetricFamilyToText(&buf, merged[name]); err != nil {
+			logrus.WithError(err).Warnf("Unable to encode the metric '%s'", name)
+		}
+	}
+
+	return buf.String()
+}
+
+func (a *Aggregator) scrape(ctx context.Context, i int) (map[string]*dto.MetricFamily, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/metrics", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.clients[i].Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status '%s'", resp.Status)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metrics; err: %w", err)
+	}
+
+	return families, nil
+}
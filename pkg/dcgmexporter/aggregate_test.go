@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregator_collect(t *testing.T) {
+	dir := t.TempDir()
+
+	serve := func(name, metrics string) AggregateTarget {
+		socket := filepath.Join(dir, name+".sock")
+		listener, err := net.Listen("unix", socket)
+		require.NoError(t, err)
+
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, metrics)
+		})}
+		go func() {
+			_ = server.Serve(listener)
+		}()
+		t.Cleanup(func() {
+			_ = server.Close()
+		})
+
+		return AggregateTarget{Hostengine: name + ":5555", Socket: socket}
+	}
+
+	targets := []AggregateTarget{
+		serve("node-1", `# HELP DCGM_FI_DEV_GPU_TEMP GPU temperature (in C).
+# TYPE DCGM_FI_DEV_GPU_TEMP gauge
+DCGM_FI_DEV_GPU_TEMP{gpu="0",Hostname="node-1"} 40
+# HELP DCGM_EXPORTER_KUBELET_CONNECTED Whether the exporter is connected to the kubelet.
+# TYPE DCGM_EXPORTER_KUBELET_CONNECTED gauge
+DCGM_EXPORTER_KUBELET_CONNECTED 1
+`),
+		serve("node-2", `# HELP DCGM_FI_DEV_GPU_TEMP GPU temperature (in C).
+# TYPE DCGM_FI_DEV_GPU_TEMP gauge
+DCGM_FI_DEV_GPU_TEMP{gpu="0",Hostname="node-2"} 50
+# HELP DCGM_FI_DEV_POWER_USAGE Power draw (in W).
+# TYPE DCGM_FI_DEV_POWER_USAGE gauge
+DCGM_FI_DEV_POWER_USAGE{gpu="0",Hostname="node-2"} 100
+`),
+		{Hostengine: "node-3:5555", Socket: filepath.Join(dir, "missing.sock")},
+	}
+
+	aggregator := NewAggregator(&Config{CollectInterval: 1000}, targets)
+	metrics := aggregator.collect(context.Background())
+
+	// The metrics of the exporters are merged by family, without their own metrics
+	assert.Equal(t, `# HELP DCGM_FI_DEV_GPU_TEMP GPU temperature (in C).
+# TYPE DCGM_FI_DEV_GPU_TEMP gauge
+DCGM_FI_DEV_GPU_TEMP{gpu="0",Hostname="node-1"} 40
+DCGM_FI_DEV_GPU_TEMP{gpu="0",Hostname="node-2"} 50
+# HELP DCGM_FI_DEV_POWER_USAGE Power draw (in W).
+# TYPE DCGM_FI_DEV_POWER_USAGE gauge
+DCGM_FI_DEV_POWER_USAGE{gpu="0",Hostname="node-2"} 100
+`, metrics)
+
+	for hostengine, want := range map[string]float64{"node-1:5555": 1, "node-2:5555": 1, "node-3:5555": 0} {
+		labels := map[string]string{aggregateHostengineLabel: hostengine}
+		up, exists := selfMetrics.Value(dcgmExporterAggregateTargetUp, labels)
+		assert.True(t, exists)
+		assert.Equal(t, want, up, hostengine)
+	}
+}
@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+const (
+	AggregationAvg = "avg"
+	AggregationMax = "max"
+	AggregationMin = "min"
+	AggregationSum = "sum"
+)
+
+var aggregations = map[string]func(samples []aggregationSample) float64{
+	AggregationAvg: func(samples []aggregationSample) float64 {
+		var sum float64
+		for _, sample := range samples {
+			sum += sample.value
+		}
+		return sum / float64(len(samples))
+	},
+	AggregationMax: func(samples []aggregationSample) float64 {
+		result := samples[0].value
+		for _, sample := range samples[1:] {
+			result = math.Max(result, sample.value)
+		}
+		return result
+	},
+	AggregationMin: func(samples []aggregationSample) float64 {
+		result := samples[0].value
+		for _, sample := range samples[1:] {
+			result = math.Min(result, sample.value)
+		}
+		return result
+	},
+	AggregationSum: func(samples []aggregationSample) float64 {
+		var sum float64
+		for _, sample := range samples {
+			sum += sample.value
+		}
+		return sum
+	},
+}
+
+// parseAggregation parses the optional fifth column of a counter; only the gauges can be aggregated.
+func parseAggregation(value, promType string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	if _, exists := aggregations[value]; !exists {
+		names := make([]string, 0, len(aggregations))
+		for name := range aggregations {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return "", fmt.Errorf("unknown aggregation '%s', expected one of: %s", value, strings.Join(names, ", "))
+	}
+
+	if promType != "gauge" {
+		return "", fmt.Errorf("aggregation '%s' of a %s, only the gauges can be aggregated", value, promType)
+	}
+
+	return value, nil
+}
+
+func (cs *CounterSet) setAggregation(fieldID dcgm.Short, aggregation string) {
+	if aggregation == "" {
+		return
+	}
+
+	if cs.Aggregations == nil {
+		cs.Aggregations = map[dcgm.Short]string{}
+	}
+	cs.Aggregations[fieldID] = aggregation
+}
+
+// fieldAggregator keeps the samples of the aggregated fields read over the last collect interval, so that the
+// exported value is e.g. their maximum rather than the last one.
+type fieldAggregator struct {
+	sync.Mutex
+	window       time.Duration
+	aggregations map[dcgm.Short]string
+	// buckets holds the upper bounds of the buckets of the fields exported as histograms of their samples
+	buckets map[dcgm.Short][]float64
+	samples map[fieldSeriesKey][]aggregationSample
+}
+
+// fieldSeriesKey identifies the values of a field read from an entity.
+type fieldSeriesKey struct {
+	entity   dcgm.GroupEntityPair
+	parentID uint
+	fieldID  uint
+}
+
+type aggregationSample struct {
+	ts    int64
+	value float64
+}
+
+// newFieldAggregator returns nil when no field is aggregated nor exported as a histogram.
+func newFieldAggregator(config *Config) *fieldAggregator {
+	if config == nil || (len(config.FieldAggregations) == 0 && len(config.FieldHistograms) == 0) {
+		return nil
+	}
+
+	return &fieldAggregator{
+		window:       time.Duration(config.CollectInterval) * time.Millisecond,
+		aggregations: config.FieldAggregations,
+		buckets:      config.FieldHistograms,
+		samples:      map[fieldSeriesKey][]aggregationSample{},
+	}
+}
+
+// aggregate adds the values of the aggregated fields and of the histograms to their samples, and replaces the values
+// of the aggregated fields with the aggregate of the samples. A value is sampled once, when its timestamp is newer
+// than the last sample.
+func (a *fieldAggregator) aggregate(
+	entity dcgm.GroupEntityPair, parentID uint, values []dcgm.FieldValue_v1,
+) []dcgm.FieldValue_v1 {
+	a.Lock()
+	defer a.Unlock()
+
+	for i, value := range values {
+		aggregation, isAggregated := a.aggregations[dcgm.Short(value.FieldId)]
+		_, isHistogram := a.buckets[dcgm.Short(value.FieldId)]
+		if !isAggregated && !isHistogram {
+			continue
+		}
+
+		sample, ok := numericFieldValue(value)
+		if !ok {
+			continue
+		}
+
+		key := fieldSeriesKey{entity: entity, parentID: parentID, fieldID: value.FieldId}
+		samples := a.samples[key]
+
+		switch last := len(samples) - 1; {
+		case last >= 0 && value.Ts < samples[last].ts:
+			// The timestamps went backwards, e.g. a replay starting over
+			samples = []aggregationSample{{ts: value.Ts, value: sample}}
+		case last < 0 || value.Ts > samples[last].ts:
+			samples = append(samples, aggregationSample{ts: value.Ts, value: sample})
+		}
+
+		start := value.Ts - a.window.Microseconds()
+		for len(samples) > 1 && samples[0].ts <= start {
+			samples = samples[1:]
+		}
+		a.samples[key] = samples
+
+		if !isAggregated {
+			continue
+		}
+
+		aggregated := doubleFieldValue(aggregations[aggregation](samples))
+		aggregated.Version = value.Version
+		aggregated.FieldId = value.FieldId
+		aggregated.Status = value.Status
+		aggregated.Ts = value.Ts
+		values[i] = aggregated
+	}
+
+	return values
+}
+
+// numericFieldValue returns the value of the int64 and double fields, when they are not blank.
+func numericFieldValue(value dcgm.FieldValue_v1) (float64, bool) {
+	if ToString(value) == SkipDCGMValue {
+		return 0, false
+	}
+
+	switch value.FieldType {
+	case dcgm.DCGM_FT_INT64:
+		return float64(value.Int64()), true
+	case dcgm.DCGM_FT_DOUBLE:
+		return value.Float64(), true
+	}
+
+	return 0, false
+}
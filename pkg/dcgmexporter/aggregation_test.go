@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractCountersAggregation(t *testing.T) {
+	cs, err := extractCounters([][]string{
+		{"DCGM_FI_DEV_POWER_USAGE", "gauge", "power", "100ms", "max"},
+		{"DCGM_FI_DEV_GPU_UTIL", "gauge", "utilization", "", "avg"},
+		{"DCGM_FI_DEV_GPU_TEMP", "gauge", "temperature"},
+	}, &Config{})
+	require.NoError(t, err)
+	assert.Equal(t, map[dcgm.Short]string{
+		dcgm.DCGM_FI_DEV_POWER_USAGE: AggregationMax,
+		dcgm.DCGM_FI_DEV_GPU_UTIL:    AggregationAvg,
+	}, cs.Aggregations)
+
+	_, err = extractCounters([][]string{{"DCGM_FI_DEV_GPU_UTIL", "gauge", "utilization", "", "median"}}, &Config{})
+	assert.Error(t, err)
+	_, err = extractCounters([][]string{{"DCGM_FI_DEV_ECC_DBE_VOL_TOTAL", "counter", "errors", "", "max"}}, &Config{})
+	assert.Error(t, err)
+}
+
+func TestFieldAggregator(t *testing.T) {
+	assert.Nil(t, newFieldAggregator(&Config{CollectInterval: 1000}))
+
+	aggregator := newFieldAggregator(&Config{
+		CollectInterval: 1000,
+		FieldAggregations: map[dcgm.Short]string{
+			dcgm.DCGM_FI_DEV_POWER_USAGE: AggregationMax,
+			dcgm.DCGM_FI_DEV_GPU_UTIL:    AggregationAvg,
+		},
+	})
+	gpu := dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU, EntityId: 0}
+
+	sample := func(ts int64, power float64, util int64) []string {
+		powerValue := doubleFieldValue(power)
+		powerValue.FieldId = uint(dcgm.DCGM_FI_DEV_POWER_USAGE)
+		powerValue.Ts = ts
+		utilValue := int64FieldValue(util)
+		utilValue.FieldId = uint(dcgm.DCGM_FI_DEV_GPU_UTIL)
+		utilValue.Ts = ts
+		tempValue := int64FieldValue(40)
+		tempValue.FieldId = uint(dcgm.DCGM_FI_DEV_GPU_TEMP)
+		tempValue.Ts = ts
+
+		values := aggregator.aggregate(gpu, PARENT_ID_IGNORED, []dcgm.FieldValue_v1{powerValue, utilValue, tempValue})
+		result := make([]string, len(values))
+		for i, value := range values {
+			result[i] = ToString(value)
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"300.000000", "10.000000", "40"}, sample(1_000_000, 300, 10))
+	assert.Equal(t, []string{"350.000000", "20.000000", "40"}, sample(1_250_000, 350, 30))
+	// The same sample is not counted twice
+	assert.Equal(t, []string{"350.000000", "20.000000", "40"}, sample(1_250_000, 350, 30))
+	assert.Equal(t, []string{"350.000000", "30.000000", "40"}, sample(1_500_000, 200, 50))
+	// The samples older than the collect interval are dropped
+	assert.Equal(t, []string{"350.000000", "40.000000", "40"}, sample(2_100_000, 250, 40))
+	assert.Equal(t, []string{"250.000000", "40.000000", "40"}, sample(2_600_000, 150, 40))
+	// The samples start over when the timestamps go backwards
+	assert.Equal(t, []string{"100.000000", "0.000000", "40"}, sample(1_000_000, 100, 0))
+
+	// The blank values are not sampled
+	blank := int64FieldValue(dcgm.DCGM_FT_INT64_BLANK)
+	blank.FieldId = uint(dcgm.DCGM_FI_DEV_GPU_UTIL)
+	blank.Ts = 1_100_000
+	values := aggregator.aggregate(gpu, PARENT_ID_IGNORED, []dcgm.FieldValue_v1{blank})
+	assert.Equal(t, SkipDCGMValue, ToString(values[0]))
+}
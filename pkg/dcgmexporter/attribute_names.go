@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+)
+
+// oldAttributeNames are the names of the pod attributes with the old namespace.
+var oldAttributeNames = map[string]string{
+	podAttribute:       oldPodAttribute,
+	namespaceAttribute: oldNamespaceAttribute,
+	containerAttribute: oldContainerAttribute,
+}
+
+// podAttributeNames names the attributes set by the pod mapper, after the old namespace and the renames of the
+// config. The other transforms, sinks and scopes find the pod of a metric through them.
+type podAttributeNames struct {
+	useOldNamespace bool
+	// renames maps the names of the attributes to their configured name, and originals the other way around
+	renames   map[string]string
+	originals map[string]string
+}
+
+// newPodAttributeNames parses the name=new_name renames of the Kubernetes attributes. The names are those the
+// attributes are exported with by default, e.g. pod_name with the old namespace.
+func newPodAttributeNames(c *Config) (podAttributeNames, error) {
+	names := podAttributeNames{
+		useOldNamespace: c.UseOldNamespace,
+		renames:         map[string]string{},
+		originals:       map[string]string{},
+	}
+
+	renames, err := parseKeyValues(c.KubernetesAttributeNames)
+	if err != nil {
+		return names, fmt.Errorf("invalid Kubernetes attribute names; err: %w", err)
+	}
+
+	for name, rename := range renames {
+		if !labelNameRegex.MatchString(rename) {
+			return names, fmt.Errorf("invalid Kubernetes attribute name '%s'", rename)
+		}
+		if original, exists := names.originals[rename]; exists {
+			return names, fmt.Errorf("Kubernetes attributes '%s' and '%s' are both renamed to '%s'", original, name,
+				rename)
+		}
+
+		names.renames[name] = rename
+		names.originals[rename] = name
+	}
+
+	return names, nil
+}
+
+// name returns the name the attribute is exported with.
+func (n podAttributeNames) name(attribute string) string {
+	if old, exists := oldAttributeNames[attribute]; exists && n.useOldNamespace {
+		attribute = old
+	}
+	if rename, exists := n.renames[attribute]; exists {
+		return rename
+	}
+	return attribute
+}
+
+// original returns the name of an exported attribute before the old namespace and the renames, e.g. pod for
+// pod_name.
+func (n podAttributeNames) original(name string) string {
+	if original, exists := n.originals[name]; exists {
+		name = original
+	}
+	for attribute, old := range oldAttributeNames {
+		if name == old {
+			return attribute
+		}
+	}
+	return name
+}
+
+// namespaceLabels returns the labels the namespace of the pods may be exported with. Both namespaces are kept
+// unless the namespace is renamed, so that the metrics of the collectors with the other namespace are matched too.
+func (n podAttributeNames) namespaceLabels() []string {
+	if name := n.name(namespaceAttribute); name != namespaceAttribute && name != oldNamespaceAttribute {
+		return []string{name}
+	}
+	return []string{namespaceAttribute, oldNamespaceAttribute}
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPodAttributeNames(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          Config
+		wantNames       map[string]string
+		wantNamespaces  []string
+		wantErrContains string
+	}{
+		{
+			name:   "default",
+			config: Config{},
+			wantNames: map[string]string{
+				podAttribute:       "pod",
+				namespaceAttribute: "namespace",
+				containerAttribute: "container",
+				ownerKindAttribute: "owner_kind",
+			},
+			wantNamespaces: []string{"namespace", "pod_namespace"},
+		},
+		{
+			name:   "old namespace",
+			config: Config{UseOldNamespace: true},
+			wantNames: map[string]string{
+				podAttribute:       "pod_name",
+				namespaceAttribute: "pod_namespace",
+				containerAttribute: "container_name",
+			},
+			wantNamespaces: []string{"namespace", "pod_namespace"},
+		},
+		{
+			name: "renames",
+			config: Config{KubernetesAttributeNames: []string{
+				"pod=k8s_pod_name", "namespace=k8s_namespace_name", "owner_kind=k8s_owner_kind",
+			}},
+			wantNames: map[string]string{
+				podAttribute:       "k8s_pod_name",
+				namespaceAttribute: "k8s_namespace_name",
+				containerAttribute: "container",
+				ownerKindAttribute: "k8s_owner_kind",
+			},
+			wantNamespaces: []string{"k8s_namespace_name"},
+		},
+		{
+			name:   "renames of the old namespace",
+			config: Config{UseOldNamespace: true, KubernetesAttributeNames: []string{"pod_name=k8s_pod_name"}},
+			wantNames: map[string]string{
+				podAttribute:       "k8s_pod_name",
+				namespaceAttribute: "pod_namespace",
+			},
+			wantNamespaces: []string{"namespace", "pod_namespace"},
+		},
+		{
+			name:            "invalid name",
+			config:          Config{KubernetesAttributeNames: []string{"pod=k8s.pod.name"}},
+			wantErrContains: "invalid Kubernetes attribute name 'k8s.pod.name'",
+		},
+		{
+			name:            "not a pair",
+			config:          Config{KubernetesAttributeNames: []string{"pod"}},
+			wantErrContains: "'pod' is not a key=value pair",
+		},
+		{
+			name:            "duplicate name",
+			config:          Config{KubernetesAttributeNames: []string{"pod=workload", "owner_name=workload"}},
+			wantErrContains: "are both renamed to 'workload'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names, err := newPodAttributeNames(&tt.config)
+			if tt.wantErrContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErrContains)
+				return
+			}
+			require.NoError(t, err)
+
+			for attribute, want := range tt.wantNames {
+				assert.Equal(t, want, names.name(attribute))
+				assert.Equal(t, attribute, names.original(want))
+			}
+			assert.Equal(t, tt.wantNamespaces, names.namespaceLabels())
+		})
+	}
+}
+
+func TestPodAttributeNames_Consumers(t *testing.T) {
+	names, err := newPodAttributeNames(&Config{
+		KubernetesAttributeNames: []string{"pod=k8s_pod_name", "namespace=k8s_namespace_name"},
+	})
+	require.NoError(t, err)
+
+	p := &PodMapper{Config: &Config{}, attributeNames: names}
+	attributes := map[string]string{}
+	p.setPodAttributes(attributes, PodInfo{
+		Name:          "trainer",
+		Namespace:     "default",
+		Container:     "main",
+		MPSAttributes: map[string]string{mpsAttribute: "true"},
+	})
+	assert.Equal(t, map[string]string{
+		"k8s_pod_name":       "trainer",
+		"k8s_namespace_name": "default",
+		containerAttribute:   "main",
+		mpsAttribute:         "true",
+	}, attributes)
+
+	counter := Counter{FieldID: 203, FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"}
+	metrics := MetricsByCounter{
+		counter: {
+			{GPU: "0", UUID: "GPU-0", Value: "20", Attributes: attributes},
+			{GPU: "1", UUID: "GPU-1", Value: "60", Attributes: attributes},
+		},
+	}
+
+	aggregated := aggregatePodMetrics(metrics, names)
+	for counter, podMetrics := range aggregated {
+		require.Len(t, podMetrics, 1, counter.FieldName)
+		assert.Equal(t, map[string]string{"k8s_pod_name": "trainer", "k8s_namespace_name": "default"},
+			podMetrics[0].Attributes)
+	}
+
+	pod, namespace := metricPod(metrics[counter][0], names)
+	assert.Equal(t, "trainer", pod)
+	assert.Equal(t, "default", namespace)
+
+	scope := namespacesScope(map[string]bool{"default": true}, names.namespaceLabels())
+	assert.True(t, scope("DCGM_FI_DEV_GPU_UTIL", `{gpu="0",k8s_namespace_name="default"}`))
+	assert.False(t, scope("DCGM_FI_DEV_GPU_UTIL", `{gpu="0",namespace="default"}`))
+}
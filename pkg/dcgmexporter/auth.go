@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"sigs.k8s.io/yaml"
+)
+
+// scopedPaths are the endpoints scoping their responses to the namespaces of the bound users, which are denied the
+// other endpoints, e.g. the debug, reload, diagnostics and job endpoints.
+var scopedPaths = map[string]bool{"/": true, "/metrics": true, "/v1/mapping": true}
+
+// authHandler requires the requests to present either the credentials of one of the basic auth users or the bearer
+// token. The health and readiness endpoints are left open for the probes.
+type authHandler struct {
+	handler http.Handler
+
+	// users maps the users to their bcrypt hashed passwords, as in the basic_auth_users of the web config format
+	users map[string]string
+	// namespaces maps the users to the namespaces the metrics they scrape are scoped to
+	namespaces map[string][]string
+	token      string
+}
+
+// newAuthHandler wraps the handler with the authentication configured by the basic auth users and the bearer token
+// files. The handler is returned unchanged when none is configured.
+func newAuthHandler(c *Config, handler http.Handler) (http.Handler, error) {
+	if c.WebBasicAuthUsersFile == "" && c.WebBearerTokenFile == "" {
+		return handler, nil
+	}
+
+	h := &authHandler{handler: handler}
+
+	if c.WebBasicAuthUsersFile != "" {
+		data, err := readAuthFile(c.WebBasicAuthUsersFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the basic auth users file; err: %w", err)
+		}
+
+		var config struct {
+			BasicAuthUsers      map[string]string   `json:"basic_auth_users"`
+			BasicAuthNamespaces map[string][]string `json:"basic_auth_namespaces"`
+		}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse the basic auth users file; err: %w", err)
+		}
+		if len(config.BasicAuthUsers) == 0 {
+			return nil, fmt.Errorf("no basic_auth_users in the file '%s'", c.WebBasicAuthUsersFile)
+		}
+
+		for user, hash := range config.BasicAuthUsers {
+			if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+				return nil, fmt.Errorf("invalid bcrypt hash of the user '%s'; err: %w", user, err)
+			}
+		}
+		for user, namespaces := range config.BasicAuthNamespaces {
+			if _, exists := config.BasicAuthUsers[user]; !exists {
+				return nil, fmt.Errorf("the namespaces of the unknown user '%s'", user)
+			}
+			if len(namespaces) == 0 {
+				return nil, fmt.Errorf("no namespaces of the user '%s'", user)
+			}
+		}
+		h.users = config.BasicAuthUsers
+		h.namespaces = config.BasicAuthNamespaces
+	}
+
+	if c.WebBearerTokenFile != "" {
+		data, err := readAuthFile(c.WebBearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the bearer token file; err: %w", err)
+		}
+
+		h.token = strings.TrimSpace(string(data))
+		if h.token == "" {
+			return nil, fmt.Errorf("the bearer token file '%s' is empty", c.WebBearerTokenFile)
+		}
+	}
+
+	logrus.Infof("Authentication of the HTTP server enabled, basic auth users: %d, scoped to namespaces: %d, "+
+		"bearer token: %t", len(h.users), len(h.namespaces), h.token != "")
+
+	return h, nil
+}
+
+func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/health" || r.URL.Path == "/ready" {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	if user, ok := h.authenticate(r); ok {
+		// The users bound to namespaces only get the metrics of the pods of those namespaces
+		if namespaces, scoped := h.namespaces[user]; scoped {
+			if !scopedPaths[r.URL.Path] {
+				http.Error(w, "the endpoint is not scoped to the namespaces of the user", http.StatusForbidden)
+				return
+			}
+			r = r.WithContext(withScrapeNamespaces(r.Context(), namespaces))
+		}
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	challenges := []string{}
+	if h.users != nil {
+		challenges = append(challenges, `Basic realm="dcgm-exporter"`)
+	}
+	if h.token != "" {
+		challenges = append(challenges, "Bearer")
+	}
+	w.Header().Set("WWW-Authenticate", strings.Join(challenges, ", "))
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// authenticate returns the basic auth user of the request, empty for the bearer token, and whether it is
+// authenticated.
+func (h *authHandler) authenticate(r *http.Request) (string, bool) {
+	if h.token != "" {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if found && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(h.token)) == 1 {
+			return "", true
+		}
+	}
+
+	if h.users != nil {
+		user, password, ok := r.BasicAuth()
+		if !ok {
+			return "", false
+		}
+
+		hash, exists := h.users[user]
+		if !exists {
+			return "", false
+		}
+
+		return user, bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+
+	return "", false
+}
+
+func readAuthFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	sysOS "os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthHandler(t *testing.T) {
+	dir := t.TempDir()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	usersFile := filepath.Join(dir, "web-config.yaml")
+	require.NoError(t, sysOS.WriteFile(usersFile, []byte("basic_auth_users:\n  prometheus: "+string(hash)+"\n"), 0o600))
+
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, sysOS.WriteFile(tokenFile, []byte("s3cr3t-t0k3n\n"), 0o600))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		config     *Config
+		path       string
+		setAuth    func(r *http.Request)
+		wantStatus int
+	}{
+		{
+			name:       "no authentication",
+			config:     &Config{},
+			path:       "/metrics",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "missing credentials",
+			config:     &Config{WebBasicAuthUsersFile: usersFile, WebBearerTokenFile: tokenFile},
+			path:       "/metrics",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "health without credentials",
+			config:     &Config{WebBasicAuthUsersFile: usersFile, WebBearerTokenFile: tokenFile},
+			path:       "/health",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "ready without credentials",
+			config:     &Config{WebBasicAuthUsersFile: usersFile, WebBearerTokenFile: tokenFile},
+			path:       "/ready",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   "basic auth",
+			config: &Config{WebBasicAuthUsersFile: usersFile, WebBearerTokenFile: tokenFile},
+			path:   "/metrics",
+			setAuth: func(r *http.Request) {
+				r.SetBasicAuth("prometheus", "secret")
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   "wrong password",
+			config: &Config{WebBasicAuthUsersFile: usersFile},
+			path:   "/metrics",
+			setAuth: func(r *http.Request) {
+				r.SetBasicAuth("prometheus", "wrong")
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "bearer token",
+			config: &Config{WebBasicAuthUsersFile: usersFile, WebBearerTokenFile: tokenFile},
+			path:   "/metrics",
+			setAuth: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer s3cr3t-t0k3n")
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   "wrong bearer token",
+			config: &Config{WebBearerTokenFile: tokenFile},
+			path:   "/metrics",
+			setAuth: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer wrong")
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := newAuthHandler(tt.config, next)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.setAuth != nil {
+				tt.setAuth(req)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+			if tt.wantStatus == http.StatusUnauthorized {
+				assert.NotEmpty(t, recorder.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAuthHandler_Namespaces(t *testing.T) {
+	dir := t.TempDir()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	usersFile := filepath.Join(dir, "web-config.yaml")
+	require.NoError(t, sysOS.WriteFile(usersFile, []byte("basic_auth_users:\n  prometheus: "+string(hash)+
+		"\n  team-a: "+string(hash)+"\nbasic_auth_namespaces:\n  team-a: [team-a]\n"), 0o600))
+
+	var bound []string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bound, _ = r.Context().Value(scrapeNamespacesKey{}).([]string)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler, err := newAuthHandler(&Config{WebBasicAuthUsersFile: usersFile}, next)
+	require.NoError(t, err)
+
+	for user, want := range map[string][]string{"prometheus": nil, "team-a": {"team-a"}} {
+		bound = nil
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.SetBasicAuth(user, "secret")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, want, bound, user)
+	}
+
+	// The bound users are denied the endpoints that aren't scoped to their namespaces
+	for _, path := range []string{"/debug/status", "/debug/pprof/heap", "/-/reload", "/diag/run", "/jobs/start",
+		"/jobs/stop", "/v1/gpus/GPU-0/reset"} {
+		for user, want := range map[string]int{"prometheus": http.StatusOK, "team-a": http.StatusForbidden} {
+			req := httptest.NewRequest(http.MethodPost, path, nil)
+			req.SetBasicAuth(user, "secret")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			assert.Equal(t, want, recorder.Code, "%s %s", user, path)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/mapping", nil)
+	req.SetBasicAuth("team-a", "secret")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestNewAuthHandler_InvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	invalidHashFile := filepath.Join(dir, "invalid-hash.yaml")
+	require.NoError(t, sysOS.WriteFile(invalidHashFile, []byte("basic_auth_users:\n  prometheus: secret\n"), 0o600))
+	unknownUserFile := filepath.Join(dir, "unknown-user.yaml")
+	require.NoError(t, sysOS.WriteFile(unknownUserFile, []byte("basic_auth_users:\n  prometheus: "+
+		"$2y$10$X0h1gDsPszWURQaxFh.zoubFi6DXncSjhoQNJgRrnGs7EsimhC7zG\nbasic_auth_namespaces:\n  team-a: [team-a]\n"),
+		0o600))
+	emptyTokenFile := filepath.Join(dir, "empty-token")
+	require.NoError(t, sysOS.WriteFile(emptyTokenFile, []byte("\n"), 0o600))
+
+	for _, c := range []*Config{
+		{WebBasicAuthUsersFile: filepath.Join(dir, "missing.yaml")},
+		{WebBasicAuthUsersFile: invalidHashFile},
+		{WebBasicAuthUsersFile: unknownUserFile},
+		{WebBearerTokenFile: emptyTokenFile},
+	} {
+		_, err := newAuthHandler(c, http.NotFoundHandler())
+		assert.Error(t, err)
+	}
+}
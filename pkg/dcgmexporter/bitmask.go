@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+// bitmaskPromType is the type of the counters of bitmask fields, exported as one gauge per bit
+const bitmaskPromType = "bitmask"
+
+type bitmaskDecoder struct {
+	label string
+	bits  map[int64]string
+}
+
+// bitmaskDecoders lists the fields that can be decoded with the bitmask type
+var bitmaskDecoders = map[dcgm.Short]bitmaskDecoder{
+	dcgm.DCGM_FI_DEV_CLOCK_THROTTLE_REASONS: {
+		label: "clock_event",
+		bits: func() map[int64]string {
+			bits := map[int64]string{}
+			for bit, name := range clockEventToString {
+				bits[int64(bit)] = name
+			}
+			return bits
+		}(),
+	},
+}
+
+func isBitmaskSupported(fieldID dcgm.Short) bool {
+	_, exists := bitmaskDecoders[fieldID]
+	return exists
+}
+
+// decodeBitmaskMetric decodes the value of a bitmask field into one gauge per bit, set to 1 when the bit is set
+// and 0 otherwise, and labeled with the name of the bit.
+func decodeBitmaskMetric(metric Metric, value int64) []Metric {
+	decoder := bitmaskDecoders[metric.Counter.FieldID]
+
+	counter := metric.Counter
+	counter.PromType = "gauge"
+
+	bits := make([]int64, 0, len(decoder.bits))
+	for bit := range decoder.bits {
+		bits = append(bits, bit)
+	}
+	slices.Sort(bits)
+
+	metrics := make([]Metric, 0, len(bits))
+
+	for _, bit := range bits {
+		m := metric
+		m.Counter = counter
+		m.Attributes = maps.Clone(metric.Attributes)
+		if m.Attributes == nil {
+			m.Attributes = map[string]string{}
+		}
+		m.Attributes[decoder.label] = decoder.bits[bit]
+
+		m.Value = "0"
+		if value&bit != 0 {
+			m.Value = "1"
+		}
+
+		metrics = append(metrics, m)
+	}
+
+	return metrics
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"runtime"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+const (
+	dcgmExpBuildInfo  = "DCGM_EXP_BUILD_INFO"
+	dcgmExpDriverInfo = "DCGM_EXP_DRIVER_INFO"
+)
+
+var nvmlGetDriverInfoHook = nvmlprovider.GetDriverInfo
+
+// SetBuildInfo exports the version of the exporter, of Go and of DCGM in DCGM_EXP_BUILD_INFO. The build version is
+// the version of DCGM and the version of the exporter, e.g. 3.3.5-3.4.1.
+func SetBuildInfo(buildVersion string) {
+	dcgmVersion, version, found := strings.Cut(buildVersion, "-")
+	if !found {
+		dcgmVersion, version = "", buildVersion
+	}
+
+	selfMetrics.SetInfo(dcgmExpBuildInfo,
+		"Version of the exporter, of Go and of DCGM the exporter is built with (always 1).",
+		map[string]string{"version": version, "goversion": runtime.Version(), "dcgm_version": dcgmVersion})
+}
+
+// UpdateDriverInfo exports the version of the driver, of NVML and of CUDA in DCGM_EXP_DRIVER_INFO, it is called when
+// DCGM is initialized, so that the versions change after the driver is upgraded.
+func UpdateDriverInfo() {
+	info, err := nvmlGetDriverInfoHook()
+	if err != nil {
+		logrus.WithError(err).Warn("Unable to get the version of the driver")
+		return
+	}
+
+	selfMetrics.SetInfo(dcgmExpDriverInfo,
+		"Version of the driver, of NVML and of CUDA supported by the driver (always 1).",
+		map[string]string{
+			"driver_version": info.DriverVersion,
+			"nvml_version":   info.NVMLVersion,
+			"cuda_version":   info.CUDAVersion,
+		})
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+func TestSetBuildInfo(t *testing.T) {
+	SetBuildInfo("3.3.6-3.4.2")
+
+	value, exists := selfMetrics.Value(dcgmExpBuildInfo,
+		map[string]string{"version": "3.4.2", "goversion": runtime.Version(), "dcgm_version": "3.3.6"})
+	assert.True(t, exists)
+	assert.Equal(t, float64(1), value)
+}
+
+func TestUpdateDriverInfo(t *testing.T) {
+	defer func() {
+		nvmlGetDriverInfoHook = nvmlprovider.GetDriverInfo
+	}()
+
+	info := &nvmlprovider.DriverInfo{DriverVersion: "550.54.15", NVMLVersion: "12.550.54.15", CUDAVersion: "12.4"}
+	nvmlGetDriverInfoHook = func() (*nvmlprovider.DriverInfo, error) {
+		return info, nil
+	}
+	labels := func(info *nvmlprovider.DriverInfo) map[string]string {
+		return map[string]string{
+			"driver_version": info.DriverVersion,
+			"nvml_version":   info.NVMLVersion,
+			"cuda_version":   info.CUDAVersion,
+		}
+	}
+
+	UpdateDriverInfo()
+	_, exists := selfMetrics.Value(dcgmExpDriverInfo, labels(info))
+	assert.True(t, exists)
+
+	// The versions of the upgraded driver replace the previous ones
+	previous := info
+	info = &nvmlprovider.DriverInfo{DriverVersion: "550.90.07", NVMLVersion: "12.550.90.07", CUDAVersion: "12.4"}
+	UpdateDriverInfo()
+	_, exists = selfMetrics.Value(dcgmExpDriverInfo, labels(previous))
+	assert.False(t, exists)
+	_, exists = selfMetrics.Value(dcgmExpDriverInfo, labels(info))
+	assert.True(t, exists)
+
+	// The versions are kept when NVML cannot tell them
+	nvmlGetDriverInfoHook = func() (*nvmlprovider.DriverInfo, error) {
+		return nil, errors.New("driver not loaded")
+	}
+	UpdateDriverInfo()
+	_, exists = selfMetrics.Value(dcgmExpDriverInfo, labels(info))
+	assert.True(t, exists)
+}
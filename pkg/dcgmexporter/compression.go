@@ -0,0 +1,251 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	encodingGzip     = "gzip"
+	encodingZstd     = "zstd"
+	encodingIdentity = "identity"
+)
+
+// compressor is a pooled encoder of a content encoding.
+type compressor interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+var compressorPools = map[string]*sync.Pool{
+	encodingGzip: {New: func() interface{} {
+		// The fast level, the exposition format compresses well and the scrapes must not wait for the CPU
+		w, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed)
+		return w
+	}},
+	encodingZstd: {New: func() interface{} {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1),
+			zstd.WithLowerEncoderMem(true))
+		return w
+	}},
+}
+
+// compressionHandler compresses the responses with the content encodings accepted by the client, e.g. the
+// multi-MB bodies of the metrics of the nodes with MIG and many counters. The encoders are pooled across the
+// requests. The health and readiness endpoints are not compressed.
+type compressionHandler struct {
+	handler http.Handler
+	// encodings are the encodings of the server, in order of preference
+	encodings []string
+}
+
+// newCompressionHandler wraps the handler with the compression of the responses. The handler is returned
+// unchanged when no encoding is set.
+func newCompressionHandler(c *Config, handler http.Handler) (http.Handler, error) {
+	var encodings []string
+	for _, encoding := range c.WebCompression {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding == "" || encoding == "none" {
+			continue
+		}
+		if _, exists := compressorPools[encoding]; !exists {
+			return nil, fmt.Errorf("invalid compression '%s'; expected %s or %s", encoding, encodingGzip,
+				encodingZstd)
+		}
+		encodings = append(encodings, encoding)
+	}
+
+	if len(encodings) == 0 {
+		return handler, nil
+	}
+
+	logrus.Infof("Compression of the HTTP responses enabled, encodings: %s", strings.Join(encodings, ", "))
+
+	return &compressionHandler{handler: handler, encodings: encodings}, nil
+}
+
+func (h *compressionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/health" || r.URL.Path == "/ready" {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), h.encodings)
+	if encoding == "" {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	cw := &compressedResponseWriter{ResponseWriter: w, encoding: encoding}
+	defer func() {
+		if err := cw.close(); err != nil {
+			logrus.WithError(err).Debug("Failed to compress the response.")
+		}
+	}()
+
+	h.handler.ServeHTTP(cw, r)
+}
+
+// negotiateEncoding returns the encoding of the server the client prefers according to its Accept-Encoding
+// header, ties broken by the order of the server, or an empty string when the response is not compressed.
+func negotiateEncoding(header string, encodings []string) string {
+	if header == "" {
+		return ""
+	}
+
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || strings.ToLower(strings.TrimSpace(key)) != "q" {
+				continue
+			}
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				q = 0
+			}
+			quality = q
+		}
+		qualities[name] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range encodings {
+		quality, exists := qualities[encoding]
+		if !exists {
+			quality, exists = qualities["*"]
+		}
+		if exists && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+
+	// The client may prefer the uncompressed response
+	if quality, exists := qualities[encodingIdentity]; exists && quality > bestQuality {
+		return ""
+	}
+
+	return best
+}
+
+// compressedResponseWriter compresses the body of the response, the encoder is taken from its pool on the first
+// write of a body.
+type compressedResponseWriter struct {
+	http.ResponseWriter
+	encoding    string
+	compressor  compressor
+	wroteHeader bool
+	// identity is set when the body is not compressed, e.g. for the responses without a body
+	identity bool
+}
+
+// Unwrap returns the wrapped response writer, e.g. for the deadlines of http.ResponseController.
+func (w *compressedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressedResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+
+	header := w.Header()
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified ||
+		header.Get("Content-Encoding") != "" {
+		w.identity = true
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressedResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			// The content type is sniffed from the uncompressed body
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.identity {
+		return w.ResponseWriter.Write(b)
+	}
+
+	if w.compressor == nil {
+		w.compressor = compressorPools[w.encoding].Get().(compressor)
+		w.compressor.Reset(w.ResponseWriter)
+	}
+	return w.compressor.Write(b)
+}
+
+// Flush sends the data compressed so far to the client.
+func (w *compressedResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.compressor.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// close completes the compressed body and puts the encoder back in its pool.
+func (w *compressedResponseWriter) close() error {
+	if !w.wroteHeader || w.identity {
+		return nil
+	}
+
+	if w.compressor == nil {
+		// An empty body is still a compressed stream
+		w.compressor = compressorPools[w.encoding].Get().(compressor)
+		w.compressor.Reset(w.ResponseWriter)
+	}
+
+	err := w.compressor.Close()
+	// The encoder must not hold the writer of the response once in the pool
+	w.compressor.Reset(io.Discard)
+	compressorPools[w.encoding].Put(w.compressor)
+	w.compressor = nil
+
+	return err
+}
@@ -0,0 +1,240 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	encodings := []string{encodingGzip, encodingZstd}
+
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{header: "", expected: ""},
+		{header: "gzip", expected: encodingGzip},
+		{header: "zstd", expected: encodingZstd},
+		{header: "br, deflate", expected: ""},
+		// Ties are broken by the order of the server
+		{header: "zstd, gzip", expected: encodingGzip},
+		{header: "gzip;q=0.5, zstd", expected: encodingZstd},
+		{header: "GZIP ; q=0.8, zstd;q=0.9", expected: encodingZstd},
+		{header: "gzip;q=0", expected: ""},
+		{header: "*", expected: encodingGzip},
+		{header: "*;q=0.1, zstd", expected: encodingZstd},
+		{header: "gzip;q=0.5, identity", expected: ""},
+		{header: "gzip;q=invalid", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.expected, negotiateEncoding(tt.header, encodings))
+		})
+	}
+}
+
+func TestCompressionHandler(t *testing.T) {
+	body := strings.Repeat(`DCGM_FI_DEV_GPU_TEMP{gpu="0",UUID="GPU-00000000-0000-0000-0000-000000000000"} 42`+"\n", 1000)
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+			_, _ = io.WriteString(w, body)
+		}
+	})
+
+	unchanged, err := newCompressionHandler(&Config{WebCompression: []string{"none"}}, metrics)
+	require.NoError(t, err)
+	_, isCompressionHandler := unchanged.(*compressionHandler)
+	assert.False(t, isCompressionHandler)
+
+	_, err = newCompressionHandler(&Config{WebCompression: []string{"br"}}, metrics)
+	assert.ErrorContains(t, err, "invalid compression 'br'")
+
+	handler, err := newCompressionHandler(&Config{WebCompression: []string{"gzip", "zstd"}}, metrics)
+	require.NoError(t, err)
+
+	serve := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("/metrics", "gzip")
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+	assert.Empty(t, rec.Header().Get("Content-Length"))
+	assert.Less(t, rec.Body.Len(), len(body)/10)
+	gzipReader, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	decompressed, err := io.ReadAll(gzipReader)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decompressed))
+
+	// The pooled encoders don't leak the data of the previous responses
+	for i := 0; i < 2; i++ {
+		rec = serve("/metrics", "zstd")
+		assert.Equal(t, "zstd", rec.Header().Get("Content-Encoding"))
+		zstdReader, err := zstd.NewReader(rec.Body)
+		require.NoError(t, err)
+		decompressed, err = io.ReadAll(zstdReader)
+		zstdReader.Close()
+		require.NoError(t, err)
+		assert.Equal(t, body, string(decompressed))
+	}
+
+	rec = serve("/metrics", "")
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, rec.Body.String())
+
+	rec = serve("/health", "gzip")
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, rec.Body.String())
+
+	rec = serve("/empty", "gzip")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Zero(t, rec.Body.Len())
+}
+
+// throttledListener bounds the bandwidth of the connections it accepts, as the network between the scraper and the
+// exporter does.
+type throttledListener struct {
+	net.Listener
+	bytesPerSecond float64
+}
+
+func (l throttledListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return throttledConn{Conn: conn, bytesPerSecond: l.bytesPerSecond}, nil
+}
+
+type throttledConn struct {
+	net.Conn
+	bytesPerSecond float64
+}
+
+func (c throttledConn) Write(b []byte) (int, error) {
+	time.Sleep(time.Duration(float64(len(b)) / c.bytesPerSecond * float64(time.Second)))
+	return c.Conn.Write(b)
+}
+
+// BenchmarkCompressionHandler measures the scrape of a multi-MB body, as served on a node with MIG, shared GPUs and
+// many counters, over a 1 Gbit/s link. The body is decompressed by the scraper.
+func BenchmarkCompressionHandler(b *testing.B) {
+	var body bytes.Buffer
+	for gpu := 0; gpu < 8; gpu++ {
+		for instance := 0; instance < 7; instance++ {
+			for replica := 0; replica < 4; replica++ {
+				for field := 0; field < 40; field++ {
+					fmt.Fprintf(&body, "DCGM_FI_PROF_FIELD_%d{gpu=\"%d\",UUID=\"GPU-%08d-1d2c-4a5b-8c7d-6e5f4a3b2c1d\","+
+						"pci_bus_id=\"00000000:%02X:00.0\",device=\"nvidia%d\",modelName=\"NVIDIA H100 80GB HBM3\","+
+						"GPU_I_PROFILE=\"1g.10gb\",GPU_I_ID=\"%d\",Hostname=\"gpu-node-17\",container=\"trainer\","+
+						"namespace=\"team-%d\",pod=\"trainer-%d-%d-7f9c6d5b8-x2k4q\"} %d\n",
+						field, gpu, gpu, gpu+0x10, gpu, instance, gpu, instance, replica, 1000+field*gpu)
+				}
+			}
+		}
+	}
+
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body.Bytes())
+	})
+	handler, err := newCompressionHandler(&Config{WebCompression: []string{"gzip", "zstd"}}, metrics)
+	require.NoError(b, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(b, err)
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = throttledListener{Listener: listener, bytesPerSecond: 125e6}
+	server.Start()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	for _, encoding := range []string{encodingIdentity, encodingGzip, encodingZstd} {
+		b.Run(encoding, func(b *testing.B) {
+			var transferred int64
+			for i := 0; i < b.N; i++ {
+				req, err := http.NewRequest(http.MethodGet, server.URL+"/metrics", nil)
+				require.NoError(b, err)
+				req.Header.Set("Accept-Encoding", encoding)
+
+				resp, err := client.Do(req)
+				require.NoError(b, err)
+
+				counted := &countingReader{reader: resp.Body}
+				var reader io.Reader = counted
+				closeReader := func() {}
+				switch resp.Header.Get("Content-Encoding") {
+				case encodingGzip:
+					reader, err = gzip.NewReader(counted)
+					require.NoError(b, err)
+				case encodingZstd:
+					decoder, err := zstd.NewReader(counted)
+					require.NoError(b, err)
+					reader, closeReader = decoder, decoder.Close
+				}
+
+				n, err := io.Copy(io.Discard, reader)
+				require.NoError(b, err)
+				require.Equal(b, int64(body.Len()), n)
+				closeReader()
+				resp.Body.Close()
+
+				transferred += counted.n
+			}
+			b.ReportMetric(float64(transferred)/float64(b.N), "wire-bytes/op")
+			b.SetBytes(int64(body.Len()))
+		})
+	}
+}
+
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
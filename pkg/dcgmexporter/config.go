@@ -16,7 +16,11 @@
 
 package dcgmexporter
 
-import "github.com/NVIDIA/go-dcgm/pkg/dcgm"
+import (
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
 
 type KubernetesGPUIDType string
 
@@ -25,10 +29,90 @@ const (
 	DeviceName KubernetesGPUIDType = "device-name"
 )
 
+type KubernetesPodFilterMode string
+
+const (
+	// PodFilterModeAttribute exports the metrics of GPUs used by filtered out pods without pod attributes.
+	PodFilterModeAttribute KubernetesPodFilterMode = "attribute"
+	// PodFilterModeDrop doesn't export the metrics of GPUs used by filtered out pods.
+	PodFilterModeDrop KubernetesPodFilterMode = "drop"
+)
+
+type UtilizationMode string
+
+const (
+	// UtilizationModeLegacy exports the utilization fields of the counters file.
+	UtilizationModeLegacy UtilizationMode = "legacy"
+	// UtilizationModeProfiling replaces the legacy utilization fields by the profiling ones when they are supported.
+	UtilizationModeProfiling UtilizationMode = "profiling"
+	// UtilizationModeBoth adds the profiling utilization fields to the legacy ones when they are supported.
+	UtilizationModeBoth UtilizationMode = "both"
+)
+
+type ProfilingMultiplexing string
+
+const (
+	// ProfilingMultiplexingWarn logs the profiling fields that DCGM multiplexes.
+	ProfilingMultiplexingWarn ProfilingMultiplexing = "warn"
+	// ProfilingMultiplexingDrop drops the profiling fields that DCGM would multiplex.
+	ProfilingMultiplexingDrop ProfilingMultiplexing = "drop"
+)
+
+type MIGStrategy string
+
+const (
+	// MIGStrategyNone advertises the GPUs whatever their MIG mode, the MIG instances are attributed to the pods of
+	// their GPU.
+	MIGStrategyNone MIGStrategy = "none"
+	// MIGStrategySingle advertises the MIG instances of the GPUs as nvidia.com/gpu.
+	MIGStrategySingle MIGStrategy = "single"
+	// MIGStrategyMixed advertises the MIG instances as nvidia.com/mig-<profile> resources.
+	MIGStrategyMixed MIGStrategy = "mixed"
+)
+
+type MetricNames string
+
+const (
+	// MetricNamesLegacy exports the fields with the names and the units of the counters file.
+	MetricNamesLegacy MetricNames = "legacy"
+	// MetricNamesPrometheus exports the fields in base units, named after the Prometheus naming conventions.
+	MetricNamesPrometheus MetricNames = "prometheus"
+)
+
+type SampleTimestamps string
+
+const (
+	// SampleTimestampsNone exports the values without the time DCGM sampled them.
+	SampleTimestampsNone SampleTimestamps = "none"
+	// SampleTimestampsExemplar attaches the time DCGM sampled the values to the exemplars of the GPU metrics.
+	SampleTimestampsExemplar SampleTimestamps = "exemplar"
+	// SampleTimestampsMetric exports the time DCGM sampled the values in a sibling <metric>_timestamp_seconds gauge.
+	SampleTimestampsMetric SampleTimestamps = "metric"
+)
+
+type ShardBy string
+
+const (
+	// ShardByGPU partitions the GPUs, and their MIG instances, across the exporters.
+	ShardByGPU ShardBy = "gpu"
+	// ShardByField partitions the fields of the counters across the exporters.
+	ShardByField ShardBy = "field"
+)
+
+type KubernetesConfigKind string
+
+const (
+	// KubernetesConfigKindCRD reads the configuration from the spec of a DCGMExporterConfig custom resource.
+	KubernetesConfigKindCRD KubernetesConfigKind = "DCGMExporterConfig"
+	// KubernetesConfigKindConfigMap reads the configuration from the config.yaml key of a ConfigMap.
+	KubernetesConfigKindConfigMap KubernetesConfigKind = "ConfigMap"
+)
+
 type DeviceOptions struct {
-	Flex       bool  // If true, then monitor all GPUs if MIG mode is disabled or all GPU instances if MIG is enabled.
-	MajorRange []int // The indices of each GPU/NvSwitch to monitor, or -1 to monitor all
-	MinorRange []int // The indices of each GPUInstance/NvLink to monitor, or -1 to monitor all
+	Flex       bool     // If true, then monitor all GPUs if MIG mode is disabled or all GPU instances if MIG is enabled.
+	MajorRange []int    // The indices of each GPU/NvSwitch to monitor, or -1 to monitor all
+	MinorRange []int    // The indices of each GPUInstance/NvLink to monitor, or -1 to monitor all
+	UUIDs      []string // The UUIDs of each GPU or GPU instance (MIG-) to monitor, added to the ranges once resolved
 }
 
 type Config struct {
@@ -58,4 +142,203 @@ type Config struct {
 	DCGMLogLevel               string
 	PodResourcesKubeletSocket  string
 	HPCJobMappingDir           string
+	KubernetesPodLabels        []string
+	KubernetesPodAnnotations   []string
+	KubernetesPodOwner         bool
+	KubernetesGPUAllocation    bool
+	DevicePluginConfig         string
+	KubernetesDeviceIDParsers  []string
+	KubernetesNamespaces       []string
+	KubernetesPodLabelSelector string
+	KubernetesPodFilterMode    KubernetesPodFilterMode
+	KubernetesPodAggregation   bool
+	KubernetesVirtualGPUs      bool
+	KubernetesExemplars        bool
+	OpenMetrics                bool
+	RemoteWriteURL             string
+	RemoteWriteBearerTokenFile string
+	RemoteWriteUsername        string
+	RemoteWritePasswordFile    string
+	RemoteWriteTLSCAFile       string
+	RemoteWriteTLSCertFile     string
+	RemoteWriteTLSKeyFile      string
+	RemoteWriteMaxRetries      uint
+	OTLPEndpoint               string
+	OTLPProtocol               OTLPProtocol
+	OTLPInsecure               bool
+	OTLPHeaders                []string
+	OTLPClusterName            string
+	OTLPResourceAttributes     []string
+	StatsDAddress              string
+	StatsDPrefix               string
+	StatsDTags                 []string
+	KafkaBrokers               []string
+	KafkaTopic                 string
+	KafkaFormat                KafkaFormat
+	KafkaTLS                   bool
+	KafkaTLSCAFile             string
+	KafkaTLSCertFile           string
+	KafkaTLSKeyFile            string
+	KafkaSASLUsername          string
+	KafkaSASLPasswordFile      string
+	RelabelConfig              string
+	LabelAllowlist             []string
+	JobStats                   bool
+	SlurmJobMapping            bool
+	SlurmJobLabels             []string
+	JobMapDir                  string
+	ContainerMapping           bool
+	DockerSocket               string
+	ContainerdStateDir         string
+	WebTLSCertFile             string
+	WebTLSKeyFile              string
+	WebTLSClientCAFile         string
+	WebBasicAuthUsersFile      string
+	WebBearerTokenFile         string
+	EnableDebugEndpoints       bool
+	WebListenUnixSocket        string
+	WebListenUnixSocketMode    string
+	WatchCollectors            bool
+	WebEnableReload            bool
+	Simulate                   string
+	Record                     string
+	Replay                     string
+	LogSampleInterval          int
+	// FieldCollectIntervals holds the collect interval of the counters that set one, it is filled from the counters
+	FieldCollectIntervals map[dcgm.Short]time.Duration
+	// FieldAggregations holds the aggregation of the counters that set one, it is filled from the counters
+	FieldAggregations map[dcgm.Short]string
+	MonotonicCounters bool
+	DerivedMetrics    string
+	UtilizationMode   UtilizationMode
+	// MIGRefreshInterval is the interval in ms at which the MIG instances are checked for changes, 0 disables it
+	MIGRefreshInterval int
+	// DCGMCheckInterval is the interval in ms at which the connection to DCGM and the GPUs are checked, 0 disables it
+	DCGMCheckInterval int
+	RemoteHostengines []string
+	CollectWorkers    int
+	// ScrapeCacheMaxAge is the age in ms under which the exporter metrics of a scrape are served again, 0 disables it
+	ScrapeCacheMaxAge int
+	// BackgroundCollection gathers the exporter metrics in the collections instead of the scrapes
+	BackgroundCollection bool
+	GPUTopologyLabels    bool
+	// EnergyCounters exports the energy consumption in J as a counter increasing across driver reloads
+	EnergyCounters     bool
+	EnergyAveragePower bool
+	Diag               bool
+	// DiagInterval is the interval in ms at which the diagnostic runs on the idle GPUs, 0 runs it only on request
+	DiagInterval int
+	DiagLevel    int
+	// KubernetesEvents creates Kubernetes events on the node and the pods on XID errors, double bit ECC errors and
+	// health watch failures
+	KubernetesEvents bool
+	// WebhookURLs receive a JSON payload on XID errors, double bit ECC errors, thermal violations and health watch
+	// changes
+	WebhookURLs       []string
+	WebhookSecretFile string
+	WebhookMaxRetries uint
+	// ReadinessGating reports the exporter as not ready, and fails the scrapes, until a collection completed and the
+	// pod mapper attributed its metrics
+	ReadinessGating bool
+	// NVMLFallback collects a subset of the metrics with NVML when DCGM can't be initialized, UseNVML is set then
+	NVMLFallback bool
+	UseNVML      bool
+	// Tegrastats is the path of the tegrastats binary the metrics of the integrated GPU of Jetson modules are
+	// collected from, instead of DCGM
+	Tegrastats string
+	// CounterGroups holds the names of the counters of every group the scrapes can select, it is filled from the
+	// counters
+	CounterGroups map[string][]string
+	// NoResourceDetection only attributes the nvidia.com resources known to the exporter, instead of every
+	// nvidia.com resource whose device IDs are the IDs of GPUs
+	NoResourceDetection bool
+	// KubernetesSharingMetrics exports the number of replicas of the shared GPUs and the memory quota of the
+	// containers using them
+	KubernetesSharingMetrics bool
+	// KubernetesMappingAPI serves the attribution of the devices to the pods on /v1/mapping
+	KubernetesMappingAPI bool
+	// TransformPlugins and TransformHooks are the Go plugins and the executables of the external transforms
+	TransformPlugins []string
+	TransformHooks   []string
+	// FieldHistograms holds the upper bounds of the buckets of the histogram counters, it is filled from the counters
+	FieldHistograms map[dcgm.Short][]float64
+	// WebMaxRequestsInFlight bounds the requests served concurrently, and WebClientRateLimit and WebClientRateBurst
+	// the requests per second of every client; they are unbounded when 0
+	WebMaxRequestsInFlight int
+	WebClientRateLimit     float64
+	WebClientRateBurst     int
+	// Hostname overrides the Hostname label, instead of the NODE_NAME environment variable or the hostname
+	Hostname string
+	// ExternalLabels are the name=value labels added to every metric
+	ExternalLabels []string
+	// HostengineDetection attaches to a running nv-hostengine when no remote hostengine is set
+	HostengineDetection bool
+	// DCGMUpdateFreq is how often DCGM samples the fields of every field group, in milliseconds, when shorter than
+	// the collect interval of the group, and DCGMMaxKeepAge, in seconds, and DCGMMaxKeepSamples bound the samples DCGM
+	// keeps; 0 samples at the collect interval and leaves the samples unbounded by the age or the count respectively,
+	// a single sample is kept when both are 0
+	DCGMUpdateFreq     int
+	DCGMMaxKeepAge     float64
+	DCGMMaxKeepSamples int
+	// ProfilingMultiplexing chooses whether the profiling fields that cannot be sampled together are multiplexed by DCGM
+	// or dropped
+	ProfilingMultiplexing ProfilingMultiplexing
+	// HealthScoreRules is the path to the YAML file of the rules scoring the health of every GPU
+	HealthScoreRules string
+	// StateFile persists the cumulative counters across restarts, and the counters not updated for StateRetention
+	// hours are dropped from it
+	StateFile      string
+	StateRetention int
+	// MetricNames chooses whether the fields keep their legacy names or are converted to base units, with the unit
+	// suffixes of the Prometheus naming conventions
+	MetricNames MetricNames
+	// ExternalLabelsDir is a directory, e.g. a downward API volume, whose files are added as labels to every metric
+	ExternalLabelsDir string
+	// MIGStrategy is the MIG strategy of the device plugin, it is read from the device plugin config when it is empty
+	MIGStrategy MIGStrategy
+	// KubeletCallTimeout bounds the calls to the kubelet pod-resources API in ms, 0 uses the connection timeout
+	KubeletCallTimeout int
+	// KubeletKeepalive is the interval in ms of the keepalive pings of the calls to the kubelet, 0 disables them
+	KubeletKeepalive int
+	// KubernetesAttributeNames are the name=new_name renames of the attributes describing the pods
+	KubernetesAttributeNames []string
+	// CollectorsOverlays are the counters files overriding the counters of CollectorsFile, in order
+	CollectorsOverlays []string
+	// CounterProfile is the built-in counter profile the counters files override, none when it is empty
+	CounterProfile string
+	// GPUProfilingFields holds the profiling fields supported by every GPU, the profiling fields are only watched on
+	// the GPUs supporting them when it is set
+	GPUProfilingFields map[uint][]uint
+	// SampleTimestamps chooses how the time DCGM sampled the values is exported, it is not exported when empty
+	SampleTimestamps SampleTimestamps
+	// SampleAge exports the age of the values read from DCGM in DCGM_EXP_SAMPLE_AGE_SECONDS
+	SampleAge bool
+	// MIGRollup adds a series per GPU rolling up the metrics of its MIG instances, labeled aggregated="true"
+	MIGRollup bool
+	// ShardIndex is the shard, from 1 to ShardCount, collected by the exporter among ShardCount exporters, the
+	// exporter collects everything when ShardCount is 0
+	ShardIndex int
+	ShardCount int
+	// ShardBy chooses whether the GPUs or the fields are partitioned across the shards
+	ShardBy ShardBy
+	// WebCompression are the content encodings, gzip or zstd, compressing the responses in order of preference, the
+	// responses are not compressed when it is empty
+	WebCompression []string
+	// FabricLeaderElection publishes the metrics of the switches and the links only from the exporter holding the
+	// FabricLease, <NAMESPACE>:<NAME>, the Lease named after the node in the namespace of the exporter when empty
+	FabricLeaderElection bool
+	FabricLease          string
+	// KubernetesConfig is the <NAMESPACE>:<NAME> object, of the KubernetesConfigKind, whose spec overrides the
+	// counters, the label policies and the sinks, and is watched to reload the exporter when it changes
+	KubernetesConfig     string
+	KubernetesConfigKind KubernetesConfigKind
+	// CountersData holds the counters in the CSV format of the collectors file, replacing the collectors file
+	CountersData string
+	// AdminAPI serves the endpoints resetting and draining the GPUs, authenticated by the admin token of
+	// AdminAPITokenFile on top of the authentication of the server
+	AdminAPI          bool
+	AdminAPITokenFile string
+	// KubernetesPodAllocation exports how long the devices have been allocated to the containers, keyed by the UID
+	// of their pod. The start of the allocations is kept across the reloads, and in the state file when there is one
+	KubernetesPodAllocation bool
 }
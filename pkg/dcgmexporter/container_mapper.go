@@ -0,0 +1,307 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+const (
+	containerNameAttribute  = "container_name"
+	containerImageAttribute = "image"
+)
+
+// containerRequestTimeout bounds the time spent inspecting a container.
+var containerRequestTimeout = 5 * time.Second
+
+var (
+	nvmlGetRunningProcessIDsHook = nvmlprovider.GetRunningProcessIDs
+
+	// The ID of the container is the last 64 hexadecimal characters of the cgroup path of its processes, e.g.
+	// /docker/<id>, /system.slice/docker-<id>.scope or /default/<id> with nerdctl
+	containerIDRegex = regexp.MustCompile(`[0-9a-f]{64}`)
+)
+
+type containerInfo struct {
+	Name  string
+	Image string
+}
+
+// containerMapper adds the name and the image of the containers running processes on the GPUs to the attributes
+// of the GPU metrics, for the containers of Docker or containerd that are not managed by Kubernetes.
+type containerMapper struct {
+	Config *Config
+
+	// kubelet is set when the Kubernetes mapping is enabled, the pods are attributed by the PodMapper when the
+	// kubelet socket exists
+	kubelet *kubeletClient
+
+	procRoot           string
+	containerdStateDir string
+	docker             *http.Client
+
+	// containers caches the containers by ID, the containers that are no longer seen are removed
+	containers map[string]containerInfo
+}
+
+func newContainerMapper(c *Config) *containerMapper {
+	logrus.Infof("Container metrics collection enabled!")
+
+	mapper := &containerMapper{
+		Config:             c,
+		procRoot:           "/proc",
+		containerdStateDir: c.ContainerdStateDir,
+		containers:         map[string]containerInfo{},
+	}
+
+	if c.Kubernetes {
+		mapper.kubelet = newKubeletClient(c)
+	}
+
+	if c.DockerSocket != "" {
+		mapper.docker = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", c.DockerSocket)
+				},
+			},
+			Timeout: containerRequestTimeout,
+		}
+	}
+
+	return mapper
+}
+
+func (p *containerMapper) Name() string {
+	return "containerMapper"
+}
+
+func (p *containerMapper) Process(metrics MetricsByCounter, _ SystemInfo) error {
+	if p.kubelet != nil {
+		if _, err := p.kubelet.discoverSocket(); err == nil {
+			logrus.Debug("Kubelet socket found, skipping container attribution")
+			return nil
+		}
+	}
+
+	gpuUUIDs := map[string]bool{}
+	for _, counterMetrics := range metrics {
+		for _, metric := range counterMetrics {
+			gpuUUIDs[metric.GPUUUID] = true
+		}
+	}
+
+	seen := map[string]bool{}
+	gpuToContainers := map[string][]containerInfo{}
+
+	for uuid := range gpuUUIDs {
+		pids, err := nvmlGetRunningProcessIDsHook(uuid)
+		if err != nil {
+			logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(), "Unable to get the processes of GPU %s", uuid)
+			continue
+		}
+
+		gpuContainers := map[string]bool{}
+		for _, pid := range pids {
+			id, err := p.getContainerID(pid)
+			if err != nil || id == "" || gpuContainers[id] {
+				continue
+			}
+			gpuContainers[id] = true
+			seen[id] = true
+
+			container, err := p.getContainer(id)
+			if err != nil {
+				logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(), "Unable to inspect the container %s", id)
+				continue
+			}
+			gpuToContainers[uuid] = append(gpuToContainers[uuid], container)
+		}
+	}
+
+	for id := range p.containers {
+		if !seen[id] {
+			delete(p.containers, id)
+		}
+	}
+
+	mapping := fmt.Sprintf("%+v", gpuToContainers)
+	logSampled(logrus.WithField("mapping", mapping), logrus.DebugLevel, mapping, "GPU to container mapping")
+
+	for counter := range metrics {
+		var modifiedMetrics []Metric
+		for _, metric := range metrics[counter] {
+			containers, exists := gpuToContainers[metric.GPUUUID]
+			if !exists {
+				modifiedMetrics = append(modifiedMetrics, metric)
+				continue
+			}
+
+			for _, container := range containers {
+				modifiedMetric := metric.withAttributes()
+				modifiedMetric.Attributes[containerNameAttribute] = container.Name
+				if container.Image != "" {
+					modifiedMetric.Attributes[containerImageAttribute] = container.Image
+				}
+				modifiedMetrics = append(modifiedMetrics, modifiedMetric)
+			}
+		}
+		metrics[counter] = modifiedMetrics
+	}
+
+	return nil
+}
+
+// getContainerID returns the ID of the container of the process, it is empty when the process doesn't run in a
+// container.
+func (p *containerMapper) getContainerID(pid uint32) (string, error) {
+	file, err := os.Open(path.Join(p.procRoot, fmt.Sprint(pid), "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	id := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if matches := containerIDRegex.FindAllString(scanner.Text(), -1); len(matches) > 0 {
+			id = matches[len(matches)-1]
+		}
+	}
+
+	return id, scanner.Err()
+}
+
+func (p *containerMapper) getContainer(id string) (containerInfo, error) {
+	if container, exists := p.containers[id]; exists {
+		return container, nil
+	}
+
+	container, err := p.inspectDockerContainer(id)
+	if err != nil {
+		container, err = p.inspectContainerdContainer(id)
+	}
+	if err != nil {
+		return containerInfo{}, err
+	}
+
+	if container.Name == "" {
+		container.Name = id[:12]
+	}
+	p.containers[id] = container
+
+	return container, nil
+}
+
+func (p *containerMapper) inspectDockerContainer(id string) (containerInfo, error) {
+	if p.docker == nil {
+		return containerInfo{}, fmt.Errorf("docker is disabled")
+	}
+
+	resp, err := p.docker.Get("http://docker/containers/" + id + "/json")
+	if err != nil {
+		return containerInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return containerInfo{}, fmt.Errorf("unexpected status '%s' inspecting the container", resp.Status)
+	}
+
+	var inspect struct {
+		Name   string
+		Config struct {
+			Image string
+		}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return containerInfo{}, err
+	}
+	if err := json.Unmarshal(body, &inspect); err != nil {
+		return containerInfo{}, err
+	}
+
+	return containerInfo{
+		Name:  strings.TrimPrefix(inspect.Name, "/"),
+		Image: inspect.Config.Image,
+	}, nil
+}
+
+// inspectContainerdContainer reads the annotations of the OCI spec of the container in the bundle of its task.
+func (p *containerMapper) inspectContainerdContainer(id string) (containerInfo, error) {
+	if p.containerdStateDir == "" {
+		return containerInfo{}, fmt.Errorf("containerd is disabled")
+	}
+
+	// The bundles are stored by namespace, e.g. /run/containerd/io.containerd.runtime.v2.task/default/<id>
+	bundles, err := filepath.Glob(filepath.Join(p.containerdStateDir, "*", id, "config.json"))
+	if err != nil {
+		return containerInfo{}, err
+	}
+	if len(bundles) == 0 {
+		return containerInfo{}, fmt.Errorf("container not found in '%s'", p.containerdStateDir)
+	}
+
+	file, err := os.Open(bundles[0])
+	if err != nil {
+		return containerInfo{}, err
+	}
+	defer file.Close()
+
+	body, err := io.ReadAll(file)
+	if err != nil {
+		return containerInfo{}, err
+	}
+
+	var spec struct {
+		Annotations map[string]string `json:"annotations"`
+	}
+	if err := json.Unmarshal(body, &spec); err != nil {
+		return containerInfo{}, err
+	}
+
+	var container containerInfo
+	for _, key := range []string{"nerdctl/name", "io.kubernetes.cri.container-name"} {
+		if name := spec.Annotations[key]; name != "" && container.Name == "" {
+			container.Name = name
+		}
+	}
+	for _, key := range []string{"nerdctl/image", "io.kubernetes.cri.image-name"} {
+		if image := spec.Annotations[key]; image != "" && container.Image == "" {
+			container.Image = image
+		}
+	}
+
+	return container, nil
+}
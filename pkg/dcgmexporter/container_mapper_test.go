@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"net"
+	"net/http"
+	sysOS "os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+func TestContainerMapper_Process(t *testing.T) {
+	dockerID := strings.Repeat("a", 64)
+	containerdID := strings.Repeat("b", 64)
+
+	dir := t.TempDir()
+	procRoot := filepath.Join(dir, "proc")
+	for pid, cgroup := range map[string]string{
+		"100": "0::/system.slice/docker-" + dockerID + ".scope\n",
+		"101": "0::/system.slice/docker-" + dockerID + ".scope\n",
+		"200": "0::/default/" + containerdID + "\n",
+		"300": "0::/user.slice/user-1000.slice/session-1.scope\n",
+	} {
+		require.NoError(t, sysOS.MkdirAll(filepath.Join(procRoot, pid), 0o755))
+		require.NoError(t, sysOS.WriteFile(filepath.Join(procRoot, pid, "cgroup"), []byte(cgroup), 0o644))
+	}
+
+	stateDir := filepath.Join(dir, "containerd")
+	require.NoError(t, sysOS.MkdirAll(filepath.Join(stateDir, "default", containerdID), 0o755))
+	require.NoError(t, sysOS.WriteFile(filepath.Join(stateDir, "default", containerdID, "config.json"),
+		[]byte(`{"annotations":{"nerdctl/name":"trainer"}}`), 0o644))
+
+	dockerSocket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", dockerSocket)
+	require.NoError(t, err)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/"+dockerID+"/json" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"Name":"/notebook","Config":{"Image":"nvcr.io/nvidia/pytorch:24.01-py3"}}`))
+	})}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	defer func() {
+		nvmlGetRunningProcessIDsHook = nvmlprovider.GetRunningProcessIDs
+	}()
+	nvmlGetRunningProcessIDsHook = func(uuid string) ([]uint32, error) {
+		return map[string][]uint32{
+			"GPU-0": {100, 101, 200},
+			"GPU-1": {300},
+		}[uuid], nil
+	}
+
+	mapper := newContainerMapper(&Config{DockerSocket: dockerSocket, ContainerdStateDir: stateDir})
+	mapper.procRoot = procRoot
+
+	counter := Counter{FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"}
+	metrics := MetricsByCounter{counter: {
+		{Counter: counter, GPU: "0", GPUUUID: "GPU-0", Attributes: map[string]string{}},
+		{Counter: counter, GPU: "1", GPUUUID: "GPU-1", Attributes: map[string]string{}},
+	}}
+
+	require.NoError(t, mapper.Process(metrics, SystemInfo{}))
+	require.Len(t, metrics[counter], 3)
+
+	var attributes []map[string]string
+	for _, metric := range metrics[counter] {
+		attributes = append(attributes, metric.Attributes)
+	}
+	assert.ElementsMatch(t, []map[string]string{
+		{containerNameAttribute: "notebook", containerImageAttribute: "nvcr.io/nvidia/pytorch:24.01-py3"},
+		{containerNameAttribute: "trainer"},
+		{},
+	}, attributes)
+	assert.Len(t, mapper.containers, 2)
+}
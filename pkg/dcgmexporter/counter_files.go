@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// counterIncludeDirective starts the lines of a counters file including another counters file, e.g.
+// include: base.csv. The relative paths are relative to the directory of the including file.
+const counterIncludeDirective = "include:"
+
+// maxCounterIncludeDepth bounds the nesting of the includes.
+const maxCounterIncludeDepth = 16
+
+// CounterOverride is a counter redefined by a later counters file, or by the lines following an include.
+type CounterOverride struct {
+	Field        string
+	File         string
+	Line         int
+	PreviousFile string
+	PreviousLine int
+	// Conflict is set when the definitions differ, the later one is kept
+	Conflict bool
+}
+
+func (o CounterOverride) String() string {
+	if !o.Conflict {
+		return fmt.Sprintf("%s:%d: %s: redefines the same counter as %s:%d", o.File, o.Line, o.Field,
+			o.PreviousFile, o.PreviousLine)
+	}
+
+	return fmt.Sprintf("%s:%d: %s: overrides the counter defined at %s:%d", o.File, o.Line, o.Field,
+		o.PreviousFile, o.PreviousLine)
+}
+
+// counterRecord is a line of a counters file with its location.
+type counterRecord struct {
+	record []string
+	file   string
+	line   int
+}
+
+// counterMerger merges the counters of several files, a counter keeps the position of its first definition and the
+// columns of its last one.
+type counterMerger struct {
+	records   []counterRecord
+	indexes   map[string]int
+	overrides []CounterOverride
+	// including holds the files being read, to detect the cycles of includes
+	including []string
+}
+
+// ReadCounterFiles reads the counters of the files, the counters of a file overriding those of the previous files.
+// The include directives of the files are expanded in place. The overrides are returned to be reported.
+func ReadCounterFiles(files []string) ([][]string, []CounterOverride, error) {
+	m := &counterMerger{indexes: map[string]int{}}
+
+	for _, file := range files {
+		if err := m.addFile(file); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return m.merged(), m.overrides, nil
+}
+
+// mergeCounterRecords overrides the records, e.g. of a ConfigMap, with the counters of the files.
+func mergeCounterRecords(records [][]string, source string, files []string) ([][]string, []CounterOverride, error) {
+	m := &counterMerger{indexes: map[string]int{}}
+
+	for i, record := range records {
+		if isCounterInclude(record) {
+			return nil, nil, fmt.Errorf("%s:%d: includes are only supported in files", source, i+1)
+		}
+		m.add(counterRecord{record: record, file: source, line: i + 1})
+	}
+
+	for _, file := range files {
+		if err := m.addFile(file); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return m.merged(), m.overrides, nil
+}
+
+func (m *counterMerger) addFile(file string) error {
+	if slices.Contains(m.including, file) {
+		return fmt.Errorf("the counters file '%s' includes itself", file)
+	}
+	if len(m.including) >= maxCounterIncludeDepth {
+		return fmt.Errorf("the includes of the counters file '%s' are nested more than %d times", file,
+			maxCounterIncludeDepth)
+	}
+
+	m.including = append(m.including, file)
+	defer func() { m.including = m.including[:len(m.including)-1] }()
+
+	records, err := readCounterRecords(file)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if !isCounterInclude(record.record) {
+			m.add(record)
+			continue
+		}
+
+		include := includedCounterFile(record.record, file)
+		if include == "" {
+			return fmt.Errorf("%s:%d: the include has no file", file, record.line)
+		}
+		if err := m.addFile(include); err != nil {
+			return fmt.Errorf("%s:%d: %w", file, record.line, err)
+		}
+	}
+
+	return nil
+}
+
+func (m *counterMerger) add(record counterRecord) {
+	if len(record.record) == 0 {
+		return
+	}
+
+	name := strings.TrimSpace(record.record[0])
+	index, exists := m.indexes[name]
+	if !exists {
+		m.indexes[name] = len(m.records)
+		m.records = append(m.records, record)
+		return
+	}
+
+	previous := m.records[index]
+	m.overrides = append(m.overrides, CounterOverride{
+		Field:        name,
+		File:         record.file,
+		Line:         record.line,
+		PreviousFile: previous.file,
+		PreviousLine: previous.line,
+		Conflict:     !slices.Equal(trimmedRecord(previous.record), trimmedRecord(record.record)),
+	})
+	m.records[index] = record
+}
+
+func (m *counterMerger) merged() [][]string {
+	records := make([][]string, 0, len(m.records))
+	for _, record := range m.records {
+		records = append(records, record.record)
+	}
+	return records
+}
+
+// readCounterRecords reads the lines of a counters file with their line numbers.
+func readCounterRecords(file string) ([]counterRecord, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+
+	var records []counterRecord
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid counters file '%s'; err: %w", file, err)
+		}
+
+		line, _ := r.FieldPos(0)
+		records = append(records, counterRecord{record: record, file: file, line: line})
+	}
+}
+
+// isCounterInclude returns whether the record of a counters file is an include directive.
+func isCounterInclude(record []string) bool {
+	return len(record) == 1 && strings.HasPrefix(strings.TrimSpace(record[0]), counterIncludeDirective)
+}
+
+// includedCounterFile returns the path of the file included by the directive of the file.
+func includedCounterFile(record []string, file string) string {
+	include := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(record[0]), counterIncludeDirective))
+	if include == "" || filepath.IsAbs(include) {
+		return include
+	}
+	return filepath.Join(filepath.Dir(file), include)
+}
+
+func trimmedRecord(record []string) []string {
+	trimmed := make([]string, len(record))
+	for i, column := range record {
+		trimmed[i] = strings.TrimSpace(column)
+	}
+	return trimmed
+}
+
+// CounterFiles returns the counters files and the files they include, e.g. to watch or validate them. The files that
+// cannot be read are kept, without their includes.
+func CounterFiles(files []string) []string {
+	var set []string
+
+	var walk func(file string)
+	walk = func(file string) {
+		if slices.Contains(set, file) {
+			return
+		}
+		set = append(set, file)
+
+		records, err := readCounterRecords(file)
+		if err != nil {
+			return
+		}
+		for _, record := range records {
+			if include := includedCounterFile(record.record, file); isCounterInclude(record.record) && include != "" {
+				walk(include)
+			}
+		}
+	}
+
+	for _, file := range files {
+		walk(file)
+	}
+
+	return set
+}
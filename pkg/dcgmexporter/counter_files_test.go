@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	sysOS "os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCounterFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, sysOS.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	writeFile("base.csv", `# Base counters
+DCGM_FI_DEV_SM_CLOCK, gauge, SM clock frequency (in MHz).
+DCGM_FI_DEV_GPU_TEMP, gauge, GPU temperature (in C).
+DCGM_FI_DEV_GPU_UTIL, gauge, GPU utilization (in %).
+`)
+	node := writeFile("node.csv", `include: base.csv
+DCGM_FI_DEV_GPU_TEMP, gauge, GPU temperature (in C).
+DCGM_FI_DEV_GPU_UTIL, gauge, GPU utilization (in %)., 30s
+`)
+	h100 := writeFile("h100.csv", `DCGM_FI_PROF_GR_ENGINE_ACTIVE, gauge, Ratio of time the graphics engine is active.
+DCGM_FI_DEV_SM_CLOCK, gauge, SM clock frequency (in MHz)., 5s
+`)
+
+	records, overrides, err := ReadCounterFiles([]string{node, h100})
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{
+		{"DCGM_FI_DEV_SM_CLOCK", " gauge", " SM clock frequency (in MHz).", " 5s"},
+		{"DCGM_FI_DEV_GPU_TEMP", " gauge", " GPU temperature (in C)."},
+		{"DCGM_FI_DEV_GPU_UTIL", " gauge", " GPU utilization (in %).", " 30s"},
+		{"DCGM_FI_PROF_GR_ENGINE_ACTIVE", " gauge", " Ratio of time the graphics engine is active."},
+	}, records)
+
+	base := filepath.Join(dir, "base.csv")
+	assert.Equal(t, []CounterOverride{
+		{Field: "DCGM_FI_DEV_GPU_TEMP", File: node, Line: 2, PreviousFile: base, PreviousLine: 3},
+		{Field: "DCGM_FI_DEV_GPU_UTIL", File: node, Line: 3, PreviousFile: base, PreviousLine: 4, Conflict: true},
+		{Field: "DCGM_FI_DEV_SM_CLOCK", File: h100, Line: 2, PreviousFile: base, PreviousLine: 2, Conflict: true},
+	}, overrides)
+	assert.Equal(t, h100+":2: DCGM_FI_DEV_SM_CLOCK: overrides the counter defined at "+base+":2",
+		overrides[2].String())
+
+	assert.Equal(t, []string{node, base, h100}, CounterFiles([]string{node, h100}))
+
+	// The counters of the merged files are extracted like those of a single file
+	counters, err := extractCounters(records, &Config{})
+	require.NoError(t, err)
+	require.Len(t, counters.DCGMCounters, 3)
+	assert.Equal(t, "DCGM_FI_DEV_SM_CLOCK", counters.DCGMCounters[0].FieldName)
+}
+
+func TestReadCounterFiles_Errors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, sysOS.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	a := writeFile("a.csv", "include: b.csv\n")
+	writeFile("b.csv", "include: a.csv\n")
+	_, _, err := ReadCounterFiles([]string{a})
+	assert.ErrorContains(t, err, "includes itself")
+
+	empty := writeFile("empty.csv", "include:\n")
+	_, _, err = ReadCounterFiles([]string{empty})
+	assert.ErrorContains(t, err, "the include has no file")
+
+	missing := writeFile("missing.csv", "include: missing/base.csv\n")
+	_, _, err = ReadCounterFiles([]string{missing})
+	assert.ErrorContains(t, err, "missing/base.csv")
+
+	_, _, err = mergeCounterRecords([][]string{{"include: a.csv"}}, "configmap default/counters", []string{a})
+	assert.ErrorContains(t, err, "includes are only supported in files")
+}
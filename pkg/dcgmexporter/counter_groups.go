@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var counterGroupRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// parseCounterGroups parses the optional sixth column of a counter, the space separated names of the groups it
+// belongs to, e.g. utilization memory.
+func parseCounterGroups(value string) ([]string, error) {
+	groups := strings.Fields(value)
+	for _, group := range groups {
+		if !counterGroupRegex.MatchString(group) {
+			return nil, fmt.Errorf("invalid group name '%s'", group)
+		}
+	}
+
+	return groups, nil
+}
+
+func (cs *CounterSet) addToGroups(fieldName string, groups []string) {
+	if len(groups) == 0 {
+		return
+	}
+
+	if cs.Groups == nil {
+		cs.Groups = map[string][]string{}
+	}
+	for _, group := range groups {
+		cs.Groups[group] = append(cs.Groups[group], fieldName)
+	}
+}
+
+// groupsOf returns the groups the counter belongs to.
+func (cs *CounterSet) groupsOf(fieldName string) []string {
+	var groups []string
+	for group, names := range cs.Groups {
+		for _, name := range names {
+			if name == fieldName {
+				groups = append(groups, group)
+				break
+			}
+		}
+	}
+
+	return groups
+}
+
+// scrapeCounters returns the names of the counters of the groups the scrape asks for with the collectors query
+// parameter, e.g. ?collectors=utilization,memory, nil when it doesn't.
+func scrapeCounters(r *http.Request, groups map[string][]string) (map[string]bool, error) {
+	requested := r.URL.Query()["collectors"]
+	if len(requested) == 0 {
+		return nil, nil
+	}
+
+	counters := map[string]bool{}
+	for _, value := range requested {
+		for _, group := range strings.Split(value, ",") {
+			names, exists := groups[strings.TrimSpace(group)]
+			if !exists {
+				return nil, fmt.Errorf("unknown collectors group '%s'", group)
+			}
+			for _, name := range names {
+				counters[name] = true
+			}
+		}
+	}
+
+	return counters, nil
+}
+
+// countersScope keeps the samples of the counters. The samples of the OpenMetrics counters are named after their
+// family, with the _total and _created suffixes, and the samples of the histograms with the _bucket, _sum and _count
+// suffixes.
+func countersScope(counters map[string]bool) func(name, labels string) bool {
+	return func(name, _ string) bool {
+		for _, suffix := range []string{"", "_total", "_created", "_bucket", "_sum", "_count"} {
+			base, ok := strings.CutSuffix(name, suffix)
+			if ok && (counters[base] || counters[base+"_total"]) {
+				return true
+			}
+		}
+		return false
+	}
+}
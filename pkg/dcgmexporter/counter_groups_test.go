@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractCountersGroups(t *testing.T) {
+	cs, err := extractCounters([][]string{
+		{"DCGM_FI_DEV_GPU_UTIL", " gauge", " utilization", "", "", " utilization"},
+		{"DCGM_FI_DEV_FB_USED", " gauge", " used memory", " 1s", "", " memory utilization"},
+		{"DCGM_FI_DEV_GPU_TEMP", " gauge", " temperature"},
+		{"DCGM_EXP_XID_ERRORS_COUNT", " gauge", " xid errors", "", "", "errors"},
+	}, &Config{})
+	require.NoError(t, err)
+	assert.Len(t, cs.DCGMCounters, 3)
+	assert.Equal(t, map[string][]string{
+		"utilization": {"DCGM_FI_DEV_GPU_UTIL", "DCGM_FI_DEV_FB_USED"},
+		"memory":      {"DCGM_FI_DEV_FB_USED"},
+		"errors":      {"DCGM_EXP_XID_ERRORS_COUNT"},
+	}, cs.Groups)
+	assert.ElementsMatch(t, []string{"memory", "utilization"}, cs.groupsOf("DCGM_FI_DEV_FB_USED"))
+
+	_, err = extractCounters([][]string{
+		{"DCGM_FI_DEV_GPU_UTIL", "gauge", "utilization", "", "", "utilization,memory"},
+	}, &Config{})
+	assert.Error(t, err)
+}
+
+func TestScrapeCounters(t *testing.T) {
+	groups := map[string][]string{
+		"utilization": {"DCGM_FI_DEV_GPU_UTIL", "DCGM_FI_DEV_FB_USED"},
+		"memory":      {"DCGM_FI_DEV_FB_USED"},
+		"errors":      {"DCGM_FI_DEV_XID_ERRORS"},
+	}
+
+	counters, err := scrapeCounters(httptest.NewRequest(http.MethodGet, "/metrics", nil), groups)
+	require.NoError(t, err)
+	assert.Nil(t, counters)
+
+	counters, err = scrapeCounters(httptest.NewRequest(http.MethodGet, "/metrics?collectors=memory,errors", nil), groups)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"DCGM_FI_DEV_FB_USED": true, "DCGM_FI_DEV_XID_ERRORS": true}, counters)
+
+	_, err = scrapeCounters(httptest.NewRequest(http.MethodGet, "/metrics?collectors=power", nil), groups)
+	assert.Error(t, err)
+}
+
+func TestCountersScope(t *testing.T) {
+	keep := countersScope(map[string]bool{"DCGM_FI_DEV_FB_USED": true, "DCGM_FI_DEV_XID_ERRORS": true})
+
+	assert.True(t, keep("DCGM_FI_DEV_FB_USED", ""))
+	assert.True(t, keep("DCGM_FI_DEV_XID_ERRORS_total", ""))
+	assert.True(t, keep("DCGM_FI_DEV_XID_ERRORS_created", ""))
+	assert.False(t, keep("DCGM_FI_DEV_GPU_UTIL", ""))
+	assert.False(t, keep("DCGM_EXP_SCRAPE_DURATION_SECONDS", ""))
+}
+
+func TestMetricsServer_Collectors(t *testing.T) {
+	server, cleanup, err := NewMetricsServer(&Config{
+		BackgroundCollection: true,
+		CounterGroups:        map[string][]string{"memory": {"DCGM_FI_DEV_FB_USED"}},
+	}, nil, NewRegistry())
+	require.NoError(t, err)
+	defer cleanup()
+
+	server.updateMetrics(`# HELP DCGM_FI_DEV_GPU_UTIL GPU utilization (in %).
+# TYPE DCGM_FI_DEV_GPU_UTIL gauge
+DCGM_FI_DEV_GPU_UTIL{gpu="0",UUID="GPU-0"} 42
+# HELP DCGM_FI_DEV_FB_USED Framebuffer memory used (in MiB).
+# TYPE DCGM_FI_DEV_FB_USED gauge
+DCGM_FI_DEV_FB_USED{gpu="0",UUID="GPU-0"} 1024
+`)
+
+	rec := httptest.NewRecorder()
+	server.Metrics(rec, httptest.NewRequest(http.MethodGet, "/metrics?collectors=memory", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `# HELP DCGM_FI_DEV_FB_USED Framebuffer memory used (in MiB).
+# TYPE DCGM_FI_DEV_FB_USED gauge
+DCGM_FI_DEV_FB_USED{gpu="0",UUID="GPU-0"} 1024
+`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	server.Metrics(rec, httptest.NewRequest(http.MethodGet, "/metrics?collectors=power", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+// counterProfiles holds the built-in counter profiles, profiles/default.csv and profiles/dcp.csv are copies of the
+// counters files of etc.
+//
+//go:embed profiles/*.csv
+var counterProfiles embed.FS
+
+// CounterProfiles are the names of the built-in counter profiles, from the smallest to the largest.
+var CounterProfiles = []string{"minimal", "default", "dcp", "debug"}
+
+// readCounterProfile returns the counters of the built-in profile.
+func readCounterProfile(name string) ([][]string, error) {
+	if !slices.Contains(CounterProfiles, name) {
+		return nil, fmt.Errorf("unknown counter profile '%s', expected one of: %s", name,
+			strings.Join(CounterProfiles, ", "))
+	}
+
+	data, err := counterProfiles.ReadFile("profiles/" + name + ".csv")
+	if err != nil {
+		return nil, err
+	}
+
+	r := csv.NewReader(strings.NewReader(string(data)))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+
+	return r.ReadAll()
+}
+
+// unsupportedProfilingFields returns, by GPU, the profiling fields of the counters the GPU does not support. It is
+// nil when the supported fields of the GPUs are unknown, i.e. without a counter profile.
+func unsupportedProfilingFields(fields []dcgm.Short, sysInfo SystemInfo, c *Config) map[uint]map[dcgm.Short]bool {
+	if c.GPUProfilingFields == nil || sysInfo.InfoType != dcgm.FE_GPU {
+		return nil
+	}
+
+	unsupported := map[uint]map[dcgm.Short]bool{}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		gpu := sysInfo.GPUs[i].DeviceInfo.GPU
+		supported := c.GPUProfilingFields[gpu]
+
+		for _, field := range fields {
+			if field < dcpFieldsStart || field >= cpuFieldsStart || slices.Contains(supported, uint(field)) {
+				continue
+			}
+
+			if unsupported[gpu] == nil {
+				unsupported[gpu] = map[dcgm.Short]bool{}
+			}
+			unsupported[gpu][field] = true
+		}
+	}
+
+	return unsupported
+}
+
+// fieldWatchGroup is a set of fields watched on some GPUs of the system.
+type fieldWatchGroup struct {
+	fields  []dcgm.Short
+	sysInfo SystemInfo
+}
+
+// fieldWatchGroupsBySupport splits the watch of the fields so that the profiling fields are only watched on the GPUs
+// supporting them, DCGM failing to watch the fields of a profiling metric group on the other GPUs. The fields are
+// watched on all the GPUs when they all support them.
+func fieldWatchGroupsBySupport(
+	fields []dcgm.Short, sysInfo SystemInfo, unsupported map[uint]map[dcgm.Short]bool,
+) []fieldWatchGroup {
+	if len(unsupported) == 0 {
+		return []fieldWatchGroup{{fields: fields, sysInfo: sysInfo}}
+	}
+
+	// The fields are grouped by the GPUs supporting them
+	var all []dcgm.Short
+	byGPUs := map[string][]dcgm.Short{}
+	gpusByKey := map[string]map[uint]bool{}
+
+	for _, field := range fields {
+		gpus := map[uint]bool{}
+		var ids []uint
+		for i := uint(0); i < sysInfo.GPUCount; i++ {
+			if gpu := sysInfo.GPUs[i].DeviceInfo.GPU; !unsupported[gpu][field] {
+				gpus[gpu] = true
+				ids = append(ids, gpu)
+			}
+		}
+
+		switch {
+		case len(gpus) == int(sysInfo.GPUCount):
+			all = append(all, field)
+		case len(gpus) == 0:
+			logrus.Infof("Skipping the field %d, it is not supported by any GPU", field)
+		default:
+			key := fmt.Sprint(ids)
+			byGPUs[key] = append(byGPUs[key], field)
+			gpusByKey[key] = gpus
+		}
+	}
+
+	var groups []fieldWatchGroup
+	if len(all) > 0 {
+		groups = append(groups, fieldWatchGroup{fields: all, sysInfo: sysInfo})
+	}
+
+	keys := make([]string, 0, len(byGPUs))
+	for key := range byGPUs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		logrus.Infof("Watching the fields %v on the GPUs %s only", byGPUs[key], key)
+		groups = append(groups, fieldWatchGroup{fields: byGPUs[key], sysInfo: sysInfoWithGPUs(sysInfo, gpusByKey[key])})
+	}
+
+	return groups
+}
+
+// sysInfoWithGPUs returns the system info restricted to the GPUs, and to their GPU instances.
+func sysInfoWithGPUs(sysInfo SystemInfo, gpus map[uint]bool) SystemInfo {
+	restricted := sysInfo
+	restricted.GPUCount = 0
+	restricted.GPUs = [dcgm.MAX_NUM_DEVICES]GPUInfo{}
+
+	instances := map[int]bool{}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		if !gpus[sysInfo.GPUs[i].DeviceInfo.GPU] {
+			continue
+		}
+
+		restricted.GPUs[restricted.GPUCount] = sysInfo.GPUs[i]
+		restricted.GPUCount++
+		for _, instance := range sysInfo.GPUs[i].GPUInstances {
+			instances[int(instance.EntityId)] = true
+		}
+	}
+
+	// The ranges select the GPUs and the GPU instances by ID, -1 selecting all of them
+	if len(sysInfo.gOpt.MajorRange) > 0 && sysInfo.gOpt.MajorRange[0] != -1 {
+		restricted.gOpt.MajorRange = slices.DeleteFunc(slices.Clone(sysInfo.gOpt.MajorRange), func(id int) bool {
+			return id < 0 || !gpus[uint(id)]
+		})
+	}
+	if len(sysInfo.gOpt.MinorRange) > 0 && sysInfo.gOpt.MinorRange[0] != -1 {
+		restricted.gOpt.MinorRange = slices.DeleteFunc(slices.Clone(sysInfo.gOpt.MinorRange), func(id int) bool {
+			return !instances[id]
+		})
+	}
+
+	return restricted
+}
+
+// supportedEntityFields returns the fields of the entity without the profiling fields its GPU does not support.
+func supportedEntityFields(fields []dcgm.Short, mi MonitoringInfo, unsupported map[uint]map[dcgm.Short]bool) []dcgm.Short {
+	skipped := unsupported[mi.DeviceInfo.GPU]
+	if len(skipped) == 0 {
+		return fields
+	}
+
+	return slices.DeleteFunc(slices.Clone(fields), func(field dcgm.Short) bool {
+		return skipped[field]
+	})
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	sysOS "os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterProfiles(t *testing.T) {
+	// The default and dcp profiles are copies of the counters files shipped in etc
+	for profile, file := range map[string]string{"default": "default-counters.csv", "dcp": "dcp-metrics-included.csv"} {
+		want, err := sysOS.ReadFile(filepath.Join("..", "..", "etc", file))
+		require.NoError(t, err)
+		got, err := counterProfiles.ReadFile("profiles/" + profile + ".csv")
+		require.NoError(t, err)
+		assert.Equal(t, string(want), string(got), "profiles/%s.csv differs from etc/%s", profile, file)
+	}
+
+	config := &Config{CollectDCP: true, MetricGroups: ProfilingMetricGroups()}
+	sizes := map[string]int{}
+	for _, profile := range CounterProfiles {
+		t.Run(profile, func(t *testing.T) {
+			data, err := counterProfiles.ReadFile("profiles/" + profile + ".csv")
+			require.NoError(t, err)
+			file := filepath.Join(t.TempDir(), profile+".csv")
+			require.NoError(t, sysOS.WriteFile(file, data, 0o644))
+
+			issues, err := ValidateCountersFile(file, config, true)
+			require.NoError(t, err)
+			assert.Empty(t, issues)
+
+			counters, err := GetCounterSet(&Config{
+				ConfigMapData:  undefinedConfigMapData,
+				CounterProfile: profile,
+				CollectDCP:     true,
+				MetricGroups:   ProfilingMetricGroups(),
+			})
+			require.NoError(t, err)
+			sizes[profile] = len(counters.DCGMCounters) + len(counters.ExporterCounters)
+		})
+	}
+	assert.Less(t, sizes["minimal"], sizes["default"])
+	assert.Less(t, sizes["default"], sizes["dcp"])
+	assert.Less(t, sizes["dcp"], sizes["debug"])
+
+	_, err := GetCounterSet(&Config{ConfigMapData: undefinedConfigMapData, CounterProfile: "everything"})
+	assert.ErrorContains(t, err, "unknown counter profile 'everything'")
+}
+
+func TestCounterProfiles_Overlays(t *testing.T) {
+	overlay := filepath.Join(t.TempDir(), "overlay.csv")
+	require.NoError(t, sysOS.WriteFile(overlay, []byte(`DCGM_FI_DEV_GPU_UTIL, gauge, GPU utilization (in %)., 30s
+DCGM_FI_DEV_POWER_VIOLATION, counter, Throttling duration due to power constraints (in us).
+`), 0o644))
+
+	counters, err := GetCounterSet(&Config{
+		ConfigMapData:      undefinedConfigMapData,
+		CounterProfile:     "minimal",
+		CollectorsOverlays: []string{overlay},
+	})
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, counter := range counters.DCGMCounters {
+		names = append(names, counter.FieldName)
+	}
+	assert.Contains(t, names, "DCGM_FI_DEV_SM_CLOCK")
+	assert.Contains(t, names, "DCGM_FI_DEV_POWER_VIOLATION")
+	assert.Equal(t, 30*time.Second, counters.CollectIntervals[dcgm.DCGM_FI_DEV_GPU_UTIL])
+}
+
+func TestFieldWatchGroupsBySupport(t *testing.T) {
+	var sysInfo SystemInfo
+	sysInfo.InfoType = dcgm.FE_GPU
+	sysInfo.GPUCount = 3
+	for i := uint(0); i < 3; i++ {
+		sysInfo.GPUs[i].DeviceInfo.GPU = i
+	}
+	sysInfo.GPUs[1].GPUInstances = []GPUInstanceInfo{{EntityId: 7}}
+	sysInfo.gOpt.MajorRange = []int{0, 1, 2}
+	sysInfo.gOpt.MinorRange = []int{7}
+
+	smActive := dcgm.DCGM_FI["DCGM_FI_PROF_SM_ACTIVE"]
+	tensorActive := dcgm.DCGM_FI["DCGM_FI_PROF_PIPE_TENSOR_ACTIVE"]
+	fp64Active := dcgm.DCGM_FI["DCGM_FI_PROF_PIPE_FP64_ACTIVE"]
+	fields := []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_TEMP, smActive, tensorActive, fp64Active}
+
+	// Without the supported fields of the GPUs, all the fields are watched on all the GPUs
+	assert.Nil(t, unsupportedProfilingFields(fields, sysInfo, &Config{}))
+	groups := fieldWatchGroupsBySupport(fields, sysInfo, nil)
+	require.Len(t, groups, 1)
+	assert.Equal(t, fields, groups[0].fields)
+
+	// GPU 2 is an older architecture without the tensor pipes, no GPU has FP64 pipes
+	config := &Config{GPUProfilingFields: map[uint][]uint{
+		0: {uint(smActive), uint(tensorActive)},
+		1: {uint(smActive), uint(tensorActive)},
+		2: {uint(smActive)},
+	}}
+	unsupported := unsupportedProfilingFields(fields, sysInfo, config)
+	assert.Equal(t, map[uint]map[dcgm.Short]bool{
+		0: {fp64Active: true},
+		1: {fp64Active: true},
+		2: {tensorActive: true, fp64Active: true},
+	}, unsupported)
+
+	groups = fieldWatchGroupsBySupport(fields, sysInfo, unsupported)
+	require.Len(t, groups, 2)
+	assert.Equal(t, []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_TEMP, smActive}, groups[0].fields)
+	assert.Equal(t, uint(3), groups[0].sysInfo.GPUCount)
+	assert.Equal(t, []dcgm.Short{tensorActive}, groups[1].fields)
+	assert.Equal(t, uint(2), groups[1].sysInfo.GPUCount)
+	assert.Equal(t, []int{0, 1}, groups[1].sysInfo.gOpt.MajorRange)
+	assert.Equal(t, []int{7}, groups[1].sysInfo.gOpt.MinorRange)
+
+	entities := GetMonitoredEntities(groups[1].sysInfo)
+	require.Len(t, entities, 3)
+
+	// The values are only read for the fields supported by the GPU of the entity
+	gpu2 := *GetMonitoringInfoForGPU(sysInfo, 2)
+	assert.Equal(t, []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_TEMP, smActive}, supportedEntityFields(fields, gpu2, unsupported))
+	instance := *GetMonitoringInfoForGPUInstance(sysInfo, 7)
+	assert.Equal(t, []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_TEMP, smActive, tensorActive},
+		supportedEntityFields(fields, instance, unsupported))
+}
@@ -19,6 +19,8 @@ package dcgmexporter
 import (
 	"fmt"
 	"math/rand"
+	"sort"
+	"time"
 
 	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
 	"github.com/sirupsen/logrus"
@@ -81,7 +83,63 @@ func WatchFieldGroup(
 	return nil
 }
 
-func SetupDcgmFieldsWatch(deviceFields []dcgm.Short, sysInfo SystemInfo, collectIntervalUsec int64) ([]func(), error) {
+// FieldWatch holds the parameters of the watches of a field group.
+type FieldWatch struct {
+	UpdateFreqUsec int64
+	MaxKeepAge     float64
+	MaxKeepSamples int32
+}
+
+// newFieldWatch returns the parameters of the watches of the field group collected every interval, DCGM samples the
+// fields at the update frequency when it is shorter than the interval.
+func newFieldWatch(config *Config, interval time.Duration) FieldWatch {
+	watch := FieldWatch{
+		UpdateFreqUsec: interval.Microseconds(),
+		MaxKeepAge:     config.DCGMMaxKeepAge,
+		MaxKeepSamples: int32(config.DCGMMaxKeepSamples),
+	}
+
+	if updateFreq := time.Duration(config.DCGMUpdateFreq) * time.Millisecond; updateFreq > 0 && updateFreq < interval {
+		watch.UpdateFreqUsec = updateFreq.Microseconds()
+	}
+
+	// DCGM would keep the samples forever
+	if watch.MaxKeepAge == 0 && watch.MaxKeepSamples == 0 {
+		watch.MaxKeepSamples = 1
+	}
+
+	return watch
+}
+
+type fieldGroupInterval struct {
+	interval time.Duration
+	fields   []dcgm.Short
+}
+
+// fieldsByCollectInterval groups the fields by the interval at which DCGM updates them, the fields without their own
+// interval are updated every collect interval.
+func fieldsByCollectInterval(fields []dcgm.Short, config *Config) []fieldGroupInterval {
+	byInterval := map[time.Duration][]dcgm.Short{}
+	for _, field := range fields {
+		interval, exists := config.FieldCollectIntervals[field]
+		if !exists {
+			interval = time.Duration(config.CollectInterval) * time.Millisecond
+		}
+		byInterval[interval] = append(byInterval[interval], field)
+	}
+
+	groups := make([]fieldGroupInterval, 0, len(byInterval))
+	for interval, fields := range byInterval {
+		groups = append(groups, fieldGroupInterval{interval: interval, fields: fields})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].interval < groups[j].interval
+	})
+
+	return groups
+}
+
+func SetupDcgmFieldsWatch(deviceFields []dcgm.Short, sysInfo SystemInfo, watch FieldWatch) ([]func(), error) {
 	var err error
 	var cleanups []func()
 	var cleanup func()
@@ -114,7 +172,29 @@ func SetupDcgmFieldsWatch(deviceFields []dcgm.Short, sysInfo SystemInfo, collect
 
 		cleanups = append(cleanups, cleanup)
 
-		err = WatchFieldGroup(gr, fieldGroup, collectIntervalUsec, 0.0, 1)
+		err = WatchFieldGroup(gr, fieldGroup, watch.UpdateFreqUsec, watch.MaxKeepAge, watch.MaxKeepSamples)
+		if err != nil {
+			goto fail
+		}
+	}
+
+	// The memory health fields are watched on the GPUs of the MIG instances, which inherit their values
+	if fields := inheritedMemoryHealthFields(deviceFields); len(fields) > 0 && len(GetMIGParentGPUs(sysInfo)) > 0 {
+		var group dcgm.GroupHandle
+		group, cleanup, err = CreateMIGParentGroupFromSystemInfo(sysInfo)
+		cleanups = append(cleanups, cleanup)
+		if err != nil {
+			goto fail
+		}
+
+		fieldGroup, cleanup, err = NewFieldGroup(fields)
+		if err != nil {
+			goto fail
+		}
+
+		cleanups = append(cleanups, cleanup)
+
+		err = WatchFieldGroup(group, fieldGroup, watch.UpdateFreqUsec, watch.MaxKeepAge, watch.MaxKeepSamples)
 		if err != nil {
 			goto fail
 		}
@@ -0,0 +1,297 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	dcgmExpReconnectsTotal     = "DCGM_EXP_RECONNECTS_TOTAL"
+	dcgmExpHostengineMode      = "DCGM_EXP_HOSTENGINE_MODE"
+	dcgmExpHostengineHeartbeat = "DCGM_EXP_HOSTENGINE_HEARTBEAT_TIMESTAMP_SECONDS"
+)
+
+// HostengineMode is how the exporter connects to DCGM, either to a hostengine running apart from it or to a hostengine
+// embedded in it.
+type HostengineMode string
+
+const (
+	HostengineModeEmbedded   HostengineMode = "embedded"
+	HostengineModeStandalone HostengineMode = "standalone"
+)
+
+var (
+	hostengineModeMtx sync.Mutex
+	hostengineMode    HostengineMode
+)
+
+// SetHostengineMode exports how the exporter connects to DCGM in DCGM_EXP_HOSTENGINE_MODE.
+func SetHostengineMode(mode HostengineMode) {
+	hostengineModeMtx.Lock()
+	hostengineMode = mode
+	hostengineModeMtx.Unlock()
+
+	selfMetrics.SetInfo(dcgmExpHostengineMode,
+		"Mode of the hostengine the exporter is connected to, in the mode label (always 1).",
+		map[string]string{"mode": string(mode)})
+}
+
+// DefaultDCGMCheckInterval is the default interval at which the connection to DCGM and the GPUs are checked.
+const DefaultDCGMCheckInterval = 10 * time.Second
+
+var (
+	dcgmMinBackoff = time.Second
+	dcgmMaxBackoff = time.Minute
+
+	// DCGM is crash looping when it is reinitialized dcgmCrashLoopReinits times within dcgmCrashLoopWindow, the
+	// reinitializations are then delayed by the maximum backoff
+	dcgmCrashLoopReinits = 5
+	dcgmCrashLoopWindow  = 10 * time.Minute
+
+	// dcgmHeartbeatPeriods is the number of update periods of the heartbeat field, or of checks, without an update
+	// after which the embedded hostengine is hung
+	dcgmHeartbeatPeriods = 3
+
+	dcgmEntityGetLatestValues = dcgm.EntityGetLatestValues
+)
+
+// DCGMSupervisor requests the reinitialization of DCGM when the connection to the host engine is lost, or when the
+// GPUs change, e.g. after a driver reload or a GPU reset, as DCGM keeps the GPUs it was initialized with.
+type DCGMSupervisor struct {
+	config *Config
+	// C receives the reinitialization requests
+	C chan struct{}
+
+	mtx     sync.Mutex
+	lost    bool
+	backoff time.Duration
+	// reinits are the times of the reinitializations within the crash loop window
+	reinits []time.Time
+}
+
+func NewDCGMSupervisor(c *Config) *DCGMSupervisor {
+	return &DCGMSupervisor{
+		config: c,
+		C:      make(chan struct{}, 1),
+	}
+}
+
+// checkGPUs returns an error when DCGM cannot be queried or when the GPUs differ from the ones of the system info.
+func checkGPUs(sysInfo SystemInfo) error {
+	count, err := dcgmGetAllDeviceCount()
+	if err != nil {
+		return err
+	}
+
+	if count != sysInfo.GPUCount {
+		return fmt.Errorf("the number of GPUs changed from %d to %d", sysInfo.GPUCount, count)
+	}
+
+	for i := uint(0); i < count; i++ {
+		device, err := dcgmGetDeviceInfo(i)
+		if err != nil {
+			return fmt.Errorf("unable to get the info of GPU %d; err: %w", i, err)
+		}
+
+		if device.UUID != sysInfo.GPUs[i].DeviceInfo.UUID {
+			return fmt.Errorf("GPU %d changed from %s to %s", i, sysInfo.GPUs[i].DeviceInfo.UUID, device.UUID)
+		}
+	}
+
+	return nil
+}
+
+// heartbeat detects a hung embedded hostengine, which still answers the API but stops updating the fields, from the
+// timestamp of the latest value of a watched field.
+type heartbeat struct {
+	entity  dcgm.GroupEntityPair
+	field   dcgm.Short
+	timeout time.Duration
+
+	ts      int64
+	updated time.Time
+}
+
+// newHeartbeat returns the heartbeat of the first entity of the system info, on its first field updated every
+// collect interval, or nil when there is no such field.
+func newHeartbeat(item FieldEntityGroupTypeSystemInfoItem, c *Config) *heartbeat {
+	entities := GetMonitoredEntities(item.SystemInfo)
+	if len(entities) == 0 {
+		return nil
+	}
+
+	for _, field := range item.DeviceFields {
+		if _, exists := c.FieldCollectIntervals[field]; exists || field == dcgm.DCGM_FI_DRIVER_VERSION {
+			continue
+		}
+
+		period := max(time.Duration(c.CollectInterval)*time.Millisecond,
+			time.Duration(c.DCGMCheckInterval)*time.Millisecond)
+		return &heartbeat{
+			entity:  entities[0].Entity,
+			field:   field,
+			timeout: time.Duration(dcgmHeartbeatPeriods) * period,
+		}
+	}
+
+	return nil
+}
+
+// check returns an error when the field was not updated within the timeout. The fields the entity doesn't support
+// are never updated, they disable the heartbeat.
+func (h *heartbeat) check(now time.Time) error {
+	if h.timeout == 0 {
+		return nil
+	}
+
+	values, err := dcgmEntityGetLatestValues(h.entity.EntityGroupId, h.entity.EntityId, []dcgm.Short{h.field})
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 || values[0].Status != dcgm.DCGM_ST_OK || values[0].Ts == 0 {
+		logrus.Debugf("Field %d of entity %d has no value, the hostengine heartbeat is disabled", h.field,
+			h.entity.EntityId)
+		h.timeout = 0
+		return nil
+	}
+
+	if values[0].Ts != h.ts || h.updated.IsZero() {
+		h.ts, h.updated = values[0].Ts, now
+		selfMetrics.SetGauge(dcgmExpHostengineHeartbeat,
+			"Unix time of the latest update of the heartbeat field by the embedded hostengine.",
+			nil, float64(values[0].Ts)/1e6)
+		return nil
+	}
+
+	if now.Sub(h.updated) > h.timeout {
+		return fmt.Errorf("the hostengine did not update field %d of entity %d for %s", h.field, h.entity.EntityId,
+			now.Sub(h.updated).Round(time.Second))
+	}
+
+	return nil
+}
+
+// Watch checks DCGM and the GPUs of the system info, and the heartbeat of the embedded hostengine, and requests the
+// reinitialization when a check fails.
+func (s *DCGMSupervisor) Watch(item FieldEntityGroupTypeSystemInfoItem, stop chan interface{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	t := time.NewTicker(time.Duration(s.config.DCGMCheckInterval) * time.Millisecond)
+	defer t.Stop()
+
+	var hb *heartbeat
+	hostengineModeMtx.Lock()
+	if hostengineMode == HostengineModeEmbedded {
+		hb = newHeartbeat(item, s.config)
+	}
+	hostengineModeMtx.Unlock()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-t.C:
+			err := checkGPUs(item.SystemInfo)
+			if err == nil && hb != nil {
+				err = hb.check(now)
+			}
+			if err == nil {
+				continue
+			}
+
+			logrus.WithError(err).Error("DCGM is unavailable or the GPUs changed, reinitializing DCGM")
+
+			s.mtx.Lock()
+			s.lost = true
+			s.mtx.Unlock()
+
+			select {
+			case s.C <- struct{}{}:
+			default:
+				// A reinitialization is already pending
+			}
+			return
+		}
+	}
+}
+
+// Lost returns true when DCGM must be reinitialized.
+func (s *DCGMSupervisor) Lost() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.lost
+}
+
+// Backoff returns the delay before the next attempt to initialize DCGM, doubled after every failed attempt.
+func (s *DCGMSupervisor) Backoff() time.Duration {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.backoff == 0 {
+		s.backoff = dcgmMinBackoff
+	} else {
+		s.backoff = min(2*s.backoff, dcgmMaxBackoff)
+	}
+
+	return s.backoff
+}
+
+// CrashLoopDelay returns the delay before reinitializing DCGM, the maximum backoff when DCGM is crash looping, e.g.
+// when the hostengine hangs again after every reinitialization, and zero otherwise.
+func (s *DCGMSupervisor) CrashLoopDelay() time.Duration {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.pruneReinits(time.Now())
+	if len(s.reinits) < dcgmCrashLoopReinits {
+		return 0
+	}
+
+	logrus.Warnf("DCGM was reinitialized %d times in %s, delaying the reinitialization by %s", len(s.reinits),
+		dcgmCrashLoopWindow, dcgmMaxBackoff)
+	return dcgmMaxBackoff
+}
+
+func (s *DCGMSupervisor) pruneReinits(now time.Time) {
+	reinits := s.reinits[:0]
+	for _, reinit := range s.reinits {
+		if now.Sub(reinit) < dcgmCrashLoopWindow {
+			reinits = append(reinits, reinit)
+		}
+	}
+	s.reinits = reinits
+}
+
+// Reconnected resets the backoff after DCGM is initialized again, and counts the reconnection.
+func (s *DCGMSupervisor) Reconnected() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.lost = false
+	s.backoff = 0
+	s.reinits = append(s.reinits, time.Now())
+
+	selfMetrics.AddCounter(dcgmExpReconnectsTotal,
+		"Number of times DCGM was reinitialized after losing the connection or the GPUs.", nil, 1)
+}
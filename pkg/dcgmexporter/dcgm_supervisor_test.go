@@ -0,0 +1,242 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckGPUs(t *testing.T) {
+	var sysInfo SystemInfo
+	sysInfo.GPUCount = 2
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i, UUID: fmt.Sprintf("GPU-%d", i)}
+	}
+
+	defer func() {
+		dcgmGetAllDeviceCount = dcgm.GetAllDeviceCount
+		dcgmGetDeviceInfo = dcgm.GetDeviceInfo
+	}()
+
+	tests := []struct {
+		name    string
+		count   uint
+		err     error
+		uuids   []string
+		wantErr string
+	}{
+		{
+			name:  "unchanged GPUs",
+			count: 2,
+			uuids: []string{"GPU-0", "GPU-1"},
+		},
+		{
+			name:    "connection lost",
+			err:     errors.New("host engine is not valid any longer"),
+			wantErr: "host engine is not valid any longer",
+		},
+		{
+			name:    "GPU removed",
+			count:   1,
+			uuids:   []string{"GPU-0"},
+			wantErr: "the number of GPUs changed from 2 to 1",
+		},
+		{
+			name:    "GPU replaced",
+			count:   2,
+			uuids:   []string{"GPU-0", "GPU-2"},
+			wantErr: "GPU 1 changed from GPU-1 to GPU-2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dcgmGetAllDeviceCount = func() (uint, error) {
+				return tt.count, tt.err
+			}
+			dcgmGetDeviceInfo = func(gpuId uint) (dcgm.Device, error) {
+				return dcgm.Device{GPU: gpuId, UUID: tt.uuids[gpuId]}, nil
+			}
+
+			err := checkGPUs(sysInfo)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDCGMSupervisor(t *testing.T) {
+	var sysInfo SystemInfo
+	sysInfo.GPUCount = 1
+	sysInfo.GPUs[0].DeviceInfo = dcgm.Device{UUID: "GPU-0"}
+
+	var (
+		mu      sync.Mutex
+		lostErr error
+	)
+	defer func() {
+		dcgmGetAllDeviceCount = dcgm.GetAllDeviceCount
+		dcgmGetDeviceInfo = dcgm.GetDeviceInfo
+	}()
+	dcgmGetAllDeviceCount = func() (uint, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return 1, lostErr
+	}
+	dcgmGetDeviceInfo = func(gpuId uint) (dcgm.Device, error) {
+		return dcgm.Device{UUID: "GPU-0"}, nil
+	}
+
+	supervisor := NewDCGMSupervisor(&Config{DCGMCheckInterval: 10})
+
+	var wg sync.WaitGroup
+	stop := make(chan interface{})
+	wg.Add(1)
+	go supervisor.Watch(FieldEntityGroupTypeSystemInfoItem{SystemInfo: sysInfo}, stop, &wg)
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	select {
+	case <-supervisor.C:
+		t.Fatal("reinitialization requested for a working DCGM")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.False(t, supervisor.Lost())
+
+	mu.Lock()
+	lostErr = errors.New("host engine is not valid any longer")
+	mu.Unlock()
+
+	select {
+	case <-supervisor.C:
+	case <-time.After(time.Second):
+		t.Fatal("reinitialization not requested after losing DCGM")
+	}
+	assert.True(t, supervisor.Lost())
+
+	// The backoff doubles up to the maximum
+	defer func(minBackoff, maxBackoff time.Duration) {
+		dcgmMinBackoff, dcgmMaxBackoff = minBackoff, maxBackoff
+	}(dcgmMinBackoff, dcgmMaxBackoff)
+	dcgmMinBackoff, dcgmMaxBackoff = time.Second, 3*time.Second
+
+	assert.Equal(t, time.Second, supervisor.Backoff())
+	assert.Equal(t, 2*time.Second, supervisor.Backoff())
+	assert.Equal(t, 3*time.Second, supervisor.Backoff())
+
+	before, _ := selfMetrics.Value(dcgmExpReconnectsTotal, nil)
+	supervisor.Reconnected()
+	after, _ := selfMetrics.Value(dcgmExpReconnectsTotal, nil)
+	assert.Equal(t, before+1, after)
+	assert.False(t, supervisor.Lost())
+	assert.Equal(t, time.Second, supervisor.Backoff())
+}
+
+func TestSetHostengineMode(t *testing.T) {
+	SetHostengineMode(HostengineModeEmbedded)
+	SetHostengineMode(HostengineModeStandalone)
+
+	// The mode replaces the previous one
+	_, exists := selfMetrics.Value(dcgmExpHostengineMode, map[string]string{"mode": "embedded"})
+	assert.False(t, exists)
+	value, exists := selfMetrics.Value(dcgmExpHostengineMode, map[string]string{"mode": "standalone"})
+	assert.True(t, exists)
+	assert.Equal(t, float64(1), value)
+}
+
+func TestHeartbeat(t *testing.T) {
+	var sysInfo SystemInfo
+	sysInfo.GPUCount = 1
+	sysInfo.GPUs[0].DeviceInfo = dcgm.Device{GPU: 0, UUID: "GPU-0"}
+	sysInfo.gOpt = DeviceOptions{Flex: true}
+
+	item := FieldEntityGroupTypeSystemInfoItem{
+		SystemInfo:   sysInfo,
+		DeviceFields: []dcgm.Short{dcgm.DCGM_FI_DRIVER_VERSION, dcgm.DCGM_FI_DEV_FB_FREE, dcgm.DCGM_FI_DEV_GPU_TEMP},
+	}
+	config := &Config{
+		CollectInterval:       1000,
+		DCGMCheckInterval:     500,
+		FieldCollectIntervals: map[dcgm.Short]time.Duration{dcgm.DCGM_FI_DEV_FB_FREE: time.Minute},
+	}
+
+	// The heartbeat is the first field updated every collect interval
+	hb := newHeartbeat(item, config)
+	assert.Equal(t, dcgm.Short(dcgm.DCGM_FI_DEV_GPU_TEMP), hb.field)
+	assert.Equal(t, 3*time.Second, hb.timeout)
+
+	defer func() {
+		dcgmEntityGetLatestValues = dcgm.EntityGetLatestValues
+	}()
+	value := dcgm.FieldValue_v1{FieldId: dcgm.DCGM_FI_DEV_GPU_TEMP, Ts: 1000}
+	dcgmEntityGetLatestValues = func(
+		_ dcgm.Field_Entity_Group, _ uint, _ []dcgm.Short,
+	) ([]dcgm.FieldValue_v1, error) {
+		return []dcgm.FieldValue_v1{value}, nil
+	}
+
+	now := time.Now()
+	assert.NoError(t, hb.check(now))
+	value.Ts = 2000
+	assert.NoError(t, hb.check(now.Add(2*time.Second)))
+
+	// The hostengine is hung when the field isn't updated within the timeout
+	assert.NoError(t, hb.check(now.Add(4*time.Second)))
+	assert.Error(t, hb.check(now.Add(6*time.Second)))
+
+	// The heartbeat is disabled when the entity doesn't support the field
+	value.Status = dcgm.DCGM_ST_NOT_SUPPORTED
+	assert.NoError(t, hb.check(now.Add(7*time.Second)))
+	value.Status = dcgm.DCGM_ST_OK
+	assert.NoError(t, hb.check(now.Add(time.Hour)))
+
+	assert.Nil(t, newHeartbeat(FieldEntityGroupTypeSystemInfoItem{
+		SystemInfo:   sysInfo,
+		DeviceFields: []dcgm.Short{dcgm.DCGM_FI_DRIVER_VERSION},
+	}, config))
+}
+
+func TestDCGMSupervisor_CrashLoopDelay(t *testing.T) {
+	supervisor := NewDCGMSupervisor(&Config{})
+
+	for i := 0; i < dcgmCrashLoopReinits-1; i++ {
+		supervisor.Reconnected()
+	}
+	assert.Zero(t, supervisor.CrashLoopDelay())
+
+	// The reinitializations are delayed while DCGM is crash looping
+	supervisor.Reconnected()
+	assert.Equal(t, dcgmMaxBackoff, supervisor.CrashLoopDelay())
+
+	// The reinitializations out of the window are forgotten
+	supervisor.mtx.Lock()
+	supervisor.reinits[0] = time.Now().Add(-dcgmCrashLoopWindow)
+	supervisor.mtx.Unlock()
+	assert.Zero(t, supervisor.CrashLoopDelay())
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+// DebugStatus is the state of the exporter served by the /debug/status endpoint.
+type DebugStatus struct {
+	Collectors []CollectorStatus `json:"collectors"`
+	// Timings holds the duration of the last run of the collectors and the transformations
+	Timings map[string]string `json:"timings"`
+	// DeviceToPods holds the pods attributed to every device by the PodMapper
+	DeviceToPods map[string][]PodInfo `json:"deviceToPods,omitempty"`
+}
+
+// CollectorStatus describes the entities and the fields watched by a DCGM collector.
+type CollectorStatus struct {
+	EntityType string       `json:"entityType"`
+	Fields     []string     `json:"fields"`
+	GPUs       []GPUInfo    `json:"gpus,omitempty"`
+	Switches   []SwitchInfo `json:"switches,omitempty"`
+	CPUs       []CPUInfo    `json:"cpus,omitempty"`
+}
+
+func (m *MetricsPipeline) recordTiming(name string, start time.Time) {
+	m.timingsMtx.Lock()
+	defer m.timingsMtx.Unlock()
+
+	if m.timings == nil {
+		m.timings = map[string]time.Duration{}
+	}
+	m.timings[name] = time.Since(start)
+}
+
+// Status returns the state of the collectors and the transformations of the pipeline.
+func (m *MetricsPipeline) Status() DebugStatus {
+	status := DebugStatus{
+		Collectors: []CollectorStatus{},
+		Timings:    map[string]string{},
+	}
+
+	for _, collector := range []*DCGMCollector{
+		m.gpuCollector, m.switchCollector, m.linkCollector, m.cpuCollector, m.coreCollector,
+	} {
+		if collector != nil {
+			status.Collectors = append(status.Collectors, collector.status())
+		}
+	}
+
+	m.timingsMtx.Lock()
+	for name, duration := range m.timings {
+		status.Timings[name] = duration.String()
+	}
+	m.timingsMtx.Unlock()
+
+	if podMapper := m.PodMapper(); podMapper != nil {
+		podMapper.deviceToPodsMtx.Lock()
+		status.DeviceToPods = podMapper.deviceToPods
+		podMapper.deviceToPodsMtx.Unlock()
+	}
+
+	return status
+}
+
+// PodMapper returns the transformation attributing the metrics to the pods, nil when Kubernetes is disabled.
+func (m *MetricsPipeline) PodMapper() *PodMapper {
+	for _, transform := range m.transformations {
+		if podMapper, ok := transform.(*PodMapper); ok {
+			return podMapper
+		}
+	}
+
+	return nil
+}
+
+func (c *DCGMCollector) status() CollectorStatus {
+	fieldNames := make(map[dcgm.Short]string, len(c.Counters))
+	for _, counter := range c.Counters {
+		fieldNames[counter.FieldID] = counter.FieldName
+	}
+
+	fields := make([]string, 0, len(c.DeviceFields))
+	for _, field := range c.DeviceFields {
+		if name, exists := fieldNames[field]; exists {
+			fields = append(fields, name)
+		} else {
+			fields = append(fields, fmt.Sprint(field))
+		}
+	}
+
+	return CollectorStatus{
+		EntityType: c.SysInfo.InfoType.String(),
+		Fields:     fields,
+		GPUs:       c.SysInfo.GPUs[:c.SysInfo.GPUCount],
+		Switches:   c.SysInfo.Switches,
+		CPUs:       c.SysInfo.CPUs,
+	}
+}
+
+// withoutWriteTimeout lifts the write timeout of the server for the profiles recorded for the requested duration, 30
+// seconds by default for the CPU profile. pprof rejects the durations exceeding the write timeout of the server of the
+// request, which is hidden from it once the deadline is lifted.
+func withoutWriteTimeout(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			logrus.WithError(err).Debug("Unable to lift the write timeout of the profile")
+		} else {
+			r = r.WithContext(context.WithValue(r.Context(), http.ServerContextKey, nil))
+		}
+
+		handler(w, r)
+	}
+}
+
+// HandleDebug serves the pprof profiles under /debug/pprof and the state of the pipeline under /debug/status.
+func (s *MetricsServer) HandleDebug(pipeline *MetricsPipeline) {
+	s.router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	s.router.HandleFunc("/debug/pprof/profile", withoutWriteTimeout(pprof.Profile))
+	s.router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	s.router.HandleFunc("/debug/pprof/trace", withoutWriteTimeout(pprof.Trace))
+	// The index serves the named profiles, e.g. /debug/pprof/heap
+	s.router.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+
+	s.router.HandleFunc("/debug/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(pipeline.Status()); err != nil {
+			logrus.WithError(err).Error("Failed to write response.")
+		}
+	})
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsServer_HandleDebug(t *testing.T) {
+	sysInfo := SystemInfo{GPUCount: 1, InfoType: dcgm.FE_GPU}
+	sysInfo.GPUs[0].DeviceInfo.UUID = "GPU-0"
+
+	podMapper := &PodMapper{
+		deviceToPods: map[string][]PodInfo{"GPU-0": {{Name: "trainer", Namespace: "default", Container: "main"}}},
+	}
+
+	pipeline := &MetricsPipeline{
+		transformations: []Transform{podMapper},
+		gpuCollector: &DCGMCollector{
+			Counters:     []Counter{{FieldID: dcgm.DCGM_FI_DEV_GPU_UTIL, FieldName: "DCGM_FI_DEV_GPU_UTIL"}},
+			DeviceFields: []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_UTIL, dcgm.DCGM_FI_DEV_FB_USED},
+			SysInfo:      sysInfo,
+		},
+	}
+	pipeline.recordTiming("gpu", time.Now().Add(-time.Second))
+
+	server, _, err := NewMetricsServer(&Config{}, nil, NewRegistry())
+	require.NoError(t, err)
+	server.HandleDebug(pipeline)
+
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/status", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var status DebugStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.Len(t, status.Collectors, 1)
+	assert.Equal(t, []string{"DCGM_FI_DEV_GPU_UTIL", "252"}, status.Collectors[0].Fields)
+	require.Len(t, status.Collectors[0].GPUs, 1)
+	assert.Equal(t, "GPU-0", status.Collectors[0].GPUs[0].DeviceInfo.UUID)
+	assert.Contains(t, status.Timings, "gpu")
+	assert.Equal(t, podMapper.deviceToPods, status.DeviceToPods)
+
+	rec = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "goroutine")
+}
+
+func TestMetricsServer_HandleDebug_WriteTimeout(t *testing.T) {
+	// The compressed responses lift the deadline too
+	server, _, err := NewMetricsServer(&Config{WebCompression: []string{encodingGzip}}, nil, NewRegistry())
+	require.NoError(t, err)
+	server.HandleDebug(&MetricsPipeline{})
+
+	ts := httptest.NewUnstartedServer(server.server.Handler)
+	ts.Config.WriteTimeout = 100 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	// The profiles are recorded for longer than the write timeout of the server
+	for _, path := range []string{"/debug/pprof/profile?seconds=1", "/debug/pprof/trace?seconds=1"} {
+		resp, err := http.Get(ts.URL + path)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err, path)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+		assert.NotEmpty(t, body, path)
+	}
+}
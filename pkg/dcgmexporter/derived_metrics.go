@@ -0,0 +1,501 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"sigs.k8s.io/yaml"
+)
+
+// derivedMetricsConfig is the format of the derived metrics file.
+type derivedMetricsConfig struct {
+	Metrics []derivedMetricConfig `json:"metrics"`
+}
+
+type derivedMetricConfig struct {
+	Name string `json:"name"`
+	Help string `json:"help"`
+	// Type is gauge by default
+	Type string `json:"type"`
+	// Expr is computed from the other metrics of the device, e.g. DCGM_FI_DEV_FB_USED / DCGM_FI_DEV_FB_TOTAL
+	Expr string `json:"expr"`
+}
+
+type derivedMetric struct {
+	counter Counter
+	expr    derivedExpr
+	// template is the first metric of the expression, the derived metric is exported with its labels
+	template string
+}
+
+// derivedDevice holds the values of the metrics of a device in a collection.
+type derivedDevice struct {
+	time    time.Time
+	values  map[string]float64
+	metrics map[string]Metric
+}
+
+// DerivedMetrics computes the metrics of the derived metrics file from the other metrics of every device, at every
+// collection.
+type DerivedMetrics struct {
+	metrics []derivedMetric
+	// previous holds the values of the last collection by device, for delta and rate
+	previous map[string]derivedDevice
+	now      func() time.Time
+}
+
+// NewDerivedMetrics loads the derived metrics file.
+func NewDerivedMetrics(c *Config) (*DerivedMetrics, error) {
+	file, err := os.Open(c.DerivedMetrics)
+	if err != nil {
+		return nil, fmt.Errorf("could not open derived metrics '%s'; err: %w", c.DerivedMetrics, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read derived metrics '%s'; err: %w", c.DerivedMetrics, err)
+	}
+
+	var config derivedMetricsConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("could not parse derived metrics '%s'; err: %w", c.DerivedMetrics, err)
+	}
+
+	d := &DerivedMetrics{
+		previous: map[string]derivedDevice{},
+		now:      time.Now,
+	}
+
+	names := map[string]bool{}
+	for i, metricConfig := range config.Metrics {
+		metric, err := newDerivedMetric(metricConfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric %d of derived metrics '%s'; err: %w", i, c.DerivedMetrics, err)
+		}
+		if names[metricConfig.Name] {
+			return nil, fmt.Errorf("invalid metric %d of derived metrics '%s'; err: duplicated name '%s'",
+				i, c.DerivedMetrics, metricConfig.Name)
+		}
+		names[metricConfig.Name] = true
+
+		d.metrics = append(d.metrics, metric)
+	}
+
+	return d, nil
+}
+
+func newDerivedMetric(c derivedMetricConfig) (derivedMetric, error) {
+	if !metricNameRegex.MatchString(c.Name) {
+		return derivedMetric{}, fmt.Errorf("invalid name '%s'", c.Name)
+	}
+
+	promType := c.Type
+	switch promType {
+	case "":
+		promType = "gauge"
+	case "gauge", "counter":
+	default:
+		return derivedMetric{}, fmt.Errorf("invalid type '%s', expected gauge or counter", c.Type)
+	}
+
+	expr, err := parseDerivedExpr(c.Expr)
+	if err != nil {
+		return derivedMetric{}, fmt.Errorf("invalid expr '%s'; err: %w", c.Expr, err)
+	}
+
+	var names []string
+	expr.metrics(&names)
+	if len(names) == 0 {
+		return derivedMetric{}, fmt.Errorf("invalid expr '%s'; err: no metric", c.Expr)
+	}
+
+	return derivedMetric{
+		counter:  Counter{FieldName: c.Name, PromType: promType, Help: c.Help},
+		expr:     expr,
+		template: names[0],
+	}, nil
+}
+
+func (d *DerivedMetrics) Name() string {
+	return "derivedMetrics"
+}
+
+func (d *DerivedMetrics) Process(metrics MetricsByCounter, _ SystemInfo) error {
+	devices, keys := derivedDevices(metrics, d.now())
+
+	for _, derived := range d.metrics {
+		for _, key := range keys {
+			device := devices[key]
+			env := derivedEnv{current: device}
+			if previous, exists := d.previous[key]; exists {
+				env.previous = &previous
+			}
+
+			value, ok := derived.expr.eval(env)
+			if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+				continue
+			}
+
+			metric := device.metrics[derived.template]
+			metric.Counter = derived.counter
+			metric.Value = fmt.Sprintf("%f", value)
+			metric.Labels = copyLabels(metric.Labels)
+			metric.Attributes = copyLabels(metric.Attributes)
+			metric.Exemplar = nil
+			metric.ExemplarTimestamp = time.Time{}
+
+			metrics[derived.counter] = append(metrics[derived.counter], metric)
+		}
+	}
+
+	d.previous = devices
+
+	return nil
+}
+
+// derivedDevices returns the values of the metrics of every device, and the sorted keys of the devices.
+func derivedDevices(metrics MetricsByCounter, now time.Time) (map[string]derivedDevice, []string) {
+	devices := map[string]derivedDevice{}
+	for counter, counterMetrics := range metrics {
+		// The samples of the histograms are not values of the field
+		if counter.PromType == histogramPromType {
+			continue
+		}
+
+		for _, metric := range counterMetrics {
+			value, err := strconv.ParseFloat(metric.Value, 64)
+			if err != nil {
+				continue
+			}
+
+			key := derivedDeviceKey(metric)
+			device, exists := devices[key]
+			if !exists {
+				device = derivedDevice{time: now, values: map[string]float64{}, metrics: map[string]Metric{}}
+				devices[key] = device
+			}
+
+			// The first metric of a counter is kept, e.g. for the bitmasks
+			if _, exists := device.values[counter.FieldName]; !exists {
+				device.values[counter.FieldName] = value
+				device.metrics[counter.FieldName] = metric
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(devices))
+	for key := range devices {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return devices, keys
+}
+
+// derivedDeviceKey identifies the GPU or the MIG instance of a metric.
+func derivedDeviceKey(metric Metric) string {
+	return metric.GPU + "/" + metric.GPUInstanceID
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+
+	result := make(map[string]string, len(labels))
+	for k, v := range labels {
+		result[k] = v
+	}
+
+	return result
+}
+
+// derivedEnv holds the values the expressions are evaluated with, previous is nil in the first collection.
+type derivedEnv struct {
+	current  derivedDevice
+	previous *derivedDevice
+}
+
+// derivedExpr is an arithmetic expression of the metrics of a device; eval returns false when a metric is missing.
+type derivedExpr interface {
+	eval(env derivedEnv) (float64, bool)
+	metrics(names *[]string)
+}
+
+type numberExpr float64
+
+func (e numberExpr) eval(derivedEnv) (float64, bool) { return float64(e), true }
+
+func (e numberExpr) metrics(*[]string) {}
+
+type metricExpr string
+
+func (e metricExpr) eval(env derivedEnv) (float64, bool) {
+	value, exists := env.current.values[string(e)]
+	return value, exists
+}
+
+func (e metricExpr) metrics(names *[]string) { *names = append(*names, string(e)) }
+
+// deltaExpr is the increase of a metric since the last collection, or per second for rate; it is missing after a
+// reset of the metric.
+type deltaExpr struct {
+	metric    string
+	perSecond bool
+}
+
+func (e deltaExpr) eval(env derivedEnv) (float64, bool) {
+	if env.previous == nil {
+		return 0, false
+	}
+
+	current, exists := env.current.values[e.metric]
+	if !exists {
+		return 0, false
+	}
+	previous, exists := env.previous.values[e.metric]
+	if !exists || current < previous {
+		return 0, false
+	}
+
+	delta := current - previous
+	if !e.perSecond {
+		return delta, true
+	}
+
+	elapsed := env.current.time.Sub(env.previous.time).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+
+	return delta / elapsed, true
+}
+
+func (e deltaExpr) metrics(names *[]string) { *names = append(*names, e.metric) }
+
+type negExpr struct {
+	expr derivedExpr
+}
+
+func (e negExpr) eval(env derivedEnv) (float64, bool) {
+	value, ok := e.expr.eval(env)
+	return -value, ok
+}
+
+func (e negExpr) metrics(names *[]string) { e.expr.metrics(names) }
+
+type binaryExpr struct {
+	op          byte
+	left, right derivedExpr
+}
+
+func (e binaryExpr) eval(env derivedEnv) (float64, bool) {
+	left, ok := e.left.eval(env)
+	if !ok {
+		return 0, false
+	}
+	right, ok := e.right.eval(env)
+	if !ok {
+		return 0, false
+	}
+
+	switch e.op {
+	case '+':
+		return left + right, true
+	case '-':
+		return left - right, true
+	case '*':
+		return left * right, true
+	case '/':
+		if right == 0 {
+			return 0, false
+		}
+		return left / right, true
+	}
+
+	return 0, false
+}
+
+func (e binaryExpr) metrics(names *[]string) {
+	e.left.metrics(names)
+	e.right.metrics(names)
+}
+
+// derivedParser parses the expressions with the usual precedence of the operators:
+//
+//	expr    = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/") unary }
+//	unary   = "-" unary | primary
+//	primary = number | metric | ("delta" | "rate") "(" metric ")" | "(" expr ")"
+type derivedParser struct {
+	input string
+	pos   int
+}
+
+func parseDerivedExpr(input string) (derivedExpr, error) {
+	p := &derivedParser{input: input}
+
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected '%c' at position %d", p.input[p.pos], p.pos)
+	}
+
+	return expr, nil
+}
+
+func (p *derivedParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek returns the next character, or 0 at the end of the input.
+func (p *derivedParser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return 0
+	}
+
+	return p.input[p.pos]
+}
+
+func (p *derivedParser) parseExpr() (derivedExpr, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *derivedParser) parseTerm() (derivedExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *derivedParser) parseUnary() (derivedExpr, error) {
+	if p.peek() == '-' {
+		p.pos++
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negExpr{expr: expr}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *derivedParser) parsePrimary() (derivedExpr, error) {
+	c := p.peek()
+
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	case c == '(':
+		p.pos++
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ')' at position %d", p.pos)
+		}
+		p.pos++
+		return expr, nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.input) && strings.ContainsRune("0123456789.", rune(p.input[p.pos])) {
+			p.pos++
+		}
+		value, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s'", p.input[start:p.pos])
+		}
+		return numberExpr(value), nil
+	case isNameStart(c):
+		name := p.parseName()
+		if p.peek() != '(' {
+			return metricExpr(name), nil
+		}
+
+		if name != "delta" && name != "rate" {
+			return nil, fmt.Errorf("unknown function '%s'", name)
+		}
+		p.pos++
+		if !isNameStart(p.peek()) {
+			return nil, fmt.Errorf("expected a metric in %s() at position %d", name, p.pos)
+		}
+		metric := p.parseName()
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ')' at position %d", p.pos)
+		}
+		p.pos++
+		return deltaExpr{metric: metric, perSecond: name == "rate"}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected '%c' at position %d", c, p.pos)
+}
+
+func (p *derivedParser) parseName() string {
+	start := p.pos
+	for p.pos < len(p.input) && (isNameStart(p.input[p.pos]) || p.input[p.pos] >= '0' && p.input[p.pos] <= '9') {
+		p.pos++
+	}
+
+	return p.input[start:p.pos]
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	sysOS "os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDerivedMetrics(t *testing.T, config string) (*DerivedMetrics, error) {
+	t.Helper()
+
+	configFile := filepath.Join(t.TempDir(), "derived.yaml")
+	require.NoError(t, sysOS.WriteFile(configFile, []byte(config), 0o644))
+
+	return NewDerivedMetrics(&Config{DerivedMetrics: configFile})
+}
+
+func TestParseDerivedExpr(t *testing.T) {
+	env := derivedEnv{
+		current: derivedDevice{
+			time:   time.Unix(20, 0),
+			values: map[string]float64{"A": 6, "B": 2, "ENERGY": 3000},
+		},
+		previous: &derivedDevice{
+			time:   time.Unix(10, 0),
+			values: map[string]float64{"A": 1, "ENERGY": 1000},
+		},
+	}
+
+	tests := []struct {
+		expr  string
+		value float64
+		ok    bool
+	}{
+		{expr: "A + B * 2", value: 10, ok: true},
+		{expr: "(A + B) * 2", value: 16, ok: true},
+		{expr: "A / (A + B)", value: 0.75, ok: true},
+		{expr: "-A - -B", value: -4, ok: true},
+		{expr: "A / 0.5", value: 12, ok: true},
+		{expr: "delta(ENERGY) / 1000", value: 2, ok: true},
+		{expr: "rate(ENERGY)", value: 200, ok: true},
+		{expr: "A / (B - 2)", ok: false},
+		{expr: "A + C", ok: false},
+		{expr: "delta(B)", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := parseDerivedExpr(tt.expr)
+			require.NoError(t, err)
+
+			value, ok := expr.eval(env)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.InDelta(t, tt.value, value, 1e-9)
+			}
+		})
+	}
+
+	for _, expr := range []string{"", "A +", "(A", "A B", "max(A)", "delta(1)", "delta(A", "A % B", "1..2"} {
+		_, err := parseDerivedExpr(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestNewDerivedMetricsErrors(t *testing.T) {
+	for _, config := range []string{
+		"metrics:\n- name: 1ratio\n  expr: A / B\n",
+		"metrics:\n- name: ratio\n  type: histogram\n  expr: A / B\n",
+		"metrics:\n- name: ratio\n  expr: A /\n",
+		"metrics:\n- name: ratio\n  expr: 1 / 2\n",
+		"metrics:\n- name: ratio\n  expr: A / B\n- name: ratio\n  expr: B / A\n",
+		"metrics:\n- name: ratio\n  expression: A / B\n",
+	} {
+		_, err := newTestDerivedMetrics(t, config)
+		assert.Error(t, err, config)
+	}
+}
+
+func TestDerivedMetrics_Process(t *testing.T) {
+	derived, err := newTestDerivedMetrics(t, `
+metrics:
+- name: DCGM_EXP_FB_USED_RATIO
+  help: Ratio of the framebuffer memory used.
+  expr: DCGM_FI_DEV_FB_USED / (DCGM_FI_DEV_FB_USED + DCGM_FI_DEV_FB_FREE)
+- name: DCGM_EXP_ENERGY_PER_SM_ACTIVE
+  help: Energy consumed per ratio of SM activity since the last collection (in mJ).
+  expr: delta(DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION) / DCGM_FI_PROF_SM_ACTIVE
+`)
+	require.NoError(t, err)
+
+	now := time.Unix(100, 0)
+	derived.now = func() time.Time { return now }
+
+	used := Counter{FieldName: "DCGM_FI_DEV_FB_USED", PromType: "gauge"}
+	free := Counter{FieldName: "DCGM_FI_DEV_FB_FREE", PromType: "gauge"}
+	energy := Counter{FieldName: "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", PromType: "counter"}
+	smActive := Counter{FieldName: "DCGM_FI_PROF_SM_ACTIVE", PromType: "gauge"}
+	ratio := Counter{FieldName: "DCGM_EXP_FB_USED_RATIO", PromType: "gauge", Help: "Ratio of the framebuffer memory used."}
+	efficiency := Counter{
+		FieldName: "DCGM_EXP_ENERGY_PER_SM_ACTIVE",
+		PromType:  "gauge",
+		Help:      "Energy consumed per ratio of SM activity since the last collection (in mJ).",
+	}
+
+	collect := func(energyValue string) MetricsByCounter {
+		metric := func(gpu, instance, value string) Metric {
+			return Metric{GPU: gpu, GPUInstanceID: instance, Value: value, Labels: map[string]string{"driver": "550"}}
+		}
+		metrics := MetricsByCounter{
+			used:     {metric("0", "", "1000"), metric("1", "", "3000"), metric("1", "2", "10")},
+			free:     {metric("0", "", "3000"), metric("1", "", "1000")},
+			energy:   {metric("0", "", energyValue)},
+			smActive: {metric("0", "", "0.5")},
+		}
+		require.NoError(t, derived.Process(metrics, SystemInfo{}))
+		return metrics
+	}
+
+	metrics := collect("10000")
+	assert.Equal(t, []Metric{
+		{Counter: ratio, GPU: "0", Value: "0.250000", Labels: map[string]string{"driver": "550"}},
+		{Counter: ratio, GPU: "1", Value: "0.750000", Labels: map[string]string{"driver": "550"}},
+	}, metrics[ratio])
+	// The deltas are computed from the second collection
+	assert.Empty(t, metrics[efficiency])
+
+	now = now.Add(10 * time.Second)
+	metrics = collect("12000")
+	assert.Equal(t, []Metric{
+		{Counter: efficiency, GPU: "0", Value: "4000.000000", Labels: map[string]string{"driver": "550"}},
+	}, metrics[efficiency])
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// DeviceIDParser decodes the device IDs registered with the kubelet by a third-party GPU sharing device plugin.
+type DeviceIDParser struct {
+	// ResourceNames are the extended resources advertised by the device plugin.
+	ResourceNames []string
+	// Parse returns the ID of the physical GPU and the replica encoded in the device ID.
+	Parse func(deviceID string) (gpuID string, replica string, ok bool)
+}
+
+var (
+	deviceIDParsersMtx sync.RWMutex
+	deviceIDParsers    = map[string]DeviceIDParser{}
+
+	// uuidReplicaDeviceIDRegex matches <GPU UUID>-<replica>, used by HAMi and Volcano to split a GPU into
+	// several devices.
+	uuidReplicaDeviceIDRegex = regexp.MustCompile(
+		`^(GPU-[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})-([0-9]+)$`)
+	// gpuUUIDRegex matches the UUID of a GPU.
+	gpuUUIDRegex = regexp.MustCompile(
+		`^GPU-[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+func init() {
+	RegisterDeviceIDParser("hami", DeviceIDParser{
+		ResourceNames: []string{nvidiaResourceName},
+		Parse:         parseUUIDReplicaDeviceID,
+	})
+	RegisterDeviceIDParser("volcano", DeviceIDParser{
+		ResourceNames: []string{"volcano.sh/vgpu-number"},
+		Parse:         parseUUIDReplicaDeviceID,
+	})
+}
+
+// RegisterDeviceIDParser makes a device ID parser available under the given name, so it can be enabled
+// with Config.KubernetesDeviceIDParsers.
+func RegisterDeviceIDParser(name string, parser DeviceIDParser) {
+	deviceIDParsersMtx.Lock()
+	defer deviceIDParsersMtx.Unlock()
+
+	deviceIDParsers[name] = parser
+}
+
+// getDeviceIDParsers returns the registered parsers with the given names.
+func getDeviceIDParsers(names []string) ([]DeviceIDParser, error) {
+	deviceIDParsersMtx.RLock()
+	defer deviceIDParsersMtx.RUnlock()
+
+	parsers := make([]DeviceIDParser, 0, len(names))
+
+	for _, name := range names {
+		parser, exists := deviceIDParsers[name]
+		if !exists {
+			available := make([]string, 0, len(deviceIDParsers))
+			for name := range deviceIDParsers {
+				available = append(available, name)
+			}
+			sort.Strings(available)
+
+			return nil, fmt.Errorf("unknown device ID parser '%s'; available parsers: %v", name, available)
+		}
+
+		parsers = append(parsers, parser)
+	}
+
+	return parsers, nil
+}
+
+func parseUUIDReplicaDeviceID(deviceID string) (string, string, bool) {
+	matches := uuidReplicaDeviceIDRegex.FindStringSubmatch(deviceID)
+	if matches == nil {
+		return "", "", false
+	}
+
+	return matches[1], matches[2], true
+}
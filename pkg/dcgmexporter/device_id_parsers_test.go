@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUUIDReplicaDeviceID(t *testing.T) {
+	tests := []struct {
+		deviceID    string
+		wantGPUID   string
+		wantReplica string
+		wantOK      bool
+	}{
+		{
+			deviceID:    "GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5-3",
+			wantGPUID:   "GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5",
+			wantReplica: "3",
+			wantOK:      true,
+		},
+		{
+			deviceID: "GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5",
+		},
+		{
+			deviceID: "GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5::3",
+		},
+		{
+			deviceID: "nvidia0/gi0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.deviceID, func(t *testing.T) {
+			gpuID, replica, ok := parseUUIDReplicaDeviceID(tt.deviceID)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantGPUID, gpuID)
+			assert.Equal(t, tt.wantReplica, replica)
+		})
+	}
+}
+
+func TestGetDeviceIDParsers(t *testing.T) {
+	parsers, err := getDeviceIDParsers([]string{"hami", "volcano"})
+	require.NoError(t, err)
+	require.Len(t, parsers, 2)
+	assert.Equal(t, []string{nvidiaResourceName}, parsers[0].ResourceNames)
+	assert.Equal(t, []string{"volcano.sh/vgpu-number"}, parsers[1].ResourceNames)
+
+	_, err = getDeviceIDParsers([]string{"unknown"})
+	assert.ErrorContains(t, err, "unknown device ID parser 'unknown'")
+}
@@ -0,0 +1,258 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// deviceMappingStrategy decides which of the pods using a device its metrics are attributed to.
+type deviceMappingStrategy interface {
+	pods(devicePods []PodInfo) []PodInfo
+}
+
+// exclusiveMapping attributes the metrics of a device to a single pod. When the device is shared, the last
+// pod reported by the kubelet wins.
+type exclusiveMapping struct{}
+
+func (exclusiveMapping) pods(devicePods []PodInfo) []PodInfo {
+	if len(devicePods) == 0 {
+		return nil
+	}
+
+	return devicePods[len(devicePods)-1:]
+}
+
+// sharedMapping attributes the metrics of a shared device to every pod using it.
+type sharedMapping struct{}
+
+func (sharedMapping) pods(devicePods []PodInfo) []PodInfo {
+	return devicePods
+}
+
+func newDeviceMappingStrategy(c *Config) deviceMappingStrategy {
+	if c.KubernetesVirtualGPUs {
+		return sharedMapping{}
+	}
+
+	return exclusiveMapping{}
+}
+
+// deviceIDNormalizer returns the identifiers, in addition to the device ID itself, under which a device
+// reported by the kubelet is known, and the replica when the device is shared.
+type deviceIDNormalizer func(p *PodMapper, deviceID string, sysInfo SystemInfo) (keys []string, replica string, ok bool)
+
+// deviceIDNormalizers are tried in order, the first one recognizing the device ID wins. New device ID
+// formats only need to be added here.
+var deviceIDNormalizers = []struct {
+	name      string
+	normalize deviceIDNormalizer
+}{
+	{name: "mig-uuid", normalize: normalizeMIGDeviceID},
+	{name: "gke-mig", normalize: normalizeGKEMIGDeviceID},
+	{name: "shared-gpu", normalize: normalizeSharedGPUDeviceID},
+}
+
+// normalizeMIGDeviceID handles MIG-<UUID> device IDs.
+func normalizeMIGDeviceID(_ *PodMapper, deviceID string, sysInfo SystemInfo) ([]string, string, bool) {
+	if !strings.HasPrefix(deviceID, MIG_UUID_PREFIX) {
+		return nil, "", false
+	}
+
+	var keys []string
+
+	migDevice, err := nvmlGetMIGDeviceInfoByIDHook(deviceID)
+	if err == nil {
+		giIdentifier := GetGPUInstanceIdentifier(sysInfo, migDevice.ParentUUID,
+			uint(migDevice.GPUInstanceID))
+		keys = append(keys, giIdentifier)
+	}
+
+	gpuUUID := deviceID[len(MIG_UUID_PREFIX):]
+	keys = append(keys, gpuUUID)
+
+	return keys, "", true
+}
+
+// normalizeGKEMIGDeviceID handles the nvidia<GPU index>/gi<GPU instance ID> device IDs of GKE.
+func normalizeGKEMIGDeviceID(_ *PodMapper, deviceID string, _ SystemInfo) ([]string, string, bool) {
+	gkeMigDeviceIDMatches := gkeMigDeviceIDRegex.FindStringSubmatch(deviceID)
+	if gkeMigDeviceIDMatches == nil {
+		return nil, "", false
+	}
+
+	var gpuIndex string
+	var gpuInstanceID string
+	for groupIdx, group := range gkeMigDeviceIDMatches {
+		switch groupIdx {
+		case 1:
+			gpuIndex = group
+		case 2:
+			gpuInstanceID = group
+		}
+	}
+
+	return []string{fmt.Sprintf("%s-%s", gpuIndex, gpuInstanceID)}, "", true
+}
+
+// normalizeSharedGPUDeviceID handles the replicas of a GPU shared between containers.
+func normalizeSharedGPUDeviceID(p *PodMapper, deviceID string, _ SystemInfo) ([]string, string, bool) {
+	gpuID, replica, ok := p.getSharedGPU(deviceID)
+	if !ok {
+		return nil, "", false
+	}
+
+	return []string{gpuID}, replica, true
+}
+
+// toDeviceKeys returns the identifiers, matching Metric.getIDOfType, under which the device reported by
+// the kubelet is known, and the replica when the device is shared.
+func (p *PodMapper) toDeviceKeys(deviceID string, sysInfo SystemInfo) ([]string, string) {
+	for _, normalizer := range deviceIDNormalizers {
+		if keys, replica, ok := normalizer.normalize(p, deviceID, sysInfo); ok {
+			// Default mapping between deviceID and pod information
+			return append(keys, deviceID), replica
+		}
+	}
+
+	return []string{deviceID}, ""
+}
+
+// toDeviceToPods maps every device identifier to the pods using the device, in the order reported by
+// the kubelet.
+func (p *PodMapper) toDeviceToPods(
+	devicePods *podresourcesapi.ListPodResourcesResponse, sysInfo SystemInfo,
+) map[string][]PodInfo {
+	deviceToPodsMap := make(map[string][]PodInfo)
+
+	for _, pod := range devicePods.GetPodResources() {
+		for _, container := range pod.GetContainers() {
+			for _, device := range container.GetDevices() {
+				resourceName := device.GetResourceName()
+				if !p.isNvidiaResource(resourceName, device.GetDeviceIds()) {
+					continue
+				}
+
+				mpsReplicas, isMPS := p.mpsResources[resourceName]
+
+				for _, deviceID := range device.GetDeviceIds() {
+					keys, replica := p.toDeviceKeys(deviceID, sysInfo)
+
+					podInfo := PodInfo{
+						Name:      pod.GetName(),
+						Namespace: pod.GetNamespace(),
+						Container: container.GetName(),
+						VGPU:      replica,
+					}
+
+					if isMPS {
+						gpuID := deviceID
+						if sharedGPUID, _, ok := p.getSharedGPU(deviceID); ok {
+							gpuID = sharedGPUID
+						}
+						podInfo.MPSAttributes = mpsAttributes(gpuID, mpsReplicas)
+					}
+
+					if p.Config.KubernetesSharingMetrics {
+						if isMPS {
+							podInfo.Sharing, podInfo.SharingReplicas = sharingMPS, mpsReplicas
+						} else if replicas, exists := p.timeSlicingResources[resourceName]; exists {
+							podInfo.Sharing, podInfo.SharingReplicas = sharingTimeSlicing, replicas
+						}
+					}
+
+					for _, key := range keys {
+						deviceToPodsMap[key] = append(deviceToPodsMap[key], podInfo)
+					}
+				}
+			}
+		}
+	}
+
+	return deviceToPodsMap
+}
+
+// isNvidiaResource tells whether the devices of the resource are GPUs, MIG devices or their replicas.
+func (p *PodMapper) isNvidiaResource(resourceName string, deviceIDs []string) bool {
+	if resourceName == nvidiaResourceName || resourceName == nvidiaResourceName+sharedResourceSuffix {
+		return true
+	}
+
+	// Resources shared with MPS may be renamed by the device plugin
+	if _, exists := p.mpsResources[resourceName]; exists {
+		return true
+	}
+
+	for _, parser := range p.deviceIDParsers {
+		if slices.Contains(parser.ResourceNames, resourceName) {
+			return true
+		}
+	}
+
+	// Mig resources appear differently than GPU resources
+	if strings.HasPrefix(resourceName, nvidiaMigResourcePrefix) {
+		return true
+	}
+
+	// The resources renamed by the device plugin, e.g. by a time-slicing config, are recognized by their device IDs
+	return p.detectResources && strings.HasPrefix(resourceName, nvidiaResourcePrefix) && p.areGPUDeviceIDs(deviceIDs)
+}
+
+// areGPUDeviceIDs tells whether all the device IDs are the UUIDs of GPUs or MIG devices, or of their replicas.
+func (p *PodMapper) areGPUDeviceIDs(deviceIDs []string) bool {
+	if len(deviceIDs) == 0 {
+		return false
+	}
+
+	for _, deviceID := range deviceIDs {
+		if gpuID, _, ok := p.getSharedGPU(deviceID); ok {
+			deviceID = gpuID
+		}
+
+		if !gpuUUIDRegex.MatchString(deviceID) && !strings.HasPrefix(deviceID, MIG_UUID_PREFIX) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getSharedGPU parses the device ID of a GPU shared between containers, either with GKE time-sharing
+// (<gpu>/vgpu<replica>) or with the replicas of the NVIDIA device plugin used by time-slicing and MPS
+// (<gpu>::<replica>), or with one of the enabled third-party device plugins. It returns the ID of the
+// physical GPU and the replica.
+func (p *PodMapper) getSharedGPU(deviceID string) (string, string, bool) {
+	if gpuID, replica, ok := strings.Cut(deviceID, gkeVirtualGPUDeviceIDSeparator); ok {
+		return gpuID, replica, true
+	}
+
+	if gpuID, replica, ok := strings.Cut(deviceID, nvidiaReplicaDeviceIDSeparator); ok {
+		return gpuID, replica, true
+	}
+
+	for _, parser := range p.deviceIDParsers {
+		if gpuID, replica, ok := parser.Parse(deviceID); ok {
+			return gpuID, replica, true
+		}
+	}
+
+	return "", "", false
+}
@@ -0,0 +1,361 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/testutils"
+)
+
+func TestToDeviceKeys(t *testing.T) {
+	const gpuUUID = "GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5"
+
+	nvmlGetMIGDeviceInfoByIDHook = func(uuid string) (*nvmlprovider.MIGDeviceInfo, error) {
+		if uuid != "MIG-b8ea3855-276c-c9cb-b366-c6fa655957c5" {
+			return nil, fmt.Errorf("unknown MIG device '%s'", uuid)
+		}
+
+		return &nvmlprovider.MIGDeviceInfo{
+			ParentUUID:    gpuUUID,
+			GPUInstanceID: 3,
+		}, nil
+	}
+	defer func() {
+		nvmlGetMIGDeviceInfoByIDHook = nvmlprovider.GetMIGDeviceInfoByID
+	}()
+
+	sysInfo := SystemInfo{GPUCount: 1}
+	sysInfo.GPUs[0].DeviceInfo = dcgm.Device{GPU: 0, UUID: gpuUUID}
+
+	hamiParsers, err := getDeviceIDParsers([]string{"hami"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		deviceID    string
+		parsers     []DeviceIDParser
+		wantKeys    []string
+		wantReplica string
+	}{
+		{
+			name:     "GPU UUID",
+			deviceID: gpuUUID,
+			wantKeys: []string{gpuUUID},
+		},
+		{
+			name:     "MIG UUID",
+			deviceID: "MIG-b8ea3855-276c-c9cb-b366-c6fa655957c5",
+			wantKeys: []string{
+				"0-3",
+				"b8ea3855-276c-c9cb-b366-c6fa655957c5",
+				"MIG-b8ea3855-276c-c9cb-b366-c6fa655957c5",
+			},
+		},
+		{
+			name:     "unknown MIG UUID",
+			deviceID: "MIG-c2a8f4b1-5e7d-4c3a-9f21-0d8e6b7a4c19",
+			wantKeys: []string{
+				"c2a8f4b1-5e7d-4c3a-9f21-0d8e6b7a4c19",
+				"MIG-c2a8f4b1-5e7d-4c3a-9f21-0d8e6b7a4c19",
+			},
+		},
+		{
+			name:     "GKE MIG",
+			deviceID: "nvidia0/gi3",
+			wantKeys: []string{"0-3", "nvidia0/gi3"},
+		},
+		{
+			name:        "GKE time-sharing",
+			deviceID:    "nvidia0/vgpu2",
+			wantKeys:    []string{"nvidia0", "nvidia0/vgpu2"},
+			wantReplica: "2",
+		},
+		{
+			name:        "NVIDIA device plugin replica",
+			deviceID:    gpuUUID + "::1",
+			wantKeys:    []string{gpuUUID, gpuUUID + "::1"},
+			wantReplica: "1",
+		},
+		{
+			name:     "HAMi without parser",
+			deviceID: gpuUUID + "-4",
+			wantKeys: []string{gpuUUID + "-4"},
+		},
+		{
+			name:        "HAMi with parser",
+			deviceID:    gpuUUID + "-4",
+			parsers:     hamiParsers,
+			wantKeys:    []string{gpuUUID, gpuUUID + "-4"},
+			wantReplica: "4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &PodMapper{deviceIDParsers: tt.parsers}
+
+			keys, replica := p.toDeviceKeys(tt.deviceID, sysInfo)
+			assert.Equal(t, tt.wantKeys, keys)
+			assert.Equal(t, tt.wantReplica, replica)
+		})
+	}
+}
+
+func TestDeviceMappingStrategy(t *testing.T) {
+	pods := []PodInfo{
+		{Name: "pod-0", Namespace: "default", Container: "default", VGPU: "0"},
+		{Name: "pod-1", Namespace: "default", Container: "default", VGPU: "1"},
+	}
+
+	tests := []struct {
+		name       string
+		config     *Config
+		devicePods []PodInfo
+		want       []PodInfo
+	}{
+		{
+			name:       "exclusive without pods",
+			config:     &Config{},
+			devicePods: nil,
+			want:       nil,
+		},
+		{
+			name:       "exclusive with a single pod",
+			config:     &Config{},
+			devicePods: pods[:1],
+			want:       pods[:1],
+		},
+		{
+			name:       "exclusive keeps the last pod",
+			config:     &Config{},
+			devicePods: pods,
+			want:       pods[1:],
+		},
+		{
+			name:       "shared without pods",
+			config:     &Config{KubernetesVirtualGPUs: true},
+			devicePods: nil,
+			want:       nil,
+		},
+		{
+			name:       "shared keeps every pod",
+			config:     &Config{KubernetesVirtualGPUs: true},
+			devicePods: pods,
+			want:       pods,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, newDeviceMappingStrategy(tt.config).pods(tt.devicePods))
+		})
+	}
+}
+
+func TestToDeviceToPods(t *testing.T) {
+	const gpuUUID = "GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5"
+
+	resp := &podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{
+			{
+				Name:      "pod-0",
+				Namespace: "default",
+				Containers: []*podresourcesapi.ContainerResources{
+					{
+						Name: "default",
+						Devices: []*podresourcesapi.ContainerDevices{
+							{ResourceName: nvidiaResourceName, DeviceIds: []string{gpuUUID + "::0"}},
+							{ResourceName: "example.com/fpga", DeviceIds: []string{"fpga-0"}},
+						},
+					},
+				},
+			},
+			{
+				Name:      "pod-1",
+				Namespace: "default",
+				Containers: []*podresourcesapi.ContainerResources{
+					{
+						Name: "default",
+						Devices: []*podresourcesapi.ContainerDevices{
+							{ResourceName: nvidiaResourceName, DeviceIds: []string{gpuUUID + "::1"}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	p := &PodMapper{Config: &Config{}}
+
+	assert.Equal(t, map[string][]PodInfo{
+		gpuUUID: {
+			{Name: "pod-0", Namespace: "default", Container: "default", VGPU: "0"},
+			{Name: "pod-1", Namespace: "default", Container: "default", VGPU: "1"},
+		},
+		gpuUUID + "::0": {
+			{Name: "pod-0", Namespace: "default", Container: "default", VGPU: "0"},
+		},
+		gpuUUID + "::1": {
+			{Name: "pod-1", Namespace: "default", Container: "default", VGPU: "1"},
+		},
+	}, p.toDeviceToPods(resp, SystemInfo{}))
+}
+
+func TestProcessPodMapper_WithVirtualGPUs(t *testing.T) {
+	testutils.RequireLinux(t)
+
+	gpuUUID := "b8ea3855-276c-c9cb-b366-c6fa655957c5"
+
+	tests := []struct {
+		name      string
+		virtual   bool
+		wantPods  []string
+		wantVGPUs []string
+	}{
+		{
+			name:      "exclusive",
+			virtual:   false,
+			wantPods:  []string{"gpu-pod-1"},
+			wantVGPUs: []string{""},
+		},
+		{
+			name:      "shared",
+			virtual:   true,
+			wantPods:  []string{"gpu-pod-0", "gpu-pod-1"},
+			wantVGPUs: []string{"0", "1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, cleanup := CreateTmpDir(t)
+			defer cleanup()
+
+			socketPath := tmpDir + "/kubelet.sock"
+			server := grpc.NewServer()
+			podresourcesapi.RegisterPodResourcesListerServer(server,
+				NewPodResourcesV1MockServer(nvidiaResourceName, []string{gpuUUID + "::0", gpuUUID + "::1"}))
+
+			cleanup = StartMockServer(t, server, socketPath)
+			defer cleanup()
+
+			podMapper, err := NewPodMapper(&Config{
+				KubernetesGPUIdType:       GPUUID,
+				PodResourcesKubeletSocket: socketPath,
+				KubernetesVirtualGPUs:     tt.virtual,
+			})
+			require.NoError(t, err)
+
+			counter := Counter{
+				FieldID:   155,
+				FieldName: "DCGM_FI_DEV_POWER_USAGE",
+				PromType:  "gauge",
+			}
+
+			metrics := MetricsByCounter{
+				counter: {
+					{
+						GPU:        "0",
+						GPUUUID:    gpuUUID,
+						Value:      "42",
+						Counter:    counter,
+						Attributes: map[string]string{},
+					},
+				},
+			}
+
+			err = podMapper.Process(metrics, SystemInfo{})
+			require.NoError(t, err)
+
+			require.Len(t, metrics[counter], len(tt.wantPods))
+			for i, metric := range metrics[counter] {
+				assert.Equal(t, tt.wantPods[i], metric.Attributes[podAttribute])
+				assert.Equal(t, tt.wantVGPUs[i], metric.Attributes[vgpuAttribute])
+				assert.Equal(t, "42", metric.Value)
+			}
+		})
+	}
+}
+
+func TestPodMapper_IsNvidiaResource(t *testing.T) {
+	gpuUUID := "GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5"
+
+	tests := []struct {
+		name         string
+		resourceName string
+		deviceIDs    []string
+		detect       bool
+		want         bool
+	}{
+		{
+			name:         "gpu",
+			resourceName: nvidiaResourceName,
+			deviceIDs:    []string{"0"},
+			want:         true,
+		},
+		{
+			name:         "renamed replicas",
+			resourceName: "nvidia.com/gpu.time-sliced",
+			deviceIDs:    []string{gpuUUID + "::0", gpuUUID + "::1"},
+			detect:       true,
+			want:         true,
+		},
+		{
+			name:         "renamed mig",
+			resourceName: "nvidia.com/a100-small",
+			deviceIDs:    []string{"MIG-b8ea3855-276c-c9cb-b366-c6fa655957c5"},
+			detect:       true,
+			want:         true,
+		},
+		{
+			name:         "renamed without detection",
+			resourceName: "nvidia.com/gpu.time-sliced",
+			deviceIDs:    []string{gpuUUID + "::0"},
+			want:         false,
+		},
+		{
+			name:         "other device IDs",
+			resourceName: "nvidia.com/nic",
+			deviceIDs:    []string{gpuUUID, "mlx5_0"},
+			detect:       true,
+			want:         false,
+		},
+		{
+			name:         "other vendor",
+			resourceName: "example.com/gpu",
+			deviceIDs:    []string{gpuUUID},
+			detect:       true,
+			want:         false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &PodMapper{Config: &Config{}, detectResources: tt.detect}
+			assert.Equal(t, tt.want, p.isNvidiaResource(tt.resourceName, tt.deviceIDs))
+		})
+	}
+}
@@ -0,0 +1,352 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	diagTestLabel  = "test"
+	diagLevelLabel = "level"
+
+	// DefaultDiagLevel is the quick diagnostic, dcgmi diag -r 1
+	DefaultDiagLevel = 1
+	MaxDiagLevel     = 4
+
+	diagGREngineActiveField = "DCGM_FI_PROF_GR_ENGINE_ACTIVE"
+)
+
+var dcgmRunDiagHook = runDCGMDiag
+
+var (
+	errDiagRunning = errors.New("a diagnostic is already running")
+	errNoIdleGPU   = errors.New("no GPU is idle")
+)
+
+var (
+	diagResultCounter = Counter{
+		FieldName: "DCGM_EXP_DIAG_RESULT",
+		PromType:  "gauge",
+		Help:      "Result of the test in the last diagnostic of the GPU: 0 on success, 10 on warning, 20 on failure.",
+	}
+	diagDurationCounter = Counter{
+		FieldName: "DCGM_EXP_DIAG_DURATION_SECONDS",
+		PromType:  "gauge",
+		Help:      "Duration of the last diagnostic of the GPU (in s).",
+	}
+	diagTimestampCounter = Counter{
+		FieldName: "DCGM_EXP_DIAG_TIMESTAMP_SECONDS",
+		PromType:  "gauge",
+		Help:      "Time at which the last diagnostic of the GPU finished (in s since the epoch).",
+	}
+)
+
+// diagGPUResult is the result of the last diagnostic of a GPU.
+type diagGPUResult struct {
+	device   Metric
+	level    int
+	tests    []dcgm.DiagResult
+	duration time.Duration
+	finished time.Time
+}
+
+// Diagnostics runs the DCGM diagnostics on the idle GPUs, periodically or on requests to /diag/run, and exports
+// the results of the tests. It receives the metrics of every collection as a sink to find the idle GPUs, and
+// exports the results as a collector.
+type Diagnostics struct {
+	mtx      sync.Mutex
+	level    int
+	interval time.Duration
+	// devices hold the device labels of the GPUs of the last collection, and busy whether they were busy
+	devices map[string]Metric
+	busy    map[string]bool
+	running bool
+	results map[string]*diagGPUResult
+	now     func() time.Time
+}
+
+func NewDiagnostics(config *Config) *Diagnostics {
+	return &Diagnostics{
+		level:    config.DiagLevel,
+		interval: time.Duration(config.DiagInterval) * time.Millisecond,
+		devices:  map[string]Metric{},
+		busy:     map[string]bool{},
+		results:  map[string]*diagGPUResult{},
+		now:      time.Now,
+	}
+}
+
+func (d *Diagnostics) Name() string {
+	return "diagnostics"
+}
+
+// Write keeps the GPUs of the collection, a GPU is idle when its utilization and the activity of its graphics
+// engine, or of the ones of its MIG instances, are zero.
+func (d *Diagnostics) Write(_ context.Context, metrics MetricsByCounter, _ time.Time) error {
+	devices := map[string]Metric{}
+	busy := map[string]bool{}
+
+	for counter, counterMetrics := range metrics {
+		switch counter.FieldName {
+		case jobUtilField, diagGREngineActiveField:
+		default:
+			continue
+		}
+
+		for _, metric := range counterMetrics {
+			value, err := strconv.ParseFloat(metric.Value, 64)
+			if err != nil {
+				continue
+			}
+
+			if _, exists := devices[metric.GPU]; !exists || metric.GPUInstanceID == "" {
+				devices[metric.GPU] = metric
+			}
+			busy[metric.GPU] = busy[metric.GPU] || value > 0
+		}
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.devices = devices
+	d.busy = busy
+
+	return nil
+}
+
+func (d *Diagnostics) Close() error {
+	return nil
+}
+
+func (d *Diagnostics) GetMetrics() (MetricsByCounter, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	metrics := MetricsByCounter{}
+
+	for _, result := range d.results {
+		level := strconv.Itoa(result.level)
+
+		for _, test := range result.tests {
+			var value int
+			switch test.Status {
+			case "pass":
+				value = healthResultPass
+			case "warn":
+				value = healthResultWarn
+			case "fail":
+				value = healthResultFail
+			default:
+				// The skipped tests and the tests that did not run have no result
+				continue
+			}
+
+			m := diagMetric(result.device, diagResultCounter, float64(value))
+			m.Labels = map[string]string{diagTestLabel: test.TestName, diagLevelLabel: level}
+			metrics[m.Counter] = append(metrics[m.Counter], m)
+		}
+
+		m := diagMetric(result.device, diagDurationCounter, result.duration.Seconds())
+		m.Labels = map[string]string{diagLevelLabel: level}
+		metrics[m.Counter] = append(metrics[m.Counter], m)
+
+		m = diagMetric(result.device, diagTimestampCounter, float64(result.finished.Unix()))
+		m.Labels = map[string]string{diagLevelLabel: level}
+		metrics[m.Counter] = append(metrics[m.Counter], m)
+	}
+
+	return metrics, nil
+}
+
+// diagMetric returns a result of a diagnostic, labeled with the device labels of the GPU.
+func diagMetric(device Metric, counter Counter, value float64) Metric {
+	m := device
+	m.Counter = counter
+	m.Value = fmt.Sprintf("%f", value)
+	setMigLabels(&m, nil)
+	m.Labels = map[string]string{}
+	m.Attributes = map[string]string{}
+	m.Exemplar = nil
+	m.ExemplarTimestamp = time.Time{}
+	return m
+}
+
+func (d *Diagnostics) Cleanup() {}
+
+// start marks a diagnostic as running and returns the idle GPUs to run it on.
+func (d *Diagnostics) start() ([]uint, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if d.running {
+		return nil, errDiagRunning
+	}
+
+	var gpus []uint
+	for gpu, busy := range d.busy {
+		if busy {
+			continue
+		}
+		id, err := strconv.ParseUint(gpu, 10, 32)
+		if err != nil {
+			continue
+		}
+		gpus = append(gpus, uint(id))
+	}
+	if len(gpus) == 0 {
+		return nil, errNoIdleGPU
+	}
+	sort.Slice(gpus, func(i, j int) bool { return gpus[i] < gpus[j] })
+
+	d.running = true
+
+	return gpus, nil
+}
+
+// run runs the diagnostic of the level on the GPUs, they are tested together so they share the duration.
+func (d *Diagnostics) run(level int, gpus []uint) {
+	logrus.Infof("Running the diagnostic of level %d on the GPUs %v", level, gpus)
+
+	started := d.now()
+	results, err := dcgmRunDiagHook(dcgm.DiagType(level), gpus)
+	finished := d.now()
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.running = false
+
+	if err != nil {
+		logrus.WithError(err).Warnf("Failed to run the diagnostic of level %d", level)
+		return
+	}
+
+	for _, test := range results.Software {
+		if test.Status == "fail" {
+			logrus.Warnf("The diagnostic found a software issue: %s; %s", test.TestName, test.ErrorMessage)
+		}
+	}
+
+	for _, gpuResult := range results.PerGpu {
+		gpu := strconv.FormatUint(uint64(gpuResult.GPU), 10)
+		device, exists := d.devices[gpu]
+		if !exists {
+			continue
+		}
+
+		var tests []dcgm.DiagResult
+		for _, test := range gpuResult.DiagResults {
+			if test.TestName == "" {
+				continue
+			}
+			if test.Status == "fail" {
+				logrus.Warnf("The %s test of the diagnostic failed on GPU %s: %s", test.TestName, gpu, test.ErrorMessage)
+			}
+			tests = append(tests, test)
+		}
+
+		d.results[gpu] = &diagGPUResult{
+			device:   device,
+			level:    level,
+			tests:    tests,
+			duration: finished.Sub(started),
+			finished: finished,
+		}
+	}
+
+	logrus.Infof("The diagnostic of level %d finished in %s", level, finished.Sub(started))
+}
+
+// Run runs the diagnostic of the configured level on the idle GPUs at every interval, until stopped.
+func (d *Diagnostics) Run(stop chan interface{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	t := time.NewTicker(d.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			gpus, err := d.start()
+			if err != nil {
+				logrus.Infof("Skipping the diagnostic; %s", err)
+				continue
+			}
+			d.run(d.level, gpus)
+		}
+	}
+}
+
+// RunDiag starts the diagnostic of the optional level parameter (the configured level by default) on the idle GPUs,
+// the results are exported once it finishes.
+func (d *Diagnostics) RunDiag(w http.ResponseWriter, r *http.Request) {
+	level := d.level
+	if param := r.FormValue("level"); param != "" {
+		var err error
+		level, err = strconv.Atoi(param)
+		if err != nil || level < DefaultDiagLevel || level > MaxDiagLevel {
+			http.Error(w, fmt.Sprintf("invalid level '%s'", param), http.StatusBadRequest)
+			return
+		}
+	}
+
+	gpus, err := d.start()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	go d.run(level, gpus)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func runDCGMDiag(level dcgm.DiagType, gpus []uint) (dcgm.DiagResults, error) {
+	group, err := dcgm.CreateGroup(fmt.Sprintf("diag-group-%d", rand.Uint64()))
+	if err != nil {
+		return dcgm.DiagResults{}, err
+	}
+	defer func() {
+		err := dcgm.DestroyGroup(group)
+		if err != nil {
+			logrus.WithError(err).Warn("Cannot destroy the diagnostic group.")
+		}
+	}()
+
+	for _, gpu := range gpus {
+		if err := dcgm.AddToGroup(group, gpu); err != nil {
+			return dcgm.DiagResults{}, err
+		}
+	}
+
+	return dcgm.RunDiag(level, group)
+}
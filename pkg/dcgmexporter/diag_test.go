@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func diagMetrics() MetricsByCounter {
+	utilCounter := Counter{FieldName: jobUtilField, PromType: "gauge"}
+	activeCounter := Counter{FieldName: diagGREngineActiveField, PromType: "gauge"}
+
+	metric := func(counter Counter, gpu, instance, value string) Metric {
+		return Metric{Counter: counter, Value: value, GPU: gpu, GPUUUID: "GPU-" + gpu, GPUInstanceID: instance}
+	}
+
+	return MetricsByCounter{
+		// GPU 0 is busy, GPU 1 is idle and a MIG instance of GPU 2 is busy
+		utilCounter: {metric(utilCounter, "0", "", "30"), metric(utilCounter, "1", "", "0")},
+		activeCounter: {
+			metric(activeCounter, "1", "", "0.000000"),
+			metric(activeCounter, "2", "1", "0.000000"),
+			metric(activeCounter, "2", "2", "0.500000"),
+		},
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	diagnostics := NewDiagnostics(&Config{DiagLevel: 2})
+	now := time.Unix(1000, 0)
+	diagnostics.now = func() time.Time {
+		now = now.Add(90 * time.Second)
+		return now
+	}
+
+	defer func() {
+		dcgmRunDiagHook = runDCGMDiag
+	}()
+	var tested []uint
+	dcgmRunDiagHook = func(level dcgm.DiagType, gpus []uint) (dcgm.DiagResults, error) {
+		assert.Equal(t, dcgm.DiagType(2), level)
+		tested = gpus
+		return dcgm.DiagResults{PerGpu: []dcgm.GpuResult{{
+			GPU: 1,
+			DiagResults: []dcgm.DiagResult{
+				{Status: "pass", TestName: "Memory"},
+				{Status: "fail", TestName: "PCIe", ErrorMessage: "replays"},
+				{Status: "skipped", TestName: "EUD"},
+				{Status: "notrun", TestName: ""},
+			},
+		}}}, nil
+	}
+
+	_, err := diagnostics.start()
+	assert.ErrorIs(t, err, errNoIdleGPU)
+
+	require.NoError(t, diagnostics.Write(context.Background(), diagMetrics(), now))
+
+	gpus, err := diagnostics.start()
+	require.NoError(t, err)
+	assert.Equal(t, []uint{1}, gpus)
+
+	_, err = diagnostics.start()
+	assert.ErrorIs(t, err, errDiagRunning)
+
+	diagnostics.run(diagnostics.level, gpus)
+	assert.Equal(t, []uint{1}, tested)
+
+	metrics, err := diagnostics.GetMetrics()
+	require.NoError(t, err)
+
+	results := map[string]string{}
+	for _, metric := range metrics[diagResultCounter] {
+		assert.Equal(t, "GPU-1", metric.GPUUUID)
+		assert.Equal(t, "2", metric.Labels[diagLevelLabel])
+		results[metric.Labels[diagTestLabel]] = metric.Value
+	}
+	assert.Equal(t, map[string]string{"Memory": "0.000000", "PCIe": "20.000000"}, results)
+
+	require.Len(t, metrics[diagDurationCounter], 1)
+	assert.Equal(t, "90.000000", metrics[diagDurationCounter][0].Value)
+	require.Len(t, metrics[diagTimestampCounter], 1)
+	assert.Equal(t, "1180.000000", metrics[diagTimestampCounter][0].Value)
+}
+
+func TestDiagnostics_RunDiag(t *testing.T) {
+	diagnostics := NewDiagnostics(&Config{DiagLevel: DefaultDiagLevel})
+
+	defer func() {
+		dcgmRunDiagHook = runDCGMDiag
+	}()
+	levels := make(chan dcgm.DiagType, 1)
+	release := make(chan struct{})
+	dcgmRunDiagHook = func(level dcgm.DiagType, _ []uint) (dcgm.DiagResults, error) {
+		levels <- level
+		<-release
+		return dcgm.DiagResults{}, errors.New("diagnostic failed")
+	}
+
+	assert.Equal(t, http.StatusConflict, jobStatsRequest(t, diagnostics.RunDiag, "/diag/run"))
+
+	require.NoError(t, diagnostics.Write(context.Background(), diagMetrics(), time.Now()))
+
+	assert.Equal(t, http.StatusBadRequest, jobStatsRequest(t, diagnostics.RunDiag, "/diag/run?level=5"))
+	assert.Equal(t, http.StatusAccepted, jobStatsRequest(t, diagnostics.RunDiag, "/diag/run?level=3"))
+	assert.Equal(t, dcgm.DiagType(3), <-levels)
+	assert.Equal(t, http.StatusConflict, jobStatsRequest(t, diagnostics.RunDiag, "/diag/run"))
+
+	// A failed diagnostic has no result
+	close(release)
+	assert.Eventually(t, func() bool {
+		diagnostics.mtx.Lock()
+		defer diagnostics.mtx.Unlock()
+		return !diagnostics.running
+	}, time.Second, 10*time.Millisecond)
+
+	metrics, err := diagnostics.GetMetrics()
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+const (
+	energyJoulesFieldName    = "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_JOULES_total"
+	dcgmExpAveragePowerWatts = "DCGM_EXP_AVERAGE_POWER_WATTS"
+)
+
+// energyCounters returns the counters with the energy consumption exported in J as a counter.
+func energyCounters(counters []Counter) []Counter {
+	result := make([]Counter, len(counters))
+	for i, counter := range counters {
+		result[i] = counter
+		if counter.FieldID != dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION || counter.PromType == "label" {
+			continue
+		}
+
+		result[i].FieldName = energyJoulesFieldName
+		result[i].PromType = "counter"
+		result[i].Help = "Total energy consumption since boot and across driver reloads (in J)."
+	}
+
+	return result
+}
+
+// energyJoules converts the energy consumption of the values from mJ to J.
+func energyJoules(values []dcgm.FieldValue_v1) []dcgm.FieldValue_v1 {
+	for i, value := range values {
+		if dcgm.Short(value.FieldId) != dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION {
+			continue
+		}
+
+		raw, ok := numericFieldValue(value)
+		if !ok {
+			continue
+		}
+
+		joules := doubleFieldValue(raw / 1000)
+		joules.Version = value.Version
+		joules.FieldId = value.FieldId
+		joules.Status = value.Status
+		joules.Ts = value.Ts
+		values[i] = joules
+	}
+
+	return values
+}
+
+// newAveragePower returns the derived metric of the average power of the devices between two collections, from the
+// increase of their energy consumption.
+func newAveragePower() (*DerivedMetrics, error) {
+	metric, err := newDerivedMetric(derivedMetricConfig{
+		Name: dcgmExpAveragePowerWatts,
+		Help: "Average power draw since the last collection (in W).",
+		Expr: "rate(" + energyJoulesFieldName + ")",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &DerivedMetrics{
+		metrics:  []derivedMetric{metric},
+		previous: map[string]derivedDevice{},
+		now:      time.Now,
+	}, nil
+}
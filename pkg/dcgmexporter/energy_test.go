@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnergyCounters(t *testing.T) {
+	counters := energyCounters(monotonicCounters([]Counter{
+		{dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION, "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", "counter", "Energy"},
+		{dcgm.DCGM_FI_DEV_POWER_USAGE, "DCGM_FI_DEV_POWER_USAGE", "gauge", "Power"},
+	}))
+
+	assert.Equal(t, []Counter{
+		{dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION, energyJoulesFieldName, "counter",
+			"Total energy consumption since boot and across driver reloads (in J)."},
+		{dcgm.DCGM_FI_DEV_POWER_USAGE, "DCGM_FI_DEV_POWER_USAGE", "gauge", "Power"},
+	}, counters)
+}
+
+func TestEnergyJoules(t *testing.T) {
+	// The energy counters only keep the energy consumption increasing
+	resets := newCounterResets(&Config{EnergyCounters: true})
+	gpu := dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU, EntityId: 0}
+
+	read := func(energy int64, replays int64) []string {
+		energyValue := int64FieldValue(energy)
+		energyValue.FieldId = uint(dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION)
+		energyValue.Ts = 42
+		replayValue := int64FieldValue(replays)
+		replayValue.FieldId = uint(dcgm.DCGM_FI_DEV_PCIE_REPLAY_COUNTER)
+
+		values := resets.adjust(MonitoringInfo{Entity: gpu, ParentId: PARENT_ID_IGNORED},
+			[]dcgm.FieldValue_v1{energyValue, replayValue})
+		values = energyJoules(values)
+		assert.Equal(t, uint(dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION), values[0].FieldId)
+		assert.Equal(t, int64(42), values[0].Ts)
+
+		result := make([]string, len(values))
+		for i, value := range values {
+			result[i] = ToString(value)
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"1500.500000", "10"}, read(1500500, 10))
+	assert.Equal(t, []string{"2000.000000", "12"}, read(2000000, 12))
+	// The driver was reloaded, the energy continues from its last value
+	assert.Equal(t, []string{"2100.000000", "1"}, read(100000, 1))
+
+	blank := int64FieldValue(dcgm.DCGM_FT_INT64_BLANK)
+	blank.FieldId = uint(dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION)
+	assert.Equal(t, SkipDCGMValue, ToString(energyJoules([]dcgm.FieldValue_v1{blank})[0]))
+}
+
+func TestAveragePower(t *testing.T) {
+	averagePower, err := newAveragePower()
+	require.NoError(t, err)
+
+	now := time.Unix(1000, 0)
+	averagePower.now = func() time.Time { return now }
+
+	energy := Counter{FieldID: dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION, FieldName: energyJoulesFieldName,
+		PromType: "counter"}
+	collect := func(joules string) []Metric {
+		metrics := MetricsByCounter{
+			energy: {{Counter: energy, Value: joules, GPU: "0", GPUUUID: "GPU-0"}},
+		}
+		require.NoError(t, averagePower.Process(metrics, SystemInfo{}))
+		return metrics[Counter{FieldName: dcgmExpAveragePowerWatts, PromType: "gauge",
+			Help: "Average power draw since the last collection (in W)."}]
+	}
+
+	// There is no average power in the first collection
+	assert.Empty(t, collect("1000.000000"))
+
+	now = now.Add(30 * time.Second)
+	power := collect("10000.000000")
+	require.Len(t, power, 1)
+	assert.Equal(t, "300.000000", power[0].Value)
+	assert.Equal(t, "GPU-0", power[0].GPUUUID)
+}
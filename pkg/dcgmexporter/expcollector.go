@@ -35,13 +35,13 @@ var expMetricsFormat = `
 # HELP {{ $counter.FieldName }} {{ $counter.Help }}
 # TYPE {{ $counter.FieldName }} {{ $counter.PromType }}
 {{- range $metric := $metrics }}
-{{ $counter.FieldName }}{gpu="{{ $metric.GPU }}",{{ $metric.UUID }}="{{ $metric.GPUUUID }}",pci_bus_id="{{ $metric.GPUPCIBusID }}",device="{{ $metric.GPUDevice }}",modelName="{{ $metric.GPUModelName }}"{{if $metric.MigProfile}},GPU_I_PROFILE="{{ $metric.MigProfile }}",GPU_I_ID="{{ $metric.GPUInstanceID }}"{{end}}{{if $metric.Hostname }},Hostname="{{ $metric.Hostname }}"{{end}}
+{{ $counter.FieldName }}{gpu="{{ $metric.GPU }}",{{ $metric.UUID }}="{{ $metric.GPUUUID }}",pci_bus_id="{{ $metric.GPUPCIBusID }}",device="{{ $metric.GPUDevice }}",modelName="{{ $metric.GPUModelName }}"{{if $metric.GPUInstanceID}},GPU_I_PROFILE="{{ $metric.MigProfile }}",GPU_I_ID="{{ $metric.GPUInstanceID }}"{{end}}{{if $metric.ComputeInstanceID}},GPU_CI_ID="{{ $metric.ComputeInstanceID }}"{{end}}{{if $metric.Hostname }},Hostname="{{ $metric.Hostname }}"{{end}}
 
 {{- range $k, $v := $metric.Labels -}}
-	,{{ $k }}="{{ $v }}"
+	,{{ $k }}="{{ escape $v }}"
 {{- end -}}
 {{- range $k, $v := $metric.Attributes -}}
-	,{{ $k }}="{{ $v }}"
+	,{{ $k }}="{{ escape $v }}"
 {{- end -}}
 
 } {{ $metric.Value -}}
@@ -55,7 +55,7 @@ type Collector interface {
 }
 
 var getExpMetricTemplate = sync.OnceValue(func() *template.Template {
-	return template.Must(template.New("expMetrics").Parse(expMetricsFormat))
+	return newMetricsTemplate("expMetrics", expMetricsFormat)
 })
 
 func encodeExpMetrics(w io.Writer, metrics MetricsByCounter) error {
@@ -180,13 +180,7 @@ func (c *expCollector) createMetric(labels map[string]string, mi MonitoringInfo,
 		Labels:     labels,
 		Attributes: map[string]string{},
 	}
-	if mi.InstanceInfo != nil {
-		m.MigProfile = mi.InstanceInfo.ProfileName
-		m.GPUInstanceID = fmt.Sprintf("%d", mi.InstanceInfo.Info.NvmlInstanceId)
-	} else {
-		m.MigProfile = ""
-		m.GPUInstanceID = ""
-	}
+	setMigLabels(&m, mi.InstanceInfo)
 	return m
 }
 
@@ -220,6 +214,7 @@ func (c *expCollector) Cleanup() {
 	for _, cleanup := range c.cleanups {
 		cleanup()
 	}
+	closeTransformations(c.transformations)
 }
 
 // newExpCollector is a constructor for the expCollector
@@ -239,7 +234,10 @@ func newExpCollector(
 
 	labelDeviceFields := NewDeviceFields(labelsCounters, dcgm.FE_GPU)
 
-	transformations := getTransformations(config)
+	transformations, err := getTransformations(config)
+	if err != nil {
+		logrus.Fatal("Failed to load metric transformations: ", err)
+	}
 
 	collector := expCollector{
 		hostname:            hostname,
@@ -256,11 +254,9 @@ func newExpCollector(
 
 	collector.sysInfo = fieldEntityGroupTypeSystemInfo.SystemInfo
 
-	var err error
-
 	collector.cleanups, err = SetupDcgmFieldsWatch(collector.counterDeviceFields,
 		collector.sysInfo,
-		int64(config.CollectInterval)*1000)
+		newFieldWatch(config, time.Duration(config.CollectInterval)*time.Millisecond))
 	if err != nil {
 		logrus.Fatal("Failed to watch metrics: ", err)
 	}
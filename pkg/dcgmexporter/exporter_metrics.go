@@ -21,6 +21,26 @@ import "fmt"
 const (
 	dcgmExpClockEventsCount = "DCGM_EXP_CLOCK_EVENTS_COUNT"
 	dcgmExpXIDErrorsCount   = "DCGM_EXP_XID_ERRORS_COUNT"
+
+	dcgmExpFabricManagerStatus = "DCGM_EXP_FABRIC_MANAGER_STATUS"
+
+	dcgmExpMIGProfileInfo = "DCGM_EXP_MIG_PROFILE_INFO"
+
+	dcgmExpPCIeLinkDegraded = "DCGM_EXP_PCIE_LINK_DEGRADED"
+
+	dcgmExpPowerLimitChangesTotal = "DCGM_EXP_POWER_LIMIT_CHANGES_TOTAL"
+
+	dcgmExpGPUInfo    = "DCGM_EXP_GPU_INFO"
+	dcgmExpGPUPCIInfo = "DCGM_EXP_GPU_PCI_INFO"
+
+	dcgmExpVGPUUtilization   = "DCGM_EXP_VGPU_UTILIZATION"
+	dcgmExpVGPUFBUsed        = "DCGM_EXP_VGPU_FB_USED"
+	dcgmExpVGPULicenseStatus = "DCGM_EXP_VGPU_LICENSE_STATUS"
+
+	dcgmHealthStatus         = "DCGM_HEALTH_STATUS"
+	dcgmHealthIncidentsTotal = "DCGM_HEALTH_INCIDENTS_TOTAL"
+
+	dcgmExporterGPUAllocated = "DCGM_EXPORTER_GPU_ALLOCATED"
 )
 
 type ExporterCounter uint16
@@ -29,6 +49,23 @@ const (
 	DCGMFIUnknown        ExporterCounter = 0
 	DCGMXIDErrorsCount   ExporterCounter = iota + 9000
 	DCGMClockEventsCount ExporterCounter = iota + 9000
+	DCGMHealthStatus     ExporterCounter = iota + 9000
+	DCGMHealthIncidents  ExporterCounter = iota + 9000
+
+	DCGMFabricManagerStatus ExporterCounter = iota + 9000
+
+	DCGMVGPUUtilization   ExporterCounter = iota + 9000
+	DCGMVGPUFBUsed        ExporterCounter = iota + 9000
+	DCGMVGPULicenseStatus ExporterCounter = iota + 9000
+
+	DCGMMIGProfileInfo ExporterCounter = iota + 9000
+
+	DCGMPCIeLinkDegraded ExporterCounter = iota + 9000
+
+	DCGMPowerLimitChanges ExporterCounter = iota + 9000
+
+	DCGMGPUInfo    ExporterCounter = iota + 9000
+	DCGMGPUPCIInfo ExporterCounter = iota + 9000
 )
 
 // String method to convert the enum value to a string
@@ -38,6 +75,28 @@ func (enm ExporterCounter) String() string {
 		return dcgmExpXIDErrorsCount
 	case DCGMClockEventsCount:
 		return dcgmExpClockEventsCount
+	case DCGMHealthStatus:
+		return dcgmHealthStatus
+	case DCGMHealthIncidents:
+		return dcgmHealthIncidentsTotal
+	case DCGMFabricManagerStatus:
+		return dcgmExpFabricManagerStatus
+	case DCGMVGPUUtilization:
+		return dcgmExpVGPUUtilization
+	case DCGMVGPUFBUsed:
+		return dcgmExpVGPUFBUsed
+	case DCGMVGPULicenseStatus:
+		return dcgmExpVGPULicenseStatus
+	case DCGMMIGProfileInfo:
+		return dcgmExpMIGProfileInfo
+	case DCGMPCIeLinkDegraded:
+		return dcgmExpPCIeLinkDegraded
+	case DCGMPowerLimitChanges:
+		return dcgmExpPowerLimitChangesTotal
+	case DCGMGPUInfo:
+		return dcgmExpGPUInfo
+	case DCGMGPUPCIInfo:
+		return dcgmExpGPUPCIInfo
 	default:
 		return "DCGM_FI_UNKNOWN"
 	}
@@ -47,7 +106,25 @@ func (enm ExporterCounter) String() string {
 var DCGMFields = map[string]ExporterCounter{
 	DCGMXIDErrorsCount.String():   DCGMXIDErrorsCount,
 	DCGMClockEventsCount.String(): DCGMClockEventsCount,
-	DCGMFIUnknown.String():        DCGMFIUnknown,
+	DCGMHealthStatus.String():     DCGMHealthStatus,
+	DCGMHealthIncidents.String():  DCGMHealthIncidents,
+
+	DCGMFabricManagerStatus.String(): DCGMFabricManagerStatus,
+
+	DCGMVGPUUtilization.String():   DCGMVGPUUtilization,
+	DCGMVGPUFBUsed.String():        DCGMVGPUFBUsed,
+	DCGMVGPULicenseStatus.String(): DCGMVGPULicenseStatus,
+
+	DCGMMIGProfileInfo.String(): DCGMMIGProfileInfo,
+
+	DCGMPCIeLinkDegraded.String(): DCGMPCIeLinkDegraded,
+
+	DCGMPowerLimitChanges.String(): DCGMPowerLimitChanges,
+
+	DCGMGPUInfo.String():    DCGMGPUInfo,
+	DCGMGPUPCIInfo.String(): DCGMGPUPCIInfo,
+
+	DCGMFIUnknown.String(): DCGMFIUnknown,
 }
 
 func IdentifyMetricType(s string) (ExporterCounter, error) {
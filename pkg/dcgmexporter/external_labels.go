@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	sysOS "os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// externalLabelEnvPrefix prefixes the environment variables of the external labels, e.g. set from the downward API
+const externalLabelEnvPrefix = "DCGM_EXPORTER_LABEL_"
+
+// externalLabels adds static labels, e.g. the cluster or the region, to every metric. The labels of a metric are
+// kept when they have the name of an external label.
+type externalLabels struct {
+	labels map[string]string
+}
+
+// newExternalLabels returns the labels of the DCGM_EXPORTER_LABEL_ environment variables, of the files of the
+// external labels directory and of the external labels option, which take precedence in that order.
+func newExternalLabels(c *Config) (*externalLabels, error) {
+	labels := envExternalLabels(sysOS.Environ())
+
+	if c.ExternalLabelsDir != "" {
+		dirLabels, err := readExternalLabelsDir(c.ExternalLabelsDir)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(labels, dirLabels)
+	}
+
+	optionLabels, err := parseKeyValues(c.ExternalLabels)
+	if err != nil {
+		return nil, fmt.Errorf("invalid external labels; err: %w", err)
+	}
+	maps.Copy(labels, optionLabels)
+
+	// The shard label identifies the exporter among the exporters sharing the node
+	if label := newShard(c).label(); label != "" {
+		labels[shardLabel] = label
+	}
+
+	// The device labels are rendered apart from the attributes, they cannot be replaced
+	reserved := append(deviceLabels(Metric{UUID: "UUID"}), "uuid", "nvswitch", "nvlink", "cpu", "cpucore")
+	for name := range labels {
+		if !labelNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("invalid external label name '%s'", name)
+		}
+		if slices.Contains(reserved, name) {
+			return nil, fmt.Errorf("external label '%s' is a device label", name)
+		}
+	}
+
+	return &externalLabels{labels: labels}, nil
+}
+
+// envExternalLabels returns the labels of the DCGM_EXPORTER_LABEL_<NAME> environment variables, named after the
+// lowercased suffix of the variables.
+func envExternalLabels(environ []string) map[string]string {
+	labels := map[string]string{}
+	for _, env := range environ {
+		name, value, _ := strings.Cut(env, "=")
+		if suffix, ok := strings.CutPrefix(name, externalLabelEnvPrefix); ok && suffix != "" {
+			labels[strings.ToLower(suffix)] = value
+		}
+	}
+	return labels
+}
+
+// readExternalLabelsDir returns a label for every file of the directory, named after the file, whose value is the
+// content of the file without its surrounding spaces. It fits the items of a downward API or ConfigMap volume, the
+// hidden files and the directories the kubelet updates the volumes with are skipped.
+func readExternalLabelsDir(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read external labels directory '%s'; err: %w", dir, err)
+	}
+
+	labels := map[string]string{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+			continue
+		}
+
+		value, err := readExternalLabelFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		labels[entry.Name()] = value
+	}
+
+	return labels, nil
+}
+
+func readExternalLabelFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("could not open external label file '%s'; err: %w", path, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("could not read external label file '%s'; err: %w", path, err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (e *externalLabels) Name() string {
+	return "externalLabels"
+}
+
+// Process adds the external labels to the attributes of the GPU metrics.
+func (e *externalLabels) Process(metrics MetricsByCounter, _ SystemInfo) error {
+	for _, counterMetrics := range metrics {
+		for i := range counterMetrics {
+			if counterMetrics[i].Attributes == nil {
+				counterMetrics[i].Attributes = map[string]string{}
+			}
+			for name, value := range e.labels {
+				if _, exists := counterMetrics[i].Attributes[name]; !exists {
+					counterMetrics[i].Attributes[name] = value
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// addLabels adds the external labels to the labels of the metrics of the switches, the links and the CPUs, whose
+// formats have no attributes. The label maps are replaced, not modified, as they are shared between the metrics of
+// an entity.
+func (e *externalLabels) addLabels(metrics MetricsByCounter) {
+	for _, counterMetrics := range metrics {
+		for i := range counterMetrics {
+			labels := maps.Clone(e.labels)
+			maps.Copy(labels, counterMetrics[i].Labels)
+			counterMetrics[i].Labels = labels
+		}
+	}
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	sysOS "os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExternalLabels(t *testing.T) {
+	labels, err := newExternalLabels(&Config{ExternalLabels: []string{"cluster=prod", " region = us-east-1 "}})
+	require.NoError(t, err)
+
+	counter := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+	shared := map[string]string{"DCGM_FI_DRIVER_VERSION": "550.54.15"}
+	metrics := MetricsByCounter{
+		counter: {
+			{GPU: "0", Labels: shared, Attributes: map[string]string{"cluster": "dev"}},
+			{GPU: "1", Labels: shared},
+		},
+	}
+
+	// The GPU metrics get the labels as attributes, the attributes of the metrics are kept
+	require.NoError(t, labels.Process(metrics, SystemInfo{}))
+	assert.Equal(t, map[string]string{"cluster": "dev", "region": "us-east-1"}, metrics[counter][0].Attributes)
+	assert.Equal(t, map[string]string{"cluster": "prod", "region": "us-east-1"}, metrics[counter][1].Attributes)
+
+	// The other metrics get them as labels, without modifying the labels shared by the metrics
+	labels.addLabels(metrics)
+	assert.Equal(t, map[string]string{
+		"DCGM_FI_DRIVER_VERSION": "550.54.15",
+		"cluster":                "prod",
+		"region":                 "us-east-1",
+	}, metrics[counter][0].Labels)
+	assert.Equal(t, map[string]string{"DCGM_FI_DRIVER_VERSION": "550.54.15"}, shared)
+
+	for _, invalid := range [][]string{{"cluster"}, {"1cluster=prod"}, {"Hostname=node"}, {"gpu=0"}} {
+		_, err := newExternalLabels(&Config{ExternalLabels: invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestExternalLabels_DownwardAPI(t *testing.T) {
+	// The files of a downward API volume are links to a hidden directory updated by the kubelet
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "..data"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "..data", "zone"), []byte("us-east-1a"), 0o644))
+	require.NoError(t, sysOS.Symlink(filepath.Join("..data", "zone"), filepath.Join(dir, "zone")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cluster"), []byte("staging\n"), 0o644))
+
+	t.Setenv("DCGM_EXPORTER_LABEL_CLUSTER", "dev")
+	t.Setenv("DCGM_EXPORTER_LABEL_EXPORTER_NAMESPACE", "gpu-operator")
+
+	labels, err := newExternalLabels(&Config{ExternalLabelsDir: dir})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"cluster":            "staging",
+		"exporter_namespace": "gpu-operator",
+		"zone":               "us-east-1a",
+	}, labels.labels)
+
+	// The external labels option takes precedence
+	labels, err = newExternalLabels(&Config{ExternalLabelsDir: dir, ExternalLabels: []string{"cluster=prod"}})
+	require.NoError(t, err)
+	assert.Equal(t, "prod", labels.labels["cluster"])
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "topology.kubernetes.io-zone"), []byte("a"), 0o644))
+	_, err = newExternalLabels(&Config{ExternalLabelsDir: dir})
+	assert.Error(t, err)
+
+	_, err = newExternalLabels(&Config{ExternalLabelsDir: filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+}
+
+func TestGetHostname(t *testing.T) {
+	t.Setenv("NODE_NAME", "node")
+
+	hostname, err := GetHostname(&Config{})
+	require.NoError(t, err)
+	assert.Equal(t, "node", hostname)
+
+	hostname, err = GetHostname(&Config{Hostname: "override"})
+	require.NoError(t, err)
+	assert.Equal(t, "override", hostname)
+
+	hostname, err = GetHostname(&Config{Hostname: "override", NoHostname: true})
+	require.NoError(t, err)
+	assert.Empty(t, hostname)
+}
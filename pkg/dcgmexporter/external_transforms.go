@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// transformHookTimeout bounds the time spent running a transform hook on every collection.
+var transformHookTimeout = 5 * time.Second
+
+var transformHookCommandHook = func(ctx context.Context, path string, stdin []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(stdin)
+	return cmd.Output()
+}
+
+// transformHookMetric is a sample exchanged with the transform hooks.
+type transformHookMetric struct {
+	Field             string            `json:"field"`
+	Value             string            `json:"value"`
+	GPU               string            `json:"gpu,omitempty"`
+	UUID              string            `json:"uuid,omitempty"`
+	Device            string            `json:"device,omitempty"`
+	ModelName         string            `json:"modelName,omitempty"`
+	PCIBusID          string            `json:"pciBusId,omitempty"`
+	MigProfile        string            `json:"migProfile,omitempty"`
+	GPUInstanceID     string            `json:"gpuInstanceId,omitempty"`
+	ComputeInstanceID string            `json:"computeInstanceId,omitempty"`
+	Hostname          string            `json:"hostname,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Attributes        map[string]string `json:"attributes"`
+}
+
+// transformHookMessage is the document written to the stdin of the transform hooks, and read from their stdout.
+type transformHookMessage struct {
+	Metrics []transformHookMetric `json:"metrics"`
+}
+
+// transformHook runs an executable on every collection to set the attributes of the metrics. The hook reads the
+// metrics as JSON on its stdin and writes them back on its stdout, in the same order, with their new attributes; the
+// other fields of the metrics it writes are ignored.
+type transformHook struct {
+	path string
+}
+
+func newTransformHook(path string) (*transformHook, error) {
+	if _, err := exec.LookPath(path); err != nil {
+		return nil, fmt.Errorf("invalid transform hook '%s'; err: %w", path, err)
+	}
+
+	logrus.Infof("Transform hook %q is enabled", path)
+
+	return &transformHook{path: path}, nil
+}
+
+func (h *transformHook) Name() string {
+	return fmt.Sprintf("transformHook(%s)", h.path)
+}
+
+func (h *transformHook) Process(metrics MetricsByCounter, _ SystemInfo) error {
+	counters := make([]Counter, 0, len(metrics))
+	request := transformHookMessage{Metrics: []transformHookMetric{}}
+	for counter, values := range metrics {
+		counters = append(counters, counter)
+		for _, val := range values {
+			request.Metrics = append(request.Metrics, transformHookMetric{
+				Field:             counter.FieldName,
+				Value:             val.Value,
+				GPU:               val.GPU,
+				UUID:              val.GPUUUID,
+				Device:            val.GPUDevice,
+				ModelName:         val.GPUModelName,
+				PCIBusID:          val.GPUPCIBusID,
+				MigProfile:        val.MigProfile,
+				GPUInstanceID:     val.GPUInstanceID,
+				ComputeInstanceID: val.ComputeInstanceID,
+				Hostname:          val.Hostname,
+				Labels:            val.Labels,
+				Attributes:        val.Attributes,
+			})
+		}
+	}
+
+	response, err := h.run(request)
+	if err != nil {
+		// Keep exporting the metrics without the attributes of the hook
+		logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(),
+			"Unable to run the transform hook %q. Ignoring.", h.path)
+		return nil
+	}
+
+	i := 0
+	for _, counter := range counters {
+		for j := range metrics[counter] {
+			attributes := response.Metrics[i].Attributes
+			if attributes == nil {
+				attributes = map[string]string{}
+			}
+			metrics[counter][j].Attributes = attributes
+			i++
+		}
+	}
+
+	return nil
+}
+
+func (h *transformHook) run(request transformHookMessage) (transformHookMessage, error) {
+	stdin, err := json.Marshal(request)
+	if err != nil {
+		return transformHookMessage{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), transformHookTimeout)
+	defer cancel()
+
+	stdout, err := transformHookCommandHook(ctx, h.path, stdin)
+	if err != nil {
+		return transformHookMessage{}, err
+	}
+
+	var response transformHookMessage
+	if err := json.Unmarshal(stdout, &response); err != nil {
+		return transformHookMessage{}, fmt.Errorf("invalid output; err: %w", err)
+	}
+	if len(response.Metrics) != len(request.Metrics) {
+		return transformHookMessage{}, fmt.Errorf("the hook wrote %d metrics instead of %d",
+			len(response.Metrics), len(request.Metrics))
+	}
+
+	return response, nil
+}
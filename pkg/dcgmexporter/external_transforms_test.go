@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	sysOS "os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransformHook_Process(t *testing.T) {
+	defer func(hook func(context.Context, string, []byte) ([]byte, error)) {
+		transformHookCommandHook = hook
+	}(transformHookCommandHook)
+
+	util := Counter{FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"}
+	metrics := MetricsByCounter{
+		util: {
+			{Counter: util, Value: "42", GPU: "0", GPUUUID: "GPU-0", Attributes: map[string]string{"pod": "trainer"}},
+			{Counter: util, Value: "7", GPU: "1", GPUUUID: "GPU-1", Attributes: map[string]string{}},
+		},
+	}
+
+	var request transformHookMessage
+	transformHookCommandHook = func(_ context.Context, path string, stdin []byte) ([]byte, error) {
+		assert.Equal(t, "/usr/bin/cmdb-labels", path)
+		require.NoError(t, json.Unmarshal(stdin, &request))
+
+		response := transformHookMessage{}
+		for _, metric := range request.Metrics {
+			attributes := maps.Clone(metric.Attributes)
+			attributes["team"] = "team-" + metric.GPU
+			response.Metrics = append(response.Metrics, transformHookMetric{Attributes: attributes})
+		}
+		return json.Marshal(response)
+	}
+
+	hook := &transformHook{path: "/usr/bin/cmdb-labels"}
+	require.NoError(t, hook.Process(metrics, SystemInfo{}))
+
+	assert.Equal(t, []transformHookMetric{
+		{Field: "DCGM_FI_DEV_GPU_UTIL", Value: "42", GPU: "0", UUID: "GPU-0", Attributes: map[string]string{"pod": "trainer"}},
+		{Field: "DCGM_FI_DEV_GPU_UTIL", Value: "7", GPU: "1", UUID: "GPU-1", Attributes: map[string]string{}},
+	}, request.Metrics)
+	assert.Equal(t, map[string]string{"pod": "trainer", "team": "team-0"}, metrics[util][0].Attributes)
+	assert.Equal(t, map[string]string{"team": "team-1"}, metrics[util][1].Attributes)
+
+	// The metrics are kept unchanged when the hook fails or writes an invalid output
+	for _, output := range []struct {
+		stdout []byte
+		err    error
+	}{
+		{err: errors.New("exit status 1")},
+		{stdout: []byte("not json")},
+		{stdout: []byte(`{"metrics":[{"attributes":{}}]}`)},
+	} {
+		transformHookCommandHook = func(context.Context, string, []byte) ([]byte, error) {
+			return output.stdout, output.err
+		}
+		require.NoError(t, hook.Process(metrics, SystemInfo{}))
+		assert.Equal(t, map[string]string{"pod": "trainer", "team": "team-0"}, metrics[util][0].Attributes)
+	}
+}
+
+func TestTransformHook_Exec(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	script := "#!/bin/sh\ncat > /dev/null\necho '{\"metrics\":[{\"attributes\":{\"site\":\"a\"}}]}'\n"
+	require.NoError(t, sysOS.WriteFile(path, []byte(script), 0o755))
+
+	hook, err := newTransformHook(path)
+	require.NoError(t, err)
+
+	util := Counter{FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"}
+	metrics := MetricsByCounter{util: {{Counter: util, Value: "42", GPU: "0"}}}
+	require.NoError(t, hook.Process(metrics, SystemInfo{}))
+	assert.Equal(t, map[string]string{"site": "a"}, metrics[util][0].Attributes)
+
+	_, err = newTransformHook(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestLoadTransformPlugin_Invalid(t *testing.T) {
+	_, err := loadTransformPlugin(filepath.Join(t.TempDir(), "missing.so"), &Config{})
+	assert.ErrorContains(t, err, "failed to open the transform plugin")
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	dcgmExporterFabricLeader = "DCGM_EXPORTER_FABRIC_LEADER"
+	fabricLeaseNamePrefix    = "dcgm-exporter-fabric-"
+)
+
+var (
+	// serviceAccountNamespaceFile holds the namespace of the pod of the exporter
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+	nvmlGetFabricClusterUUIDHook = nvmlprovider.GetFabricClusterUUID
+
+	fabricLeaseDuration = 15 * time.Second
+	fabricRenewDeadline = 10 * time.Second
+	fabricRetryPeriod   = 2 * time.Second
+)
+
+// FabricLeader elects, with a Kubernetes Lease, the exporter publishing the metrics of the entities shared by the
+// exporters of an NVSwitch domain, the switches and their links, so that the exporters of a chassis don't duplicate
+// their series. The other exporters keep collecting the GPUs.
+type FabricLeader struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	identity  string
+	leading   atomic.Bool
+}
+
+// NewFabricLeader returns the election of the Lease of the configuration, <NAMESPACE>:<NAME>. The Lease is named
+// after the NVLink domain of the GPUs in the namespace of the exporter by default, or after the node when the GPUs
+// are not registered in a fabric.
+func NewFabricLeader(c *Config) (*FabricLeader, error) {
+	client, err := getKubeClientHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client for the fabric leader election; err: %w", err)
+	}
+
+	namespace, name, err := fabricLease(c)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	return &FabricLeader{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+		// The exporters of the host network share the hostname of the node
+		identity: hostname + "_" + uuid.NewString(),
+	}, nil
+}
+
+func fabricLease(c *Config) (string, string, error) {
+	if c.FabricLease != "" {
+		namespace, name, found := strings.Cut(c.FabricLease, ":")
+		if !found || namespace == "" || name == "" {
+			return "", "", fmt.Errorf("malformed fabric lease '%s'; expected <NAMESPACE>:<NAME>", c.FabricLease)
+		}
+		return namespace, name, nil
+	}
+
+	file, err := os.Open(serviceAccountNamespaceFile)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read the namespace of the exporter; err: %w", err)
+	}
+	defer file.Close()
+
+	namespace, err := io.ReadAll(file)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read the namespace of the exporter; err: %w", err)
+	}
+
+	// The exporters of the nodes of a multi-node NVLink domain share the cluster UUID of their fabric
+	domain, err := nvmlGetFabricClusterUUIDHook()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read the NVLink domain of the GPUs; err: %w", err)
+	}
+
+	if domain == "" {
+		// The node is named by NODE_NAME, even without hostname
+		domain, err = GetHostname(&Config{})
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	return strings.TrimSpace(string(namespace)), fabricLeaseNamePrefix + strings.ToLower(domain), nil
+}
+
+// Leading returns whether the exporter publishes the metrics of the NVSwitch domain.
+func (l *FabricLeader) Leading() bool {
+	return l.leading.Load()
+}
+
+func (l *FabricLeader) setLeading(leading bool) {
+	l.leading.Store(leading)
+
+	value := 0.0
+	if leading {
+		value = 1
+	}
+	selfMetrics.SetGauge(dcgmExporterFabricLeader,
+		"Whether the exporter publishes the metrics of the NVSwitch domain, as the leader of its Lease.",
+		map[string]string{"lease": l.namespace + "/" + l.name}, value)
+}
+
+// Run takes part in the election until the exporter is stopped, the Lease is released on stop so that another
+// exporter takes over without waiting for its expiry.
+func (l *FabricLeader) Run(stop chan interface{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	l.setLeading(false)
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: l.namespace, Name: l.name},
+			Client:     l.client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: l.identity},
+		},
+		LeaseDuration:   fabricLeaseDuration,
+		RenewDeadline:   fabricRenewDeadline,
+		RetryPeriod:     fabricRetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            l.name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				logrus.Infof("Publishing the metrics of the NVSwitch domain, as the leader of the Lease '%s/%s'",
+					l.namespace, l.name)
+				l.setLeading(true)
+			},
+			OnStoppedLeading: func() {
+				logrus.Infof("Not publishing the metrics of the NVSwitch domain anymore, the Lease '%s/%s' is lost",
+					l.namespace, l.name)
+				l.setLeading(false)
+			},
+			OnNewLeader: func(identity string) {
+				if identity != l.identity {
+					logrus.Infof("The metrics of the NVSwitch domain are published by '%s'", identity)
+				}
+			},
+		},
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to start the fabric leader election.")
+		return
+	}
+
+	// The elector returns when the Lease is lost, the exporter runs for the Lease again
+	for ctx.Err() == nil {
+		elector.Run(ctx)
+	}
+}
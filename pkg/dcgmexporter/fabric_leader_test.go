@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	sysOS "os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+func TestFabricLease(t *testing.T) {
+	namespace, name, err := fabricLease(&Config{FabricLease: "gpu-operator:rack-12"})
+	require.NoError(t, err)
+	assert.Equal(t, "gpu-operator", namespace)
+	assert.Equal(t, "rack-12", name)
+
+	for _, lease := range []string{"rack-12", ":rack-12", "gpu-operator:"} {
+		_, _, err = fabricLease(&Config{FabricLease: lease})
+		assert.ErrorContains(t, err, "malformed fabric lease", lease)
+	}
+
+	// The default Lease is shared by the nodes of the NVLink domain, or named after the node without fabric
+	serviceAccountNamespaceFile = filepath.Join(t.TempDir(), "namespace")
+	defer func() {
+		serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+		nvmlGetFabricClusterUUIDHook = nvmlprovider.GetFabricClusterUUID
+	}()
+	require.NoError(t, sysOS.WriteFile(serviceAccountNamespaceFile, []byte("gpu-operator\n"), 0o600))
+	t.Setenv("NODE_NAME", "Node-1")
+
+	nvmlGetFabricClusterUUIDHook = func() (string, error) {
+		return "7c5a2f4e-1b3d-4e8f-9a6b-2d1c0e9f8a7b", nil
+	}
+	namespace, name, err = fabricLease(&Config{})
+	require.NoError(t, err)
+	assert.Equal(t, "gpu-operator", namespace)
+	assert.Equal(t, "dcgm-exporter-fabric-7c5a2f4e-1b3d-4e8f-9a6b-2d1c0e9f8a7b", name)
+
+	nvmlGetFabricClusterUUIDHook = func() (string, error) {
+		return "", nil
+	}
+	_, name, err = fabricLease(&Config{})
+	require.NoError(t, err)
+	assert.Equal(t, "dcgm-exporter-fabric-node-1", name)
+}
+
+func TestFabricLeader(t *testing.T) {
+	fabricLeaseDuration, fabricRenewDeadline, fabricRetryPeriod = time.Second, 500*time.Millisecond, 50*time.Millisecond
+	defer func() {
+		fabricLeaseDuration, fabricRenewDeadline, fabricRetryPeriod = 15*time.Second, 10*time.Second, 2*time.Second
+	}()
+
+	client := fake.NewSimpleClientset()
+	getKubeClientHook = func() (kubernetes.Interface, error) {
+		return client, nil
+	}
+	defer func() {
+		getKubeClientHook = getKubeClient
+	}()
+
+	c := &Config{FabricLeaderElection: true, FabricLease: "gpu-operator:rack-12"}
+	run := func() (*FabricLeader, chan interface{}, *sync.WaitGroup) {
+		leader, err := NewFabricLeader(c)
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		stop := make(chan interface{})
+		wg.Add(1)
+		go leader.Run(stop, &wg)
+
+		return leader, stop, &wg
+	}
+
+	first, stopFirst, wgFirst := run()
+	require.Eventually(t, first.Leading, 5*time.Second, 10*time.Millisecond)
+
+	value, _ := selfMetrics.Value(dcgmExporterFabricLeader, map[string]string{"lease": "gpu-operator/rack-12"})
+	assert.Equal(t, float64(1), value)
+
+	lease, err := client.CoordinationV1().Leases("gpu-operator").Get(context.Background(), "rack-12",
+		metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, first.identity, *lease.Spec.HolderIdentity)
+
+	// A single exporter of the domain publishes the switches
+	second, stopSecond, wgSecond := run()
+	assert.Never(t, second.Leading, 300*time.Millisecond, 10*time.Millisecond)
+
+	pipeline := &MetricsPipeline{}
+	assert.True(t, pipeline.publishesFabric())
+	pipeline.SetFabricLeader(second)
+	assert.False(t, pipeline.publishesFabric())
+
+	// The Lease is released on stop, the other exporter takes over
+	close(stopFirst)
+	wgFirst.Wait()
+	assert.False(t, first.Leading())
+	require.Eventually(t, second.Leading, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, pipeline.publishesFabric())
+
+	close(stopSecond)
+	wgSecond.Wait()
+}
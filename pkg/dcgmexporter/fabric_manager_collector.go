@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+const fabricManagerErrorLabel = "error"
+
+// Status of the registration of the GPUs with the fabric manager, matching dcgmFabricManagerStatus_t of DCGM
+const (
+	fabricManagerStatusNotSupported = 0
+	fabricManagerStatusNotStarted   = 1
+	fabricManagerStatusInProgress   = 2
+	fabricManagerStatusSuccess      = 3
+	fabricManagerStatusFailure      = 4
+)
+
+var nvmlGetGPUFabricInfoHook = nvmlprovider.GetGPUFabricInfo
+
+// fabricManagerStatus returns the status of the registration of the GPU with the fabric manager.
+func fabricManagerStatus(info *nvmlprovider.GPUFabricInfo) int {
+	switch {
+	case info.State == fabricManagerStatusSuccess && info.Error != "":
+		return fabricManagerStatusFailure
+	case info.State > fabricManagerStatusSuccess:
+		return fabricManagerStatusNotSupported
+	}
+	// The states of NVML and the statuses of DCGM have the same values up to completed
+	return int(info.State)
+}
+
+// fabricManagerCollector exports the status of the registration of the GPUs with the fabric manager, which
+// configures the NVSwitch fabric of HGX systems. GPUs are not usable until their registration succeeds.
+type fabricManagerCollector struct {
+	expCollector
+}
+
+// IsDCGMExpFabricManagerStatusEnabled checks if the DCGM_EXP_FABRIC_MANAGER_STATUS counter exists
+func IsDCGMExpFabricManagerStatusEnabled(counters []Counter) bool {
+	return slices.ContainsFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpFabricManagerStatus
+	})
+}
+
+func NewFabricManagerCollector(counters []Counter,
+	hostname string,
+	config *Config,
+	fieldEntityGroupTypeSystemInfo FieldEntityGroupTypeSystemInfoItem) (Collector, error) {
+	if !IsDCGMExpFabricManagerStatusEnabled(counters) {
+		logrus.Error(dcgmExpFabricManagerStatus + " collector is disabled")
+		return nil, fmt.Errorf(dcgmExpFabricManagerStatus + " collector is disabled")
+	}
+
+	transformations, err := getTransformations(config)
+	if err != nil {
+		return nil, err
+	}
+
+	collector := fabricManagerCollector{
+		expCollector: expCollector{
+			sysInfo:         fieldEntityGroupTypeSystemInfo.SystemInfo,
+			hostname:        hostname,
+			config:          config,
+			transformations: transformations,
+		},
+	}
+
+	collector.counter = counters[slices.IndexFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpFabricManagerStatus
+	})]
+
+	return &collector, nil
+}
+
+func (c *fabricManagerCollector) GetMetrics() (MetricsByCounter, error) {
+	uuid := "UUID"
+	if c.config.UseOldNamespace {
+		uuid = "uuid"
+	}
+
+	metrics := make(MetricsByCounter)
+	checked := map[uint]bool{}
+
+	for _, mi := range GetMonitoredEntities(c.sysInfo) {
+		if checked[mi.DeviceInfo.GPU] {
+			continue
+		}
+		checked[mi.DeviceInfo.GPU] = true
+
+		// The GPUs are registered with the fabric manager, the MIG instances share the status of their GPU
+		mi.InstanceInfo = nil
+
+		info, err := nvmlGetGPUFabricInfoHook(mi.DeviceInfo.UUID)
+		if err != nil {
+			logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(),
+				"Unable to get fabric info of GPU %d", mi.DeviceInfo.GPU)
+			continue
+		}
+
+		labels := map[string]string{}
+		if info.Error != "" {
+			labels[fabricManagerErrorLabel] = info.Error
+		}
+
+		m := c.createMetric(labels, mi, uuid, fabricManagerStatus(info))
+		metrics[c.counter] = append(metrics[c.counter], m)
+	}
+
+	for _, transform := range c.transformations {
+		err := transform.Process(metrics, c.sysInfo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform metrics for transform '%s'; err: %v", transform.Name(), err)
+		}
+	}
+
+	return metrics, nil
+}
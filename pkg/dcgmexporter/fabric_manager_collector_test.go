@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+func TestFabricManagerCollector_GetMetrics(t *testing.T) {
+	counter := Counter{FieldName: dcgmExpFabricManagerStatus, PromType: "gauge"}
+
+	sysInfo := SystemInfo{
+		GPUCount: 4,
+		gOpt:     DeviceOptions{Flex: true},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i, UUID: fmt.Sprintf("GPU-%d", i)}
+	}
+
+	fabricInfos := map[string]*nvmlprovider.GPUFabricInfo{
+		"GPU-0": {State: 3},
+		"GPU-1": {State: 3, Error: "ERROR_NOT_READY"},
+		"GPU-2": {State: 2},
+	}
+
+	defer func() {
+		nvmlGetGPUFabricInfoHook = nvmlprovider.GetGPUFabricInfo
+	}()
+	nvmlGetGPUFabricInfoHook = func(uuid string) (*nvmlprovider.GPUFabricInfo, error) {
+		info, exists := fabricInfos[uuid]
+		if !exists {
+			return nil, fmt.Errorf("GPU %s is lost", uuid)
+		}
+		return info, nil
+	}
+
+	collector, err := NewFabricManagerCollector([]Counter{counter}, "node", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{SystemInfo: sysInfo})
+	require.NoError(t, err)
+	defer collector.Cleanup()
+
+	metrics, err := collector.GetMetrics()
+	require.NoError(t, err)
+	require.Len(t, metrics[counter], 3)
+
+	values := map[string]string{}
+	for _, metric := range metrics[counter] {
+		values[metric.GPUUUID] = metric.Value
+		assert.Equal(t, "node", metric.Hostname)
+	}
+	assert.Equal(t, "3", values["GPU-0"])
+	assert.Equal(t, "4", values["GPU-1"])
+	assert.Equal(t, "2", values["GPU-2"])
+
+	assert.Equal(t, "ERROR_NOT_READY", metrics[counter][1].Labels[fabricManagerErrorLabel])
+	assert.NotContains(t, metrics[counter][0].Labels, fabricManagerErrorLabel)
+}
+
+func TestNewFabricManagerCollector_Disabled(t *testing.T) {
+	_, err := NewFabricManagerCollector([]Counter{{FieldName: dcgmExpXIDErrorsCount}}, "node", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{})
+	assert.Error(t, err)
+}
@@ -48,6 +48,7 @@ type FieldEntityGroupTypeSystemInfo struct {
 	switchDevices DeviceOptions
 	cpuDevices    DeviceOptions
 	useFakeGPUs   bool
+	shard         shard
 }
 
 // NewEntityGroupTypeSystemInfo creates a new instance of the FieldEntityGroupTypeSystemInfo
@@ -59,6 +60,7 @@ func NewEntityGroupTypeSystemInfo(c []Counter, config *Config) *FieldEntityGroup
 		switchDevices: config.SwitchDevices,
 		cpuDevices:    config.CPUDevices,
 		useFakeGPUs:   config.UseFakeGPUs,
+		shard:         newShard(config),
 	}
 }
 
@@ -70,6 +72,12 @@ func (e *FieldEntityGroupTypeSystemInfo) Load(entityType dcgm.Field_Entity_Group
 		return fmt.Errorf("no fields to watch for device type: %d", entityType)
 	}
 
+	// When the GPUs are sharded, the other entities are collected by the first shard
+	shardGPUs := e.shard.enabled() && e.shard.by == ShardByGPU
+	if shardGPUs && entityType != dcgm.FE_GPU && !e.shard.first() {
+		return fmt.Errorf("the entities of type %d are collected by shard 1/%d", entityType, e.shard.count)
+	}
+
 	sysInfo, err := GetSystemInfo(&Config{
 		GPUDevices:    e.gpuDevices,
 		SwitchDevices: e.switchDevices,
@@ -80,6 +88,13 @@ func (e *FieldEntityGroupTypeSystemInfo) Load(entityType dcgm.Field_Entity_Group
 		return err
 	}
 
+	if shardGPUs && entityType == dcgm.FE_GPU {
+		*sysInfo = e.shard.systemInfo(*sysInfo)
+		if sysInfo.GPUCount == 0 {
+			return fmt.Errorf("no GPU in shard %s", e.shard.label())
+		}
+	}
+
 	e.items[entityType] = FieldEntityGroupTypeSystemInfoItem{
 		SystemInfo:   *sysInfo,
 		DeviceFields: deviceFields,
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+const (
+	dcgmExpFieldErrorsTotal = "DCGM_EXP_FIELD_ERRORS_TOTAL"
+
+	// fieldReadRetries is the number of times a failed read of the fields of an entity is retried in a collection
+	fieldReadRetries = 1
+)
+
+// fieldStatusReasons are the reasons of the field errors of the status of the values, the other statuses that are
+// not OK are counted as "error". The fields without data or not supported by an entity are not errors.
+var fieldStatusReasons = map[int]string{
+	dcgm.DCGM_ST_STALE_DATA:    "stale_data",
+	dcgm.DCGM_ST_NOT_WATCHED:   "not_watched",
+	dcgm.DCGM_ST_NO_PERMISSION: "no_permission",
+	dcgm.DCGM_ST_NVML_ERROR:    "nvml_error",
+	dcgm.DCGM_ST_TIMEOUT:       "timeout",
+	dcgm.DCGM_ST_GPU_IS_LOST:   "gpu_lost",
+}
+
+// isConnectionError returns whether the error is a lost connection to DCGM, which fails the collection.
+func isConnectionError(err error) bool {
+	var derr *dcgm.DcgmError
+	return errors.As(err, &derr) && derr.Code == dcgm.DCGM_ST_CONNECTION_NOT_VALID
+}
+
+// entityErrorGPU returns the gpu label of the field errors of an entity, the index of the GPU of the GPUs and MIG
+// instances, and the ID of the other entities.
+func entityErrorGPU(mi MonitoringInfo, infoType dcgm.Field_Entity_Group) string {
+	if infoType == dcgm.FE_GPU {
+		return fmt.Sprintf("%d", mi.DeviceInfo.GPU)
+	}
+	return fmt.Sprintf("%d", mi.Entity.EntityId)
+}
+
+// countFieldErrors counts an error reading the fields of an entity.
+func (c *DCGMCollector) countFieldErrors(mi MonitoringInfo, fields []dcgm.Short, reason string) {
+	gpu := entityErrorGPU(mi, c.SysInfo.InfoType)
+	for _, field := range fields {
+		c.countFieldError(field, gpu, reason)
+	}
+}
+
+// countFieldStatusErrors counts the values of an entity with an error status.
+func (c *DCGMCollector) countFieldStatusErrors(mi MonitoringInfo, values []dcgm.FieldValue_v1) {
+	for _, value := range values {
+		if value.Status == dcgm.DCGM_ST_OK || value.Status == dcgm.DCGM_ST_NO_DATA ||
+			value.Status == dcgm.DCGM_ST_NOT_SUPPORTED {
+			continue
+		}
+
+		reason, ok := fieldStatusReasons[value.Status]
+		if !ok {
+			reason = "error"
+		}
+		c.countFieldError(dcgm.Short(value.FieldId), entityErrorGPU(mi, c.SysInfo.InfoType), reason)
+	}
+}
+
+func (c *DCGMCollector) countFieldError(field dcgm.Short, gpu, reason string) {
+	name := fmt.Sprintf("%d", field)
+	if counter, err := FindCounterField(c.Counters, uint(field)); err == nil {
+		name = counter.FieldName
+	}
+
+	selfMetrics.AddCounter(dcgmExpFieldErrorsTotal,
+		"Number of errors reading the fields of the entities, the other fields and entities are still exported.",
+		map[string]string{"field": name, "gpu": gpu, "reason": reason}, 1)
+}
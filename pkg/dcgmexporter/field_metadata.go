@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"strings"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+// fieldMetadata describes how a field is exported with the Prometheus naming conventions.
+type fieldMetadata struct {
+	// help describes the field, from the DCGM field descriptions
+	help string
+	// unit is the base unit of the exported values, it is appended to the name of the metric
+	unit string
+	// scale converts the values read from DCGM to the base unit
+	scale float64
+}
+
+const (
+	mebibyte  = 1 << 20
+	megahertz = 1e6
+)
+
+// fieldsMetadata holds the metadata of the fields exported in a unit, the other fields keep their name and values.
+var fieldsMetadata = map[dcgm.Short]fieldMetadata{
+	dcgm.DCGM_FI_DEV_SM_CLOCK:     {help: "SM clock frequency of the device", unit: "hertz", scale: megahertz},
+	dcgm.DCGM_FI_DEV_MEM_CLOCK:    {help: "Memory clock frequency of the device", unit: "hertz", scale: megahertz},
+	dcgm.DCGM_FI_DEV_VIDEO_CLOCK:  {help: "Video clock frequency of the device", unit: "hertz", scale: megahertz},
+	dcgm.DCGM_FI_DEV_APP_SM_CLOCK: {help: "SM application clock frequency of the device", unit: "hertz", scale: megahertz},
+
+	dcgm.DCGM_FI_DEV_MEMORY_TEMP:     {help: "Memory temperature of the device", unit: "celsius", scale: 1},
+	dcgm.DCGM_FI_DEV_GPU_TEMP:        {help: "Current temperature of the device", unit: "celsius", scale: 1},
+	dcgm.DCGM_FI_DEV_MEM_MAX_OP_TEMP: {help: "Maximum operating temperature of the memory", unit: "celsius", scale: 1},
+	dcgm.DCGM_FI_DEV_GPU_MAX_OP_TEMP: {help: "Maximum operating temperature of the device", unit: "celsius", scale: 1},
+	dcgm.DCGM_FI_DEV_SLOWDOWN_TEMP:   {help: "Slowdown temperature of the device", unit: "celsius", scale: 1},
+	dcgm.DCGM_FI_DEV_SHUTDOWN_TEMP:   {help: "Shutdown temperature of the device", unit: "celsius", scale: 1},
+
+	dcgm.DCGM_FI_DEV_POWER_USAGE:      {help: "Power usage of the device", unit: "watts", scale: 1},
+	dcgm.DCGM_FI_DEV_POWER_MGMT_LIMIT: {help: "Current power limit of the device", unit: "watts", scale: 1},
+	dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT: {
+		help:  "Effective power limit that the driver enforces after taking into account all limiters",
+		unit:  "watts",
+		scale: 1,
+	},
+	dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION: {
+		help:  "Total energy consumption of the GPU since the driver was last reloaded",
+		unit:  "joules",
+		scale: 1e-3,
+	},
+
+	dcgm.DCGM_FI_DEV_FB_TOTAL:    {help: "Total frame buffer of the GPU", unit: "bytes", scale: mebibyte},
+	dcgm.DCGM_FI_DEV_FB_FREE:     {help: "Free frame buffer", unit: "bytes", scale: mebibyte},
+	dcgm.DCGM_FI_DEV_FB_USED:     {help: "Used frame buffer", unit: "bytes", scale: mebibyte},
+	dcgm.DCGM_FI_DEV_FB_RESERVED: {help: "Reserved frame buffer", unit: "bytes", scale: mebibyte},
+	dcgm.DCGM_FI_DEV_BAR1_TOTAL:  {help: "Total BAR1 memory of the GPU", unit: "bytes", scale: mebibyte},
+	dcgm.DCGM_FI_DEV_BAR1_USED:   {help: "Used BAR1 memory of the GPU", unit: "bytes", scale: mebibyte},
+	dcgm.DCGM_FI_DEV_BAR1_FREE:   {help: "Free BAR1 memory of the GPU", unit: "bytes", scale: mebibyte},
+
+	dcgm.DCGM_FI_DEV_GPU_UTIL:      {help: "GPU utilization", unit: "ratio", scale: 0.01},
+	dcgm.DCGM_FI_DEV_MEM_COPY_UTIL: {help: "Memory utilization", unit: "ratio", scale: 0.01},
+	dcgm.DCGM_FI_DEV_ENC_UTIL:      {help: "Encoder utilization", unit: "ratio", scale: 0.01},
+	dcgm.DCGM_FI_DEV_DEC_UTIL:      {help: "Decoder utilization", unit: "ratio", scale: 0.01},
+}
+
+// metricUnits are the units of the metrics exported with the Prometheus naming conventions.
+var metricUnits = func() map[string]bool {
+	units := map[string]bool{}
+	for _, metadata := range fieldsMetadata {
+		units[metadata.unit] = true
+	}
+	return units
+}()
+
+// prometheusCounters returns the counters named after the Prometheus naming conventions, with the unit of their
+// values and the _total suffix of the counters, and the scales converting the values of their fields to the unit.
+// The labels, the bitmasks and the histograms are left unchanged, as are the fields already exported in their unit,
+// e.g. the energy consumption in J of the energy counters.
+func prometheusCounters(counters []Counter) ([]Counter, map[dcgm.Short]float64) {
+	result := make([]Counter, len(counters))
+	scales := map[dcgm.Short]float64{}
+	for i, counter := range counters {
+		result[i] = counter
+		if counter.PromType == "label" || counter.PromType == bitmaskPromType || counter.PromType == histogramPromType {
+			continue
+		}
+
+		name := counter.FieldName
+		total := ""
+		if counter.PromType == "counter" {
+			total = "_total"
+			name = trimSuffixFold(name, total)
+		}
+
+		metadata, ok := fieldsMetadata[counter.FieldID]
+		if ok && !hasSuffixFold(name, "_"+metadata.unit) {
+			name += "_" + metadata.unit
+			result[i].Help = metadata.help + " (in " + metadata.unit + ")."
+			if metadata.unit == "ratio" {
+				result[i].Help = metadata.help + " (from 0 to 1)."
+			}
+			if metadata.scale != 1 {
+				scales[counter.FieldID] = metadata.scale
+			}
+		}
+
+		result[i].FieldName = name + total
+	}
+
+	return result, scales
+}
+
+// convertUnits converts the values of the fields with a scale to their unit.
+func convertUnits(values []dcgm.FieldValue_v1, scales map[dcgm.Short]float64) []dcgm.FieldValue_v1 {
+	for i, value := range values {
+		scale, ok := scales[dcgm.Short(value.FieldId)]
+		if !ok {
+			continue
+		}
+
+		raw, ok := numericFieldValue(value)
+		if !ok {
+			continue
+		}
+
+		converted := doubleFieldValue(raw * scale)
+		converted.Version = value.Version
+		converted.FieldId = value.FieldId
+		converted.Status = value.Status
+		converted.Ts = value.Ts
+		values[i] = converted
+	}
+
+	return values
+}
+
+// metricUnit returns the unit the name of a metric family ends with, or an empty string.
+func metricUnit(family string) string {
+	i := strings.LastIndex(family, "_")
+	if i < 0 || !metricUnits[family[i+1:]] {
+		return ""
+	}
+
+	return family[i+1:]
+}
+
+func hasSuffixFold(s, suffix string) bool {
+	return len(s) >= len(suffix) && strings.EqualFold(s[len(s)-len(suffix):], suffix)
+}
+
+func trimSuffixFold(s, suffix string) string {
+	if hasSuffixFold(s, suffix) {
+		return s[:len(s)-len(suffix)]
+	}
+	return s
+}
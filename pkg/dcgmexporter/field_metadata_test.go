@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusCounters(t *testing.T) {
+	counters, scales := prometheusCounters([]Counter{
+		{dcgm.DCGM_FI_DEV_GPU_TEMP, "DCGM_FI_DEV_GPU_TEMP", "gauge", "GPU temperature (in C)."},
+		{dcgm.DCGM_FI_DEV_FB_USED, "DCGM_FI_DEV_FB_USED", "gauge", "Frame buffer memory used (in MB)."},
+		{dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION, "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", "counter", "Energy"},
+		{dcgm.DCGM_FI_DEV_PCIE_REPLAY_COUNTER, "DCGM_FI_DEV_PCIE_REPLAY_COUNTER", "counter", "Replays"},
+		{dcgm.DCGM_FI_DEV_GPU_UTIL, "DCGM_FI_DEV_GPU_UTIL", histogramPromType, "Utilization"},
+		{dcgm.DCGM_FI_DRIVER_VERSION, "DCGM_FI_DRIVER_VERSION", "label", "Driver Version"},
+	})
+
+	assert.Equal(t, []Counter{
+		{dcgm.DCGM_FI_DEV_GPU_TEMP, "DCGM_FI_DEV_GPU_TEMP_celsius", "gauge",
+			"Current temperature of the device (in celsius)."},
+		{dcgm.DCGM_FI_DEV_FB_USED, "DCGM_FI_DEV_FB_USED_bytes", "gauge", "Used frame buffer (in bytes)."},
+		{dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION, "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_joules_total", "counter",
+			"Total energy consumption of the GPU since the driver was last reloaded (in joules)."},
+		{dcgm.DCGM_FI_DEV_PCIE_REPLAY_COUNTER, "DCGM_FI_DEV_PCIE_REPLAY_COUNTER_total", "counter", "Replays"},
+		{dcgm.DCGM_FI_DEV_GPU_UTIL, "DCGM_FI_DEV_GPU_UTIL", histogramPromType, "Utilization"},
+		{dcgm.DCGM_FI_DRIVER_VERSION, "DCGM_FI_DRIVER_VERSION", "label", "Driver Version"},
+	}, counters)
+	assert.Equal(t, map[dcgm.Short]float64{
+		dcgm.DCGM_FI_DEV_FB_USED:                  mebibyte,
+		dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION: 1e-3,
+	}, scales)
+
+	// The energy counters and the monotonic counters are already exported in their unit, with the _total suffix
+	counters, scales = prometheusCounters(energyCounters(monotonicCounters([]Counter{
+		{dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION, "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", "counter", "Energy"},
+		{dcgm.DCGM_FI_DEV_PCIE_REPLAY_COUNTER, "DCGM_FI_DEV_PCIE_REPLAY_COUNTER", "counter", "Replays"},
+	})))
+	assert.Equal(t, []string{energyJoulesFieldName, "DCGM_FI_DEV_PCIE_REPLAY_COUNTER_total"},
+		[]string{counters[0].FieldName, counters[1].FieldName})
+	assert.Empty(t, scales)
+}
+
+func TestConvertUnits(t *testing.T) {
+	fbUsed := int64FieldValue(1024)
+	fbUsed.FieldId = uint(dcgm.DCGM_FI_DEV_FB_USED)
+	fbUsed.Ts = 42
+	util := int64FieldValue(75)
+	util.FieldId = uint(dcgm.DCGM_FI_DEV_GPU_UTIL)
+	temp := int64FieldValue(60)
+	temp.FieldId = uint(dcgm.DCGM_FI_DEV_GPU_TEMP)
+	blank := int64FieldValue(dcgm.DCGM_FT_INT64_BLANK)
+	blank.FieldId = uint(dcgm.DCGM_FI_DEV_FB_FREE)
+
+	values := convertUnits([]dcgm.FieldValue_v1{fbUsed, util, temp, blank}, map[dcgm.Short]float64{
+		dcgm.DCGM_FI_DEV_FB_USED:  mebibyte,
+		dcgm.DCGM_FI_DEV_FB_FREE:  mebibyte,
+		dcgm.DCGM_FI_DEV_GPU_UTIL: 0.01,
+	})
+
+	result := make([]string, len(values))
+	for i, value := range values {
+		result[i] = ToString(value)
+	}
+	assert.Equal(t, []string{"1073741824.000000", "0.750000", "60", SkipDCGMValue}, result)
+	assert.Equal(t, uint(dcgm.DCGM_FI_DEV_FB_USED), values[0].FieldId)
+	assert.Equal(t, int64(42), values[0].Ts)
+}
+
+func TestMetricUnit(t *testing.T) {
+	assert.Equal(t, "celsius", metricUnit("DCGM_FI_DEV_GPU_TEMP_celsius"))
+	assert.Equal(t, "joules", metricUnit("DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_joules"))
+	assert.Equal(t, "", metricUnit("DCGM_EXP_AVERAGE_POWER_WATTS"))
+	assert.Equal(t, "", metricUnit("DCGM_FI_DEV_GPU_TEMP"))
+}
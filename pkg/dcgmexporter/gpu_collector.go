@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
 	"github.com/sirupsen/logrus"
@@ -28,6 +30,9 @@ import (
 
 const unknownErr = "Unknown Error"
 
+// DefaultCollectWorkers is the default number of entities whose field values are read concurrently.
+const DefaultCollectWorkers = 4
+
 type DCGMCollectorConstructor func([]Counter, string, *Config, FieldEntityGroupTypeSystemInfoItem) (*DCGMCollector,
 	func(), error)
 
@@ -55,15 +60,43 @@ func NewDCGMCollector(
 
 	collector.UseOldNamespace = config.UseOldNamespace
 	collector.ReplaceBlanksInModelName = config.ReplaceBlanksInModelName
-
-	cleanups, err := SetupDcgmFieldsWatch(collector.DeviceFields,
-		fieldEntityGroupTypeSystemInfo.SystemInfo,
-		int64(config.CollectInterval)*1000)
-	if err != nil {
-		logrus.Fatal("Failed to watch metrics: ", err)
+	collector.aggregator = newFieldAggregator(config)
+	collector.resets = newCounterResets(config)
+	collector.workers = config.CollectWorkers
+	collector.sampleTimestamps = config.SampleTimestamps
+	collector.sampleAge = config.SampleAge
+	collector.now = time.Now
+	if config.MonotonicCounters {
+		collector.Counters = monotonicCounters(c)
+	}
+	if config.EnergyCounters {
+		collector.Counters = energyCounters(collector.Counters)
+		collector.energyJoules = true
+	}
+	if config.MetricNames == MetricNamesPrometheus {
+		collector.Counters, collector.unitScales = prometheusCounters(collector.Counters)
 	}
+	if collector.SysInfo.InfoType != dcgm.FE_GPU {
+		collector.Counters = withoutHistograms(collector.Counters)
+	}
+
+	// The fields with their own collect interval are watched in separate field groups, the collector reads the latest
+	// value of every field
+	// The profiling fields are only watched and read on the GPUs supporting them
+	collector.unsupportedFields = unsupportedProfilingFields(collector.DeviceFields, collector.SysInfo, config)
+	for _, group := range fieldsByCollectInterval(collector.DeviceFields, config) {
+		for _, watchGroup := range fieldWatchGroupsBySupport(group.fields, collector.SysInfo,
+			collector.unsupportedFields) {
+			cleanups, err := SetupDcgmFieldsWatch(watchGroup.fields,
+				watchGroup.sysInfo,
+				newFieldWatch(config, group.interval))
+			if err != nil {
+				logrus.Fatal("Failed to watch metrics: ", err)
+			}
 
-	collector.Cleanups = cleanups
+			collector.Cleanups = append(collector.Cleanups, cleanups...)
+		}
+	}
 
 	return collector, func() { collector.Cleanup() }, nil
 }
@@ -83,7 +116,9 @@ func GetHostname(config *Config) (string, error) {
 	hostname := ""
 	var err error
 	if !config.NoHostname {
-		if nodeName := os.Getenv("NODE_NAME"); nodeName != "" {
+		if config.Hostname != "" {
+			hostname = config.Hostname
+		} else if nodeName := os.Getenv("NODE_NAME"); nodeName != "" {
 			hostname = nodeName
 		} else {
 			hostname, err = os.Hostname()
@@ -106,31 +141,79 @@ func (c *DCGMCollector) GetMetrics() (MetricsByCounter, error) {
 
 	metrics := make(MetricsByCounter)
 
-	for _, mi := range monitoringInfo {
-		var vals []dcgm.FieldValue_v1
-		var err error
-		if mi.Entity.EntityGroupId == dcgm.FE_LINK {
-			vals, err = dcgm.LinkGetLatestValues(mi.Entity.EntityId, mi.ParentId, c.DeviceFields)
-		} else {
-			vals, err = dcgm.EntityGetLatestValues(mi.Entity.EntityGroupId, mi.Entity.EntityId, c.DeviceFields)
-		}
+	inheritedFields := inheritedMemoryHealthFields(c.DeviceFields)
+	entityValues, parentValues := c.readLatestValues(monitoringInfo, inheritedFields)
 
+	// The values are converted in the order of the entities, so that the metrics don't depend on the reads.
+	// The entities whose fields cannot be read are left out and counted, so that the others are still exported.
+	var lastErr error
+	failed := 0
+	for i, mi := range monitoringInfo {
+		vals, err := entityValues[i].values, entityValues[i].err
 		if err != nil {
-			if derr, ok := err.(*dcgm.DcgmError); ok {
-				if derr.Code == dcgm.DCGM_ST_CONNECTION_NOT_VALID {
-					logrus.Fatal("Could not retrieve metrics: ", err)
+			// The supervisor reinitializes DCGM once it notices the lost connection, the collection fails meanwhile
+			if isConnectionError(err) {
+				return nil, fmt.Errorf("lost the connection to DCGM; err: %w", err)
+			}
+
+			logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(),
+				"Unable to read the fields of entity %d of group %s", mi.Entity.EntityId, mi.Entity.EntityGroupId)
+			c.countFieldErrors(mi, c.DeviceFields, "read_failed")
+			lastErr = err
+			failed++
+			continue
+		}
+
+		if mi.InstanceInfo != nil && len(inheritedFields) > 0 {
+			parent := parentValues[mi.DeviceInfo.GPU]
+			if parent.err != nil {
+				if isConnectionError(parent.err) {
+					return nil, fmt.Errorf("lost the connection to DCGM; err: %w", parent.err)
 				}
+
+				// The MIG instance is exported without the fields of its parent GPU
+				c.countFieldErrors(mi, inheritedFields, "read_failed")
+			} else {
+				vals = inheritParentValues(vals, parent.values)
 			}
-			return nil, err
+		}
+
+		c.countFieldStatusErrors(mi, vals)
+
+		// The times are those of the values read from DCGM, before they are aggregated
+		var times map[dcgm.Short]time.Time
+		if c.exportsSampleTimes() {
+			times = sampleTimes(vals)
+		}
+
+		if c.aggregator != nil {
+			vals = c.aggregator.aggregate(mi.Entity, mi.ParentId, vals)
+		}
+		if c.resets != nil {
+			vals = c.resets.adjust(mi, vals)
+		}
+		if c.energyJoules {
+			vals = energyJoules(vals)
+		}
+		if c.unitScales != nil {
+			vals = convertUnits(vals, c.unitScales)
+		}
+
+		// The sample times and the histograms are added to the metrics of the entity, they are converted apart from
+		// the other entities
+		entityMetrics := metrics
+		histograms := c.aggregator.histograms(mi.Entity, mi.ParentId)
+		if times != nil || histograms != nil {
+			entityMetrics = make(MetricsByCounter)
 		}
 
 		// InstanceInfo will be nil for GPUs
 		if c.SysInfo.InfoType == dcgm.FE_SWITCH || c.SysInfo.InfoType == dcgm.FE_LINK {
-			ToSwitchMetric(metrics, vals, c.Counters, mi, c.UseOldNamespace, c.Hostname)
+			ToSwitchMetric(entityMetrics, vals, c.Counters, mi, c.UseOldNamespace, c.Hostname)
 		} else if c.SysInfo.InfoType == dcgm.FE_CPU || c.SysInfo.InfoType == dcgm.FE_CPU_CORE {
-			ToCPUMetric(metrics, vals, c.Counters, mi, c.UseOldNamespace, c.Hostname)
+			ToCPUMetric(entityMetrics, vals, c.Counters, mi, c.UseOldNamespace, c.Hostname)
 		} else {
-			ToMetric(metrics,
+			ToMetric(entityMetrics,
 				vals,
 				c.Counters,
 				mi.DeviceInfo,
@@ -139,11 +222,115 @@ func (c *DCGMCollector) GetMetrics() (MetricsByCounter, error) {
 				c.Hostname,
 				c.ReplaceBlanksInModelName)
 		}
+
+		if times != nil {
+			c.addSampleTimes(entityMetrics, times)
+		}
+		if histograms != nil {
+			entityMetrics = toHistogramMetrics(entityMetrics, histograms)
+		}
+		if times != nil || histograms != nil {
+			mergeMetrics(metrics, entityMetrics)
+		}
+	}
+
+	if len(monitoringInfo) > 0 && failed == len(monitoringInfo) {
+		return nil, fmt.Errorf("could not read the fields of any entity; err: %w", lastErr)
+	}
+
+	if c.sourceLabel != "" {
+		for _, counterMetrics := range metrics {
+			for _, metric := range counterMetrics {
+				metric.Attributes[sourceAttribute] = c.sourceLabel
+			}
+		}
+	}
+
+	if c.source != nil {
+		c.source.collected(c.SysInfo)
 	}
 
 	return metrics, nil
 }
 
+// latestValues are the field values of an entity read in a collection.
+type latestValues struct {
+	values []dcgm.FieldValue_v1
+	err    error
+}
+
+// readLatestValues reads the field values of the entities, and the inherited fields of the parent GPUs of the MIG
+// instances, with up to the configured number of concurrent reads. The values of the entities are in their order.
+// A failed read is retried, e.g. when a MIG instance is reconfigured during the read.
+func (c *DCGMCollector) readLatestValues(
+	monitoringInfo []MonitoringInfo, inheritedFields []dcgm.Short,
+) ([]latestValues, map[uint]*latestValues) {
+	type read struct {
+		entity   dcgm.GroupEntityPair
+		parentID uint
+		fields   []dcgm.Short
+		result   *latestValues
+	}
+
+	entityValues := make([]latestValues, len(monitoringInfo))
+	parentValues := map[uint]*latestValues{}
+
+	var reads []read
+	for i, mi := range monitoringInfo {
+		fields := supportedEntityFields(c.DeviceFields, mi, c.unsupportedFields)
+		reads = append(reads, read{mi.Entity, mi.ParentId, fields, &entityValues[i]})
+
+		if mi.InstanceInfo != nil && len(inheritedFields) > 0 {
+			gpu := mi.DeviceInfo.GPU
+			if _, exists := parentValues[gpu]; !exists {
+				parentValues[gpu] = &latestValues{}
+				reads = append(reads, read{dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU, EntityId: gpu},
+					PARENT_ID_IGNORED, inheritedFields, parentValues[gpu]})
+			}
+		}
+	}
+
+	workers := make(chan struct{}, max(c.workers, 1))
+	var wg sync.WaitGroup
+	for _, r := range reads {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(r read) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+
+			r.result.values, r.result.err = c.getLatestValues(r.entity, r.parentID, r.fields)
+			for retry := 0; retry < fieldReadRetries && r.result.err != nil && !isConnectionError(r.result.err); retry++ {
+				r.result.values, r.result.err = c.getLatestValues(r.entity, r.parentID, r.fields)
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	return entityValues, parentValues
+}
+
+// getLatestValues reads the latest values of the fields of an entity from DCGM, or from the source of the collector.
+func (c *DCGMCollector) getLatestValues(
+	entity dcgm.GroupEntityPair, parentID uint, fields []dcgm.Short,
+) ([]dcgm.FieldValue_v1, error) {
+	if c.source != nil {
+		return c.source.latestValues(entity, parentID, fields)
+	}
+
+	return dcgmLatestValues(entity, parentID, fields)
+}
+
+func dcgmLatestValues(entity dcgm.GroupEntityPair, parentID uint, fields []dcgm.Short) ([]dcgm.FieldValue_v1, error) {
+	if entity.EntityGroupId == dcgm.FE_LINK {
+		return dcgm.LinkGetLatestValues(entity.EntityId, parentID, fields)
+	}
+
+	return dcgm.EntityGetLatestValues(entity.EntityGroupId, entity.EntityId, fields)
+}
+
 func ShouldMonitorDeviceType(fields []dcgm.Short, entityType dcgm.Field_Entity_Group) bool {
 	if len(fields) == 0 {
 		return false
@@ -319,12 +506,13 @@ func ToMetric(
 			Labels:     labels,
 			Attributes: attrs,
 		}
-		if instanceInfo != nil {
-			m.MigProfile = instanceInfo.ProfileName
-			m.GPUInstanceID = fmt.Sprintf("%d", instanceInfo.Info.NvmlInstanceId)
-		} else {
-			m.MigProfile = ""
-			m.GPUInstanceID = ""
+		setMigLabels(&m, instanceInfo)
+
+		if counter.PromType == bitmaskPromType {
+			for _, bm := range decodeBitmaskMetric(m, val.Int64()) {
+				metrics[bm.Counter] = append(metrics[bm.Counter], bm)
+			}
+			continue
 		}
 
 		metrics[m.Counter] = append(metrics[m.Counter], m)
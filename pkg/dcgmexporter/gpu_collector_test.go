@@ -17,9 +17,13 @@
 package dcgmexporter
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
 	"github.com/stretchr/testify/assert"
@@ -184,7 +188,7 @@ func testDCGMGPUCollector(t *testing.T, counters []Counter) (*DCGMCollector, fun
 }
 
 func testDCGMCPUCollector(t *testing.T, counters []Counter) (*DCGMCollector, func()) {
-	dOpt := DeviceOptions{true, []int{-1}, []int{-1}}
+	dOpt := DeviceOptions{Flex: true, MajorRange: []int{-1}, MinorRange: []int{-1}}
 	config := Config{
 		CPUDevices:      dOpt,
 		NoHostname:      false,
@@ -417,6 +421,48 @@ func TestToMetricWhenDCGM_FI_DEV_XID_ERRORSField(t *testing.T) {
 	}
 }
 
+func TestToMetricWhenBitmaskField(t *testing.T) {
+	fieldValue := [4096]byte{}
+	fieldValue[0] = byte(DCGM_CLOCKS_THROTTLE_REASON_HW_THERMAL | DCGM_CLOCKS_THROTTLE_REASON_HW_SLOWDOWN)
+	values := []dcgm.FieldValue_v1{
+		{
+			FieldId:   dcgm.DCGM_FI_DEV_CLOCK_THROTTLE_REASONS,
+			FieldType: dcgm.DCGM_FT_INT64,
+			Value:     fieldValue,
+		},
+	}
+
+	c := []Counter{
+		{
+			FieldID:   dcgm.DCGM_FI_DEV_CLOCK_THROTTLE_REASONS,
+			FieldName: "DCGM_FI_DEV_CLOCK_THROTTLE_REASONS",
+			PromType:  "bitmask",
+			Help:      "Clock throttle reasons",
+		},
+	}
+
+	d := dcgm.Device{UUID: "fake0"}
+
+	metrics := make(map[Counter][]Metric)
+	ToMetric(metrics, values, c, d, nil, false, "", false)
+	require.Len(t, metrics, 1)
+
+	counter := c[0]
+	counter.PromType = "gauge"
+	require.Len(t, metrics[counter], len(clockEventToString))
+
+	active := map[string]string{}
+	for _, metric := range metrics[counter] {
+		assert.Equal(t, d.UUID, metric.GPUUUID)
+		active[metric.Attributes["clock_event"]] = metric.Value
+	}
+	assert.Equal(t, "1", active["hw_thermal"])
+	assert.Equal(t, "1", active["hw_slowdown"])
+	assert.Equal(t, "0", active["sw_thermal"])
+	assert.Equal(t, "0", active["hw_power_brake"])
+	assert.Equal(t, "0", active["sync_boost"])
+}
+
 func TestGPUCollector_GetMetrics(t *testing.T) {
 	teardownTest := setupTest(t)
 	defer teardownTest(t)
@@ -484,3 +530,177 @@ func TestGPUCollector_GetMetrics(t *testing.T) {
 
 	require.Equal(t, numGPUs, uint(len(values)))
 }
+
+// concurrentSource counts the concurrent reads of a source.
+type concurrentSource struct {
+	fieldValuesSource
+	reads      atomic.Int32
+	running    atomic.Int32
+	maxRunning atomic.Int32
+}
+
+func (s *concurrentSource) latestValues(
+	entity dcgm.GroupEntityPair, parentID uint, fields []dcgm.Short,
+) ([]dcgm.FieldValue_v1, error) {
+	s.reads.Add(1)
+	running := s.running.Add(1)
+	defer s.running.Add(-1)
+	for {
+		maxRunning := s.maxRunning.Load()
+		if running <= maxRunning || s.maxRunning.CompareAndSwap(maxRunning, running) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	return s.fieldValuesSource.latestValues(entity, parentID, fields)
+}
+
+func TestDCGMCollector_ConcurrentReads(t *testing.T) {
+	spec, err := LoadSimulationSpec(writeSimulationSpec(t, `
+gpus:
+- count: 4
+- mig:
+  - profile: 1g.10gb
+    count: 2
+fields:
+  DCGM_FI_DEV_GPU_TEMP: {values: [40, 41, 42]}
+  DCGM_FI_DEV_CORRECTABLE_REMAPPED_ROWS: {values: [0, 1]}
+`))
+	require.NoError(t, err)
+
+	counters := []Counter{
+		{dcgm.DCGM_FI_DEV_GPU_TEMP, "DCGM_FI_DEV_GPU_TEMP", "gauge", "Temp"},
+		{dcgm.DCGM_FI_DEV_CORRECTABLE_REMAPPED_ROWS, "DCGM_FI_DEV_CORRECTABLE_REMAPPED_ROWS", "counter", "Rows"},
+	}
+	config := &Config{GPUDevices: DeviceOptions{Flex: true}}
+
+	systemInfo, err := NewSimulatedEntityGroupTypeSystemInfo(counters, config, spec)
+	require.NoError(t, err)
+	item, _ := systemInfo.Get(dcgm.FE_GPU)
+
+	collect := func(workers int) (MetricsByCounter, *concurrentSource) {
+		source := &concurrentSource{fieldValuesSource: newSimulator(spec, counters)}
+		collector := &DCGMCollector{
+			Counters:     counters,
+			DeviceFields: item.DeviceFields,
+			SysInfo:      item.SystemInfo,
+			Hostname:     "node",
+			source:       source,
+			workers:      workers,
+		}
+
+		metrics, err := collector.GetMetrics()
+		require.NoError(t, err)
+		return metrics, source
+	}
+
+	serial, source := collect(1)
+	require.Len(t, serial[counters[0]], 6)
+	// The MIG instances read the memory health fields of their parent GPU once
+	assert.Equal(t, int32(7), source.reads.Load())
+	assert.Equal(t, int32(1), source.maxRunning.Load())
+
+	concurrent, source := collect(3)
+	assert.Equal(t, serial, concurrent)
+	assert.Equal(t, int32(7), source.reads.Load())
+	assert.LessOrEqual(t, source.maxRunning.Load(), int32(3))
+	assert.Greater(t, source.maxRunning.Load(), int32(1))
+}
+
+// failingSource fails the reads of the entities a number of times, with err when it is set, and sets the status of
+// the values of a field.
+type failingSource struct {
+	fieldValuesSource
+	sync.Mutex
+	failures map[uint]int
+	status   map[dcgm.Short]int
+	err      error
+}
+
+func (s *failingSource) latestValues(
+	entity dcgm.GroupEntityPair, parentID uint, fields []dcgm.Short,
+) ([]dcgm.FieldValue_v1, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.failures[entity.EntityId] > 0 {
+		s.failures[entity.EntityId]--
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, errors.New("entity is being reconfigured")
+	}
+
+	values, err := s.fieldValuesSource.latestValues(entity, parentID, fields)
+	for i := range values {
+		values[i].Status = s.status[dcgm.Short(values[i].FieldId)]
+	}
+	return values, err
+}
+
+func TestDCGMCollector_FieldErrors(t *testing.T) {
+	spec, err := LoadSimulationSpec(writeSimulationSpec(t, `
+gpus:
+- count: 3
+fields:
+  DCGM_FI_DEV_GPU_TEMP: {values: [40]}
+  DCGM_FI_DEV_POWER_USAGE: {values: [100]}
+`))
+	require.NoError(t, err)
+
+	counters := []Counter{
+		{dcgm.DCGM_FI_DEV_GPU_TEMP, "DCGM_FI_DEV_GPU_TEMP", "gauge", "Temp"},
+		{dcgm.DCGM_FI_DEV_POWER_USAGE, "DCGM_FI_DEV_POWER_USAGE", "gauge", "Power"},
+	}
+	config := &Config{GPUDevices: DeviceOptions{Flex: true}}
+
+	systemInfo, err := NewSimulatedEntityGroupTypeSystemInfo(counters, config, spec)
+	require.NoError(t, err)
+	item, _ := systemInfo.Get(dcgm.FE_GPU)
+
+	source := &failingSource{
+		fieldValuesSource: newSimulator(spec, counters),
+		// GPU 1 fails once and is retried, GPU 2 fails every read
+		failures: map[uint]int{1: 1, 2: 1 + fieldReadRetries},
+		status:   map[dcgm.Short]int{dcgm.DCGM_FI_DEV_POWER_USAGE: dcgm.DCGM_ST_STALE_DATA},
+	}
+	collector := &DCGMCollector{
+		Counters:     counters,
+		DeviceFields: item.DeviceFields,
+		SysInfo:      item.SystemInfo,
+		source:       source,
+	}
+
+	fieldErrors := func(field, gpu, reason string) float64 {
+		value, _ := selfMetrics.Value(dcgmExpFieldErrorsTotal,
+			map[string]string{"field": field, "gpu": gpu, "reason": reason})
+		return value
+	}
+	readFailed := fieldErrors("DCGM_FI_DEV_GPU_TEMP", "2", "read_failed")
+	staleData := fieldErrors("DCGM_FI_DEV_POWER_USAGE", "0", "stale_data")
+
+	// The GPUs that could be read are exported
+	metrics, err := collector.GetMetrics()
+	require.NoError(t, err)
+	var gpus []string
+	for _, metric := range metrics[counters[0]] {
+		gpus = append(gpus, metric.GPU)
+	}
+	assert.Equal(t, []string{"0", "1"}, gpus)
+
+	assert.Equal(t, readFailed+1, fieldErrors("DCGM_FI_DEV_GPU_TEMP", "2", "read_failed"))
+	assert.Equal(t, float64(0), fieldErrors("DCGM_FI_DEV_GPU_TEMP", "1", "read_failed"))
+	assert.Equal(t, staleData+1, fieldErrors("DCGM_FI_DEV_POWER_USAGE", "0", "stale_data"))
+
+	// The collection fails when no entity can be read
+	source.failures = map[uint]int{0: 2, 1: 2, 2: 2}
+	_, err = collector.GetMetrics()
+	assert.Error(t, err)
+
+	// The collection fails without exiting when the connection to DCGM is lost, the supervisor reconnects
+	source.failures = map[uint]int{1: 1}
+	source.err = &dcgm.DcgmError{Code: dcgm.DCGM_ST_CONNECTION_NOT_VALID}
+	_, err = collector.GetMetrics()
+	assert.ErrorContains(t, err, "lost the connection to DCGM")
+}
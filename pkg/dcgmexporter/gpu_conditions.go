@@ -0,0 +1,217 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+const (
+	gpuXIDErrorReason         = "GPUXidError"
+	gpuDBEErrorReason         = "GPUDoubleBitECCError"
+	gpuThermalViolationReason = "GPUThermalViolation"
+	gpuHealthFailReason       = "GPUHealthFailure"
+	gpuHealthWarnReason       = "GPUHealthWarning"
+	gpuHealthPassReason       = "GPUHealthRecovered"
+)
+
+// gpuCondition is a critical condition of a device found in the metrics of a collection.
+type gpuCondition struct {
+	// device is the key of the device, name identifies the condition of the device
+	device  string
+	name    string
+	value   float64
+	reason  string
+	message string
+}
+
+func (c gpuCondition) key() string {
+	return c.device + "/" + c.name
+}
+
+// reported returns whether the condition is a failure that happened since the previous collection. The XID errors
+// and the double bit ECC errors seen in the first collection happened before the exporter started, they are not
+// reported.
+func (c gpuCondition) reported(previous float64, seen bool) bool {
+	switch c.reason {
+	case gpuXIDErrorReason:
+		return seen && c.value != previous && c.value != 0
+	case gpuDBEErrorReason:
+		return seen && c.value > previous
+	case gpuHealthFailReason:
+		return c.value == healthResultFail && previous != healthResultFail
+	}
+	return false
+}
+
+// changed returns whether the condition changed since the previous collection, like reported, including the thermal
+// violations and every change of the health watches, e.g. back to pass.
+func (c gpuCondition) changed(previous float64, seen bool) bool {
+	switch c.reason {
+	case gpuThermalViolationReason:
+		return seen && c.value > previous
+	case gpuHealthFailReason, gpuHealthWarnReason, gpuHealthPassReason:
+		// The health watches are passing until the first collection
+		return c.value != previous
+	}
+	return c.reported(previous, seen)
+}
+
+// gpuConditionDevice holds a metric of a device, for its labels, and the pods using the device by name.
+type gpuConditionDevice struct {
+	metric Metric
+	pods   map[string]string
+}
+
+// sortedPods returns the names of the pods using the device, sorted.
+func (d *gpuConditionDevice) sortedPods() []string {
+	pods := make([]string, 0, len(d.pods))
+	for pod := range d.pods {
+		pods = append(pods, pod)
+	}
+	sort.Strings(pods)
+	return pods
+}
+
+// gpuConditionTracker finds the conditions of the devices to report in the metrics of every collection.
+type gpuConditionTracker struct {
+	// previous holds the values of the conditions of the last collection
+	previous map[string]float64
+	report   func(condition gpuCondition, previous float64, seen bool) bool
+	// names names the attributes of the pods the metrics are attributed to
+	names podAttributeNames
+}
+
+func newGPUConditionTracker(
+	names podAttributeNames, report func(condition gpuCondition, previous float64, seen bool) bool,
+) *gpuConditionTracker {
+	return &gpuConditionTracker{
+		previous: map[string]float64{},
+		report:   report,
+		names:    names,
+	}
+}
+
+// update returns the conditions to report in the metrics of a collection, sorted by key, and the devices by key.
+func (t *gpuConditionTracker) update(metrics MetricsByCounter) ([]gpuCondition, map[string]*gpuConditionDevice) {
+	devices := map[string]*gpuConditionDevice{}
+	var conditions []gpuCondition
+
+	for counter, counterMetrics := range metrics {
+		for _, metric := range counterMetrics {
+			key := derivedDeviceKey(metric)
+			device, exists := devices[key]
+			if !exists {
+				device = &gpuConditionDevice{metric: metric, pods: map[string]string{}}
+				devices[key] = device
+			}
+
+			// The metrics of a GPU are repeated for every pod sharing it
+			if pod, namespace := metricPod(metric, t.names); pod != "" {
+				device.pods[pod] = namespace
+			}
+
+			if condition, ok := metricCondition(counter, metric); ok {
+				conditions = append(conditions, condition)
+			}
+		}
+	}
+
+	sort.Slice(conditions, func(i, j int) bool { return conditions[i].key() < conditions[j].key() })
+
+	var reported []gpuCondition
+	seen := map[string]bool{}
+	for _, condition := range conditions {
+		// The condition of a GPU shared by pods is seen once per pod
+		key := condition.key()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		previous, exists := t.previous[key]
+		t.previous[key] = condition.value
+		if t.report(condition, previous, exists) {
+			reported = append(reported, condition)
+		}
+	}
+
+	return reported, devices
+}
+
+// metricPod returns the name and the namespace of the pod attributed to the metric, if any.
+func metricPod(metric Metric, names podAttributeNames) (string, string) {
+	return metric.Attributes[names.name(podAttribute)], metric.Attributes[names.name(namespaceAttribute)]
+}
+
+// metricCondition returns the condition reported by the metric, if any.
+func metricCondition(counter Counter, metric Metric) (gpuCondition, bool) {
+	value, err := strconv.ParseFloat(metric.Value, 64)
+	if err != nil {
+		return gpuCondition{}, false
+	}
+
+	device := fmt.Sprintf("GPU %s (%s)", metric.GPU, metric.GPUUUID)
+	if metric.GPUInstanceID != "" {
+		device = fmt.Sprintf("GPU instance %s of GPU %s (%s)", metric.GPUInstanceID, metric.GPU, metric.GPUUUID)
+	}
+
+	condition := gpuCondition{device: derivedDeviceKey(metric), name: counter.FieldName, value: value}
+
+	switch {
+	case counter.FieldName == dcgmHealthStatus:
+		system := metric.Labels[healthSystemLabel]
+		if system == "" || system == healthSystemOverall {
+			return gpuCondition{}, false
+		}
+		condition.name += "/" + system
+		watch := metric.Labels[healthWatchLabel]
+		switch value {
+		case healthResultFail:
+			condition.reason = gpuHealthFailReason
+			condition.message = fmt.Sprintf("The %s health watch failed on %s", watch, device)
+		case healthResultWarn:
+			condition.reason = gpuHealthWarnReason
+			condition.message = fmt.Sprintf("The %s health watch reported a warning on %s", watch, device)
+		default:
+			condition.reason = gpuHealthPassReason
+			condition.message = fmt.Sprintf("The %s health watch passed on %s", watch, device)
+		}
+	case counter.FieldID == dcgm.DCGM_FI_DEV_XID_ERRORS:
+		errCode := int(value)
+		errMsg := unknownErr
+		if 0 <= errCode && errCode < len(xidErrCodeToText) {
+			errMsg = xidErrCodeToText[errCode]
+		}
+		condition.reason = gpuXIDErrorReason
+		condition.message = fmt.Sprintf("XID error %d on %s: %s", errCode, device, errMsg)
+	case counter.FieldID == dcgm.DCGM_FI_DEV_ECC_DBE_VOL_TOTAL:
+		condition.reason = gpuDBEErrorReason
+		condition.message = fmt.Sprintf("%.0f double bit ECC errors on %s since it was reset", value, device)
+	case counter.FieldID == dcgm.DCGM_FI_DEV_THERMAL_VIOLATION:
+		condition.reason = gpuThermalViolationReason
+		condition.message = fmt.Sprintf("%s was throttled by a thermal violation, for %.0f us in total", device, value)
+	default:
+		return gpuCondition{}, false
+	}
+
+	return condition, true
+}
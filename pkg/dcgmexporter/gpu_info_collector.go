@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	gpuSerialLabel          = "serial"
+	gpuBoardPartNumberLabel = "board_part_number"
+)
+
+// gpuInfoCollector exports a series per GPU with the serial number and the board part number of the GPU as labels,
+// so that the metrics can be joined by UUID with the inventory of the GPUs. The PCI bus ID is one of the usual
+// labels of the GPU metrics.
+type gpuInfoCollector struct {
+	expCollector
+}
+
+// IsDCGMExpGPUInfoEnabled checks if the DCGM_EXP_GPU_INFO counter exists
+func IsDCGMExpGPUInfoEnabled(counters []Counter) bool {
+	return slices.ContainsFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpGPUInfo
+	})
+}
+
+func NewGPUInfoCollector(counters []Counter,
+	hostname string,
+	config *Config,
+	fieldEntityGroupTypeSystemInfo FieldEntityGroupTypeSystemInfoItem) (Collector, error) {
+	if !IsDCGMExpGPUInfoEnabled(counters) {
+		logrus.Error(dcgmExpGPUInfo + " collector is disabled")
+		return nil, fmt.Errorf(dcgmExpGPUInfo + " collector is disabled")
+	}
+
+	transformations, err := getTransformations(config)
+	if err != nil {
+		return nil, err
+	}
+
+	collector := gpuInfoCollector{
+		expCollector: expCollector{
+			sysInfo:         fieldEntityGroupTypeSystemInfo.SystemInfo,
+			hostname:        hostname,
+			config:          config,
+			transformations: transformations,
+		},
+	}
+
+	// The part numbers don't change, they are read once
+	PopulateBoardPartNumbers(&collector.sysInfo)
+
+	collector.counter = counters[slices.IndexFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpGPUInfo
+	})]
+
+	return &collector, nil
+}
+
+func (c *gpuInfoCollector) GetMetrics() (MetricsByCounter, error) {
+	uuid := "UUID"
+	if c.config.UseOldNamespace {
+		uuid = "uuid"
+	}
+
+	gpus := map[uint]GPUInfo{}
+	for i := uint(0); i < c.sysInfo.GPUCount; i++ {
+		gpus[c.sysInfo.GPUs[i].DeviceInfo.GPU] = c.sysInfo.GPUs[i]
+	}
+
+	metrics := make(MetricsByCounter)
+	checked := map[uint]bool{}
+
+	for _, mi := range GetMonitoredEntities(c.sysInfo) {
+		if checked[mi.DeviceInfo.GPU] {
+			continue
+		}
+		checked[mi.DeviceInfo.GPU] = true
+
+		// The info is the one of the GPU, the MIG instances share it
+		mi.InstanceInfo = nil
+
+		gpu := gpus[mi.DeviceInfo.GPU]
+		labels := map[string]string{
+			gpuSerialLabel:          gpu.DeviceInfo.Identifiers.Serial,
+			gpuBoardPartNumberLabel: gpu.BoardPartNumber,
+		}
+
+		m := c.createMetric(labels, mi, uuid, 1)
+		metrics[c.counter] = append(metrics[c.counter], m)
+	}
+
+	for _, transform := range c.transformations {
+		err := transform.Process(metrics, c.sysInfo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform metrics for transform '%s'; err: %v", transform.Name(), err)
+		}
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+func TestGPUInfoCollector_GetMetrics(t *testing.T) {
+	counter := Counter{FieldName: dcgmExpGPUInfo, PromType: "gauge"}
+
+	sysInfo := SystemInfo{
+		GPUCount: 2,
+		gOpt:     DeviceOptions{Flex: true},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{
+			GPU:         i,
+			UUID:        fmt.Sprintf("GPU-%d", i),
+			PCI:         dcgm.PCIInfo{BusID: fmt.Sprintf("00000000:%02d:00.0", i+1)},
+			Identifiers: dcgm.DeviceIdentifiers{Serial: fmt.Sprintf("132032600%d", i)},
+		}
+	}
+	// The MIG instances share the info of their GPU
+	sysInfo.GPUs[1].MigEnabled = true
+	sysInfo.GPUs[1].GPUInstances = []GPUInstanceInfo{
+		{Info: dcgm.MigEntityInfo{GpuUuid: "GPU-1", NvmlInstanceId: 1}, ProfileName: "3g.40gb", EntityId: 1},
+		{Info: dcgm.MigEntityInfo{GpuUuid: "GPU-1", NvmlInstanceId: 2}, ProfileName: "3g.40gb", EntityId: 2},
+	}
+
+	defer func() {
+		nvmlGetBoardPartNumberHook = nvmlprovider.GetBoardPartNumber
+	}()
+	nvmlGetBoardPartNumberHook = func(uuid string) (string, error) {
+		if uuid == "GPU-1" {
+			return "", fmt.Errorf("unknown GPU")
+		}
+		return "900-21001-0000-000", nil
+	}
+
+	collector, err := NewGPUInfoCollector([]Counter{counter}, "node", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{SystemInfo: sysInfo})
+	require.NoError(t, err)
+	defer collector.Cleanup()
+
+	metrics, err := collector.GetMetrics()
+	require.NoError(t, err)
+	require.Len(t, metrics[counter], 2)
+
+	m := metrics[counter][0]
+	assert.Equal(t, "1", m.Value)
+	assert.Equal(t, "GPU-0", m.GPUUUID)
+	assert.Equal(t, "00000000:01:00.0", m.GPUPCIBusID)
+	assert.Equal(t, map[string]string{
+		gpuSerialLabel:          "1320326000",
+		gpuBoardPartNumberLabel: "900-21001-0000-000",
+	}, m.Labels)
+
+	// The part number is empty when NVML cannot tell it
+	m = metrics[counter][1]
+	assert.Equal(t, "GPU-1", m.GPUUUID)
+	assert.Empty(t, m.GPUInstanceID)
+	assert.Equal(t, map[string]string{
+		gpuSerialLabel:          "1320326001",
+		gpuBoardPartNumberLabel: "",
+	}, m.Labels)
+
+	_, err = NewGPUInfoCollector([]Counter{{FieldName: dcgmExpFabricManagerStatus}}, "node", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{SystemInfo: sysInfo})
+	assert.Error(t, err)
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	gpuPCIStateLabel    = "state"
+	gpuPCIDriverLabel   = "driver"
+	gpuPCIDeviceIDLabel = "pci_device_id"
+
+	// gpuPCIStateActive is the state of the GPUs visible to DCGM
+	gpuPCIStateActive = "active"
+	// gpuPCIStatePassthrough is the state of the GPUs bound to vfio-pci, e.g. to be passed through to a VM
+	gpuPCIStatePassthrough = "passthrough"
+	// gpuPCIStateUnavailable is the state of the other GPUs, unbound or bound to a driver but invisible to DCGM
+	gpuPCIStateUnavailable = "unavailable"
+
+	nvidiaPCIVendorID = "0x10de"
+	// displayPCIClassPrefix is the prefix of the class of the PCI display controllers, e.g. 0x030200 for 3D
+	// controllers
+	displayPCIClassPrefix = "0x03"
+)
+
+// gpuPCIDevice is an NVIDIA GPU on the PCI bus, as seen by the kernel.
+type gpuPCIDevice struct {
+	// address is the sysfs address of the device, e.g. 0000:3b:00.0
+	address  string
+	deviceID string
+	// driver is the kernel driver the device is bound to, it is empty when the device is unbound
+	driver string
+}
+
+// busID returns the PCI bus ID of the device formatted like DCGM, e.g. 00000000:3B:00.0.
+func (d gpuPCIDevice) busID() string {
+	domain, rest, _ := strings.Cut(strings.ToUpper(d.address), ":")
+	if len(domain) < 8 {
+		domain = strings.Repeat("0", 8-len(domain)) + domain
+	}
+	return domain + ":" + rest
+}
+
+func (d gpuPCIDevice) passthrough() bool {
+	return strings.Contains(d.driver, "vfio")
+}
+
+// listGPUPCIDevices returns the NVIDIA GPUs of the PCI bus, whatever their driver, in the order of their address.
+func listGPUPCIDevices() ([]gpuPCIDevice, error) {
+	entries, err := os.ReadDir(pciDevicesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []gpuPCIDevice
+	for _, entry := range entries {
+		dir := filepath.Join(pciDevicesDir, entry.Name())
+
+		vendor, err := readSysfsValue(filepath.Join(dir, "vendor"))
+		if err != nil || vendor != nvidiaPCIVendorID {
+			continue
+		}
+		class, err := readSysfsValue(filepath.Join(dir, "class"))
+		if err != nil || !strings.HasPrefix(class, displayPCIClassPrefix) {
+			continue
+		}
+
+		device := gpuPCIDevice{address: entry.Name()}
+		device.deviceID, _ = readSysfsValue(filepath.Join(dir, "device"))
+		if driver, err := filepath.EvalSymlinks(filepath.Join(dir, "driver")); err == nil {
+			device.driver = filepath.Base(driver)
+		}
+
+		devices = append(devices, device)
+	}
+
+	slices.SortFunc(devices, func(a, b gpuPCIDevice) int {
+		return strings.Compare(a.address, b.address)
+	})
+
+	return devices, nil
+}
+
+// readSysfsValue reads the value of a sysfs attribute, without its trailing newline.
+func readSysfsValue(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+// gpuPCICollector exports a series per NVIDIA GPU of the PCI bus with its state, so that the GPUs passed through to
+// VMs or invisible to the driver are not silently missing from the inventory of the host.
+type gpuPCICollector struct {
+	expCollector
+}
+
+// IsDCGMExpGPUPCIInfoEnabled checks if the DCGM_EXP_GPU_PCI_INFO counter exists
+func IsDCGMExpGPUPCIInfoEnabled(counters []Counter) bool {
+	return slices.ContainsFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpGPUPCIInfo
+	})
+}
+
+func NewGPUPCICollector(counters []Counter,
+	hostname string,
+	config *Config,
+	fieldEntityGroupTypeSystemInfo FieldEntityGroupTypeSystemInfoItem) (Collector, error) {
+	if !IsDCGMExpGPUPCIInfoEnabled(counters) {
+		logrus.Error(dcgmExpGPUPCIInfo + " collector is disabled")
+		return nil, fmt.Errorf(dcgmExpGPUPCIInfo + " collector is disabled")
+	}
+
+	transformations, err := getTransformations(config)
+	if err != nil {
+		return nil, err
+	}
+
+	collector := gpuPCICollector{
+		expCollector: expCollector{
+			sysInfo:         fieldEntityGroupTypeSystemInfo.SystemInfo,
+			hostname:        hostname,
+			config:          config,
+			transformations: transformations,
+		},
+	}
+
+	collector.counter = counters[slices.IndexFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpGPUPCIInfo
+	})]
+
+	devices, err := listGPUPCIDevices()
+	if err != nil {
+		logrus.WithError(err).Warn("Unable to list the GPUs of the PCI bus")
+	}
+	for _, device := range devices {
+		if device.passthrough() {
+			logrus.Infof("GPU %s is bound to %s, it is passed through and not monitored", device.busID(), device.driver)
+		}
+	}
+
+	return &collector, nil
+}
+
+func (c *gpuPCICollector) GetMetrics() (MetricsByCounter, error) {
+	uuid := "UUID"
+	if c.config.UseOldNamespace {
+		uuid = "uuid"
+	}
+
+	devices, err := listGPUPCIDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the GPUs of the PCI bus; err: %w", err)
+	}
+
+	gpus := map[string]GPUInfo{}
+	for i := uint(0); i < c.sysInfo.GPUCount; i++ {
+		gpus[sysfsPCIAddress(c.sysInfo.GPUs[i].DeviceInfo.PCI.BusID)] = c.sysInfo.GPUs[i]
+	}
+
+	metrics := make(MetricsByCounter)
+	for _, device := range devices {
+		labels := map[string]string{
+			gpuPCIDriverLabel:   device.driver,
+			gpuPCIDeviceIDLabel: device.deviceID,
+		}
+
+		var m Metric
+		if gpu, exists := gpus[device.address]; exists {
+			labels[gpuPCIStateLabel] = gpuPCIStateActive
+			m = c.createMetric(labels, MonitoringInfo{DeviceInfo: gpu.DeviceInfo}, uuid, 1)
+		} else {
+			labels[gpuPCIStateLabel] = gpuPCIStateUnavailable
+			if device.passthrough() {
+				labels[gpuPCIStateLabel] = gpuPCIStatePassthrough
+			}
+			m = Metric{
+				Counter:     c.counter,
+				Value:       "1",
+				UUID:        uuid,
+				GPUPCIBusID: device.busID(),
+				Hostname:    c.hostname,
+				Labels:      labels,
+				Attributes:  map[string]string{},
+			}
+		}
+
+		metrics[c.counter] = append(metrics[c.counter], m)
+	}
+
+	for _, transform := range c.transformations {
+		err := transform.Process(metrics, c.sysInfo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform metrics for transform '%s'; err: %v", transform.Name(), err)
+		}
+	}
+
+	return metrics, nil
+}
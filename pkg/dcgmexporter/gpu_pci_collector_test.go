@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	sysOS "os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePCIDevice writes the sysfs attributes of a PCI device, bound to the driver when it is set.
+func writePCIDevice(t *testing.T, address, vendor, class, device, driver string) {
+	t.Helper()
+
+	dir := filepath.Join(pciDevicesDir, address)
+	require.NoError(t, sysOS.MkdirAll(dir, 0o755))
+	for name, value := range map[string]string{"vendor": vendor, "class": class, "device": device} {
+		require.NoError(t, sysOS.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0o644))
+	}
+
+	if driver != "" {
+		driverDir := filepath.Join(filepath.Dir(pciDevicesDir), "drivers", driver)
+		require.NoError(t, sysOS.MkdirAll(driverDir, 0o755))
+		require.NoError(t, sysOS.Symlink(driverDir, filepath.Join(dir, "driver")))
+	}
+}
+
+func TestGPUPCICollector_GetMetrics(t *testing.T) {
+	defer func(dir string) {
+		pciDevicesDir = dir
+	}(pciDevicesDir)
+	pciDevicesDir = filepath.Join(t.TempDir(), "devices")
+
+	writePCIDevice(t, "0000:07:00.0", "0x10de", "0x030200", "0x2330", "nvidia")
+	writePCIDevice(t, "0000:0a:00.0", "0x10de", "0x030200", "0x2330", "vfio-pci")
+	writePCIDevice(t, "0000:0b:00.0", "0x10de", "0x030000", "0x20b5", "")
+	// The other NVIDIA functions, e.g. the audio of a board, and the other vendors are not GPUs
+	writePCIDevice(t, "0000:07:00.1", "0x10de", "0x040300", "0x22ba", "snd_hda_intel")
+	writePCIDevice(t, "0000:0c:00.0", "0x15b3", "0x020700", "0x1021", "mlx5_core")
+
+	counter := Counter{FieldName: dcgmExpGPUPCIInfo, PromType: "gauge"}
+	sysInfo := SystemInfo{GPUCount: 1}
+	sysInfo.GPUs[0].DeviceInfo = dcgm.Device{
+		GPU:         0,
+		UUID:        "GPU-0",
+		PCI:         dcgm.PCIInfo{BusID: "00000000:07:00.0"},
+		Identifiers: dcgm.DeviceIdentifiers{Model: "NVIDIA H100 80GB HBM3"},
+	}
+
+	collector, err := NewGPUPCICollector([]Counter{counter}, "node", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{SystemInfo: sysInfo})
+	require.NoError(t, err)
+	defer collector.Cleanup()
+
+	metrics, err := collector.GetMetrics()
+	require.NoError(t, err)
+	require.Len(t, metrics[counter], 3)
+
+	m := metrics[counter][0]
+	assert.Equal(t, "1", m.Value)
+	assert.Equal(t, "0", m.GPU)
+	assert.Equal(t, "GPU-0", m.GPUUUID)
+	assert.Equal(t, "NVIDIA H100 80GB HBM3", m.GPUModelName)
+	assert.Equal(t, map[string]string{
+		gpuPCIStateLabel:    gpuPCIStateActive,
+		gpuPCIDriverLabel:   "nvidia",
+		gpuPCIDeviceIDLabel: "0x2330",
+	}, m.Labels)
+
+	m = metrics[counter][1]
+	assert.Empty(t, m.GPUUUID)
+	assert.Equal(t, "00000000:0A:00.0", m.GPUPCIBusID)
+	assert.Equal(t, "node", m.Hostname)
+	assert.Equal(t, map[string]string{
+		gpuPCIStateLabel:    gpuPCIStatePassthrough,
+		gpuPCIDriverLabel:   "vfio-pci",
+		gpuPCIDeviceIDLabel: "0x2330",
+	}, m.Labels)
+
+	m = metrics[counter][2]
+	assert.Equal(t, "00000000:0B:00.0", m.GPUPCIBusID)
+	assert.Equal(t, map[string]string{
+		gpuPCIStateLabel:    gpuPCIStateUnavailable,
+		gpuPCIDriverLabel:   "",
+		gpuPCIDeviceIDLabel: "0x20b5",
+	}, m.Labels)
+
+	_, err = NewGPUPCICollector([]Counter{{FieldName: dcgmExpGPUInfo}}, "node", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{SystemInfo: sysInfo})
+	assert.Error(t, err)
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	numaNodeAttribute    = "numa_node"
+	cpuAffinityAttribute = "cpu_affinity"
+)
+
+// pciDevicesDir is the sysfs directory of the PCI devices, the NUMA node of a GPU is read from it.
+var pciDevicesDir = "/sys/bus/pci/devices"
+
+// PopulateGPUNUMANodes sets the NUMA node of the GPUs from sysfs; it is left empty when the platform does not report
+// it, e.g. on the hosts with a single NUMA node.
+func PopulateGPUNUMANodes(sysInfo *SystemInfo) {
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		gpu := &sysInfo.GPUs[i]
+		node, err := readNUMANode(gpu.DeviceInfo.PCI.BusID)
+		if err != nil {
+			logrus.WithError(err).Debugf("Unable to get the NUMA node of GPU %d", gpu.DeviceInfo.GPU)
+			continue
+		}
+
+		gpu.NUMANode = node
+	}
+}
+
+// sysfsPCIAddress returns the sysfs address of a PCI device, DCGM formats the bus ID in upper case with a domain of 8
+// digits where sysfs uses 4 of them in lower case.
+func sysfsPCIAddress(busID string) string {
+	busID = strings.ToLower(busID)
+	if domain, rest, found := strings.Cut(busID, ":"); found && len(domain) > 4 {
+		busID = domain[len(domain)-4:] + ":" + rest
+	}
+
+	return busID
+}
+
+// readNUMANode returns the NUMA node of the PCI device.
+func readNUMANode(busID string) (string, error) {
+	file, err := os.Open(filepath.Join(pciDevicesDir, sysfsPCIAddress(busID), "numa_node"))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+
+	node := strings.TrimSpace(string(content))
+	if _, err := strconv.Atoi(node); err != nil || node == "-1" {
+		return "", nil
+	}
+
+	return node, nil
+}
+
+// cpuAffinityRanges formats the CPU affinity of a GPU, the set of CPUs reported by DCGM as "{0,1,2,3,8}", as a list
+// of ranges like "0-3,8".
+func cpuAffinityRanges(affinity string) string {
+	affinity = strings.Trim(strings.TrimSpace(affinity), "{}")
+	if affinity == "" {
+		return ""
+	}
+
+	var cpus []int
+	for _, field := range strings.Split(affinity, ",") {
+		cpu, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return ""
+		}
+		cpus = append(cpus, cpu)
+	}
+
+	var ranges []string
+	for start := 0; start < len(cpus); {
+		end := start
+		for end+1 < len(cpus) && cpus[end+1] == cpus[end]+1 {
+			end++
+		}
+
+		if end == start {
+			ranges = append(ranges, strconv.Itoa(cpus[start]))
+		} else {
+			ranges = append(ranges, strconv.Itoa(cpus[start])+"-"+strconv.Itoa(cpus[end]))
+		}
+		start = end + 1
+	}
+
+	return strings.Join(ranges, ",")
+}
+
+// gpuTopologyMapper adds the NUMA node and the CPU affinity of the GPU to the attributes of its metrics, and of the
+// metrics of its MIG instances, so that the throttling of a GPU can be correlated with the placement of the workloads.
+type gpuTopologyMapper struct{}
+
+func newGPUTopologyMapper() *gpuTopologyMapper {
+	return &gpuTopologyMapper{}
+}
+
+func (p *gpuTopologyMapper) Name() string {
+	return "gpuTopologyMapper"
+}
+
+func (p *gpuTopologyMapper) Process(metrics MetricsByCounter, sysInfo SystemInfo) error {
+	topology := map[string]map[string]string{}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		gpu := sysInfo.GPUs[i]
+
+		attributes := map[string]string{}
+		if gpu.NUMANode != "" {
+			attributes[numaNodeAttribute] = gpu.NUMANode
+		}
+		if affinity := cpuAffinityRanges(gpu.DeviceInfo.CPUAffinity); affinity != "" {
+			attributes[cpuAffinityAttribute] = affinity
+		}
+		if len(attributes) > 0 {
+			topology[strconv.FormatUint(uint64(gpu.DeviceInfo.GPU), 10)] = attributes
+		}
+	}
+
+	for _, counterMetrics := range metrics {
+		for i := range counterMetrics {
+			attributes, exists := topology[counterMetrics[i].GPU]
+			if !exists {
+				continue
+			}
+
+			// The attributes are replaced, not modified, as they may be shared between the copies of a metric
+			metric := counterMetrics[i].withAttributes()
+			for k, v := range attributes {
+				metric.Attributes[k] = v
+			}
+			counterMetrics[i] = metric
+		}
+	}
+
+	return nil
+}
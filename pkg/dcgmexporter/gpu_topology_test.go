@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	sysOS "os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPopulateGPUNUMANodes(t *testing.T) {
+	defer func(dir string) {
+		pciDevicesDir = dir
+	}(pciDevicesDir)
+	pciDevicesDir = t.TempDir()
+
+	for busID, node := range map[string]string{"0000:07:00.0": "1\n", "0000:0a:00.0": "-1\n"} {
+		require.NoError(t, sysOS.MkdirAll(filepath.Join(pciDevicesDir, busID), 0o755))
+		require.NoError(t, sysOS.WriteFile(filepath.Join(pciDevicesDir, busID, "numa_node"), []byte(node), 0o644))
+	}
+
+	sysInfo := SystemInfo{GPUCount: 3}
+	sysInfo.GPUs[0].DeviceInfo = dcgm.Device{GPU: 0, PCI: dcgm.PCIInfo{BusID: "00000000:07:00.0"}}
+	sysInfo.GPUs[1].DeviceInfo = dcgm.Device{GPU: 1, PCI: dcgm.PCIInfo{BusID: "00000000:0A:00.0"}}
+	sysInfo.GPUs[2].DeviceInfo = dcgm.Device{GPU: 2, PCI: dcgm.PCIInfo{BusID: "00000000:0B:00.0"}}
+
+	PopulateGPUNUMANodes(&sysInfo)
+
+	assert.Equal(t, "1", sysInfo.GPUs[0].NUMANode)
+	// The platforms without NUMA report -1
+	assert.Equal(t, "", sysInfo.GPUs[1].NUMANode)
+	assert.Equal(t, "", sysInfo.GPUs[2].NUMANode)
+}
+
+func TestCPUAffinityRanges(t *testing.T) {
+	tests := []struct {
+		affinity string
+		want     string
+	}{
+		{affinity: "{0,1,2,3,8,10,11}", want: "0-3,8,10-11"},
+		{affinity: "{5}", want: "5"},
+		{affinity: "{}", want: ""},
+		{affinity: "N/A", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.affinity, func(t *testing.T) {
+			assert.Equal(t, tt.want, cpuAffinityRanges(tt.affinity))
+		})
+	}
+}
+
+func TestGPUTopologyMapper_Process(t *testing.T) {
+	sysInfo := SystemInfo{GPUCount: 2}
+	sysInfo.GPUs[0].DeviceInfo = dcgm.Device{GPU: 0, CPUAffinity: "{0,1,2,3}"}
+	sysInfo.GPUs[0].NUMANode = "0"
+	sysInfo.GPUs[1].DeviceInfo = dcgm.Device{GPU: 1}
+
+	counter := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+	shared := map[string]string{"pod": "trainer"}
+	metrics := MetricsByCounter{counter: {
+		{Counter: counter, GPU: "0", Attributes: shared},
+		{Counter: counter, GPU: "0", GPUInstanceID: "1", MigProfile: "1g.10gb", Attributes: map[string]string{}},
+		{Counter: counter, GPU: "1", Attributes: map[string]string{}},
+	}}
+
+	require.NoError(t, newGPUTopologyMapper().Process(metrics, sysInfo))
+
+	assert.Equal(t, map[string]string{"pod": "trainer", numaNodeAttribute: "0", cpuAffinityAttribute: "0-3"},
+		metrics[counter][0].Attributes)
+	assert.Equal(t, map[string]string{numaNodeAttribute: "0", cpuAffinityAttribute: "0-3"},
+		metrics[counter][1].Attributes)
+	// The GPUs without topology are left unchanged
+	assert.Empty(t, metrics[counter][2].Attributes)
+	// The attributes shared with other copies of the metric are not modified
+	assert.Equal(t, map[string]string{"pod": "trainer"}, shared)
+}
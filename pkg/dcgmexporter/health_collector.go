@@ -0,0 +1,302 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	healthSystemLabel = "system"
+	healthWatchLabel  = "watch"
+	healthLabel       = "health"
+
+	healthSystemOverall = "overall"
+)
+
+// Health results of DCGM, see dcgmHealthResult_t in dcgm_structs.h
+const (
+	healthResultPass = 0
+	healthResultWarn = 10
+	healthResultFail = 20
+)
+
+type healthSystem struct {
+	// dcgmType is the name of the system reported by go-dcgm
+	dcgmType string
+	name     string
+	watch    string
+}
+
+// Source of the watches: https://github.com/NVIDIA/DCGM/blob/master/dcgmlib/dcgm_structs.h
+var healthSystems = []healthSystem{
+	{"PCIe watches", "pcie", "DCGM_HEALTH_WATCH_PCIE"},
+	{"NVLINK watches", "nvlink", "DCGM_HEALTH_WATCH_NVLINK"},
+	{"Power Managemnt unit watches", "pmu", "DCGM_HEALTH_WATCH_PMU"},
+	{"Microcontroller unit watches", "mcu", "DCGM_HEALTH_WATCH_MCU"},
+	{"Memory watches", "memory", "DCGM_HEALTH_WATCH_MEM"},
+	{"Streaming Multiprocessor watches", "sm", "DCGM_HEALTH_WATCH_SM"},
+	{"Inforom watches", "inforom", "DCGM_HEALTH_WATCH_INFOROM"},
+	{"Temperature watches", "thermal", "DCGM_HEALTH_WATCH_THERMAL"},
+	{"Power watches", "power", "DCGM_HEALTH_WATCH_POWER"},
+	{"Driver-related watches", "driver", "DCGM_HEALTH_WATCH_DRIVER"},
+}
+
+var dcgmHealthCheckByGpuIdHook = dcgm.HealthCheckByGpuId
+
+func healthResult(status string) int {
+	switch status {
+	case "Warning":
+		return healthResultWarn
+	case "Failure":
+		return healthResultFail
+	}
+	return healthResultPass
+}
+
+func healthResultLabel(result int) string {
+	if result == healthResultFail {
+		return "failure"
+	}
+	return "warning"
+}
+
+type healthIncidentKey struct {
+	gpu    uint
+	system string
+	health int
+}
+
+// healthCollector enables the DCGM health watches of the GPUs and exports the health of every watched system
+// and the number of incidents reported by the watches.
+type healthCollector struct {
+	expCollector
+
+	statusCounter    *Counter
+	incidentsCounter *Counter
+
+	mtx sync.Mutex
+	// incidents are the incidents reported by the previous check, only new incidents are counted
+	incidents      map[healthIncidentKey]bool
+	incidentsTotal map[healthIncidentKey]int
+	// store persists the incidents across the restarts of the exporter, it is nil when the state is not persisted
+	store *stateStore
+	// loaded holds the GPUs whose incidents were loaded from the store
+	loaded map[uint]bool
+}
+
+// IsDCGMHealthEnabled checks if the DCGM_HEALTH_STATUS or DCGM_HEALTH_INCIDENTS_TOTAL counters exist
+func IsDCGMHealthEnabled(counters []Counter) bool {
+	return slices.ContainsFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmHealthStatus || c.FieldName == dcgmHealthIncidentsTotal
+	})
+}
+
+func NewHealthCollector(counters []Counter,
+	hostname string,
+	config *Config,
+	fieldEntityGroupTypeSystemInfo FieldEntityGroupTypeSystemInfoItem) (Collector, error) {
+	if !IsDCGMHealthEnabled(counters) {
+		logrus.Error(dcgmHealthStatus + " collector is disabled")
+		return nil, fmt.Errorf(dcgmHealthStatus + " collector is disabled")
+	}
+
+	transformations, err := getTransformations(config)
+	if err != nil {
+		return nil, err
+	}
+
+	collector := healthCollector{
+		expCollector: expCollector{
+			sysInfo:         fieldEntityGroupTypeSystemInfo.SystemInfo,
+			hostname:        hostname,
+			config:          config,
+			transformations: transformations,
+		},
+		incidents:      map[healthIncidentKey]bool{},
+		incidentsTotal: map[healthIncidentKey]int{},
+		store:          getStateStore(),
+		loaded:         map[uint]bool{},
+	}
+
+	for i := range counters {
+		switch counters[i].FieldName {
+		case dcgmHealthStatus:
+			collector.statusCounter = &counters[i]
+		case dcgmHealthIncidentsTotal:
+			collector.incidentsCounter = &counters[i]
+		}
+	}
+
+	return &collector, nil
+}
+
+func (c *healthCollector) GetMetrics() (MetricsByCounter, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	uuid := "UUID"
+	if c.config.UseOldNamespace {
+		uuid = "uuid"
+	}
+
+	metrics := make(MetricsByCounter)
+	incidents := map[healthIncidentKey]bool{}
+	checked := map[uint]bool{}
+
+	for _, mi := range GetMonitoredEntities(c.sysInfo) {
+		gpu := mi.DeviceInfo.GPU
+		if checked[gpu] {
+			continue
+		}
+		checked[gpu] = true
+
+		// Health watches are set on the GPUs, the MIG instances share the health of their GPU
+		mi.InstanceInfo = nil
+		c.loadIncidents(gpu, mi)
+
+		health, err := dcgmHealthCheckByGpuIdHook(gpu)
+		if err != nil {
+			logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(), "Unable to check health of GPU %d", gpu)
+			// Keep the incidents of the GPU, so that they are not counted again by the next check
+			for key := range c.incidents {
+				if key.gpu == gpu {
+					incidents[key] = true
+				}
+			}
+			continue
+		}
+
+		results := map[string]int{}
+		for _, watch := range health.Watches {
+			i := slices.IndexFunc(healthSystems, func(system healthSystem) bool {
+				return system.dcgmType == watch.Type
+			})
+			if i < 0 {
+				continue
+			}
+			system := healthSystems[i]
+
+			result := healthResult(watch.Status)
+			results[system.name] = max(results[system.name], result)
+
+			key := healthIncidentKey{gpu: gpu, system: system.name, health: result}
+			if result != healthResultPass && !incidents[key] {
+				incidents[key] = true
+				if !c.incidents[key] {
+					c.incidentsTotal[key]++
+				}
+			}
+		}
+
+		c.saveIncidents(gpu, mi, incidents)
+
+		if c.statusCounter != nil {
+			m := c.createMetric(map[string]string{
+				healthSystemLabel: healthSystemOverall,
+				healthWatchLabel:  "DCGM_HEALTH_WATCH_ALL",
+			}, mi, uuid, healthResult(health.Status))
+			m.Counter = *c.statusCounter
+			metrics[m.Counter] = append(metrics[m.Counter], m)
+
+			for _, system := range healthSystems {
+				m := c.createMetric(map[string]string{
+					healthSystemLabel: system.name,
+					healthWatchLabel:  system.watch,
+				}, mi, uuid, results[system.name])
+				m.Counter = *c.statusCounter
+				metrics[m.Counter] = append(metrics[m.Counter], m)
+			}
+		}
+
+		if c.incidentsCounter != nil {
+			for _, system := range healthSystems {
+				for _, result := range []int{healthResultWarn, healthResultFail} {
+					total := c.incidentsTotal[healthIncidentKey{gpu: gpu, system: system.name, health: result}]
+					m := c.createMetric(map[string]string{
+						healthSystemLabel: system.name,
+						healthWatchLabel:  system.watch,
+						healthLabel:       healthResultLabel(result),
+					}, mi, uuid, total)
+					m.Counter = *c.incidentsCounter
+					metrics[m.Counter] = append(metrics[m.Counter], m)
+				}
+			}
+		}
+	}
+
+	c.incidents = incidents
+
+	for _, transform := range c.transformations {
+		err := transform.Process(metrics, c.sysInfo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform metrics for transform '%s'; err: %v", transform.Name(), err)
+		}
+	}
+
+	return metrics, nil
+}
+
+// loadIncidents loads the incidents of the GPU counted by the previous runs of the exporter, and the incidents
+// ongoing when it stopped, so that they are not counted again.
+func (c *healthCollector) loadIncidents(gpu uint, mi MonitoringInfo) {
+	if c.store == nil || c.loaded[gpu] {
+		return
+	}
+	c.loaded[gpu] = true
+
+	for _, system := range healthSystems {
+		for _, result := range []int{healthResultWarn, healthResultFail} {
+			key := healthIncidentKey{gpu: gpu, system: system.name, health: result}
+			if state, ok := c.store.get(healthIncidentStateKey(mi, key)); ok && len(state) == 2 {
+				c.incidentsTotal[key] = int(state[0])
+				c.incidents[key] = state[1] == 1
+			}
+		}
+	}
+}
+
+// saveIncidents stores the incidents of the GPU that started or ended in the check.
+func (c *healthCollector) saveIncidents(gpu uint, mi MonitoringInfo, incidents map[healthIncidentKey]bool) {
+	if c.store == nil {
+		return
+	}
+
+	for _, system := range healthSystems {
+		for _, result := range []int{healthResultWarn, healthResultFail} {
+			key := healthIncidentKey{gpu: gpu, system: system.name, health: result}
+			if incidents[key] == c.incidents[key] {
+				continue
+			}
+
+			ongoing := 0.0
+			if incidents[key] {
+				ongoing = 1
+			}
+			c.store.set(healthIncidentStateKey(mi, key), float64(c.incidentsTotal[key]), ongoing)
+		}
+	}
+}
+
+func healthIncidentStateKey(mi MonitoringInfo, key healthIncidentKey) string {
+	return "health_incidents/" + entityStateKey(mi) + "/" + key.system + "/" + healthResultLabel(key.health)
+}
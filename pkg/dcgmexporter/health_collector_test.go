@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func healthMetricValues(metrics []Metric) map[string]string {
+	values := map[string]string{}
+	for _, metric := range metrics {
+		key := metric.GPU + "/" + metric.Labels[healthSystemLabel]
+		if health, exists := metric.Labels[healthLabel]; exists {
+			key += "/" + health
+		}
+		values[key] = metric.Value
+	}
+	return values
+}
+
+func TestHealthCollector_GetMetrics(t *testing.T) {
+	statusCounter := Counter{FieldName: dcgmHealthStatus, PromType: "gauge"}
+	incidentsCounter := Counter{FieldName: dcgmHealthIncidentsTotal, PromType: "counter"}
+
+	sysInfo := SystemInfo{
+		GPUCount: 2,
+		gOpt:     DeviceOptions{Flex: true},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i, UUID: fmt.Sprintf("GPU-%d", i)}
+	}
+
+	collector, err := NewHealthCollector([]Counter{statusCounter, incidentsCounter}, "node", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{SystemInfo: sysInfo})
+	require.NoError(t, err)
+	defer collector.Cleanup()
+
+	checks := []map[uint]dcgm.DeviceHealth{
+		{
+			0: {GPU: 0, Status: "Warning", Watches: []dcgm.SystemWatch{
+				{Type: "PCIe watches", Status: "Warning", Error: "PCIe replay rate"},
+			}},
+			1: {GPU: 1, Status: "Healthy"},
+		},
+		{
+			0: {GPU: 0, Status: "Failure", Watches: []dcgm.SystemWatch{
+				{Type: "PCIe watches", Status: "Warning", Error: "PCIe replay rate"},
+				{Type: "Memory watches", Status: "Failure", Error: "DBE"},
+			}},
+		},
+	}
+
+	defer func() {
+		dcgmHealthCheckByGpuIdHook = dcgm.HealthCheckByGpuId
+	}()
+
+	var metrics MetricsByCounter
+	for _, check := range checks {
+		check := check
+		dcgmHealthCheckByGpuIdHook = func(gpu uint) (dcgm.DeviceHealth, error) {
+			health, exists := check[gpu]
+			if !exists {
+				return dcgm.DeviceHealth{}, fmt.Errorf("GPU %d is lost", gpu)
+			}
+			return health, nil
+		}
+
+		metrics, err = collector.GetMetrics()
+		require.NoError(t, err)
+	}
+
+	status := healthMetricValues(metrics[statusCounter])
+	assert.Len(t, status, len(healthSystems)+1)
+	assert.Equal(t, "20", status["0/overall"])
+	assert.Equal(t, "10", status["0/pcie"])
+	assert.Equal(t, "20", status["0/memory"])
+	assert.Equal(t, "0", status["0/thermal"])
+
+	incidents := healthMetricValues(metrics[incidentsCounter])
+	assert.Len(t, incidents, 2*len(healthSystems))
+	// The PCIe warning persists and is counted once
+	assert.Equal(t, "1", incidents["0/pcie/warning"])
+	assert.Equal(t, "1", incidents["0/memory/failure"])
+	assert.Equal(t, "0", incidents["0/memory/warning"])
+
+	for _, metric := range metrics[statusCounter] {
+		assert.Equal(t, "GPU-0", metric.GPUUUID)
+		assert.Equal(t, "node", metric.Hostname)
+	}
+}
+
+func TestHealthCollector_StateStore(t *testing.T) {
+	incidentsCounter := Counter{FieldName: dcgmHealthIncidentsTotal, PromType: "counter"}
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	sysInfo := SystemInfo{GPUCount: 1, gOpt: DeviceOptions{Flex: true}}
+	sysInfo.GPUs[0].DeviceInfo = dcgm.Device{GPU: 0, UUID: "GPU-0"}
+
+	defer func() {
+		dcgmHealthCheckByGpuIdHook = dcgm.HealthCheckByGpuId
+	}()
+
+	check := func(collector Collector, status string) string {
+		dcgmHealthCheckByGpuIdHook = func(gpu uint) (dcgm.DeviceHealth, error) {
+			health := dcgm.DeviceHealth{GPU: gpu, Status: status}
+			if status != "Healthy" {
+				health.Watches = []dcgm.SystemWatch{{Type: "PCIe watches", Status: status}}
+			}
+			return health, nil
+		}
+
+		metrics, err := collector.GetMetrics()
+		require.NoError(t, err)
+		return healthMetricValues(metrics[incidentsCounter])["0/pcie/warning"]
+	}
+
+	run := func(statuses ...string) []string {
+		cleanup, err := OpenStateStore(path, 0)
+		require.NoError(t, err)
+		defer cleanup()
+
+		collector, err := NewHealthCollector([]Counter{incidentsCounter}, "node", &Config{},
+			FieldEntityGroupTypeSystemInfoItem{SystemInfo: sysInfo})
+		require.NoError(t, err)
+		defer collector.Cleanup()
+
+		var totals []string
+		for _, status := range statuses {
+			totals = append(totals, check(collector, status))
+		}
+		return totals
+	}
+
+	assert.Equal(t, []string{"1", "1"}, run("Warning", "Warning"))
+	// The ongoing incident is not counted again after a restart
+	assert.Equal(t, []string{"1", "1", "2"}, run("Warning", "Healthy", "Warning"))
+}
+
+func TestNewHealthCollector_Disabled(t *testing.T) {
+	_, err := NewHealthCollector([]Counter{{FieldName: dcgmExpXIDErrorsCount}}, "node", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{})
+	assert.Error(t, err)
+}
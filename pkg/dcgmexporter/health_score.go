@@ -0,0 +1,244 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	dcgmExpGPUHealthScore             = "DCGM_EXP_GPU_HEALTH_SCORE"
+	dcgmExpGPUHealthRuleFailing       = "DCGM_EXP_GPU_HEALTH_RULE_FAILING"
+	dcgmExpGPURetirementRecommended   = "DCGM_EXP_GPU_RETIREMENT_RECOMMENDED"
+	maxHealthScore                    = 100
+	defaultHealthScoreRetirementBelow = 50
+)
+
+var (
+	healthScoreCounter = Counter{
+		FieldName: dcgmExpGPUHealthScore,
+		PromType:  "gauge",
+		Help:      "Health score of the GPU, 100 minus the penalties of the failing health rules, down to 0.",
+	}
+	healthRuleFailingCounter = Counter{
+		FieldName: dcgmExpGPUHealthRuleFailing,
+		PromType:  "gauge",
+		Help:      "Whether the health rule fails for the GPU, 1 when it fails.",
+	}
+	retirementRecommendedCounter = Counter{
+		FieldName: dcgmExpGPURetirementRecommended,
+		PromType:  "gauge",
+		Help:      "Whether the health score of the GPU recommends draining and retiring it, 1 when it does.",
+	}
+)
+
+// healthScoreConfig is the format of the health score rules file.
+type healthScoreConfig struct {
+	Rules []healthRuleConfig `json:"rules"`
+	// RetirementBelow is the score under which the retirement of the GPU is recommended, 50 by default
+	RetirementBelow *float64 `json:"retirement_below"`
+}
+
+type healthRuleConfig struct {
+	Name string `json:"name"`
+	// Expr is computed from the metrics of the device like the derived metrics, e.g. rate(DCGM_FI_DEV_XID_ERRORS)
+	Expr string `json:"expr"`
+	// The rule fails when the value of the expression is above or below the thresholds that are set
+	Above *float64 `json:"above"`
+	Below *float64 `json:"below"`
+	// Penalty is subtracted from the score when the rule fails
+	Penalty float64 `json:"penalty"`
+}
+
+type healthRule struct {
+	config  healthRuleConfig
+	expr    derivedExpr
+	metrics []string
+}
+
+func (r healthRule) failing(value float64) bool {
+	return (r.config.Above != nil && value > *r.config.Above) || (r.config.Below != nil && value < *r.config.Below)
+}
+
+// HealthScore scores the health of every device from the rules of the health score rules file, at every
+// collection, so that the drain automation can act on one metric instead of the ECC, row remapping, XID and
+// violation metrics.
+type HealthScore struct {
+	rules           []healthRule
+	retirementBelow float64
+	// previous holds the values of the last collection by device, for delta and rate
+	previous map[string]derivedDevice
+	now      func() time.Time
+}
+
+// NewHealthScore loads the health score rules file.
+func NewHealthScore(c *Config) (*HealthScore, error) {
+	file, err := os.Open(c.HealthScoreRules)
+	if err != nil {
+		return nil, fmt.Errorf("could not open health score rules '%s'; err: %w", c.HealthScoreRules, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read health score rules '%s'; err: %w", c.HealthScoreRules, err)
+	}
+
+	var config healthScoreConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("could not parse health score rules '%s'; err: %w", c.HealthScoreRules, err)
+	}
+
+	if len(config.Rules) == 0 {
+		return nil, fmt.Errorf("invalid health score rules '%s'; err: no rule", c.HealthScoreRules)
+	}
+
+	h := &HealthScore{
+		retirementBelow: defaultHealthScoreRetirementBelow,
+		previous:        map[string]derivedDevice{},
+		now:             time.Now,
+	}
+	if config.RetirementBelow != nil {
+		h.retirementBelow = *config.RetirementBelow
+	}
+
+	names := map[string]bool{}
+	for i, ruleConfig := range config.Rules {
+		rule, err := newHealthRule(ruleConfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %d of health score rules '%s'; err: %w", i, c.HealthScoreRules, err)
+		}
+		if names[ruleConfig.Name] {
+			return nil, fmt.Errorf("invalid rule %d of health score rules '%s'; err: duplicated name '%s'",
+				i, c.HealthScoreRules, ruleConfig.Name)
+		}
+		names[ruleConfig.Name] = true
+
+		h.rules = append(h.rules, rule)
+	}
+
+	return h, nil
+}
+
+func newHealthRule(c healthRuleConfig) (healthRule, error) {
+	if c.Name == "" {
+		return healthRule{}, fmt.Errorf("missing name")
+	}
+
+	if c.Above == nil && c.Below == nil {
+		return healthRule{}, fmt.Errorf("missing above or below threshold")
+	}
+
+	if c.Penalty < 0 {
+		return healthRule{}, fmt.Errorf("invalid penalty %v, expected a positive number", c.Penalty)
+	}
+
+	expr, err := parseDerivedExpr(c.Expr)
+	if err != nil {
+		return healthRule{}, fmt.Errorf("invalid expr '%s'; err: %w", c.Expr, err)
+	}
+
+	var names []string
+	expr.metrics(&names)
+	if len(names) == 0 {
+		return healthRule{}, fmt.Errorf("invalid expr '%s'; err: no metric", c.Expr)
+	}
+
+	return healthRule{config: c, expr: expr, metrics: names}, nil
+}
+
+func (h *HealthScore) Name() string {
+	return "healthScore"
+}
+
+func (h *HealthScore) Process(metrics MetricsByCounter, _ SystemInfo) error {
+	devices, keys := derivedDevices(metrics, h.now())
+
+	for _, key := range keys {
+		device := devices[key]
+		env := derivedEnv{current: device}
+		if previous, exists := h.previous[key]; exists {
+			env.previous = &previous
+		}
+
+		// The device is scored when one of its rules can be evaluated, with the labels of the first metric of the
+		// first rule evaluated
+		var template *Metric
+		score := float64(maxHealthScore)
+		for _, rule := range h.rules {
+			value, ok := rule.expr.eval(env)
+			if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+				continue
+			}
+
+			if template == nil {
+				metric := device.metrics[rule.metrics[0]]
+				template = &metric
+			}
+
+			failing := 0.0
+			if rule.failing(value) {
+				failing = 1
+				score -= rule.config.Penalty
+			}
+
+			metric := healthScoreMetric(*template, healthRuleFailingCounter, failing)
+			metric.Labels["rule"] = rule.config.Name
+			metrics[healthRuleFailingCounter] = append(metrics[healthRuleFailingCounter], metric)
+		}
+
+		if template == nil {
+			continue
+		}
+
+		score = math.Max(score, 0)
+		metrics[healthScoreCounter] = append(metrics[healthScoreCounter],
+			healthScoreMetric(*template, healthScoreCounter, score))
+
+		recommended := 0.0
+		if score < h.retirementBelow {
+			recommended = 1
+		}
+		metrics[retirementRecommendedCounter] = append(metrics[retirementRecommendedCounter],
+			healthScoreMetric(*template, retirementRecommendedCounter, recommended))
+	}
+
+	h.previous = devices
+
+	return nil
+}
+
+// healthScoreMetric returns a metric of the device of the template.
+func healthScoreMetric(template Metric, counter Counter, value float64) Metric {
+	metric := template
+	metric.Counter = counter
+	metric.Value = fmt.Sprintf("%f", value)
+	metric.Labels = copyLabels(metric.Labels)
+	if metric.Labels == nil {
+		metric.Labels = map[string]string{}
+	}
+	metric.Attributes = copyLabels(metric.Attributes)
+	metric.Exemplar = nil
+	metric.ExemplarTimestamp = time.Time{}
+
+	return metric
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	sysOS "os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHealthScore(t *testing.T, config string) (*HealthScore, error) {
+	t.Helper()
+
+	rulesFile := filepath.Join(t.TempDir(), "health.yaml")
+	require.NoError(t, sysOS.WriteFile(rulesFile, []byte(config), 0o644))
+
+	return NewHealthScore(&Config{HealthScoreRules: rulesFile})
+}
+
+func TestNewHealthScoreErrors(t *testing.T) {
+	for _, config := range []string{
+		"rules: []\n",
+		"rules:\n- expr: A\n  above: 0\n",
+		"rules:\n- name: a\n  expr: A\n",
+		"rules:\n- name: a\n  expr: A\n  above: 0\n  penalty: -1\n",
+		"rules:\n- name: a\n  expr: 1 + 2\n  above: 0\n",
+		"rules:\n- name: a\n  expr: A\n  above: 0\n- name: a\n  expr: B\n  above: 0\n",
+		"rules:\n- name: a\n  expr: A\n  above: 0\n  weight: 10\n",
+	} {
+		_, err := newTestHealthScore(t, config)
+		assert.Error(t, err, config)
+	}
+
+	// The example rules are valid
+	_, err := NewHealthScore(&Config{HealthScoreRules: "../../etc/health-score-rules.yaml"})
+	assert.NoError(t, err)
+}
+
+func TestHealthScore_Process(t *testing.T) {
+	healthScore, err := newTestHealthScore(t, `
+retirement_below: 60
+rules:
+- name: row_remap_failure
+  expr: DCGM_FI_DEV_ROW_REMAP_FAILURE
+  above: 0
+  penalty: 100
+- name: xid_errors
+  expr: DCGM_FI_DEV_XID_ERRORS
+  above: 0
+  penalty: 30
+- name: thermal_violations
+  expr: rate(DCGM_FI_DEV_THERMAL_VIOLATION)
+  above: 100000
+  penalty: 20
+`)
+	require.NoError(t, err)
+
+	now := time.Unix(100, 0)
+	healthScore.now = func() time.Time { return now }
+
+	remapFailure := Counter{FieldName: "DCGM_FI_DEV_ROW_REMAP_FAILURE", PromType: "gauge"}
+	xid := Counter{FieldName: "DCGM_FI_DEV_XID_ERRORS", PromType: "gauge"}
+	thermal := Counter{FieldName: "DCGM_FI_DEV_THERMAL_VIOLATION", PromType: "counter"}
+	temp := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+
+	collect := func(thermalValue string) MetricsByCounter {
+		metric := func(gpu, value string) Metric {
+			return Metric{GPU: gpu, Value: value, Labels: map[string]string{"driver": "550"}}
+		}
+		metrics := MetricsByCounter{
+			remapFailure: {metric("0", "0"), metric("1", "1")},
+			xid:          {metric("0", "43"), metric("1", "0")},
+			thermal:      {metric("0", thermalValue), metric("1", "0")},
+			// The GPU without the metrics of the rules is not scored
+			temp: {metric("2", "40")},
+		}
+		require.NoError(t, healthScore.Process(metrics, SystemInfo{}))
+		return metrics
+	}
+
+	scored := func(counter Counter, gpu, value string, labels map[string]string) Metric {
+		labels["driver"] = "550"
+		return Metric{Counter: counter, GPU: gpu, Value: value, Labels: labels}
+	}
+
+	// The rates are evaluated from the second collection
+	metrics := collect("1000000")
+	assert.Equal(t, []Metric{
+		scored(healthScoreCounter, "0", "70.000000", map[string]string{}),
+		scored(healthScoreCounter, "1", "0.000000", map[string]string{}),
+	}, metrics[healthScoreCounter])
+	assert.Equal(t, []Metric{
+		scored(retirementRecommendedCounter, "0", "0.000000", map[string]string{}),
+		scored(retirementRecommendedCounter, "1", "1.000000", map[string]string{}),
+	}, metrics[retirementRecommendedCounter])
+	assert.Equal(t, []Metric{
+		scored(healthRuleFailingCounter, "0", "0.000000", map[string]string{"rule": "row_remap_failure"}),
+		scored(healthRuleFailingCounter, "0", "1.000000", map[string]string{"rule": "xid_errors"}),
+		scored(healthRuleFailingCounter, "1", "1.000000", map[string]string{"rule": "row_remap_failure"}),
+		scored(healthRuleFailingCounter, "1", "0.000000", map[string]string{"rule": "xid_errors"}),
+	}, metrics[healthRuleFailingCounter])
+
+	// GPU 0 was throttled 20% of the time
+	now = now.Add(10 * time.Second)
+	metrics = collect("3000000")
+	assert.Equal(t, []Metric{
+		scored(healthScoreCounter, "0", "50.000000", map[string]string{}),
+		scored(healthScoreCounter, "1", "0.000000", map[string]string{}),
+	}, metrics[healthScoreCounter])
+	assert.Equal(t, []Metric{
+		scored(retirementRecommendedCounter, "0", "1.000000", map[string]string{}),
+		scored(retirementRecommendedCounter, "1", "1.000000", map[string]string{}),
+	}, metrics[retirementRecommendedCounter])
+	assert.Contains(t, metrics[healthRuleFailingCounter],
+		scored(healthRuleFailingCounter, "0", "1.000000", map[string]string{"rule": "thermal_violations"}))
+}
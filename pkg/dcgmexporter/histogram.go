@@ -0,0 +1,221 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+const (
+	histogramPromType = "histogram"
+	// histogramBucketAttribute is the label of the upper bound of the buckets
+	histogramBucketAttribute = "le"
+)
+
+// defaultHistogramBuckets split the ratios of the profiling fields, e.g. DCGM_FI_PROF_SM_ACTIVE, in tenths.
+var defaultHistogramBuckets = []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1}
+
+// parseHistogramBuckets parses the optional fifth column of a histogram counter, the space-separated upper bounds of
+// its buckets in increasing order.
+func parseHistogramBuckets(value string) ([]float64, error) {
+	if value == "" {
+		return defaultHistogramBuckets, nil
+	}
+
+	var buckets []float64
+	for _, field := range strings.Fields(value) {
+		bound, err := strconv.ParseFloat(field, 64)
+		if err != nil || math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return nil, fmt.Errorf("invalid bucket '%s'", field)
+		}
+		if len(buckets) > 0 && bound <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("the buckets must be in increasing order, %s is after %s", field,
+				strconv.FormatFloat(buckets[len(buckets)-1], 'f', -1, 64))
+		}
+		buckets = append(buckets, bound)
+	}
+
+	return buckets, nil
+}
+
+// column returns the i-th column of a record, empty when the record is shorter.
+func column(record []string, i int) string {
+	if i < len(record) {
+		return record[i]
+	}
+	return ""
+}
+
+func (cs *CounterSet) setHistogram(fieldID dcgm.Short, buckets []float64) {
+	if buckets == nil {
+		return
+	}
+
+	if cs.Histograms == nil {
+		cs.Histograms = map[dcgm.Short][]float64{}
+	}
+	cs.Histograms[fieldID] = buckets
+}
+
+// fieldHistogram is the distribution of the samples of a field read over the last collect interval.
+type fieldHistogram struct {
+	buckets []float64
+	// counts are the cumulative numbers of samples lower or equal to the buckets
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// histograms returns the histograms of the samples of the fields of the entity, by field. It returns nil when no
+// field is exported as a histogram.
+func (a *fieldAggregator) histograms(entity dcgm.GroupEntityPair, parentID uint) map[dcgm.Short]fieldHistogram {
+	if a == nil || len(a.buckets) == 0 {
+		return nil
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	histograms := map[dcgm.Short]fieldHistogram{}
+	for fieldID, buckets := range a.buckets {
+		samples := a.samples[fieldSeriesKey{entity: entity, parentID: parentID, fieldID: uint(fieldID)}]
+		if len(samples) == 0 {
+			continue
+		}
+
+		histogram := fieldHistogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+		for _, sample := range samples {
+			for i, bound := range buckets {
+				if sample.value <= bound {
+					histogram.counts[i]++
+				}
+			}
+			histogram.sum += sample.value
+			histogram.count++
+		}
+		histograms[fieldID] = histogram
+	}
+
+	return histograms
+}
+
+// toHistogramMetrics replaces the metrics of the histogram counters with the samples of their histogram. The metrics
+// without samples are dropped, they would not be valid histograms.
+func toHistogramMetrics(metrics MetricsByCounter, histograms map[dcgm.Short]fieldHistogram) MetricsByCounter {
+	for counter, counterMetrics := range metrics {
+		if counter.PromType != histogramPromType {
+			continue
+		}
+
+		histogram, exists := histograms[counter.FieldID]
+		if !exists {
+			delete(metrics, counter)
+			continue
+		}
+
+		expanded := make([]Metric, 0, len(counterMetrics)*(len(histogram.buckets)+3))
+		for _, metric := range counterMetrics {
+			expanded = append(expanded, histogramMetrics(metric, histogram)...)
+		}
+		metrics[counter] = expanded
+	}
+
+	return metrics
+}
+
+// histogramMetrics returns the _bucket, _sum and _count samples of the histogram of a metric.
+func histogramMetrics(metric Metric, histogram fieldHistogram) []Metric {
+	sample := func(suffix, value string) Metric {
+		m := metric.withAttributes()
+		m.Suffix = suffix
+		m.Value = value
+		m.Exemplar = nil
+		m.ExemplarTimestamp = time.Time{}
+		return m
+	}
+
+	metrics := make([]Metric, 0, len(histogram.buckets)+3)
+	for i, bound := range histogram.buckets {
+		bucket := sample("_bucket", strconv.FormatUint(histogram.counts[i], 10))
+		bucket.Attributes[histogramBucketAttribute] = strconv.FormatFloat(bound, 'f', -1, 64)
+		metrics = append(metrics, bucket)
+	}
+
+	count := strconv.FormatUint(histogram.count, 10)
+	bucket := sample("_bucket", count)
+	bucket.Attributes[histogramBucketAttribute] = "+Inf"
+
+	return append(metrics, bucket,
+		sample("_sum", strconv.FormatFloat(histogram.sum, 'g', -1, 64)),
+		sample("_count", count))
+}
+
+// withoutHistograms exports the histogram counters of the entities without histograms, e.g. the NvSwitches, as
+// gauges of their last value.
+func withoutHistograms(counters []Counter) []Counter {
+	result := make([]Counter, len(counters))
+	for i, counter := range counters {
+		if counter.PromType == histogramPromType {
+			counter.PromType = "gauge"
+		}
+		result[i] = counter
+	}
+
+	return result
+}
+
+// flattenHistograms groups the samples of the histograms by their name, e.g. DCGM_FI_PROF_SM_ACTIVE_bucket, for the
+// sinks exporting one series per counter.
+func flattenHistograms(metrics MetricsByCounter) MetricsByCounter {
+	var flattened MetricsByCounter
+	for counter, counterMetrics := range metrics {
+		if counter.PromType != histogramPromType {
+			continue
+		}
+
+		if flattened == nil {
+			flattened = make(MetricsByCounter, len(metrics))
+			for c, m := range metrics {
+				if c.PromType != histogramPromType {
+					flattened[c] = m
+				}
+			}
+		}
+
+		for _, metric := range counterMetrics {
+			sampleCounter := counter
+			sampleCounter.FieldName += metric.Suffix
+			sampleCounter.PromType = "gauge"
+
+			metric.Counter = sampleCounter
+			metric.Suffix = ""
+			flattened[sampleCounter] = append(flattened[sampleCounter], metric)
+		}
+	}
+
+	if flattened == nil {
+		return metrics
+	}
+
+	return flattened
+}
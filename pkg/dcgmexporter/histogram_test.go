@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractCountersHistogram(t *testing.T) {
+	cs, err := extractCounters([][]string{
+		{"DCGM_FI_DEV_MEM_COPY_UTIL", "histogram", "memory utilization distribution", "100ms"},
+		{"DCGM_FI_DEV_GPU_UTIL", "histogram", "utilization distribution", "", "25 50 75 100"},
+		{"DCGM_FI_DEV_POWER_USAGE", "gauge", "power", "", "max"},
+	}, &Config{})
+	require.NoError(t, err)
+	assert.Equal(t, map[dcgm.Short][]float64{
+		dcgm.DCGM_FI_DEV_MEM_COPY_UTIL: defaultHistogramBuckets,
+		dcgm.DCGM_FI_DEV_GPU_UTIL:      {25, 50, 75, 100},
+	}, cs.Histograms)
+	assert.Equal(t, map[dcgm.Short]string{dcgm.DCGM_FI_DEV_POWER_USAGE: AggregationMax}, cs.Aggregations)
+
+	for _, buckets := range []string{"50 25", "25 25", "a", "1 +Inf"} {
+		_, err = extractCounters([][]string{{"DCGM_FI_DEV_GPU_UTIL", "histogram", "utilization", "", buckets}},
+			&Config{})
+		assert.Error(t, err, buckets)
+	}
+}
+
+func TestFieldAggregator_Histograms(t *testing.T) {
+	assert.Nil(t, (*fieldAggregator)(nil).histograms(dcgm.GroupEntityPair{}, PARENT_ID_IGNORED))
+
+	aggregator := newFieldAggregator(&Config{
+		CollectInterval: 1000,
+		FieldHistograms: map[dcgm.Short][]float64{dcgm.DCGM_FI_PROF_SM_ACTIVE: {0.25, 0.5, 1}},
+	})
+	require.NotNil(t, aggregator)
+	gpu := dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU, EntityId: 0}
+
+	assert.Empty(t, aggregator.histograms(gpu, PARENT_ID_IGNORED))
+
+	for i, activity := range []float64{0.1, 0.3, 0.9, 0.2} {
+		value := doubleFieldValue(activity)
+		value.FieldId = uint(dcgm.DCGM_FI_PROF_SM_ACTIVE)
+		value.Ts = int64(1_000_000 + i*100_000)
+
+		// The value of the histograms is left unchanged
+		values := aggregator.aggregate(gpu, PARENT_ID_IGNORED, []dcgm.FieldValue_v1{value})
+		assert.Equal(t, activity, values[0].Float64())
+	}
+
+	histogram, exists := aggregator.histograms(gpu, PARENT_ID_IGNORED)[dcgm.DCGM_FI_PROF_SM_ACTIVE]
+	require.True(t, exists)
+	assert.Equal(t, []uint64{2, 3, 4}, histogram.counts)
+	assert.Equal(t, uint64(4), histogram.count)
+	assert.InDelta(t, 1.5, histogram.sum, 1e-9)
+}
+
+func TestToHistogramMetrics(t *testing.T) {
+	smActive := Counter{FieldID: dcgm.DCGM_FI_PROF_SM_ACTIVE, FieldName: "DCGM_FI_PROF_SM_ACTIVE", PromType: "histogram",
+		Help: "SM activity distribution."}
+	temp := Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge",
+		Help: "Temperature."}
+	util := Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_UTIL, FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "histogram",
+		Help: "Utilization distribution."}
+
+	device := Metric{GPU: "0", UUID: "UUID", GPUUUID: "GPU-0", GPUDevice: "nvidia0", GPUModelName: "A100",
+		Attributes: map[string]string{}}
+	metric := func(counter Counter, value string) Metric {
+		m := device.withAttributes()
+		m.Counter = counter
+		m.Value = value
+		return m
+	}
+
+	metrics := toHistogramMetrics(MetricsByCounter{
+		smActive: {metric(smActive, "0.2")},
+		temp:     {metric(temp, "40")},
+		// Without samples, e.g. with a non numeric value
+		util: {metric(util, "N/A")},
+	}, map[dcgm.Short]fieldHistogram{
+		dcgm.DCGM_FI_PROF_SM_ACTIVE: {buckets: []float64{0.25, 0.5}, counts: []uint64{2, 3}, sum: 1.5, count: 4},
+	})
+	assert.NotContains(t, metrics, util)
+	require.Len(t, metrics[smActive], 5)
+
+	tmpl := newMetricsTemplate("migMetrics", migMetricsFormat)
+	formatted, err := FormatMetrics(tmpl, MetricsByCounter{smActive: metrics[smActive]})
+	require.NoError(t, err)
+	assert.Equal(t, `# HELP DCGM_FI_PROF_SM_ACTIVE SM activity distribution.
+# TYPE DCGM_FI_PROF_SM_ACTIVE histogram
+DCGM_FI_PROF_SM_ACTIVE_bucket{gpu="0",UUID="GPU-0",pci_bus_id="",device="nvidia0",modelName="A100",le="0.25"} 2
+DCGM_FI_PROF_SM_ACTIVE_bucket{gpu="0",UUID="GPU-0",pci_bus_id="",device="nvidia0",modelName="A100",le="0.5"} 3
+DCGM_FI_PROF_SM_ACTIVE_bucket{gpu="0",UUID="GPU-0",pci_bus_id="",device="nvidia0",modelName="A100",le="+Inf"} 4
+DCGM_FI_PROF_SM_ACTIVE_sum{gpu="0",UUID="GPU-0",pci_bus_id="",device="nvidia0",modelName="A100"} 1.5
+DCGM_FI_PROF_SM_ACTIVE_count{gpu="0",UUID="GPU-0",pci_bus_id="",device="nvidia0",modelName="A100"} 4
+`, formatted)
+
+	// The sinks get a series per sample name
+	flattened := flattenHistograms(metrics)
+	assert.Len(t, flattened, 4)
+	assert.Equal(t, metrics[temp], flattened[temp])
+	buckets := flattened[Counter{FieldID: dcgm.DCGM_FI_PROF_SM_ACTIVE, FieldName: "DCGM_FI_PROF_SM_ACTIVE_bucket",
+		PromType: "gauge", Help: "SM activity distribution."}]
+	require.Len(t, buckets, 3)
+	assert.Equal(t, "0.25", buckets[0].Attributes["le"])
+	assert.Empty(t, buckets[0].Suffix)
+
+	assert.Equal(t, []Counter{{FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"}},
+		withoutHistograms([]Counter{{FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "histogram"}}))
+}
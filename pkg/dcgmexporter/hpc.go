@@ -18,6 +18,7 @@ package dcgmexporter
 
 import (
 	"bufio"
+	"fmt"
 	sysOS "os"
 	"path"
 	"strconv"
@@ -43,7 +44,8 @@ func (p *hpcMapper) Name() string {
 func (p *hpcMapper) Process(metrics MetricsByCounter, sysInfo SystemInfo) error {
 	_, err := os.Stat(p.Config.HPCJobMappingDir)
 	if err != nil {
-		logrus.WithError(err).Warnf("Unable to access HPC job mapping file directory '%s' - directory not found. Ignoring.", p.Config.HPCJobMappingDir)
+		logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(),
+			"Unable to access HPC job mapping file directory '%s' - directory not found. Ignoring.", p.Config.HPCJobMappingDir)
 		return nil
 	}
 
@@ -68,7 +70,8 @@ func (p *hpcMapper) Process(metrics MetricsByCounter, sysInfo SystemInfo) error
 		gpuToJobMap[gpuFileName] = append(gpuToJobMap[gpuFileName], jobs...)
 	}
 
-	logrus.Debugf("GPU to job mapping: %+v", gpuToJobMap)
+	mapping := fmt.Sprintf("%+v", gpuToJobMap)
+	logSampled(logrus.WithField("mapping", mapping), logrus.DebugLevel, mapping, "GPU to job mapping")
 
 	for counter := range metrics {
 		var modifiedMetrics []Metric
@@ -76,11 +79,7 @@ func (p *hpcMapper) Process(metrics MetricsByCounter, sysInfo SystemInfo) error
 			jobs, exists := gpuToJobMap[metric.GPU]
 			if exists {
 				for _, job := range jobs {
-					modifiedMetric, err := deepCopy(metric)
-					if err != nil {
-						logrus.WithError(err).Errorf("Can not create deepCopy for the value: %v", metric)
-						continue
-					}
+					modifiedMetric := metric.withAttributes()
 					modifiedMetric.Attributes[hpcJobAttribute] = job
 					modifiedMetrics = append(modifiedMetrics, modifiedMetric)
 				}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bufio"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type jobMapFile struct {
+	modTime time.Time
+	size    int64
+	labels  map[string]string
+}
+
+// jobMapper merges the labels written by an external agent in the files of the job map directory into the
+// attributes of the GPU metrics. Every file is named after the UUID of a GPU and holds one key=value label per
+// line. The files are read again when they change.
+type jobMapper struct {
+	Config *Config
+
+	mtx   sync.Mutex
+	files map[string]jobMapFile
+}
+
+func newJobMapper(c *Config) *jobMapper {
+	logrus.Infof("Job map attribution is enabled and watches the %q directory", c.JobMapDir)
+	return &jobMapper{
+		Config: c,
+		files:  map[string]jobMapFile{},
+	}
+}
+
+func (p *jobMapper) Name() string {
+	return "jobMapper"
+}
+
+func (p *jobMapper) Process(metrics MetricsByCounter, _ SystemInfo) error {
+	gpuLabels, err := p.readFiles()
+	if err != nil {
+		logrus.WithError(err).Warnf("Unable to read the job map directory '%s'. Ignoring.", p.Config.JobMapDir)
+		return nil
+	}
+
+	for _, counterMetrics := range metrics {
+		for i := range counterMetrics {
+			labels, exists := gpuLabels[counterMetrics[i].GPUUUID]
+			if !exists {
+				continue
+			}
+
+			// The attributes are replaced, not modified, as they may be shared between the copies of a metric
+			attributes := make(map[string]string, len(counterMetrics[i].Attributes)+len(labels))
+			for k, v := range counterMetrics[i].Attributes {
+				attributes[k] = v
+			}
+			for k, v := range labels {
+				attributes[k] = v
+			}
+			counterMetrics[i].Attributes = attributes
+		}
+	}
+
+	return nil
+}
+
+// readFiles returns the labels of the files of the directory by GPU UUID, only the changed files are read.
+func (p *jobMapper) readFiles() (map[string]map[string]string, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	entries, err := os.ReadDir(p.Config.JobMapDir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]jobMapFile, len(entries))
+	gpuLabels := make(map[string]map[string]string, len(entries))
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		file, exists := p.files[entry.Name()]
+		if !exists || !file.modTime.Equal(info.ModTime()) || file.size != info.Size() {
+			labels, err := readJobMapFile(path.Join(p.Config.JobMapDir, entry.Name()))
+			if err != nil {
+				logrus.WithError(err).Warnf("Unable to read the job map file '%s'", entry.Name())
+				continue
+			}
+			file = jobMapFile{modTime: info.ModTime(), size: info.Size(), labels: labels}
+		}
+
+		files[entry.Name()] = file
+		gpuLabels[entry.Name()] = file.labels
+	}
+
+	p.files = files
+
+	return gpuLabels, nil
+}
+
+func readJobMapFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Example of the expected file format:
+	// # comment
+	// job_id=1234
+	// user=alice
+	labels := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || !labelNameRegex.MatchString(key) {
+			logrus.Warnf("Ignoring invalid line '%s' of the job map file '%s'", line, path)
+			continue
+		}
+		labels[key] = strings.TrimSpace(value)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	sysOS "os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobMapper_Process(t *testing.T) {
+	dir := t.TempDir()
+	gpu0File := filepath.Join(dir, "GPU-0")
+	require.NoError(t, sysOS.WriteFile(gpu0File, []byte("# written by the scheduler\njob_id=1234\nuser = alice\ninvalid-key=x\n\n"), 0o644))
+	require.NoError(t, sysOS.Mkdir(filepath.Join(dir, "GPU-1"), 0o755))
+
+	counter := Counter{FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"}
+	shared := map[string]string{"pod": "trainer"}
+	newMetrics := func() MetricsByCounter {
+		return MetricsByCounter{counter: {
+			{Counter: counter, GPU: "0", GPUUUID: "GPU-0", Attributes: shared},
+			{Counter: counter, GPU: "1", GPUUUID: "GPU-1", Attributes: map[string]string{}},
+		}}
+	}
+
+	mapper := newJobMapper(&Config{JobMapDir: dir})
+
+	metrics := newMetrics()
+	require.NoError(t, mapper.Process(metrics, SystemInfo{}))
+	assert.Equal(t, map[string]string{"pod": "trainer", "job_id": "1234", "user": "alice"},
+		metrics[counter][0].Attributes)
+	assert.Empty(t, metrics[counter][1].Attributes)
+	// The attributes shared with other metrics are not modified
+	assert.Equal(t, map[string]string{"pod": "trainer"}, shared)
+
+	// The changed files are read again
+	require.NoError(t, sysOS.WriteFile(gpu0File, []byte("job_id=5678\n"), 0o644))
+	require.NoError(t, sysOS.Chtimes(gpu0File, time.Now(), time.Now().Add(time.Minute)))
+	metrics = newMetrics()
+	require.NoError(t, mapper.Process(metrics, SystemInfo{}))
+	assert.Equal(t, map[string]string{"pod": "trainer", "job_id": "5678"}, metrics[counter][0].Attributes)
+
+	// The labels of the removed files are removed
+	require.NoError(t, sysOS.Remove(gpu0File))
+	metrics = newMetrics()
+	require.NoError(t, mapper.Process(metrics, SystemInfo{}))
+	assert.Equal(t, map[string]string{"pod": "trainer"}, metrics[counter][0].Attributes)
+}
+
+func TestJobMapper_ProcessMissingDirectory(t *testing.T) {
+	mapper := newJobMapper(&Config{JobMapDir: filepath.Join(t.TempDir(), "missing")})
+
+	counter := Counter{FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"}
+	metrics := MetricsByCounter{counter: {{Counter: counter, GPUUUID: "GPU-0", Attributes: map[string]string{}}}}
+	require.NoError(t, mapper.Process(metrics, SystemInfo{}))
+	assert.Empty(t, metrics[counter][0].Attributes)
+}
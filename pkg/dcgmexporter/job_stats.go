@@ -0,0 +1,294 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	jobIDLabel = "job_id"
+
+	jobEnergyField = "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION"
+	jobUtilField   = "DCGM_FI_DEV_GPU_UTIL"
+	jobFBUsedField = "DCGM_FI_DEV_FB_USED"
+)
+
+// jobStatsRetention is the time the summaries of the stopped jobs are exported for.
+var jobStatsRetention = time.Hour
+
+var (
+	jobEnergyCounter = Counter{
+		FieldName: "DCGM_EXP_JOB_ENERGY_CONSUMPTION",
+		PromType:  "gauge",
+		Help:      "Energy consumed by the GPU during the job (in mJ).",
+	}
+	jobSMUtilCounter = Counter{
+		FieldName: "DCGM_EXP_JOB_SM_UTIL_AVG",
+		PromType:  "gauge",
+		Help:      "Average GPU utilization during the job (in %).",
+	}
+	jobFBUsedCounter = Counter{
+		FieldName: "DCGM_EXP_JOB_FB_USED_MAX",
+		PromType:  "gauge",
+		Help:      "Maximum framebuffer memory used during the job (in MiB).",
+	}
+)
+
+type jobGPUStats struct {
+	// device holds the device labels of the GPU
+	device Metric
+
+	firstEnergy, lastEnergy float64
+	hasEnergy               bool
+	utilSum                 float64
+	utilCount               int
+	maxFBUsed               float64
+	hasFBUsed               bool
+}
+
+type job struct {
+	// gpus are the GPUs of the job, all the GPUs when empty
+	gpus    map[string]bool
+	stopped time.Time
+	stats   map[string]*jobGPUStats
+}
+
+// JobStats rolls up the GPU metrics of the jobs bracketed by calls to /jobs/start and /jobs/stop, like the job
+// statistics of dcgmi. It receives the metrics of every collection as a sink and exports the summaries of the
+// jobs as a collector.
+type JobStats struct {
+	mtx  sync.Mutex
+	jobs map[string]*job
+	now  func() time.Time
+}
+
+func NewJobStats() *JobStats {
+	return &JobStats{
+		jobs: map[string]*job{},
+		now:  time.Now,
+	}
+}
+
+func (j *JobStats) Name() string {
+	return "jobStats"
+}
+
+func (j *JobStats) Write(_ context.Context, metrics MetricsByCounter, _ time.Time) error {
+	// The metrics of a GPU are repeated for every pod sharing it, the first one is kept. The values of the
+	// MIG instances of a GPU are combined.
+	type instanceKey struct{ gpu, instance string }
+	seen := map[instanceKey]map[string]bool{}
+
+	energy := map[string]float64{}
+	util := map[string]float64{}
+	fbUsed := map[string]float64{}
+	devices := map[string]Metric{}
+
+	for counter, counterMetrics := range metrics {
+		switch counter.FieldName {
+		case jobEnergyField, jobUtilField, jobFBUsedField:
+		default:
+			continue
+		}
+
+		for _, metric := range counterMetrics {
+			key := instanceKey{metric.GPU, metric.GPUInstanceID}
+			if seen[key] == nil {
+				seen[key] = map[string]bool{}
+			}
+			if seen[key][counter.FieldName] {
+				continue
+			}
+			seen[key][counter.FieldName] = true
+
+			value, err := strconv.ParseFloat(metric.Value, 64)
+			if err != nil {
+				continue
+			}
+
+			if _, exists := devices[metric.GPU]; !exists || metric.GPUInstanceID == "" {
+				devices[metric.GPU] = metric
+			}
+
+			switch counter.FieldName {
+			case jobEnergyField:
+				energy[metric.GPU] = max(energy[metric.GPU], value)
+			case jobUtilField:
+				util[metric.GPU] = max(util[metric.GPU], value)
+			case jobFBUsedField:
+				fbUsed[metric.GPU] += value
+			}
+		}
+	}
+
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	for _, job := range j.jobs {
+		if !job.stopped.IsZero() {
+			continue
+		}
+
+		for gpu, device := range devices {
+			if len(job.gpus) > 0 && !job.gpus[gpu] {
+				continue
+			}
+
+			stats, exists := job.stats[gpu]
+			if !exists {
+				stats = &jobGPUStats{}
+				job.stats[gpu] = stats
+			}
+			stats.device = device
+
+			if value, exists := energy[gpu]; exists {
+				if !stats.hasEnergy {
+					stats.firstEnergy = value
+					stats.hasEnergy = true
+				}
+				stats.lastEnergy = value
+			}
+			if value, exists := util[gpu]; exists {
+				stats.utilSum += value
+				stats.utilCount++
+			}
+			if value, exists := fbUsed[gpu]; exists {
+				stats.maxFBUsed = max(stats.maxFBUsed, value)
+				stats.hasFBUsed = true
+			}
+		}
+	}
+
+	return nil
+}
+
+func (j *JobStats) Close() error {
+	return nil
+}
+
+func (j *JobStats) GetMetrics() (MetricsByCounter, error) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	metrics := MetricsByCounter{}
+	now := j.now()
+
+	for id, job := range j.jobs {
+		if !job.stopped.IsZero() && now.Sub(job.stopped) > jobStatsRetention {
+			delete(j.jobs, id)
+			continue
+		}
+
+		for _, stats := range job.stats {
+			if stats.hasEnergy {
+				m := jobMetric(stats.device, id, jobEnergyCounter, stats.lastEnergy-stats.firstEnergy)
+				metrics[m.Counter] = append(metrics[m.Counter], m)
+			}
+			if stats.utilCount > 0 {
+				m := jobMetric(stats.device, id, jobSMUtilCounter, stats.utilSum/float64(stats.utilCount))
+				metrics[m.Counter] = append(metrics[m.Counter], m)
+			}
+			if stats.hasFBUsed {
+				m := jobMetric(stats.device, id, jobFBUsedCounter, stats.maxFBUsed)
+				metrics[m.Counter] = append(metrics[m.Counter], m)
+			}
+		}
+	}
+
+	return metrics, nil
+}
+
+// jobMetric returns the summary of a job, labeled with the device labels of the GPU and the job ID.
+func jobMetric(device Metric, id string, counter Counter, value float64) Metric {
+	m := device
+	m.Counter = counter
+	m.Value = fmt.Sprintf("%f", value)
+	setMigLabels(&m, nil)
+	m.Labels = map[string]string{jobIDLabel: id}
+	m.Attributes = map[string]string{}
+	m.Exemplar = nil
+	m.ExemplarTimestamp = time.Time{}
+	return m
+}
+
+func (j *JobStats) Cleanup() {}
+
+// StartJob starts the job of the id parameter, on the GPUs of the optional gpu parameter (a comma separated
+// list of GPU indexes) or on all the GPUs.
+func (j *JobStats) StartJob(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if id == "" {
+		http.Error(w, "missing job id", http.StatusBadRequest)
+		return
+	}
+
+	gpus := map[string]bool{}
+	if param := r.FormValue("gpu"); param != "" {
+		for _, gpu := range strings.Split(param, ",") {
+			if _, err := strconv.ParseUint(gpu, 10, 32); err != nil {
+				http.Error(w, fmt.Sprintf("invalid GPU '%s'", gpu), http.StatusBadRequest)
+				return
+			}
+			gpus[gpu] = true
+		}
+	}
+
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if job, exists := j.jobs[id]; exists && job.stopped.IsZero() {
+		http.Error(w, fmt.Sprintf("job '%s' is already running", id), http.StatusConflict)
+		return
+	}
+
+	// Starting a stopped job again replaces its summary
+	j.jobs[id] = &job{gpus: gpus, stats: map[string]*jobGPUStats{}}
+
+	logrus.Infof("Job '%s' started", id)
+	w.WriteHeader(http.StatusOK)
+}
+
+// StopJob stops the job of the id parameter, its summary is exported for jobStatsRetention.
+func (j *JobStats) StopJob(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if id == "" {
+		http.Error(w, "missing job id", http.StatusBadRequest)
+		return
+	}
+
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	job, exists := j.jobs[id]
+	if !exists || !job.stopped.IsZero() {
+		http.Error(w, fmt.Sprintf("job '%s' is not running", id), http.StatusNotFound)
+		return
+	}
+	job.stopped = j.now()
+
+	logrus.Infof("Job '%s' stopped", id)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func jobStatsRequest(t *testing.T, handler http.HandlerFunc, target string) int {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, target, nil))
+	return recorder.Code
+}
+
+func jobStatsMetrics(energy, util, fbUsed string) MetricsByCounter {
+	gpuMetric := func(counter Counter, gpu, value string) Metric {
+		return Metric{
+			Counter:    counter,
+			Value:      value,
+			GPU:        gpu,
+			GPUUUID:    "GPU-" + gpu,
+			UUID:       "UUID",
+			Hostname:   "node",
+			Attributes: map[string]string{"pod": "trainer"},
+		}
+	}
+
+	energyCounter := Counter{FieldName: jobEnergyField, PromType: "counter"}
+	utilCounter := Counter{FieldName: jobUtilField, PromType: "gauge"}
+	fbUsedCounter := Counter{FieldName: jobFBUsedField, PromType: "gauge"}
+
+	return MetricsByCounter{
+		energyCounter: {gpuMetric(energyCounter, "0", energy), gpuMetric(energyCounter, "1", energy)},
+		utilCounter:   {gpuMetric(utilCounter, "0", util), gpuMetric(utilCounter, "1", util)},
+		fbUsedCounter: {gpuMetric(fbUsedCounter, "0", fbUsed), gpuMetric(fbUsedCounter, "1", fbUsed)},
+	}
+}
+
+func TestJobStats(t *testing.T) {
+	now := time.Now()
+	jobStats := NewJobStats()
+	jobStats.now = func() time.Time { return now }
+
+	// The collections before the start of the job are ignored
+	require.NoError(t, jobStats.Write(context.Background(), jobStatsMetrics("1000", "90", "100"), now))
+
+	assert.Equal(t, http.StatusOK, jobStatsRequest(t, jobStats.StartJob, "/jobs/start?id=train-1&gpu=0"))
+	assert.Equal(t, http.StatusConflict, jobStatsRequest(t, jobStats.StartJob, "/jobs/start?id=train-1"))
+	assert.Equal(t, http.StatusBadRequest, jobStatsRequest(t, jobStats.StartJob, "/jobs/start?id=train-2&gpu=a"))
+
+	require.NoError(t, jobStats.Write(context.Background(), jobStatsMetrics("2000", "40", "300"), now))
+	require.NoError(t, jobStats.Write(context.Background(), jobStatsMetrics("5000", "60", "200"), now))
+
+	assert.Equal(t, http.StatusOK, jobStatsRequest(t, jobStats.StopJob, "/jobs/stop?id=train-1"))
+	assert.Equal(t, http.StatusNotFound, jobStatsRequest(t, jobStats.StopJob, "/jobs/stop?id=train-1"))
+
+	// The collections after the end of the job are ignored
+	require.NoError(t, jobStats.Write(context.Background(), jobStatsMetrics("9000", "100", "900"), now))
+
+	metrics, err := jobStats.GetMetrics()
+	require.NoError(t, err)
+	require.Len(t, metrics, 3)
+
+	for counter, value := range map[Counter]string{
+		jobEnergyCounter: "3000.000000",
+		jobSMUtilCounter: "50.000000",
+		jobFBUsedCounter: "300.000000",
+	} {
+		require.Len(t, metrics[counter], 1, counter.FieldName)
+		m := metrics[counter][0]
+		assert.Equal(t, value, m.Value, counter.FieldName)
+		assert.Equal(t, "0", m.GPU)
+		assert.Equal(t, "GPU-0", m.GPUUUID)
+		assert.Equal(t, map[string]string{jobIDLabel: "train-1"}, m.Labels)
+		assert.Empty(t, m.Attributes)
+	}
+
+	// The summaries of the stopped jobs expire
+	now = now.Add(jobStatsRetention + time.Second)
+	metrics, err = jobStats.GetMetrics()
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+}
@@ -0,0 +1,281 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	promconfig "github.com/prometheus/common/config"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/kafka"
+)
+
+type KafkaFormat string
+
+const (
+	KafkaFormatJSON KafkaFormat = "json"
+	KafkaFormatAvro KafkaFormat = "avro"
+)
+
+const dcgmExporterKafkaProduceFailuresTotal = "DCGM_EXPORTER_KAFKA_PRODUCE_FAILURES_TOTAL"
+
+// KafkaAvroSchema is the schema of the messages produced with the avro format. Messages hold the binary
+// encoding of a single record, without any schema registry framing.
+const KafkaAvroSchema = `{
+  "type": "record",
+  "name": "GPUMetrics",
+  "namespace": "com.nvidia.dcgm",
+  "fields": [
+    {"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "hostname", "type": "string"},
+    {"name": "gpu_uuid", "type": "string"},
+    {"name": "metrics", "type": {"type": "array", "items": {
+      "type": "record",
+      "name": "Metric",
+      "fields": [
+        {"name": "name", "type": "string"},
+        {"name": "value", "type": "double"},
+        {"name": "attributes", "type": {"type": "map", "values": "string"}}
+      ]
+    }}}
+  ]
+}`
+
+// kafkaMessage holds the metrics of a GPU for one collection.
+type kafkaMessage struct {
+	Timestamp int64         `json:"timestamp"`
+	Hostname  string        `json:"hostname"`
+	GPUUUID   string        `json:"gpu_uuid"`
+	Metrics   []kafkaMetric `json:"metrics"`
+}
+
+type kafkaMetric struct {
+	Name       string            `json:"name"`
+	Value      float64           `json:"value"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// KafkaSink produces one message per GPU on every collection, keyed by the GPU UUID so the messages of a
+// GPU stay ordered in a single partition.
+type KafkaSink struct {
+	producer *kafka.Producer
+	format   KafkaFormat
+	hostname string
+}
+
+// NewKafkaSink creates a KafkaSink for the configured brokers and topic.
+func NewKafkaSink(c *Config, hostname string) (*KafkaSink, error) {
+	format := c.KafkaFormat
+	switch format {
+	case "":
+		format = KafkaFormatJSON
+	case KafkaFormatJSON, KafkaFormatAvro:
+	default:
+		return nil, fmt.Errorf("invalid Kafka format '%s'; possible values: '%s', '%s'",
+			c.KafkaFormat, KafkaFormatJSON, KafkaFormatAvro)
+	}
+
+	config := kafka.Config{
+		Brokers:      c.KafkaBrokers,
+		Topic:        c.KafkaTopic,
+		ClientID:     "dcgm-exporter",
+		SASLUsername: c.KafkaSASLUsername,
+	}
+
+	if c.KafkaTLS {
+		tlsConfig, err := promconfig.NewTLSConfig(&promconfig.TLSConfig{
+			CAFile:   c.KafkaTLSCAFile,
+			CertFile: c.KafkaTLSCertFile,
+			KeyFile:  c.KafkaTLSKeyFile,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid Kafka TLS configuration; err: %w", err)
+		}
+		tlsConfig.MinVersion = tls.VersionTLS12
+		config.TLS = tlsConfig
+	}
+
+	if c.KafkaSASLPasswordFile != "" {
+		password, err := readPasswordFile(c.KafkaSASLPasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		config.SASLPassword = password
+	}
+
+	producer, err := kafka.NewProducer(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KafkaSink{
+		producer: producer,
+		format:   format,
+		hostname: hostname,
+	}, nil
+}
+
+func readPasswordFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("could not open password file '%s'; err: %w", path, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("could not read password file '%s'; err: %w", path, err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (s *KafkaSink) Name() string {
+	return "kafka"
+}
+
+func (s *KafkaSink) Write(ctx context.Context, metrics MetricsByCounter, timestamp time.Time) error {
+	var messages []kafka.Message
+	for _, msg := range s.groupByGPU(metrics, timestamp) {
+		var value []byte
+		if s.format == KafkaFormatAvro {
+			value = encodeAvroMessage(msg)
+		} else {
+			var err error
+			value, err = json.Marshal(msg)
+			if err != nil {
+				return err
+			}
+		}
+
+		key := msg.GPUUUID
+		if key == "" {
+			key = msg.Hostname
+		}
+
+		messages = append(messages, kafka.Message{Key: []byte(key), Value: value})
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	if err := s.producer.Produce(ctx, messages); err != nil {
+		selfMetrics.AddCounter(dcgmExporterKafkaProduceFailuresTotal,
+			"Number of collections that couldn't be produced to Kafka.", nil, 1)
+		return err
+	}
+
+	return nil
+}
+
+func (s *KafkaSink) Close() error {
+	return s.producer.Close()
+}
+
+// groupByGPU returns one message per GPU UUID, sorted by UUID. Metrics without a GPU, like the exporter
+// metrics, are grouped in a message with an empty UUID.
+func (s *KafkaSink) groupByGPU(metrics MetricsByCounter, timestamp time.Time) []*kafkaMessage {
+	byGPU := map[string]*kafkaMessage{}
+
+	for _, counter := range sortedCounters(metrics) {
+		for _, metric := range metrics[counter] {
+			value, err := strconv.ParseFloat(metric.Value, 64)
+			if err != nil {
+				continue
+			}
+
+			msg, exists := byGPU[metric.GPUUUID]
+			if !exists {
+				hostname := metric.Hostname
+				if hostname == "" {
+					hostname = s.hostname
+				}
+				msg = &kafkaMessage{
+					Timestamp: timestamp.UnixMilli(),
+					Hostname:  hostname,
+					GPUUUID:   metric.GPUUUID,
+				}
+				byGPU[metric.GPUUUID] = msg
+			}
+
+			msg.Metrics = append(msg.Metrics, kafkaMetric{
+				Name:       counter.FieldName,
+				Value:      value,
+				Attributes: metricAttributes(metric),
+			})
+		}
+	}
+
+	messages := make([]*kafkaMessage, 0, len(byGPU))
+	for _, msg := range byGPU {
+		messages = append(messages, msg)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].GPUUUID < messages[j].GPUUUID })
+
+	return messages
+}
+
+// encodeAvroMessage encodes the message with the Avro binary encoding of KafkaAvroSchema.
+func encodeAvroMessage(msg *kafkaMessage) []byte {
+	var b []byte
+
+	b = binary.AppendVarint(b, msg.Timestamp)
+	b = appendAvroString(b, msg.Hostname)
+	b = appendAvroString(b, msg.GPUUUID)
+
+	if len(msg.Metrics) > 0 {
+		b = binary.AppendVarint(b, int64(len(msg.Metrics)))
+		for _, metric := range msg.Metrics {
+			b = appendAvroString(b, metric.Name)
+			b = binary.LittleEndian.AppendUint64(b, math.Float64bits(metric.Value))
+
+			if len(metric.Attributes) > 0 {
+				keys := make([]string, 0, len(metric.Attributes))
+				for k := range metric.Attributes {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+
+				b = binary.AppendVarint(b, int64(len(keys)))
+				for _, k := range keys {
+					b = appendAvroString(b, k)
+					b = appendAvroString(b, metric.Attributes[k])
+				}
+			}
+			b = binary.AppendVarint(b, 0)
+		}
+	}
+	b = binary.AppendVarint(b, 0)
+
+	return b
+}
+
+func appendAvroString(b []byte, s string) []byte {
+	b = binary.AppendVarint(b, int64(len(s)))
+	return append(b, s...)
+}
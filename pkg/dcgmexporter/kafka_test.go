@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// avroReader decodes the Avro binary encoding of KafkaAvroSchema.
+type avroReader struct {
+	t *testing.T
+	b []byte
+}
+
+func (r *avroReader) long() int64 {
+	v, n := binary.Varint(r.b)
+	require.Positive(r.t, n)
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *avroReader) string() string {
+	n := int(r.long())
+	require.LessOrEqual(r.t, n, len(r.b))
+	v := string(r.b[:n])
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *avroReader) double() float64 {
+	require.GreaterOrEqual(r.t, len(r.b), 8)
+	v := math.Float64frombits(binary.LittleEndian.Uint64(r.b))
+	r.b = r.b[8:]
+	return v
+}
+
+func (r *avroReader) message() *kafkaMessage {
+	msg := &kafkaMessage{
+		Timestamp: r.long(),
+		Hostname:  r.string(),
+		GPUUUID:   r.string(),
+	}
+
+	for n := r.long(); n != 0; n = r.long() {
+		for i := int64(0); i < n; i++ {
+			metric := kafkaMetric{Name: r.string(), Value: r.double(), Attributes: map[string]string{}}
+			for m := r.long(); m != 0; m = r.long() {
+				for j := int64(0); j < m; j++ {
+					k := r.string()
+					metric.Attributes[k] = r.string()
+				}
+			}
+			msg.Metrics = append(msg.Metrics, metric)
+		}
+	}
+
+	return msg
+}
+
+func TestKafkaSink_GroupByGPU(t *testing.T) {
+	sink := &KafkaSink{hostname: "node"}
+	timestamp := time.UnixMilli(1700000000000)
+
+	temp := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP"}
+	power := Counter{FieldName: "DCGM_FI_DEV_POWER_USAGE"}
+	expMetric := Counter{FieldName: "DCGM_EXPORTER_COLLECT_DURATION_SECONDS"}
+
+	metrics := MetricsByCounter{
+		temp: {
+			{GPU: "1", GPUUUID: "GPU-1", Value: "40"},
+			{GPU: "0", GPUUUID: "GPU-0", Hostname: "gpu-node", Value: "42", Attributes: map[string]string{"pod": "a"}},
+		},
+		power: {
+			{GPU: "0", GPUUUID: "GPU-0", Hostname: "gpu-node", Value: "120.5"},
+			{GPU: "0", GPUUUID: "GPU-0", Value: "not a number"},
+		},
+		expMetric: {
+			{Value: "0.01"},
+		},
+	}
+
+	messages := sink.groupByGPU(metrics, timestamp)
+	require.Len(t, messages, 3)
+
+	assert.Equal(t, &kafkaMessage{
+		Timestamp: 1700000000000,
+		Hostname:  "node",
+		Metrics: []kafkaMetric{
+			{Name: "DCGM_EXPORTER_COLLECT_DURATION_SECONDS", Value: 0.01, Attributes: map[string]string{}},
+		},
+	}, messages[0])
+
+	assert.Equal(t, &kafkaMessage{
+		Timestamp: 1700000000000,
+		Hostname:  "gpu-node",
+		GPUUUID:   "GPU-0",
+		Metrics: []kafkaMetric{
+			{Name: "DCGM_FI_DEV_GPU_TEMP", Value: 42, Attributes: map[string]string{"gpu": "0", "pod": "a"}},
+			{Name: "DCGM_FI_DEV_POWER_USAGE", Value: 120.5, Attributes: map[string]string{"gpu": "0"}},
+		},
+	}, messages[1])
+
+	assert.Equal(t, "GPU-1", messages[2].GPUUUID)
+	assert.Equal(t, "node", messages[2].Hostname)
+	assert.Len(t, messages[2].Metrics, 1)
+}
+
+func TestKafkaMessage_JSON(t *testing.T) {
+	msg := &kafkaMessage{
+		Timestamp: 1700000000000,
+		Hostname:  "node",
+		GPUUUID:   "GPU-0",
+		Metrics: []kafkaMetric{
+			{Name: "DCGM_FI_DEV_GPU_TEMP", Value: 42, Attributes: map[string]string{"gpu": "0"}},
+		},
+	}
+
+	b, err := json.Marshal(msg)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"timestamp": 1700000000000,
+		"hostname": "node",
+		"gpu_uuid": "GPU-0",
+		"metrics": [{"name": "DCGM_FI_DEV_GPU_TEMP", "value": 42, "attributes": {"gpu": "0"}}]
+	}`, string(b))
+}
+
+func TestEncodeAvroMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *kafkaMessage
+	}{
+		{
+			name: "metrics with attributes",
+			msg: &kafkaMessage{
+				Timestamp: 1700000000000,
+				Hostname:  "node",
+				GPUUUID:   "GPU-0",
+				Metrics: []kafkaMetric{
+					{Name: "DCGM_FI_DEV_GPU_TEMP", Value: 42, Attributes: map[string]string{"gpu": "0", "pod": "a"}},
+					{Name: "DCGM_FI_DEV_POWER_USAGE", Value: -1.5, Attributes: map[string]string{}},
+				},
+			},
+		},
+		{
+			name: "no metrics",
+			msg:  &kafkaMessage{Timestamp: 1, Hostname: "node"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &avroReader{t: t, b: encodeAvroMessage(tt.msg)}
+			assert.Equal(t, tt.msg, r.message())
+			assert.Empty(t, r.b)
+		})
+	}
+}
+
+func TestKafkaAvroSchema(t *testing.T) {
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(KafkaAvroSchema), &schema))
+	assert.Equal(t, "GPUMetrics", schema["name"])
+}
+
+func TestNewKafkaSink_InvalidConfig(t *testing.T) {
+	_, err := NewKafkaSink(&Config{KafkaBrokers: []string{"localhost:9092"}, KafkaTopic: "gpu", KafkaFormat: "xml"},
+		"node")
+	assert.Error(t, err)
+
+	_, err = NewKafkaSink(&Config{KafkaBrokers: []string{"localhost:9092"}, KafkaTopic: "gpu",
+		KafkaSASLPasswordFile: "/does/not/exist"}, "node")
+	assert.Error(t, err)
+
+	sink, err := NewKafkaSink(&Config{KafkaBrokers: []string{"localhost:9092"}, KafkaTopic: "gpu"}, "node")
+	require.NoError(t, err)
+	assert.Equal(t, KafkaFormatJSON, sink.format)
+	assert.NoError(t, sink.Close())
+}
@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+const (
+	dcgmExporterKubeletConnected           = "DCGM_EXPORTER_KUBELET_CONNECTED"
+	dcgmExporterKubeletReconnectsTotal     = "DCGM_EXPORTER_KUBELET_RECONNECTS_TOTAL"
+	dcgmExporterKubeletConnectionState     = "DCGM_EXPORTER_KUBELET_CONNECTION_STATE"
+	dcgmExporterKubeletCallDurationSeconds = "DCGM_EXPORTER_KUBELET_CALL_DURATION_SECONDS"
+	dcgmExporterKubeletCallFailuresTotal   = "DCGM_EXPORTER_KUBELET_CALL_FAILURES_TOTAL"
+)
+
+var (
+	kubeletMinBackoff = time.Second
+	kubeletMaxBackoff = time.Minute
+
+	// kubeletSocketCandidates are the pod-resources sockets of common Kubernetes distributions, used when the
+	// configured socket doesn't exist.
+	kubeletSocketCandidates = []string{
+		"/var/lib/kubelet/pod-resources/kubelet.sock",
+		"/var/snap/microk8s/common/var/lib/kubelet/pod-resources/kubelet.sock",
+		"/var/lib/k0s/kubelet/pod-resources/kubelet.sock",
+	}
+
+	errNoKubeletSocket = errors.New("no kubelet socket")
+)
+
+// kubeletClient keeps a connection to the kubelet pod-resources socket. The connection is re-established,
+// with an exponential backoff, when it fails or when the socket is recreated, e.g. after a kubelet restart.
+type kubeletClient struct {
+	socketPath string
+	// callTimeout bounds every call to the kubelet, apart from the connection timeout
+	callTimeout time.Duration
+	// keepalive is the interval of the keepalive pings of the calls in flight, 0 disables them
+	keepalive time.Duration
+
+	mtx         sync.Mutex
+	conn        *grpc.ClientConn
+	closeConn   func()
+	connPath    string
+	watcher     *socketWatcher
+	backoff     time.Duration
+	nextAttempt time.Time
+}
+
+func newKubeletClient(c *Config) *kubeletClient {
+	client := &kubeletClient{
+		socketPath:  c.PodResourcesKubeletSocket,
+		callTimeout: time.Duration(c.KubeletCallTimeout) * time.Millisecond,
+		keepalive:   time.Duration(c.KubeletKeepalive) * time.Millisecond,
+	}
+	if client.callTimeout <= 0 {
+		client.callTimeout = connectionTimeout
+	}
+
+	return client
+}
+
+// callContext returns the context of a call to the kubelet.
+func (k *kubeletClient) callContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), k.callTimeout)
+}
+
+// observeCall reports the duration of a call to the kubelet, and counts it when it failed.
+func (k *kubeletClient) observeCall(call string, start time.Time, err error) {
+	labels := map[string]string{"call": call}
+	selfMetrics.SetGauge(dcgmExporterKubeletCallDurationSeconds,
+		"Duration of the last call to the kubelet pod-resources API, by call.", labels,
+		time.Since(start).Seconds())
+	if err != nil {
+		selfMetrics.AddCounter(dcgmExporterKubeletCallFailuresTotal,
+			"Number of failed calls to the kubelet pod-resources API, by call.", labels, 1)
+	}
+}
+
+// getConn returns the connection to the kubelet, connecting first if needed.
+func (k *kubeletClient) getConn() (*grpc.ClientConn, error) {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	if k.watcher != nil && k.watcher.changed() {
+		logrus.Infof("Kubelet socket '%s' changed; reconnecting", k.connPath)
+		k.closeLocked()
+		k.backoff = 0
+		k.nextAttempt = time.Time{}
+	}
+
+	if k.conn != nil {
+		k.setState(k.conn.GetState())
+		return k.conn, nil
+	}
+
+	if time.Now().Before(k.nextAttempt) {
+		return nil, fmt.Errorf("kubelet unavailable; next connection attempt at %s",
+			k.nextAttempt.Format(time.RFC3339))
+	}
+
+	socketPath, err := k.discoverSocket()
+	if err != nil {
+		k.setConnected(false)
+		return nil, err
+	}
+
+	conn, closeConn, err := connectToServer(socketPath, k.keepalive)
+	if err != nil {
+		k.failLocked()
+		return nil, err
+	}
+
+	if socketPath != k.connPath {
+		if k.watcher != nil {
+			k.watcher.close()
+		}
+
+		k.watcher, err = newSocketWatcher(socketPath)
+		if err != nil {
+			logrus.WithError(err).Warnf("Unable to watch kubelet socket '%s'", socketPath)
+		}
+	}
+
+	if k.connPath != "" {
+		selfMetrics.AddCounter(dcgmExporterKubeletReconnectsTotal,
+			"Number of times the connection to the kubelet was re-established.", nil, 1)
+	}
+
+	k.conn = conn
+	k.closeConn = closeConn
+	k.connPath = socketPath
+	k.backoff = 0
+	k.setConnected(true)
+	k.setState(conn.GetState())
+
+	return conn, nil
+}
+
+// reset drops the connection after a failed call, it is re-established after the backoff.
+func (k *kubeletClient) reset() {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	k.closeLocked()
+	k.failLocked()
+}
+
+// Close closes the connection to the kubelet and stops watching its socket.
+func (k *kubeletClient) Close() error {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	k.closeLocked()
+	if k.watcher != nil {
+		k.watcher.close()
+		k.watcher = nil
+	}
+	k.connPath = ""
+
+	return nil
+}
+
+func (k *kubeletClient) failLocked() {
+	if k.backoff == 0 {
+		k.backoff = kubeletMinBackoff
+	} else {
+		k.backoff = min(2*k.backoff, kubeletMaxBackoff)
+	}
+
+	k.nextAttempt = time.Now().Add(k.backoff)
+	k.setConnected(false)
+}
+
+func (k *kubeletClient) closeLocked() {
+	if k.conn != nil {
+		k.closeConn()
+		k.conn = nil
+	}
+}
+
+func (k *kubeletClient) setConnected(connected bool) {
+	value := 0.0
+	if connected {
+		value = 1
+	}
+
+	selfMetrics.SetGauge(dcgmExporterKubeletConnected,
+		"Whether the exporter is connected to the kubelet pod-resources socket (1) or not (0).", nil, value)
+}
+
+// setState reports the state of the gRPC connection to the kubelet, which reconnects by itself when the connection
+// is lost between two calls.
+func (k *kubeletClient) setState(state connectivity.State) {
+	for _, s := range []connectivity.State{connectivity.Idle, connectivity.Connecting, connectivity.Ready,
+		connectivity.TransientFailure, connectivity.Shutdown} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		selfMetrics.SetGauge(dcgmExporterKubeletConnectionState,
+			"State of the gRPC connection to the kubelet, the value is 1 for the current state.",
+			map[string]string{"state": strings.ToLower(s.String())}, value)
+	}
+}
+
+// discoverSocket returns the configured socket, or the first existing well-known socket when it is missing.
+func (k *kubeletClient) discoverSocket() (string, error) {
+	if _, err := os.Stat(k.socketPath); err == nil {
+		return k.socketPath, nil
+	}
+
+	for _, candidate := range kubeletSocketCandidates {
+		if candidate == k.socketPath {
+			continue
+		}
+
+		if _, err := os.Stat(candidate); err == nil {
+			logrus.Infof("Kubelet socket '%s' not found; using '%s'", k.socketPath, candidate)
+			return candidate, nil
+		}
+	}
+
+	return "", errNoKubeletSocket
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	podresourcesv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/testutils"
+)
+
+func TestKubeletClient(t *testing.T) {
+	testutils.RequireLinux(t)
+
+	tmpDir, cleanup := CreateTmpDir(t)
+	defer cleanup()
+
+	socketPath := tmpDir + "/kubelet.sock"
+	client := newKubeletClient(&Config{PodResourcesKubeletSocket: socketPath})
+
+	connected := func() float64 {
+		value, _ := selfMetrics.Value(dcgmExporterKubeletConnected, nil)
+		return value
+	}
+
+	_, err := client.getConn()
+	assert.ErrorIs(t, err, errNoKubeletSocket)
+	assert.Equal(t, 0.0, connected())
+
+	startServer := func() func() {
+		server := grpc.NewServer()
+		podresourcesv1.RegisterPodResourcesListerServer(server, NewPodResourcesV1MockServer(nvidiaResourceName, nil))
+		return StartMockServer(t, server, socketPath)
+	}
+
+	stopServer := startServer()
+
+	conn, err := client.getConn()
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, connected())
+
+	sameConn, err := client.getConn()
+	require.NoError(t, err)
+	assert.Same(t, conn, sameConn)
+	ready, _ := selfMetrics.Value(dcgmExporterKubeletConnectionState, map[string]string{"state": "ready"})
+	assert.Equal(t, 1.0, ready)
+
+	// A failed call backs off before reconnecting
+	client.reset()
+	assert.Equal(t, 0.0, connected())
+	_, err = client.getConn()
+	assert.ErrorContains(t, err, "kubelet unavailable")
+
+	reconnects, _ := selfMetrics.Value(dcgmExporterKubeletReconnectsTotal, nil)
+
+	client.nextAttempt = time.Time{}
+	_, err = client.getConn()
+	require.NoError(t, err)
+
+	// Recreating the socket reconnects without waiting for the backoff
+	stopServer()
+	stopServer = startServer()
+	defer stopServer()
+
+	client.nextAttempt = time.Now().Add(time.Hour)
+	_, err = client.getConn()
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, connected())
+
+	value, _ := selfMetrics.Value(dcgmExporterKubeletReconnectsTotal, nil)
+	assert.Equal(t, reconnects+2, value)
+
+	// Closing the client releases the connection and the watch of the socket
+	conn, err = client.getConn()
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+	assert.Equal(t, connectivity.Shutdown, conn.GetState())
+	assert.Nil(t, client.watcher)
+}
+
+func TestKubeletClient_Calls(t *testing.T) {
+	// The calls default to the connection timeout
+	client := newKubeletClient(&Config{})
+	assert.Equal(t, connectionTimeout, client.callTimeout)
+	assert.Zero(t, client.keepalive)
+
+	client = newKubeletClient(&Config{KubeletCallTimeout: 500, KubeletKeepalive: 300000})
+	assert.Equal(t, 500*time.Millisecond, client.callTimeout)
+	assert.Equal(t, 5*time.Minute, client.keepalive)
+
+	ctx, cancel := client.callContext()
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(500*time.Millisecond), deadline, 100*time.Millisecond)
+
+	labels := map[string]string{"call": "test"}
+	client.observeCall("test", time.Now().Add(-2*time.Second), nil)
+	duration, _ := selfMetrics.Value(dcgmExporterKubeletCallDurationSeconds, labels)
+	assert.InDelta(t, 2, duration, 0.5)
+	_, failed := selfMetrics.Value(dcgmExporterKubeletCallFailuresTotal, labels)
+	assert.False(t, failed)
+
+	client.observeCall("test", time.Now(), errors.New("deadline exceeded"))
+	failures, _ := selfMetrics.Value(dcgmExporterKubeletCallFailuresTotal, labels)
+	assert.Equal(t, 1.0, failures)
+}
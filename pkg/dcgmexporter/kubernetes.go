@@ -18,16 +18,21 @@ package dcgmexporter
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"regexp"
-	"strings"
+	"slices"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
-	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1alpha1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	podresourcesv1alpha1 "k8s.io/kubelet/pkg/apis/podresources/v1alpha1"
 
 	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
 )
@@ -37,85 +42,371 @@ var (
 
 	gkeMigDeviceIDRegex            = regexp.MustCompile(`^nvidia([0-9]+)/gi([0-9]+)$`)
 	gkeVirtualGPUDeviceIDSeparator = "/vgpu"
+	nvidiaReplicaDeviceIDSeparator = "::"
 	nvmlGetMIGDeviceInfoByIDHook   = nvmlprovider.GetMIGDeviceInfoByID
+	nvmlGetMemoryTotalByUUIDHook   = nvmlprovider.GetMemoryTotalByUUID
+	getKubeClientHook              = getKubeClient
 )
 
-func NewPodMapper(c *Config) (*PodMapper, error) {
+func NewPodMapper(c *Config) (_ *PodMapper, err error) {
 	logrus.Infof("Kubernetes metrics collection enabled!")
 
-	return &PodMapper{
-		Config: c,
-	}, nil
+	attributeNames, err := newPodAttributeNames(c)
+	if err != nil {
+		return nil, err
+	}
+
+	podMapper := &PodMapper{
+		Config:         c,
+		kubelet:        newKubeletClient(c),
+		attributeNames: attributeNames,
+	}
+	// The kubelet client and the watch of the pods are released when the pod mapper cannot be created
+	defer func() {
+		if err != nil {
+			podMapper.Close()
+		}
+	}()
+
+	if c.DevicePluginConfig != "" {
+		mpsResources, err := loadMPSResources(c.DevicePluginConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		podMapper.mpsResources = mpsResources
+
+		if c.MIGStrategy == "" {
+			podMapper.migStrategy, err = loadMIGStrategy(c.DevicePluginConfig)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if c.KubernetesSharingMetrics {
+			podMapper.timeSlicingResources, err = loadTimeSlicingResources(c.DevicePluginConfig)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if c.MIGStrategy != "" {
+		podMapper.migStrategy = c.MIGStrategy
+	}
+	setMIGStrategyMetric(podMapper.migStrategy)
+
+	deviceIDParsers, err := getDeviceIDParsers(c.KubernetesDeviceIDParsers)
+	if err != nil {
+		return nil, err
+	}
+
+	podMapper.deviceIDParsers = deviceIDParsers
+	podMapper.detectResources = !c.NoResourceDetection
+
+	podMapper.strategy = newDeviceMappingStrategy(c)
+
+	// The memory quotas of the containers sharing a GPU with HAMi are read from the annotations of their pod, and the
+	// allocations are keyed by the UID of their pod
+	hamiQuotas := c.KubernetesSharingMetrics && slices.Contains(c.KubernetesDeviceIDParsers, "hami")
+
+	if len(c.KubernetesPodLabels) > 0 || len(c.KubernetesPodAnnotations) > 0 || c.KubernetesPodOwner ||
+		c.KubernetesPodLabelSelector != "" || c.KubernetesExemplars || hamiQuotas || c.KubernetesPodAllocation {
+		client, err := getKubeClientHook()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create kubernetes client for pod metadata; err: %w", err)
+		}
+
+		podMapper.podMetadata, err = newPodMetadataCache(client, podMetadataCacheTTL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	podMapper.podFilter, err = newPodFilter(c, podMapper.podMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.KubernetesPodAllocation {
+		podMapper.allocations = getPodAllocations()
+	}
+
+	return podMapper, nil
 }
 
 func (p *PodMapper) Name() string {
 	return "podMapper"
 }
 
+// Close releases the connection to the kubelet and the watch of the pods, the pod mapper is rebuilt when the
+// exporter reloads.
+func (p *PodMapper) Close() error {
+	if p.podMetadata != nil {
+		p.podMetadata.Close()
+	}
+
+	return p.kubelet.Close()
+}
+
 func (p *PodMapper) Process(metrics MetricsByCounter, sysInfo SystemInfo) error {
-	socketPath := p.Config.PodResourcesKubeletSocket
-	_, err := os.Stat(socketPath)
-	if os.IsNotExist(err) {
-		logrus.Info("No Kubelet socket, ignoring")
+	c, err := p.kubelet.getConn()
+	if errors.Is(err, errNoKubeletSocket) {
+		logSampled(nil, logrus.InfoLevel, "", "No Kubelet socket, ignoring")
 		return nil
 	}
-
-	// TODO: This needs to be moved out of the critical path.
-	c, cleanup, err := connectToServer(socketPath)
 	if err != nil {
-		return err
+		// Keep exporting the GPU metrics, the connectivity is reported by DCGM_EXPORTER_KUBELET_CONNECTED.
+		logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(),
+			"Unable to connect to the kubelet; skipping pod attribution")
+		return nil
 	}
-	defer cleanup()
 
 	pods, err := p.listPods(c)
 	if err != nil {
-		return err
+		p.kubelet.reset()
+		logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(),
+			"Unable to list pod resources; skipping pod attribution")
+		return nil
 	}
 
-	deviceToPod := p.toDeviceToPod(pods, sysInfo)
+	deviceToPods := p.toDeviceToPods(pods, sysInfo)
+
+	mapping := fmt.Sprintf("%+v", deviceToPods)
+	logSampled(logrus.WithField("mapping", mapping), logrus.DebugLevel, mapping, "Device to pod mapping")
+
+	p.deviceToPodsMtx.Lock()
+	p.deviceToPods = deviceToPods
+	p.sysInfo = sysInfo
+	p.deviceToPodsMtx.Unlock()
+	p.mapped.Store(true)
 
-	logrus.Debugf("Device to pod mapping: %+v", deviceToPod)
+	var allocatableDevices map[string]bool
+	if p.Config.KubernetesGPUAllocation {
+		allocatableDevices, err = p.getAllocatableDevices(c, sysInfo)
+		if err != nil {
+			// The allocation is best effort, pod attribution remains functional without it.
+			logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(),
+				"Unable to get allocatable GPUs from the kubelet")
+		}
+	}
 
-	// Note: for loop are copies the value, if we want to change the value
-	// and not the copy, we need to use the indexes
 	for counter := range metrics {
-		for j, val := range metrics[counter] {
+		attributed := make([]Metric, 0, len(metrics[counter]))
+
+		for _, val := range metrics[counter] {
 			deviceID, err := val.getIDOfType(p.Config.KubernetesGPUIdType)
 			if err != nil {
 				return err
 			}
 
-			podInfo, exists := deviceToPod[deviceID]
-			if exists {
-				if !p.Config.UseOldNamespace {
-					metrics[counter][j].Attributes[podAttribute] = podInfo.Name
-					metrics[counter][j].Attributes[namespaceAttribute] = podInfo.Namespace
-					metrics[counter][j].Attributes[containerAttribute] = podInfo.Container
-				} else {
-					metrics[counter][j].Attributes[oldPodAttribute] = podInfo.Name
-					metrics[counter][j].Attributes[oldNamespaceAttribute] = podInfo.Namespace
-					metrics[counter][j].Attributes[oldContainerAttribute] = podInfo.Container
+			// With the none MIG strategy the pods hold the GPUs, the MIG instances are attributed to their pods
+			if len(deviceToPods[deviceID]) == 0 && val.MigProfile != "" && p.migStrategy == MIGStrategyNone {
+				gpu := val
+				gpu.MigProfile = ""
+				deviceID, err = gpu.getIDOfType(p.Config.KubernetesGPUIdType)
+				if err != nil {
+					return err
 				}
 			}
+
+			devicePods := p.strategy.pods(deviceToPods[deviceID])
+
+			pods := make([]PodInfo, 0, len(devicePods))
+			for _, podInfo := range devicePods {
+				if p.podFilter.matches(podInfo) {
+					pods = append(pods, podInfo)
+				}
+			}
+
+			if len(pods) == 0 {
+				if len(devicePods) > 0 {
+					// The GPU is only used by filtered out pods, it is not attributed.
+					if p.Config.KubernetesPodFilterMode == PodFilterModeDrop {
+						continue
+					}
+				} else if allocatableDevices[deviceID] {
+					val.Attributes[allocatedAttribute] = "false"
+				}
+
+				attributed = append(attributed, val)
+				continue
+			}
+
+			for _, podInfo := range pods {
+				metric := val
+				if len(pods) > 1 {
+					// The GPU is shared, every pod gets its own copy of the metric.
+					metric = val.withAttributes()
+				}
+
+				p.setPodAttributes(metric.Attributes, podInfo)
+				metric.Exemplar = p.podExemplar(podInfo)
+				attributed = append(attributed, metric)
+			}
+		}
+
+		metrics[counter] = attributed
+	}
+
+	if allocatableDevices != nil {
+		if err := p.addGPUAllocatedMetrics(metrics, deviceToPods, allocatableDevices); err != nil {
+			return err
+		}
+	}
+
+	if p.allocations != nil {
+		if err := p.addAllocationMetrics(metrics, deviceToPods); err != nil {
+			return err
+		}
+	}
+
+	if p.Config.KubernetesSharingMetrics {
+		return p.addSharingMetrics(metrics, deviceToPods)
+	}
+
+	return nil
+}
+
+// setPodAttributes attaches the attributes describing the pod to the metric.
+func (p *PodMapper) setPodAttributes(attributes map[string]string, podInfo PodInfo) {
+	names := p.attributeNames
+	attributes[names.name(podAttribute)] = podInfo.Name
+	attributes[names.name(namespaceAttribute)] = podInfo.Namespace
+	attributes[names.name(containerAttribute)] = podInfo.Container
+
+	if p.Config.KubernetesVirtualGPUs && podInfo.VGPU != "" {
+		attributes[names.name(vgpuAttribute)] = podInfo.VGPU
+	}
+
+	for k, v := range p.podMetadataAttributes(podInfo) {
+		attributes[names.name(k)] = v
+	}
+
+	for k, v := range podInfo.MPSAttributes {
+		attributes[names.name(k)] = v
+	}
+}
+
+// getAllocatableDevices returns the identifiers of the GPUs the kubelet can assign to pods.
+func (p *PodMapper) getAllocatableDevices(conn *grpc.ClientConn, sysInfo SystemInfo) (map[string]bool, error) {
+	if p.useV1alpha1.Load() {
+		return nil, fmt.Errorf("allocatable resources are not available in the podresources v1alpha1 API")
+	}
+
+	ctx, cancel := p.kubelet.callContext()
+	defer cancel()
+
+	start := time.Now()
+	resp, err := podresourcesapi.NewPodResourcesListerClient(conn).GetAllocatableResources(ctx,
+		&podresourcesapi.AllocatableResourcesRequest{})
+	p.kubelet.observeCall("get_allocatable_resources", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failure getting allocatable resources; err: %w", err)
+	}
+
+	allocatableDevices := make(map[string]bool)
+
+	for _, device := range resp.GetDevices() {
+		if !p.isNvidiaResource(device.GetResourceName(), device.GetDeviceIds()) {
+			continue
+		}
+
+		for _, deviceID := range device.GetDeviceIds() {
+			keys, _ := p.toDeviceKeys(deviceID, sysInfo)
+			for _, key := range keys {
+				allocatableDevices[key] = true
+			}
 		}
 	}
 
+	return allocatableDevices, nil
+}
+
+// addGPUAllocatedMetrics adds the DCGM_EXPORTER_GPU_ALLOCATED metric, reporting for every allocatable GPU
+// whether it is assigned to a pod.
+func (p *PodMapper) addGPUAllocatedMetrics(
+	metrics MetricsByCounter, deviceToPods map[string][]PodInfo, allocatableDevices map[string]bool,
+) error {
+	counter := Counter{
+		FieldName: dcgmExporterGPUAllocated,
+		PromType:  "gauge",
+		Help:      "Whether the GPU is allocated to a pod (1) or not (0).",
+	}
+
+	var allocated []Metric
+	seen := make(map[string]bool)
+
+	for _, counterMetrics := range metrics {
+		for _, val := range counterMetrics {
+			deviceID, err := val.getIDOfType(p.Config.KubernetesGPUIdType)
+			if err != nil {
+				return err
+			}
+
+			if seen[deviceID] || !allocatableDevices[deviceID] {
+				continue
+			}
+			seen[deviceID] = true
+
+			value := "0"
+			if len(deviceToPods[deviceID]) > 0 {
+				value = "1"
+			}
+
+			allocated = append(allocated, deviceMetric(val, counter, value))
+		}
+	}
+
+	if len(allocated) > 0 {
+		metrics[counter] = allocated
+	}
+
 	return nil
 }
 
-func connectToServer(socket string) (*grpc.ClientConn, func(), error) {
+// deviceMetric returns a metric of the device of the metric, with its device labels only.
+func deviceMetric(val Metric, counter Counter, value string) Metric {
+	return Metric{
+		Counter:           counter,
+		Value:             value,
+		GPU:               val.GPU,
+		GPUUUID:           val.GPUUUID,
+		GPUDevice:         val.GPUDevice,
+		GPUModelName:      val.GPUModelName,
+		GPUPCIBusID:       val.GPUPCIBusID,
+		UUID:              val.UUID,
+		MigProfile:        val.MigProfile,
+		GPUInstanceID:     val.GPUInstanceID,
+		ComputeInstanceID: val.ComputeInstanceID,
+		Hostname:          val.Hostname,
+		Labels:            map[string]string{},
+		Attributes:        map[string]string{},
+	}
+}
+
+// connectToServer connects to the kubelet socket. The keepalive pings, when enabled, are only sent during the calls:
+// the kubelet closes the connections pinged without calls in flight, or more often than every 5 minutes.
+func connectToServer(socket string, keepaliveTime time.Duration) (*grpc.ClientConn, func(), error) {
 	ctx, cancel := context.WithTimeout(context.Background(), connectionTimeout)
 	defer cancel()
 
-	conn, err := grpc.DialContext(ctx,
-		socket,
+	opts := []grpc.DialOption{
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 		grpc.WithBlock(),
 		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
 			d := net.Dialer{}
 			return d.DialContext(ctx, "unix", addr)
 		}),
-	)
+	}
+	if keepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    keepaliveTime,
+			Timeout: connectionTimeout,
+		}))
+	}
+
+	conn, err := grpc.DialContext(ctx, socket, opts...)
 	if err != nil {
 		return nil, func() {}, fmt.Errorf("failure connecting to '%s'; err: %w", socket, err)
 	}
@@ -123,78 +414,72 @@ func connectToServer(socket string) (*grpc.ClientConn, func(), error) {
 	return conn, func() { conn.Close() }, nil
 }
 
+// listPods returns the pod resources using the podresources v1 API, and falls back to the deprecated
+// v1alpha1 API when the kubelet doesn't serve v1 yet. The negotiated version is remembered, and negotiated
+// again if a call fails, e.g. after a kubelet upgrade.
 func (p *PodMapper) listPods(conn *grpc.ClientConn) (*podresourcesapi.ListPodResourcesResponse, error) {
-	client := podresourcesapi.NewPodResourcesListerClient(conn)
-
-	ctx, cancel := context.WithTimeout(context.Background(), connectionTimeout)
+	ctx, cancel := p.kubelet.callContext()
 	defer cancel()
 
-	resp, err := client.List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+	if !p.useV1alpha1.Load() {
+		start := time.Now()
+		resp, err := podresourcesapi.NewPodResourcesListerClient(conn).List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+		if status.Code(err) != codes.Unimplemented {
+			p.kubelet.observeCall("list", start, err)
+			if err != nil {
+				return nil, fmt.Errorf("failure getting pod resources; err: %w", err)
+			}
+			return resp, nil
+		}
+
+		logrus.Info("Kubelet doesn't support the podresources v1 API; falling back to v1alpha1")
+		p.useV1alpha1.Store(true)
+	}
+
+	start := time.Now()
+	resp, err := podresourcesv1alpha1.NewPodResourcesListerClient(conn).List(ctx,
+		&podresourcesv1alpha1.ListPodResourcesRequest{})
+	p.kubelet.observeCall("list_v1alpha1", start, err)
 	if err != nil {
+		p.useV1alpha1.Store(false)
 		return nil, fmt.Errorf("failure getting pod resources; err: %w", err)
 	}
 
-	return resp, nil
+	return v1alpha1ToV1ListPodResourcesResponse(resp), nil
 }
 
-func (p *PodMapper) toDeviceToPod(
-	devicePods *podresourcesapi.ListPodResourcesResponse, sysInfo SystemInfo,
-) map[string]PodInfo {
-	deviceToPodMap := make(map[string]PodInfo)
+// v1alpha1ToV1ListPodResourcesResponse converts the v1alpha1 response into its v1 equivalent,
+// the v1 API is a superset of v1alpha1.
+func v1alpha1ToV1ListPodResourcesResponse(
+	resp *podresourcesv1alpha1.ListPodResourcesResponse,
+) *podresourcesapi.ListPodResourcesResponse {
+	podResources := make([]*podresourcesapi.PodResources, 0, len(resp.GetPodResources()))
 
-	for _, pod := range devicePods.GetPodResources() {
-		for _, container := range pod.GetContainers() {
-			for _, device := range container.GetDevices() {
+	for _, pod := range resp.GetPodResources() {
+		containers := make([]*podresourcesapi.ContainerResources, 0, len(pod.GetContainers()))
 
-				resourceName := device.GetResourceName()
-				if resourceName != nvidiaResourceName {
-					// Mig resources appear differently than GPU resources
-					if !strings.HasPrefix(resourceName, nvidiaMigResourcePrefix) {
-						continue
-					}
-				}
-
-				podInfo := PodInfo{
-					Name:      pod.GetName(),
-					Namespace: pod.GetNamespace(),
-					Container: container.GetName(),
-				}
+		for _, container := range pod.GetContainers() {
+			devices := make([]*podresourcesapi.ContainerDevices, 0, len(container.GetDevices()))
 
-				for _, deviceID := range device.GetDeviceIds() {
-					if strings.HasPrefix(deviceID, MIG_UUID_PREFIX) {
-						migDevice, err := nvmlGetMIGDeviceInfoByIDHook(deviceID)
-						if err == nil {
-							giIdentifier := GetGPUInstanceIdentifier(sysInfo, migDevice.ParentUUID,
-								uint(migDevice.GPUInstanceID))
-							deviceToPodMap[giIdentifier] = podInfo
-						}
-						gpuUUID := deviceID[len(MIG_UUID_PREFIX):]
-						deviceToPodMap[gpuUUID] = podInfo
-					} else if gkeMigDeviceIDMatches := gkeMigDeviceIDRegex.FindStringSubmatch(deviceID); gkeMigDeviceIDMatches != nil {
-						var gpuIndex string
-						var gpuInstanceID string
-						for groupIdx, group := range gkeMigDeviceIDMatches {
-							switch groupIdx {
-							case 1:
-								gpuIndex = group
-							case 2:
-								gpuInstanceID = group
-							}
-						}
-						giIdentifier := fmt.Sprintf("%s-%s", gpuIndex, gpuInstanceID)
-						deviceToPodMap[giIdentifier] = podInfo
-					} else if strings.Contains(deviceID, gkeVirtualGPUDeviceIDSeparator) {
-						deviceToPodMap[strings.Split(deviceID, gkeVirtualGPUDeviceIDSeparator)[0]] = podInfo
-					} else if strings.Contains(deviceID, "::") {
-						gpuInstanceID := strings.Split(deviceID, "::")[0]
-						deviceToPodMap[gpuInstanceID] = podInfo
-					}
-					// Default mapping between deviceID and pod information
-					deviceToPodMap[deviceID] = podInfo
-				}
+			for _, device := range container.GetDevices() {
+				devices = append(devices, &podresourcesapi.ContainerDevices{
+					ResourceName: device.GetResourceName(),
+					DeviceIds:    device.GetDeviceIds(),
+				})
 			}
+
+			containers = append(containers, &podresourcesapi.ContainerResources{
+				Name:    container.GetName(),
+				Devices: devices,
+			})
 		}
+
+		podResources = append(podResources, &podresourcesapi.PodResources{
+			Name:       pod.GetName(),
+			Namespace:  pod.GetNamespace(),
+			Containers: containers,
+		})
 	}
 
-	return deviceToPodMap
+	return &podresourcesapi.ListPodResourcesResponse{PodResources: podResources}
 }
@@ -0,0 +1,347 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/yaml"
+)
+
+// kubernetesConfigKey is the key of the ConfigMap holding the spec of the configuration
+const kubernetesConfigKey = "config.yaml"
+
+var (
+	dcgmExporterConfigResource = schema.GroupVersionResource{
+		Group:    "dcgm.nvidia.com",
+		Version:  "v1alpha1",
+		Resource: "dcgmexporterconfigs",
+	}
+	configMapResource = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+	// kubernetesConfigSyncTimeout bounds the wait for the configuration at startup
+	kubernetesConfigSyncTimeout = 30 * time.Second
+
+	getDynamicClientHook = getDynamicClient
+)
+
+// KubernetesConfigSpec is the spec of a DCGMExporterConfig, or the config.yaml key of a ConfigMap. The fields that
+// are set override the options of the exporter, an empty list clears a list option and an empty string disables a
+// sink.
+type KubernetesConfigSpec struct {
+	// Counters are the counters in the CSV format of the collectors file
+	Counters string                  `json:"counters,omitempty"`
+	Labels   *KubernetesConfigLabels `json:"labels,omitempty"`
+	Sinks    *KubernetesConfigSinks  `json:"sinks,omitempty"`
+}
+
+type KubernetesConfigLabels struct {
+	// Allowlist overrides --label-allowlist
+	Allowlist []string `json:"allowlist,omitempty"`
+	// External overrides --external-labels
+	External []string `json:"external,omitempty"`
+	// PodLabels overrides --kubernetes-pod-labels
+	PodLabels []string `json:"podLabels,omitempty"`
+	// PodAnnotations overrides --kubernetes-pod-annotations
+	PodAnnotations []string `json:"podAnnotations,omitempty"`
+}
+
+type KubernetesConfigSinks struct {
+	RemoteWriteURL *string  `json:"remoteWriteURL,omitempty"`
+	OTLPEndpoint   *string  `json:"otlpEndpoint,omitempty"`
+	OTLPProtocol   *string  `json:"otlpProtocol,omitempty"`
+	StatsDAddress  *string  `json:"statsdAddress,omitempty"`
+	StatsDPrefix   *string  `json:"statsdPrefix,omitempty"`
+	KafkaBrokers   []string `json:"kafkaBrokers,omitempty"`
+	KafkaTopic     *string  `json:"kafkaTopic,omitempty"`
+	WebhookURLs    []string `json:"webhookURLs,omitempty"`
+}
+
+// apply overrides the options of the configuration set in the spec.
+func (s *KubernetesConfigSpec) apply(c *Config) {
+	if s.Counters != "" {
+		c.CountersData = s.Counters
+	}
+
+	if l := s.Labels; l != nil {
+		setStrings(&c.LabelAllowlist, l.Allowlist)
+		setStrings(&c.ExternalLabels, l.External)
+		setStrings(&c.KubernetesPodLabels, l.PodLabels)
+		setStrings(&c.KubernetesPodAnnotations, l.PodAnnotations)
+	}
+
+	if sinks := s.Sinks; sinks != nil {
+		setString(&c.RemoteWriteURL, sinks.RemoteWriteURL)
+		setString(&c.OTLPEndpoint, sinks.OTLPEndpoint)
+		if sinks.OTLPProtocol != nil {
+			c.OTLPProtocol = OTLPProtocol(*sinks.OTLPProtocol)
+		}
+		setString(&c.StatsDAddress, sinks.StatsDAddress)
+		setString(&c.StatsDPrefix, sinks.StatsDPrefix)
+		setStrings(&c.KafkaBrokers, sinks.KafkaBrokers)
+		setString(&c.KafkaTopic, sinks.KafkaTopic)
+		setStrings(&c.WebhookURLs, sinks.WebhookURLs)
+	}
+}
+
+func setString(option *string, value *string) {
+	if value != nil {
+		*option = *value
+	}
+}
+
+func setStrings(option *[]string, value []string) {
+	if value != nil {
+		*option = value
+	}
+}
+
+// validate checks the options of the spec that can be checked without starting the exporter.
+func (s *KubernetesConfigSpec) validate(c Config) error {
+	s.apply(&c)
+
+	if s.Counters != "" {
+		records, err := parseCounterRecords(s.Counters)
+		if err != nil {
+			return fmt.Errorf("invalid counters; err: %w", err)
+		}
+		if _, err := extractCounters(records, &c); err != nil {
+			return fmt.Errorf("invalid counters; err: %w", err)
+		}
+	}
+
+	if _, err := newExternalLabels(&c); err != nil {
+		return err
+	}
+
+	switch c.OTLPProtocol {
+	case OTLPProtocolGRPC, OTLPProtocolHTTP, "":
+	default:
+		return fmt.Errorf("invalid OTLP protocol '%s'; expected %s or %s", c.OTLPProtocol, OTLPProtocolGRPC,
+			OTLPProtocolHTTP)
+	}
+
+	return nil
+}
+
+// KubernetesConfig watches the DCGMExporterConfig custom resource, or the ConfigMap, configuring the exporter, so
+// that the counters, the label policies and the sinks are managed in the cluster, e.g. with GitOps, and applied
+// without restarting the pods. The invalid specs are logged and ignored, the exporter keeps the running one.
+type KubernetesConfig struct {
+	client    dynamic.Interface
+	kind      KubernetesConfigKind
+	namespace string
+	name      string
+	// config holds the options of the exporter the specs are validated against
+	config Config
+
+	mtx     sync.Mutex
+	spec    *KubernetesConfigSpec
+	synced  bool
+	stopped chan struct{}
+
+	// C receives a request when the spec changes, the exporter must be reloaded to apply it
+	C chan struct{}
+}
+
+func NewKubernetesConfig(c *Config) (*KubernetesConfig, error) {
+	namespace, name, found := strings.Cut(c.KubernetesConfig, ":")
+	if !found || namespace == "" || name == "" {
+		return nil, fmt.Errorf("malformed kubernetes config '%s'; expected <NAMESPACE>:<NAME>", c.KubernetesConfig)
+	}
+
+	switch c.KubernetesConfigKind {
+	case KubernetesConfigKindCRD, KubernetesConfigKindConfigMap:
+	default:
+		return nil, fmt.Errorf("invalid kubernetes config kind '%s'; expected %s or %s", c.KubernetesConfigKind,
+			KubernetesConfigKindCRD, KubernetesConfigKindConfigMap)
+	}
+
+	client, err := getDynamicClientHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client for the configuration; err: %w", err)
+	}
+
+	return &KubernetesConfig{
+		client:    client,
+		kind:      c.KubernetesConfigKind,
+		namespace: namespace,
+		name:      name,
+		config:    *c,
+		stopped:   make(chan struct{}),
+		C:         make(chan struct{}, 1),
+	}, nil
+}
+
+func getDynamicClient() (dynamic.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return dynamic.NewForConfig(config)
+}
+
+// Start watches the configuration and waits for its current spec, the exporter starts with the options of the
+// command line when the object does not exist.
+func (k *KubernetesConfig) Start() error {
+	resource := dcgmExporterConfigResource
+	if k.kind == KubernetesConfigKindConfigMap {
+		resource = configMapResource
+	}
+
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(k.client, 0, k.namespace,
+		func(options *metav1.ListOptions) {
+			options.FieldSelector = "metadata.name=" + k.name
+		})
+	informer := factory.ForResource(resource).Informer()
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: k.update,
+		UpdateFunc: func(_, obj interface{}) {
+			k.update(obj)
+		},
+		DeleteFunc: func(interface{}) {
+			logrus.Warnf("The %s '%s/%s' was deleted, using the options of the command line", k.kind, k.namespace,
+				k.name)
+			k.set(nil)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	factory.Start(k.stopped)
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubernetesConfigSyncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		k.Stop()
+		return fmt.Errorf("timed out reading the %s '%s/%s'", k.kind, k.namespace, k.name)
+	}
+
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	k.synced = true
+	if k.spec == nil {
+		logrus.Warnf("The %s '%s/%s' does not exist, using the options of the command line", k.kind, k.namespace,
+			k.name)
+	}
+
+	return nil
+}
+
+// Stop stops watching the configuration.
+func (k *KubernetesConfig) Stop() {
+	select {
+	case <-k.stopped:
+	default:
+		close(k.stopped)
+	}
+}
+
+// Apply overrides the options of the configuration with the current spec.
+func (k *KubernetesConfig) Apply(c *Config) {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	if k.spec != nil {
+		k.spec.apply(c)
+	}
+}
+
+func (k *KubernetesConfig) update(obj interface{}) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok || u.GetName() != k.name {
+		return
+	}
+
+	spec, err := k.parse(u)
+	if err == nil {
+		err = spec.validate(k.config)
+	}
+	if err != nil {
+		logrus.WithError(err).Errorf("Invalid %s '%s/%s', keeping the running configuration", k.kind, k.namespace,
+			k.name)
+		return
+	}
+
+	k.set(spec)
+}
+
+// parse returns the spec of the custom resource, or of the config.yaml key of the ConfigMap.
+func (k *KubernetesConfig) parse(u *unstructured.Unstructured) (*KubernetesConfigSpec, error) {
+	var data []byte
+	if k.kind == KubernetesConfigKindConfigMap {
+		value, _, err := unstructured.NestedString(u.Object, "data", kubernetesConfigKey)
+		if err != nil {
+			return nil, err
+		}
+		data = []byte(value)
+	} else {
+		value, _, err := unstructured.NestedMap(u.Object, "spec")
+		if err != nil {
+			return nil, err
+		}
+		data, err = json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	spec := &KubernetesConfigSpec{}
+	if err := yaml.UnmarshalStrict(data, spec); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+// set replaces the spec, and requests the reload of the exporter when it changed after the startup.
+func (k *KubernetesConfig) set(spec *KubernetesConfigSpec) {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	if reflect.DeepEqual(k.spec, spec) {
+		return
+	}
+	k.spec = spec
+
+	if !k.synced {
+		return
+	}
+
+	logrus.Infof("The %s '%s/%s' changed, reloading", k.kind, k.namespace, k.name)
+	select {
+	case k.C <- struct{}{}:
+	default:
+		// A reload is already pending
+	}
+}
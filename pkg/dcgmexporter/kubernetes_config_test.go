@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func dcgmExporterConfigObject(spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "dcgm.nvidia.com/v1alpha1",
+		"kind":       "DCGMExporterConfig",
+		"metadata":   map[string]interface{}{"namespace": "gpu-operator", "name": "default"},
+		"spec":       spec,
+	}}
+}
+
+func newFakeKubernetesConfig(t *testing.T, c *Config, objects ...runtime.Object) *fake.FakeDynamicClient {
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			dcgmExporterConfigResource: "DCGMExporterConfigList",
+			configMapResource:          "ConfigMapList",
+		}, objects...)
+
+	getDynamicClientHook = func() (dynamic.Interface, error) {
+		return client, nil
+	}
+	t.Cleanup(func() {
+		getDynamicClientHook = getDynamicClient
+	})
+
+	return client
+}
+
+func TestNewKubernetesConfig_Invalid(t *testing.T) {
+	newFakeKubernetesConfig(t, nil)
+
+	_, err := NewKubernetesConfig(&Config{KubernetesConfig: "default", KubernetesConfigKind: KubernetesConfigKindCRD})
+	assert.ErrorContains(t, err, "malformed kubernetes config 'default'")
+
+	_, err = NewKubernetesConfig(&Config{KubernetesConfig: "gpu-operator:default", KubernetesConfigKind: "Secret"})
+	assert.ErrorContains(t, err, "invalid kubernetes config kind 'Secret'")
+}
+
+func TestKubernetesConfig_CRD(t *testing.T) {
+	c := &Config{
+		KubernetesConfig:     "gpu-operator:default",
+		KubernetesConfigKind: KubernetesConfigKindCRD,
+		LabelAllowlist:       []string{"pod"},
+		RemoteWriteURL:       "http://prometheus/api/v1/write",
+		StatsDAddress:        "localhost:8125",
+	}
+	client := newFakeKubernetesConfig(t, c, dcgmExporterConfigObject(map[string]interface{}{
+		"counters": "DCGM_FI_DEV_GPU_TEMP, gauge, Temperature.\n",
+		"labels":   map[string]interface{}{"allowlist": []interface{}{"pod", "namespace"}},
+		"sinks":    map[string]interface{}{"remoteWriteURL": "", "otlpEndpoint": "otel:4317"},
+	}))
+
+	kubernetesConfig, err := NewKubernetesConfig(c)
+	require.NoError(t, err)
+	require.NoError(t, kubernetesConfig.Start())
+	defer kubernetesConfig.Stop()
+
+	applied := *c
+	kubernetesConfig.Apply(&applied)
+	assert.Equal(t, "DCGM_FI_DEV_GPU_TEMP, gauge, Temperature.\n", applied.CountersData)
+	assert.Equal(t, []string{"pod", "namespace"}, applied.LabelAllowlist)
+	// An empty string disables the sink, the sinks not set keep their options
+	assert.Empty(t, applied.RemoteWriteURL)
+	assert.Equal(t, "otel:4317", applied.OTLPEndpoint)
+	assert.Equal(t, "localhost:8125", applied.StatsDAddress)
+	assert.Empty(t, kubernetesConfig.C)
+
+	resource := client.Resource(dcgmExporterConfigResource).Namespace("gpu-operator")
+	update := func(spec map[string]interface{}) {
+		_, err := resource.Update(context.Background(), dcgmExporterConfigObject(spec), metav1.UpdateOptions{})
+		require.NoError(t, err)
+	}
+
+	// The changes reload the exporter
+	update(map[string]interface{}{"labels": map[string]interface{}{"allowlist": []interface{}{}}})
+	select {
+	case <-kubernetesConfig.C:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the change of the configuration did not request a reload")
+	}
+	applied = *c
+	kubernetesConfig.Apply(&applied)
+	assert.Empty(t, applied.CountersData)
+	assert.Equal(t, []string{}, applied.LabelAllowlist)
+	assert.Equal(t, "http://prometheus/api/v1/write", applied.RemoteWriteURL)
+
+	// The invalid specs are ignored
+	update(map[string]interface{}{"labels": map[string]interface{}{"podLabel": []interface{}{"app"}}})
+	update(map[string]interface{}{"counters": "DCGM_FI_DEV_GPU_TEMP, gauge\n"})
+	update(map[string]interface{}{"labels": map[string]interface{}{"external": []interface{}{"gpu=0"}}})
+	update(map[string]interface{}{"sinks": map[string]interface{}{"otlpProtocol": "udp"}})
+	select {
+	case <-kubernetesConfig.C:
+		require.Fail(t, "an invalid configuration requested a reload")
+	case <-time.After(200 * time.Millisecond):
+	}
+	applied = *c
+	kubernetesConfig.Apply(&applied)
+	assert.Equal(t, []string{}, applied.LabelAllowlist)
+
+	// The options of the command line are used once the object is deleted
+	require.NoError(t, resource.Delete(context.Background(), "default", metav1.DeleteOptions{}))
+	select {
+	case <-kubernetesConfig.C:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the deletion of the configuration did not request a reload")
+	}
+	applied = *c
+	kubernetesConfig.Apply(&applied)
+	assert.Equal(t, *c, applied)
+}
+
+func TestKubernetesConfig_ConfigMap(t *testing.T) {
+	c := &Config{KubernetesConfig: "gpu-operator:dcgm-exporter", KubernetesConfigKind: KubernetesConfigKindConfigMap}
+	newFakeKubernetesConfig(t, c, &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"namespace": "gpu-operator", "name": "dcgm-exporter"},
+		"data": map[string]interface{}{
+			kubernetesConfigKey: "labels:\n  podLabels: [app, team]\nsinks:\n  kafkaBrokers: [kafka:9092]\n",
+		},
+	}})
+
+	kubernetesConfig, err := NewKubernetesConfig(c)
+	require.NoError(t, err)
+	require.NoError(t, kubernetesConfig.Start())
+	defer kubernetesConfig.Stop()
+
+	applied := *c
+	kubernetesConfig.Apply(&applied)
+	assert.Equal(t, []string{"app", "team"}, applied.KubernetesPodLabels)
+	assert.Equal(t, []string{"kafka:9092"}, applied.KafkaBrokers)
+}
+
+func TestKubernetesConfig_Missing(t *testing.T) {
+	c := &Config{KubernetesConfig: "gpu-operator:default", KubernetesConfigKind: KubernetesConfigKindCRD}
+	newFakeKubernetesConfig(t, c)
+
+	kubernetesConfig, err := NewKubernetesConfig(c)
+	require.NoError(t, err)
+	require.NoError(t, kubernetesConfig.Start())
+	defer kubernetesConfig.Stop()
+
+	applied := *c
+	kubernetesConfig.Apply(&applied)
+	assert.Equal(t, *c, applied)
+}
+
+func TestGetCounterSet_CountersData(t *testing.T) {
+	cs, err := GetCounterSet(&Config{
+		ConfigMapData:  undefinedConfigMapData,
+		CollectorsFile: "/non/existent.csv",
+		CountersData:   "# Temperature\nDCGM_FI_DEV_GPU_TEMP, gauge, Temperature.\nDCGM_FI_DEV_POWER_USAGE, gauge, Power.\n",
+	})
+	require.NoError(t, err)
+	require.Len(t, cs.DCGMCounters, 2)
+	assert.Equal(t, "DCGM_FI_DEV_GPU_TEMP", cs.DCGMCounters[0].FieldName)
+	assert.Equal(t, "DCGM_FI_DEV_POWER_USAGE", cs.DCGMCounters[1].FieldName)
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const kubernetesEventsComponent = "dcgm-exporter"
+
+// KubernetesEvents creates Kubernetes events on the node, and on the pods using the GPU, when XID errors, double bit
+// ECC errors or health watch failures are found in the metrics of a collection, so that the GPU failures are shown
+// by kubectl describe. It receives the metrics of every collection as a sink, after the pod attribution.
+type KubernetesEvents struct {
+	client     kubernetes.Interface
+	nodeName   string
+	conditions *gpuConditionTracker
+	now        func() time.Time
+}
+
+func NewKubernetesEvents(c *Config) (*KubernetesEvents, error) {
+	attributeNames, err := newPodAttributeNames(c)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := getKubeClientHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client for the events; err: %w", err)
+	}
+
+	// The node is named by NODE_NAME, even without hostname
+	nodeName, err := GetHostname(&Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &KubernetesEvents{
+		client:     client,
+		nodeName:   nodeName,
+		conditions: newGPUConditionTracker(attributeNames, gpuCondition.reported),
+		now:        time.Now,
+	}, nil
+}
+
+func (k *KubernetesEvents) Name() string {
+	return "kubernetesEvents"
+}
+
+func (k *KubernetesEvents) Write(ctx context.Context, metrics MetricsByCounter, _ time.Time) error {
+	conditions, devices := k.conditions.update(metrics)
+	for _, condition := range conditions {
+		logrus.Warnf("%s: %s", condition.reason, condition.message)
+		for _, err := range k.emit(ctx, devices[condition.device], condition) {
+			logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(), "Unable to create a Kubernetes event")
+		}
+	}
+
+	return nil
+}
+
+func (k *KubernetesEvents) Close() error {
+	return nil
+}
+
+// emit creates the event of the condition on the node and on the pods using the device.
+func (k *KubernetesEvents) emit(ctx context.Context, device *gpuConditionDevice, condition gpuCondition) []error {
+	var errs []error
+
+	if k.nodeName != "" {
+		ref := corev1.ObjectReference{Kind: "Node", APIVersion: "v1", Name: k.nodeName}
+		if node, err := k.client.CoreV1().Nodes().Get(ctx, k.nodeName, metav1.GetOptions{}); err == nil {
+			ref.UID = node.UID
+		}
+		if err := k.createEvent(ctx, metav1.NamespaceDefault, ref, condition); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, pod := range device.sortedPods() {
+		namespace := device.pods[pod]
+		ref := corev1.ObjectReference{Kind: "Pod", APIVersion: "v1", Namespace: namespace, Name: pod}
+		// kubectl describe shows the events of the pod by UID
+		if p, err := k.client.CoreV1().Pods(namespace).Get(ctx, pod, metav1.GetOptions{}); err == nil {
+			ref.UID = p.UID
+		}
+		if err := k.createEvent(ctx, namespace, ref, condition); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+func (k *KubernetesEvents) createEvent(
+	ctx context.Context, namespace string, ref corev1.ObjectReference, condition gpuCondition,
+) error {
+	now := metav1.NewTime(k.now())
+	event := &corev1.Event{
+		// The events are named like the ones of client-go
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%v.%x", ref.Name, now.UnixNano()),
+			Namespace: namespace,
+		},
+		InvolvedObject:      ref,
+		Reason:              condition.reason,
+		Message:             condition.message,
+		Type:                corev1.EventTypeWarning,
+		Source:              corev1.EventSource{Component: kubernetesEventsComponent, Host: k.nodeName},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		ReportingController: kubernetesEventsComponent,
+		ReportingInstance:   k.nodeName,
+	}
+
+	_, err := k.client.CoreV1().Events(namespace).Create(ctx, event, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create the %s event of %s %s; err: %w", condition.reason, ref.Kind, ref.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func kubernetesEventsMetrics(xid, dbe string, health int) MetricsByCounter {
+	xidCounter := Counter{FieldID: dcgm.DCGM_FI_DEV_XID_ERRORS, FieldName: "DCGM_FI_DEV_XID_ERRORS", PromType: "gauge"}
+	dbeCounter := Counter{FieldID: dcgm.DCGM_FI_DEV_ECC_DBE_VOL_TOTAL, FieldName: "DCGM_FI_DEV_ECC_DBE_VOL_TOTAL",
+		PromType: "counter"}
+	healthCounter := Counter{FieldName: dcgmHealthStatus, PromType: "gauge"}
+
+	// GPU 0 is shared by two pods, GPU 1 is not used by any pod
+	metric := func(counter Counter, gpu, value, pod string) Metric {
+		m := Metric{Counter: counter, Value: value, GPU: gpu, GPUUUID: "GPU-" + gpu, Attributes: map[string]string{}}
+		if pod != "" {
+			m.Attributes[podAttribute] = pod
+			m.Attributes[namespaceAttribute] = "training"
+		}
+		return m
+	}
+	healthMetric := func(system string, value int) Metric {
+		m := metric(healthCounter, "1", fmt.Sprint(value), "")
+		m.Labels = map[string]string{healthSystemLabel: system, healthWatchLabel: "DCGM_HEALTH_WATCH_MEM"}
+		return m
+	}
+
+	return MetricsByCounter{
+		xidCounter: {metric(xidCounter, "0", xid, "trainer-0"), metric(xidCounter, "0", xid, "trainer-1")},
+		dbeCounter: {metric(dbeCounter, "0", dbe, "trainer-0"), metric(dbeCounter, "0", dbe, "trainer-1")},
+		healthCounter: {
+			healthMetric(healthSystemOverall, health),
+			healthMetric("memory", health),
+		},
+	}
+}
+
+func TestKubernetesEvents(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", UID: "node-uid"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "trainer-0", Namespace: "training", UID: "trainer-0-uid"}},
+	)
+
+	now := time.Unix(1000, 0)
+	events := &KubernetesEvents{
+		client:     client,
+		nodeName:   "node",
+		conditions: newGPUConditionTracker(podAttributeNames{}, gpuCondition.reported),
+		now: func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		},
+	}
+
+	write := func(xid, dbe string, health int) []corev1.Event {
+		require.NoError(t, events.Write(context.Background(), kubernetesEventsMetrics(xid, dbe, health), now))
+
+		list, err := client.CoreV1().Events("").List(context.Background(), metav1.ListOptions{})
+		require.NoError(t, err)
+		for _, event := range list.Items {
+			require.NoError(t, client.CoreV1().Events(event.Namespace).Delete(context.Background(), event.Name,
+				metav1.DeleteOptions{}))
+		}
+
+		sort.Slice(list.Items, func(i, j int) bool {
+			return list.Items[i].InvolvedObject.Name+list.Items[i].Reason <
+				list.Items[j].InvolvedObject.Name+list.Items[j].Reason
+		})
+		return list.Items
+	}
+
+	// The errors before the exporter started are not reported, the health watch failures are
+	created := write("43", "2", healthResultPass)
+	assert.Empty(t, created)
+
+	created = write("43", "2", healthResultFail)
+	require.Len(t, created, 1)
+	assert.Equal(t, gpuHealthFailReason, created[0].Reason)
+	assert.Equal(t, "The DCGM_HEALTH_WATCH_MEM health watch failed on GPU 1 (GPU-1)", created[0].Message)
+	assert.Equal(t, corev1.ObjectReference{Kind: "Node", APIVersion: "v1", Name: "node", UID: "node-uid"},
+		created[0].InvolvedObject)
+	assert.Equal(t, metav1.NamespaceDefault, created[0].Namespace)
+
+	// A new XID error and a new double bit error are reported on the node and on the pods of the GPU
+	created = write("79", "3", healthResultFail)
+	require.Len(t, created, 6)
+	assert.Equal(t, "node", created[0].InvolvedObject.Name)
+	assert.Equal(t, gpuDBEErrorReason, created[0].Reason)
+	assert.Equal(t, "node", created[1].InvolvedObject.Name)
+	assert.Equal(t, gpuXIDErrorReason, created[1].Reason)
+	assert.Equal(t, "XID error 79 on GPU 0 (GPU-0): "+xidErrCodeToText[79], created[1].Message)
+
+	assert.Equal(t, corev1.ObjectReference{Kind: "Pod", APIVersion: "v1", Namespace: "training",
+		Name: "trainer-0", UID: "trainer-0-uid"}, created[2].InvolvedObject)
+	assert.Equal(t, "training", created[2].Namespace)
+	assert.Equal(t, corev1.EventTypeWarning, created[2].Type)
+	assert.Equal(t, kubernetesEventsComponent, created[2].Source.Component)
+	assert.Equal(t, "trainer-1", created[4].InvolvedObject.Name)
+	// The pod is not found in the API, the event is created without its UID
+	assert.Empty(t, created[4].InvolvedObject.UID)
+
+	// The conditions that did not change are not reported again, nor the GPU resets
+	assert.Empty(t, write("79", "3", healthResultFail))
+	assert.Empty(t, write("0", "0", healthResultPass))
+}
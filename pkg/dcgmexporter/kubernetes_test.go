@@ -18,6 +18,7 @@ package dcgmexporter
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"reflect"
@@ -28,6 +29,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	podresourcesv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
 	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1alpha1"
 
 	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
@@ -326,3 +332,766 @@ func TestProcessPodMapper_WithD_Different_Format_Of_DeviceID(t *testing.T) {
 			})
 	}
 }
+
+func TestProcessPodMapper_WithPodMetadata(t *testing.T) {
+	testutils.RequireLinux(t)
+
+	tmpDir, cleanup := CreateTmpDir(t)
+	defer cleanup()
+
+	socketPath := tmpDir + "/kubelet.sock"
+	server := grpc.NewServer()
+	gpus := []string{"b8ea3855-276c-c9cb-b366-c6fa655957c5"}
+	podresourcesapi.RegisterPodResourcesListerServer(server, NewPodResourcesMockServer(nvidiaResourceName, gpus))
+
+	cleanup = StartMockServer(t, server, socketPath)
+	defer cleanup()
+
+	clientset := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "gpu-pod-0",
+			Namespace: "default",
+			Labels: map[string]string{
+				"team":                   "ml-research",
+				"app.kubernetes.io/name": "trainer",
+				"ignored":                "value",
+			},
+			Annotations: map[string]string{
+				"example.com/owner": `jane "jd" doe`,
+			},
+		},
+	})
+
+	getKubeClientHook = func() (kubernetes.Interface, error) {
+		return clientset, nil
+	}
+	defer func() {
+		getKubeClientHook = getKubeClient
+	}()
+
+	podMapper, err := NewPodMapper(&Config{
+		KubernetesGPUIdType:       GPUUID,
+		PodResourcesKubeletSocket: socketPath,
+		KubernetesPodLabels:       []string{"team", "app.kubernetes.io/name", "missing"},
+		KubernetesPodAnnotations:  []string{"example.com/owner"},
+	})
+	require.NoError(t, err)
+	defer podMapper.Close()
+	waitForPodMetadata(t, podMapper.podMetadata)
+
+	counter := Counter{
+		FieldID:   155,
+		FieldName: "DCGM_FI_DEV_POWER_USAGE",
+		PromType:  "gauge",
+	}
+	metrics := MetricsByCounter{}
+	metrics[counter] = append(metrics[counter], Metric{
+		GPU:        "0",
+		GPUUUID:    gpus[0],
+		Value:      "42",
+		Counter:    counter,
+		Attributes: map[string]string{},
+	})
+
+	err = podMapper.Process(metrics, SystemInfo{})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		podAttribute:                   "gpu-pod-0",
+		namespaceAttribute:             "default",
+		containerAttribute:             "default",
+		"label_team":                   "ml-research",
+		"label_app_kubernetes_io_name": "trainer",
+		"annotation_example_com_owner": `jane "jd" doe`,
+	}, metrics[counter][0].Attributes)
+}
+
+func TestProcessPodMapper_WithExemplars(t *testing.T) {
+	testutils.RequireLinux(t)
+
+	tmpDir, cleanup := CreateTmpDir(t)
+	defer cleanup()
+
+	socketPath := tmpDir + "/kubelet.sock"
+	server := grpc.NewServer()
+	gpus := []string{"b8ea3855-276c-c9cb-b366-c6fa655957c5", "b8ea3855-276c-c9cb-b366-c6fa655957c6"}
+	podresourcesapi.RegisterPodResourcesListerServer(server, NewPodResourcesMockServer(nvidiaResourceName, gpus))
+
+	cleanup = StartMockServer(t, server, socketPath)
+	defer cleanup()
+
+	// The second pod is not running yet, it has no container ID
+	clientset := fake.NewSimpleClientset(
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "gpu-pod-0", Namespace: "default", UID: "0f4a1e52-7c1b-4d2c-9a8e-3f6b2d1c0e9a"},
+			Status: v1.PodStatus{
+				ContainerStatuses: []v1.ContainerStatus{
+					{Name: "default", ContainerID: "containerd://4c1f0e9b2a"},
+				},
+			},
+		},
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "gpu-pod-1", Namespace: "default", UID: "9b2e4d1a-5f3c-4e8b-8a7d-1c0e9f6b2a3d"},
+		},
+	)
+
+	getKubeClientHook = func() (kubernetes.Interface, error) {
+		return clientset, nil
+	}
+	defer func() {
+		getKubeClientHook = getKubeClient
+	}()
+
+	podMapper, err := NewPodMapper(&Config{
+		KubernetesGPUIdType:       GPUUID,
+		PodResourcesKubeletSocket: socketPath,
+		KubernetesExemplars:       true,
+	})
+	require.NoError(t, err)
+	defer podMapper.Close()
+	waitForPodMetadata(t, podMapper.podMetadata)
+
+	counter := Counter{
+		FieldID:   1001,
+		FieldName: "DCGM_FI_PROF_GR_ENGINE_ACTIVE",
+		PromType:  "gauge",
+	}
+	metrics := MetricsByCounter{}
+	for i, gpu := range gpus {
+		metrics[counter] = append(metrics[counter], Metric{
+			GPU:        fmt.Sprint(i),
+			GPUUUID:    gpu,
+			Value:      "0.5",
+			Counter:    counter,
+			Attributes: map[string]string{},
+		})
+	}
+
+	err = podMapper.Process(metrics, SystemInfo{})
+	require.NoError(t, err)
+
+	require.Len(t, metrics[counter], 2)
+	assert.Equal(t, map[string]string{
+		exemplarPodUIDLabel:      "0f4a1e52-7c1b-4d2c-9a8e-3f6b2d1c0e9a",
+		exemplarContainerIDLabel: "4c1f0e9b2a",
+	}, metrics[counter][0].Exemplar)
+	assert.Equal(t, map[string]string{
+		exemplarPodUIDLabel: "9b2e4d1a-5f3c-4e8b-8a7d-1c0e9f6b2a3d",
+	}, metrics[counter][1].Exemplar)
+}
+
+// PodResourcesV1MockServer serves the podresources v1 API for the list of UUIDs
+type PodResourcesV1MockServer struct {
+	podresourcesv1.UnimplementedPodResourcesListerServer
+
+	resourceName string
+	gpus         []string
+	allocatable  []string
+}
+
+func NewPodResourcesV1MockServer(resourceName string, gpus []string) *PodResourcesV1MockServer {
+	return &PodResourcesV1MockServer{
+		resourceName: resourceName,
+		gpus:         gpus,
+	}
+}
+
+func (s *PodResourcesV1MockServer) List(
+	ctx context.Context, req *podresourcesv1.ListPodResourcesRequest,
+) (*podresourcesv1.ListPodResourcesResponse, error) {
+	podResources := make([]*podresourcesv1.PodResources, len(s.gpus))
+
+	for i, gpu := range s.gpus {
+		podResources[i] = &podresourcesv1.PodResources{
+			Name:      fmt.Sprintf("gpu-pod-%d", i),
+			Namespace: "default",
+			Containers: []*podresourcesv1.ContainerResources{
+				{
+					Name: "default",
+					Devices: []*podresourcesv1.ContainerDevices{
+						{
+							ResourceName: s.resourceName,
+							DeviceIds:    []string{gpu},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	return &podresourcesv1.ListPodResourcesResponse{
+		PodResources: podResources,
+	}, nil
+}
+
+func (s *PodResourcesV1MockServer) GetAllocatableResources(
+	ctx context.Context, req *podresourcesv1.AllocatableResourcesRequest,
+) (*podresourcesv1.AllocatableResourcesResponse, error) {
+	return &podresourcesv1.AllocatableResourcesResponse{
+		Devices: []*podresourcesv1.ContainerDevices{
+			{
+				ResourceName: s.resourceName,
+				DeviceIds:    s.allocatable,
+			},
+		},
+	}, nil
+}
+
+func TestProcessPodMapper_PodResourcesAPIVersions(t *testing.T) {
+	testutils.RequireLinux(t)
+
+	gpus := []string{"b8ea3855-276c-c9cb-b366-c6fa655957c5"}
+
+	tests := []struct {
+		name            string
+		register        func(*grpc.Server)
+		wantUseV1alpha1 bool
+	}{
+		{
+			name: "When kubelet serves podresources v1",
+			register: func(server *grpc.Server) {
+				podresourcesv1.RegisterPodResourcesListerServer(server, NewPodResourcesV1MockServer(nvidiaResourceName, gpus))
+			},
+			wantUseV1alpha1: false,
+		},
+		{
+			name: "When kubelet serves podresources v1alpha1 only",
+			register: func(server *grpc.Server) {
+				podresourcesapi.RegisterPodResourcesListerServer(server, NewPodResourcesMockServer(nvidiaResourceName, gpus))
+			},
+			wantUseV1alpha1: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, cleanup := CreateTmpDir(t)
+			defer cleanup()
+
+			socketPath := tmpDir + "/kubelet.sock"
+			server := grpc.NewServer()
+			tt.register(server)
+
+			cleanup = StartMockServer(t, server, socketPath)
+			defer cleanup()
+
+			podMapper, err := NewPodMapper(&Config{KubernetesGPUIdType: GPUUID, PodResourcesKubeletSocket: socketPath})
+			require.NoError(t, err)
+
+			counter := Counter{
+				FieldID:   155,
+				FieldName: "DCGM_FI_DEV_POWER_USAGE",
+				PromType:  "gauge",
+			}
+
+			// Process twice to verify that the negotiated API version is reused
+			for i := 0; i < 2; i++ {
+				metrics := MetricsByCounter{}
+				metrics[counter] = append(metrics[counter], Metric{
+					GPU:        "0",
+					GPUUUID:    gpus[0],
+					Counter:    counter,
+					Attributes: map[string]string{},
+				})
+
+				err = podMapper.Process(metrics, SystemInfo{})
+				require.NoError(t, err)
+				assert.Equal(t, "gpu-pod-0", metrics[counter][0].Attributes[podAttribute])
+				assert.Equal(t, tt.wantUseV1alpha1, podMapper.useV1alpha1.Load())
+			}
+		})
+	}
+}
+
+func TestProcessPodMapper_WithGPUAllocation(t *testing.T) {
+	testutils.RequireLinux(t)
+
+	tmpDir, cleanup := CreateTmpDir(t)
+	defer cleanup()
+
+	allocatedGPU := "b8ea3855-276c-c9cb-b366-c6fa655957c5"
+	unallocatedGPU := "c2a8f4b1-5e7d-4c3a-9f21-0d8e6b7a4c19"
+
+	mockServer := NewPodResourcesV1MockServer(nvidiaResourceName, []string{allocatedGPU})
+	mockServer.allocatable = []string{allocatedGPU, unallocatedGPU}
+
+	socketPath := tmpDir + "/kubelet.sock"
+	server := grpc.NewServer()
+	podresourcesv1.RegisterPodResourcesListerServer(server, mockServer)
+
+	cleanup = StartMockServer(t, server, socketPath)
+	defer cleanup()
+
+	podMapper, err := NewPodMapper(&Config{
+		KubernetesGPUIdType:       GPUUID,
+		PodResourcesKubeletSocket: socketPath,
+		KubernetesGPUAllocation:   true,
+	})
+	require.NoError(t, err)
+
+	counter := Counter{
+		FieldID:   155,
+		FieldName: "DCGM_FI_DEV_POWER_USAGE",
+		PromType:  "gauge",
+	}
+
+	metrics := MetricsByCounter{}
+	for i, gpu := range []string{allocatedGPU, unallocatedGPU} {
+		metrics[counter] = append(metrics[counter], Metric{
+			GPU:        fmt.Sprint(i),
+			GPUUUID:    gpu,
+			Counter:    counter,
+			Attributes: map[string]string{},
+		})
+	}
+
+	err = podMapper.Process(metrics, SystemInfo{})
+	require.NoError(t, err)
+
+	require.Len(t, metrics[counter], 2)
+	assert.Equal(t, "gpu-pod-0", metrics[counter][0].Attributes[podAttribute])
+	assert.NotContains(t, metrics[counter][0].Attributes, allocatedAttribute)
+	assert.NotContains(t, metrics[counter][1].Attributes, podAttribute)
+	assert.Equal(t, "false", metrics[counter][1].Attributes[allocatedAttribute])
+
+	var allocatedMetrics []Metric
+	for c, m := range metrics {
+		if c.FieldName == dcgmExporterGPUAllocated {
+			allocatedMetrics = m
+		}
+	}
+
+	require.Len(t, allocatedMetrics, 2)
+	assert.Equal(t, allocatedGPU, allocatedMetrics[0].GPUUUID)
+	assert.Equal(t, "1", allocatedMetrics[0].Value)
+	assert.Equal(t, unallocatedGPU, allocatedMetrics[1].GPUUUID)
+	assert.Equal(t, "0", allocatedMetrics[1].Value)
+}
+
+func TestProcessPodMapper_WithMPS(t *testing.T) {
+	testutils.RequireLinux(t)
+
+	tmpDir, cleanup := CreateTmpDir(t)
+	defer cleanup()
+
+	gpuUUID := "GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5"
+
+	configFile, err := os.CreateTemp(tmpDir, "config*.yaml")
+	require.NoError(t, err)
+	_, err = configFile.WriteString(`
+version: v1
+sharing:
+  mps:
+    renameByDefault: true
+    resources:
+    - name: nvidia.com/gpu
+      replicas: 4
+`)
+	require.NoError(t, err)
+	require.NoError(t, configFile.Close())
+
+	defer func() {
+		nvmlGetMemoryTotalByUUIDHook = nvmlprovider.GetMemoryTotalByUUID
+	}()
+	nvmlGetMemoryTotalByUUIDHook = func(uuid string) (uint64, error) {
+		assert.Equal(t, gpuUUID, uuid)
+		return 40 * 1024 * 1024 * 1024, nil
+	}
+
+	socketPath := tmpDir + "/kubelet.sock"
+	server := grpc.NewServer()
+	podresourcesv1.RegisterPodResourcesListerServer(server,
+		NewPodResourcesV1MockServer(nvidiaResourceName+sharedResourceSuffix, []string{gpuUUID + "::2"}))
+
+	cleanup = StartMockServer(t, server, socketPath)
+	defer cleanup()
+
+	podMapper, err := NewPodMapper(&Config{
+		KubernetesGPUIdType:       GPUUID,
+		PodResourcesKubeletSocket: socketPath,
+		DevicePluginConfig:        configFile.Name(),
+	})
+	require.NoError(t, err)
+
+	counter := Counter{
+		FieldID:   155,
+		FieldName: "DCGM_FI_DEV_POWER_USAGE",
+		PromType:  "gauge",
+	}
+
+	metrics := MetricsByCounter{}
+	metrics[counter] = append(metrics[counter], Metric{
+		GPU:        "0",
+		GPUUUID:    gpuUUID,
+		Counter:    counter,
+		Attributes: map[string]string{},
+	})
+
+	err = podMapper.Process(metrics, SystemInfo{})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		podAttribute:                       "gpu-pod-0",
+		namespaceAttribute:                 "default",
+		containerAttribute:                 "default",
+		mpsAttribute:                       "true",
+		mpsActiveThreadPercentageAttribute: "25",
+		mpsPinnedMemoryLimitAttribute:      "10240",
+	}, metrics[counter][0].Attributes)
+}
+
+func TestProcessPodMapper_WithMIGStrategy(t *testing.T) {
+	testutils.RequireLinux(t)
+
+	tmpDir, cleanup := CreateTmpDir(t)
+	defer cleanup()
+
+	gpuUUID := "GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5"
+
+	configFile, err := os.CreateTemp(tmpDir, "config*.yaml")
+	require.NoError(t, err)
+	_, err = configFile.WriteString(`
+version: v1
+flags:
+  migStrategy: none
+`)
+	require.NoError(t, err)
+	require.NoError(t, configFile.Close())
+
+	socketPath := tmpDir + "/kubelet.sock"
+	server := grpc.NewServer()
+	podresourcesv1.RegisterPodResourcesListerServer(server,
+		NewPodResourcesV1MockServer(nvidiaResourceName, []string{gpuUUID}))
+
+	cleanup = StartMockServer(t, server, socketPath)
+	defer cleanup()
+
+	counter := Counter{
+		FieldID:   155,
+		FieldName: "DCGM_FI_DEV_POWER_USAGE",
+		PromType:  "gauge",
+	}
+
+	process := func(strategy MIGStrategy) Metric {
+		podMapper, err := NewPodMapper(&Config{
+			KubernetesGPUIdType:       GPUUID,
+			PodResourcesKubeletSocket: socketPath,
+			DevicePluginConfig:        configFile.Name(),
+			MIGStrategy:               strategy,
+		})
+		require.NoError(t, err)
+
+		metrics := MetricsByCounter{}
+		metrics[counter] = append(metrics[counter], Metric{
+			GPU:           "0",
+			GPUUUID:       gpuUUID,
+			MigProfile:    "1g.10gb",
+			GPUInstanceID: "1",
+			Counter:       counter,
+			Attributes:    map[string]string{},
+		})
+
+		require.NoError(t, podMapper.Process(metrics, SystemInfo{}))
+		return metrics[counter][0]
+	}
+
+	// The strategy of the device plugin config attributes the MIG instance to the pod holding its GPU
+	assert.Equal(t, "gpu-pod-0", process("").Attributes[podAttribute])
+	value, _ := selfMetrics.Value(dcgmExporterMIGStrategy, map[string]string{"strategy": "none"})
+	assert.Equal(t, 1.0, value)
+
+	// The strategy option takes precedence
+	assert.NotContains(t, process(MIGStrategyMixed).Attributes, podAttribute)
+	value, _ = selfMetrics.Value(dcgmExporterMIGStrategy, map[string]string{"strategy": "mixed"})
+	assert.Equal(t, 1.0, value)
+}
+
+func TestProcessPodMapper_WithDeviceIDParsers(t *testing.T) {
+	testutils.RequireLinux(t)
+
+	gpuUUID := "GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5"
+
+	tests := []struct {
+		name         string
+		parsers      []string
+		resourceName string
+		wantPod      string
+	}{
+		{
+			name:         "When the HAMi parser is enabled",
+			parsers:      []string{"hami"},
+			resourceName: nvidiaResourceName,
+			wantPod:      "gpu-pod-0",
+		},
+		{
+			name:         "When the Volcano parser is enabled",
+			parsers:      []string{"volcano"},
+			resourceName: "volcano.sh/vgpu-number",
+			wantPod:      "gpu-pod-0",
+		},
+		{
+			name:         "When no parser is enabled",
+			resourceName: "volcano.sh/vgpu-number",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, cleanup := CreateTmpDir(t)
+			defer cleanup()
+
+			socketPath := tmpDir + "/kubelet.sock"
+			server := grpc.NewServer()
+			podresourcesv1.RegisterPodResourcesListerServer(server,
+				NewPodResourcesV1MockServer(tt.resourceName, []string{gpuUUID + "-1"}))
+
+			cleanup = StartMockServer(t, server, socketPath)
+			defer cleanup()
+
+			podMapper, err := NewPodMapper(&Config{
+				KubernetesGPUIdType:       GPUUID,
+				PodResourcesKubeletSocket: socketPath,
+				KubernetesDeviceIDParsers: tt.parsers,
+			})
+			require.NoError(t, err)
+
+			counter := Counter{
+				FieldID:   155,
+				FieldName: "DCGM_FI_DEV_POWER_USAGE",
+				PromType:  "gauge",
+			}
+
+			metrics := MetricsByCounter{}
+			metrics[counter] = append(metrics[counter], Metric{
+				GPU:        "0",
+				GPUUUID:    gpuUUID,
+				Counter:    counter,
+				Attributes: map[string]string{},
+			})
+
+			err = podMapper.Process(metrics, SystemInfo{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPod, metrics[counter][0].Attributes[podAttribute])
+		})
+	}
+}
+
+func TestProcessPodMapper_WithPodFilter(t *testing.T) {
+	testutils.RequireLinux(t)
+
+	gpus := []string{
+		"b8ea3855-276c-c9cb-b366-c6fa655957c5",
+		"c2a8f4b1-5e7d-4c3a-9f21-0d8e6b7a4c19",
+	}
+
+	tests := []struct {
+		name        string
+		config      Config
+		wantPods    []string
+		wantMetrics int
+	}{
+		{
+			name:        "When no filter is configured",
+			wantPods:    []string{"gpu-pod-0", "gpu-pod-1"},
+			wantMetrics: 2,
+		},
+		{
+			name:        "When the namespace is not allowed",
+			config:      Config{KubernetesNamespaces: []string{"ml"}},
+			wantPods:    []string{"", ""},
+			wantMetrics: 2,
+		},
+		{
+			name:        "When the namespace is allowed",
+			config:      Config{KubernetesNamespaces: []string{"ml", "default"}},
+			wantPods:    []string{"gpu-pod-0", "gpu-pod-1"},
+			wantMetrics: 2,
+		},
+		{
+			name:        "When only one pod matches the label selector",
+			config:      Config{KubernetesPodLabelSelector: "team=ml"},
+			wantPods:    []string{"gpu-pod-0", ""},
+			wantMetrics: 2,
+		},
+		{
+			name: "When the metrics of filtered out pods are dropped",
+			config: Config{
+				KubernetesPodLabelSelector: "team=ml",
+				KubernetesPodFilterMode:    PodFilterModeDrop,
+			},
+			wantPods:    []string{"gpu-pod-0"},
+			wantMetrics: 1,
+		},
+	}
+
+	clientset := fake.NewSimpleClientset(
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      "gpu-pod-0",
+			Namespace: "default",
+			Labels:    map[string]string{"team": "ml"},
+		}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      "gpu-pod-1",
+			Namespace: "default",
+			Labels:    map[string]string{"team": "infra"},
+		}},
+	)
+
+	getKubeClientHook = func() (kubernetes.Interface, error) {
+		return clientset, nil
+	}
+	defer func() {
+		getKubeClientHook = getKubeClient
+	}()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, cleanup := CreateTmpDir(t)
+			defer cleanup()
+
+			socketPath := tmpDir + "/kubelet.sock"
+			server := grpc.NewServer()
+			podresourcesv1.RegisterPodResourcesListerServer(server, NewPodResourcesV1MockServer(nvidiaResourceName, gpus))
+
+			cleanup = StartMockServer(t, server, socketPath)
+			defer cleanup()
+
+			config := tt.config
+			config.KubernetesGPUIdType = GPUUID
+			config.PodResourcesKubeletSocket = socketPath
+
+			podMapper, err := NewPodMapper(&config)
+			require.NoError(t, err)
+			defer podMapper.Close()
+			if podMapper.podMetadata != nil {
+				waitForPodMetadata(t, podMapper.podMetadata)
+			}
+
+			counter := Counter{
+				FieldID:   155,
+				FieldName: "DCGM_FI_DEV_POWER_USAGE",
+				PromType:  "gauge",
+			}
+
+			metrics := MetricsByCounter{}
+			for i, gpu := range gpus {
+				metrics[counter] = append(metrics[counter], Metric{
+					GPU:        fmt.Sprint(i),
+					GPUUUID:    gpu,
+					Counter:    counter,
+					Attributes: map[string]string{},
+				})
+			}
+
+			err = podMapper.Process(metrics, SystemInfo{})
+			require.NoError(t, err)
+
+			require.Len(t, metrics[counter], tt.wantMetrics)
+			for i, wantPod := range tt.wantPods {
+				assert.Equal(t, wantPod, metrics[counter][i].Attributes[podAttribute])
+			}
+		})
+	}
+}
+
+func TestNewPodMapper_WithInvalidPodFilter(t *testing.T) {
+	_, err := NewPodMapper(&Config{KubernetesPodFilterMode: "unknown"})
+	assert.ErrorContains(t, err, "unsupported pod filter mode")
+
+	getKubeClientHook = func() (kubernetes.Interface, error) {
+		return fake.NewSimpleClientset(), nil
+	}
+	defer func() {
+		getKubeClientHook = getKubeClient
+	}()
+
+	_, err = NewPodMapper(&Config{KubernetesPodLabelSelector: "team in (ml"})
+	assert.ErrorContains(t, err, "invalid pod label selector")
+
+	// The kubelet client is closed when the client of the pod metadata cannot be created
+	getKubeClientHook = func() (kubernetes.Interface, error) {
+		return nil, errors.New("no kubeconfig")
+	}
+	_, err = NewPodMapper(&Config{KubernetesPodOwner: true})
+	assert.ErrorContains(t, err, "failed to create kubernetes client for pod metadata")
+}
+
+func sharedGPUMetrics(gpuUUID string, counters int) MetricsByCounter {
+	metrics := MetricsByCounter{}
+	for i := 0; i < counters; i++ {
+		counter := Counter{FieldID: dcgm.Short(i), FieldName: fmt.Sprintf("DCGM_FI_%d", i), PromType: "gauge"}
+		metrics[counter] = []Metric{{
+			GPU:        "0",
+			GPUUUID:    gpuUUID,
+			Counter:    counter,
+			Value:      "42",
+			Labels:     map[string]string{"driver_version": "535.104.05"},
+			Attributes: map[string]string{},
+		}}
+	}
+	return metrics
+}
+
+func newSharedGPUPodMapper(tb testing.TB, gpuUUID string, replicas int) *PodMapper {
+	tmpDir := tb.TempDir()
+	socketPath := tmpDir + "/kubelet.sock"
+
+	deviceIDs := make([]string, replicas)
+	for i := range deviceIDs {
+		deviceIDs[i] = fmt.Sprintf("%s::%d", gpuUUID, i)
+	}
+
+	server := grpc.NewServer()
+	podresourcesv1.RegisterPodResourcesListerServer(server, NewPodResourcesV1MockServer(nvidiaResourceName, deviceIDs))
+
+	l, err := net.Listen("unix", socketPath)
+	require.NoError(tb, err)
+	go server.Serve(l)
+	tb.Cleanup(server.Stop)
+
+	podMapper, err := NewPodMapper(&Config{
+		KubernetesGPUIdType:       GPUUID,
+		KubernetesVirtualGPUs:     true,
+		PodResourcesKubeletSocket: socketPath,
+	})
+	require.NoError(tb, err)
+
+	return podMapper
+}
+
+func TestProcessPodMapper_WithSharedGPU(t *testing.T) {
+	testutils.RequireLinux(t)
+
+	gpuUUID := "GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5"
+	podMapper := newSharedGPUPodMapper(t, gpuUUID, 3)
+
+	metrics := sharedGPUMetrics(gpuUUID, 2)
+	require.NoError(t, podMapper.Process(metrics, SystemInfo{}))
+
+	for _, counterMetrics := range metrics {
+		require.Len(t, counterMetrics, 3)
+		for i, metric := range counterMetrics {
+			// Every pod gets its own attributes, the other fields are kept
+			assert.Equal(t, fmt.Sprintf("gpu-pod-%d", i), metric.Attributes[podAttribute])
+			assert.Equal(t, fmt.Sprint(i), metric.Attributes[vgpuAttribute])
+			assert.Equal(t, map[string]string{"driver_version": "535.104.05"}, metric.Labels)
+			assert.Equal(t, "42", metric.Value)
+		}
+	}
+}
+
+func BenchmarkProcessPodMapper_WithSharedGPU(b *testing.B) {
+	gpuUUID := "GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5"
+	podMapper := newSharedGPUPodMapper(b, gpuUUID, 32)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		metrics := sharedGPUMetrics(gpuUUID, 64)
+		b.StartTimer()
+
+		if err := podMapper.Process(metrics, SystemInfo{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// labelAllowlist removes the labels that are not allowed from the GPU metrics. The labels allowed for a
+// field replace the global ones, the metrics of the fields without allowed labels are left unchanged.
+type labelAllowlist struct {
+	global  map[string]bool
+	byField map[string]map[string]bool
+}
+
+// newLabelAllowlist parses the allowlist entries, either a label allowed for all the fields or a
+// FIELD:label pair allowing the label for the field.
+func newLabelAllowlist(c *Config) (*labelAllowlist, error) {
+	allowlist := &labelAllowlist{
+		global:  map[string]bool{},
+		byField: map[string]map[string]bool{},
+	}
+
+	for _, entry := range c.LabelAllowlist {
+		field, label, found := strings.Cut(entry, ":")
+		if !found {
+			field, label = "", entry
+		}
+
+		if found && field == "" {
+			return nil, fmt.Errorf("invalid label allowlist entry '%s'; missing field name", entry)
+		}
+		if !labelNameRegex.MatchString(label) {
+			return nil, fmt.Errorf("invalid label allowlist entry '%s'; invalid label name '%s'", entry, label)
+		}
+
+		if field == "" {
+			allowlist.global[label] = true
+			continue
+		}
+
+		if allowlist.byField[field] == nil {
+			allowlist.byField[field] = map[string]bool{}
+		}
+		allowlist.byField[field][label] = true
+	}
+
+	return allowlist, nil
+}
+
+func (a *labelAllowlist) Name() string {
+	return "labelAllowlist"
+}
+
+func (a *labelAllowlist) Process(metrics MetricsByCounter, _ SystemInfo) error {
+	for counter, counterMetrics := range metrics {
+		allowed, exists := a.byField[counter.FieldName]
+		if !exists {
+			if len(a.global) == 0 {
+				continue
+			}
+			allowed = a.global
+		}
+
+		for i := range counterMetrics {
+			filterMetricLabels(&counterMetrics[i], allowed)
+		}
+	}
+
+	return nil
+}
+
+// deviceLabels returns the names of the labels rendered for every metric from its device fields.
+func deviceLabels(metric Metric) []string {
+	return []string{"gpu", metric.UUID, "pci_bus_id", "device", "modelName", "GPU_I_PROFILE", "GPU_I_ID", "GPU_CI_ID", "Hostname"}
+}
+
+// filterMetricLabels removes the labels of the metric that are not allowed. The label maps are replaced, not
+// modified, as they may be shared between the copies of a metric.
+func filterMetricLabels(metric *Metric, allowed map[string]bool) {
+	for _, label := range deviceLabels(*metric) {
+		if !allowed[label] {
+			setMetricLabel(metric, label, "")
+		}
+	}
+
+	labels := make(map[string]string, len(metric.Labels))
+	for k, v := range metric.Labels {
+		if allowed[k] {
+			labels[k] = v
+		}
+	}
+	metric.Labels = labels
+
+	attributes := make(map[string]string, len(metric.Attributes))
+	for k, v := range metric.Attributes {
+		// The buckets of the histograms keep their bound
+		if allowed[k] || (k == histogramBucketAttribute && metric.Suffix == "_bucket") {
+			attributes[k] = v
+		}
+	}
+	metric.Attributes = attributes
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelAllowlist_Process(t *testing.T) {
+	allowlist, err := newLabelAllowlist(&Config{
+		LabelAllowlist: []string{
+			"gpu", "UUID", "pod", "namespace", "DCGM_FI_DRIVER_VERSION",
+			"DCGM_FI_PROF_GR_ENGINE_ACTIVE:gpu", "DCGM_FI_PROF_GR_ENGINE_ACTIVE:Hostname",
+		},
+	})
+	require.NoError(t, err)
+
+	util := Counter{FieldName: "DCGM_FI_DEV_GPU_UTIL"}
+	active := Counter{FieldName: "DCGM_FI_PROF_GR_ENGINE_ACTIVE"}
+
+	labels := map[string]string{"DCGM_FI_DRIVER_VERSION": "535.104.05", "DCGM_FI_DEV_SERIAL": "1234"}
+	attributes := map[string]string{podAttribute: "train-0", namespaceAttribute: "default", containerAttribute: "main"}
+
+	metric := Metric{
+		GPU: "0", GPUUUID: "GPU-0", GPUDevice: "nvidia0", GPUPCIBusID: "00000000:01:00.0", GPUModelName: "NVIDIA A100",
+		Hostname: "node-0", UUID: "UUID", Labels: labels, Attributes: attributes,
+	}
+
+	metrics := MetricsByCounter{
+		util:   {metric},
+		active: {metric},
+	}
+
+	require.NoError(t, allowlist.Process(metrics, SystemInfo{}))
+
+	utilMetric := metrics[util][0]
+	assert.Equal(t, "0", utilMetric.GPU)
+	assert.Equal(t, "GPU-0", utilMetric.GPUUUID)
+	assert.Empty(t, utilMetric.GPUDevice)
+	assert.Empty(t, utilMetric.GPUPCIBusID)
+	assert.Empty(t, utilMetric.GPUModelName)
+	assert.Empty(t, utilMetric.Hostname)
+	assert.Equal(t, map[string]string{"DCGM_FI_DRIVER_VERSION": "535.104.05"}, utilMetric.Labels)
+	assert.Equal(t, map[string]string{podAttribute: "train-0", namespaceAttribute: "default"}, utilMetric.Attributes)
+
+	activeMetric := metrics[active][0]
+	assert.Equal(t, "0", activeMetric.GPU)
+	assert.Empty(t, activeMetric.GPUUUID)
+	assert.Equal(t, "node-0", activeMetric.Hostname)
+	assert.Empty(t, activeMetric.Labels)
+	assert.Empty(t, activeMetric.Attributes)
+
+	// The label maps shared between the metrics are not modified
+	assert.Len(t, labels, 2)
+	assert.Len(t, attributes, 3)
+}
+
+func TestLabelAllowlist_FieldsOnly(t *testing.T) {
+	allowlist, err := newLabelAllowlist(&Config{LabelAllowlist: []string{"DCGM_FI_PROF_GR_ENGINE_ACTIVE:gpu"}})
+	require.NoError(t, err)
+
+	util := Counter{FieldName: "DCGM_FI_DEV_GPU_UTIL"}
+	metrics := MetricsByCounter{
+		util: {{GPU: "0", GPUUUID: "GPU-0", UUID: "UUID", Attributes: map[string]string{podAttribute: "train-0"}}},
+	}
+
+	require.NoError(t, allowlist.Process(metrics, SystemInfo{}))
+	assert.Equal(t, "GPU-0", metrics[util][0].GPUUUID)
+	assert.Equal(t, map[string]string{podAttribute: "train-0"}, metrics[util][0].Attributes)
+}
+
+func TestNewLabelAllowlist_InvalidConfig(t *testing.T) {
+	for _, entry := range []string{":pod", "DCGM_FI_DEV_GPU_UTIL:", "label.name", "DCGM_FI_DEV_GPU_UTIL:a:b"} {
+		t.Run(entry, func(t *testing.T) {
+			_, err := newLabelAllowlist(&Config{LabelAllowlist: []string{entry}})
+			assert.Error(t, err)
+		})
+	}
+}
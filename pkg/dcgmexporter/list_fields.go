@@ -0,0 +1,244 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	FieldsFormatTable = "table"
+	FieldsFormatJSON  = "json"
+	FieldsFormatCSV   = "csv"
+)
+
+var fieldTypeNames = map[byte]string{
+	byte(dcgm.DCGM_FT_BINARY):    "binary",
+	byte(dcgm.DCGM_FT_DOUBLE):    "double",
+	byte(dcgm.DCGM_FT_INT64):     "int64",
+	byte(dcgm.DCGM_FT_STRING):    "string",
+	byte(dcgm.DCGM_FT_TIMESTAMP): "timestamp",
+}
+
+// FieldInfo describes a DCGM field and the local GPUs that support it.
+type FieldInfo struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	EntityLevel string `json:"entity_level"`
+	Profiling   bool   `json:"profiling"`
+	// SupportedGPUs is nil for the fields that are not read from the GPUs, e.g. the NvSwitch and CPU fields
+	SupportedGPUs []uint `json:"supported_gpus"`
+}
+
+// ListFields returns the fields known to DCGM, sorted by ID. The GPU fields are read once from every GPU to find the
+// ones that support them, and the profiling fields are checked against the metric groups of every GPU.
+func ListFields() ([]FieldInfo, error) {
+	gpus, err := dcgm.GetSupportedDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the GPUs: %w", err)
+	}
+
+	names := make([]string, 0, len(dcgm.DCGM_FI))
+	for name := range dcgm.DCGM_FI {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if dcgm.DCGM_FI[names[i]] != dcgm.DCGM_FI[names[j]] {
+			return dcgm.DCGM_FI[names[i]] < dcgm.DCGM_FI[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	var (
+		fields    []FieldInfo
+		gpuFields []dcgm.Short
+	)
+	byID := map[uint]int{}
+
+	for _, name := range names {
+		fieldID := dcgm.DCGM_FI[name]
+		meta, ok := fieldMeta(fieldID)
+		if !ok {
+			logrus.Debugf("Field '%s' is unknown to DCGM; skipping", name)
+			continue
+		}
+
+		info := FieldInfo{
+			ID:          uint(fieldID),
+			Name:        name,
+			Type:        fieldTypeName(meta.FieldType),
+			EntityLevel: entityLevelName(meta.EntityLevel),
+			Profiling:   fieldID >= dcpFieldsStart && fieldID < cpuFieldsStart,
+		}
+
+		if info.Profiling || meta.EntityLevel == dcgm.FE_GPU {
+			info.SupportedGPUs = []uint{}
+		}
+		if !info.Profiling && meta.EntityLevel == dcgm.FE_GPU {
+			if _, exists := byID[info.ID]; !exists {
+				gpuFields = append(gpuFields, fieldID)
+			}
+		}
+
+		byID[info.ID] = len(fields)
+		fields = append(fields, info)
+	}
+
+	for _, gpu := range gpus {
+		supported := map[uint]bool{}
+
+		groups, err := dcgm.GetSupportedMetricGroups(gpu)
+		if err != nil {
+			logrus.WithError(err).Debugf("No profiling metrics on GPU %d", gpu)
+		}
+		for _, group := range groups {
+			for _, fieldID := range group.FieldIds {
+				supported[fieldID] = true
+			}
+		}
+
+		if len(gpuFields) > 0 {
+			entities := []dcgm.GroupEntityPair{{EntityGroupId: dcgm.FE_GPU, EntityId: gpu}}
+			values, err := dcgm.EntitiesGetLatestValues(entities, gpuFields, dcgm.DCGM_FV_FLAG_LIVE_DATA)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the fields of GPU %d: %w", gpu, err)
+			}
+
+			for _, value := range values {
+				if value.Status == dcgm.DCGM_ST_OK && ToString(toFieldValueV1(value)) != SkipDCGMValue {
+					supported[value.FieldId] = true
+				}
+			}
+		}
+
+		for i := range fields {
+			if fields[i].SupportedGPUs != nil && supported[fields[i].ID] {
+				fields[i].SupportedGPUs = append(fields[i].SupportedGPUs, gpu)
+			}
+		}
+	}
+
+	return fields, nil
+}
+
+// fieldMeta recovers from the fields that the host engine does not know, as DCGM returns no metadata for them.
+func fieldMeta(fieldID dcgm.Short) (meta dcgm.FieldMeta, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	return dcgm.FieldGetById(fieldID), true
+}
+
+func toFieldValueV1(value dcgm.FieldValue_v2) dcgm.FieldValue_v1 {
+	return dcgm.FieldValue_v1{
+		FieldId:   value.FieldId,
+		FieldType: value.FieldType,
+		Status:    value.Status,
+		Ts:        value.Ts,
+		Value:     value.Value,
+	}
+}
+
+func fieldTypeName(fieldType byte) string {
+	if name, ok := fieldTypeNames[fieldType]; ok {
+		return name
+	}
+
+	return string(fieldType)
+}
+
+func entityLevelName(level dcgm.Field_Entity_Group) string {
+	if level == dcgm.FE_NONE {
+		return "none"
+	}
+
+	return level.String()
+}
+
+// WriteFields writes the fields in the table, JSON or CSV format.
+func WriteFields(w io.Writer, fields []FieldInfo, format string) error {
+	switch format {
+	case FieldsFormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tTYPE\tENTITY\tPROFILING\tSUPPORTED GPUS")
+		for _, field := range fields {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%t\t%s\n",
+				field.ID, field.Name, field.Type, field.EntityLevel, field.Profiling, supportedGPUsString(field))
+		}
+		return tw.Flush()
+	case FieldsFormatJSON:
+		if fields == nil {
+			fields = []FieldInfo{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(fields)
+	case FieldsFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"id", "name", "type", "entity_level", "profiling", "supported_gpus"}); err != nil {
+			return err
+		}
+		for _, field := range fields {
+			err := cw.Write([]string{
+				strconv.FormatUint(uint64(field.ID), 10),
+				field.Name,
+				field.Type,
+				field.EntityLevel,
+				strconv.FormatBool(field.Profiling),
+				supportedGPUsString(field),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	return fmt.Errorf("unknown format '%s', expected one of: %s, %s, %s",
+		format, FieldsFormatTable, FieldsFormatJSON, FieldsFormatCSV)
+}
+
+func supportedGPUsString(field FieldInfo) string {
+	switch {
+	case field.SupportedGPUs == nil:
+		return "-"
+	case len(field.SupportedGPUs) == 0:
+		return "none"
+	}
+
+	gpus := make([]string, len(field.SupportedGPUs))
+	for i, gpu := range field.SupportedGPUs {
+		gpus[i] = strconv.FormatUint(uint64(gpu), 10)
+	}
+
+	return strings.Join(gpus, ",")
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFields(t *testing.T) {
+	fields := []FieldInfo{
+		{ID: 150, Name: "DCGM_FI_DEV_GPU_TEMP", Type: "int64", EntityLevel: "GPU", SupportedGPUs: []uint{0, 1}},
+		{ID: 1001, Name: "DCGM_FI_PROF_GR_ENGINE_ACTIVE", Type: "double", EntityLevel: "GPU", Profiling: true,
+			SupportedGPUs: []uint{}},
+		{ID: 1100, Name: "DCGM_FI_DEV_CPU_UTIL_TOTAL", Type: "double", EntityLevel: "CPU Core"},
+	}
+
+	var table bytes.Buffer
+	require.NoError(t, WriteFields(&table, fields, FieldsFormatTable))
+	assert.Equal(t, `ID    NAME                           TYPE    ENTITY    PROFILING  SUPPORTED GPUS
+150   DCGM_FI_DEV_GPU_TEMP           int64   GPU       false      0,1
+1001  DCGM_FI_PROF_GR_ENGINE_ACTIVE  double  GPU       true       none
+1100  DCGM_FI_DEV_CPU_UTIL_TOTAL     double  CPU Core  false      -
+`, table.String())
+
+	var csvOutput bytes.Buffer
+	require.NoError(t, WriteFields(&csvOutput, fields, FieldsFormatCSV))
+	assert.Equal(t, `id,name,type,entity_level,profiling,supported_gpus
+150,DCGM_FI_DEV_GPU_TEMP,int64,GPU,false,"0,1"
+1001,DCGM_FI_PROF_GR_ENGINE_ACTIVE,double,GPU,true,none
+1100,DCGM_FI_DEV_CPU_UTIL_TOTAL,double,CPU Core,false,-
+`, csvOutput.String())
+
+	var jsonOutput bytes.Buffer
+	require.NoError(t, WriteFields(&jsonOutput, fields, FieldsFormatJSON))
+	var decoded []FieldInfo
+	require.NoError(t, json.Unmarshal(jsonOutput.Bytes(), &decoded))
+	assert.Equal(t, fields, decoded)
+	assert.Contains(t, jsonOutput.String(), `"supported_gpus": null`)
+
+	assert.Error(t, WriteFields(&bytes.Buffer{}, fields, "yaml"))
+}
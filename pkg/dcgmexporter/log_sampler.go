@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultLogSampleInterval is the interval of the messages logged at every collection, when their state is unchanged.
+const DefaultLogSampleInterval = 5 * time.Minute
+
+var defaultLogSampler = newLogSampler(DefaultLogSampleInterval)
+
+// SetLogSampleInterval sets the interval of the messages logged at every collection; all of them are logged when it
+// is zero.
+func SetLogSampleInterval(interval time.Duration) {
+	defaultLogSampler.setInterval(interval)
+}
+
+// logSampler limits the messages logged at every collection, e.g. the kubelet being unreachable, to the changes of
+// their state and to one message per interval.
+type logSampler struct {
+	sync.Mutex
+	interval time.Duration
+	logged   map[string]sampledMessage
+	now      func() time.Time
+}
+
+type sampledMessage struct {
+	state string
+	time  time.Time
+}
+
+func newLogSampler(interval time.Duration) *logSampler {
+	return &logSampler{
+		interval: interval,
+		logged:   map[string]sampledMessage{},
+		now:      time.Now,
+	}
+}
+
+func (s *logSampler) setInterval(interval time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.interval = interval
+	s.logged = map[string]sampledMessage{}
+}
+
+// allow returns true when the state of the message changed or when the interval elapsed since it was last allowed.
+func (s *logSampler) allow(msg, state string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.interval <= 0 {
+		return true
+	}
+
+	now := s.now()
+	last, exists := s.logged[msg]
+	if exists && last.state == state && now.Sub(last.time) < s.interval {
+		return false
+	}
+
+	s.logged[msg] = sampledMessage{state: state, time: now}
+
+	return true
+}
+
+// log logs the message at the level when it is allowed, and at the debug level otherwise, or at the trace level for
+// the debug messages.
+func (s *logSampler) log(entry *logrus.Entry, level logrus.Level, state string, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+
+	if !s.allow(msg, state) {
+		if level >= logrus.DebugLevel {
+			level = logrus.TraceLevel
+		} else {
+			level = logrus.DebugLevel
+		}
+	}
+
+	if entry == nil {
+		entry = logrus.NewEntry(logrus.StandardLogger())
+	}
+	entry.Log(level, msg)
+}
+
+// logSampled logs a message of a collection with the default sampler, the state is e.g. the error or the mapping
+// that the message reports.
+func logSampled(entry *logrus.Entry, level logrus.Level, state string, format string, args ...interface{}) {
+	defaultLogSampler.log(entry, level, state, format, args...)
+}
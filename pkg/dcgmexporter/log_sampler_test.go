@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogSampler(t *testing.T) {
+	now := time.Now()
+	sampler := newLogSampler(time.Minute)
+	sampler.now = func() time.Time { return now }
+
+	assert.True(t, sampler.allow("Unable to connect to the kubelet", "connection refused"))
+	assert.False(t, sampler.allow("Unable to connect to the kubelet", "connection refused"))
+	// The messages are sampled separately
+	assert.True(t, sampler.allow("Unable to check health of GPU 0", "not supported"))
+
+	// A new state is logged, then sampled again
+	assert.True(t, sampler.allow("Unable to connect to the kubelet", "permission denied"))
+	assert.False(t, sampler.allow("Unable to connect to the kubelet", "permission denied"))
+
+	now = now.Add(30 * time.Second)
+	assert.False(t, sampler.allow("Unable to connect to the kubelet", "permission denied"))
+
+	now = now.Add(30 * time.Second)
+	assert.True(t, sampler.allow("Unable to connect to the kubelet", "permission denied"))
+
+	// Every message is logged without interval
+	sampler.setInterval(0)
+	assert.True(t, sampler.allow("Unable to connect to the kubelet", "permission denied"))
+	assert.True(t, sampler.allow("Unable to connect to the kubelet", "permission denied"))
+}
+
+func TestLogSamplerLog(t *testing.T) {
+	var output bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&output)
+	logger.SetLevel(logrus.InfoLevel)
+	logger.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+
+	sampler := newLogSampler(time.Minute)
+
+	for i := 0; i < 3; i++ {
+		sampler.log(logrus.NewEntry(logger), logrus.WarnLevel, "", "No Kubelet socket, ignoring")
+	}
+	assert.Equal(t, "level=warning msg=\"No Kubelet socket, ignoring\"\n", output.String())
+
+	// The sampled messages are demoted to debug
+	output.Reset()
+	logger.SetLevel(logrus.DebugLevel)
+	sampler.log(logrus.NewEntry(logger), logrus.WarnLevel, "", "No Kubelet socket, ignoring")
+	assert.Equal(t, "level=debug msg=\"No Kubelet socket, ignoring\"\n", output.String())
+}
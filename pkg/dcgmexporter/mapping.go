@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DeviceMapping is the attribution of the devices to the pods served by the /v1/mapping endpoint.
+type DeviceMapping struct {
+	GPUs []GPUMapping `json:"gpus"`
+}
+
+// GPUMapping holds the pods using a GPU, or one of its MIG instances when MIG is enabled.
+type GPUMapping struct {
+	UUID         string               `json:"uuid"`
+	Index        uint                 `json:"index"`
+	Device       string               `json:"device"`
+	ModelName    string               `json:"modelName,omitempty"`
+	Pods         []PodMapping         `json:"pods,omitempty"`
+	MIGInstances []MIGInstanceMapping `json:"migInstances,omitempty"`
+}
+
+// MIGInstanceMapping holds the pods using a GPU instance and the compute instances it is split into.
+type MIGInstanceMapping struct {
+	GPUInstanceID    uint                     `json:"gpuInstanceId"`
+	Profile          string                   `json:"profile"`
+	ComputeInstances []ComputeInstanceMapping `json:"computeInstances,omitempty"`
+	Pods             []PodMapping             `json:"pods,omitempty"`
+}
+
+// ComputeInstanceMapping describes a compute instance of a GPU instance.
+type ComputeInstanceMapping struct {
+	ComputeInstanceID uint   `json:"computeInstanceId"`
+	Profile           string `json:"profile"`
+}
+
+// PodMapping is a container using a device, with the replica it holds when the device is shared.
+type PodMapping struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Container string `json:"container"`
+	VGPU      string `json:"vgpu,omitempty"`
+	// MPS holds the limits of the container when the device is shared with MPS
+	MPS map[string]string `json:"mps,omitempty"`
+	// Sharing and Replicas are only known with the sharing metrics
+	Sharing  string `json:"sharing,omitempty"`
+	Replicas int    `json:"replicas,omitempty"`
+}
+
+// Mapping returns the attribution of the devices to the pods of the last run, keeping the pods of the namespaces
+// when they are set. It returns false until the pods were mapped once.
+func (p *PodMapper) Mapping(namespaces map[string]bool) (DeviceMapping, bool) {
+	if !p.mapped.Load() {
+		return DeviceMapping{}, false
+	}
+
+	p.deviceToPodsMtx.Lock()
+	defer p.deviceToPodsMtx.Unlock()
+
+	podsOf := func(key string) []PodMapping {
+		var pods []PodMapping
+		for _, podInfo := range p.deviceToPods[key] {
+			if namespaces != nil && !namespaces[podInfo.Namespace] {
+				continue
+			}
+			pods = append(pods, PodMapping{
+				Name:      podInfo.Name,
+				Namespace: podInfo.Namespace,
+				Container: podInfo.Container,
+				VGPU:      podInfo.VGPU,
+				MPS:       podInfo.MPSAttributes,
+				Sharing:   podInfo.Sharing,
+				Replicas:  podInfo.SharingReplicas,
+			})
+		}
+		return pods
+	}
+
+	mapping := DeviceMapping{GPUs: []GPUMapping{}}
+	for _, gpu := range p.sysInfo.GPUs[:p.sysInfo.GPUCount] {
+		device := fmt.Sprintf("nvidia%d", gpu.DeviceInfo.GPU)
+		gpuMapping := GPUMapping{
+			UUID:      gpu.DeviceInfo.UUID,
+			Index:     gpu.DeviceInfo.GPU,
+			Device:    device,
+			ModelName: gpu.DeviceInfo.Identifiers.Model,
+		}
+
+		// The GPUs are known by the kubelet under the identifier type of the configuration, see Metric.getIDOfType
+		if p.Config.KubernetesGPUIdType == DeviceName {
+			gpuMapping.Pods = podsOf(device)
+		} else {
+			gpuMapping.Pods = podsOf(gpu.DeviceInfo.UUID)
+		}
+
+		for _, instance := range gpu.GPUInstances {
+			instanceMapping := MIGInstanceMapping{
+				GPUInstanceID: instance.Info.NvmlInstanceId,
+				Profile:       instance.ProfileName,
+				Pods:          podsOf(fmt.Sprintf("%d-%d", gpu.DeviceInfo.GPU, instance.Info.NvmlInstanceId)),
+			}
+			for _, computeInstance := range instance.ComputeInstances {
+				instanceMapping.ComputeInstances = append(instanceMapping.ComputeInstances, ComputeInstanceMapping{
+					ComputeInstanceID: computeInstance.InstanceInfo.NvmlComputeInstanceId,
+					Profile:           computeInstance.ProfileName,
+				})
+			}
+			gpuMapping.MIGInstances = append(gpuMapping.MIGInstances, instanceMapping)
+		}
+
+		mapping.GPUs = append(mapping.GPUs, gpuMapping)
+	}
+
+	return mapping, true
+}
+
+// ServeMapping serves the attribution of the devices to the pods, scoped to the namespaces of the client like the
+// scrapes.
+func (p *PodMapper) ServeMapping(w http.ResponseWriter, r *http.Request) {
+	namespaces, err := scrapeNamespaces(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	mapping, ok := p.Mapping(namespaces)
+	if !ok {
+		http.Error(w, "the pods are not mapped yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(mapping); err != nil {
+		logrus.WithError(err).Error("Failed to write response.")
+	}
+}
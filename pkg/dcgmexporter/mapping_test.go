@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPodMapper_ServeMapping(t *testing.T) {
+	sysInfo := SystemInfo{GPUCount: 2, InfoType: dcgm.FE_GPU}
+	sysInfo.GPUs[0].DeviceInfo = dcgm.Device{GPU: 0, UUID: "GPU-0", Identifiers: dcgm.DeviceIdentifiers{Model: "A100"}}
+	sysInfo.GPUs[1].DeviceInfo = dcgm.Device{GPU: 1, UUID: "GPU-1"}
+	sysInfo.GPUs[1].MigEnabled = true
+	sysInfo.GPUs[1].GPUInstances = []GPUInstanceInfo{{
+		Info:        dcgm.MigEntityInfo{NvmlInstanceId: 3},
+		ProfileName: "3g.40gb",
+		ComputeInstances: []ComputeInstanceInfo{
+			{InstanceInfo: dcgm.MigEntityInfo{NvmlComputeInstanceId: 0}, ProfileName: "1c.3g.40gb"},
+		},
+	}}
+
+	podMapper := &PodMapper{
+		Config:  &Config{KubernetesGPUIdType: GPUUID},
+		sysInfo: sysInfo,
+		deviceToPods: map[string][]PodInfo{
+			"GPU-0": {
+				{Name: "trainer", Namespace: "a", Container: "main", VGPU: "0"},
+				{Name: "server", Namespace: "b", Container: "main", VGPU: "1"},
+			},
+			"1-3": {{Name: "notebook", Namespace: "a", Container: "jupyter"}},
+		},
+	}
+
+	server, _, err := NewMetricsServer(&Config{}, nil, NewRegistry())
+	require.NoError(t, err)
+	server.HandleMapping(podMapper)
+
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/mapping", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	podMapper.mapped.Store(true)
+
+	rec = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/mapping", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var mapping DeviceMapping
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &mapping))
+	assert.Equal(t, DeviceMapping{GPUs: []GPUMapping{{
+		UUID:      "GPU-0",
+		Index:     0,
+		Device:    "nvidia0",
+		ModelName: "A100",
+		Pods: []PodMapping{
+			{Name: "trainer", Namespace: "a", Container: "main", VGPU: "0"},
+			{Name: "server", Namespace: "b", Container: "main", VGPU: "1"},
+		},
+	}, {
+		UUID:   "GPU-1",
+		Index:  1,
+		Device: "nvidia1",
+		MIGInstances: []MIGInstanceMapping{{
+			GPUInstanceID:    3,
+			Profile:          "3g.40gb",
+			ComputeInstances: []ComputeInstanceMapping{{ComputeInstanceID: 0, Profile: "1c.3g.40gb"}},
+			Pods:             []PodMapping{{Name: "notebook", Namespace: "a", Container: "jupyter"}},
+		}},
+	}}}, mapping)
+
+	// The clients bound to namespaces only see their pods
+	req := httptest.NewRequest(http.MethodGet, "/v1/mapping", nil)
+	req = req.WithContext(withScrapeNamespaces(context.Background(), []string{"b"}))
+	rec = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	mapping = DeviceMapping{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &mapping))
+	require.Len(t, mapping.GPUs, 2)
+	assert.Equal(t, []PodMapping{{Name: "server", Namespace: "b", Container: "main", VGPU: "1"}}, mapping.GPUs[0].Pods)
+	assert.Empty(t, mapping.GPUs[1].MIGInstances[0].Pods)
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/mapping?namespace=a", nil)
+	req = req.WithContext(withScrapeNamespaces(context.Background(), []string{"b"}))
+	rec = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/mapping", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
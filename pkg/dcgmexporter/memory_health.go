@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"slices"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+// memoryHealthFields are the row remapping and ECC fields of the GPU memory. DCGM reports them for GPUs only,
+// the MIG instances inherit the values of their parent GPU.
+var memoryHealthFields = []dcgm.Short{
+	dcgm.DCGM_FI_DEV_UNCORRECTABLE_REMAPPED_ROWS,
+	dcgm.DCGM_FI_DEV_CORRECTABLE_REMAPPED_ROWS,
+	dcgm.DCGM_FI_DEV_ROW_REMAP_FAILURE,
+	dcgm.DCGM_FI_DEV_ROW_REMAP_PENDING,
+	dcgm.DCGM_FI_DEV_ECC_SBE_VOL_TOTAL,
+	dcgm.DCGM_FI_DEV_ECC_DBE_VOL_TOTAL,
+	dcgm.DCGM_FI_DEV_ECC_SBE_AGG_TOTAL,
+	dcgm.DCGM_FI_DEV_ECC_DBE_AGG_TOTAL,
+	dcgm.DCGM_FI_DEV_ECC_SBE_AGG_L1,
+	dcgm.DCGM_FI_DEV_ECC_DBE_AGG_L1,
+	dcgm.DCGM_FI_DEV_ECC_SBE_AGG_L2,
+	dcgm.DCGM_FI_DEV_ECC_DBE_AGG_L2,
+	dcgm.DCGM_FI_DEV_ECC_SBE_AGG_DEV,
+	dcgm.DCGM_FI_DEV_ECC_DBE_AGG_DEV,
+	dcgm.DCGM_FI_DEV_ECC_SBE_AGG_REG,
+	dcgm.DCGM_FI_DEV_ECC_DBE_AGG_REG,
+	dcgm.DCGM_FI_DEV_ECC_SBE_AGG_TEX,
+	dcgm.DCGM_FI_DEV_ECC_DBE_AGG_TEX,
+}
+
+// inheritedMemoryHealthFields returns the memory health fields among the watched fields.
+func inheritedMemoryHealthFields(deviceFields []dcgm.Short) []dcgm.Short {
+	var fields []dcgm.Short
+	for _, field := range deviceFields {
+		if slices.Contains(memoryHealthFields, field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// inheritParentValues replaces the memory health values of a MIG instance with the values of its parent GPU.
+func inheritParentValues(values, parentValues []dcgm.FieldValue_v1) []dcgm.FieldValue_v1 {
+	inherited := make([]dcgm.FieldValue_v1, 0, len(values))
+	for _, val := range values {
+		if !slices.Contains(memoryHealthFields, dcgm.Short(val.FieldId)) {
+			inherited = append(inherited, val)
+		}
+	}
+
+	for _, val := range parentValues {
+		if slices.Contains(memoryHealthFields, dcgm.Short(val.FieldId)) {
+			inherited = append(inherited, val)
+		}
+	}
+
+	return inherited
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInheritedMemoryHealthFields(t *testing.T) {
+	assert.Equal(t, []dcgm.Short{dcgm.DCGM_FI_DEV_ROW_REMAP_PENDING, dcgm.DCGM_FI_DEV_ECC_DBE_AGG_TOTAL},
+		inheritedMemoryHealthFields([]dcgm.Short{
+			dcgm.DCGM_FI_DEV_GPU_TEMP,
+			dcgm.DCGM_FI_DEV_ROW_REMAP_PENDING,
+			dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE,
+			dcgm.DCGM_FI_DEV_ECC_DBE_AGG_TOTAL,
+		}))
+	assert.Empty(t, inheritedMemoryHealthFields([]dcgm.Short{dcgm.DCGM_FI_DEV_GPU_TEMP}))
+}
+
+func TestInheritParentValues(t *testing.T) {
+	instanceValues := []dcgm.FieldValue_v1{
+		{FieldId: dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE, Ts: 14},
+		{FieldId: dcgm.DCGM_FI_DEV_ROW_REMAP_PENDING, Ts: 14},
+	}
+	parentValues := []dcgm.FieldValue_v1{
+		{FieldId: dcgm.DCGM_FI_DEV_ROW_REMAP_PENDING, Ts: 1},
+		{FieldId: dcgm.DCGM_FI_DEV_CORRECTABLE_REMAPPED_ROWS, Ts: 1},
+	}
+
+	assert.Equal(t, []dcgm.FieldValue_v1{
+		{FieldId: dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE, Ts: 14},
+		{FieldId: dcgm.DCGM_FI_DEV_ROW_REMAP_PENDING, Ts: 1},
+		{FieldId: dcgm.DCGM_FI_DEV_CORRECTABLE_REMAPPED_ROWS, Ts: 1},
+	}, inheritParentValues(instanceValues, parentValues))
+}
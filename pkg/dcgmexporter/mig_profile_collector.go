@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	migMemorySizeLabel         = "memory_size_mib"
+	migSMCountLabel            = "sm_count"
+	migComputeInstanceIDsLabel = "compute_instance_ids"
+)
+
+// migProfileInfoCollector exports a series per MIG GPU instance describing the capacity of its profile, so that the
+// utilization of instances of different sizes can be normalized. The profile, the parent GPU and the GPU instance ID
+// are the usual labels of the MIG metrics.
+type migProfileInfoCollector struct {
+	expCollector
+}
+
+// IsDCGMExpMIGProfileInfoEnabled checks if the DCGM_EXP_MIG_PROFILE_INFO counter exists
+func IsDCGMExpMIGProfileInfoEnabled(counters []Counter) bool {
+	return slices.ContainsFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpMIGProfileInfo
+	})
+}
+
+func NewMIGProfileInfoCollector(counters []Counter,
+	hostname string,
+	config *Config,
+	fieldEntityGroupTypeSystemInfo FieldEntityGroupTypeSystemInfoItem) (Collector, error) {
+	if !IsDCGMExpMIGProfileInfoEnabled(counters) {
+		logrus.Error(dcgmExpMIGProfileInfo + " collector is disabled")
+		return nil, fmt.Errorf(dcgmExpMIGProfileInfo + " collector is disabled")
+	}
+
+	transformations, err := getTransformations(config)
+	if err != nil {
+		return nil, err
+	}
+
+	collector := migProfileInfoCollector{
+		expCollector: expCollector{
+			sysInfo:         fieldEntityGroupTypeSystemInfo.SystemInfo,
+			hostname:        hostname,
+			config:          config,
+			transformations: transformations,
+		},
+	}
+
+	collector.counter = counters[slices.IndexFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpMIGProfileInfo
+	})]
+
+	return &collector, nil
+}
+
+func (c *migProfileInfoCollector) GetMetrics() (MetricsByCounter, error) {
+	uuid := "UUID"
+	if c.config.UseOldNamespace {
+		uuid = "uuid"
+	}
+
+	metrics := make(MetricsByCounter)
+
+	for _, mi := range GetMonitoredEntities(c.sysInfo) {
+		if mi.InstanceInfo == nil {
+			continue
+		}
+
+		computeInstanceIDs := make([]string, 0, len(mi.InstanceInfo.ComputeInstances))
+		for _, ci := range mi.InstanceInfo.ComputeInstances {
+			id := strconv.FormatUint(uint64(ci.InstanceInfo.NvmlComputeInstanceId), 10)
+			computeInstanceIDs = append(computeInstanceIDs, id)
+		}
+
+		labels := map[string]string{
+			migMemorySizeLabel:         strconv.FormatUint(mi.InstanceInfo.MemorySizeMB, 10),
+			migSMCountLabel:            strconv.FormatUint(uint64(mi.InstanceInfo.MultiprocessorCount), 10),
+			migComputeInstanceIDsLabel: strings.Join(computeInstanceIDs, ","),
+		}
+
+		m := c.createMetric(labels, mi, uuid, 1)
+		metrics[c.counter] = append(metrics[c.counter], m)
+	}
+
+	for _, transform := range c.transformations {
+		err := transform.Process(metrics, c.sysInfo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform metrics for transform '%s'; err: %v", transform.Name(), err)
+		}
+	}
+
+	return metrics, nil
+}
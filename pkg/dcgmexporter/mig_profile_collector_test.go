@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+func TestMIGProfileInfoCollector_GetMetrics(t *testing.T) {
+	counter := Counter{FieldName: dcgmExpMIGProfileInfo, PromType: "gauge"}
+
+	sysInfo := SystemInfo{
+		GPUCount: 2,
+		gOpt:     DeviceOptions{Flex: true},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i, UUID: fmt.Sprintf("GPU-%d", i)}
+	}
+	sysInfo.GPUs[1].MigEnabled = true
+	sysInfo.GPUs[1].GPUInstances = []GPUInstanceInfo{
+		{
+			Info:        dcgm.MigEntityInfo{GpuUuid: "GPU-1", NvmlInstanceId: 1},
+			ProfileName: "3g.40gb",
+			EntityId:    1,
+			ComputeInstances: []ComputeInstanceInfo{
+				{InstanceInfo: dcgm.MigEntityInfo{NvmlInstanceId: 1, NvmlComputeInstanceId: 0}},
+				{InstanceInfo: dcgm.MigEntityInfo{NvmlInstanceId: 1, NvmlComputeInstanceId: 1}},
+			},
+		},
+		{
+			Info:        dcgm.MigEntityInfo{GpuUuid: "GPU-1", NvmlInstanceId: 2},
+			ProfileName: "1g.10gb",
+			EntityId:    2,
+		},
+	}
+
+	defer func() {
+		nvmlGetGPUInstanceProfileInfoHook = nvmlprovider.GetGPUInstanceProfileInfo
+	}()
+	nvmlGetGPUInstanceProfileInfoHook = func(uuid string, gpuInstanceID uint) (*nvmlprovider.GPUInstanceProfileInfo, error) {
+		require.Equal(t, "GPU-1", uuid)
+		if gpuInstanceID == 2 {
+			return nil, fmt.Errorf("unknown profile")
+		}
+		return &nvmlprovider.GPUInstanceProfileInfo{MemorySizeMB: 40192, MultiprocessorCount: 42}, nil
+	}
+	PopulateMigProfileCapacities(&sysInfo)
+
+	collector, err := NewMIGProfileInfoCollector([]Counter{counter}, "node", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{SystemInfo: sysInfo})
+	require.NoError(t, err)
+	defer collector.Cleanup()
+
+	metrics, err := collector.GetMetrics()
+	require.NoError(t, err)
+	// The GPU without MIG has no series
+	require.Len(t, metrics[counter], 2)
+
+	m := metrics[counter][0]
+	assert.Equal(t, "1", m.Value)
+	assert.Equal(t, "GPU-1", m.GPUUUID)
+	assert.Equal(t, "3g.40gb", m.MigProfile)
+	assert.Equal(t, "1", m.GPUInstanceID)
+	assert.Equal(t, map[string]string{
+		migMemorySizeLabel:         "40192",
+		migSMCountLabel:            "42",
+		migComputeInstanceIDsLabel: "0,1",
+	}, m.Labels)
+
+	// The capacity is unknown when NVML cannot tell the profile
+	assert.Equal(t, map[string]string{
+		migMemorySizeLabel:         "0",
+		migSMCountLabel:            "0",
+		migComputeInstanceIDsLabel: "",
+	}, metrics[counter][1].Labels)
+
+	_, err = NewMIGProfileInfoCollector([]Counter{{FieldName: dcgmExpFabricManagerStatus}}, "node", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{SystemInfo: sysInfo})
+	assert.Error(t, err)
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+// aggregatedAttribute labels the series rolling up the metrics of the MIG instances to their GPU
+const aggregatedAttribute = "aggregated"
+
+type migRollupAggregation int
+
+const (
+	// migRollupSum adds up the values of the instances, e.g. their framebuffer
+	migRollupSum migRollupAggregation = iota
+	// migRollupSMWeighted averages the values of the instances weighted by their number of SMs
+	migRollupSMWeighted
+	// migRollupMemoryWeighted averages the values of the instances weighted by their memory size
+	migRollupMemoryWeighted
+)
+
+// migRollups lists the fields whose metrics of the MIG instances are rolled up to their GPU, and how they are
+// combined.
+var migRollups = map[dcgm.Short]migRollupAggregation{
+	dcgm.DCGM_FI_DEV_FB_TOTAL:            migRollupSum,
+	dcgm.DCGM_FI_DEV_FB_FREE:             migRollupSum,
+	dcgm.DCGM_FI_DEV_FB_USED:             migRollupSum,
+	dcgm.DCGM_FI_DEV_FB_RESERVED:         migRollupSum,
+	dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE:   migRollupSMWeighted,
+	dcgm.DCGM_FI_PROF_SM_ACTIVE:          migRollupSMWeighted,
+	dcgm.DCGM_FI_PROF_SM_OCCUPANCY:       migRollupSMWeighted,
+	dcgm.DCGM_FI_PROF_PIPE_TENSOR_ACTIVE: migRollupSMWeighted,
+	dcgm.DCGM_FI_PROF_PIPE_FP64_ACTIVE:   migRollupSMWeighted,
+	dcgm.DCGM_FI_PROF_PIPE_FP32_ACTIVE:   migRollupSMWeighted,
+	dcgm.DCGM_FI_PROF_PIPE_FP16_ACTIVE:   migRollupSMWeighted,
+	dcgm.DCGM_FI_PROF_DRAM_ACTIVE:        migRollupMemoryWeighted,
+}
+
+// migInstanceCapacity is the capacity of the profile of a MIG instance, the weight of its values in the rollups.
+type migInstanceCapacity struct {
+	multiprocessors float64
+	memory          float64
+}
+
+type migRollupValue struct {
+	template Metric
+	sum      float64
+	weights  float64
+	// unweighted holds the sum and the number of the values, the average is unweighted when the capacity of an
+	// instance is unknown
+	unweighted      float64
+	count           int
+	unknownCapacity bool
+}
+
+// migRollup adds a series per GPU rolling up the metrics of its MIG instances, labeled aggregated="true", so that the
+// capacity of the GPUs doesn't depend on their partitioning. It comes before the mappings, so that the series are
+// attributed like the metrics of the whole GPUs.
+type migRollup struct{}
+
+func newMIGRollup() *migRollup {
+	return &migRollup{}
+}
+
+func (r *migRollup) Name() string {
+	return "migRollup"
+}
+
+func (r *migRollup) Process(metrics MetricsByCounter, sysInfo SystemInfo) error {
+	capacities := migInstanceCapacities(sysInfo)
+
+	for counter, counterMetrics := range metrics {
+		aggregation, exists := migRollups[counter.FieldID]
+		if !exists || counter.PromType == histogramPromType {
+			continue
+		}
+
+		values := map[string]*migRollupValue{}
+		var gpus []string
+		for _, metric := range counterMetrics {
+			if metric.GPUInstanceID == "" {
+				continue
+			}
+
+			value, err := strconv.ParseFloat(metric.Value, 64)
+			if err != nil {
+				continue
+			}
+
+			key := metric.Hostname + "/" + metric.GPU
+			rollup, exists := values[key]
+			if !exists {
+				rollup = &migRollupValue{template: metric}
+				values[key] = rollup
+				gpus = append(gpus, key)
+			}
+
+			capacity, known := capacities[metric.GPU+"/"+metric.GPUInstanceID]
+			weight := capacity.multiprocessors
+			if aggregation == migRollupMemoryWeighted {
+				weight = capacity.memory
+			}
+			if !known || weight == 0 {
+				rollup.unknownCapacity = true
+			}
+
+			rollup.sum += value * weight
+			rollup.weights += weight
+			rollup.unweighted += value
+			rollup.count++
+		}
+
+		for _, key := range gpus {
+			rollup := values[key]
+
+			result := rollup.unweighted
+			switch {
+			case aggregation == migRollupSum:
+			case rollup.unknownCapacity:
+				result /= float64(rollup.count)
+			default:
+				result = rollup.sum / rollup.weights
+			}
+
+			metrics[counter] = append(metrics[counter], migRollupMetric(rollup.template, result))
+		}
+	}
+
+	return nil
+}
+
+// migRollupMetric returns the series of a GPU rolling up the metrics of its instances, labeled with the device
+// labels of the GPU.
+func migRollupMetric(instance Metric, value float64) Metric {
+	m := instance.withAttributes()
+	m.Value = fmt.Sprintf("%f", value)
+	setMigLabels(&m, nil)
+	m.Attributes[aggregatedAttribute] = "true"
+	m.Exemplar = nil
+	m.ExemplarTimestamp = time.Time{}
+
+	return m
+}
+
+// migInstanceCapacities returns the capacity of the MIG instances by GPU and GPU instance ID, as labeled in their
+// metrics.
+func migInstanceCapacities(sysInfo SystemInfo) map[string]migInstanceCapacity {
+	capacities := map[string]migInstanceCapacity{}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		gpu := sysInfo.GPUs[i]
+		for _, instance := range gpu.GPUInstances {
+			key := fmt.Sprintf("%d/%d", gpu.DeviceInfo.GPU, instance.Info.NvmlInstanceId)
+			capacities[key] = migInstanceCapacity{
+				multiprocessors: float64(instance.MultiprocessorCount),
+				memory:          float64(instance.MemorySizeMB),
+			}
+		}
+	}
+
+	return capacities
+}
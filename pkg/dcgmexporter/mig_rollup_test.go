@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMIGRollup(t *testing.T) {
+	fbCounter := Counter{FieldID: dcgm.DCGM_FI_DEV_FB_USED, FieldName: "DCGM_FI_DEV_FB_USED", PromType: "gauge"}
+	smCounter := Counter{FieldID: dcgm.DCGM_FI_PROF_SM_ACTIVE, FieldName: "DCGM_FI_PROF_SM_ACTIVE", PromType: "gauge"}
+	dramCounter := Counter{FieldID: dcgm.DCGM_FI_PROF_DRAM_ACTIVE, FieldName: "DCGM_FI_PROF_DRAM_ACTIVE",
+		PromType: "gauge"}
+	tempCounter := Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+
+	var sysInfo SystemInfo
+	sysInfo.GPUCount = 2
+	sysInfo.GPUs[0].DeviceInfo.GPU = 0
+	sysInfo.GPUs[0].GPUInstances = []GPUInstanceInfo{
+		{Info: dcgm.MigEntityInfo{NvmlInstanceId: 1}, MultiprocessorCount: 14, MemorySizeMB: 10240},
+		{Info: dcgm.MigEntityInfo{NvmlInstanceId: 2}, MultiprocessorCount: 42, MemorySizeMB: 40960},
+	}
+	// The capacity of the instances of GPU 1 is unknown, their activity is averaged
+	sysInfo.GPUs[1].DeviceInfo.GPU = 1
+	sysInfo.GPUs[1].GPUInstances = []GPUInstanceInfo{
+		{Info: dcgm.MigEntityInfo{NvmlInstanceId: 1}},
+		{Info: dcgm.MigEntityInfo{NvmlInstanceId: 2}},
+	}
+
+	instance := func(gpu, instance, value string) Metric {
+		return Metric{
+			GPU: gpu, GPUUUID: "GPU-" + gpu, GPUInstanceID: instance, MigProfile: "1g.10gb", Hostname: "node",
+			Value: value, Attributes: map[string]string{}, Exemplar: map[string]string{"pod_uid": "uid"},
+		}
+	}
+
+	metrics := MetricsByCounter{
+		fbCounter: {
+			instance("0", "1", "1024"), instance("0", "2", "2048"), instance("1", "1", "512"),
+		},
+		smCounter: {
+			instance("0", "1", "0.8"), instance("0", "2", "0.4"), instance("1", "1", "0.2"), instance("1", "2", "0.6"),
+		},
+		dramCounter: {
+			instance("0", "1", "0.5"), instance("0", "2", "0"),
+		},
+		tempCounter: {
+			instance("0", "1", "40"),
+		},
+		// The GPUs without MIG are not rolled up
+		Counter{FieldID: dcgm.DCGM_FI_DEV_FB_FREE, FieldName: "DCGM_FI_DEV_FB_FREE", PromType: "gauge"}: {
+			{GPU: "2", Value: "4096", Attributes: map[string]string{}},
+		},
+	}
+
+	require.NoError(t, newMIGRollup().Process(metrics, sysInfo))
+
+	rollups := func(counter Counter) map[string]string {
+		values := map[string]string{}
+		for _, metric := range metrics[counter] {
+			if metric.Attributes[aggregatedAttribute] != "true" {
+				continue
+			}
+			assert.Empty(t, metric.GPUInstanceID)
+			assert.Empty(t, metric.MigProfile)
+			assert.Nil(t, metric.Exemplar)
+			assert.Equal(t, "GPU-"+metric.GPU, metric.GPUUUID)
+			assert.Equal(t, "node", metric.Hostname)
+			values[metric.GPU] = metric.Value
+		}
+		return values
+	}
+
+	assert.Equal(t, map[string]string{"0": "3072.000000", "1": "512.000000"}, rollups(fbCounter))
+	// (0.8 * 14 + 0.4 * 42) / 56
+	assert.Equal(t, map[string]string{"0": "0.500000", "1": "0.400000"}, rollups(smCounter))
+	// (0.5 * 10240 + 0 * 40960) / 51200
+	assert.Equal(t, map[string]string{"0": "0.100000"}, rollups(dramCounter))
+	assert.Empty(t, rollups(tempCounter))
+	assert.Len(t, metrics[tempCounter], 1)
+
+	// The instances are left unchanged
+	assert.Len(t, metrics[fbCounter], 5)
+	assert.Equal(t, map[string]string{}, metrics[fbCounter][0].Attributes)
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import "fmt"
+
+const dcgmExporterMIGStrategy = "DCGM_EXPORTER_MIG_STRATEGY"
+
+// loadMIGStrategy reads the device plugin configuration file, e.g. mounted from the ConfigMap of the GPU operator,
+// and returns its MIG strategy, or an empty strategy when it is not set.
+func loadMIGStrategy(path string) (MIGStrategy, error) {
+	config, err := loadDevicePluginConfig(path)
+	if err != nil {
+		return "", err
+	}
+
+	switch strategy := config.Flags.MigStrategy; strategy {
+	case "", MIGStrategyNone, MIGStrategySingle, MIGStrategyMixed:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("invalid MIG strategy '%s' in device plugin config '%s'", strategy, path)
+	}
+}
+
+// setMIGStrategyMetric exports the MIG strategy in effect, the strategies are all 0 when it is unknown.
+func setMIGStrategyMetric(strategy MIGStrategy) {
+	for _, s := range []MIGStrategy{MIGStrategyNone, MIGStrategySingle, MIGStrategyMixed} {
+		value := 0.0
+		if s == strategy {
+			value = 1
+		}
+		selfMetrics.SetGauge(dcgmExporterMIGStrategy,
+			"MIG strategy of the device plugin, none, single or mixed, the value is 1 for the strategy in effect.",
+			map[string]string{"strategy": string(s)}, value)
+	}
+}
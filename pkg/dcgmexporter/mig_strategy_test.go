@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMIGStrategy(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    MIGStrategy
+		wantErr bool
+	}{
+		{
+			name:   "When the MIG strategy is not set",
+			config: "version: v1\n",
+			want:   "",
+		},
+		{
+			name:   "When the MIG strategy is set",
+			config: "version: v1\nflags:\n  migStrategy: single\n",
+			want:   MIGStrategySingle,
+		},
+		{
+			name:    "When the MIG strategy is invalid",
+			config:  "version: v1\nflags:\n  migStrategy: all\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.config), 0o644))
+
+			got, err := loadMIGStrategy(path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
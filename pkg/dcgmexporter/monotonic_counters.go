@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+const dcgmExporterCounterResetsTotal = "DCGM_EXPORTER_COUNTER_RESETS_TOTAL"
+
+// cumulativeFieldNames are the DCGM fields counting since the driver was loaded or the GPU was reset, so their
+// values only go backwards on a reset.
+var cumulativeFieldNames = []string{
+	"DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION",
+	"DCGM_FI_DEV_PCIE_REPLAY_COUNTER",
+	"DCGM_FI_DEV_ECC_SBE_VOL_TOTAL",
+	"DCGM_FI_DEV_ECC_DBE_VOL_TOTAL",
+	"DCGM_FI_DEV_ECC_SBE_AGG_TOTAL",
+	"DCGM_FI_DEV_ECC_DBE_AGG_TOTAL",
+	"DCGM_FI_DEV_ECC_SBE_VOL_DEV",
+	"DCGM_FI_DEV_ECC_DBE_VOL_DEV",
+	"DCGM_FI_DEV_ECC_SBE_AGG_DEV",
+	"DCGM_FI_DEV_ECC_DBE_AGG_DEV",
+	"DCGM_FI_DEV_ECC_SBE_VOL_L1",
+	"DCGM_FI_DEV_ECC_DBE_VOL_L1",
+	"DCGM_FI_DEV_ECC_SBE_AGG_L1",
+	"DCGM_FI_DEV_ECC_DBE_AGG_L1",
+	"DCGM_FI_DEV_ECC_SBE_VOL_L2",
+	"DCGM_FI_DEV_ECC_DBE_VOL_L2",
+	"DCGM_FI_DEV_ECC_SBE_AGG_L2",
+	"DCGM_FI_DEV_ECC_DBE_AGG_L2",
+	"DCGM_FI_DEV_ECC_SBE_VOL_REG",
+	"DCGM_FI_DEV_ECC_DBE_VOL_REG",
+	"DCGM_FI_DEV_ECC_SBE_AGG_REG",
+	"DCGM_FI_DEV_ECC_DBE_AGG_REG",
+	"DCGM_FI_DEV_ECC_SBE_VOL_TEX",
+	"DCGM_FI_DEV_ECC_DBE_VOL_TEX",
+	"DCGM_FI_DEV_ECC_SBE_AGG_TEX",
+	"DCGM_FI_DEV_ECC_DBE_AGG_TEX",
+	"DCGM_FI_DEV_RETIRED_SBE",
+	"DCGM_FI_DEV_RETIRED_DBE",
+	"DCGM_FI_DEV_POWER_VIOLATION",
+	"DCGM_FI_DEV_THERMAL_VIOLATION",
+	"DCGM_FI_DEV_SYNC_BOOST_VIOLATION",
+	"DCGM_FI_DEV_BOARD_LIMIT_VIOLATION",
+	"DCGM_FI_DEV_LOW_UTIL_VIOLATION",
+	"DCGM_FI_DEV_RELIABILITY_VIOLATION",
+	"DCGM_FI_DEV_TOTAL_APP_CLOCKS_VIOLATION",
+	"DCGM_FI_DEV_TOTAL_BASE_CLOCKS_VIOLATION",
+	"DCGM_FI_DEV_NVLINK_CRC_FLIT_ERROR_COUNT_TOTAL",
+	"DCGM_FI_DEV_NVLINK_CRC_DATA_ERROR_COUNT_TOTAL",
+	"DCGM_FI_DEV_NVLINK_REPLAY_ERROR_COUNT_TOTAL",
+	"DCGM_FI_DEV_NVLINK_RECOVERY_ERROR_COUNT_TOTAL",
+}
+
+var cumulativeFields = func() map[dcgm.Short]bool {
+	fields := map[dcgm.Short]bool{}
+	for _, name := range cumulativeFieldNames {
+		if fieldID, exists := dcgm.DCGM_FI[name]; exists {
+			fields[fieldID] = true
+		}
+	}
+	return fields
+}()
+
+// monotonicCounters returns the counters with the cumulative fields exported as counters, named with a _total
+// suffix. The labels and the bitmasks are left unchanged.
+func monotonicCounters(counters []Counter) []Counter {
+	result := make([]Counter, len(counters))
+	for i, counter := range counters {
+		result[i] = counter
+		if !cumulativeFields[counter.FieldID] || counter.PromType == "label" || counter.PromType == bitmaskPromType {
+			continue
+		}
+
+		if counter.PromType != "counter" {
+			logrus.Infof("Exporting the cumulative field %s as a counter instead of a %s",
+				counter.FieldName, counter.PromType)
+		}
+
+		result[i].PromType = "counter"
+		if !strings.HasSuffix(strings.ToLower(counter.FieldName), "_total") {
+			result[i].FieldName += "_total"
+		}
+	}
+
+	return result
+}
+
+// counterResets keeps the cumulative fields increasing when they are reset, e.g. by a GPU reset or a driver reload:
+// the last value read before the reset is added to the values read after it.
+type counterResets struct {
+	sync.Mutex
+	// fields are the cumulative fields kept increasing
+	fields map[dcgm.Short]bool
+	series map[fieldSeriesKey]*resetSeries
+	// store persists the series across the restarts of the exporter, it is nil when the state is not persisted
+	store *stateStore
+}
+
+type resetSeries struct {
+	last   float64
+	offset float64
+}
+
+// newCounterResets returns nil when the monotonic counters and the energy counters are disabled, the energy counters
+// only keep the energy consumption increasing.
+func newCounterResets(config *Config) *counterResets {
+	if config == nil || (!config.MonotonicCounters && !config.EnergyCounters) {
+		return nil
+	}
+
+	fields := cumulativeFields
+	if !config.MonotonicCounters {
+		fields = map[dcgm.Short]bool{dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION: true}
+	}
+
+	return &counterResets{
+		fields: fields,
+		series: map[fieldSeriesKey]*resetSeries{},
+		store:  getStateStore(),
+	}
+}
+
+func (r *counterResets) adjust(mi MonitoringInfo, values []dcgm.FieldValue_v1) []dcgm.FieldValue_v1 {
+	r.Lock()
+	defer r.Unlock()
+
+	for i, value := range values {
+		if !r.fields[dcgm.Short(value.FieldId)] {
+			continue
+		}
+
+		raw, ok := numericFieldValue(value)
+		if !ok {
+			continue
+		}
+
+		entity := mi.Entity
+		name := cumulativeFieldName(dcgm.Short(value.FieldId))
+		stateKey := "counter_resets/" + entityStateKey(mi) + "/" + name
+
+		key := fieldSeriesKey{entity: entity, parentID: mi.ParentId, fieldID: value.FieldId}
+		series, exists := r.series[key]
+		if !exists {
+			series = &resetSeries{}
+			r.series[key] = series
+
+			// The series continues from the state of the previous run of the exporter
+			if r.store != nil {
+				if state, ok := r.store.get(stateKey); ok && len(state) == 2 {
+					series.last, series.offset = state[0], state[1]
+				}
+			}
+		}
+
+		if raw < series.last {
+			series.offset += series.last
+			logrus.Infof("%s of %s %d went backwards from %v to %v, the counter continues from %v",
+				name, entity.EntityGroupId, entity.EntityId, series.last, raw, series.offset+raw)
+			selfMetrics.AddCounter(dcgmExporterCounterResetsTotal,
+				"Number of times a cumulative DCGM field went backwards, e.g. after a GPU reset or a driver reload.",
+				map[string]string{"field": name}, 1)
+		}
+		series.last = raw
+		if r.store != nil {
+			r.store.set(stateKey, series.last, series.offset)
+		}
+
+		if series.offset == 0 {
+			continue
+		}
+
+		adjusted := int64FieldValue(int64(raw + series.offset))
+		if value.FieldType == dcgm.DCGM_FT_DOUBLE {
+			adjusted = doubleFieldValue(raw + series.offset)
+		}
+		adjusted.Version = value.Version
+		adjusted.FieldId = value.FieldId
+		adjusted.Status = value.Status
+		adjusted.Ts = value.Ts
+		values[i] = adjusted
+	}
+
+	return values
+}
+
+func cumulativeFieldName(fieldID dcgm.Short) string {
+	for _, name := range cumulativeFieldNames {
+		if dcgm.DCGM_FI[name] == fieldID {
+			return name
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonotonicCounters(t *testing.T) {
+	counters := monotonicCounters([]Counter{
+		{dcgm.DCGM_FI_DEV_PCIE_REPLAY_COUNTER, "DCGM_FI_DEV_PCIE_REPLAY_COUNTER", "counter", "PCIe retries"},
+		{dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION, "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", "gauge", "Energy"},
+		{dcgm.DCGM_FI_DEV_ECC_DBE_VOL_TOTAL, "DCGM_FI_DEV_ECC_DBE_VOL_TOTAL", "counter", "DBE errors"},
+		{dcgm.DCGM_FI_DEV_GPU_TEMP, "DCGM_FI_DEV_GPU_TEMP", "gauge", "Temperature"},
+		{dcgm.DCGM_FI_DEV_RETIRED_SBE, "DCGM_FI_DEV_RETIRED_SBE", "label", "Retired pages"},
+	})
+
+	assert.Equal(t, []Counter{
+		{dcgm.DCGM_FI_DEV_PCIE_REPLAY_COUNTER, "DCGM_FI_DEV_PCIE_REPLAY_COUNTER_total", "counter", "PCIe retries"},
+		{dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION, "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_total", "counter", "Energy"},
+		{dcgm.DCGM_FI_DEV_ECC_DBE_VOL_TOTAL, "DCGM_FI_DEV_ECC_DBE_VOL_TOTAL", "counter", "DBE errors"},
+		{dcgm.DCGM_FI_DEV_GPU_TEMP, "DCGM_FI_DEV_GPU_TEMP", "gauge", "Temperature"},
+		{dcgm.DCGM_FI_DEV_RETIRED_SBE, "DCGM_FI_DEV_RETIRED_SBE", "label", "Retired pages"},
+	}, counters)
+}
+
+func TestCounterResets(t *testing.T) {
+	assert.Nil(t, newCounterResets(&Config{}))
+
+	resets := newCounterResets(&Config{MonotonicCounters: true})
+	gpu := dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU, EntityId: 0}
+
+	read := func(replays int64, energy float64) []string {
+		replayValue := int64FieldValue(replays)
+		replayValue.FieldId = uint(dcgm.DCGM_FI_DEV_PCIE_REPLAY_COUNTER)
+		energyValue := doubleFieldValue(energy)
+		energyValue.FieldId = uint(dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION)
+		tempValue := int64FieldValue(40)
+		tempValue.FieldId = uint(dcgm.DCGM_FI_DEV_GPU_TEMP)
+
+		values := resets.adjust(MonitoringInfo{Entity: gpu, ParentId: PARENT_ID_IGNORED},
+			[]dcgm.FieldValue_v1{replayValue, energyValue, tempValue})
+		result := make([]string, len(values))
+		for i, value := range values {
+			result[i] = ToString(value)
+		}
+		return result
+	}
+
+	labels := map[string]string{"field": "DCGM_FI_DEV_PCIE_REPLAY_COUNTER"}
+	before, _ := selfMetrics.Value(dcgmExporterCounterResetsTotal, labels)
+
+	assert.Equal(t, []string{"10", "1000.000000", "40"}, read(10, 1000))
+	assert.Equal(t, []string{"12", "1500.000000", "40"}, read(12, 1500))
+	// The GPU was reset, the counters continue from their last values
+	assert.Equal(t, []string{"13", "1600.000000", "40"}, read(1, 100))
+	assert.Equal(t, []string{"15", "1700.000000", "40"}, read(3, 200))
+	// A second reset adds up with the first one
+	assert.Equal(t, []string{"15", "1700.000000", "40"}, read(0, 0))
+
+	after, _ := selfMetrics.Value(dcgmExporterCounterResetsTotal, labels)
+	assert.Equal(t, float64(2), after-before)
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+const sharedResourceSuffix = ".shared"
+
+// devicePluginConfig is the subset of the NVIDIA device plugin configuration file describing the MIG strategy, and
+// MPS and time-slicing sharing.
+type devicePluginConfig struct {
+	Flags struct {
+		MigStrategy MIGStrategy `json:"migStrategy"`
+	} `json:"flags"`
+	Sharing struct {
+		MPS         *replicatedResources `json:"mps"`
+		TimeSlicing *replicatedResources `json:"timeSlicing"`
+	} `json:"sharing"`
+}
+
+type replicatedResources struct {
+	RenameByDefault bool                 `json:"renameByDefault"`
+	Resources       []replicatedResource `json:"resources"`
+}
+
+type replicatedResource struct {
+	Name     string `json:"name"`
+	Rename   string `json:"rename"`
+	Replicas int    `json:"replicas"`
+}
+
+// loadMPSResources reads the device plugin configuration file and returns the number of MPS replicas
+// for every resource name advertised to the kubelet.
+func loadMPSResources(path string) (map[string]int, error) {
+	config, err := loadDevicePluginConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.Sharing.MPS.replicas("MPS")
+}
+
+// loadTimeSlicingResources reads the device plugin configuration file and returns the number of time-slicing
+// replicas for every resource name advertised to the kubelet.
+func loadTimeSlicingResources(path string) (map[string]int, error) {
+	config, err := loadDevicePluginConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.Sharing.TimeSlicing.replicas("time-slicing")
+}
+
+func loadDevicePluginConfig(path string) (devicePluginConfig, error) {
+	var config devicePluginConfig
+
+	file, err := os.Open(path)
+	if err != nil {
+		return config, fmt.Errorf("could not open device plugin config '%s'; err: %w", path, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return config, fmt.Errorf("could not read device plugin config '%s'; err: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("could not parse device plugin config '%s'; err: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// replicas returns the number of replicas of every resource name advertised to the kubelet.
+func (r *replicatedResources) replicas(sharing string) (map[string]int, error) {
+	resources := map[string]int{}
+
+	if r == nil {
+		return resources, nil
+	}
+
+	for _, resource := range r.Resources {
+		if resource.Replicas < 1 {
+			return nil, fmt.Errorf("invalid number of %s replicas %d for resource '%s'", sharing, resource.Replicas,
+				resource.Name)
+		}
+
+		name := resource.Name
+		switch {
+		case resource.Rename != "":
+			name = resource.Rename
+		case r.RenameByDefault:
+			name += sharedResourceSuffix
+		}
+
+		resources[name] = resource.Replicas
+	}
+
+	return resources, nil
+}
+
+// mpsAttributes returns the MPS limits applied by the device plugin to every client of the shared GPU.
+func mpsAttributes(gpuUUID string, replicas int) map[string]string {
+	attrs := map[string]string{
+		mpsAttribute:                       "true",
+		mpsActiveThreadPercentageAttribute: strconv.Itoa(100 / replicas),
+	}
+
+	memoryTotal, err := nvmlGetMemoryTotalByUUIDHook(gpuUUID)
+	if err != nil {
+		logrus.WithError(err).Debugf("Unable to get total memory of GPU '%s'", gpuUUID)
+		return attrs
+	}
+
+	attrs[mpsPinnedMemoryLimitAttribute] = strconv.FormatUint(memoryTotal/uint64(replicas)/(1024*1024), 10)
+
+	return attrs
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+func TestLoadMPSResources(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    map[string]int
+		wantErr bool
+	}{
+		{
+			name: "When MPS sharing is not configured",
+			config: `
+version: v1
+sharing:
+  timeSlicing:
+    resources:
+    - name: nvidia.com/gpu
+      replicas: 4
+`,
+			want: map[string]int{},
+		},
+		{
+			name: "When MPS resources keep their name",
+			config: `
+version: v1
+sharing:
+  mps:
+    resources:
+    - name: nvidia.com/gpu
+      replicas: 4
+`,
+			want: map[string]int{"nvidia.com/gpu": 4},
+		},
+		{
+			name: "When MPS resources are renamed",
+			config: `
+version: v1
+sharing:
+  mps:
+    renameByDefault: true
+    resources:
+    - name: nvidia.com/gpu
+      replicas: 2
+    - name: nvidia.com/mig-1g.10gb
+      rename: example.com/small-gpu
+      replicas: 5
+`,
+			want: map[string]int{"nvidia.com/gpu.shared": 2, "example.com/small-gpu": 5},
+		},
+		{
+			name: "When the number of replicas is invalid",
+			config: `
+sharing:
+  mps:
+    resources:
+    - name: nvidia.com/gpu
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := os.CreateTemp(t.TempDir(), "config*.yaml")
+			require.NoError(t, err)
+			_, err = file.WriteString(tt.config)
+			require.NoError(t, err)
+			require.NoError(t, file.Close())
+
+			got, err := loadMPSResources(file.Name())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMPSAttributes(t *testing.T) {
+	defer func() {
+		nvmlGetMemoryTotalByUUIDHook = nvmlprovider.GetMemoryTotalByUUID
+	}()
+
+	nvmlGetMemoryTotalByUUIDHook = func(uuid string) (uint64, error) {
+		return 80 * 1024 * 1024 * 1024, nil
+	}
+
+	assert.Equal(t, map[string]string{
+		mpsAttribute:                       "true",
+		mpsActiveThreadPercentageAttribute: "25",
+		mpsPinnedMemoryLimitAttribute:      "20480",
+	}, mpsAttributes("GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5", 4))
+
+	nvmlGetMemoryTotalByUUIDHook = func(uuid string) (uint64, error) {
+		return 0, errors.New("boom")
+	}
+
+	assert.Equal(t, map[string]string{
+		mpsAttribute:                       "true",
+		mpsActiveThreadPercentageAttribute: "25",
+	}, mpsAttributes("GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5", 4))
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// scrapeNamespacesKey is the key of the context of the requests holding the namespaces the authenticated client is
+// bound to.
+type scrapeNamespacesKey struct{}
+
+func withScrapeNamespaces(ctx context.Context, namespaces []string) context.Context {
+	return context.WithValue(ctx, scrapeNamespacesKey{}, namespaces)
+}
+
+// scrapeNamespaces returns the namespaces the response of the scrape is scoped to, nil when it isn't. The clients
+// bound to namespaces by their identity only get those, or the subset of them they ask for with the namespace query
+// parameter; the others get the namespaces they ask for.
+func scrapeNamespaces(r *http.Request) (map[string]bool, error) {
+	bound, isBound := r.Context().Value(scrapeNamespacesKey{}).([]string)
+	requested := r.URL.Query()["namespace"]
+
+	if len(requested) == 0 {
+		requested = bound
+	}
+	if len(requested) == 0 {
+		return nil, nil
+	}
+
+	namespaces := make(map[string]bool, len(requested))
+	for _, namespace := range requested {
+		if isBound && !slices.Contains(bound, namespace) {
+			return nil, fmt.Errorf("the namespace '%s' is not allowed", namespace)
+		}
+		namespaces[namespace] = true
+	}
+
+	return namespaces, nil
+}
+
+// namespacesScope keeps the samples attributed to a pod of one of the namespaces, so that the tenants neither see the
+// metrics of the pods of their neighbors nor the unattributed ones.
+// The namespace is read from the first of the namespace labels the sample has.
+func namespacesScope(namespaces map[string]bool, namespaceLabels []string) func(name, labels string) bool {
+	return func(_, labels string) bool {
+		for _, label := range namespaceLabels {
+			if namespace, ok := sampleLabel(labels, label); ok {
+				return namespaces[namespace]
+			}
+		}
+		return false
+	}
+}
+
+// sampleLabel returns the unescaped value of the label in the label set of a sample, e.g. {gpu="0",namespace="a"}.
+func sampleLabel(labels, name string) (string, bool) {
+	labels = strings.TrimSuffix(strings.TrimPrefix(labels, "{"), "}")
+
+	for len(labels) > 0 {
+		labels = strings.TrimLeft(labels, ", ")
+
+		eq := strings.Index(labels, `="`)
+		if eq < 0 {
+			return "", false
+		}
+		key := labels[:eq]
+		labels = labels[eq+2:]
+
+		var value strings.Builder
+		i := 0
+		for ; i < len(labels) && labels[i] != '"'; i++ {
+			if labels[i] == '\\' && i+1 < len(labels) {
+				i++
+				switch labels[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(labels[i])
+				}
+				continue
+			}
+			value.WriteByte(labels[i])
+		}
+
+		if key == name {
+			return value.String(), true
+		}
+
+		if i < len(labels) {
+			i++
+		}
+		labels = labels[i:]
+	}
+
+	return "", false
+}
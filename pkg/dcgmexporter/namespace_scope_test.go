@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespacesScope(t *testing.T) {
+	metrics := `# HELP DCGM_FI_DEV_GPU_UTIL GPU utilization (in %).
+# TYPE DCGM_FI_DEV_GPU_UTIL gauge
+DCGM_FI_DEV_GPU_UTIL{gpu="0",UUID="GPU-0",pod="a-0",namespace="team-a",container="main"} 42
+DCGM_FI_DEV_GPU_UTIL{gpu="0",UUID="GPU-0",pod="b-0",namespace="team-b",container="main"} 42
+DCGM_FI_DEV_GPU_UTIL{gpu="1",UUID="GPU-1"} 0
+# HELP DCGM_FI_DEV_FB_USED Framebuffer memory used (in MiB).
+# TYPE DCGM_FI_DEV_FB_USED gauge
+DCGM_FI_DEV_FB_USED{gpu="0",UUID="GPU-0",pod="b-0",namespace="team-b"} 1024
+# HELP DCGM_FI_DEV_XID_ERRORS Value of the last XID error encountered.
+# TYPE DCGM_FI_DEV_XID_ERRORS gauge
+DCGM_FI_DEV_XID_ERRORS{gpu="0",UUID="GPU-0",pod_name="a-0",pod_namespace="team-a",err_msg="a \"quoted\", message"} 0
+# HELP DCGM_EXP_SCRAPE_DURATION_SECONDS Duration of the scrape.
+# TYPE DCGM_EXP_SCRAPE_DURATION_SECONDS gauge
+DCGM_EXP_SCRAPE_DURATION_SECONDS 0.1
+`
+
+	assert.Equal(t, `# HELP DCGM_FI_DEV_GPU_UTIL GPU utilization (in %).
+# TYPE DCGM_FI_DEV_GPU_UTIL gauge
+DCGM_FI_DEV_GPU_UTIL{gpu="0",UUID="GPU-0",pod="a-0",namespace="team-a",container="main"} 42
+# HELP DCGM_FI_DEV_XID_ERRORS Value of the last XID error encountered.
+# TYPE DCGM_FI_DEV_XID_ERRORS gauge
+DCGM_FI_DEV_XID_ERRORS{gpu="0",UUID="GPU-0",pod_name="a-0",pod_namespace="team-a",err_msg="a \"quoted\", message"} 0
+`, filterSamples(metrics, namespacesScope(map[string]bool{"team-a": true}, podAttributeNames{}.namespaceLabels())))
+
+	assert.Empty(t, filterSamples(metrics, namespacesScope(map[string]bool{"team-c": true}, podAttributeNames{}.namespaceLabels())))
+}
+
+func TestSampleLabel(t *testing.T) {
+	labels := `{err_msg="a \"namespace=\\\"x\\\"\", b",namespace="team-a"}`
+
+	value, ok := sampleLabel(labels, "namespace")
+	assert.True(t, ok)
+	assert.Equal(t, "team-a", value)
+
+	value, ok = sampleLabel(labels, "err_msg")
+	assert.True(t, ok)
+	assert.Equal(t, `a "namespace=\"x\"", b`, value)
+
+	_, ok = sampleLabel(labels, "pod")
+	assert.False(t, ok)
+	_, ok = sampleLabel("", "namespace")
+	assert.False(t, ok)
+}
+
+func TestScrapeNamespaces(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		bound   []string
+		want    map[string]bool
+		wantErr bool
+	}{
+		{
+			name: "unscoped",
+			url:  "/metrics",
+		},
+		{
+			name: "requested",
+			url:  "/metrics?namespace=team-a&namespace=team-b",
+			want: map[string]bool{"team-a": true, "team-b": true},
+		},
+		{
+			name:  "bound",
+			url:   "/metrics",
+			bound: []string{"team-a", "team-b"},
+			want:  map[string]bool{"team-a": true, "team-b": true},
+		},
+		{
+			name:  "bound and requested",
+			url:   "/metrics?namespace=team-b",
+			bound: []string{"team-a", "team-b"},
+			want:  map[string]bool{"team-b": true},
+		},
+		{
+			name:    "bound and requested another",
+			url:     "/metrics?namespace=team-c",
+			bound:   []string{"team-a"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.bound != nil {
+				req = req.WithContext(withScrapeNamespaces(req.Context(), tt.bound))
+			}
+
+			namespaces, err := scrapeNamespaces(req)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, namespaces)
+		})
+	}
+}
@@ -0,0 +1,299 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+const (
+	// sourceAttribute labels the metrics that are not collected with DCGM
+	sourceAttribute = "source"
+	nvmlSource      = "nvml"
+)
+
+var (
+	nvmlGetDevicesHook       = nvmlprovider.GetDevices
+	nvmlGetDeviceMetricsHook = nvmlprovider.GetDeviceMetrics
+	nvmlNewXidEventsHook     = func(uuids []string) (nvmlXidEvents, error) {
+		return nvmlprovider.NewXidEvents(uuids)
+	}
+)
+
+// nvmlXidEvents reads the last XID error of the GPUs that got one since the previous read, by UUID.
+type nvmlXidEvents interface {
+	Read() (map[string]uint64, error)
+	Close()
+}
+
+// nvmlFields are the fields collected with NVML when DCGM is unavailable.
+var nvmlFields = map[dcgm.Short]bool{
+	dcgm.DCGM_FI_DEV_GPU_UTIL:                 true,
+	dcgm.DCGM_FI_DEV_MEM_COPY_UTIL:            true,
+	dcgm.DCGM_FI_DEV_FB_USED:                  true,
+	dcgm.DCGM_FI_DEV_FB_FREE:                  true,
+	dcgm.DCGM_FI_DEV_GPU_TEMP:                 true,
+	dcgm.DCGM_FI_DEV_POWER_USAGE:              true,
+	dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION: true,
+	dcgm.DCGM_FI_DEV_XID_ERRORS:               true,
+}
+
+// NewNVMLEntityGroupTypeSystemInfo returns the GPUs found by NVML with the fields of the counters that NVML
+// collects, for when DCGM is unavailable. The MIG instances are not monitored.
+func NewNVMLEntityGroupTypeSystemInfo(c []Counter, config *Config) (*FieldEntityGroupTypeSystemInfo, error) {
+	devices, err := nvmlGetDevicesHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the GPUs with NVML; err: %w", err)
+	}
+
+	return newSourceEntityGroupTypeSystemInfo(c, config, devices, nvmlFields, nvmlSource)
+}
+
+// NewNVMLCollector returns a collector constructor reading the values of the fields with NVML instead of DCGM, the
+// metrics are labeled with source="nvml".
+func NewNVMLCollector() DCGMCollectorConstructor {
+	return func(
+		c []Counter, hostname string, config *Config, item FieldEntityGroupTypeSystemInfoItem,
+	) (*DCGMCollector, func(), error) {
+		if item.isEmpty() {
+			return nil, func() {}, fmt.Errorf("fieldEntityGroupTypeSystemInfo is empty")
+		}
+
+		source, err := newNVMLFieldSource(item.SystemInfo)
+		if err != nil {
+			return nil, func() {}, err
+		}
+
+		collector := newSourceCollector(c, hostname, config, item, source, nvmlSource)
+		collector.Cleanups = []func(){source.close}
+
+		return collector, func() { collector.Cleanup() }, nil
+	}
+}
+
+// newSourceEntityGroupTypeSystemInfo returns the GPUs of a source other than DCGM with the fields of the counters
+// that the source collects, the other fields are not collected.
+func newSourceEntityGroupTypeSystemInfo(
+	c []Counter, config *Config, devices []nvmlprovider.DeviceInfo, fields map[dcgm.Short]bool, source string,
+) (*FieldEntityGroupTypeSystemInfo, error) {
+	sysInfo := SystemInfo{InfoType: dcgm.FE_GPU}
+	for _, device := range devices {
+		id := uint(device.Index)
+		sysInfo.GPUs[id] = GPUInfo{
+			DeviceInfo: dcgm.Device{
+				GPU:  id,
+				UUID: device.UUID,
+				PCI:  dcgm.PCIInfo{BusID: device.PCIBusID},
+				Identifiers: dcgm.DeviceIdentifiers{
+					Brand: "NVIDIA",
+					Model: device.Name,
+				},
+			},
+		}
+		sysInfo.GPUCount++
+	}
+	gOpt, err := resolveDeviceUUIDs(sysInfo, config.GPUDevices)
+	if err != nil {
+		return nil, err
+	}
+	sysInfo.gOpt = gOpt
+
+	if err := VerifyDevicePresence(&sysInfo, gOpt); err != nil {
+		return nil, err
+	}
+
+	var deviceFields []dcgm.Short
+	for _, counter := range c {
+		if !fields[counter.FieldID] {
+			if counter.PromType != "label" {
+				logrus.Warnf("Not collecting %s metrics with %s", counter.FieldName, source)
+			}
+			continue
+		}
+		deviceFields = append(deviceFields, counter.FieldID)
+	}
+
+	e := NewEntityGroupTypeSystemInfo(c, config)
+	if len(deviceFields) > 0 {
+		e.items[dcgm.FE_GPU] = FieldEntityGroupTypeSystemInfoItem{
+			SystemInfo:   sysInfo,
+			DeviceFields: deviceFields,
+		}
+	}
+
+	return e, nil
+}
+
+// newSourceCollector returns a collector reading the values of the fields from a source other than DCGM, the metrics
+// are labeled with the source.
+func newSourceCollector(
+	c []Counter, hostname string, config *Config, item FieldEntityGroupTypeSystemInfoItem, source fieldValuesSource,
+	label string,
+) *DCGMCollector {
+	collector := &DCGMCollector{
+		Counters:     c,
+		DeviceFields: item.DeviceFields,
+		SysInfo:      item.SystemInfo,
+		Hostname:     hostname,
+		source:       source,
+		sourceLabel:  label,
+	}
+
+	if config != nil {
+		collector.UseOldNamespace = config.UseOldNamespace
+		collector.ReplaceBlanksInModelName = config.ReplaceBlanksInModelName
+		collector.aggregator = newFieldAggregator(config)
+		collector.resets = newCounterResets(config)
+		collector.workers = config.CollectWorkers
+		if config.MonotonicCounters {
+			collector.Counters = monotonicCounters(c)
+		}
+		if config.EnergyCounters {
+			collector.Counters = energyCounters(collector.Counters)
+			collector.energyJoules = true
+		}
+		if config.MetricNames == MetricNamesPrometheus {
+			collector.Counters, collector.unitScales = prometheusCounters(collector.Counters)
+		}
+	}
+
+	return collector
+}
+
+// nvmlFieldSource reads the values of the fields of the GPUs with NVML.
+type nvmlFieldSource struct {
+	mtx sync.Mutex
+	// uuids holds the UUIDs of the GPUs by ID
+	uuids     map[uint]string
+	xidEvents nvmlXidEvents
+	// xids holds the last XID error of the GPUs by UUID
+	xids map[string]uint64
+}
+
+func newNVMLFieldSource(sysInfo SystemInfo) (*nvmlFieldSource, error) {
+	s := &nvmlFieldSource{uuids: map[uint]string{}, xids: map[string]uint64{}}
+
+	uuids := make([]string, 0, sysInfo.GPUCount)
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		uuid := sysInfo.GPUs[i].DeviceInfo.UUID
+		s.uuids[sysInfo.GPUs[i].DeviceInfo.GPU] = uuid
+		uuids = append(uuids, uuid)
+	}
+
+	xidEvents, err := nvmlNewXidEventsHook(uuids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register the XID errors with NVML; err: %w", err)
+	}
+	s.xidEvents = xidEvents
+
+	return s, nil
+}
+
+func (s *nvmlFieldSource) latestValues(
+	entity dcgm.GroupEntityPair, _ uint, fields []dcgm.Short,
+) ([]dcgm.FieldValue_v1, error) {
+	uuid, exists := s.uuids[entity.EntityId]
+	if !exists || entity.EntityGroupId != dcgm.FE_GPU {
+		return nil, fmt.Errorf("no GPU %d in NVML", entity.EntityId)
+	}
+
+	metrics, err := nvmlGetDeviceMetricsHook(uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	xid := s.lastXid(uuid)
+
+	values := make([]dcgm.FieldValue_v1, 0, len(fields))
+	for _, fieldID := range fields {
+		value := nvmlFieldValue(fieldID, metrics, xid)
+		value.FieldId = uint(fieldID)
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func (s *nvmlFieldSource) collected(SystemInfo) {}
+
+// lastXid returns the last XID error of the GPU, 0 when it got none since the exporter started.
+func (s *nvmlFieldSource) lastXid(uuid string) uint64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	xids, err := s.xidEvents.Read()
+	if err != nil {
+		logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(), "Unable to read the XID errors with NVML")
+	}
+	for gpu, xid := range xids {
+		s.xids[gpu] = xid
+	}
+
+	return s.xids[uuid]
+}
+
+func (s *nvmlFieldSource) close() {
+	s.xidEvents.Close()
+}
+
+// nvmlFieldValue returns the value of the field in the units of DCGM, blank when the GPU doesn't support it.
+func nvmlFieldValue(fieldID dcgm.Short, metrics *nvmlprovider.DeviceMetrics, xid uint64) dcgm.FieldValue_v1 {
+	blank := int64FieldValue(dcgm.DCGM_FT_INT64_BLANK)
+
+	switch fieldID {
+	case dcgm.DCGM_FI_DEV_GPU_UTIL:
+		if metrics.GPUUtil != nil {
+			return int64FieldValue(int64(*metrics.GPUUtil))
+		}
+	case dcgm.DCGM_FI_DEV_MEM_COPY_UTIL:
+		if metrics.MemoryUtil != nil {
+			return int64FieldValue(int64(*metrics.MemoryUtil))
+		}
+	case dcgm.DCGM_FI_DEV_FB_USED:
+		// The framebuffer fields are in MiB
+		if metrics.MemoryUsed != nil {
+			return int64FieldValue(int64(*metrics.MemoryUsed >> 20))
+		}
+	case dcgm.DCGM_FI_DEV_FB_FREE:
+		if metrics.MemoryFree != nil {
+			return int64FieldValue(int64(*metrics.MemoryFree >> 20))
+		}
+	case dcgm.DCGM_FI_DEV_GPU_TEMP:
+		if metrics.Temperature != nil {
+			return int64FieldValue(int64(*metrics.Temperature))
+		}
+	case dcgm.DCGM_FI_DEV_POWER_USAGE:
+		// The power usage is in W
+		if metrics.PowerUsage != nil {
+			return doubleFieldValue(float64(*metrics.PowerUsage) / 1000)
+		}
+	case dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION:
+		if metrics.TotalEnergy != nil {
+			return int64FieldValue(int64(*metrics.TotalEnergy))
+		}
+	case dcgm.DCGM_FI_DEV_XID_ERRORS:
+		return int64FieldValue(int64(xid))
+	}
+
+	return blank
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+type fakeXidEvents struct {
+	pending map[string]uint64
+	closed  bool
+}
+
+func (f *fakeXidEvents) Read() (map[string]uint64, error) {
+	xids := f.pending
+	f.pending = nil
+	return xids, nil
+}
+
+func (f *fakeXidEvents) Close() {
+	f.closed = true
+}
+
+func TestNVMLCollector(t *testing.T) {
+	ptr32 := func(v uint32) *uint32 { return &v }
+	ptr64 := func(v uint64) *uint64 { return &v }
+
+	xidEvents := &fakeXidEvents{}
+	defer func(getDevices, getMetrics, newXidEvents interface{}) {
+		nvmlGetDevicesHook = getDevices.(func() ([]nvmlprovider.DeviceInfo, error))
+		nvmlGetDeviceMetricsHook = getMetrics.(func(string) (*nvmlprovider.DeviceMetrics, error))
+		nvmlNewXidEventsHook = newXidEvents.(func([]string) (nvmlXidEvents, error))
+	}(nvmlGetDevicesHook, nvmlGetDeviceMetricsHook, nvmlNewXidEventsHook)
+
+	nvmlGetDevicesHook = func() ([]nvmlprovider.DeviceInfo, error) {
+		return []nvmlprovider.DeviceInfo{
+			{Index: 0, UUID: "GPU-0", Name: "NVIDIA T4", PCIBusID: "00000000:01:00.0"},
+			{Index: 1, UUID: "GPU-1", Name: "Orin"},
+		}, nil
+	}
+	nvmlGetDeviceMetricsHook = func(uuid string) (*nvmlprovider.DeviceMetrics, error) {
+		if uuid == "GPU-1" {
+			// The integrated GPU doesn't report its memory
+			return &nvmlprovider.DeviceMetrics{GPUUtil: ptr32(50), Temperature: ptr32(45)}, nil
+		}
+		return &nvmlprovider.DeviceMetrics{
+			GPUUtil:     ptr32(90),
+			MemoryUsed:  ptr64(2 << 30),
+			Temperature: ptr32(60),
+			PowerUsage:  ptr32(70500),
+		}, nil
+	}
+	nvmlNewXidEventsHook = func([]string) (nvmlXidEvents, error) {
+		return xidEvents, nil
+	}
+
+	counters := []Counter{
+		{FieldID: dcgm.DCGM_FI_DEV_GPU_UTIL, FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_DEV_FB_USED, FieldName: "DCGM_FI_DEV_FB_USED", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_DEV_POWER_USAGE, FieldName: "DCGM_FI_DEV_POWER_USAGE", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_DEV_XID_ERRORS, FieldName: "DCGM_FI_DEV_XID_ERRORS", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE, FieldName: "DCGM_FI_PROF_GR_ENGINE_ACTIVE", PromType: "gauge"},
+	}
+
+	config := &Config{GPUDevices: DeviceOptions{Flex: true}}
+	systemInfo, err := NewNVMLEntityGroupTypeSystemInfo(counters, config)
+	require.NoError(t, err)
+
+	item, exists := systemInfo.Get(dcgm.FE_GPU)
+	require.True(t, exists)
+	assert.Equal(t, uint(2), item.SystemInfo.GPUCount)
+	// The profiling fields are not collected with NVML
+	assert.NotContains(t, item.DeviceFields, dcgm.Short(dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE))
+
+	collector, cleanup, err := NewNVMLCollector()(counters, "node", config, item)
+	require.NoError(t, err)
+
+	values := func(metrics MetricsByCounter, counter Counter) map[string]string {
+		byGPU := map[string]string{}
+		for _, metric := range metrics[counter] {
+			assert.Equal(t, nvmlSource, metric.Attributes[sourceAttribute])
+			byGPU[metric.GPUUUID] = metric.Value
+		}
+		return byGPU
+	}
+
+	metrics, err := collector.GetMetrics()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"GPU-0": "90", "GPU-1": "50"}, values(metrics, counters[0]))
+	// The memory is in MiB, the power in W, the unsupported values are skipped
+	assert.Equal(t, map[string]string{"GPU-0": "2048"}, values(metrics, counters[1]))
+	assert.Equal(t, map[string]string{"GPU-0": "70.500000"}, values(metrics, counters[2]))
+	assert.Equal(t, map[string]string{"GPU-0": "0", "GPU-1": "0"}, values(metrics, counters[3]))
+
+	// The last XID error of the GPU is kept
+	xidEvents.pending = map[string]uint64{"GPU-1": 79}
+	for i := 0; i < 2; i++ {
+		metrics, err = collector.GetMetrics()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"GPU-0": "0", "GPU-1": "79"}, values(metrics, counters[3]))
+	}
+
+	cleanup()
+	assert.True(t, xidEvents.closed)
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const openMetricsEOF = "# EOF\n"
+
+type createdCounter struct {
+	created time.Time
+	value   float64
+}
+
+// openMetricsConverter rewrites the Prometheus text exposition format into the OpenMetrics 1.0 format.
+// Counter families lose their _total suffix, their samples get it, and every counter sample is followed by
+// a _created sample. The created timestamp is the time the series was first seen, it moves forward when
+// the counter goes backwards or the series reappears, so consumers can tell resets apart.
+type openMetricsConverter struct {
+	mtx      sync.Mutex
+	counters map[string]createdCounter
+}
+
+func newOpenMetricsConverter() *openMetricsConverter {
+	return &openMetricsConverter{
+		counters: map[string]createdCounter{},
+	}
+}
+
+// convert converts the metrics, without the trailing # EOF, and forgets the counters missing from them.
+func (c *openMetricsConverter) convert(metrics string, now time.Time) string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var sb strings.Builder
+	sb.Grow(len(metrics) * 2)
+
+	seen := make(map[string]createdCounter, len(c.counters))
+
+	var family, familyType string
+
+	// The HELP line comes before the TYPE line, it is written once the name of the family is known
+	var helpName, helpText string
+	flushHelp := func(name string) {
+		if helpName != "" {
+			sb.WriteString("# HELP " + name + " " + helpText + "\n")
+			helpName, helpText = "", ""
+		}
+	}
+
+	for _, line := range strings.Split(metrics, "\n") {
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "# ") {
+			fields := strings.SplitN(line, " ", 4)
+			if len(fields) < 3 || (fields[1] != "HELP" && fields[1] != "TYPE") {
+				continue
+			}
+
+			name, text := fields[2], ""
+			if len(fields) == 4 {
+				text = fields[3]
+			}
+
+			if fields[1] == "HELP" {
+				flushHelp(helpName)
+				// Double quotes must be escaped in OpenMetrics
+				helpName, helpText = name, strings.ReplaceAll(text, `"`, `\"`)
+				continue
+			}
+
+			family, familyType = name, text
+			switch familyType {
+			case "counter":
+				family = strings.TrimSuffix(name, "_total")
+			case "untyped":
+				familyType = "unknown"
+			}
+
+			if helpName == name {
+				flushHelp(family)
+			} else {
+				flushHelp(helpName)
+			}
+			sb.WriteString("# TYPE " + family + " " + familyType + "\n")
+			// The metrics named after the Prometheus naming conventions end with their unit
+			if unit := metricUnit(family); unit != "" {
+				sb.WriteString("# UNIT " + family + " " + unit + "\n")
+			}
+			continue
+		}
+
+		flushHelp(helpName)
+
+		name, labels, rest := splitSample(line)
+		if familyType != "counter" || (name != family && name != family+"_total") {
+			sb.WriteString(line + "\n")
+			continue
+		}
+
+		sb.WriteString(family + "_total" + labels + " " + rest + "\n")
+
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+
+		key := family + labels
+		counter, exists := c.counters[key]
+		if !exists || value < counter.value {
+			counter.created = now
+		}
+		counter.value = value
+		seen[key] = counter
+
+		created := strconv.FormatFloat(float64(counter.created.UnixMilli())/1000, 'f', -1, 64)
+		sb.WriteString(family + "_created" + labels + " " + created + "\n")
+	}
+	flushHelp(helpName)
+
+	c.counters = seen
+
+	return sb.String()
+}
+
+// splitSample splits a sample line into its name, its label set with the braces, and the rest of the line
+// holding the value and the optional exemplar.
+func splitSample(sample string) (name, labels, rest string) {
+	end := strings.IndexAny(sample, "{ ")
+	if end < 0 {
+		return sample, "", ""
+	}
+
+	name = sample[:end]
+
+	if sample[end] == '{' {
+		inQuotes, escaped := false, false
+		for i := end + 1; i < len(sample); i++ {
+			switch {
+			case escaped:
+				escaped = false
+			case sample[i] == '\\':
+				escaped = inQuotes
+			case sample[i] == '"':
+				inQuotes = !inQuotes
+			case sample[i] == '}' && !inQuotes:
+				return name, sample[end : i+1], strings.TrimSpace(sample[i+1:])
+			}
+		}
+	}
+
+	return name, "", strings.TrimSpace(sample[end:])
+}
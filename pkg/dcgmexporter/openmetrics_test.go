@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenMetricsConverter_Convert(t *testing.T) {
+	converter := newOpenMetricsConverter()
+	start := time.UnixMilli(1700000000000)
+
+	metrics := `# HELP DCGM_FI_DEV_GPU_TEMP GPU temperature (in "C").
+# TYPE DCGM_FI_DEV_GPU_TEMP gauge
+DCGM_FI_DEV_GPU_TEMP{gpu="0",UUID="GPU-0"} 42
+# HELP DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION Total energy consumption since boot (in mJ).
+# TYPE DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION counter
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION{gpu="0",UUID="GPU-0"} 1000
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION{gpu="1",UUID="GPU-1"} 2000
+# HELP DCGM_EXPORTER_REMOTE_WRITE_FAILURES_total Failures.
+# TYPE DCGM_EXPORTER_REMOTE_WRITE_FAILURES_total counter
+DCGM_EXPORTER_REMOTE_WRITE_FAILURES_total 1
+`
+
+	assert.Equal(t, `# HELP DCGM_FI_DEV_GPU_TEMP GPU temperature (in \"C\").
+# TYPE DCGM_FI_DEV_GPU_TEMP gauge
+DCGM_FI_DEV_GPU_TEMP{gpu="0",UUID="GPU-0"} 42
+# HELP DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION Total energy consumption since boot (in mJ).
+# TYPE DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION counter
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_total{gpu="0",UUID="GPU-0"} 1000
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_created{gpu="0",UUID="GPU-0"} 1700000000
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_total{gpu="1",UUID="GPU-1"} 2000
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_created{gpu="1",UUID="GPU-1"} 1700000000
+# HELP DCGM_EXPORTER_REMOTE_WRITE_FAILURES Failures.
+# TYPE DCGM_EXPORTER_REMOTE_WRITE_FAILURES counter
+DCGM_EXPORTER_REMOTE_WRITE_FAILURES_total 1
+DCGM_EXPORTER_REMOTE_WRITE_FAILURES_created 1700000000
+`, converter.convert(metrics, start))
+
+	// GPU 0 is reset, GPU 1 disappears then comes back
+	converted := converter.convert(`# TYPE DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION counter
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION{gpu="0",UUID="GPU-0"} 10
+`, start.Add(time.Second))
+	assert.Contains(t, converted, `DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_created{gpu="0",UUID="GPU-0"} 1700000001`+"\n")
+
+	converted = converter.convert(`# TYPE DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION counter
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION{gpu="0",UUID="GPU-0"} 20
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION{gpu="1",UUID="GPU-1"} 3000
+`, start.Add(2*time.Second))
+	assert.Contains(t, converted, `DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_created{gpu="0",UUID="GPU-0"} 1700000001`+"\n")
+	assert.Contains(t, converted, `DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_created{gpu="1",UUID="GPU-1"} 1700000002`+"\n")
+}
+
+func TestOpenMetricsConverter_KeepsExemplars(t *testing.T) {
+	converter := newOpenMetricsConverter()
+
+	converted := converter.convert(`# TYPE DCGM_FI_PROF_PCIE_TX_BYTES counter
+DCGM_FI_PROF_PCIE_TX_BYTES{gpu="0",pod="p"} 5 # {pod_uid="u"} 5
+`, time.UnixMilli(1700000000500))
+
+	assert.Equal(t, `# TYPE DCGM_FI_PROF_PCIE_TX_BYTES counter
+DCGM_FI_PROF_PCIE_TX_BYTES_total{gpu="0",pod="p"} 5 # {pod_uid="u"} 5
+DCGM_FI_PROF_PCIE_TX_BYTES_created{gpu="0",pod="p"} 1700000000.5
+`, converted)
+}
+
+func TestOpenMetricsConverter_Units(t *testing.T) {
+	converter := newOpenMetricsConverter()
+
+	converted := converter.convert(`# HELP DCGM_FI_DEV_GPU_TEMP_celsius Current temperature of the device (in celsius).
+# TYPE DCGM_FI_DEV_GPU_TEMP_celsius gauge
+DCGM_FI_DEV_GPU_TEMP_celsius{gpu="0"} 42
+# TYPE DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_joules_total counter
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_joules_total{gpu="0"} 1.5
+# TYPE DCGM_EXP_AVERAGE_POWER_WATTS gauge
+DCGM_EXP_AVERAGE_POWER_WATTS{gpu="0"} 100
+`, time.UnixMilli(1700000000000))
+
+	assert.Equal(t, `# HELP DCGM_FI_DEV_GPU_TEMP_celsius Current temperature of the device (in celsius).
+# TYPE DCGM_FI_DEV_GPU_TEMP_celsius gauge
+# UNIT DCGM_FI_DEV_GPU_TEMP_celsius celsius
+DCGM_FI_DEV_GPU_TEMP_celsius{gpu="0"} 42
+# TYPE DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_joules counter
+# UNIT DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_joules joules
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_joules_total{gpu="0"} 1.5
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_joules_created{gpu="0"} 1700000000
+# TYPE DCGM_EXP_AVERAGE_POWER_WATTS gauge
+DCGM_EXP_AVERAGE_POWER_WATTS{gpu="0"} 100
+`, converted)
+}
+
+func TestSplitSample(t *testing.T) {
+	tests := []struct {
+		sample     string
+		wantName   string
+		wantLabels string
+		wantRest   string
+	}{
+		{sample: `A 1`, wantName: "A", wantRest: "1"},
+		{sample: `A{a="b"} 1`, wantName: "A", wantLabels: `{a="b"}`, wantRest: "1"},
+		{sample: `A{a="}\" #"} 1 # {b="c"} 1`, wantName: "A", wantLabels: `{a="}\" #"}`, wantRest: `1 # {b="c"} 1`},
+	}
+
+	for _, tt := range tests {
+		name, labels, rest := splitSample(tt.sample)
+		assert.Equal(t, tt.wantName, name, tt.sample)
+		assert.Equal(t, tt.wantLabels, labels, tt.sample)
+		assert.Equal(t, tt.wantRest, rest, tt.sample)
+	}
+}
@@ -0,0 +1,386 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type OTLPProtocol string
+
+const (
+	OTLPProtocolGRPC OTLPProtocol = "grpc"
+	OTLPProtocolHTTP OTLPProtocol = "http/protobuf"
+)
+
+const (
+	dcgmExporterOTLPExportFailuresTotal = "DCGM_EXPORTER_OTLP_EXPORT_FAILURES_TOTAL"
+
+	otlpExportMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+	otlpScopeName    = "github.com/NVIDIA/dcgm-exporter"
+
+	// OTLP aggregation temporality and resource attributes
+	otlpCumulativeTemporality = 2
+	otlpHostNameAttribute     = "host.name"
+	otlpClusterNameAttribute  = "k8s.cluster.name"
+	otlpGPUUUIDAttribute      = "gpu.uuid"
+)
+
+// OTLPSink pushes the metrics of every collection to an OpenTelemetry collector, GPU metrics are grouped
+// in one resource per GPU.
+type OTLPSink struct {
+	protocol   OTLPProtocol
+	endpoint   string
+	headers    map[string]string
+	attributes map[string]string
+
+	conn       *grpc.ClientConn
+	httpClient *http.Client
+	startTime  time.Time
+}
+
+// NewOTLPSink creates an OTLPSink for the configured endpoint.
+func NewOTLPSink(c *Config, hostname string) (*OTLPSink, error) {
+	headers, err := parseKeyValues(c.OTLPHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP headers; err: %w", err)
+	}
+
+	attributes, err := parseKeyValues(c.OTLPResourceAttributes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP resource attributes; err: %w", err)
+	}
+
+	if hostname != "" {
+		attributes[otlpHostNameAttribute] = hostname
+	}
+
+	if c.OTLPClusterName != "" {
+		attributes[otlpClusterNameAttribute] = c.OTLPClusterName
+	}
+
+	sink := &OTLPSink{
+		protocol:   c.OTLPProtocol,
+		endpoint:   c.OTLPEndpoint,
+		headers:    headers,
+		attributes: attributes,
+		startTime:  time.Now(),
+	}
+
+	switch c.OTLPProtocol {
+	case OTLPProtocolGRPC, "":
+		sink.protocol = OTLPProtocolGRPC
+
+		creds := credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+		if c.OTLPInsecure {
+			creds = insecure.NewCredentials()
+		}
+
+		sink.conn, err = grpc.Dial(c.OTLPEndpoint, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to OTLP endpoint '%s'; err: %w", c.OTLPEndpoint, err)
+		}
+	case OTLPProtocolHTTP:
+		if !strings.HasPrefix(c.OTLPEndpoint, "http://") && !strings.HasPrefix(c.OTLPEndpoint, "https://") {
+			return nil, fmt.Errorf("invalid OTLP endpoint '%s'; the http/protobuf protocol requires a URL",
+				c.OTLPEndpoint)
+		}
+
+		sink.httpClient = &http.Client{}
+	default:
+		return nil, fmt.Errorf("invalid OTLP protocol '%s'; possible values: '%s', '%s'",
+			c.OTLPProtocol, OTLPProtocolGRPC, OTLPProtocolHTTP)
+	}
+
+	return sink, nil
+}
+
+func (s *OTLPSink) Name() string {
+	return "otlp"
+}
+
+func (s *OTLPSink) Write(ctx context.Context, metrics MetricsByCounter, timestamp time.Time) error {
+	req := s.encodeRequest(metrics, timestamp)
+
+	var err error
+	if s.protocol == OTLPProtocolGRPC {
+		err = s.exportGRPC(ctx, req)
+	} else {
+		err = s.exportHTTP(ctx, req)
+	}
+
+	if err != nil {
+		selfMetrics.AddCounter(dcgmExporterOTLPExportFailuresTotal,
+			"Number of failed exports to the OTLP endpoint.", nil, 1)
+	}
+
+	return err
+}
+
+func (s *OTLPSink) Close() error {
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+
+	return nil
+}
+
+func (s *OTLPSink) exportGRPC(ctx context.Context, req []byte) error {
+	if len(s.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(s.headers))
+	}
+
+	var resp []byte
+	err := s.conn.Invoke(ctx, otlpExportMethod, &req, &resp, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		return fmt.Errorf("failed to export metrics to '%s'; err: %w", s.endpoint, err)
+	}
+
+	return nil
+}
+
+func (s *OTLPSink) exportHTTP(ctx context.Context, req []byte) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(req))
+	if err != nil {
+		return err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range s.headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to export metrics to '%s'; err: %w", s.endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to export metrics to '%s'; HTTP status %s: %s", s.endpoint, resp.Status,
+			bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// encodeRequest encodes the metrics as an ExportMetricsServiceRequest protobuf message.
+func (s *OTLPSink) encodeRequest(metrics MetricsByCounter, timestamp time.Time) []byte {
+	// Group the metrics by resource, metrics without GPU (e.g. CPU, NvSwitch) belong to the node
+	byResource := map[string]MetricsByCounter{}
+	for counter, counterMetrics := range metrics {
+		for _, metric := range counterMetrics {
+			if byResource[metric.GPUUUID] == nil {
+				byResource[metric.GPUUUID] = MetricsByCounter{}
+			}
+			byResource[metric.GPUUUID][counter] = append(byResource[metric.GPUUUID][counter], metric)
+		}
+	}
+
+	gpuUUIDs := make([]string, 0, len(byResource))
+	for gpuUUID := range byResource {
+		gpuUUIDs = append(gpuUUIDs, gpuUUID)
+	}
+	sort.Strings(gpuUUIDs)
+
+	startTime := uint64(s.startTime.UnixNano())
+	now := uint64(timestamp.UnixNano())
+
+	var req []byte
+
+	for _, gpuUUID := range gpuUUIDs {
+		attributes := make(map[string]string, len(s.attributes)+1)
+		for k, v := range s.attributes {
+			attributes[k] = v
+		}
+		if gpuUUID != "" {
+			attributes[otlpGPUUUIDAttribute] = gpuUUID
+		}
+
+		var resource []byte
+		resource = appendOTLPAttributes(resource, 1, attributes)
+
+		var scope []byte
+		scope = protowire.AppendTag(scope, 1, protowire.BytesType)
+		scope = protowire.AppendString(scope, otlpScopeName)
+
+		var scopeMetrics []byte
+		scopeMetrics = protowire.AppendTag(scopeMetrics, 1, protowire.BytesType)
+		scopeMetrics = protowire.AppendBytes(scopeMetrics, scope)
+
+		counters := byResource[gpuUUID]
+		for _, counter := range sortedCounters(counters) {
+			metric := encodeOTLPMetric(counter, counters[counter], startTime, now)
+			if metric == nil {
+				continue
+			}
+
+			scopeMetrics = protowire.AppendTag(scopeMetrics, 2, protowire.BytesType)
+			scopeMetrics = protowire.AppendBytes(scopeMetrics, metric)
+		}
+
+		var resourceMetrics []byte
+		resourceMetrics = protowire.AppendTag(resourceMetrics, 1, protowire.BytesType)
+		resourceMetrics = protowire.AppendBytes(resourceMetrics, resource)
+		resourceMetrics = protowire.AppendTag(resourceMetrics, 2, protowire.BytesType)
+		resourceMetrics = protowire.AppendBytes(resourceMetrics, scopeMetrics)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, resourceMetrics)
+	}
+
+	return req
+}
+
+// encodeOTLPMetric encodes the metrics of a counter as an OTLP Metric, counters become monotonic
+// cumulative sums and other metrics become gauges.
+func encodeOTLPMetric(counter Counter, metrics []Metric, startTime, now uint64) []byte {
+	var dataPoints []byte
+
+	for _, metric := range metrics {
+		value, err := strconv.ParseFloat(metric.Value, 64)
+		if err != nil {
+			continue
+		}
+
+		var dataPoint []byte
+		if counter.PromType == "counter" {
+			dataPoint = protowire.AppendTag(dataPoint, 2, protowire.Fixed64Type)
+			dataPoint = protowire.AppendFixed64(dataPoint, startTime)
+		}
+		dataPoint = protowire.AppendTag(dataPoint, 3, protowire.Fixed64Type)
+		dataPoint = protowire.AppendFixed64(dataPoint, now)
+		dataPoint = protowire.AppendTag(dataPoint, 4, protowire.Fixed64Type)
+		dataPoint = protowire.AppendFixed64(dataPoint, math.Float64bits(value))
+		dataPoint = appendOTLPAttributes(dataPoint, 7, metricAttributes(metric))
+
+		dataPoints = protowire.AppendTag(dataPoints, 1, protowire.BytesType)
+		dataPoints = protowire.AppendBytes(dataPoints, dataPoint)
+	}
+
+	if dataPoints == nil {
+		return nil
+	}
+
+	var result []byte
+	result = protowire.AppendTag(result, 1, protowire.BytesType)
+	result = protowire.AppendString(result, counter.FieldName)
+	result = protowire.AppendTag(result, 2, protowire.BytesType)
+	result = protowire.AppendString(result, counter.Help)
+
+	if counter.PromType == "counter" {
+		data := dataPoints
+		data = protowire.AppendTag(data, 2, protowire.VarintType)
+		data = protowire.AppendVarint(data, otlpCumulativeTemporality)
+		data = protowire.AppendTag(data, 3, protowire.VarintType)
+		data = protowire.AppendVarint(data, protowire.EncodeBool(true))
+
+		result = protowire.AppendTag(result, 7, protowire.BytesType)
+		result = protowire.AppendBytes(result, data)
+	} else {
+		result = protowire.AppendTag(result, 5, protowire.BytesType)
+		result = protowire.AppendBytes(result, dataPoints)
+	}
+
+	return result
+}
+
+// appendOTLPAttributes appends the attributes as KeyValue messages with string values, sorted by key.
+func appendOTLPAttributes(b []byte, num protowire.Number, attributes map[string]string) []byte {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		var value []byte
+		value = protowire.AppendTag(value, 1, protowire.BytesType)
+		value = protowire.AppendString(value, attributes[k])
+
+		var keyValue []byte
+		keyValue = protowire.AppendTag(keyValue, 1, protowire.BytesType)
+		keyValue = protowire.AppendString(keyValue, k)
+		keyValue = protowire.AppendTag(keyValue, 2, protowire.BytesType)
+		keyValue = protowire.AppendBytes(keyValue, value)
+
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, keyValue)
+	}
+
+	return b
+}
+
+// parseKeyValues parses a list of key=value pairs.
+func parseKeyValues(pairs []string) (map[string]string, error) {
+	result := make(map[string]string, len(pairs))
+
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("'%s' is not a key=value pair", pair)
+		}
+		result[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	return result, nil
+}
+
+// rawCodec sends and receives already encoded protobuf messages, so the OTLP service can be called
+// without generated code.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+
+	return *b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+
+	*b = append((*b)[:0], data...)
+
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protoFields decodes a protobuf message into its raw fields, length-delimited fields are kept encoded.
+func protoFields(t *testing.T, b []byte) map[protowire.Number][][]byte {
+	t.Helper()
+
+	fields := map[protowire.Number][][]byte{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		require.GreaterOrEqual(t, n, 0)
+
+		value := b[:n]
+		if typ == protowire.BytesType {
+			value, _ = protowire.ConsumeBytes(value)
+		}
+		fields[num] = append(fields[num], value)
+		b = b[n:]
+	}
+
+	return fields
+}
+
+func protoAttributes(t *testing.T, keyValues [][]byte) map[string]string {
+	t.Helper()
+
+	attributes := map[string]string{}
+	for _, keyValue := range keyValues {
+		fields := protoFields(t, keyValue)
+		value := protoFields(t, fields[2][0])
+		attributes[string(fields[1][0])] = string(value[1][0])
+	}
+
+	return attributes
+}
+
+func testOTLPMetrics() MetricsByCounter {
+	gauge := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge", Help: "Temperature"}
+	counter := Counter{FieldName: "DCGM_FI_DEV_XID_ERRORS", PromType: "counter", Help: "XID errors"}
+
+	return MetricsByCounter{
+		gauge: {
+			{GPU: "0", GPUUUID: "GPU-0", Value: "42", Attributes: map[string]string{"pod": "p"}},
+			{GPU: "1", GPUUUID: "GPU-1", Value: "43", Attributes: map[string]string{}},
+		},
+		counter: {
+			{GPU: "0", GPUUUID: "GPU-0", Value: "3", Attributes: map[string]string{}},
+			{GPU: "0", GPUUUID: "GPU-0", Value: "not a number", Attributes: map[string]string{}},
+		},
+	}
+}
+
+func TestOTLPSink_EncodeRequest(t *testing.T) {
+	sink, err := NewOTLPSink(&Config{
+		OTLPEndpoint:           "http://localhost:4318/v1/metrics",
+		OTLPProtocol:           OTLPProtocolHTTP,
+		OTLPClusterName:        "cluster",
+		OTLPResourceAttributes: []string{"env=prod"},
+	}, "node")
+	require.NoError(t, err)
+
+	timestamp := time.Unix(100, 0)
+	req := protoFields(t, sink.encodeRequest(testOTLPMetrics(), timestamp))
+
+	resourceMetrics := req[1]
+	require.Len(t, resourceMetrics, 2)
+
+	wantResources := []string{"GPU-0", "GPU-1"}
+	for i, rm := range resourceMetrics {
+		fields := protoFields(t, rm)
+
+		resource := protoFields(t, fields[1][0])
+		assert.Equal(t, map[string]string{
+			"env":              "prod",
+			"gpu.uuid":         wantResources[i],
+			"host.name":        "node",
+			"k8s.cluster.name": "cluster",
+		}, protoAttributes(t, resource[1]))
+
+		scopeMetrics := protoFields(t, fields[2][0])
+		scope := protoFields(t, scopeMetrics[1][0])
+		assert.Equal(t, otlpScopeName, string(scope[1][0]))
+
+		metrics := scopeMetrics[2]
+		if i == 1 {
+			require.Len(t, metrics, 1)
+			continue
+		}
+		require.Len(t, metrics, 2)
+
+		gauge := protoFields(t, metrics[0])
+		assert.Equal(t, "DCGM_FI_DEV_GPU_TEMP", string(gauge[1][0]))
+		require.Contains(t, gauge, protowire.Number(5))
+		dataPoint := protoFields(t, protoFields(t, gauge[5][0])[1][0])
+		value, _ := protowire.ConsumeFixed64(dataPoint[4][0])
+		assert.Equal(t, 42.0, math.Float64frombits(value))
+		ts, _ := protowire.ConsumeFixed64(dataPoint[3][0])
+		assert.Equal(t, uint64(timestamp.UnixNano()), ts)
+		assert.Equal(t, map[string]string{"gpu": "0", "pod": "p"}, protoAttributes(t, dataPoint[7]))
+
+		sum := protoFields(t, metrics[1])
+		assert.Equal(t, "DCGM_FI_DEV_XID_ERRORS", string(sum[1][0]))
+		require.Contains(t, sum, protowire.Number(7))
+		sumFields := protoFields(t, sum[7][0])
+		assert.Len(t, sumFields[1], 1, "non-numeric values are skipped")
+		temporality, _ := protowire.ConsumeVarint(sumFields[2][0])
+		assert.Equal(t, uint64(otlpCumulativeTemporality), temporality)
+		monotonic, _ := protowire.ConsumeVarint(sumFields[3][0])
+		assert.Equal(t, uint64(1), monotonic)
+	}
+}
+
+func TestOTLPSink_WriteHTTP(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+
+		var err error
+		body, err = io.ReadAll(r.Body)
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+
+	sink, err := NewOTLPSink(&Config{
+		OTLPEndpoint: server.URL,
+		OTLPProtocol: OTLPProtocolHTTP,
+		OTLPHeaders:  []string{"X-Api-Key=secret"},
+	}, "node")
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Write(context.Background(), testOTLPMetrics(), time.Now()))
+	assert.Len(t, protoFields(t, body)[1], 2)
+}
+
+func TestOTLPSink_WriteGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var method string
+	var body []byte
+	server := grpc.NewServer(grpc.ForceServerCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			method, _ = grpc.MethodFromServerStream(stream)
+			if err := stream.RecvMsg(&body); err != nil {
+				return err
+			}
+			resp := []byte{}
+			return stream.SendMsg(&resp)
+		}))
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	sink, err := NewOTLPSink(&Config{
+		OTLPEndpoint: lis.Addr().String(),
+		OTLPInsecure: true,
+	}, "node")
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Write(context.Background(), testOTLPMetrics(), time.Now()))
+	assert.Equal(t, otlpExportMethod, method)
+	assert.Len(t, protoFields(t, body)[1], 2)
+}
+
+func TestNewOTLPSink_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *Config
+	}{
+		{
+			name:   "invalid protocol",
+			config: &Config{OTLPEndpoint: "localhost:4317", OTLPProtocol: "udp"},
+		},
+		{
+			name:   "http endpoint without scheme",
+			config: &Config{OTLPEndpoint: "localhost:4318", OTLPProtocol: OTLPProtocolHTTP},
+		},
+		{
+			name:   "invalid header",
+			config: &Config{OTLPEndpoint: "localhost:4317", OTLPHeaders: []string{"novalue"}},
+		},
+		{
+			name:   "invalid resource attribute",
+			config: &Config{OTLPEndpoint: "localhost:4317", OTLPResourceAttributes: []string{"=value"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewOTLPSink(tt.config, "node")
+			assert.Error(t, err)
+		})
+	}
+}
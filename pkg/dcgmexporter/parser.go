@@ -19,8 +19,10 @@ package dcgmexporter
 import (
 	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
 	"github.com/sirupsen/logrus"
@@ -44,7 +46,15 @@ func GetCounterSet(c *Config) (*CounterSet, error) {
 
 	res := new(CounterSet)
 
-	if c.ConfigMapData != undefinedConfigMapData {
+	source := "configmap " + c.ConfigMapData
+	if c.CountersData != "" {
+		logrus.Info("Using the counters of the Kubernetes configuration")
+		source = "kubernetes configuration"
+		records, err = parseCounterRecords(c.CountersData)
+		if err != nil {
+			return res, err
+		}
+	} else if c.ConfigMapData != undefinedConfigMapData {
 		var client kubernetes.Interface
 		client, err = getKubeClient()
 		if err != nil {
@@ -58,14 +68,39 @@ func GetCounterSet(c *Config) (*CounterSet, error) {
 		err = fmt.Errorf("no configmap data specified")
 	}
 
-	if err != nil || c.ConfigMapData == undefinedConfigMapData {
+	var overrides []CounterOverride
+	if err != nil && c.CounterProfile != "" {
+		logrus.Infof("Using the counter profile '%s'", c.CounterProfile)
+
+		records, err = readCounterProfile(c.CounterProfile)
+		if err != nil {
+			return res, err
+		}
+		records, overrides, err = mergeCounterRecords(records, "profile "+c.CounterProfile, collectorsFiles(c))
+		if err != nil {
+			return res, err
+		}
+	} else if err != nil {
 		logrus.Infof("Falling back to metric file '%s'", c.CollectorsFile)
 
-		records, err = ReadCSVFile(c.CollectorsFile)
+		records, overrides, err = ReadCounterFiles(collectorsFiles(c))
 		if err != nil {
 			logrus.Errorf("Could not read metrics file '%s'; err: %v", c.CollectorsFile, err)
 			return res, err
 		}
+	} else if len(c.CollectorsOverlays) > 0 {
+		records, overrides, err = mergeCounterRecords(records, source, c.CollectorsOverlays)
+		if err != nil {
+			return res, err
+		}
+	}
+
+	for _, override := range overrides {
+		if override.Conflict {
+			logrus.Infof("Counter overridden: %s", override)
+		} else {
+			logrus.Debugf("Counter redefined: %s", override)
+		}
 	}
 
 	res, err = extractCounters(records, c)
@@ -76,6 +111,14 @@ func GetCounterSet(c *Config) (*CounterSet, error) {
 	return res, err
 }
 
+// collectorsFiles returns the counters files of the configuration, in order.
+func collectorsFiles(c *Config) []string {
+	if c.CollectorsFile == "" {
+		return c.CollectorsOverlays
+	}
+	return append([]string{c.CollectorsFile}, c.CollectorsOverlays...)
+}
+
 func ReadCSVFile(filename string) ([][]string, error) {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -86,6 +129,7 @@ func ReadCSVFile(filename string) ([][]string, error) {
 
 	r := csv.NewReader(file)
 	r.Comment = '#'
+	r.FieldsPerRecord = -1
 	records, err := r.ReadAll()
 
 	return records, err
@@ -104,12 +148,47 @@ func extractCounters(records [][]string, c *Config) (*CounterSet, error) {
 			record[j] = strings.Trim(r, " ")
 		}
 
-		if len(record) != 3 {
+		if len(record) < 3 || len(record) > 6 {
 			return nil, fmt.Errorf("malformed CSV record; err: failed to parse line %d (`%v`), "+
-				"expected 3 fields", i,
+				"expected 3 to 6 fields", i,
 				record)
 		}
 
+		var collectInterval time.Duration
+		if len(record) >= 4 {
+			var err error
+			collectInterval, err = parseCollectInterval(record[3])
+			if err != nil {
+				return nil, fmt.Errorf("invalid collect interval of '%s'; err: %w", record[0], err)
+			}
+		}
+
+		var aggregation string
+		var buckets []float64
+		if record[1] == histogramPromType {
+			// The fifth column of the histograms holds their buckets
+			var err error
+			buckets, err = parseHistogramBuckets(column(record, 4))
+			if err != nil {
+				return nil, fmt.Errorf("invalid histogram buckets of '%s'; err: %w", record[0], err)
+			}
+		} else if len(record) >= 5 {
+			var err error
+			aggregation, err = parseAggregation(record[4], record[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid aggregation of '%s'; err: %w", record[0], err)
+			}
+		}
+
+		var groups []string
+		if len(record) == 6 {
+			var err error
+			groups, err = parseCounterGroups(record[5])
+			if err != nil {
+				return nil, fmt.Errorf("invalid groups of '%s'; err: %w", record[0], err)
+			}
+		}
+
 		fieldID, ok := dcgm.DCGM_FI[record[0]]
 		oldFieldID, oldOk := dcgm.OLD_DCGM_FI[record[0]]
 		if !ok && !oldOk {
@@ -119,6 +198,7 @@ func extractCounters(records [][]string, c *Config) (*CounterSet, error) {
 				return nil, fmt.Errorf("could not find DCGM field; err: %w", err)
 			} else if expField != DCGMFIUnknown {
 				res.ExporterCounters = append(res.ExporterCounters, Counter{dcgm.Short(expField), record[0], record[1], record[2]})
+				res.addToGroups(record[0], groups)
 				continue
 			}
 		}
@@ -137,7 +217,15 @@ func extractCounters(records [][]string, c *Config) (*CounterSet, error) {
 				return nil, fmt.Errorf("could not find Prometheus metric type '%s'", record[1])
 			}
 
+			if record[1] == bitmaskPromType && !isBitmaskSupported(fieldID) {
+				return nil, fmt.Errorf("field '%s' cannot be decoded as a bitmask", record[0])
+			}
+
 			res.DCGMCounters = append(res.DCGMCounters, Counter{fieldID, record[0], record[1], record[2]})
+			res.setCollectInterval(fieldID, collectInterval)
+			res.setAggregation(fieldID, aggregation)
+			res.setHistogram(fieldID, buckets)
+			res.addToGroups(record[0], groups)
 		} else {
 			if !fieldIsSupported(uint(oldFieldID), c) {
 				logrus.Warnf("Skipping line %d ('%s'): metric not enabled", i, record[0])
@@ -148,13 +236,50 @@ func extractCounters(records [][]string, c *Config) (*CounterSet, error) {
 				return nil, fmt.Errorf("could not find Prometheus metric type '%s'", record[1])
 			}
 
+			if record[1] == bitmaskPromType && !isBitmaskSupported(oldFieldID) {
+				return nil, fmt.Errorf("field '%s' cannot be decoded as a bitmask", record[0])
+			}
+
 			res.DCGMCounters = append(res.DCGMCounters, Counter{oldFieldID, record[0], record[1], record[2]})
+			res.setCollectInterval(oldFieldID, collectInterval)
+			res.setAggregation(oldFieldID, aggregation)
+			res.setHistogram(oldFieldID, buckets)
+			res.addToGroups(record[0], groups)
 		}
 	}
 
 	return &res, nil
 }
 
+func (cs *CounterSet) setCollectInterval(fieldID dcgm.Short, interval time.Duration) {
+	if interval == 0 {
+		return
+	}
+
+	if cs.CollectIntervals == nil {
+		cs.CollectIntervals = map[dcgm.Short]time.Duration{}
+	}
+	cs.CollectIntervals[fieldID] = interval
+}
+
+// parseCollectInterval parses the optional fourth column of a counter, e.g. 30s; the collect interval is used when
+// it is empty.
+func parseCollectInterval(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if interval < time.Millisecond {
+		return 0, fmt.Errorf("interval %s is shorter than 1ms", value)
+	}
+
+	return interval, nil
+}
+
 func fieldIsSupported(fieldID uint, c *Config) bool {
 	if fieldID < dcpFieldsStart || fieldID >= cpuFieldsStart {
 		return true
@@ -191,15 +316,29 @@ func readConfigMap(kubeClient kubernetes.Interface, c *Config) ([][]string, erro
 		return nil, fmt.Errorf("malformed ConfigMap '%s'; no 'metrics' key", c.ConfigMapData)
 	}
 
-	r := csv.NewReader(strings.NewReader(cm.Data["metrics"]))
+	records, err := parseCounterRecords(cm.Data["metrics"])
+	if err != nil {
+		return nil, fmt.Errorf("malformed configmap contents; err: %w", err)
+	}
+
+	return records, nil
+}
+
+// parseCounterRecords returns the records of the counters in the CSV format of the collectors file.
+func parseCounterRecords(data string) ([][]string, error) {
+	r := csv.NewReader(strings.NewReader(data))
 	r.Comment = '#'
+	r.FieldsPerRecord = -1
 	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
 
 	if len(records) == 0 {
-		return nil, fmt.Errorf("malformed configmap contents; err: no metrics found")
+		return nil, errors.New("no metrics found")
 	}
 
-	return records, err
+	return records, nil
 }
 
 func getKubeClient() (kubernetes.Interface, error) {
@@ -2,8 +2,11 @@ package dcgmexporter
 
 import (
 	"testing"
+	"time"
 
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
@@ -109,6 +112,16 @@ func TestExtractCounters(t *testing.T) {
 			field: "DCGM_FI_DEV_GPU_TEMP, gauge, temperature\n",
 			valid: true,
 		},
+		{
+			name:  "Valid Input DCGM_FI_DEV_CLOCK_THROTTLE_REASONS bitmask",
+			field: "DCGM_FI_DEV_CLOCK_THROTTLE_REASONS, bitmask, clock throttle reasons\n",
+			valid: true,
+		},
+		{
+			name:  "Invalid Input DCGM_FI_DEV_GPU_TEMP bitmask",
+			field: "DCGM_FI_DEV_GPU_TEMP, bitmask, temperature\n",
+			valid: false,
+		},
 		{
 			name:  "Invalid Input DCGM_EXP_XID_ERRORS_COUNTXXX",
 			field: "DCGM_EXP_XID_ERRORS_COUNTXXX, gauge, temperature\n",
@@ -123,6 +136,22 @@ func TestExtractCounters(t *testing.T) {
 	}
 }
 
+func TestExtractCountersCollectInterval(t *testing.T) {
+	cs, err := extractCounters([][]string{
+		{"DCGM_FI_DEV_GPU_TEMP", " gauge", " temperature", " 1s"},
+		{"DCGM_FI_DEV_POWER_USAGE", " gauge", " power"},
+		{"DCGM_FI_DEV_FB_FREE", " gauge", " free memory", " "},
+	}, &Config{})
+	require.NoError(t, err)
+	assert.Len(t, cs.DCGMCounters, 3)
+	assert.Equal(t, map[dcgm.Short]time.Duration{dcgm.DCGM_FI_DEV_GPU_TEMP: time.Second}, cs.CollectIntervals)
+
+	for _, interval := range []string{"often", "0s", "-1s"} {
+		_, err = extractCounters([][]string{{"DCGM_FI_DEV_GPU_TEMP", "gauge", "temperature", interval}}, &Config{})
+		assert.Error(t, err, interval)
+	}
+}
+
 func extractCountersHelper(t *testing.T, input string, valid bool) {
 	tmpFile, err := os.CreateTemp(os.TempDir(), "prefix-")
 	if err != nil {
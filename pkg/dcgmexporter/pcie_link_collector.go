@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+const (
+	pcieLinkGenLabel      = "pcie_link_gen"
+	pcieMaxLinkGenLabel   = "pcie_max_link_gen"
+	pcieLinkWidthLabel    = "pcie_link_width"
+	pcieMaxLinkWidthLabel = "pcie_max_link_width"
+)
+
+var nvmlGetPCIeLinkInfoHook = nvmlprovider.GetPCIeLinkInfo
+
+// pcieLinkDegraded returns 1 when the PCIe link of the GPU trained below its maximum generation or width, e.g. after
+// the GPU was reseated and its link came up at x8 or gen3.
+func pcieLinkDegraded(info *nvmlprovider.PCIeLinkInfo) int {
+	if info.Gen < info.MaxGen || info.Width < info.MaxWidth {
+		return 1
+	}
+	return 0
+}
+
+// pcieLinkCollector exports whether the PCIe link of the GPUs is degraded, with the current and the maximum
+// generation and width of the link as labels.
+type pcieLinkCollector struct {
+	expCollector
+}
+
+// IsDCGMExpPCIeLinkDegradedEnabled checks if the DCGM_EXP_PCIE_LINK_DEGRADED counter exists
+func IsDCGMExpPCIeLinkDegradedEnabled(counters []Counter) bool {
+	return slices.ContainsFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpPCIeLinkDegraded
+	})
+}
+
+func NewPCIeLinkCollector(counters []Counter,
+	hostname string,
+	config *Config,
+	fieldEntityGroupTypeSystemInfo FieldEntityGroupTypeSystemInfoItem) (Collector, error) {
+	if !IsDCGMExpPCIeLinkDegradedEnabled(counters) {
+		logrus.Error(dcgmExpPCIeLinkDegraded + " collector is disabled")
+		return nil, fmt.Errorf(dcgmExpPCIeLinkDegraded + " collector is disabled")
+	}
+
+	transformations, err := getTransformations(config)
+	if err != nil {
+		return nil, err
+	}
+
+	collector := pcieLinkCollector{
+		expCollector: expCollector{
+			sysInfo:         fieldEntityGroupTypeSystemInfo.SystemInfo,
+			hostname:        hostname,
+			config:          config,
+			transformations: transformations,
+		},
+	}
+
+	collector.counter = counters[slices.IndexFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpPCIeLinkDegraded
+	})]
+
+	return &collector, nil
+}
+
+func (c *pcieLinkCollector) GetMetrics() (MetricsByCounter, error) {
+	uuid := "UUID"
+	if c.config.UseOldNamespace {
+		uuid = "uuid"
+	}
+
+	metrics := make(MetricsByCounter)
+	checked := map[uint]bool{}
+
+	for _, mi := range GetMonitoredEntities(c.sysInfo) {
+		if checked[mi.DeviceInfo.GPU] {
+			continue
+		}
+		checked[mi.DeviceInfo.GPU] = true
+
+		// The link is the one of the GPU, the MIG instances share it
+		mi.InstanceInfo = nil
+
+		info, err := nvmlGetPCIeLinkInfoHook(mi.DeviceInfo.UUID)
+		if err != nil {
+			logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(),
+				"Unable to get the PCIe link of GPU %d", mi.DeviceInfo.GPU)
+			continue
+		}
+
+		labels := map[string]string{
+			pcieLinkGenLabel:      strconv.Itoa(info.Gen),
+			pcieMaxLinkGenLabel:   strconv.Itoa(info.MaxGen),
+			pcieLinkWidthLabel:    strconv.Itoa(info.Width),
+			pcieMaxLinkWidthLabel: strconv.Itoa(info.MaxWidth),
+		}
+
+		m := c.createMetric(labels, mi, uuid, pcieLinkDegraded(info))
+		metrics[c.counter] = append(metrics[c.counter], m)
+	}
+
+	for _, transform := range c.transformations {
+		err := transform.Process(metrics, c.sysInfo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform metrics for transform '%s'; err: %v", transform.Name(), err)
+		}
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+func TestPCIeLinkCollector_GetMetrics(t *testing.T) {
+	counter := Counter{FieldName: dcgmExpPCIeLinkDegraded, PromType: "gauge"}
+
+	sysInfo := SystemInfo{
+		GPUCount: 4,
+		gOpt:     DeviceOptions{Flex: true},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i, UUID: fmt.Sprintf("GPU-%d", i)}
+	}
+
+	links := map[string]*nvmlprovider.PCIeLinkInfo{
+		"GPU-0": {Gen: 4, MaxGen: 4, Width: 16, MaxWidth: 16},
+		"GPU-1": {Gen: 4, MaxGen: 4, Width: 8, MaxWidth: 16},
+		"GPU-2": {Gen: 3, MaxGen: 4, Width: 16, MaxWidth: 16},
+	}
+
+	defer func() {
+		nvmlGetPCIeLinkInfoHook = nvmlprovider.GetPCIeLinkInfo
+	}()
+	nvmlGetPCIeLinkInfoHook = func(uuid string) (*nvmlprovider.PCIeLinkInfo, error) {
+		info, exists := links[uuid]
+		if !exists {
+			return nil, fmt.Errorf("GPU %s is lost", uuid)
+		}
+		return info, nil
+	}
+
+	collector, err := NewPCIeLinkCollector([]Counter{counter}, "node", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{SystemInfo: sysInfo})
+	require.NoError(t, err)
+	defer collector.Cleanup()
+
+	metrics, err := collector.GetMetrics()
+	require.NoError(t, err)
+	require.Len(t, metrics[counter], 3)
+
+	values := map[string]string{}
+	for _, metric := range metrics[counter] {
+		values[metric.GPUUUID] = metric.Value
+		assert.Equal(t, "node", metric.Hostname)
+	}
+	assert.Equal(t, "0", values["GPU-0"])
+	assert.Equal(t, "1", values["GPU-1"])
+	assert.Equal(t, "1", values["GPU-2"])
+
+	assert.Equal(t, map[string]string{
+		pcieLinkGenLabel:      "4",
+		pcieMaxLinkGenLabel:   "4",
+		pcieLinkWidthLabel:    "8",
+		pcieMaxLinkWidthLabel: "16",
+	}, metrics[counter][1].Labels)
+}
+
+func TestNewPCIeLinkCollector_Disabled(t *testing.T) {
+	_, err := NewPCIeLinkCollector([]Counter{{FieldName: "DCGM_FI_DEV_GPU_TEMP"}}, "node", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{})
+	assert.Error(t, err)
+}
@@ -18,7 +18,9 @@ package dcgmexporter
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"sync"
 	"text/template"
 	"time"
@@ -91,16 +93,34 @@ func NewMetricsPipeline(config *Config,
 		cleanups = append(cleanups, cleanup)
 	}
 
-	transformations := getTransformations(config)
+	transformations, err := getTransformations(config)
+	if err != nil {
+		return nil, func() {
+			for _, cleanup := range cleanups {
+				cleanup()
+			}
+		}, err
+	}
+	cleanups = append(cleanups, func() { closeTransformations(transformations) })
+
+	sinks, err := getSinks(config, hostname)
+	if err != nil {
+		return nil, func() {
+			for _, cleanup := range cleanups {
+				cleanup()
+			}
+		}, err
+	}
 
 	return &MetricsPipeline{
 			config: config,
 
-			migMetricsFormat:     template.Must(template.New("migMetrics").Parse(migMetricsFormat)),
-			switchMetricsFormat:  template.Must(template.New("switchMetrics").Parse(switchMetricsFormat)),
-			linkMetricsFormat:    template.Must(template.New("switchMetrics").Parse(linkMetricsFormat)),
-			cpuMetricsFormat:     template.Must(template.New("cpuMetrics").Parse(cpuMetricsFormat)),
-			cpuCoreMetricsFormat: template.Must(template.New("cpuMetrics").Parse(cpuCoreMetricsFormat)),
+			migMetricsFormat:     newMetricsTemplate("migMetrics", migMetricsFormat),
+			switchMetricsFormat:  newMetricsTemplate("switchMetrics", switchMetricsFormat),
+			linkMetricsFormat:    newMetricsTemplate("switchMetrics", linkMetricsFormat),
+			cpuMetricsFormat:     newMetricsTemplate("cpuMetrics", cpuMetricsFormat),
+			cpuCoreMetricsFormat: newMetricsTemplate("cpuMetrics", cpuCoreMetricsFormat),
+			podMetricsFormat:     newMetricsTemplate("podMetrics", podMetricsFormat),
 
 			counters:        counters,
 			gpuCollector:    gpuCollector,
@@ -109,6 +129,7 @@ func NewMetricsPipeline(config *Config,
 			transformations: transformations,
 			cpuCollector:    cpuCollector,
 			coreCollector:   coreCollector,
+			sinks:           newSinkWriters(sinks),
 		}, func() {
 			for _, cleanup := range cleanups {
 				cleanup()
@@ -116,15 +137,70 @@ func NewMetricsPipeline(config *Config,
 		}, nil
 }
 
-func getTransformations(c *Config) []Transform {
+// closeTransformations releases the resources held by the transformations, e.g. the connection of the pod mapper to
+// the kubelet.
+func closeTransformations(transformations []Transform) {
+	for _, transform := range transformations {
+		if closer, ok := transform.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				logrus.WithError(err).Warnf("Unable to close transformation '%s'", transform.Name())
+			}
+		}
+	}
+}
+
+func getTransformations(c *Config) ([]Transform, error) {
 	transformations := []Transform{}
+
+	// The transformations already created are closed when a later one fails
+	built := false
+	defer func() {
+		if !built {
+			closeTransformations(transformations)
+		}
+	}()
+
+	// The derived metrics come first, so that the mappings apply to them
+	if c.DerivedMetrics != "" {
+		derived, err := NewDerivedMetrics(c)
+		if err != nil {
+			return nil, err
+		}
+		transformations = append(transformations, derived)
+	}
+
+	if c.EnergyAveragePower {
+		averagePower, err := newAveragePower()
+		if err != nil {
+			return nil, err
+		}
+		transformations = append(transformations, averagePower)
+	}
+
+	// The health score comes after the derived metrics, so that the rules can use them
+	if c.HealthScoreRules != "" {
+		healthScore, err := NewHealthScore(c)
+		if err != nil {
+			return nil, err
+		}
+		transformations = append(transformations, healthScore)
+	}
+
+	// The MIG rollups come before the mappings, so that they are attributed like the metrics of the whole GPUs
+	if c.MIGRollup {
+		transformations = append(transformations, newMIGRollup())
+	}
+
 	if c.Kubernetes {
 		podMapper, err := NewPodMapper(c)
 		if err != nil {
-			logrus.Warnf("Could not enable kubernetes metric collection: %v", err)
-		} else {
-			transformations = append(transformations, podMapper)
+			return nil, fmt.Errorf("could not enable kubernetes metric collection; err: %w", err)
 		}
+		transformations = append(transformations, podMapper)
+	}
+
+	if c.ContainerMapping {
+		transformations = append(transformations, newContainerMapper(c))
 	}
 
 	if c.HPCJobMappingDir != "" {
@@ -132,7 +208,67 @@ func getTransformations(c *Config) []Transform {
 		transformations = append(transformations, hpcMapper)
 	}
 
-	return transformations
+	if c.SlurmJobMapping {
+		slurmMapper, err := newSlurmMapper(c)
+		if err != nil {
+			return nil, err
+		}
+		transformations = append(transformations, slurmMapper)
+	}
+
+	if c.JobMapDir != "" {
+		transformations = append(transformations, newJobMapper(c))
+	}
+
+	if c.GPUTopologyLabels {
+		transformations = append(transformations, newGPUTopologyMapper())
+	}
+
+	// The external transforms come after the built-in mappings, so that they can use the pod and job attributes
+	for _, path := range c.TransformPlugins {
+		transform, err := loadTransformPlugin(path, c)
+		if err != nil {
+			return nil, err
+		}
+		transformations = append(transformations, transform)
+	}
+
+	for _, path := range c.TransformHooks {
+		hook, err := newTransformHook(path)
+		if err != nil {
+			return nil, err
+		}
+		transformations = append(transformations, hook)
+	}
+
+	if len(c.LabelAllowlist) > 0 {
+		allowlist, err := newLabelAllowlist(c)
+		if err != nil {
+			return nil, err
+		}
+		transformations = append(transformations, allowlist)
+	}
+
+	// Relabeling comes last, so that the rules can match the pod and job attributes
+	if c.RelabelConfig != "" {
+		relabeler, err := NewMetricRelabeler(c)
+		if err != nil {
+			return nil, err
+		}
+		transformations = append(transformations, relabeler)
+	}
+
+	// The external labels come after relabeling, like the external labels of Prometheus
+	labels, err := newExternalLabels(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(labels.labels) > 0 {
+		transformations = append(transformations, labels)
+	}
+
+	built = true
+	return transformations, nil
 }
 
 // Primarely for testing, caller expected to cleanup the collector
@@ -140,17 +276,29 @@ func NewMetricsPipelineWithGPUCollector(c *Config, collector *DCGMCollector) (*M
 	return &MetricsPipeline{
 		config: c,
 
-		migMetricsFormat:     template.Must(template.New("migMetrics").Parse(migMetricsFormat)),
-		switchMetricsFormat:  template.Must(template.New("switchMetrics").Parse(switchMetricsFormat)),
-		linkMetricsFormat:    template.Must(template.New("switchMetrics").Parse(linkMetricsFormat)),
-		cpuMetricsFormat:     template.Must(template.New("cpuMetrics").Parse(cpuMetricsFormat)),
-		cpuCoreMetricsFormat: template.Must(template.New("cpuMetrics").Parse(cpuCoreMetricsFormat)),
+		migMetricsFormat:     newMetricsTemplate("migMetrics", migMetricsFormat),
+		switchMetricsFormat:  newMetricsTemplate("switchMetrics", switchMetricsFormat),
+		linkMetricsFormat:    newMetricsTemplate("switchMetrics", linkMetricsFormat),
+		cpuMetricsFormat:     newMetricsTemplate("cpuMetrics", cpuMetricsFormat),
+		cpuCoreMetricsFormat: newMetricsTemplate("cpuMetrics", cpuCoreMetricsFormat),
+		podMetricsFormat:     newMetricsTemplate("podMetrics", podMetricsFormat),
 
 		counters:     collector.Counters,
 		gpuCollector: collector,
 	}, func() {}, nil
 }
 
+// AddSink adds a sink receiving the metrics of every collection, it must be called before Run.
+func (m *MetricsPipeline) AddSink(sink MetricsSink) {
+	m.sinks = append(m.sinks, newSinkWriters([]MetricsSink{sink})...)
+}
+
+// GatherRegistry gathers the exporter metrics of the registry in every collection, so that they are served from the
+// last collection and pushed to the sinks like the DCGM metrics, instead of being gathered on every scrape.
+func (m *MetricsPipeline) GatherRegistry(registry *Registry) {
+	m.registry = registry
+}
+
 func (m *MetricsPipeline) Run(out chan string, stop chan interface{}, wg *sync.WaitGroup) {
 	defer wg.Done()
 
@@ -159,9 +307,14 @@ func (m *MetricsPipeline) Run(out chan string, stop chan interface{}, wg *sync.W
 	// Note we are using a ticker so that we can stick as close as possible to the collect interval.
 	// e.g: The CollectInterval is 10s and the transformation pipeline takes 5s, the time will
 	// ensure we really collect metrics every 10s by firing an event 5s after the run function completes.
-	t := time.NewTicker(time.Millisecond * time.Duration(m.config.CollectInterval))
+	t := time.NewTicker(collectTickInterval(m.config))
 	defer t.Stop()
 
+	for _, sink := range m.sinks {
+		wg.Add(1)
+		go sink.run(stop, wg)
+	}
+
 	for {
 		select {
 		case <-stop:
@@ -169,12 +322,16 @@ func (m *MetricsPipeline) Run(out chan string, stop chan interface{}, wg *sync.W
 		case <-t.C:
 			o, err := m.run()
 			if err != nil {
-				logrus.Errorf("Failed to collect metrics; err: %v", err)
+				logSampled(nil, logrus.ErrorLevel, err.Error(), "Failed to collect metrics; err: %v", err)
 				/* flush output rather than output stale data */
 				out <- ""
 				continue
 			}
 
+			if m.startup != nil {
+				m.startup.collected(m.podsMapped())
+			}
+
 			if len(out) == cap(out) {
 				logrus.Errorf("Channel is full skipping.")
 			} else {
@@ -184,20 +341,91 @@ func (m *MetricsPipeline) Run(out chan string, stop chan interface{}, wg *sync.W
 	}
 }
 
+// SetStartup gates the readiness of the exporter on the collections of the pipeline, it must be called before Run.
+func (m *MetricsPipeline) SetStartup(startup *Startup) {
+	m.startup = startup
+}
+
+// SetFabricLeader publishes the metrics of the switches and the links only while the exporter is the leader of the
+// NVSwitch domain, it must be called before Run.
+func (m *MetricsPipeline) SetFabricLeader(leader *FabricLeader) {
+	m.fabricLeader = leader
+}
+
+// publishesFabric returns whether the metrics of the switches and the links are published by the exporter.
+func (m *MetricsPipeline) publishesFabric() bool {
+	return m.fabricLeader == nil || m.fabricLeader.Leading()
+}
+
+// podsMapped returns whether the pod mapper, if any, mapped the pods to the devices.
+func (m *MetricsPipeline) podsMapped() bool {
+	for _, transform := range m.transformations {
+		if podMapper, ok := transform.(*PodMapper); ok {
+			return podMapper.mapped.Load()
+		}
+	}
+	return true
+}
+
+// podAttributeNames returns the names of the attributes the pod mapper describes the pods with.
+func (m *MetricsPipeline) podAttributeNames() podAttributeNames {
+	for _, transform := range m.transformations {
+		if podMapper, ok := transform.(*PodMapper); ok {
+			return podMapper.attributeNames
+		}
+	}
+	return podAttributeNames{useOldNamespace: m.config.UseOldNamespace}
+}
+
+// addExternalLabels adds the external labels, if any, to the attributes of the metrics, or to their labels for the
+// formats without attributes.
+func (m *MetricsPipeline) addExternalLabels(metrics MetricsByCounter, asLabels bool) {
+	for _, transform := range m.transformations {
+		if labels, ok := transform.(*externalLabels); ok {
+			if asLabels {
+				labels.addLabels(metrics)
+			} else {
+				_ = labels.Process(metrics, SystemInfo{})
+			}
+			return
+		}
+	}
+}
+
+// collectTickInterval returns the interval of the collections, the shortest of the collect interval and the
+// intervals of the counters, so that the fields updated more often are exported as soon as they change.
+func collectTickInterval(c *Config) time.Duration {
+	interval := time.Duration(c.CollectInterval) * time.Millisecond
+	for _, fieldInterval := range c.FieldCollectIntervals {
+		if fieldInterval < interval {
+			interval = fieldInterval
+		}
+	}
+
+	return interval
+}
+
 func (m *MetricsPipeline) run() (string, error) {
 	var metrics map[Counter][]Metric
 	var err error
 	var formatted string
 
+	// collected holds the metrics of all the entities for the sinks
+	collected := MetricsByCounter{}
+
 	if m.gpuCollector != nil {
 		/* Collect GPU Metrics */
+		start := time.Now()
 		metrics, err = m.gpuCollector.GetMetrics()
+		m.recordTiming("gpu", start)
 		if err != nil {
 			return "", fmt.Errorf("failed to collect gpu metrics; err: %w", err)
 		}
 
 		for _, transform := range m.transformations {
+			start := time.Now()
 			err := transform.Process(metrics, m.gpuCollector.SysInfo)
+			m.recordTiming(transform.Name(), start)
 			if err != nil {
 				return "", fmt.Errorf("failed to transform metrics for transform '%s'; err: %w", transform.Name(), err)
 			}
@@ -207,14 +435,35 @@ func (m *MetricsPipeline) run() (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("failed to format metrics; err: %w", err)
 		}
+
+		if m.config.Kubernetes && m.config.KubernetesPodAggregation {
+			/* Roll up the GPU metrics per pod */
+			podMetrics := aggregatePodMetrics(metrics, m.podAttributeNames())
+			m.addExternalLabels(podMetrics, false)
+			if len(podMetrics) > 0 {
+				podFormatted, err := FormatMetrics(m.podMetricsFormat, podMetrics)
+				if err != nil {
+					logrus.Warnf("Failed to format pod metrics with error: %v", err)
+				}
+
+				formatted = formatted + podFormatted
+			}
+
+			mergeMetrics(collected, podMetrics)
+		}
+
+		mergeMetrics(collected, metrics)
 	}
 
-	if m.switchCollector != nil {
+	if m.switchCollector != nil && m.publishesFabric() {
 		/* Collect Switch Metrics */
+		start := time.Now()
 		metrics, err = m.switchCollector.GetMetrics()
+		m.recordTiming("switch", start)
 		if err != nil {
 			return "", fmt.Errorf("failed to collect switch metrics; err: %w", err)
 		}
+		m.addExternalLabels(metrics, true)
 
 		if len(metrics) > 0 {
 			switchFormatted, err := FormatMetrics(m.switchMetricsFormat, metrics)
@@ -223,15 +472,20 @@ func (m *MetricsPipeline) run() (string, error) {
 			}
 
 			formatted = formatted + switchFormatted
+
+			mergeMetrics(collected, metrics)
 		}
 	}
 
-	if m.linkCollector != nil {
+	if m.linkCollector != nil && m.publishesFabric() {
 		/* Collect Link Metrics */
+		start := time.Now()
 		metrics, err = m.linkCollector.GetMetrics()
+		m.recordTiming("link", start)
 		if err != nil {
 			return "", fmt.Errorf("failed to collect link metrics; err: %w", err)
 		}
+		m.addExternalLabels(metrics, true)
 
 		if len(metrics) > 0 {
 			switchFormatted, err := FormatMetrics(m.linkMetricsFormat, metrics)
@@ -240,15 +494,20 @@ func (m *MetricsPipeline) run() (string, error) {
 			}
 
 			formatted = formatted + switchFormatted
+
+			mergeMetrics(collected, metrics)
 		}
 	}
 
 	if m.cpuCollector != nil {
 		/* Collect CPU Metrics */
+		start := time.Now()
 		metrics, err = m.cpuCollector.GetMetrics()
+		m.recordTiming("cpu", start)
 		if err != nil {
 			return "", fmt.Errorf("failed to collect CPU metrics; err: %w", err)
 		}
+		m.addExternalLabels(metrics, true)
 
 		if len(metrics) > 0 {
 			cpuFormatted, err := FormatMetrics(m.cpuMetricsFormat, metrics)
@@ -257,15 +516,20 @@ func (m *MetricsPipeline) run() (string, error) {
 			}
 
 			formatted = formatted + cpuFormatted
+
+			mergeMetrics(collected, metrics)
 		}
 	}
 
 	if m.coreCollector != nil {
 		/* Collect cpu core Metrics */
+		start := time.Now()
 		metrics, err = m.coreCollector.GetMetrics()
+		m.recordTiming("cpu_core", start)
 		if err != nil {
 			return "", fmt.Errorf("failed to collect CPU core metrics; err: %w", err)
 		}
+		m.addExternalLabels(metrics, true)
 
 		if len(metrics) > 0 {
 			coreFormatted, err := FormatMetrics(m.cpuCoreMetricsFormat, metrics)
@@ -274,6 +538,31 @@ func (m *MetricsPipeline) run() (string, error) {
 			}
 
 			formatted = formatted + coreFormatted
+
+			mergeMetrics(collected, metrics)
+		}
+	}
+
+	if m.registry != nil {
+		/* Gather the exporter metrics, they are left out when they cannot be gathered */
+		ctx, cancel := context.WithTimeout(context.Background(), collectTickInterval(m.config))
+		start := time.Now()
+		registryMetrics, registryFormatted, _, err := gatherExpMetrics(ctx, m.registry)
+		m.recordTiming("exporter", start)
+		cancel()
+		if err != nil {
+			logSampled(nil, logrus.WarnLevel, err.Error(), "Failed to gather the exporter metrics; err: %v", err)
+		} else {
+			formatted = formatted + registryFormatted
+
+			mergeMetrics(collected, registryMetrics)
+		}
+	}
+
+	if len(m.sinks) > 0 {
+		batch := sinkBatch{metrics: flattenHistograms(collected), timestamp: time.Now()}
+		for _, sink := range m.sinks {
+			sink.offer(batch)
 		}
 	}
 
@@ -296,16 +585,17 @@ var migMetricsFormat = `
 # HELP {{ $counter.FieldName }} {{ $counter.Help }}
 # TYPE {{ $counter.FieldName }} {{ $counter.PromType }}
 {{- range $metric := $metrics }}
-{{ $counter.FieldName }}{gpu="{{ $metric.GPU }}",{{ $metric.UUID }}="{{ $metric.GPUUUID }}",pci_bus_id="{{ $metric.GPUPCIBusID }}",device="{{ $metric.GPUDevice }}",modelName="{{ $metric.GPUModelName }}"{{if $metric.MigProfile}},GPU_I_PROFILE="{{ $metric.MigProfile }}",GPU_I_ID="{{ $metric.GPUInstanceID }}"{{end}}{{if $metric.Hostname }},Hostname="{{ $metric.Hostname }}"{{end}}
+{{ $counter.FieldName }}{{ $metric.Suffix }}{gpu="{{ $metric.GPU }}",{{ $metric.UUID }}="{{ $metric.GPUUUID }}",pci_bus_id="{{ $metric.GPUPCIBusID }}",device="{{ $metric.GPUDevice }}",modelName="{{ $metric.GPUModelName }}"{{if $metric.GPUInstanceID}},GPU_I_PROFILE="{{ $metric.MigProfile }}",GPU_I_ID="{{ $metric.GPUInstanceID }}"{{end}}{{if $metric.ComputeInstanceID}},GPU_CI_ID="{{ $metric.ComputeInstanceID }}"{{end}}{{if $metric.Hostname }},Hostname="{{ $metric.Hostname }}"{{end}}
 
 {{- range $k, $v := $metric.Labels -}}
-	,{{ $k }}="{{ $v }}"
+	,{{ $k }}="{{ escape $v }}"
 {{- end -}}
 {{- range $k, $v := $metric.Attributes -}}
-	,{{ $k }}="{{ $v }}"
+	,{{ $k }}="{{ escape $v }}"
 {{- end -}}
 
 } {{ $metric.Value -}}
+{{- if $metric.HasExemplar }} # { {{- $metric.ExemplarLabels -}} } {{ $metric.Value }}{{ with $metric.ExemplarTime }} {{ . }}{{ end }}{{ end -}}
 {{- end }}
 {{ end }}`
 
@@ -317,7 +607,7 @@ var switchMetricsFormat = `
 {{ $counter.FieldName }}{nvswitch="{{ $metric.GPU }}"{{if $metric.Hostname }},Hostname="{{ $metric.Hostname }}"{{end}}
 
 {{- range $k, $v := $metric.Labels -}}
-	,{{ $k }}="{{ $v }}"
+	,{{ $k }}="{{ escape $v }}"
 {{- end -}}
 } {{ $metric.Value -}}
 {{- end }}
@@ -331,7 +621,7 @@ var linkMetricsFormat = `
 {{ $counter.FieldName }}{nvlink="{{ $metric.GPU }}",nvswitch="{{ $metric.GPUDevice }}"{{if $metric.Hostname }},Hostname="{{ $metric.Hostname }}"{{end}}
 
 {{- range $k, $v := $metric.Labels -}}
-	,{{ $k }}="{{ $v }}"
+	,{{ $k }}="{{ escape $v }}"
 {{- end -}}
 } {{ $metric.Value -}}
 {{- end }}
@@ -345,7 +635,7 @@ var cpuMetricsFormat = `
 {{ $counter.FieldName }}{cpu="{{ $metric.GPU }}"{{if $metric.Hostname }},Hostname="{{ $metric.Hostname }}"{{end}}
 
 {{- range $k, $v := $metric.Labels -}}
-	,{{ $k }}="{{ $v }}"
+	,{{ $k }}="{{ escape $v }}"
 {{- end -}}
 } {{ $metric.Value -}}
 {{- end }}
@@ -359,12 +649,39 @@ var cpuCoreMetricsFormat = `
 {{ $counter.FieldName }}{cpucore="{{ $metric.GPU }}",cpu="{{ $metric.GPUDevice }}"{{if $metric.Hostname }},Hostname="{{ $metric.Hostname }}"{{end}}
 
 {{- range $k, $v := $metric.Labels -}}
-	,{{ $k }}="{{ $v }}"
+	,{{ $k }}="{{ escape $v }}"
 {{- end -}}
 } {{ $metric.Value -}}
 {{- end }}
 {{ end }}`
 
+/*
+* Pod metrics have no device labels, the pod is identified by its attributes:
+* ```
+* FIELD_ID{namespace="NAMESPACE",pod="POD", attr...,Hostname="HOSTNAME"} VALUE
+* ```
+ */
+var podMetricsFormat = `
+{{- range $counter, $metrics := . -}}
+# HELP {{ $counter.FieldName }} {{ $counter.Help }}
+# TYPE {{ $counter.FieldName }} {{ $counter.PromType }}
+{{- range $metric := $metrics }}
+{{ $counter.FieldName }}{
+{{- range $k, $v := $metric.Attributes -}}
+	{{ $k }}="{{ escape $v }}",
+{{- end -}}
+{{if $metric.Hostname }}Hostname="{{ $metric.Hostname }}"{{end}}} {{ $metric.Value -}}
+{{- end }}
+{{ end }}`
+
+// metricsTemplateFuncs escape the values of the labels and the attributes, which are kept raw for the other sinks
+var metricsTemplateFuncs = template.FuncMap{"escape": escapeLabelValue}
+
+// newMetricsTemplate parses the template rendering metrics in the text exposition format.
+func newMetricsTemplate(name, format string) *template.Template {
+	return template.Must(template.New(name).Funcs(metricsTemplateFuncs).Parse(format))
+}
+
 // FormatMetrics Template is passed here so that it isn't recompiled at each iteration
 func FormatMetrics(t *template.Template, groupedMetrics MetricsByCounter) (string, error) {
 	// Format metrics
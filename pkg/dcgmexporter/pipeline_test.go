@@ -18,7 +18,12 @@ package dcgmexporter
 
 import (
 	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -206,3 +211,94 @@ func TestNewMetricsPipelineWhenFieldEntityGroupTypeSystemInfoItemIsEmpty(t *test
 	require.NoError(t, err)
 	require.Empty(t, out)
 }
+
+func TestCollectIntervals(t *testing.T) {
+	config := &Config{
+		CollectInterval: 30000,
+		FieldCollectIntervals: map[dcgm.Short]time.Duration{
+			dcgm.DCGM_FI_DEV_GPU_TEMP:    time.Second,
+			dcgm.DCGM_FI_DEV_POWER_USAGE: time.Second,
+			dcgm.DCGM_FI_DEV_FB_FREE:     time.Minute,
+		},
+	}
+
+	assert.Equal(t, time.Second, collectTickInterval(config))
+	assert.Equal(t, 30*time.Second, collectTickInterval(&Config{CollectInterval: 30000}))
+
+	groups := fieldsByCollectInterval([]dcgm.Short{
+		dcgm.DCGM_FI_DEV_GPU_TEMP,
+		dcgm.DCGM_FI_DEV_FB_FREE,
+		dcgm.DCGM_FI_DEV_SM_CLOCK,
+		dcgm.DCGM_FI_DEV_POWER_USAGE,
+	}, config)
+	assert.Equal(t, []fieldGroupInterval{
+		{interval: time.Second, fields: []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_TEMP, dcgm.DCGM_FI_DEV_POWER_USAGE}},
+		{interval: 30 * time.Second, fields: []dcgm.Short{dcgm.DCGM_FI_DEV_SM_CLOCK}},
+		{interval: time.Minute, fields: []dcgm.Short{dcgm.DCGM_FI_DEV_FB_FREE}},
+	}, groups)
+}
+
+func TestGetTransformations_PodMapperError(t *testing.T) {
+	_, err := getTransformations(&Config{Kubernetes: true, KubernetesDeviceIDParsers: []string{"unknown"}})
+	assert.ErrorContains(t, err, "unknown device ID parser 'unknown'")
+}
+
+func TestNewFieldWatch(t *testing.T) {
+	// The default watches sample at the collect interval and keep the latest sample
+	config := &Config{CollectInterval: 30000, DCGMMaxKeepSamples: 1}
+	assert.Equal(t, FieldWatch{UpdateFreqUsec: 30000000, MaxKeepSamples: 1}, newFieldWatch(config, 30*time.Second))
+
+	// The update frequency only tightens the sampling
+	config = &Config{CollectInterval: 30000, DCGMUpdateFreq: 100, DCGMMaxKeepAge: 60, DCGMMaxKeepSamples: 10}
+	assert.Equal(t, FieldWatch{UpdateFreqUsec: 100000, MaxKeepAge: 60, MaxKeepSamples: 10},
+		newFieldWatch(config, 30*time.Second))
+	assert.Equal(t, FieldWatch{UpdateFreqUsec: 50000, MaxKeepAge: 60, MaxKeepSamples: 10},
+		newFieldWatch(config, 50*time.Millisecond))
+
+	// The samples are never kept forever
+	assert.Equal(t, FieldWatch{UpdateFreqUsec: 1000000, MaxKeepSamples: 1}, newFieldWatch(&Config{}, time.Second))
+	config = &Config{DCGMMaxKeepAge: 5}
+	assert.Equal(t, FieldWatch{UpdateFreqUsec: 1000000, MaxKeepAge: 5}, newFieldWatch(config, time.Second))
+}
+
+func TestMetricsPipeline_GatherRegistry(t *testing.T) {
+	config := &Config{CollectInterval: 10, BackgroundCollection: true}
+	collector := &countingCollector{}
+	registry := NewRegistry()
+	registry.Register(collector)
+
+	sink := &fakeSink{written: make(chan MetricsByCounter, 10), block: make(chan struct{})}
+	close(sink.block)
+
+	pipeline := &MetricsPipeline{config: config}
+	pipeline.AddSink(sink)
+	pipeline.GatherRegistry(registry)
+
+	var wg sync.WaitGroup
+	stop := make(chan interface{})
+	out := make(chan string, 10)
+	wg.Add(1)
+	go pipeline.Run(out, stop, &wg)
+
+	// The exporter metrics are served and pushed from the collection
+	formatted := <-out
+	assert.Contains(t, formatted, "DCGM_EXP_COUNTING")
+	assert.Contains(t, formatted, dcgmExporterCollectedAtSeconds)
+
+	written := <-sink.written
+	assert.Contains(t, written, Counter{FieldName: "DCGM_EXP_COUNTING", PromType: "gauge"})
+
+	close(stop)
+	wg.Wait()
+	gathered := collector.gathered
+
+	// The scrapes serve the last collection without gathering the exporter metrics
+	server, _, err := NewMetricsServer(config, nil, registry)
+	require.NoError(t, err)
+	server.updateMetrics(formatted)
+
+	rec := httptest.NewRecorder()
+	server.Metrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, 1, strings.Count(rec.Body.String(), "# TYPE DCGM_EXP_COUNTING gauge"))
+	assert.Equal(t, gathered, collector.gathered)
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const dcgmPodGPUCount = "DCGM_POD_GPU_COUNT"
+
+type podAggregation string
+
+const (
+	podAggregationSum podAggregation = "sum"
+	podAggregationAvg podAggregation = "avg"
+)
+
+type podAggregate struct {
+	name        string
+	aggregation podAggregation
+}
+
+// podAggregates lists the device metrics rolled up per pod, and how they are combined across the GPUs or
+// MIG slices held by the pod.
+var podAggregates = map[string]podAggregate{
+	"DCGM_FI_DEV_GPU_UTIL":          {name: "DCGM_POD_GPU_UTIL", aggregation: podAggregationAvg},
+	"DCGM_FI_DEV_MEM_COPY_UTIL":     {name: "DCGM_POD_MEM_COPY_UTIL", aggregation: podAggregationAvg},
+	"DCGM_FI_DEV_FB_USED":           {name: "DCGM_POD_FB_USED", aggregation: podAggregationSum},
+	"DCGM_FI_DEV_FB_FREE":           {name: "DCGM_POD_FB_FREE", aggregation: podAggregationSum},
+	"DCGM_FI_DEV_POWER_USAGE":       {name: "DCGM_POD_POWER_USAGE", aggregation: podAggregationSum},
+	"DCGM_FI_PROF_GR_ENGINE_ACTIVE": {name: "DCGM_POD_GR_ENGINE_ACTIVE", aggregation: podAggregationAvg},
+	"DCGM_FI_PROF_SM_ACTIVE":        {name: "DCGM_POD_SM_ACTIVE", aggregation: podAggregationAvg},
+	"DCGM_FI_PROF_DRAM_ACTIVE":      {name: "DCGM_POD_DRAM_ACTIVE", aggregation: podAggregationAvg},
+}
+
+type podAggregateValue struct {
+	attributes map[string]string
+	hostname   string
+	sum        float64
+	count      int
+}
+
+// aggregatePodMetrics rolls up the metrics attributed to pods into one series per pod. The GPU metrics
+// must have been processed by the PodMapper first.
+func aggregatePodMetrics(metrics MetricsByCounter, names podAttributeNames) MetricsByCounter {
+	podKey := names.name(podAttribute)
+
+	aggregated := MetricsByCounter{}
+	gpus := map[string]*podAggregateValue{}
+	seenGPUs := map[string]bool{}
+
+	for counter, counterMetrics := range metrics {
+		aggregate, exists := podAggregates[counter.FieldName]
+		if !exists || counter.PromType == histogramPromType {
+			continue
+		}
+
+		values := map[string]*podAggregateValue{}
+		var keys []string
+
+		for _, metric := range counterMetrics {
+			// The rollups of the MIG instances would count the instances of the pod twice
+			if metric.Attributes[podKey] == "" || metric.Attributes[aggregatedAttribute] != "" {
+				continue
+			}
+
+			value, err := strconv.ParseFloat(metric.Value, 64)
+			if err != nil {
+				continue
+			}
+
+			attributes := podLevelAttributes(metric.Attributes, names)
+			key := podAggregateKey(attributes, names)
+
+			if _, exists := values[key]; !exists {
+				values[key] = &podAggregateValue{attributes: attributes, hostname: metric.Hostname}
+				keys = append(keys, key)
+			}
+			values[key].sum += value
+			values[key].count++
+
+			gpuKey := key + "/" + metric.GPU + "-" + metric.GPUInstanceID
+			if !seenGPUs[gpuKey] {
+				seenGPUs[gpuKey] = true
+				if _, exists := gpus[key]; !exists {
+					gpus[key] = &podAggregateValue{attributes: attributes, hostname: metric.Hostname}
+				}
+				gpus[key].count++
+			}
+		}
+
+		if len(keys) == 0 {
+			continue
+		}
+
+		podCounter := Counter{
+			FieldName: aggregate.name,
+			PromType:  counter.PromType,
+			Help: fmt.Sprintf("%s, %s across the GPUs of the pod.", strings.TrimSuffix(counter.Help, "."),
+				aggregate.aggregation),
+		}
+
+		for _, key := range keys {
+			value := values[key]
+
+			result := value.sum
+			if aggregate.aggregation == podAggregationAvg {
+				result /= float64(value.count)
+			}
+
+			aggregated[podCounter] = append(aggregated[podCounter], Metric{
+				Counter:    podCounter,
+				Value:      strconv.FormatFloat(result, 'f', -1, 64),
+				Hostname:   value.hostname,
+				Attributes: value.attributes,
+			})
+		}
+	}
+
+	if len(gpus) > 0 {
+		countCounter := Counter{
+			FieldName: dcgmPodGPUCount,
+			PromType:  "gauge",
+			Help:      "Number of GPUs or MIG slices held by the pod.",
+		}
+
+		for _, value := range gpus {
+			aggregated[countCounter] = append(aggregated[countCounter], Metric{
+				Counter:    countCounter,
+				Value:      strconv.Itoa(value.count),
+				Hostname:   value.hostname,
+				Attributes: value.attributes,
+			})
+		}
+	}
+
+	return aggregated
+}
+
+// podLevelAttributes keeps the attributes describing the pod, dropping the container and device specific ones.
+func podLevelAttributes(attributes map[string]string, names podAttributeNames) map[string]string {
+	result := map[string]string{}
+
+	for k, v := range attributes {
+		switch original := names.original(k); {
+		case original == podAttribute, original == namespaceAttribute,
+			original == ownerKindAttribute, original == ownerNameAttribute,
+			strings.HasPrefix(original, podLabelAttributePrefix), strings.HasPrefix(original, podAnnotationAttributePrefix):
+			result[k] = v
+		}
+	}
+
+	return result
+}
+
+func podAggregateKey(attributes map[string]string, names podAttributeNames) string {
+	return attributes[names.name(namespaceAttribute)] + "/" + attributes[names.name(podAttribute)]
+}
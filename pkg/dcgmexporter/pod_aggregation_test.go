@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregatePodMetrics(t *testing.T) {
+	utilCounter := Counter{FieldID: 203, FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge", Help: "GPU utilization (in %)."}
+	fbCounter := Counter{FieldID: 252, FieldName: "DCGM_FI_DEV_FB_USED", PromType: "gauge", Help: "Framebuffer memory used (in MiB)."}
+	tempCounter := Counter{FieldID: 150, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge", Help: "GPU temperature (in C)."}
+
+	podAttributes := func(pod, container string) map[string]string {
+		return map[string]string{
+			podAttribute:                     pod,
+			namespaceAttribute:               "default",
+			containerAttribute:               container,
+			podLabelAttributePrefix + "team": "ml",
+			mpsAttribute:                     "true",
+		}
+	}
+
+	// The rollup of the MIG instances of a GPU is not counted with its instances
+	rollupAttributes := podAttributes("trainer", "a")
+	rollupAttributes[aggregatedAttribute] = "true"
+
+	metrics := MetricsByCounter{
+		utilCounter: {
+			{GPU: "0", Value: "20", Hostname: "node", Attributes: podAttributes("trainer", "a")},
+			{GPU: "1", Value: "60", Hostname: "node", Attributes: podAttributes("trainer", "b")},
+			{GPU: "2", Value: "80", Hostname: "node", Attributes: map[string]string{}},
+		},
+		fbCounter: {
+			{GPU: "0", Value: "1024", Hostname: "node", Attributes: podAttributes("trainer", "a")},
+			{GPU: "1", Value: "512", Hostname: "node", Attributes: podAttributes("trainer", "b")},
+			{GPU: "2", Value: "256", Hostname: "node", Attributes: map[string]string{}},
+			{GPU: "0", Value: "4096", Hostname: "node", Attributes: rollupAttributes},
+		},
+		tempCounter: {
+			{GPU: "0", Value: "40", Hostname: "node", Attributes: podAttributes("trainer", "a")},
+		},
+	}
+
+	aggregated := aggregatePodMetrics(metrics, podAttributeNames{})
+	require.Len(t, aggregated, 3)
+
+	wantAttributes := map[string]string{
+		podAttribute:                     "trainer",
+		namespaceAttribute:               "default",
+		podLabelAttributePrefix + "team": "ml",
+	}
+
+	for counter, podMetrics := range aggregated {
+		require.Len(t, podMetrics, 1, counter.FieldName)
+		assert.Equal(t, wantAttributes, podMetrics[0].Attributes)
+		assert.Equal(t, "node", podMetrics[0].Hostname)
+
+		switch counter.FieldName {
+		case "DCGM_POD_GPU_UTIL":
+			assert.Equal(t, "40", podMetrics[0].Value)
+		case "DCGM_POD_FB_USED":
+			assert.Equal(t, "1536", podMetrics[0].Value)
+		case dcgmPodGPUCount:
+			assert.Equal(t, "2", podMetrics[0].Value)
+		default:
+			t.Errorf("unexpected pod metric %s", counter.FieldName)
+		}
+	}
+}
+
+func TestPodMetricsFormat(t *testing.T) {
+	counter := Counter{FieldName: "DCGM_POD_GPU_UTIL", PromType: "gauge", Help: "GPU utilization (in %)."}
+	metrics := MetricsByCounter{
+		counter: {
+			{
+				Counter:    counter,
+				Value:      "40",
+				Hostname:   "node",
+				Attributes: map[string]string{podAttribute: "trainer", namespaceAttribute: "default"},
+			},
+		},
+	}
+
+	out, err := FormatMetrics(newMetricsTemplate("podMetrics", podMetricsFormat), metrics)
+	require.NoError(t, err)
+	assert.Equal(t, `# HELP DCGM_POD_GPU_UTIL GPU utilization (in %).
+# TYPE DCGM_POD_GPU_UTIL gauge
+DCGM_POD_GPU_UTIL{namespace="default",pod="trainer",Hostname="node"} 40
+`, out)
+}
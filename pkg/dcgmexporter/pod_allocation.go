@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const dcgmExpPodGPUAllocationSeconds = "DCGM_EXP_POD_GPU_ALLOCATION_SECONDS"
+
+var (
+	sharedPodAllocationsMutex sync.Mutex
+	sharedPodAllocations      *podAllocations
+)
+
+// podAllocations remembers when the containers were first seen holding a device, the start times are persisted in
+// the state store, when there is one, so that the allocations keep their age across the restarts of the exporter.
+type podAllocations struct {
+	sync.Mutex
+	now     func() time.Time
+	store   func() *stateStore
+	started map[string]time.Time
+}
+
+// getPodAllocations returns the allocations shared by the pod mappers, so that they keep their age across the
+// reloads of the configuration, even without state store.
+func getPodAllocations() *podAllocations {
+	sharedPodAllocationsMutex.Lock()
+	defer sharedPodAllocationsMutex.Unlock()
+
+	if sharedPodAllocations == nil {
+		sharedPodAllocations = &podAllocations{
+			now:     time.Now,
+			store:   getStateStore,
+			started: map[string]time.Time{},
+		}
+	}
+
+	return sharedPodAllocations
+}
+
+// update records the start of the allocations that appeared and, when the keys are complete, forgets the
+// allocations that ended.
+func (a *podAllocations) update(keys map[string]bool, complete bool) {
+	a.Lock()
+	defer a.Unlock()
+
+	store := a.store()
+	for key := range keys {
+		if _, exists := a.started[key]; !exists {
+			a.started[key] = a.start(store, key)
+		}
+
+		if store != nil {
+			store.set(allocationStateKey(key), float64(a.started[key].Unix()))
+		}
+	}
+
+	if !complete {
+		return
+	}
+
+	for key := range a.started {
+		if keys[key] {
+			continue
+		}
+
+		delete(a.started, key)
+		if store != nil {
+			store.delete(allocationStateKey(key))
+		}
+	}
+}
+
+// start returns the start of a new allocation, read from the state store when it was seen before a restart.
+func (a *podAllocations) start(store *stateStore, key string) time.Time {
+	if store != nil {
+		if state, ok := store.get(allocationStateKey(key)); ok && len(state) == 1 {
+			return time.Unix(int64(state[0]), 0)
+		}
+	}
+
+	return a.now()
+}
+
+// seconds returns how long the allocation has been held.
+func (a *podAllocations) seconds(key string) float64 {
+	a.Lock()
+	defer a.Unlock()
+
+	return a.now().Sub(a.started[key]).Seconds()
+}
+
+func allocationStateKey(key string) string {
+	return "pod_allocations/" + key
+}
+
+// allocationKey identifies the allocation of a device to a container. The pod is identified by its UID, so that a
+// pod recreated with the same name, e.g. by a StatefulSet, starts a new allocation, and the replicas of a shared GPU
+// are only told apart when they are exported.
+func (p *PodMapper) allocationKey(deviceID string, podInfo PodInfo) (string, error) {
+	pod, err := p.podMetadata.Get(podInfo.Namespace, podInfo.Name)
+	if err != nil {
+		return "", err
+	}
+	if pod.UID == "" {
+		return "", fmt.Errorf("pod '%s/%s' has no UID", podInfo.Namespace, podInfo.Name)
+	}
+
+	parts := []string{deviceID, string(pod.UID), podInfo.Container}
+	if p.Config.KubernetesVirtualGPUs {
+		parts = append(parts, podInfo.VGPU)
+	}
+
+	return strings.Join(parts, "/"), nil
+}
+
+// addAllocationMetrics adds, for every container holding a device, how long the device has been allocated to it, so
+// that the GPU-hours can be billed whether the container uses the device or not.
+func (p *PodMapper) addAllocationMetrics(metrics MetricsByCounter, deviceToPods map[string][]PodInfo) error {
+	counter := Counter{
+		FieldName: dcgmExpPodGPUAllocationSeconds,
+		PromType:  "gauge",
+		Help:      "Time since the device was allocated to the container (in seconds).",
+	}
+
+	// The allocations of the pods whose UID is unknown yet are neither reported nor forgotten
+	keys := make(map[string]bool)
+	deviceKeys := make(map[string][]string, len(deviceToPods))
+	complete := true
+	for deviceID, pods := range deviceToPods {
+		deviceKeys[deviceID] = make([]string, len(pods))
+		for i, podInfo := range pods {
+			key, err := p.allocationKey(deviceID, podInfo)
+			if err != nil {
+				logrus.WithError(err).Debug("Skipping the allocation of the pod")
+				complete = false
+				continue
+			}
+
+			keys[key] = true
+			deviceKeys[deviceID][i] = key
+		}
+	}
+	p.allocations.update(keys, complete)
+
+	var allocations []Metric
+	seen := make(map[string]bool)
+
+	for _, counterMetrics := range metrics {
+		for _, val := range counterMetrics {
+			deviceID, err := val.getIDOfType(p.Config.KubernetesGPUIdType)
+			if err != nil {
+				return err
+			}
+
+			for i, podInfo := range deviceToPods[deviceID] {
+				key := deviceKeys[deviceID][i]
+				if key == "" || seen[key] || !p.podFilter.matches(podInfo) {
+					continue
+				}
+				seen[key] = true
+
+				seconds := strconv.FormatFloat(p.allocations.seconds(key), 'f', 0, 64)
+				metric := deviceMetric(val, counter, seconds)
+				p.setPodAttributes(metric.Attributes, podInfo)
+				allocations = append(allocations, metric)
+			}
+		}
+	}
+
+	if len(allocations) > 0 {
+		metrics[counter] = allocations
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAddAllocationMetrics(t *testing.T) {
+	gpuUUID := "GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5"
+	now := time.Unix(1000, 0)
+	store := &stateStore{
+		path:      filepath.Join(t.TempDir(), "state.json"),
+		retention: time.Hour,
+		now:       func() time.Time { return now },
+		entries:   map[string]stateEntry{},
+	}
+	clientset := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "gpu-pod-0", Namespace: "default", UID: "uid-0"},
+	})
+	podMetadata, err := newPodMetadataCache(clientset, time.Minute)
+	require.NoError(t, err)
+	defer podMetadata.Close()
+	waitForPodMetadata(t, podMetadata)
+
+	newPodMapper := func() *PodMapper {
+		return &PodMapper{
+			Config:      &Config{KubernetesGPUIdType: GPUUID},
+			podMetadata: podMetadata,
+			allocations: &podAllocations{
+				now:     func() time.Time { return now },
+				store:   func() *stateStore { return store },
+				started: map[string]time.Time{},
+			},
+		}
+	}
+
+	counter := Counter{FieldID: 155, FieldName: "DCGM_FI_DEV_POWER_USAGE", PromType: "gauge"}
+	process := func(p *PodMapper, deviceToPods map[string][]PodInfo) []Metric {
+		t.Helper()
+
+		metrics := MetricsByCounter{
+			counter: {{GPU: "0", GPUUUID: gpuUUID, Value: "0", Counter: counter, Attributes: map[string]string{}}},
+		}
+		require.NoError(t, p.addAllocationMetrics(metrics, deviceToPods))
+
+		for c, counterMetrics := range metrics {
+			if c.FieldName == dcgmExpPodGPUAllocationSeconds {
+				return counterMetrics
+			}
+		}
+		return nil
+	}
+
+	podMapper := newPodMapper()
+	pod := PodInfo{Name: "gpu-pod-0", Namespace: "default", Container: "default"}
+	deviceToPods := map[string][]PodInfo{gpuUUID: {pod}}
+
+	got := process(podMapper, deviceToPods)
+	require.Len(t, got, 1)
+	assert.Equal(t, "0", got[0].Value)
+	assert.Equal(t, map[string]string{
+		podAttribute:       "gpu-pod-0",
+		namespaceAttribute: "default",
+		containerAttribute: "default",
+	}, got[0].Attributes)
+
+	// The allocation is reported while the container doesn't use the GPU, and survives a restart
+	now = now.Add(90 * time.Second)
+	got = process(newPodMapper(), deviceToPods)
+	require.Len(t, got, 1)
+	assert.Equal(t, "90", got[0].Value)
+
+	// The pods whose UID is unknown are skipped without ending the other allocations
+	unknown := PodInfo{Name: "gpu-pod-1", Namespace: "default", Container: "default"}
+	got = process(podMapper, map[string][]PodInfo{gpuUUID: {unknown}})
+	assert.Empty(t, got)
+	got = process(podMapper, deviceToPods)
+	require.Len(t, got, 1)
+	assert.Equal(t, "90", got[0].Value)
+
+	// A new allocation starts over once the pod is gone
+	key, err := podMapper.allocationKey(gpuUUID, pod)
+	require.NoError(t, err)
+	assert.Equal(t, gpuUUID+"/uid-0/default", key)
+	assert.Empty(t, process(podMapper, map[string][]PodInfo{}))
+	_, exists := store.get(allocationStateKey(key))
+	assert.False(t, exists)
+
+	now = now.Add(time.Minute)
+	got = process(podMapper, deviceToPods)
+	require.Len(t, got, 1)
+	assert.Equal(t, "0", got[0].Value)
+
+	// A pod recreated with the same name starts a new allocation
+	now = now.Add(time.Minute)
+	recreated := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "gpu-pod-0", Namespace: "default", UID: "uid-1"}}
+	_, err = clientset.CoreV1().Pods("default").Update(context.Background(), recreated, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		meta, err := podMetadata.Get("default", "gpu-pod-0")
+		return err == nil && meta.UID == types.UID("uid-1")
+	}, 5*time.Second, 10*time.Millisecond)
+	got = process(podMapper, deviceToPods)
+	require.Len(t, got, 1)
+	assert.Equal(t, "0", got[0].Value)
+}
+
+func TestGetPodAllocations(t *testing.T) {
+	sharedPodAllocations = nil
+	defer func() {
+		sharedPodAllocations = nil
+	}()
+
+	// The allocations are kept across the reloads of the configuration
+	allocations := getPodAllocations()
+	allocations.update(map[string]bool{"GPU-0/uid-0/default": true}, true)
+	assert.Same(t, allocations, getPodAllocations())
+	assert.Contains(t, getPodAllocations().started, "GPU-0/uid-0/default")
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// podFilter selects the pods that GPU metrics are attributed to.
+type podFilter struct {
+	namespaces map[string]bool
+	selector   labels.Selector
+	metadata   *podMetadataCache
+}
+
+func newPodFilter(c *Config, metadata *podMetadataCache) (*podFilter, error) {
+	switch c.KubernetesPodFilterMode {
+	case "", PodFilterModeAttribute, PodFilterModeDrop:
+	default:
+		return nil, fmt.Errorf("unsupported pod filter mode '%s'", c.KubernetesPodFilterMode)
+	}
+
+	if len(c.KubernetesNamespaces) == 0 && c.KubernetesPodLabelSelector == "" {
+		return nil, nil
+	}
+
+	filter := &podFilter{
+		metadata: metadata,
+	}
+
+	if len(c.KubernetesNamespaces) > 0 {
+		filter.namespaces = map[string]bool{}
+		for _, namespace := range c.KubernetesNamespaces {
+			filter.namespaces[namespace] = true
+		}
+	}
+
+	if c.KubernetesPodLabelSelector != "" {
+		selector, err := labels.Parse(c.KubernetesPodLabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pod label selector '%s'; err: %w", c.KubernetesPodLabelSelector, err)
+		}
+		filter.selector = selector
+	}
+
+	return filter, nil
+}
+
+// matches returns true if the pod is allowed. Pods whose labels can't be retrieved don't match the selector.
+func (f *podFilter) matches(podInfo PodInfo) bool {
+	if f == nil {
+		return true
+	}
+
+	if f.namespaces != nil && !f.namespaces[podInfo.Namespace] {
+		return false
+	}
+
+	if f.selector == nil {
+		return true
+	}
+
+	meta, err := f.metadata.Get(podInfo.Namespace, podInfo.Name)
+	if err != nil {
+		logrus.WithError(err).Debug("Unable to get pod labels for the pod label selector")
+		return false
+	}
+
+	return f.selector.Matches(labels.Set(meta.Labels))
+}
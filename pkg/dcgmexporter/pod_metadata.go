@@ -0,0 +1,307 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	podLabelAttributePrefix      = "label_"
+	podAnnotationAttributePrefix = "annotation_"
+)
+
+var podMetadataCacheTTL = time.Minute
+
+type podOwner struct {
+	Kind string
+	Name string
+}
+
+type podOwnerCacheEntry struct {
+	owner     podOwner
+	fetchedAt time.Time
+}
+
+// podMetadataCache keeps the metadata of the pods of the node, watched by an informer, and of their owners, so that
+// the Kubernetes API is queried at most once per owner for every TTL period.
+type podMetadataCache struct {
+	client kubernetes.Interface
+	ttl    time.Duration
+
+	factory informers.SharedInformerFactory
+	pods    corelisters.PodLister
+	synced  cache.InformerSynced
+	stopped chan struct{}
+
+	mtx    sync.Mutex
+	owners map[string]podOwnerCacheEntry
+}
+
+// newPodMetadataCache starts watching the pods of the node, named by NODE_NAME even without hostname. The pods are
+// unknown until the informer listed them.
+func newPodMetadataCache(client kubernetes.Interface, ttl time.Duration) (*podMetadataCache, error) {
+	nodeName, err := GetHostname(&Config{})
+	if err != nil {
+		return nil, fmt.Errorf("could not find the node name; err: %w", err)
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", nodeName).String()
+		}))
+	podInformer := factory.Core().V1().Pods()
+
+	c := &podMetadataCache{
+		client:  client,
+		ttl:     ttl,
+		factory: factory,
+		pods:    podInformer.Lister(),
+		synced:  podInformer.Informer().HasSynced,
+		stopped: make(chan struct{}),
+		owners:  map[string]podOwnerCacheEntry{},
+	}
+	factory.Start(c.stopped)
+
+	return c, nil
+}
+
+// Close stops watching the pods.
+func (c *podMetadataCache) Close() {
+	close(c.stopped)
+	c.factory.Shutdown()
+}
+
+// Get returns the metadata of the pod.
+func (c *podMetadataCache) Get(namespace, name string) (metav1.ObjectMeta, error) {
+	pod, err := c.get(namespace, name)
+	if err != nil {
+		return metav1.ObjectMeta{}, err
+	}
+
+	return pod.ObjectMeta, nil
+}
+
+// GetContainerID returns the runtime ID of the container, or an empty string when the container is not
+// running yet.
+func (c *podMetadataCache) GetContainerID(namespace, name, container string) (string, error) {
+	pod, err := c.get(namespace, name)
+	if err != nil {
+		return "", err
+	}
+
+	return containerIDs(pod)[container], nil
+}
+
+// GetContainers returns the names of the containers of the pod, in the order of the pod spec.
+func (c *podMetadataCache) GetContainers(namespace, name string) ([]string, error) {
+	pod, err := c.get(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	containers := make([]string, 0, len(pod.Spec.Containers))
+	for _, container := range pod.Spec.Containers {
+		containers = append(containers, container.Name)
+	}
+
+	return containers, nil
+}
+
+func (c *podMetadataCache) get(namespace, name string) (*corev1.Pod, error) {
+	if !c.synced() {
+		return nil, fmt.Errorf("could not retrieve pod '%s/%s'; the pods of the node are not listed yet",
+			namespace, name)
+	}
+
+	pod, err := c.pods.Pods(namespace).Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve pod '%s/%s'; err: %w", namespace, name, err)
+	}
+
+	return pod, nil
+}
+
+// containerIDs returns the IDs of the containers of the pod, stripped of their runtime prefix, e.g.
+// containerd://, to keep exemplars below the 128 characters limit of OpenMetrics.
+func containerIDs(pod *corev1.Pod) map[string]string {
+	ids := map[string]string{}
+
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.ContainerID == "" {
+				continue
+			}
+			_, id, found := strings.Cut(status.ContainerID, "://")
+			if !found {
+				id = status.ContainerID
+			}
+			ids[status.Name] = id
+		}
+	}
+
+	return ids
+}
+
+// GetOwner resolves the top-level controller of the pod, following ReplicaSets to their Deployment and Jobs
+// to their CronJob. It returns false when the pod is not managed by a controller.
+func (c *podMetadataCache) GetOwner(meta metav1.ObjectMeta) (podOwner, bool) {
+	ref := metav1.GetControllerOf(&meta)
+	if ref == nil {
+		return podOwner{}, false
+	}
+
+	owner := podOwner{Kind: ref.Kind, Name: ref.Name}
+	if ref.Kind != "ReplicaSet" && ref.Kind != "Job" {
+		return owner, true
+	}
+
+	key := meta.Namespace + "/" + ref.Kind + "/" + ref.Name
+
+	c.mtx.Lock()
+	entry, exists := c.owners[key]
+	c.mtx.Unlock()
+
+	if exists && time.Since(entry.fetchedAt) < c.ttl {
+		return entry.owner, true
+	}
+
+	// The lock is not held during the call, so that a slow API server does not block the other lookups
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTimeout)
+	defer cancel()
+
+	var (
+		ownerMeta metav1.ObjectMeta
+		err       error
+	)
+
+	switch ref.Kind {
+	case "ReplicaSet":
+		var rs *appsv1.ReplicaSet
+		rs, err = c.client.AppsV1().ReplicaSets(meta.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err == nil {
+			ownerMeta = rs.ObjectMeta
+		}
+	case "Job":
+		var job *batchv1.Job
+		job, err = c.client.BatchV1().Jobs(meta.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err == nil {
+			ownerMeta = job.ObjectMeta
+		}
+	}
+
+	if err != nil {
+		// Fall back to the immediate controller, the API may be unreachable or RBAC may not allow the lookup.
+		logrus.WithError(err).Debugf("Unable to resolve owner of %s '%s'", ref.Kind, key)
+	} else if parent := metav1.GetControllerOf(&ownerMeta); parent != nil {
+		owner = podOwner{Kind: parent.Kind, Name: parent.Name}
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.owners[key] = podOwnerCacheEntry{
+		owner:     owner,
+		fetchedAt: time.Now(),
+	}
+	c.evictExpired()
+
+	return owner, true
+}
+
+// evictExpired removes the owners that were not requested for a while, e.g. of deleted pods.
+func (c *podMetadataCache) evictExpired() {
+	for key, entry := range c.owners {
+		if time.Since(entry.fetchedAt) >= 2*c.ttl {
+			delete(c.owners, key)
+		}
+	}
+}
+
+// podMetadataAttributes returns the configured pod labels, annotations and owner as metric attributes.
+func (p *PodMapper) podMetadataAttributes(podInfo PodInfo) map[string]string {
+	attrs := map[string]string{}
+
+	if p.podMetadata == nil {
+		return attrs
+	}
+
+	meta, err := p.podMetadata.Get(podInfo.Namespace, podInfo.Name)
+	if err != nil {
+		logrus.WithError(err).Debug("Unable to get pod metadata")
+		return attrs
+	}
+
+	for _, key := range p.Config.KubernetesPodLabels {
+		if value, exists := meta.Labels[key]; exists {
+			attrs[podLabelAttributePrefix+sanitizeLabelName(key)] = value
+		}
+	}
+
+	for _, key := range p.Config.KubernetesPodAnnotations {
+		if value, exists := meta.Annotations[key]; exists {
+			attrs[podAnnotationAttributePrefix+sanitizeLabelName(key)] = value
+		}
+	}
+
+	if p.Config.KubernetesPodOwner {
+		if owner, exists := p.podMetadata.GetOwner(meta); exists {
+			attrs[ownerKindAttribute] = owner.Kind
+			attrs[ownerNameAttribute] = owner.Name
+		}
+	}
+
+	return attrs
+}
+
+// podExemplar returns the exemplar labels linking the metrics of the pod to its UID and container ID, or nil
+// when exemplars are disabled or the pod is unknown.
+func (p *PodMapper) podExemplar(podInfo PodInfo) map[string]string {
+	if !p.Config.KubernetesExemplars || p.podMetadata == nil {
+		return nil
+	}
+
+	meta, err := p.podMetadata.Get(podInfo.Namespace, podInfo.Name)
+	if err != nil {
+		logrus.WithError(err).Debug("Unable to get pod metadata")
+		return nil
+	}
+
+	exemplar := map[string]string{exemplarPodUIDLabel: string(meta.UID)}
+
+	containerID, _ := p.podMetadata.GetContainerID(podInfo.Namespace, podInfo.Name, podInfo.Container)
+	if containerID != "" {
+		exemplar[exemplarContainerIDLabel] = containerID
+	}
+
+	return exemplar
+}
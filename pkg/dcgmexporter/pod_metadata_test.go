@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+)
+
+func controllerRef(kind, name string) []metav1.OwnerReference {
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: ptr.To(true)}}
+}
+
+func TestPodMetadataCache_GetOwner(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "trainer-5d4f8",
+				Namespace:       "default",
+				OwnerReferences: controllerRef("Deployment", "trainer"),
+			},
+		},
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "standalone-rs",
+				Namespace: "default",
+			},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "nightly-28391",
+				Namespace:       "default",
+				OwnerReferences: controllerRef("CronJob", "nightly"),
+			},
+		},
+	)
+
+	cache, err := newPodMetadataCache(clientset, time.Minute)
+	require.NoError(t, err)
+	defer cache.Close()
+
+	tests := []struct {
+		name       string
+		owners     []metav1.OwnerReference
+		wantOwner  podOwner
+		wantExists bool
+	}{
+		{
+			name:       "When pod is owned by a Deployment",
+			owners:     controllerRef("ReplicaSet", "trainer-5d4f8"),
+			wantOwner:  podOwner{Kind: "Deployment", Name: "trainer"},
+			wantExists: true,
+		},
+		{
+			name:       "When pod is owned by a ReplicaSet without a controller",
+			owners:     controllerRef("ReplicaSet", "standalone-rs"),
+			wantOwner:  podOwner{Kind: "ReplicaSet", Name: "standalone-rs"},
+			wantExists: true,
+		},
+		{
+			name:       "When pod is owned by a CronJob",
+			owners:     controllerRef("Job", "nightly-28391"),
+			wantOwner:  podOwner{Kind: "CronJob", Name: "nightly"},
+			wantExists: true,
+		},
+		{
+			name:       "When pod is owned by a StatefulSet",
+			owners:     controllerRef("StatefulSet", "db"),
+			wantOwner:  podOwner{Kind: "StatefulSet", Name: "db"},
+			wantExists: true,
+		},
+		{
+			name:       "When ReplicaSet can not be found",
+			owners:     controllerRef("ReplicaSet", "deleted"),
+			wantOwner:  podOwner{Kind: "ReplicaSet", Name: "deleted"},
+			wantExists: true,
+		},
+		{
+			name:       "When pod has no controller",
+			wantExists: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner, exists := cache.GetOwner(metav1.ObjectMeta{
+				Name:            "pod",
+				Namespace:       "default",
+				OwnerReferences: tt.owners,
+			})
+			require.Equal(t, tt.wantExists, exists)
+			assert.Equal(t, tt.wantOwner, owner)
+		})
+	}
+}
+
+func TestPodMetadataCache_Get(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "gpu-pod-0", Namespace: "default", Labels: map[string]string{"team": "a"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "main"}, {Name: "sidecar"}}},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "main", ContainerID: "containerd://4c1f0e9b2a"},
+		}},
+	})
+	cache, err := newPodMetadataCache(clientset, time.Minute)
+	require.NoError(t, err)
+	defer cache.Close()
+
+	waitForPodMetadata(t, cache)
+
+	_, err = cache.Get("default", "missing")
+	require.Error(t, err)
+
+	meta, err := cache.Get("default", "gpu-pod-0")
+	require.NoError(t, err)
+	assert.Equal(t, "a", meta.Labels["team"])
+
+	containers, err := cache.GetContainers("default", "gpu-pod-0")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main", "sidecar"}, containers)
+
+	containerID, err := cache.GetContainerID("default", "gpu-pod-0", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "4c1f0e9b2a", containerID)
+}
+
+// waitForPodMetadata waits until the informer of the cache listed the pods.
+func waitForPodMetadata(t *testing.T, cache *podMetadataCache) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.True(t, toolscache.WaitForCacheSync(ctx.Done(), cache.synced))
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+// powerLimitCollector counts the changes of the enforced power limit of the GPUs, e.g. when an operator or the
+// firmware lowers the power cap of a node, so that they are not missed between two scrapes of the limit gauges.
+type powerLimitCollector struct {
+	expCollector
+	mtx sync.Mutex
+	// limits are the enforced power limits of the GPUs seen by the previous collection
+	limits  map[uint]float64
+	changes map[uint]int
+}
+
+// IsDCGMExpPowerLimitChangesEnabled checks if the DCGM_EXP_POWER_LIMIT_CHANGES_TOTAL counter exists
+func IsDCGMExpPowerLimitChangesEnabled(counters []Counter) bool {
+	return slices.ContainsFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpPowerLimitChangesTotal
+	})
+}
+
+func NewPowerLimitCollector(counters []Counter,
+	hostname string,
+	config *Config,
+	fieldEntityGroupTypeSystemInfo FieldEntityGroupTypeSystemInfoItem) (Collector, error) {
+	if !IsDCGMExpPowerLimitChangesEnabled(counters) {
+		logrus.Error(dcgmExpPowerLimitChangesTotal + " collector is disabled")
+		return nil, fmt.Errorf(dcgmExpPowerLimitChangesTotal + " collector is disabled")
+	}
+
+	collector := newPowerLimitCollector(newExpCollector(
+		counters,
+		hostname,
+		[]dcgm.Short{dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT},
+		config,
+		fieldEntityGroupTypeSystemInfo,
+	))
+
+	collector.counter = counters[slices.IndexFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpPowerLimitChangesTotal
+	})]
+
+	return collector, nil
+}
+
+func newPowerLimitCollector(expCollector expCollector) *powerLimitCollector {
+	return &powerLimitCollector{
+		expCollector: expCollector,
+		limits:       map[uint]float64{},
+		changes:      map[uint]int{},
+	}
+}
+
+// observe records the enforced power limit of the GPU, the first limit seen is not a change
+func (c *powerLimitCollector) observe(gpu uint, limit float64) {
+	previous, exists := c.limits[gpu]
+	if exists && previous != limit {
+		c.changes[gpu]++
+	}
+	c.limits[gpu] = limit
+}
+
+func (c *powerLimitCollector) GetMetrics() (MetricsByCounter, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	uuid := "UUID"
+	if c.config.UseOldNamespace {
+		uuid = "uuid"
+	}
+
+	metrics := make(MetricsByCounter)
+	checked := map[uint]bool{}
+
+	for _, mi := range GetMonitoredEntities(c.sysInfo) {
+		if checked[mi.DeviceInfo.GPU] {
+			continue
+		}
+		checked[mi.DeviceInfo.GPU] = true
+
+		// The power limit is the one of the GPU, the MIG instances share it
+		mi.InstanceInfo = nil
+
+		entity := dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU, EntityId: mi.DeviceInfo.GPU}
+		values, err := dcgmLatestValuesHook(entity, 0, c.counterDeviceFields)
+		if err != nil {
+			logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(),
+				"Unable to get the enforced power limit of GPU %d", mi.DeviceInfo.GPU)
+			continue
+		}
+
+		for _, val := range values {
+			if val.FieldId == uint(dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT) && ToString(val) != SkipDCGMValue {
+				c.observe(mi.DeviceInfo.GPU, val.Float64())
+			}
+		}
+
+		labels := map[string]string{}
+		if len(c.labelsCounters) > 0 {
+			err := c.getLabelsFromCounters(mi, labels)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		m := c.createMetric(labels, mi, uuid, c.changes[mi.DeviceInfo.GPU])
+		metrics[c.counter] = append(metrics[c.counter], m)
+	}
+
+	for _, transform := range c.transformations {
+		err := transform.Process(metrics, c.sysInfo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform metrics for transform '%s'; err: %v", transform.Name(), err)
+		}
+	}
+
+	return metrics, nil
+}
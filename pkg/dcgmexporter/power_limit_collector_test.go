@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPowerLimitCollector_GetMetrics(t *testing.T) {
+	counter := Counter{FieldName: dcgmExpPowerLimitChangesTotal, PromType: "counter"}
+
+	sysInfo := SystemInfo{
+		GPUCount: 3,
+		gOpt:     DeviceOptions{Flex: true},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i, UUID: fmt.Sprintf("GPU-%d", i)}
+	}
+
+	limits := map[uint]float64{0: 700, 1: 700}
+
+	defer func(hook func(dcgm.GroupEntityPair, uint, []dcgm.Short) ([]dcgm.FieldValue_v1, error)) {
+		dcgmLatestValuesHook = hook
+	}(dcgmLatestValuesHook)
+	dcgmLatestValuesHook = func(entity dcgm.GroupEntityPair, _ uint, _ []dcgm.Short) ([]dcgm.FieldValue_v1, error) {
+		limit, exists := limits[entity.EntityId]
+		if !exists {
+			return nil, fmt.Errorf("GPU %d is lost", entity.EntityId)
+		}
+		value := doubleFieldValue(limit)
+		value.FieldId = uint(dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT)
+		return []dcgm.FieldValue_v1{value}, nil
+	}
+
+	collector := newPowerLimitCollector(expCollector{
+		sysInfo:             sysInfo,
+		hostname:            "node",
+		config:              &Config{},
+		counter:             counter,
+		counterDeviceFields: []dcgm.Short{dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT},
+	})
+
+	changes := func() map[string]string {
+		metrics, err := collector.GetMetrics()
+		require.NoError(t, err)
+		require.Len(t, metrics[counter], 2)
+
+		values := map[string]string{}
+		for _, metric := range metrics[counter] {
+			values[metric.GPUUUID] = metric.Value
+		}
+		return values
+	}
+
+	// The first limits are not changes
+	assert.Equal(t, map[string]string{"GPU-0": "0", "GPU-1": "0"}, changes())
+
+	limits[1] = 450
+	assert.Equal(t, map[string]string{"GPU-0": "0", "GPU-1": "1"}, changes())
+	assert.Equal(t, map[string]string{"GPU-0": "0", "GPU-1": "1"}, changes())
+
+	limits[1] = 700
+	assert.Equal(t, map[string]string{"GPU-0": "0", "GPU-1": "2"}, changes())
+
+	// A blank limit is not a change
+	limits[0] = dcgm.DCGM_FT_FP64_BLANK
+	assert.Equal(t, map[string]string{"GPU-0": "0", "GPU-1": "2"}, changes())
+}
+
+func TestNewPowerLimitCollector_Disabled(t *testing.T) {
+	_, err := NewPowerLimitCollector([]Counter{{FieldName: "DCGM_FI_DEV_GPU_TEMP"}}, "node", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+const dcgmExporterProfilingMultiplexed = "DCGM_EXPORTER_PROFILING_MULTIPLEXED"
+
+// ApplyProfilingMultiplexing checks whether the profiling counters can be sampled together, DCGM reads the fields of
+// one metric group of every major group at a time and otherwise time-slices the metric groups, which scales down
+// the accuracy of the values. The fields that need multiplexing are logged, or dropped in the drop mode, and
+// DCGM_EXPORTER_PROFILING_MULTIPLEXED tells whether the sampling is multiplexed. It returns the multiplexed fields.
+func ApplyProfilingMultiplexing(cs *CounterSet, c *Config) []string {
+	fields := map[uint]bool{}
+	for _, counter := range cs.DCGMCounters {
+		if fieldID := uint(counter.FieldID); fieldID >= dcpFieldsStart && fieldID < cpuFieldsStart {
+			fields[fieldID] = true
+		}
+	}
+
+	var multiplexed []string
+	if len(fields) > 0 {
+		covered := coveringMetricGroups(fields, c.MetricGroups)
+		for _, counter := range cs.DCGMCounters {
+			if fields[uint(counter.FieldID)] && !covered[uint(counter.FieldID)] {
+				multiplexed = append(multiplexed, counter.FieldName)
+			}
+		}
+	}
+
+	if len(multiplexed) > 0 && c.ProfilingMultiplexing == ProfilingMultiplexingDrop {
+		logrus.Warnf("Dropping the profiling fields %s, they cannot be sampled with the other profiling fields",
+			strings.Join(multiplexed, ", "))
+		counters := make([]Counter, 0, len(cs.DCGMCounters))
+		for _, counter := range cs.DCGMCounters {
+			if !slices.Contains(multiplexed, counter.FieldName) {
+				counters = append(counters, counter)
+			}
+		}
+		cs.DCGMCounters = counters
+		multiplexed = nil
+	} else if len(multiplexed) > 0 {
+		logrus.Warnf("The profiling fields %s cannot be sampled with the other profiling fields, DCGM multiplexes "+
+			"them and their values are less accurate; drop them from the counters or set the drop mode",
+			strings.Join(multiplexed, ", "))
+	}
+
+	value := 0.0
+	if len(multiplexed) > 0 {
+		value = 1
+	}
+	selfMetrics.SetGauge(dcgmExporterProfilingMultiplexed,
+		"Whether DCGM multiplexes the sampling of the profiling fields, which makes their values less accurate.",
+		nil, value)
+
+	return multiplexed
+}
+
+// coveringMetricGroups returns the fields covered by the metric groups sampled together, one metric group of every
+// major group, covering the most fields; the earliest metric groups win the ties.
+func coveringMetricGroups(fields map[uint]bool, groups []dcgm.MetricGroup) map[uint]bool {
+	byMajor := map[uint][]dcgm.MetricGroup{}
+	for _, group := range groups {
+		byMajor[group.Major] = append(byMajor[group.Major], group)
+	}
+
+	majors := make([]uint, 0, len(byMajor))
+	for major := range byMajor {
+		majors = append(majors, major)
+	}
+	sort.Slice(majors, func(i, j int) bool { return majors[i] < majors[j] })
+
+	var best map[uint]bool
+	var cover func(i int, covered map[uint]bool)
+	cover = func(i int, covered map[uint]bool) {
+		if i == len(majors) {
+			if best == nil || len(covered) > len(best) {
+				best = covered
+			}
+			return
+		}
+
+		for _, group := range byMajor[majors[i]] {
+			next := make(map[uint]bool, len(covered))
+			for fieldID := range covered {
+				next[fieldID] = true
+			}
+			for _, fieldID := range group.FieldIds {
+				if fields[fieldID] {
+					next[fieldID] = true
+				}
+			}
+			cover(i+1, next)
+		}
+	}
+	cover(0, map[uint]bool{})
+
+	return best
+}
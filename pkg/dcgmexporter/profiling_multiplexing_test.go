@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyProfilingMultiplexing(t *testing.T) {
+	smActive := Counter{dcgm.DCGM_FI_PROF_SM_ACTIVE, "DCGM_FI_PROF_SM_ACTIVE", "gauge", "SM active (in %)."}
+	smOccupancy := Counter{dcgm.DCGM_FI_PROF_SM_OCCUPANCY, "DCGM_FI_PROF_SM_OCCUPANCY", "gauge", "SM occupancy."}
+	tensorActive := Counter{dcgm.DCGM_FI_PROF_PIPE_TENSOR_ACTIVE, "DCGM_FI_PROF_PIPE_TENSOR_ACTIVE", "gauge", "Tensor."}
+	dramActive := Counter{dcgm.DCGM_FI_PROF_DRAM_ACTIVE, "DCGM_FI_PROF_DRAM_ACTIVE", "gauge", "DRAM active (in %)."}
+	temp := Counter{dcgm.DCGM_FI_DEV_GPU_TEMP, "DCGM_FI_DEV_GPU_TEMP", "gauge", "GPU temperature (in C)."}
+
+	fieldIDs := func(counters ...Counter) []uint {
+		var ids []uint
+		for _, counter := range counters {
+			ids = append(ids, uint(counter.FieldID))
+		}
+		return ids
+	}
+
+	// The SM fields can be sampled with either the tensor field or the DRAM field, which share a major group
+	groups := []dcgm.MetricGroup{
+		{Major: 1, Minor: 0, FieldIds: fieldIDs(smActive, smOccupancy, tensorActive)},
+		{Major: 1, Minor: 1, FieldIds: fieldIDs(smActive, smOccupancy, dramActive)},
+		{Major: 2, Minor: 0, FieldIds: fieldIDs(dramActive)},
+	}
+
+	tests := []struct {
+		name            string
+		mode            ProfilingMultiplexing
+		groups          []dcgm.MetricGroup
+		counters        []Counter
+		wantMultiplexed []string
+		want            []Counter
+	}{
+		{
+			name:     "sampled together",
+			groups:   groups,
+			counters: []Counter{smActive, smOccupancy, dramActive, temp},
+			want:     []Counter{smActive, smOccupancy, dramActive, temp},
+		},
+		{
+			name:     "single group",
+			groups:   ProfilingMetricGroups(),
+			counters: []Counter{smActive, tensorActive, dramActive, temp},
+			want:     []Counter{smActive, tensorActive, dramActive, temp},
+		},
+		{
+			name:            "multiplexed",
+			mode:            ProfilingMultiplexingWarn,
+			groups:          groups[:2],
+			counters:        []Counter{smActive, tensorActive, dramActive, temp},
+			wantMultiplexed: []string{"DCGM_FI_PROF_DRAM_ACTIVE"},
+			want:            []Counter{smActive, tensorActive, dramActive, temp},
+		},
+		{
+			name:     "dropped",
+			mode:     ProfilingMultiplexingDrop,
+			groups:   groups[:2],
+			counters: []Counter{smActive, tensorActive, dramActive, temp},
+			want:     []Counter{smActive, tensorActive, temp},
+		},
+		{
+			name:     "no profiling fields",
+			groups:   groups,
+			counters: []Counter{temp},
+			want:     []Counter{temp},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := &CounterSet{DCGMCounters: tt.counters}
+			config := &Config{CollectDCP: true, MetricGroups: tt.groups, ProfilingMultiplexing: tt.mode}
+
+			assert.Equal(t, tt.wantMultiplexed, ApplyProfilingMultiplexing(cs, config))
+			assert.Equal(t, tt.want, cs.DCGMCounters)
+
+			value := 0.0
+			if len(tt.wantMultiplexed) > 0 {
+				value = 1
+			}
+			got, ok := selfMetrics.Value(dcgmExporterProfilingMultiplexed, nil)
+			assert.True(t, ok)
+			assert.Equal(t, value, got)
+		})
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+const (
+	dcgmExporterHTTPRequestsInFlight      = "DCGM_EXPORTER_HTTP_REQUESTS_IN_FLIGHT"
+	dcgmExporterHTTPRequestsRejectedTotal = "DCGM_EXPORTER_HTTP_REQUESTS_REJECTED_TOTAL"
+
+	rejectedInFlight  = "in_flight"
+	rejectedRateLimit = "rate_limit"
+)
+
+// rateLimitIdleTimeout is the time after which the limiter of a client that stopped sending requests is dropped.
+var rateLimitIdleTimeout = 10 * time.Minute
+
+// limitHandler bounds the requests served concurrently and the rate of the requests of every client, so that a
+// misconfigured scraper cannot trigger overlapping collections. The health and readiness endpoints are left open
+// for the probes.
+type limitHandler struct {
+	handler http.Handler
+
+	// inFlight holds a token for every request being served, it is nil when the requests are not bounded
+	inFlight chan struct{}
+
+	rateLimit rate.Limit
+	burst     int
+	// clients maps the remote addresses of the clients to their limiter
+	clientsMtx sync.Mutex
+	clients    map[string]*clientLimiter
+	prunedAt   time.Time
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newLimitHandler wraps the handler with the limits of the configuration. The handler is returned unchanged when
+// none is set.
+func newLimitHandler(c *Config, handler http.Handler) http.Handler {
+	if c.WebMaxRequestsInFlight <= 0 && c.WebClientRateLimit <= 0 {
+		return handler
+	}
+
+	h := &limitHandler{handler: handler}
+
+	if c.WebMaxRequestsInFlight > 0 {
+		h.inFlight = make(chan struct{}, c.WebMaxRequestsInFlight)
+	}
+
+	if c.WebClientRateLimit > 0 {
+		h.rateLimit = rate.Limit(c.WebClientRateLimit)
+		h.burst = max(c.WebClientRateBurst, 1)
+		h.clients = map[string]*clientLimiter{}
+		h.prunedAt = time.Now()
+	}
+
+	logrus.Infof("Limits of the HTTP server enabled, max requests in flight: %d, requests per second per client: %g, "+
+		"burst: %d", c.WebMaxRequestsInFlight, c.WebClientRateLimit, h.burst)
+
+	return h
+}
+
+func (h *limitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/health" || r.URL.Path == "/ready" {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	if h.clients != nil && !h.allow(clientAddress(r), time.Now()) {
+		rejectRequest(w, rejectedRateLimit, http.StatusTooManyRequests,
+			int(math.Ceil(1/float64(h.rateLimit))))
+		return
+	}
+
+	if h.inFlight != nil {
+		select {
+		case h.inFlight <- struct{}{}:
+			setRequestsInFlight(len(h.inFlight))
+			defer func() {
+				<-h.inFlight
+				setRequestsInFlight(len(h.inFlight))
+			}()
+		default:
+			rejectRequest(w, rejectedInFlight, http.StatusServiceUnavailable, 1)
+			return
+		}
+	}
+
+	h.handler.ServeHTTP(w, r)
+}
+
+// allow tells whether the client may send a request, and drops the limiters of the idle clients.
+func (h *limitHandler) allow(client string, now time.Time) bool {
+	h.clientsMtx.Lock()
+	defer h.clientsMtx.Unlock()
+
+	if now.Sub(h.prunedAt) > rateLimitIdleTimeout {
+		for address, limiter := range h.clients {
+			if now.Sub(limiter.lastSeen) > rateLimitIdleTimeout {
+				delete(h.clients, address)
+			}
+		}
+		h.prunedAt = now
+	}
+
+	limiter, exists := h.clients[client]
+	if !exists {
+		limiter = &clientLimiter{limiter: rate.NewLimiter(h.rateLimit, h.burst)}
+		h.clients[client] = limiter
+	}
+	limiter.lastSeen = now
+
+	return limiter.limiter.AllowN(now, 1)
+}
+
+// clientAddress returns the IP address of the client, the forwarding headers are not trusted. The clients of the
+// Unix domain socket share the same address.
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func rejectRequest(w http.ResponseWriter, reason string, code, retryAfterSeconds int) {
+	selfMetrics.AddCounter(dcgmExporterHTTPRequestsRejectedTotal,
+		"Number of requests rejected by the HTTP server, because of the requests in flight or the rate limit of the client.",
+		map[string]string{"reason": reason}, 1)
+
+	w.Header().Set("Retry-After", strconv.Itoa(max(retryAfterSeconds, 1)))
+	http.Error(w, http.StatusText(code), code)
+}
+
+func setRequestsInFlight(n int) {
+	selfMetrics.SetGauge(dcgmExporterHTTPRequestsInFlight, "Number of requests being served by the HTTP server.",
+		nil, float64(n))
+}
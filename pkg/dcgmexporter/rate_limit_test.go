@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitHandler_InFlight(t *testing.T) {
+	_, limited := newLimitHandler(&Config{}, http.NotFoundHandler()).(*limitHandler)
+	assert.False(t, limited)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" {
+			started <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := newLimitHandler(&Config{WebMaxRequestsInFlight: 1}, blocking)
+
+	labels := map[string]string{"reason": rejectedInFlight}
+	rejected, _ := selfMetrics.Value(dcgmExporterHTTPRequestsRejectedTotal, labels)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	first := httptest.NewRecorder()
+	go func() {
+		defer wg.Done()
+		handler.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	}()
+	<-started
+
+	inFlight, _ := selfMetrics.Value(dcgmExporterHTTPRequestsInFlight, nil)
+	assert.Equal(t, float64(1), inFlight)
+
+	// The scrape overlapping the first one is rejected
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	value, _ := selfMetrics.Value(dcgmExporterHTTPRequestsRejectedTotal, labels)
+	assert.Equal(t, rejected+1, value)
+
+	// The probes are not limited
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	release <- struct{}{}
+	wg.Wait()
+	assert.Equal(t, http.StatusOK, first.Code)
+
+	inFlight, _ = selfMetrics.Value(dcgmExporterHTTPRequestsInFlight, nil)
+	assert.Equal(t, float64(0), inFlight)
+}
+
+func TestLimitHandler_RateLimit(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := newLimitHandler(&Config{WebClientRateLimit: 0.5, WebClientRateBurst: 2}, next)
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		r.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, request("10.0.0.1:40000").Code)
+	assert.Equal(t, http.StatusOK, request("10.0.0.1:40001").Code)
+
+	// The client is identified by its IP address, whatever its port
+	rec := request("10.0.0.1:40002")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+
+	// The other clients have their own limit
+	assert.Equal(t, http.StatusOK, request("10.0.0.2:40000").Code)
+}
+
+func TestLimitHandler_PruneIdleClients(t *testing.T) {
+	handler := newLimitHandler(&Config{WebClientRateLimit: 1, WebClientRateBurst: 1}, http.NotFoundHandler())
+	limiter, ok := handler.(*limitHandler)
+	require.True(t, ok)
+
+	now := time.Now()
+	assert.True(t, limiter.allow("10.0.0.1", now))
+	assert.False(t, limiter.allow("10.0.0.1", now))
+
+	later := now.Add(2 * rateLimitIdleTimeout)
+	assert.True(t, limiter.allow("10.0.0.2", later))
+	assert.NotContains(t, limiter.clients, "10.0.0.1")
+	assert.Contains(t, limiter.clients, "10.0.0.2")
+}
@@ -0,0 +1,405 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+// RecordedCountersFile is the counters file written in the record directory, the replay uses it by default.
+const RecordedCountersFile = "counters.csv"
+
+var dcgmLatestValuesHook = dcgmLatestValues
+
+var recordedEntityTypes = map[dcgm.Field_Entity_Group]string{
+	dcgm.FE_GPU:      "gpu",
+	dcgm.FE_SWITCH:   "switch",
+	dcgm.FE_LINK:     "link",
+	dcgm.FE_CPU:      "cpu",
+	dcgm.FE_CPU_CORE: "cpu_core",
+}
+
+// recording holds the field values of the entities of a collector, read in a collection.
+type recording struct {
+	Time          time.Time        `json:"time"`
+	GPUDevices    DeviceOptions    `json:"gpu_devices"`
+	SwitchDevices DeviceOptions    `json:"switch_devices"`
+	CPUDevices    DeviceOptions    `json:"cpu_devices"`
+	SystemInfo    SystemInfo       `json:"system_info"`
+	Fields        []dcgm.Short     `json:"fields"`
+	Entities      []recordedEntity `json:"entities"`
+}
+
+type recordedEntity struct {
+	Entity   dcgm.GroupEntityPair `json:"entity"`
+	ParentID uint                 `json:"parent_id"`
+	Values   []recordedValue      `json:"values"`
+}
+
+type recordedValue struct {
+	FieldID   uint  `json:"field_id"`
+	FieldType uint  `json:"field_type"`
+	Status    int   `json:"status"`
+	Ts        int64 `json:"ts"`
+	// Value holds the raw bytes of the value, without the trailing zeros
+	Value []byte `json:"value"`
+	// Text is the value as it is exported, for the humans reading the recording; it is not replayed
+	Text string `json:"text"`
+}
+
+func newRecordedValue(value dcgm.FieldValue_v1) recordedValue {
+	return recordedValue{
+		FieldID:   value.FieldId,
+		FieldType: value.FieldType,
+		Status:    value.Status,
+		Ts:        value.Ts,
+		Value:     bytes.TrimRight(value.Value[:], "\x00"),
+		Text:      ToString(value),
+	}
+}
+
+func (v recordedValue) fieldValue() dcgm.FieldValue_v1 {
+	value := dcgm.FieldValue_v1{
+		FieldId:   v.FieldID,
+		FieldType: v.FieldType,
+		Status:    v.Status,
+		Ts:        v.Ts,
+	}
+	copy(value.Value[:], v.Value)
+
+	return value
+}
+
+// WriteRecordedCounters writes the counters in the record directory, so that the replay exports the same metrics.
+func WriteRecordedCounters(dir string, counters []Counter) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	for _, counter := range counters {
+		if err := w.Write([]string{counter.FieldName, counter.PromType, counter.Help}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, RecordedCountersFile), b.Bytes(), 0o644)
+}
+
+// NewRecordingCollector returns a collector constructor for the DCGM collectors writing the field values of every
+// collection in the record directory.
+func NewRecordingCollector(dir string) DCGMCollectorConstructor {
+	return func(
+		c []Counter, hostname string, config *Config, item FieldEntityGroupTypeSystemInfoItem,
+	) (*DCGMCollector, func(), error) {
+		collector, cleanup, err := NewDCGMCollector(c, hostname, config, item)
+		if err != nil {
+			return collector, cleanup, err
+		}
+
+		name, exists := recordedEntityTypes[item.SystemInfo.InfoType]
+		if !exists {
+			return collector, cleanup, nil
+		}
+
+		collector.source = &recorder{
+			dir:    dir,
+			name:   name,
+			fields: item.DeviceFields,
+			config: config,
+		}
+
+		return collector, cleanup, nil
+	}
+}
+
+// recorder reads the field values from DCGM and writes them to a file per collection.
+type recorder struct {
+	sync.Mutex
+	dir      string
+	name     string
+	fields   []dcgm.Short
+	config   *Config
+	sequence int
+	entities []recordedEntity
+}
+
+func (r *recorder) latestValues(
+	entity dcgm.GroupEntityPair, parentID uint, fields []dcgm.Short,
+) ([]dcgm.FieldValue_v1, error) {
+	values, err := dcgmLatestValuesHook(entity, parentID, fields)
+	if err != nil {
+		return values, err
+	}
+
+	recorded := recordedEntity{Entity: entity, ParentID: parentID}
+	for _, value := range values {
+		recorded.Values = append(recorded.Values, newRecordedValue(value))
+	}
+
+	r.Lock()
+	r.entities = append(r.entities, recorded)
+	r.Unlock()
+
+	return values, nil
+}
+
+func (r *recorder) collected(sysInfo SystemInfo) {
+	r.Lock()
+	defer r.Unlock()
+
+	// The entities are read concurrently, they are sorted so that the recordings don't depend on the reads
+	sort.SliceStable(r.entities, func(i, j int) bool {
+		a, b := r.entities[i], r.entities[j]
+		if a.Entity.EntityGroupId != b.Entity.EntityGroupId {
+			return a.Entity.EntityGroupId < b.Entity.EntityGroupId
+		}
+		if a.Entity.EntityId != b.Entity.EntityId {
+			return a.Entity.EntityId < b.Entity.EntityId
+		}
+		return a.ParentID < b.ParentID
+	})
+
+	rec := recording{
+		Time:       time.Now(),
+		SystemInfo: sysInfo,
+		Fields:     r.fields,
+		Entities:   r.entities,
+	}
+	if r.config != nil {
+		rec.GPUDevices = r.config.GPUDevices
+		rec.SwitchDevices = r.config.SwitchDevices
+		rec.CPUDevices = r.config.CPUDevices
+	}
+	if sysInfo.InfoType == dcgm.FE_GPU {
+		// The GPUs selected by their UUID are replayed by their indices
+		rec.GPUDevices = sysInfo.gOpt
+	}
+	r.entities = nil
+
+	filename := filepath.Join(r.dir, fmt.Sprintf("%s-%06d.json", r.name, r.sequence))
+	r.sequence++
+
+	data, err := json.Marshal(rec)
+	if err == nil {
+		err = os.WriteFile(filename, data, 0o644)
+	}
+	if err != nil {
+		logrus.WithError(err).Warnf("Cannot record the field values to '%s'", filename)
+	}
+}
+
+// NewReplayEntityGroupTypeSystemInfo returns the entities and the fields of the collectors found in the record
+// directory, the collectors that were not recorded are not replayed.
+func NewReplayEntityGroupTypeSystemInfo(
+	dir string, c []Counter, config *Config,
+) (*FieldEntityGroupTypeSystemInfo, error) {
+	e := NewEntityGroupTypeSystemInfo(c, config)
+
+	for entityType, name := range recordedEntityTypes {
+		filenames, err := recordingFiles(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		if len(filenames) == 0 {
+			continue
+		}
+
+		rec, err := readRecording(filenames[0])
+		if err != nil {
+			return nil, err
+		}
+
+		e.items[entityType] = FieldEntityGroupTypeSystemInfoItem{
+			SystemInfo:   rec.systemInfo(),
+			DeviceFields: rec.Fields,
+		}
+	}
+
+	if len(e.items) == 0 {
+		return nil, fmt.Errorf("no recording found in '%s'", dir)
+	}
+
+	return e, nil
+}
+
+// NewReplayCollector returns a collector constructor reading the field values from the recordings of the record
+// directory, in a loop.
+func NewReplayCollector(dir string) DCGMCollectorConstructor {
+	return func(
+		c []Counter, hostname string, config *Config, item FieldEntityGroupTypeSystemInfoItem,
+	) (*DCGMCollector, func(), error) {
+		if item.isEmpty() {
+			return nil, func() {}, fmt.Errorf("fieldEntityGroupTypeSystemInfo is empty")
+		}
+
+		filenames, err := recordingFiles(dir, recordedEntityTypes[item.SystemInfo.InfoType])
+		if err != nil {
+			return nil, func() {}, err
+		}
+
+		replay := &replayer{filenames: filenames}
+		if err := replay.load(); err != nil {
+			return nil, func() {}, err
+		}
+
+		collector := &DCGMCollector{
+			Counters:     c,
+			DeviceFields: item.DeviceFields,
+			SysInfo:      item.SystemInfo,
+			Hostname:     hostname,
+			source:       replay,
+		}
+
+		if config != nil {
+			collector.UseOldNamespace = config.UseOldNamespace
+			collector.ReplaceBlanksInModelName = config.ReplaceBlanksInModelName
+			collector.aggregator = newFieldAggregator(config)
+			collector.resets = newCounterResets(config)
+			collector.workers = config.CollectWorkers
+			if config.MonotonicCounters {
+				collector.Counters = monotonicCounters(c)
+			}
+			if config.EnergyCounters {
+				collector.Counters = energyCounters(collector.Counters)
+				collector.energyJoules = true
+			}
+			if config.MetricNames == MetricNamesPrometheus {
+				collector.Counters, collector.unitScales = prometheusCounters(collector.Counters)
+			}
+		}
+
+		return collector, func() {}, nil
+	}
+}
+
+// replayer returns the field values of a recording per collection, and starts again after the last one.
+type replayer struct {
+	sync.Mutex
+	filenames []string
+	next      int
+	current   recording
+}
+
+func (r *replayer) load() error {
+	r.Lock()
+	defer r.Unlock()
+
+	if len(r.filenames) == 0 {
+		return fmt.Errorf("no recording to replay")
+	}
+
+	rec, err := readRecording(r.filenames[r.next])
+	if err != nil {
+		return err
+	}
+
+	r.current = rec
+	r.next = (r.next + 1) % len(r.filenames)
+
+	return nil
+}
+
+func (r *replayer) latestValues(
+	entity dcgm.GroupEntityPair, parentID uint, fields []dcgm.Short,
+) ([]dcgm.FieldValue_v1, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	recorded := map[uint]recordedValue{}
+	for _, e := range r.current.Entities {
+		if e.Entity != entity || e.ParentID != parentID {
+			continue
+		}
+		for _, value := range e.Values {
+			recorded[value.FieldID] = value
+		}
+	}
+
+	values := make([]dcgm.FieldValue_v1, 0, len(fields))
+	for _, fieldID := range fields {
+		value, exists := recorded[uint(fieldID)]
+		if !exists {
+			// The fields that were not recorded are blank, so that they are skipped
+			value = recordedValue{FieldID: uint(fieldID), FieldType: dcgm.DCGM_FT_INT64}
+			blank := int64FieldValue(dcgm.DCGM_FT_INT64_BLANK)
+			value.Value = blank.Value[:8]
+		}
+		values = append(values, value.fieldValue())
+	}
+
+	return values, nil
+}
+
+func (r *replayer) collected(SystemInfo) {
+	if err := r.load(); err != nil {
+		logrus.WithError(err).Warn("Cannot load the next recording")
+	}
+}
+
+func (rec recording) systemInfo() SystemInfo {
+	sysInfo := rec.SystemInfo
+	sysInfo.gOpt = rec.GPUDevices
+	sysInfo.sOpt = rec.SwitchDevices
+	sysInfo.cOpt = rec.CPUDevices
+
+	return sysInfo
+}
+
+func recordingFiles(dir, name string) ([]string, error) {
+	filenames, err := filepath.Glob(filepath.Join(dir, name+"-*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(filenames)
+
+	return filenames, nil
+}
+
+func readRecording(filename string) (recording, error) {
+	var rec recording
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return rec, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rec); err != nil {
+		return rec, fmt.Errorf("invalid recording '%s'; err: %w", filename, err)
+	}
+
+	return rec, nil
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	sysOS "os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	spec, err := LoadSimulationSpec(writeSimulationSpec(t, `
+seed: 1
+gpus:
+- count: 1
+- mig:
+  - profile: 1g.10gb
+    count: 2
+fields:
+  DCGM_FI_DRIVER_VERSION: {values: [535.104.05]}
+`))
+	require.NoError(t, err)
+
+	counters := []Counter{
+		{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge", Help: "Temp"},
+		{FieldID: dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION, FieldName: "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION",
+			PromType: "counter", Help: "Energy"},
+		{FieldID: dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE, FieldName: "DCGM_FI_PROF_GR_ENGINE_ACTIVE", PromType: "gauge",
+			Help: "Activity"},
+		{FieldID: dcgm.DCGM_FI_DRIVER_VERSION, FieldName: "DCGM_FI_DRIVER_VERSION", PromType: "label"},
+	}
+	config := &Config{GPUDevices: DeviceOptions{Flex: true}}
+
+	systemInfo, err := NewSimulatedEntityGroupTypeSystemInfo(counters, config, spec)
+	require.NoError(t, err)
+	item, _ := systemInfo.Get(dcgm.FE_GPU)
+
+	// Record the values of the simulator, as DCGM is not available
+	sim := newSimulator(spec, counters)
+	defer func(hook func(dcgm.GroupEntityPair, uint, []dcgm.Short) ([]dcgm.FieldValue_v1, error)) {
+		dcgmLatestValuesHook = hook
+	}(dcgmLatestValuesHook)
+	dcgmLatestValuesHook = sim.latestValues
+
+	dir := filepath.Join(t.TempDir(), "recording")
+	require.NoError(t, WriteRecordedCounters(dir, counters))
+
+	recording := &DCGMCollector{
+		Counters:     counters,
+		DeviceFields: item.DeviceFields,
+		SysInfo:      item.SystemInfo,
+		Hostname:     "node",
+		source:       &recorder{dir: dir, name: "gpu", fields: item.DeviceFields, config: config},
+	}
+
+	var recorded []MetricsByCounter
+	for i := 0; i < 2; i++ {
+		metrics, err := recording.GetMetrics()
+		require.NoError(t, err)
+		require.Len(t, metrics[counters[0]], 3)
+		recorded = append(recorded, metrics)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "gpu-*.json"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "gpu-000000.json"), filepath.Join(dir, "gpu-000001.json")}, files)
+
+	content, err := sysOS.ReadFile(filepath.Join(dir, RecordedCountersFile))
+	require.NoError(t, err)
+	assert.Equal(t, "DCGM_FI_DEV_GPU_TEMP,gauge,Temp\nDCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION,counter,Energy\n"+
+		"DCGM_FI_PROF_GR_ENGINE_ACTIVE,gauge,Activity\nDCGM_FI_DRIVER_VERSION,label,\n", string(content))
+
+	// The replay serves the recorded values in a loop
+	replaySystemInfo, err := NewReplayEntityGroupTypeSystemInfo(dir, counters, config)
+	require.NoError(t, err)
+	replayItem, exists := replaySystemInfo.Get(dcgm.FE_GPU)
+	require.True(t, exists)
+	assert.Equal(t, item.DeviceFields, replayItem.DeviceFields)
+	assert.Equal(t, item.SystemInfo, replayItem.SystemInfo)
+
+	_, exists = replaySystemInfo.Get(dcgm.FE_SWITCH)
+	assert.False(t, exists)
+
+	replay, cleanup, err := NewReplayCollector(dir)(counters, "node", config, replayItem)
+	require.NoError(t, err)
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		metrics, err := replay.GetMetrics()
+		require.NoError(t, err)
+		assert.Equal(t, recorded[i%2], metrics)
+	}
+}
+
+func TestNewReplayEntityGroupTypeSystemInfo_NoRecording(t *testing.T) {
+	_, err := NewReplayEntityGroupTypeSystemInfo(t.TempDir(), nil, &Config{})
+	assert.ErrorContains(t, err, "no recording found")
+}
@@ -17,19 +17,21 @@
 package dcgmexporter
 
 import (
+	"context"
 	"sync"
-
-	"golang.org/x/sync/errgroup"
 )
 
 type Registry struct {
 	collectors []Collector
-	mtx        sync.RWMutex
+	// gathering is held while the collectors are gathered, until the last of them returns even if the gathering
+	// timed out, so that a collector is never called concurrently
+	gathering chan struct{}
 }
 
 func NewRegistry() *Registry {
 	return &Registry{
 		collectors: make([]Collector, 0),
+		gathering:  make(chan struct{}, 1),
 	}
 }
 
@@ -40,48 +42,63 @@ func (r *Registry) Register(c Collector) {
 
 // Gather gathers metrics from all registered collectors.
 func (r *Registry) Gather() (MetricsByCounter, error) {
-	r.mtx.Lock()
-	defer r.mtx.Unlock()
+	metrics, _, err := r.GatherContext(context.Background())
+	return metrics, err
+}
 
-	var wg sync.WaitGroup
-	wg.Add(len(r.collectors))
+// GatherContext gathers metrics from all registered collectors until the context is done. The metrics of the
+// collectors that did not return in time are left out, and the returned flag reports that the result is partial.
+func (r *Registry) GatherContext(ctx context.Context) (MetricsByCounter, bool, error) {
+	select {
+	case r.gathering <- struct{}{}:
+	case <-ctx.Done():
+		// The collectors of a previous gathering are still running
+		return MetricsByCounter{}, len(r.collectors) > 0, nil
+	}
 
-	g := new(errgroup.Group)
+	type result struct {
+		metrics MetricsByCounter
+		err     error
+	}
 
-	var sm sync.Map
+	results := make(chan result, len(r.collectors))
+
+	var wg sync.WaitGroup
+	wg.Add(len(r.collectors))
 
 	for _, c := range r.collectors {
 		c := c //creates new c, see https://golang.org/doc/faq#closures_and_goroutines
-		g.Go(func() error {
-			metrics, err := c.GetMetrics()
+		go func() {
+			defer wg.Done()
 
-			if err != nil {
-				return err
-			}
-
-			for counter, metricVals := range metrics {
-				val, _ := sm.LoadOrStore(counter, []Metric{})
-				out := val.([]Metric)
-				out = append(out, metricVals...)
-				sm.Store(counter, out)
-			}
-
-			return nil
-		})
+			metrics, err := c.GetMetrics()
+			results <- result{metrics: metrics, err: err}
+		}()
 	}
 
-	if err := g.Wait(); err != nil {
-		return nil, err
-	}
+	go func() {
+		wg.Wait()
+		<-r.gathering
+	}()
 
 	output := MetricsByCounter{}
 
-	sm.Range(func(key, value interface{}) bool {
-		output[key.(Counter)] = value.([]Metric)
-		return true // continue iteration
-	})
+	for range r.collectors {
+		select {
+		case <-ctx.Done():
+			return output, true, nil
+		case res := <-results:
+			if res.err != nil {
+				return nil, false, res.err
+			}
+
+			for counter, metricVals := range res.metrics {
+				output[counter] = append(output[counter], metricVals...)
+			}
+		}
+	}
 
-	return output, nil
+	return output, false, nil
 }
 
 // Cleanup resources of registered collectors
@@ -17,8 +17,10 @@
 package dcgmexporter
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -106,3 +108,38 @@ func TestRegistry_Gather(t *testing.T) {
 
 	}
 }
+
+type slowCollector struct {
+	delay   time.Duration
+	metrics MetricsByCounter
+}
+
+func (c *slowCollector) GetMetrics() (MetricsByCounter, error) {
+	time.Sleep(c.delay)
+	return c.metrics, nil
+}
+
+func (c *slowCollector) Cleanup() {}
+
+func TestRegistry_GatherContext(t *testing.T) {
+	fast := Counter{FieldName: "DCGM_EXP_FAST", PromType: "gauge"}
+	slow := Counter{FieldName: "DCGM_EXP_SLOW", PromType: "gauge"}
+
+	reg := NewRegistry()
+	reg.Register(&slowCollector{metrics: MetricsByCounter{fast: {{Counter: fast, Value: "1"}}}})
+	reg.Register(&slowCollector{delay: 200 * time.Millisecond, metrics: MetricsByCounter{slow: {{Counter: slow}}}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	got, truncated, err := reg.GatherContext(ctx)
+	require.NoError(t, err)
+	require.True(t, truncated)
+	require.Equal(t, MetricsByCounter{fast: {{Counter: fast, Value: "1"}}}, got)
+
+	// The gathering waits for the collectors of the timed out gathering
+	got, truncated, err = reg.GatherContext(context.Background())
+	require.NoError(t, err)
+	require.False(t, truncated)
+	require.Len(t, got, 2)
+}
@@ -0,0 +1,386 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	"sigs.k8s.io/yaml"
+)
+
+type RelabelAction string
+
+const (
+	RelabelActionRename     RelabelAction = "rename"
+	RelabelActionDropLabels RelabelAction = "drop_labels"
+	RelabelActionAddLabels  RelabelAction = "add_labels"
+	RelabelActionReplace    RelabelAction = "replace"
+	RelabelActionDrop       RelabelAction = "drop"
+)
+
+var (
+	metricNameRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRegex  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// relabelConfig is the format of the relabel config file.
+type relabelConfig struct {
+	Rules []relabelRuleConfig `json:"rules"`
+}
+
+type relabelRuleConfig struct {
+	Action RelabelAction `json:"action"`
+	// Metric and Match select the series the rule applies to, all the series by default
+	Metric string            `json:"metric"`
+	Match  map[string]string `json:"match"`
+
+	// Name is the new name of the metric of the rename action
+	Name string `json:"name"`
+	// Labels are the labels removed by the drop_labels action
+	Labels []string `json:"labels"`
+	// StaticLabels are the labels set by the add_labels action
+	StaticLabels map[string]string `json:"static_labels"`
+	// SourceLabel, Regex, Replacement and TargetLabel configure the replace action
+	SourceLabel string  `json:"source_label"`
+	Regex       string  `json:"regex"`
+	Replacement *string `json:"replacement"`
+	TargetLabel string  `json:"target_label"`
+}
+
+type relabelRule struct {
+	action RelabelAction
+	metric *regexp.Regexp
+	match  map[string]*regexp.Regexp
+
+	name         string
+	labels       []string
+	staticLabels map[string]string
+	sourceLabel  string
+	regex        *regexp.Regexp
+	replacement  string
+	targetLabel  string
+}
+
+// MetricRelabeler applies the rules of the relabel config to the GPU metrics, in order, to reduce their
+// cardinality before they are exported.
+type MetricRelabeler struct {
+	rules []relabelRule
+}
+
+// NewMetricRelabeler loads the rules of the relabel config file.
+func NewMetricRelabeler(c *Config) (*MetricRelabeler, error) {
+	file, err := os.Open(c.RelabelConfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not open relabel config '%s'; err: %w", c.RelabelConfig, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read relabel config '%s'; err: %w", c.RelabelConfig, err)
+	}
+
+	var config relabelConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("could not parse relabel config '%s'; err: %w", c.RelabelConfig, err)
+	}
+
+	relabeler := &MetricRelabeler{}
+
+	for i, ruleConfig := range config.Rules {
+		rule, err := newRelabelRule(ruleConfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %d of relabel config '%s'; err: %w", i, c.RelabelConfig, err)
+		}
+		relabeler.rules = append(relabeler.rules, rule)
+	}
+
+	return relabeler, nil
+}
+
+// anchoredRegexp compiles the expression so that it matches whole values, like Prometheus relabeling.
+func anchoredRegexp(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + expr + ")$")
+}
+
+func newRelabelRule(c relabelRuleConfig) (relabelRule, error) {
+	rule := relabelRule{
+		action:       c.Action,
+		name:         c.Name,
+		labels:       c.Labels,
+		staticLabels: c.StaticLabels,
+		sourceLabel:  c.SourceLabel,
+		targetLabel:  c.TargetLabel,
+		match:        map[string]*regexp.Regexp{},
+	}
+
+	var err error
+
+	if c.Metric != "" {
+		rule.metric, err = anchoredRegexp(c.Metric)
+		if err != nil {
+			return rule, fmt.Errorf("invalid metric regex '%s'; err: %w", c.Metric, err)
+		}
+	}
+
+	for label, expr := range c.Match {
+		rule.match[label], err = anchoredRegexp(expr)
+		if err != nil {
+			return rule, fmt.Errorf("invalid regex '%s' for label '%s'; err: %w", expr, label, err)
+		}
+	}
+
+	switch c.Action {
+	case RelabelActionRename:
+		if !metricNameRegex.MatchString(c.Name) {
+			return rule, fmt.Errorf("invalid metric name '%s'", c.Name)
+		}
+	case RelabelActionDropLabels:
+		if len(c.Labels) == 0 {
+			return rule, fmt.Errorf("no labels to drop")
+		}
+	case RelabelActionAddLabels:
+		if len(c.StaticLabels) == 0 {
+			return rule, fmt.Errorf("no labels to add")
+		}
+		for label := range c.StaticLabels {
+			if !labelNameRegex.MatchString(label) {
+				return rule, fmt.Errorf("invalid label name '%s'", label)
+			}
+		}
+	case RelabelActionReplace:
+		if c.SourceLabel == "" {
+			return rule, fmt.Errorf("no source label")
+		}
+		if rule.targetLabel == "" {
+			rule.targetLabel = c.SourceLabel
+		}
+		if !labelNameRegex.MatchString(rule.targetLabel) {
+			return rule, fmt.Errorf("invalid target label '%s'", rule.targetLabel)
+		}
+
+		expr := c.Regex
+		if expr == "" {
+			expr = "(.*)"
+		}
+		rule.regex, err = anchoredRegexp(expr)
+		if err != nil {
+			return rule, fmt.Errorf("invalid regex '%s'; err: %w", expr, err)
+		}
+
+		rule.replacement = "$1"
+		if c.Replacement != nil {
+			rule.replacement = *c.Replacement
+		}
+	case RelabelActionDrop:
+		if rule.metric == nil && len(rule.match) == 0 {
+			return rule, fmt.Errorf("drop rules require a metric or match selector")
+		}
+	default:
+		return rule, fmt.Errorf("unknown action '%s'; possible values: '%s', '%s', '%s', '%s', '%s'", c.Action,
+			RelabelActionRename, RelabelActionDropLabels, RelabelActionAddLabels, RelabelActionReplace,
+			RelabelActionDrop)
+	}
+
+	return rule, nil
+}
+
+func (r *MetricRelabeler) Name() string {
+	return "relabeler"
+}
+
+func (r *MetricRelabeler) Process(metrics MetricsByCounter, _ SystemInfo) error {
+	for _, rule := range r.rules {
+		// The counters are collected first, renaming adds counters to the map
+		var counters []Counter
+		for counter := range metrics {
+			if rule.metric == nil || rule.metric.MatchString(counter.FieldName) {
+				counters = append(counters, counter)
+			}
+		}
+
+		for _, counter := range counters {
+			kept, renamed := rule.apply(metrics[counter])
+
+			if len(kept) > 0 {
+				metrics[counter] = kept
+			} else {
+				delete(metrics, counter)
+			}
+
+			if len(renamed) > 0 {
+				target := renamedCounter(metrics, counter, rule.name)
+				for i := range renamed {
+					renamed[i].Counter = target
+				}
+				metrics[target] = append(metrics[target], renamed...)
+			}
+		}
+	}
+
+	return nil
+}
+
+// apply applies the rule to the metrics of a counter, it returns the metrics to keep under the counter and
+// the metrics to rename.
+func (rule relabelRule) apply(metrics []Metric) (kept, renamed []Metric) {
+	kept = make([]Metric, 0, len(metrics))
+
+	for _, metric := range metrics {
+		if !rule.matches(metric) {
+			kept = append(kept, metric)
+			continue
+		}
+
+		switch rule.action {
+		case RelabelActionDrop:
+			continue
+		case RelabelActionRename:
+			renamed = append(renamed, metric)
+			continue
+		case RelabelActionDropLabels:
+			for _, label := range rule.labels {
+				setMetricLabel(&metric, label, "")
+			}
+		case RelabelActionAddLabels:
+			for label, value := range rule.staticLabels {
+				setMetricLabel(&metric, label, value)
+			}
+		case RelabelActionReplace:
+			value, _ := metricLabel(metric, rule.sourceLabel)
+			if match := rule.regex.FindStringSubmatchIndex(value); match != nil {
+				replaced := rule.regex.ExpandString(nil, rule.replacement, value, match)
+				setMetricLabel(&metric, rule.targetLabel, string(replaced))
+			}
+		}
+
+		kept = append(kept, metric)
+	}
+
+	return kept, renamed
+}
+
+// renamedCounter returns the counter of the metrics renamed to name, merging them into an existing counter
+// of that name so that the family is exported once.
+func renamedCounter(metrics MetricsByCounter, counter Counter, name string) Counter {
+	for existing := range metrics {
+		if existing.FieldName == name {
+			return existing
+		}
+	}
+
+	counter.FieldName = name
+	return counter
+}
+
+func (rule relabelRule) matches(metric Metric) bool {
+	for label, regex := range rule.match {
+		value, _ := metricLabel(metric, label)
+		if !regex.MatchString(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// metricLabel returns the value of a label of the metric, as rendered in the exposition format.
+func metricLabel(metric Metric, label string) (string, bool) {
+	switch label {
+	case "gpu":
+		return metric.GPU, true
+	case metric.UUID:
+		return metric.GPUUUID, true
+	case "pci_bus_id":
+		return metric.GPUPCIBusID, true
+	case "device":
+		return metric.GPUDevice, true
+	case "modelName":
+		return metric.GPUModelName, true
+	case "GPU_I_PROFILE":
+		return metric.MigProfile, true
+	case "GPU_I_ID":
+		return metric.GPUInstanceID, true
+	case "GPU_CI_ID":
+		return metric.ComputeInstanceID, true
+	case "Hostname":
+		return metric.Hostname, true
+	}
+
+	if value, exists := metric.Attributes[label]; exists {
+		return value, true
+	}
+
+	value, exists := metric.Labels[label]
+	return value, exists
+}
+
+// setMetricLabel sets a label of the metric, an empty value removes it. Device labels are always rendered,
+// an empty value is equivalent to a missing label for Prometheus.
+func setMetricLabel(metric *Metric, label, value string) {
+	switch label {
+	case "gpu":
+		metric.GPU = value
+		return
+	case metric.UUID:
+		metric.GPUUUID = value
+		return
+	case "pci_bus_id":
+		metric.GPUPCIBusID = value
+		return
+	case "device":
+		metric.GPUDevice = value
+		return
+	case "modelName":
+		metric.GPUModelName = value
+		return
+	case "GPU_I_PROFILE":
+		metric.MigProfile = value
+		return
+	case "GPU_I_ID":
+		metric.GPUInstanceID = value
+		return
+	case "GPU_CI_ID":
+		metric.ComputeInstanceID = value
+		return
+	case "Hostname":
+		metric.Hostname = value
+		return
+	}
+
+	// The label maps may be shared between the copies of a metric
+	labels := make(map[string]string, len(metric.Labels))
+	for k, v := range metric.Labels {
+		if k != label {
+			labels[k] = v
+		}
+	}
+	metric.Labels = labels
+
+	attributes := make(map[string]string, len(metric.Attributes)+1)
+	for k, v := range metric.Attributes {
+		if k != label {
+			attributes[k] = v
+		}
+	}
+	if value != "" {
+		attributes[label] = value
+	}
+	metric.Attributes = attributes
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMetricRelabeler(t *testing.T, config string) (*MetricRelabeler, error) {
+	t.Helper()
+
+	tmpDir, cleanup := CreateTmpDir(t)
+	t.Cleanup(cleanup)
+
+	configFile, err := os.CreateTemp(tmpDir, "relabel*.yaml")
+	require.NoError(t, err)
+	_, err = configFile.WriteString(config)
+	require.NoError(t, err)
+	require.NoError(t, configFile.Close())
+
+	return NewMetricRelabeler(&Config{RelabelConfig: configFile.Name()})
+}
+
+func TestMetricRelabeler_Process(t *testing.T) {
+	relabeler, err := newTestMetricRelabeler(t, `
+rules:
+- action: drop
+  metric: DCGM_FI_DEV_.*_CLOCK
+- action: drop
+  match:
+    namespace: kube-system
+- action: rename
+  metric: DCGM_FI_DEV_GPU_UTIL
+  name: gpu_utilization
+- action: drop_labels
+  labels: [pci_bus_id, modelName, pod]
+- action: add_labels
+  static_labels:
+    cluster: east
+- action: replace
+  source_label: Hostname
+  regex: (.*)\.example\.com
+  target_label: node
+- action: replace
+  source_label: device
+  regex: nvidia([0-9]+)
+  replacement: gpu$1
+`)
+	require.NoError(t, err)
+
+	util := Counter{FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge", Help: "GPU utilization (in %)."}
+	temp := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge", Help: "GPU temperature (in C)."}
+	clock := Counter{FieldName: "DCGM_FI_DEV_SM_CLOCK", PromType: "gauge", Help: "SM clock frequency (in MHz)."}
+
+	attributes := map[string]string{podAttribute: "train-0", namespaceAttribute: "default"}
+
+	metrics := MetricsByCounter{
+		util: {
+			{
+				Counter: util, GPU: "0", GPUUUID: "GPU-0", GPUDevice: "nvidia0", GPUPCIBusID: "00000000:01:00.0",
+				GPUModelName: "NVIDIA A100", Hostname: "node-0.example.com", UUID: "UUID", Value: "42",
+				Attributes: attributes,
+			},
+			{
+				Counter: util, GPU: "1", GPUUUID: "GPU-1", GPUDevice: "nvidia1", Hostname: "node-0.example.com",
+				UUID: "UUID", Value: "0",
+				Attributes: map[string]string{podAttribute: "dcgm", namespaceAttribute: "kube-system"},
+			},
+		},
+		temp: {
+			{
+				Counter: temp, GPU: "0", GPUUUID: "GPU-0", GPUDevice: "nvidia0", Hostname: "localhost",
+				UUID: "UUID", Value: "40", Attributes: attributes,
+			},
+		},
+		clock: {
+			{Counter: clock, GPU: "0", GPUUUID: "GPU-0", UUID: "UUID", Value: "1410"},
+		},
+	}
+
+	require.NoError(t, relabeler.Process(metrics, SystemInfo{}))
+
+	renamed := util
+	renamed.FieldName = "gpu_utilization"
+
+	require.Len(t, metrics, 2)
+	require.Len(t, metrics[renamed], 1)
+	require.Len(t, metrics[temp], 1)
+
+	utilMetric := metrics[renamed][0]
+	assert.Equal(t, renamed, utilMetric.Counter)
+	assert.Equal(t, "gpu0", utilMetric.GPUDevice)
+	assert.Empty(t, utilMetric.GPUPCIBusID)
+	assert.Empty(t, utilMetric.GPUModelName)
+	assert.Equal(t, map[string]string{
+		namespaceAttribute: "default",
+		"cluster":          "east",
+		"node":             "node-0",
+	}, utilMetric.Attributes)
+
+	tempMetric := metrics[temp][0]
+	assert.Equal(t, map[string]string{namespaceAttribute: "default", "cluster": "east"}, tempMetric.Attributes)
+
+	// The attributes shared between the metrics are not modified
+	assert.Equal(t, map[string]string{podAttribute: "train-0", namespaceAttribute: "default"}, attributes)
+}
+
+func TestMetricRelabeler_RenameMerge(t *testing.T) {
+	relabeler, err := newTestMetricRelabeler(t, `
+rules:
+- action: rename
+  metric: DCGM_FI_DEV_FB_USED|DCGM_FI_DEV_FB_FREE
+  name: DCGM_FI_DEV_FB_USED
+`)
+	require.NoError(t, err)
+
+	used := Counter{FieldName: "DCGM_FI_DEV_FB_USED", PromType: "gauge", Help: "Framebuffer memory used (in MiB)."}
+	free := Counter{FieldName: "DCGM_FI_DEV_FB_FREE", PromType: "gauge", Help: "Framebuffer memory free (in MiB)."}
+
+	metrics := MetricsByCounter{
+		used: {{Counter: used, GPU: "0", Value: "10"}},
+		free: {{Counter: free, GPU: "0", Value: "20"}},
+	}
+
+	require.NoError(t, relabeler.Process(metrics, SystemInfo{}))
+
+	require.Len(t, metrics, 1)
+	require.Len(t, metrics[used], 2)
+	for _, metric := range metrics[used] {
+		assert.Equal(t, used, metric.Counter)
+	}
+}
+
+func TestNewMetricRelabeler_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{
+			name:   "unknown action",
+			config: "rules:\n- action: keep\n",
+		},
+		{
+			name:   "unknown field",
+			config: "rules:\n- action: drop\n  metrics: DCGM_FI_DEV_GPU_TEMP\n",
+		},
+		{
+			name:   "drop without selector",
+			config: "rules:\n- action: drop\n",
+		},
+		{
+			name:   "invalid metric name",
+			config: "rules:\n- action: rename\n  name: gpu-util\n",
+		},
+		{
+			name:   "invalid regex",
+			config: "rules:\n- action: replace\n  source_label: pod\n  regex: \"(\"\n",
+		},
+		{
+			name:   "invalid label name",
+			config: "rules:\n- action: add_labels\n  static_labels:\n    k8s.cluster: east\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTestMetricRelabeler(t, tt.config)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := NewMetricRelabeler(&Config{RelabelConfig: "/does/not/exist"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+// reloadPollInterval is the interval at which the collectors file is checked for changes.
+var reloadPollInterval = 5 * time.Second
+
+// Reloader requests the reload of the exporter when the collectors file changes or on POST /-/reload. The counters
+// are parsed before requesting the reload, so that an invalid file keeps the running counters.
+type Reloader struct {
+	config *Config
+	// C receives the reload requests
+	C chan struct{}
+
+	// validate parses the counters, it is replaced in tests
+	validate func(*Config) error
+}
+
+func NewReloader(c *Config) *Reloader {
+	return &Reloader{
+		config: c,
+		C:      make(chan struct{}, 1),
+		validate: func(c *Config) error {
+			_, err := GetCounterSet(c)
+			return err
+		},
+	}
+}
+
+// Request validates the counters and requests the reload.
+func (r *Reloader) Request() error {
+	if err := r.validate(r.config); err != nil {
+		return fmt.Errorf("invalid counters, keeping the running configuration; err: %w", err)
+	}
+
+	select {
+	case r.C <- struct{}{}:
+	default:
+		// A reload is already pending
+	}
+
+	return nil
+}
+
+// Watch requests the reload when the modification time or the size of the collectors files, or of the files they
+// include, changes.
+func (r *Reloader) Watch(stop chan interface{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	if len(collectorsFiles(r.config)) == 0 {
+		// The counters of the built-in profile don't change
+		return
+	}
+
+	if _, err := os.Stat(r.config.CollectorsFile); err != nil {
+		logrus.WithError(err).Warnf("Unable to watch the collectors file '%s'", r.config.CollectorsFile)
+		return
+	}
+
+	stamps := r.fileStamps()
+
+	t := time.NewTicker(reloadPollInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			current := r.fileStamps()
+
+			var changed []string
+			for file, stamp := range current {
+				if previous, exists := stamps[file]; !exists || previous != stamp {
+					changed = append(changed, file)
+				}
+			}
+			for file := range stamps {
+				if _, exists := current[file]; !exists {
+					changed = append(changed, file)
+				}
+			}
+			if len(changed) == 0 {
+				continue
+			}
+			stamps = current
+
+			sort.Strings(changed)
+			logrus.Infof("The collectors files '%s' changed, reloading", strings.Join(changed, "', '"))
+			if err := r.Request(); err != nil {
+				logrus.WithError(err).Error("Unable to reload the collectors file")
+			}
+		}
+	}
+}
+
+// fileStamp is the modification time and the size of a file, a change of either triggers a reload.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// fileStamps returns the stamps of the collectors files and of their includes, the files that cannot be read are
+// left out.
+func (r *Reloader) fileStamps() map[string]fileStamp {
+	stamps := map[string]fileStamp{}
+
+	for _, file := range CounterFiles(collectorsFiles(r.config)) {
+		info, err := os.Stat(file)
+		if err != nil {
+			logrus.WithError(err).Warnf("Unable to read the collectors file '%s'", file)
+			continue
+		}
+		stamps[file] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	return stamps
+}
+
+// DefaultMIGRefreshInterval is the default interval at which the MIG instances are checked for changes.
+const DefaultMIGRefreshInterval = 30 * time.Second
+
+// migEntity identifies a GPU or compute instance by its parent and the profile it was created with, as DCGM reuses
+// the entity IDs of the destroyed instances.
+type migEntity struct {
+	Entity dcgm.GroupEntityPair
+	Parent dcgm.GroupEntityPair
+	Info   dcgm.MigEntityInfo
+}
+
+// newMIGEntity leaves the UUID of the GPU out of the info, as the system info completes it when DCGM doesn't
+// report it, and the parent already identifies the GPU.
+func newMIGEntity(entity, parent dcgm.GroupEntityPair, info dcgm.MigEntityInfo) migEntity {
+	info.GpuUuid = ""
+	return migEntity{Entity: entity, Parent: parent, Info: info}
+}
+
+// migTopology returns the GPU and compute instances of the system info.
+func migTopology(sysInfo SystemInfo) map[migEntity]bool {
+	topology := map[migEntity]bool{}
+
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		gpu := dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU, EntityId: sysInfo.GPUs[i].DeviceInfo.GPU}
+		for _, gi := range sysInfo.GPUs[i].GPUInstances {
+			instance := dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU_I, EntityId: gi.EntityId}
+			topology[newMIGEntity(instance, gpu, gi.Info)] = true
+
+			for _, ci := range gi.ComputeInstances {
+				entity := dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU_CI, EntityId: ci.EntityId}
+				topology[newMIGEntity(entity, instance, ci.InstanceInfo)] = true
+			}
+		}
+	}
+
+	return topology
+}
+
+// currentMIGTopology returns the GPU and compute instances known to DCGM.
+func currentMIGTopology() (map[migEntity]bool, error) {
+	hierarchy, err := dcgmGetGpuInstanceHierarchy()
+	if err != nil {
+		return nil, err
+	}
+
+	topology := map[migEntity]bool{}
+	for i := uint(0); i < hierarchy.Count; i++ {
+		info := hierarchy.EntityList[i]
+		topology[newMIGEntity(info.Entity, info.Parent, info.Info)] = true
+	}
+
+	return topology, nil
+}
+
+// WatchGPUInstances requests the reload when the MIG instances differ from the ones of the system info, so that the
+// field groups are created again for the instances created at runtime and the destroyed ones are no longer exported.
+func (r *Reloader) WatchGPUInstances(sysInfo SystemInfo, stop chan interface{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	expected := migTopology(sysInfo)
+
+	t := time.NewTicker(time.Duration(r.config.MIGRefreshInterval) * time.Millisecond)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			topology, err := currentMIGTopology()
+			if err != nil {
+				logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(), "Unable to read the MIG instances")
+				continue
+			}
+
+			if maps.Equal(topology, expected) {
+				continue
+			}
+
+			logSampled(nil, logrus.InfoLevel, "", "The MIG instances changed, reloading")
+			if err := r.Request(); err != nil {
+				logSampled(logrus.WithError(err), logrus.ErrorLevel, err.Error(), "Unable to reload the MIG instances")
+			}
+		}
+	}
+}
+
+// HandleReload serves the POST /-/reload endpoint.
+func (r *Reloader) HandleReload(w http.ResponseWriter, _ *http.Request) {
+	if err := r.Request(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleReload serves the endpoint reloading the exporter.
+func (s *MetricsServer) HandleReload(reloader *Reloader) {
+	s.router.HandleFunc("/-/reload", reloader.HandleReload).Methods(http.MethodPost)
+}
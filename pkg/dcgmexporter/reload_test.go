@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	sysOS "os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloader_HandleReload(t *testing.T) {
+	server, _, err := NewMetricsServer(&Config{}, nil, NewRegistry())
+	require.NoError(t, err)
+
+	reloader := NewReloader(&Config{})
+	server.HandleReload(reloader)
+
+	var validateErr error
+	reloader.validate = func(*Config) error {
+		return validateErr
+	}
+
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, reloader.C, 1)
+
+	// The pending reload is not requested twice
+	rec = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	<-reloader.C
+
+	validateErr = errors.New("could not find DCGM field")
+	rec = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "could not find DCGM field")
+	assert.Empty(t, reloader.C)
+
+	rec = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/-/reload", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestReloader_Watch(t *testing.T) {
+	defer func(interval time.Duration) {
+		reloadPollInterval = interval
+	}(reloadPollInterval)
+	reloadPollInterval = 10 * time.Millisecond
+
+	collectorsFile := filepath.Join(t.TempDir(), "counters.csv")
+	require.NoError(t, sysOS.WriteFile(collectorsFile, []byte("DCGM_FI_DEV_GPU_TEMP, gauge, GPU temperature (in C).\n"), 0o644))
+
+	reloader := NewReloader(&Config{CollectorsFile: collectorsFile})
+	reloader.validate = func(*Config) error {
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan interface{})
+	wg.Add(1)
+	go reloader.Watch(stop, &wg)
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	select {
+	case <-reloader.C:
+		t.Fatal("reload requested for an unchanged file")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, sysOS.WriteFile(collectorsFile, []byte("DCGM_FI_DEV_POWER_USAGE, gauge, Power draw (in W).\n"), 0o644))
+
+	select {
+	case <-reloader.C:
+	case <-time.After(time.Second):
+		t.Fatal("reload not requested for the changed file")
+	}
+}
+
+func TestReloader_WatchGPUInstances(t *testing.T) {
+	// DCGM doesn't report the UUID of the GPU of the instances, which the system info completes
+	gi := dcgm.MigHierarchyInfo_v2{
+		Entity: dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU_I, EntityId: 1},
+		Parent: dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU, EntityId: 0},
+		Info:   dcgm.MigEntityInfo{NvmlInstanceId: 1, NvmlMigProfileId: 9, NvmlProfileSlices: 3},
+	}
+	ci := dcgm.MigHierarchyInfo_v2{
+		Entity: dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU_CI, EntityId: 1},
+		Parent: gi.Entity,
+		Info:   dcgm.MigEntityInfo{NvmlInstanceId: 1, NvmlMigProfileId: 2, NvmlProfileSlices: 3},
+	}
+
+	var sysInfo SystemInfo
+	sysInfo.GPUCount = 1
+	sysInfo.GPUs[0].DeviceInfo.UUID = "GPU-0"
+	sysInfo.GPUs[0].GPUInstances = []GPUInstanceInfo{{
+		Info:             gi.Info,
+		EntityId:         gi.Entity.EntityId,
+		ProfileName:      "3g.40gb",
+		ComputeInstances: []ComputeInstanceInfo{{InstanceInfo: ci.Info, EntityId: ci.Entity.EntityId}},
+	}}
+	NormalizeMigInfo(&sysInfo)
+	require.Equal(t, "GPU-0", sysInfo.GPUs[0].GPUInstances[0].Info.GpuUuid)
+
+	var (
+		mu        sync.Mutex
+		hierarchy = dcgm.MigHierarchy_v2{Count: 2}
+	)
+	hierarchy.EntityList[0], hierarchy.EntityList[1] = gi, ci
+
+	defer func() {
+		dcgmGetGpuInstanceHierarchy = dcgm.GetGpuInstanceHierarchy
+	}()
+	dcgmGetGpuInstanceHierarchy = func() (dcgm.MigHierarchy_v2, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return hierarchy, nil
+	}
+
+	reloader := NewReloader(&Config{MIGRefreshInterval: 10})
+	reloader.validate = func(*Config) error {
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan interface{})
+	wg.Add(1)
+	go reloader.WatchGPUInstances(sysInfo, stop, &wg)
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	select {
+	case <-reloader.C:
+		t.Fatal("reload requested for unchanged MIG instances")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The GPU instance is created again with another profile, under the same entity ID
+	mu.Lock()
+	hierarchy.Count = 1
+	hierarchy.EntityList[0].Info.NvmlMigProfileId = 5
+	mu.Unlock()
+
+	select {
+	case <-reloader.C:
+	case <-time.After(time.Second):
+		t.Fatal("reload not requested for the changed MIG instances")
+	}
+}
@@ -0,0 +1,379 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avast/retry-go/v4"
+	"github.com/klauspost/compress/snappy"
+	dto "github.com/prometheus/client_model/go"
+	promconfig "github.com/prometheus/common/config"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	dcgmExporterRemoteWriteSamplesTotal  = "DCGM_EXPORTER_REMOTE_WRITE_SAMPLES_TOTAL"
+	dcgmExporterRemoteWriteFailuresTotal = "DCGM_EXPORTER_REMOTE_WRITE_FAILURES_TOTAL"
+
+	remoteWriteVersion = "0.1.0"
+
+	// remoteWriteStaleNaN is the value Prometheus uses to mark a series as stale
+	remoteWriteStaleNaN uint64 = 0x7ff0000000000002
+)
+
+var (
+	remoteWriteTimeout    = 30 * time.Second
+	remoteWriteMinBackoff = 500 * time.Millisecond
+	remoteWriteMaxBackoff = 30 * time.Second
+)
+
+// RemoteWriter pushes the exported metrics to a Prometheus remote_write endpoint on every collection
+// interval, for nodes that can't be scraped.
+type RemoteWriter struct {
+	url        string
+	client     *http.Client
+	source     func(w io.Writer) error
+	interval   time.Duration
+	maxRetries uint
+	// pushed holds the labels of the series of the last successful push, by series key
+	pushed map[string][]remoteWriteLabel
+}
+
+// NewRemoteWriter creates a RemoteWriter pushing the metrics written by source.
+func NewRemoteWriter(c *Config, source func(w io.Writer) error) (*RemoteWriter, error) {
+	if _, err := url.ParseRequestURI(c.RemoteWriteURL); err != nil {
+		return nil, fmt.Errorf("invalid remote write URL '%s'; err: %w", c.RemoteWriteURL, err)
+	}
+
+	httpConfig := promconfig.HTTPClientConfig{
+		BearerTokenFile: c.RemoteWriteBearerTokenFile,
+		TLSConfig: promconfig.TLSConfig{
+			CAFile:   c.RemoteWriteTLSCAFile,
+			CertFile: c.RemoteWriteTLSCertFile,
+			KeyFile:  c.RemoteWriteTLSKeyFile,
+		},
+	}
+
+	if c.RemoteWriteUsername != "" {
+		httpConfig.BasicAuth = &promconfig.BasicAuth{
+			Username:     c.RemoteWriteUsername,
+			PasswordFile: c.RemoteWritePasswordFile,
+		}
+	}
+
+	if err := httpConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid remote write configuration; err: %w", err)
+	}
+
+	client, err := promconfig.NewClientFromConfig(httpConfig, "dcgm-exporter")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create remote write client; err: %w", err)
+	}
+	client.Timeout = remoteWriteTimeout
+
+	return &RemoteWriter{
+		url:        c.RemoteWriteURL,
+		client:     client,
+		source:     source,
+		interval:   time.Millisecond * time.Duration(c.CollectInterval),
+		maxRetries: c.RemoteWriteMaxRetries,
+	}, nil
+}
+
+func (r *RemoteWriter) Run(stop chan interface{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	logrus.Infof("Pushing metrics to '%s'", r.url)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			if err := r.push(ctx); err != nil && ctx.Err() == nil {
+				logrus.WithError(err).Warn("Failed to push metrics")
+			}
+		}
+	}
+}
+
+// push sends the current metrics, retrying with an exponential backoff on network and server errors.
+func (r *RemoteWriter) push(ctx context.Context) error {
+	var buf bytes.Buffer
+	if err := r.source(&buf); err != nil {
+		return err
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(&buf)
+	if err != nil {
+		return fmt.Errorf("failed to parse metrics; err: %w", err)
+	}
+
+	now := time.Now().UnixMilli()
+	series := toTimeSeries(families, now)
+
+	current := make(map[string][]remoteWriteLabel, len(series))
+	for _, s := range series {
+		current[remoteWriteSeriesKey(s.labels)] = s.labels
+	}
+
+	// Series that disappeared since the last push, e.g. of a destroyed MIG instance, are marked stale so
+	// queries stop returning them right away rather than after the lookback delta.
+	series = append(series, staleSeries(r.pushed, current, now)...)
+	if len(series) == 0 {
+		return nil
+	}
+
+	body := snappy.Encode(nil, encodeWriteRequest(series))
+
+	err = retry.Do(
+		func() error {
+			return r.send(ctx, body)
+		},
+		retry.Context(ctx),
+		retry.Attempts(r.maxRetries+1),
+		retry.Delay(remoteWriteMinBackoff),
+		retry.MaxDelay(remoteWriteMaxBackoff),
+		retry.DelayType(retry.BackOffDelay),
+		retry.LastErrorOnly(true),
+		retry.OnRetry(func(n uint, err error) {
+			logrus.WithError(err).Debugf("Retrying remote write, attempt %d", n+1)
+		}),
+	)
+	if err != nil {
+		selfMetrics.AddCounter(dcgmExporterRemoteWriteFailuresTotal,
+			"Number of remote write requests that failed after all retries.", nil, 1)
+		return err
+	}
+
+	selfMetrics.AddCounter(dcgmExporterRemoteWriteSamplesTotal,
+		"Number of samples pushed to the remote write endpoint.", nil, float64(len(series)))
+
+	r.pushed = current
+
+	return nil
+}
+
+// staleSeries returns a stale marker for every pushed series missing from the current ones.
+func staleSeries(pushed, current map[string][]remoteWriteLabel, timestamp int64) []remoteWriteSeries {
+	var keys []string
+	for key := range pushed {
+		if _, exists := current[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	stale := make([]remoteWriteSeries, 0, len(keys))
+	for _, key := range keys {
+		stale = append(stale, remoteWriteSeries{
+			labels:    pushed[key],
+			value:     math.Float64frombits(remoteWriteStaleNaN),
+			timestamp: timestamp,
+		})
+	}
+
+	return stale
+}
+
+func remoteWriteSeriesKey(labels []remoteWriteLabel) string {
+	var sb strings.Builder
+	for _, label := range labels {
+		sb.WriteString(label.name)
+		sb.WriteByte(0xff)
+		sb.WriteString(label.value)
+		sb.WriteByte(0xff)
+	}
+
+	return sb.String()
+}
+
+func (r *RemoteWriter) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return retry.Unrecoverable(err)
+	}
+
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "dcgm-exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote write returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(msg))
+
+	// Client errors, except throttling, won't succeed on retry
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return retry.Unrecoverable(err)
+	}
+
+	return err
+}
+
+type remoteWriteLabel struct {
+	name  string
+	value string
+}
+
+type remoteWriteSeries struct {
+	labels    []remoteWriteLabel
+	value     float64
+	timestamp int64
+}
+
+// toTimeSeries flattens the metric families into one series per sample, histograms and summaries are
+// expanded like in the text exposition format.
+func toTimeSeries(families map[string]*dto.MetricFamily, timestamp int64) []remoteWriteSeries {
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var series []remoteWriteSeries
+
+	for _, name := range names {
+		family := families[name]
+
+		for _, metric := range family.GetMetric() {
+			ts := timestamp
+			if metric.TimestampMs != nil {
+				ts = metric.GetTimestampMs()
+			}
+
+			add := func(name string, value float64, extra ...remoteWriteLabel) {
+				labels := make([]remoteWriteLabel, 0, len(metric.GetLabel())+len(extra)+1)
+				labels = append(labels, remoteWriteLabel{name: model.MetricNameLabel, value: name})
+				for _, label := range metric.GetLabel() {
+					labels = append(labels, remoteWriteLabel{name: label.GetName(), value: label.GetValue()})
+				}
+				labels = append(labels, extra...)
+				sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+
+				series = append(series, remoteWriteSeries{labels: labels, value: value, timestamp: ts})
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, metric.GetGauge().GetValue())
+			case dto.MetricType_SUMMARY:
+				for _, q := range metric.GetSummary().GetQuantile() {
+					add(name, q.GetValue(), remoteWriteLabel{
+						name:  model.QuantileLabel,
+						value: fmt.Sprint(q.GetQuantile()),
+					})
+				}
+				add(name+"_sum", metric.GetSummary().GetSampleSum())
+				add(name+"_count", float64(metric.GetSummary().GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				// The parser keeps the +Inf bucket of the exposition, it is only added when it is missing
+				infinite := false
+				for _, b := range metric.GetHistogram().GetBucket() {
+					infinite = infinite || math.IsInf(b.GetUpperBound(), 1)
+					add(name+"_bucket", float64(b.GetCumulativeCount()), remoteWriteLabel{
+						name:  model.BucketLabel,
+						value: fmt.Sprint(b.GetUpperBound()),
+					})
+				}
+				if !infinite {
+					add(name+"_bucket", float64(metric.GetHistogram().GetSampleCount()), remoteWriteLabel{
+						name:  model.BucketLabel,
+						value: "+Inf",
+					})
+				}
+				add(name+"_sum", metric.GetHistogram().GetSampleSum())
+				add(name+"_count", float64(metric.GetHistogram().GetSampleCount()))
+			default:
+				add(name, metric.GetUntyped().GetValue())
+			}
+		}
+	}
+
+	return series
+}
+
+// encodeWriteRequest encodes the series as a prometheus.WriteRequest protobuf message.
+func encodeWriteRequest(series []remoteWriteSeries) []byte {
+	var req []byte
+
+	for _, s := range series {
+		var ts []byte
+
+		for _, label := range s.labels {
+			var l []byte
+			l = protowire.AppendTag(l, 1, protowire.BytesType)
+			l = protowire.AppendString(l, label.name)
+			l = protowire.AppendTag(l, 2, protowire.BytesType)
+			l = protowire.AppendString(l, label.value)
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, l)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.timestamp))
+
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+
+	return req
+}
@@ -0,0 +1,342 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const remoteWriteTestMetrics = `# HELP DCGM_FI_DEV_GPU_TEMP Temperature
+# TYPE DCGM_FI_DEV_GPU_TEMP gauge
+DCGM_FI_DEV_GPU_TEMP{gpu="0",UUID="GPU-0",pod="p"} 42
+# HELP DCGM_FI_DEV_XID_ERRORS XID errors
+# TYPE DCGM_FI_DEV_XID_ERRORS counter
+DCGM_FI_DEV_XID_ERRORS{gpu="0"} 3
+`
+
+// decodeWriteRequest decodes a prometheus.WriteRequest into its series.
+func decodeWriteRequest(t *testing.T, b []byte) []remoteWriteSeries {
+	t.Helper()
+
+	var series []remoteWriteSeries
+
+	consume := func(b []byte, f func(num protowire.Number, typ protowire.Type, b []byte) int) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			require.GreaterOrEqual(t, n, 0)
+			b = b[n:]
+			n = f(num, typ, b)
+			require.GreaterOrEqual(t, n, 0)
+			b = b[n:]
+		}
+	}
+
+	consume(b, func(_ protowire.Number, _ protowire.Type, b []byte) int {
+		ts, n := protowire.ConsumeBytes(b)
+
+		var s remoteWriteSeries
+		consume(ts, func(num protowire.Number, _ protowire.Type, b []byte) int {
+			field, n := protowire.ConsumeBytes(b)
+			switch num {
+			case 1:
+				var label remoteWriteLabel
+				consume(field, func(num protowire.Number, _ protowire.Type, b []byte) int {
+					v, n := protowire.ConsumeString(b)
+					if num == 1 {
+						label.name = v
+					} else {
+						label.value = v
+					}
+					return n
+				})
+				s.labels = append(s.labels, label)
+			case 2:
+				consume(field, func(num protowire.Number, typ protowire.Type, b []byte) int {
+					if num == 1 {
+						v, n := protowire.ConsumeFixed64(b)
+						s.value = math.Float64frombits(v)
+						return n
+					}
+					v, n := protowire.ConsumeVarint(b)
+					s.timestamp = int64(v)
+					return n
+				})
+			}
+			return n
+		})
+
+		series = append(series, s)
+		return n
+	})
+
+	return series
+}
+
+func newTestRemoteWriter(t *testing.T, c *Config) *RemoteWriter {
+	t.Helper()
+
+	remoteWriter, err := NewRemoteWriter(c, func(w io.Writer) error {
+		_, err := io.WriteString(w, remoteWriteTestMetrics)
+		return err
+	})
+	require.NoError(t, err)
+
+	return remoteWriter
+}
+
+func TestRemoteWriter_Push(t *testing.T) {
+	tokenFile, err := os.CreateTemp(t.TempDir(), "token")
+	require.NoError(t, err)
+	_, err = tokenFile.WriteString("secret")
+	require.NoError(t, err)
+	require.NoError(t, tokenFile.Close())
+
+	var series []remoteWriteSeries
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, remoteWriteVersion, r.Header.Get("X-Prometheus-Remote-Write-Version"))
+
+		compressed, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		body, err := snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+
+		series = decodeWriteRequest(t, body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	remoteWriter := newTestRemoteWriter(t, &Config{
+		RemoteWriteURL:             server.URL,
+		RemoteWriteBearerTokenFile: tokenFile.Name(),
+		CollectInterval:            1000,
+	})
+
+	require.NoError(t, remoteWriter.push(context.Background()))
+
+	require.Len(t, series, 2)
+	assert.Equal(t, []remoteWriteLabel{
+		{name: "UUID", value: "GPU-0"},
+		{name: "__name__", value: "DCGM_FI_DEV_GPU_TEMP"},
+		{name: "gpu", value: "0"},
+		{name: "pod", value: "p"},
+	}, series[0].labels)
+	assert.Equal(t, 42.0, series[0].value)
+	assert.NotZero(t, series[0].timestamp)
+	assert.Equal(t, []remoteWriteLabel{
+		{name: "__name__", value: "DCGM_FI_DEV_XID_ERRORS"},
+		{name: "gpu", value: "0"},
+	}, series[1].labels)
+	assert.Equal(t, 3.0, series[1].value)
+}
+
+func TestRemoteWriter_StaleMarkers(t *testing.T) {
+	var series []remoteWriteSeries
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		compressed, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		body, err := snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+
+		series = decodeWriteRequest(t, body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// The MIG instance is destroyed after the first push
+	pushes := []string{
+		"# TYPE DCGM_FI_DEV_GPU_TEMP gauge\n" +
+			"DCGM_FI_DEV_GPU_TEMP{gpu=\"0\",GPU_I_ID=\"1\"} 42\n" +
+			"DCGM_FI_DEV_GPU_TEMP{gpu=\"0\",GPU_I_ID=\"2\"} 43\n",
+		"# TYPE DCGM_FI_DEV_GPU_TEMP gauge\n" +
+			"DCGM_FI_DEV_GPU_TEMP{gpu=\"0\",GPU_I_ID=\"1\"} 44\n",
+		"# TYPE DCGM_FI_DEV_GPU_TEMP gauge\n" +
+			"DCGM_FI_DEV_GPU_TEMP{gpu=\"0\",GPU_I_ID=\"1\"} 45\n",
+	}
+	push := 0
+
+	remoteWriter, err := NewRemoteWriter(&Config{RemoteWriteURL: server.URL, CollectInterval: 1000},
+		func(w io.Writer) error {
+			_, err := io.WriteString(w, pushes[push])
+			return err
+		})
+	require.NoError(t, err)
+
+	require.NoError(t, remoteWriter.push(context.Background()))
+	require.Len(t, series, 2)
+
+	push++
+	require.NoError(t, remoteWriter.push(context.Background()))
+	require.Len(t, series, 2)
+	assert.Equal(t, 44.0, series[0].value)
+	assert.Equal(t, []remoteWriteLabel{
+		{name: "GPU_I_ID", value: "2"},
+		{name: "__name__", value: "DCGM_FI_DEV_GPU_TEMP"},
+		{name: "gpu", value: "0"},
+	}, series[1].labels)
+	assert.Equal(t, remoteWriteStaleNaN, math.Float64bits(series[1].value))
+
+	// The stale marker is only sent once
+	push++
+	require.NoError(t, remoteWriter.push(context.Background()))
+	require.Len(t, series, 1)
+	assert.Equal(t, 45.0, series[0].value)
+}
+
+func TestRemoteWriter_Retry(t *testing.T) {
+	remoteWriteMinBackoff, remoteWriteMaxBackoff = time.Millisecond, time.Millisecond
+	defer func() {
+		remoteWriteMinBackoff, remoteWriteMaxBackoff = 500*time.Millisecond, 30*time.Second
+	}()
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantErr      bool
+		wantRequests int32
+	}{
+		{
+			name:         "success after server errors",
+			statuses:     []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusOK},
+			wantRequests: 3,
+		},
+		{
+			name:         "retries exhausted",
+			statuses:     []int{http.StatusServiceUnavailable},
+			wantErr:      true,
+			wantRequests: 3,
+		},
+		{
+			name:         "client error is not retried",
+			statuses:     []int{http.StatusBadRequest},
+			wantErr:      true,
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(requests.Add(1)) - 1
+				w.WriteHeader(tt.statuses[min(n, len(tt.statuses)-1)])
+			}))
+			defer server.Close()
+
+			remoteWriter := newTestRemoteWriter(t, &Config{
+				RemoteWriteURL:        server.URL,
+				RemoteWriteMaxRetries: 2,
+				CollectInterval:       1000,
+			})
+
+			err := remoteWriter.push(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantRequests, requests.Load())
+		})
+	}
+}
+
+func TestNewRemoteWriter_InvalidConfig(t *testing.T) {
+	_, err := NewRemoteWriter(&Config{RemoteWriteURL: "not a url"}, nil)
+	assert.Error(t, err)
+
+	_, err = NewRemoteWriter(&Config{
+		RemoteWriteURL:         "https://example.com/api/v1/write",
+		RemoteWriteTLSCertFile: "cert.pem",
+	}, nil)
+	assert.Error(t, err)
+}
+
+func TestToTimeSeries_Histogram(t *testing.T) {
+	tests := []struct {
+		name       string
+		exposition string
+	}{
+		{
+			name: "When the exposition has the +Inf bucket",
+			exposition: `# TYPE DCGM_FI_DEV_POWER_USAGE histogram
+DCGM_FI_DEV_POWER_USAGE_bucket{gpu="0",le="100"} 1
+DCGM_FI_DEV_POWER_USAGE_bucket{gpu="0",le="200"} 3
+DCGM_FI_DEV_POWER_USAGE_bucket{gpu="0",le="+Inf"} 4
+DCGM_FI_DEV_POWER_USAGE_sum{gpu="0"} 650
+DCGM_FI_DEV_POWER_USAGE_count{gpu="0"} 4
+`,
+		},
+		{
+			name: "When the exposition misses the +Inf bucket",
+			exposition: `# TYPE DCGM_FI_DEV_POWER_USAGE histogram
+DCGM_FI_DEV_POWER_USAGE_bucket{gpu="0",le="100"} 1
+DCGM_FI_DEV_POWER_USAGE_bucket{gpu="0",le="200"} 3
+DCGM_FI_DEV_POWER_USAGE_sum{gpu="0"} 650
+DCGM_FI_DEV_POWER_USAGE_count{gpu="0"} 4
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var parser expfmt.TextParser
+			families, err := parser.TextToMetricFamilies(strings.NewReader(tt.exposition))
+			require.NoError(t, err)
+
+			series := decodeWriteRequest(t, encodeWriteRequest(toTimeSeries(families, 1000)))
+
+			buckets := map[string]float64{}
+			for _, s := range series {
+				var name, le string
+				for _, label := range s.labels {
+					switch label.name {
+					case "__name__":
+						name = label.value
+					case "le":
+						le = label.value
+					}
+				}
+				if name != "DCGM_FI_DEV_POWER_USAGE_bucket" {
+					continue
+				}
+
+				_, duplicate := buckets[le]
+				assert.False(t, duplicate, "duplicate bucket le=%q", le)
+				buckets[le] = s.value
+			}
+
+			assert.Equal(t, map[string]float64{"100": 1, "200": 3, "+Inf": 4}, buckets)
+			assert.Len(t, series, 5)
+		})
+	}
+}
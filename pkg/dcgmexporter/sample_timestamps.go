@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+const (
+	dcgmExpSampleAgeSeconds = "DCGM_EXP_SAMPLE_AGE_SECONDS"
+
+	// sampleTimestampSuffix is appended to the name of the metrics of the time DCGM sampled the values
+	sampleTimestampSuffix = "_timestamp_seconds"
+	// sampleAgeFieldLabel is the label of the field of the age of the values
+	sampleAgeFieldLabel = "field"
+)
+
+var sampleAgeCounter = Counter{
+	FieldName: dcgmExpSampleAgeSeconds,
+	PromType:  "gauge",
+	Help:      "Age of the latest value of the field read from DCGM at the time of the collection (in s).",
+}
+
+// sampleTimes returns the time DCGM sampled the values by field, the values without data or timestamp are left out.
+func sampleTimes(values []dcgm.FieldValue_v1) map[dcgm.Short]time.Time {
+	times := make(map[dcgm.Short]time.Time, len(values))
+	for _, value := range values {
+		if value.Ts <= 0 || ToString(value) == SkipDCGMValue {
+			continue
+		}
+		times[dcgm.Short(value.FieldId)] = time.UnixMicro(value.Ts)
+	}
+
+	return times
+}
+
+// sampleTimestampCounter returns the counter of the time DCGM sampled the values of a counter, named after the
+// counter without its _total suffix.
+func sampleTimestampCounter(counter Counter) Counter {
+	return Counter{
+		FieldName: strings.TrimSuffix(counter.FieldName, "_total") + sampleTimestampSuffix,
+		PromType:  "gauge",
+		Help:      fmt.Sprintf("Time DCGM sampled the value of %s (in seconds since the epoch).", counter.FieldName),
+	}
+}
+
+// formatSampleTime formats a time in seconds since the epoch, with the microsecond precision of DCGM.
+func formatSampleTime(t time.Time) string {
+	return fmt.Sprintf("%d.%06d", t.Unix(), t.Nanosecond()/int(time.Microsecond))
+}
+
+// exportsSampleTimes returns whether the collector exports the time DCGM sampled the values or their age.
+func (c *DCGMCollector) exportsSampleTimes() bool {
+	return c.sampleAge || c.sampleTimestamps == SampleTimestampsExemplar || c.sampleTimestamps == SampleTimestampsMetric
+}
+
+// addSampleTimes exports the times DCGM sampled the values of the metrics of an entity, as exemplars or sibling
+// metrics, and their age. The metrics must all be converted from the values of the entity.
+func (c *DCGMCollector) addSampleTimes(metrics MetricsByCounter, times map[dcgm.Short]time.Time) {
+	if len(times) == 0 {
+		return
+	}
+
+	now := c.now()
+	added := MetricsByCounter{}
+	for counter, counterMetrics := range metrics {
+		sampled, exists := times[counter.FieldID]
+		if !exists || len(counterMetrics) == 0 {
+			continue
+		}
+
+		switch c.sampleTimestamps {
+		case SampleTimestampsExemplar:
+			for i := range counterMetrics {
+				counterMetrics[i].ExemplarTimestamp = sampled
+			}
+		case SampleTimestampsMetric:
+			timestampCounter := sampleTimestampCounter(counter)
+			for _, metric := range counterMetrics {
+				m := metric.withAttributes()
+				m.Counter = timestampCounter
+				m.Suffix = ""
+				m.Value = formatSampleTime(sampled)
+				m.Exemplar = nil
+				m.ExemplarTimestamp = time.Time{}
+				added[timestampCounter] = append(added[timestampCounter], m)
+			}
+		}
+
+		// The age is exported once per field, without the attributes of the values, e.g. the bits of the bitmasks
+		if c.sampleAge {
+			m := counterMetrics[0]
+			m.Counter = sampleAgeCounter
+			m.Suffix = ""
+			m.Value = fmt.Sprintf("%f", now.Sub(sampled).Seconds())
+			m.Labels = maps.Clone(m.Labels)
+			if m.Labels == nil {
+				m.Labels = map[string]string{}
+			}
+			m.Labels[sampleAgeFieldLabel] = counter.FieldName
+			m.Attributes = map[string]string{}
+			m.Exemplar = nil
+			m.ExemplarTimestamp = time.Time{}
+			added[sampleAgeCounter] = append(added[sampleAgeCounter], m)
+		}
+	}
+
+	mergeMetrics(metrics, added)
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// timestampedSource sets the time DCGM sampled the values of a field, the other values are not timestamped.
+type timestampedSource struct {
+	fieldValuesSource
+	field   dcgm.Short
+	sampled time.Time
+}
+
+func (s *timestampedSource) latestValues(
+	entity dcgm.GroupEntityPair, parentID uint, fields []dcgm.Short,
+) ([]dcgm.FieldValue_v1, error) {
+	values, err := s.fieldValuesSource.latestValues(entity, parentID, fields)
+	for i := range values {
+		values[i].Ts = 0
+		if dcgm.Short(values[i].FieldId) == s.field {
+			values[i].Ts = s.sampled.UnixMicro()
+		}
+	}
+	return values, err
+}
+
+func TestDCGMCollector_SampleTimes(t *testing.T) {
+	spec, err := LoadSimulationSpec(writeSimulationSpec(t, `
+gpus:
+- count: 2
+fields:
+  DCGM_FI_DEV_GPU_TEMP: {values: [40]}
+  DCGM_FI_DEV_POWER_USAGE: {values: [100]}
+`))
+	require.NoError(t, err)
+
+	temp := Counter{dcgm.DCGM_FI_DEV_GPU_TEMP, "DCGM_FI_DEV_GPU_TEMP", "gauge", "Temp"}
+	power := Counter{dcgm.DCGM_FI_DEV_POWER_USAGE, "DCGM_FI_DEV_POWER_USAGE", "gauge", "Power"}
+	counters := []Counter{temp, power}
+	config := &Config{GPUDevices: DeviceOptions{Flex: true}}
+
+	systemInfo, err := NewSimulatedEntityGroupTypeSystemInfo(counters, config, spec)
+	require.NoError(t, err)
+	item, _ := systemInfo.Get(dcgm.FE_GPU)
+
+	sampled := time.Date(2024, 5, 1, 12, 0, 0, 250000000, time.UTC)
+	collect := func(timestamps SampleTimestamps, age bool) MetricsByCounter {
+		collector := &DCGMCollector{
+			Counters:         counters,
+			DeviceFields:     item.DeviceFields,
+			SysInfo:          item.SystemInfo,
+			source:           &timestampedSource{newSimulator(spec, counters), dcgm.DCGM_FI_DEV_GPU_TEMP, sampled},
+			sampleTimestamps: timestamps,
+			sampleAge:        age,
+			now:              func() time.Time { return sampled.Add(3 * time.Second) },
+		}
+
+		metrics, err := collector.GetMetrics()
+		require.NoError(t, err)
+		return metrics
+	}
+
+	t.Run("none", func(t *testing.T) {
+		metrics := collect(SampleTimestampsNone, false)
+		assert.Len(t, metrics, 2)
+		for _, metric := range metrics[temp] {
+			assert.False(t, metric.HasExemplar())
+		}
+	})
+
+	t.Run("exemplar", func(t *testing.T) {
+		metrics := collect(SampleTimestampsExemplar, false)
+		require.Len(t, metrics, 2)
+		require.Len(t, metrics[temp], 2)
+		for _, metric := range metrics[temp] {
+			assert.True(t, metric.HasExemplar())
+			assert.Equal(t, "1714564800.250000", metric.ExemplarTime())
+		}
+		// The values without timestamp have no exemplar
+		for _, metric := range metrics[power] {
+			assert.False(t, metric.HasExemplar())
+		}
+
+		formatted, err := FormatMetrics(newMetricsTemplate("migMetrics", migMetricsFormat),
+			MetricsByCounter{temp: metrics[temp][:1]})
+		require.NoError(t, err)
+		assert.Contains(t, formatted, `} 40 # {} 40 1714564800.250000
+`)
+	})
+
+	t.Run("metric", func(t *testing.T) {
+		metrics := collect(SampleTimestampsMetric, false)
+		require.Len(t, metrics, 3)
+
+		timestamps := metrics[sampleTimestampCounter(temp)]
+		require.Len(t, timestamps, 2)
+		assert.Equal(t, "DCGM_FI_DEV_GPU_TEMP_timestamp_seconds", timestamps[0].Counter.FieldName)
+		assert.Equal(t, "gauge", timestamps[0].Counter.PromType)
+		for i, metric := range timestamps {
+			assert.Equal(t, metrics[temp][i].GPU, metric.GPU)
+			assert.Equal(t, "1714564800.250000", metric.Value)
+			assert.False(t, metric.HasExemplar())
+		}
+	})
+
+	t.Run("age", func(t *testing.T) {
+		metrics := collect(SampleTimestampsNone, true)
+		require.Len(t, metrics, 3)
+
+		ages := metrics[sampleAgeCounter]
+		require.Len(t, ages, 2)
+		for _, metric := range ages {
+			assert.Equal(t, "3.000000", metric.Value)
+			assert.Equal(t, map[string]string{sampleAgeFieldLabel: "DCGM_FI_DEV_GPU_TEMP"}, metric.Labels)
+		}
+		// The labels of the metrics are not modified
+		for _, metric := range metrics[temp] {
+			assert.Empty(t, metric.Labels)
+		}
+	})
+}
+
+func TestSampleTimestampCounter(t *testing.T) {
+	counter := sampleTimestampCounter(Counter{FieldName: "DCGM_FI_DEV_XID_ERRORS_total", PromType: "counter"})
+	assert.Equal(t, "DCGM_FI_DEV_XID_ERRORS_timestamp_seconds", counter.FieldName)
+	assert.Equal(t, dcgm.Short(0), counter.FieldID)
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"strings"
+)
+
+// scrapeScope selects the metrics served to a scrape, by the namespaces of the pods they are attributed to and by the
+// groups of their counters. The scrape gets all the metrics when none is set.
+type scrapeScope struct {
+	namespaces map[string]bool
+	counters   map[string]bool
+	// namespaceLabels are the labels the namespace of the pods is exported with
+	namespaceLabels []string
+}
+
+func (s scrapeScope) isSet() bool {
+	return s.namespaces != nil || s.counters != nil
+}
+
+// filter returns the samples of the metrics, in the text exposition format, selected by the scope.
+func (s scrapeScope) filter(metrics string) string {
+	if s.namespaces != nil {
+		metrics = filterSamples(metrics, namespacesScope(s.namespaces, s.namespaceLabels))
+	}
+	if s.counters != nil {
+		metrics = filterSamples(metrics, countersScope(s.counters))
+	}
+	return metrics
+}
+
+// filterSamples keeps the samples of the metrics, in the text exposition format, for which keep returns true. The
+// HELP and TYPE lines are kept for the families that keep samples.
+func filterSamples(metrics string, keep func(name, labels string) bool) string {
+	var sb strings.Builder
+	var header []string
+	headerFamily := ""
+
+	for _, line := range strings.Split(metrics, "\n") {
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) < 3 || (fields[1] != "HELP" && fields[1] != "TYPE") {
+				continue
+			}
+			if fields[2] != headerFamily {
+				header, headerFamily = nil, fields[2]
+			}
+			header = append(header, line)
+			continue
+		}
+
+		name, labels, _ := splitSample(line)
+		if !keep(name, labels) {
+			continue
+		}
+
+		for _, h := range header {
+			sb.WriteString(h)
+			sb.WriteByte('\n')
+		}
+		header = nil
+
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
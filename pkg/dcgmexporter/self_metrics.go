@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// selfMetrics holds the metrics describing the exporter itself, e.g. the state of its connections.
+// Unlike GPU metrics they have no device labels.
+var selfMetrics = newSelfMetricsRegistry()
+
+type selfMetricSample struct {
+	labels map[string]string
+	value  float64
+}
+
+type selfMetricFamily struct {
+	help       string
+	metricType string
+	samples    map[string]*selfMetricSample
+}
+
+type selfMetricsRegistry struct {
+	mtx      sync.Mutex
+	families map[string]*selfMetricFamily
+}
+
+func newSelfMetricsRegistry() *selfMetricsRegistry {
+	return &selfMetricsRegistry{
+		families: map[string]*selfMetricFamily{},
+	}
+}
+
+// SetGauge sets the value of the gauge with the given labels.
+func (r *selfMetricsRegistry) SetGauge(name, help string, labels map[string]string, value float64) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.sample(name, help, "gauge", labels).value = value
+}
+
+// AddCounter increments the counter with the given labels.
+func (r *selfMetricsRegistry) AddCounter(name, help string, labels map[string]string, delta float64) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.sample(name, help, "counter", labels).value += delta
+}
+
+// SetInfo sets the info gauge to 1 with the given labels, replacing the samples with other labels, e.g. the previous
+// version of the driver.
+func (r *selfMetricsRegistry) SetInfo(name, help string, labels map[string]string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if family, exists := r.families[name]; exists {
+		family.samples = map[string]*selfMetricSample{}
+	}
+	r.sample(name, help, "gauge", labels).value = 1
+}
+
+// Value returns the current value of the metric with the given labels.
+func (r *selfMetricsRegistry) Value(name string, labels map[string]string) (float64, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	family, exists := r.families[name]
+	if !exists {
+		return 0, false
+	}
+
+	sample, exists := family.samples[encodeSelfMetricLabels(labels)]
+	if !exists {
+		return 0, false
+	}
+
+	return sample.value, true
+}
+
+func (r *selfMetricsRegistry) sample(name, help, metricType string, labels map[string]string) *selfMetricSample {
+	family, exists := r.families[name]
+	if !exists {
+		family = &selfMetricFamily{
+			help:       help,
+			metricType: metricType,
+			samples:    map[string]*selfMetricSample{},
+		}
+		r.families[name] = family
+	}
+
+	key := encodeSelfMetricLabels(labels)
+
+	sample, exists := family.samples[key]
+	if !exists {
+		sample = &selfMetricSample{labels: labels}
+		family.samples[key] = sample
+	}
+
+	return sample
+}
+
+// Encode writes the metrics in the Prometheus text exposition format.
+func (r *selfMetricsRegistry) Encode(w io.Writer) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+
+	for _, name := range names {
+		family := r.families[name]
+
+		fmt.Fprintf(&sb, "# HELP %s %s\n", name, family.help)
+		fmt.Fprintf(&sb, "# TYPE %s %s\n", name, family.metricType)
+
+		keys := make([]string, 0, len(family.samples))
+		for key := range family.samples {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			sb.WriteString(name)
+			if key != "" {
+				sb.WriteString("{" + key + "}")
+			}
+			sb.WriteString(" " + strconv.FormatFloat(family.samples[key].value, 'g', -1, 64) + "\n")
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func encodeSelfMetricLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, key, escapeLabelValue(labels[key])))
+	}
+
+	return strings.Join(pairs, ",")
+}
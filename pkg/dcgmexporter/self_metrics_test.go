@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfMetricsRegistry_Encode(t *testing.T) {
+	registry := newSelfMetricsRegistry()
+
+	registry.SetGauge("DCGM_EXPORTER_TEST_GAUGE", "A test gauge.", nil, 1)
+	registry.SetGauge("DCGM_EXPORTER_TEST_GAUGE", "A test gauge.", nil, 0)
+	registry.AddCounter("DCGM_EXPORTER_TEST_TOTAL", "A test counter.", map[string]string{"reason": `a"b`}, 2)
+	registry.AddCounter("DCGM_EXPORTER_TEST_TOTAL", "A test counter.", map[string]string{"reason": `a"b`}, 1)
+	registry.AddCounter("DCGM_EXPORTER_TEST_TOTAL", "A test counter.", map[string]string{"reason": "c"}, 1)
+
+	value, exists := registry.Value("DCGM_EXPORTER_TEST_TOTAL", map[string]string{"reason": `a"b`})
+	assert.True(t, exists)
+	assert.Equal(t, 3.0, value)
+
+	_, exists = registry.Value("DCGM_EXPORTER_TEST_UNKNOWN", nil)
+	assert.False(t, exists)
+
+	var buf bytes.Buffer
+	require.NoError(t, registry.Encode(&buf))
+	assert.Equal(t, `# HELP DCGM_EXPORTER_TEST_GAUGE A test gauge.
+# TYPE DCGM_EXPORTER_TEST_GAUGE gauge
+DCGM_EXPORTER_TEST_GAUGE 0
+# HELP DCGM_EXPORTER_TEST_TOTAL A test counter.
+# TYPE DCGM_EXPORTER_TEST_TOTAL counter
+DCGM_EXPORTER_TEST_TOTAL{reason="a\"b"} 3
+DCGM_EXPORTER_TEST_TOTAL{reason="c"} 1
+`, buf.String())
+}
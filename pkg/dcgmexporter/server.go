@@ -17,35 +17,92 @@
 package dcgmexporter
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/exporter-toolkit/web"
 	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
 
 	"github.com/NVIDIA/dcgm-exporter/internal/pkg/logging"
 )
 
+const (
+	dcgmExporterScrapeTruncatedTotal = "DCGM_EXPORTER_SCRAPE_TRUNCATED_TOTAL"
+	dcgmExporterCollectedAtSeconds   = "DCGM_EXPORTER_COLLECTED_AT_SECONDS"
+
+	// scrapeTimeoutHeader is set by Prometheus to the timeout of the scrape
+	scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+)
+
+// scrapeTimeoutOffset is subtracted from the timeout of the scrape to leave time to write the response.
+var scrapeTimeoutOffset = 500 * time.Millisecond
+
 func NewMetricsServer(c *Config, metrics chan string, registry *Registry) (*MetricsServer, func(), error) {
+	webConfigFile, cleanup, err := getWebConfigFile(c)
+	if err != nil {
+		return nil, func() {}, err
+	}
+
+	attributeNames, err := newPodAttributeNames(c)
+	if err != nil {
+		cleanup()
+		return nil, func() {}, err
+	}
+
 	router := mux.NewRouter()
+	handler, err := newCompressionHandler(c, router)
+	if err != nil {
+		cleanup()
+		return nil, func() {}, err
+	}
+	handler, err = newAuthHandler(c, handler)
+	if err != nil {
+		cleanup()
+		return nil, func() {}, err
+	}
+	// The limits apply before the authentication, so that the rejected requests are cheap
+	handler = newLimitHandler(c, handler)
+
 	serverv1 := &MetricsServer{
 		server: &http.Server{
 			Addr:         c.Address,
-			Handler:      router,
+			Handler:      handler,
 			ReadTimeout:  10 * time.Second,
 			WriteTimeout: 10 * time.Second,
 		},
 		webConfig: &web.FlagConfig{
 			WebListenAddresses: &[]string{c.Address},
 			WebSystemdSocket:   &c.WebSystemdSocket,
-			WebConfigFile:      &c.WebConfigFile,
+			WebConfigFile:      &webConfigFile,
 		},
+		router:      router,
 		metricsChan: metrics,
 		metrics:     "",
 		registry:    registry,
+		exemplars:   c.KubernetesExemplars || c.SampleTimestamps == SampleTimestampsExemplar,
+
+		backgroundCollection: c.BackgroundCollection,
+		scrapeCacheMaxAge:    time.Duration(c.ScrapeCacheMaxAge) * time.Millisecond,
+		counterGroups:        c.CounterGroups,
+		namespaceLabels:      attributeNames.namespaceLabels(),
+	}
+
+	if c.OpenMetrics || serverv1.exemplars {
+		serverv1.openMetricsConverter = newOpenMetricsConverter()
+		serverv1.openMetricsScrape = newOpenMetricsConverter()
 	}
 
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -66,9 +123,125 @@ func NewMetricsServer(c *Config, metrics chan string, registry *Registry) (*Metr
 	})
 
 	router.HandleFunc("/health", serverv1.Health)
+	router.HandleFunc("/ready", serverv1.Ready)
 	router.HandleFunc("/metrics", serverv1.Metrics)
 
-	return serverv1, func() {}, nil
+	if c.WebListenUnixSocket != "" {
+		listener, err := listenUnixSocket(c.WebListenUnixSocket, c.WebListenUnixSocketMode)
+		if err != nil {
+			cleanup()
+			return nil, func() {}, err
+		}
+		serverv1.listener = listener
+
+		cleanupWebConfig := cleanup
+		cleanup = func() {
+			// Closing the listener removes the socket
+			_ = listener.Close()
+			cleanupWebConfig()
+		}
+	}
+
+	return serverv1, cleanup, nil
+}
+
+// listenUnixSocket listens on the Unix domain socket with the given octal permissions, replacing the socket left
+// by a previous run.
+func listenUnixSocket(path, mode string) (net.Listener, error) {
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Unix socket mode '%s'; err: %w", mode, err)
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("'%s' exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove the stale socket '%s'; err: %w", path, err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on the Unix socket '%s'; err: %w", path, err)
+	}
+
+	if err := os.Chmod(path, fs.FileMode(perm)); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to set the permissions of the Unix socket '%s'; err: %w", path, err)
+	}
+
+	return listener, nil
+}
+
+// getWebConfigFile returns the web config file of the exporter-toolkit. When the TLS flags are set, the file is
+// generated from them and removed by the returned cleanup.
+func getWebConfigFile(c *Config) (string, func(), error) {
+	if c.WebTLSCertFile == "" && c.WebTLSKeyFile == "" && c.WebTLSClientCAFile == "" {
+		return c.WebConfigFile, func() {}, nil
+	}
+
+	if c.WebConfigFile != "" {
+		return "", func() {}, errors.New("the TLS flags cannot be used with a web config file")
+	}
+	if c.WebTLSCertFile == "" || c.WebTLSKeyFile == "" {
+		return "", func() {}, errors.New("both the TLS certificate and key files are required")
+	}
+
+	tlsConfig := map[string]string{
+		"cert_file": c.WebTLSCertFile,
+		"key_file":  c.WebTLSKeyFile,
+	}
+	if c.WebTLSClientCAFile != "" {
+		tlsConfig["client_ca_file"] = c.WebTLSClientCAFile
+		tlsConfig["client_auth_type"] = "RequireAndVerifyClientCert"
+	}
+
+	data, err := yaml.Marshal(map[string]interface{}{"tls_server_config": tlsConfig})
+	if err != nil {
+		return "", func() {}, err
+	}
+
+	file, err := os.CreateTemp("", "dcgm-exporter-web-config-*.yaml")
+	if err != nil {
+		return "", func() {}, fmt.Errorf("failed to create the web config file; err: %w", err)
+	}
+	defer file.Close()
+
+	cleanup := func() {
+		if err := os.Remove(file.Name()); err != nil {
+			logrus.WithError(err).Warnf("Failed to remove the web config file '%s'", file.Name())
+		}
+	}
+
+	if _, err := file.Write(data); err != nil {
+		cleanup()
+		return "", func() {}, fmt.Errorf("failed to write the web config file; err: %w", err)
+	}
+
+	return file.Name(), cleanup, nil
+}
+
+// HandleJobs serves the endpoints starting and stopping the jobs of the job statistics.
+func (s *MetricsServer) HandleJobs(jobStats *JobStats) {
+	s.router.HandleFunc("/jobs/start", jobStats.StartJob).Methods(http.MethodPost)
+	s.router.HandleFunc("/jobs/stop", jobStats.StopJob).Methods(http.MethodPost)
+}
+
+// HandleMapping serves the endpoint returning the attribution of the devices to the pods.
+func (s *MetricsServer) HandleMapping(podMapper *PodMapper) {
+	s.router.HandleFunc("/v1/mapping", podMapper.ServeMapping).Methods(http.MethodGet)
+}
+
+// HandleDiag serves the endpoint running the diagnostic on the idle GPUs.
+func (s *MetricsServer) HandleDiag(diagnostics *Diagnostics) {
+	s.router.HandleFunc("/diag/run", diagnostics.RunDiag).Methods(http.MethodPost)
+}
+
+// SetStartup gates the readiness and the scrapes on the startup of the exporter, it must be called before Run.
+func (s *MetricsServer) SetStartup(startup *Startup) {
+	s.startup = startup
 }
 
 func (s *MetricsServer) Run(stop chan interface{}, wg *sync.WaitGroup) {
@@ -81,7 +254,14 @@ func (s *MetricsServer) Run(stop chan interface{}, wg *sync.WaitGroup) {
 	go func() {
 		defer httpwg.Done()
 		logrus.Info("Starting webserver")
-		if err := web.ListenAndServe(s.server, s.webConfig, logger); err != nil && err != http.ErrServerClosed {
+
+		var err error
+		if s.listener != nil {
+			err = web.ServeMultiple([]net.Listener{s.listener}, s.server, s.webConfig, logger)
+		} else {
+			err = web.ListenAndServe(s.server, s.webConfig, logger)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logrus.WithError(err).Fatal("Failed to Listen and Server HTTP server.")
 		}
 	}()
@@ -111,26 +291,203 @@ func (s *MetricsServer) Run(stop chan interface{}, wg *sync.WaitGroup) {
 
 func (s *MetricsServer) Metrics(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("X-Content-Type-Options", "nosniff")
-	w.WriteHeader(http.StatusOK)
-	_, err := w.Write([]byte(s.getMetrics()))
+
+	// OpenMetrics is opt-in as it renames the counter samples, it is served to the scrapers asking for it
+	openMetrics := false
+	if s.openMetricsConverter != nil {
+		format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+		if format.FormatType() == expfmt.TypeOpenMetrics {
+			openMetrics = true
+			w.Header().Set("Content-Type", string(format))
+		}
+	}
+
+	// The scrapes don't get empty or unattributed metrics while the exporter is starting
+	if s.startup != nil {
+		if ready, state := s.startup.Ready(); !ready {
+			http.Error(w, "exporter is starting: "+state, http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	var scope scrapeScope
+	var err error
+	scope.namespaces, err = scrapeNamespaces(r)
+	scope.namespaceLabels = s.namespaceLabels
 	if err != nil {
-		logrus.WithError(err).Error("Failed to write response.")
-		http.Error(w, "failed to write response", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
-	metrics, err := s.registry.Gather()
+	scope.counters, err = scrapeCounters(r, s.counterGroups)
 	if err != nil {
-		logrus.WithError(err).Error("Failed to write response.")
-		http.Error(w, "failed to write response", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	err = encodeExpMetrics(w, metrics)
+
+	ctx, cancel := scrapeContext(r)
+	defer cancel()
+
+	w.WriteHeader(http.StatusOK)
+	err = s.writeMetrics(ctx, w, openMetrics, scope)
 	if err != nil {
+		logrus.WithError(err).Error("Failed to write response.")
 		http.Error(w, "failed to write response", http.StatusInternalServerError)
 		return
 	}
 }
 
+// scrapeContext returns the context of the scrape, bounded by the timeout of the scrape when the scraper sets it.
+func scrapeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	value := r.Header.Get(scrapeTimeoutHeader)
+	if value == "" {
+		return r.Context(), func() {}
+	}
+
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds <= 0 {
+		logrus.Debugf("Ignoring invalid %s header '%s'", scrapeTimeoutHeader, value)
+		return r.Context(), func() {}
+	}
+
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > 2*scrapeTimeoutOffset {
+		timeout -= scrapeTimeoutOffset
+	}
+
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// WriteMetrics writes the exported metrics in the Prometheus text exposition format.
+func (s *MetricsServer) WriteMetrics(w io.Writer) error {
+	return s.writeMetrics(context.Background(), w, false, scrapeScope{})
+}
+
+// writeMetrics writes the metrics of the pipeline and the exporter metrics gathered until the context is done. When
+// the scope is set, only the metrics it selects are written.
+func (s *MetricsServer) writeMetrics(ctx context.Context, w io.Writer, openMetrics bool, scope scrapeScope) error {
+	var metrics string
+	if openMetrics {
+		metrics = s.getOpenMetrics()
+	} else {
+		metrics = s.getMetrics()
+		if s.exemplars {
+			metrics = stripExemplars(metrics)
+		}
+	}
+	if scope.isSet() {
+		metrics = scope.filter(metrics)
+	}
+
+	_, err := w.Write([]byte(metrics))
+	if err != nil {
+		return err
+	}
+
+	// The exporter metrics are part of the metrics of the collection, and they aren't attributed to the tenants
+	if s.backgroundCollection || scope.namespaces != nil {
+		if openMetrics {
+			_, err = io.WriteString(w, openMetricsEOF)
+		}
+		return err
+	}
+
+	expMetrics, err := s.scrapeExpMetrics(ctx)
+	if err != nil {
+		return err
+	}
+
+	if openMetrics {
+		expMetrics = s.openMetricsScrape.convert(expMetrics, time.Now())
+	}
+	if scope.isSet() {
+		expMetrics = scope.filter(expMetrics)
+	}
+	if openMetrics {
+		expMetrics += openMetricsEOF
+	}
+
+	_, err = io.WriteString(w, expMetrics)
+	return err
+}
+
+// scrapeExpMetrics returns the exporter metrics gathered by the last scrape when they are younger than the maximum
+// age of the cache, so that the scrapes of several Prometheus servers gather them once, and gathers them otherwise.
+func (s *MetricsServer) scrapeExpMetrics(ctx context.Context) (string, error) {
+	if s.scrapeCacheMaxAge <= 0 {
+		_, text, _, err := gatherExpMetrics(ctx, s.registry)
+		return text, err
+	}
+
+	// The concurrent scrapes wait for the one gathering the metrics
+	s.scrapeCache.Lock()
+	defer s.scrapeCache.Unlock()
+
+	if s.scrapeCache.text != "" && time.Since(s.scrapeCache.gatheredAt) < s.scrapeCacheMaxAge {
+		return s.scrapeCache.text, nil
+	}
+
+	_, text, truncated, err := gatherExpMetrics(ctx, s.registry)
+	if err != nil {
+		return "", err
+	}
+
+	// The truncated scrapes are not cached, the next scrape gathers the collectors left out again
+	s.scrapeCache.text = ""
+	if !truncated {
+		s.scrapeCache.text = text
+		s.scrapeCache.gatheredAt = time.Now()
+	}
+
+	return text, nil
+}
+
+// gatherExpMetrics gathers the exporter metrics until the context is done, and encodes them with the self metrics.
+func gatherExpMetrics(ctx context.Context, registry *Registry) (MetricsByCounter, string, bool, error) {
+	var buf bytes.Buffer
+	registryMetrics, truncated, err := registry.GatherContext(ctx)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if truncated {
+		logrus.Warn("The scrape timed out, the metrics of the collectors still running are left out")
+		selfMetrics.AddCounter(dcgmExporterScrapeTruncatedTotal,
+			"Number of scrapes served without the metrics of the collectors that did not complete before the scrape timeout.",
+			nil, 1)
+	}
+	selfMetrics.SetGauge(dcgmExporterCollectedAtSeconds,
+		"Unix time at which the exporter metrics were gathered, older than the scrape when they are served from the cache.",
+		nil, float64(time.Now().UnixMilli())/1000)
+
+	err = encodeExpMetrics(&buf, registryMetrics)
+	if err != nil {
+		return nil, "", false, err
+	}
+	err = selfMetrics.Encode(&buf)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	return registryMetrics, buf.String(), truncated, nil
+}
+
+// stripExemplars removes the exemplars from the samples, they are not part of the Prometheus text format.
+func stripExemplars(metrics string) string {
+	lines := strings.Split(metrics, "\n")
+
+	for i, line := range lines {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, labels, rest := splitSample(line)
+		if exemplar := strings.Index(rest, "#"); exemplar >= 0 {
+			lines[i] = name + labels + " " + strings.TrimSpace(rest[:exemplar])
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 func (s *MetricsServer) Health(w http.ResponseWriter, r *http.Request) {
 	if s.getMetrics() == "" {
 		w.Header().Set("X-Content-Type-Options", "nosniff")
@@ -151,11 +508,38 @@ func (s *MetricsServer) Health(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Ready reports whether the exporter is ready to be scraped: once it collected metrics, and with the readiness
+// gating once the startup completed.
+func (s *MetricsServer) Ready(w http.ResponseWriter, r *http.Request) {
+	ready, state := s.getMetrics() != "", "waiting for metrics"
+	if s.startup != nil {
+		ready, state = s.startup.Ready()
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if !ready {
+		http.Error(w, "KO: "+state, http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write([]byte("OK"))
+	if err != nil {
+		logrus.WithError(err).Error("Failed to write response.")
+		http.Error(w, "failed to write response", http.StatusInternalServerError)
+	}
+}
+
 func (s *MetricsServer) updateMetrics(m string) {
 	s.Lock()
 	defer s.Unlock()
 
 	s.metrics = m
+
+	// The conversion tracks the counters of every collection, not of every scrape
+	if s.openMetricsConverter != nil {
+		s.openMetricsText = s.openMetricsConverter.convert(m, time.Now())
+	}
 }
 
 func (s *MetricsServer) getMetrics() string {
@@ -164,3 +548,10 @@ func (s *MetricsServer) getMetrics() string {
 
 	return s.metrics
 }
+
+func (s *MetricsServer) getOpenMetrics() string {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.openMetricsText
+}
@@ -0,0 +1,404 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	sysOS "os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func formatExemplarMetrics(t *testing.T) string {
+	t.Helper()
+
+	counter := Counter{FieldName: "DCGM_FI_PROF_GR_ENGINE_ACTIVE", PromType: "gauge", Help: "Ratio of time the graphics engine is active."}
+	metrics := MetricsByCounter{
+		counter: {
+			{
+				GPU:        "0",
+				GPUUUID:    "GPU-0",
+				UUID:       "UUID",
+				Value:      "0.5",
+				Attributes: map[string]string{podAttribute: "gpu-pod-0"},
+				Exemplar: map[string]string{
+					exemplarPodUIDLabel:      "0f4a1e52-7c1b-4d2c-9a8e-3f6b2d1c0e9a",
+					exemplarContainerIDLabel: "4c1f0e9b2a",
+				},
+			},
+			{
+				GPU:        "1",
+				GPUUUID:    "GPU-1",
+				UUID:       "UUID",
+				Value:      "0",
+				Attributes: map[string]string{},
+			},
+		},
+	}
+
+	formatted, err := FormatMetrics(newMetricsTemplate("migMetrics", migMetricsFormat), metrics)
+	require.NoError(t, err)
+
+	return formatted
+}
+
+func TestFormatMetrics_WithExemplars(t *testing.T) {
+	formatted := formatExemplarMetrics(t)
+
+	assert.Contains(t, formatted, `DCGM_FI_PROF_GR_ENGINE_ACTIVE{gpu="0",UUID="GPU-0",pci_bus_id="",device="",modelName="",pod="gpu-pod-0"} 0.5 # {container_id="4c1f0e9b2a",pod_uid="0f4a1e52-7c1b-4d2c-9a8e-3f6b2d1c0e9a"} 0.5
+`)
+	assert.Contains(t, formatted, `DCGM_FI_PROF_GR_ENGINE_ACTIVE{gpu="1",UUID="GPU-1",pci_bus_id="",device="",modelName=""} 0
+`)
+}
+
+func TestStripExemplars(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics string
+		want    string
+	}{
+		{
+			name:    "sample with exemplar",
+			metrics: "# HELP A help\n# TYPE A gauge\nA{pod=\"p\"} 1 # {pod_uid=\"u\"} 1\nA{pod=\"q\"} 2\n",
+			want:    "# HELP A help\n# TYPE A gauge\nA{pod=\"p\"} 1\nA{pod=\"q\"} 2\n",
+		},
+		{
+			name:    "label value containing a hash",
+			metrics: "A{annotation=\"a \\\" # b\"} 1 # {pod_uid=\"u\"} 1",
+			want:    "A{annotation=\"a \\\" # b\"} 1",
+		},
+		{
+			name:    "sample without labels",
+			metrics: "A 1 # {pod_uid=\"u\"} 1\n",
+			want:    "A 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, stripExemplars(tt.metrics))
+		})
+	}
+}
+
+func TestMetricsServer_Metrics(t *testing.T) {
+	formatted := formatExemplarMetrics(t)
+
+	tests := []struct {
+		name            string
+		exemplars       bool
+		openMetrics     bool
+		accept          string
+		wantOpenMetrics bool
+	}{
+		{
+			name:            "OpenMetrics scraper",
+			exemplars:       true,
+			accept:          "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5",
+			wantOpenMetrics: true,
+		},
+		{
+			name:            "OpenMetrics enabled without exemplars",
+			openMetrics:     true,
+			accept:          "application/openmetrics-text;version=1.0.0",
+			wantOpenMetrics: true,
+		},
+		{
+			name:      "text format scraper",
+			exemplars: true,
+			accept:    "text/plain;version=0.0.4",
+		},
+		{
+			name:   "exemplars disabled",
+			accept: "application/openmetrics-text;version=1.0.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _, err := NewMetricsServer(&Config{
+				KubernetesExemplars: tt.exemplars,
+				OpenMetrics:         tt.openMetrics,
+			}, nil, NewRegistry())
+			require.NoError(t, err)
+			server.updateMetrics(formatted)
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+
+			server.Metrics(rec, req)
+
+			body := rec.Body.String()
+			if tt.wantOpenMetrics {
+				assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "application/openmetrics-text"))
+				assert.Contains(t, body, `# {container_id="4c1f0e9b2a",pod_uid="0f4a1e52-7c1b-4d2c-9a8e-3f6b2d1c0e9a"} 0.5`)
+				assert.True(t, strings.HasSuffix(body, "# EOF\n"))
+				return
+			}
+
+			assert.NotContains(t, rec.Header().Get("Content-Type"), "openmetrics")
+			assert.NotContains(t, body, "# EOF")
+			if tt.exemplars {
+				assert.NotContains(t, body, "pod_uid")
+			}
+		})
+	}
+}
+
+// countingCollector counts the gatherings of the exporter metrics.
+type countingCollector struct {
+	gathered int
+}
+
+func (c *countingCollector) GetMetrics() (MetricsByCounter, error) {
+	c.gathered++
+	counter := Counter{FieldName: "DCGM_EXP_COUNTING", PromType: "gauge"}
+	return MetricsByCounter{counter: {{Counter: counter, Value: "1", Attributes: map[string]string{}}}}, nil
+}
+
+func (c *countingCollector) Cleanup() {}
+
+func TestMetricsServer_ScrapeCache(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxAge       int
+		wantGathered int
+	}{
+		{name: "cache disabled", maxAge: 0, wantGathered: 3},
+		{name: "cache enabled", maxAge: 60000, wantGathered: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector := &countingCollector{}
+			registry := NewRegistry()
+			registry.Register(collector)
+
+			server, _, err := NewMetricsServer(&Config{ScrapeCacheMaxAge: tt.maxAge}, nil, registry)
+			require.NoError(t, err)
+
+			for i := 0; i < 3; i++ {
+				rec := httptest.NewRecorder()
+				server.Metrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+				require.Equal(t, http.StatusOK, rec.Code)
+				assert.Contains(t, rec.Body.String(), "DCGM_EXP_COUNTING")
+				assert.Contains(t, rec.Body.String(), dcgmExporterCollectedAtSeconds)
+			}
+			assert.Equal(t, tt.wantGathered, collector.gathered)
+
+			collectedAt, exists := selfMetrics.Value(dcgmExporterCollectedAtSeconds, nil)
+			require.True(t, exists)
+			assert.InDelta(t, float64(time.Now().Unix()), collectedAt, 60)
+		})
+	}
+
+	// The metrics older than the maximum age are gathered again
+	collector := &countingCollector{}
+	registry := NewRegistry()
+	registry.Register(collector)
+	server, _, err := NewMetricsServer(&Config{ScrapeCacheMaxAge: 60000}, nil, registry)
+	require.NoError(t, err)
+
+	_, err = server.scrapeExpMetrics(context.Background())
+	require.NoError(t, err)
+	server.scrapeCache.gatheredAt = time.Now().Add(-time.Minute)
+	_, err = server.scrapeExpMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, collector.gathered)
+}
+
+func TestGetWebConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "web config file",
+			config: &Config{WebConfigFile: "web-config.yaml"},
+		},
+		{
+			name:   "TLS",
+			config: &Config{WebTLSCertFile: "/etc/tls/tls.crt", WebTLSKeyFile: "/etc/tls/tls.key"},
+			want:   "tls_server_config:\n  cert_file: /etc/tls/tls.crt\n  key_file: /etc/tls/tls.key\n",
+		},
+		{
+			name: "mTLS",
+			config: &Config{
+				WebTLSCertFile:     "/etc/tls/tls.crt",
+				WebTLSKeyFile:      "/etc/tls/tls.key",
+				WebTLSClientCAFile: "/etc/tls/ca.crt",
+			},
+			want: "tls_server_config:\n  cert_file: /etc/tls/tls.crt\n  client_auth_type: RequireAndVerifyClientCert\n" +
+				"  client_ca_file: /etc/tls/ca.crt\n  key_file: /etc/tls/tls.key\n",
+		},
+		{
+			name:    "missing key",
+			config:  &Config{WebTLSCertFile: "/etc/tls/tls.crt"},
+			wantErr: true,
+		},
+		{
+			name:    "TLS flags and web config file",
+			config:  &Config{WebConfigFile: "web-config.yaml", WebTLSCertFile: "tls.crt", WebTLSKeyFile: "tls.key"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, cleanup, err := getWebConfigFile(tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			if tt.want == "" {
+				assert.Equal(t, tt.config.WebConfigFile, file)
+				cleanup()
+				return
+			}
+
+			data, err := sysOS.ReadFile(file)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(data))
+
+			cleanup()
+			_, err = sysOS.Stat(file)
+			assert.True(t, sysOS.IsNotExist(err))
+		})
+	}
+}
+
+func TestScrapeContext(t *testing.T) {
+	tests := []struct {
+		header       string
+		wantDeadline bool
+		wantTimeout  time.Duration
+	}{
+		{header: ""},
+		{header: "invalid"},
+		{header: "-1"},
+		{header: "10", wantDeadline: true, wantTimeout: 9500 * time.Millisecond},
+		{header: "0.5", wantDeadline: true, wantTimeout: 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.Header.Set(scrapeTimeoutHeader, tt.header)
+
+			ctx, cancel := scrapeContext(req)
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			require.Equal(t, tt.wantDeadline, ok)
+			if ok {
+				assert.InDelta(t, tt.wantTimeout, time.Until(deadline), float64(100*time.Millisecond))
+			}
+		})
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	// The path of a Unix socket is limited to about 100 characters, shorter than the test directories
+	dir, err := sysOS.MkdirTemp("", "dcgm")
+	require.NoError(t, err)
+	defer sysOS.RemoveAll(dir)
+
+	path := filepath.Join(dir, "exporter.sock")
+
+	// The socket left by a previous run is replaced
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	listener, err := listenUnixSocket(path, "0600")
+	require.NoError(t, err)
+
+	info, err := sysOS.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, sysOS.FileMode(0o600), info.Mode().Perm())
+
+	require.NoError(t, listener.Close())
+	_, err = sysOS.Stat(path)
+	assert.True(t, sysOS.IsNotExist(err))
+
+	regularFile := filepath.Join(dir, "file")
+	require.NoError(t, sysOS.WriteFile(regularFile, nil, 0o644))
+	_, err = listenUnixSocket(regularFile, "0660")
+	assert.Error(t, err)
+
+	_, err = listenUnixSocket(path, "rw")
+	assert.Error(t, err)
+}
+
+func TestMetricsServer_RunUnixSocket(t *testing.T) {
+	dir, err := sysOS.MkdirTemp("", "dcgm")
+	require.NoError(t, err)
+	defer sysOS.RemoveAll(dir)
+
+	path := filepath.Join(dir, "exporter.sock")
+
+	server, cleanup, err := NewMetricsServer(&Config{
+		WebListenUnixSocket:     path,
+		WebListenUnixSocketMode: "0660",
+	}, make(chan string), NewRegistry())
+	require.NoError(t, err)
+	defer cleanup()
+	server.updateMetrics("DCGM_FI_DEV_GPU_TEMP{gpu=\"0\"} 42\n")
+
+	var wg sync.WaitGroup
+	stop := make(chan interface{})
+	wg.Add(1)
+	go server.Run(stop, &wg)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+
+	resp, err := client.Get("http://localhost/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Contains(t, string(body), "DCGM_FI_DEV_GPU_TEMP")
+
+	close(stop)
+	wg.Wait()
+
+	_, err = sysOS.Stat(path)
+	assert.True(t, sysOS.IsNotExist(err))
+}
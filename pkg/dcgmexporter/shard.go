@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+)
+
+// shardLabel identifies the shard of the metrics of an exporter, e.g. shard="2/4"
+const shardLabel = "shard"
+
+// shard is the part of the GPUs or of the fields collected by an exporter. The assignment only depends on the IDs of
+// the GPUs and on the order of the fields, so that the exporters of a node partition them without coordination.
+type shard struct {
+	index int
+	count int
+	by    ShardBy
+}
+
+func newShard(c *Config) shard {
+	if c.ShardCount <= 1 {
+		return shard{}
+	}
+
+	return shard{index: c.ShardIndex, count: c.ShardCount, by: c.ShardBy}
+}
+
+func (s shard) enabled() bool {
+	return s.count > 1
+}
+
+// label returns the value of the shard label, it is empty when sharding is disabled.
+func (s shard) label() string {
+	if !s.enabled() {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", s.index, s.count)
+}
+
+// includes returns whether the n-th GPU or field, counting from 0, belongs to the shard.
+func (s shard) includes(n int) bool {
+	return !s.enabled() || n%s.count == s.index-1
+}
+
+// first returns whether the exporter collects the first shard, which collects the entities that are not GPUs and
+// the exporter metrics that are not sharded.
+func (s shard) first() bool {
+	return !s.enabled() || s.index == 1
+}
+
+// systemInfo returns the system info restricted to the GPUs of the shard, the GPUs whose ID modulo the number of
+// shards is the index of the shard.
+func (s shard) systemInfo(sysInfo SystemInfo) SystemInfo {
+	gpus := map[uint]bool{}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		gpu := sysInfo.GPUs[i].DeviceInfo.GPU
+		if s.includes(int(gpu)) {
+			gpus[gpu] = true
+		}
+	}
+
+	return sysInfoWithGPUs(sysInfo, gpus)
+}
+
+// ApplyShard keeps the fields of the shard of the exporter when the fields are sharded, in the order of the counters
+// files. The label fields are kept by every shard, they label the metrics of the other fields, and the exporter
+// metrics are collected by the first shard.
+func ApplyShard(cs *CounterSet, c *Config) {
+	s := newShard(c)
+	if !s.enabled() || s.by != ShardByField {
+		return
+	}
+
+	var counters []Counter
+	n := 0
+	for _, counter := range cs.DCGMCounters {
+		if counter.PromType == "label" {
+			counters = append(counters, counter)
+			continue
+		}
+
+		if s.includes(n) {
+			counters = append(counters, counter)
+		}
+		n++
+	}
+	cs.DCGMCounters = counters
+
+	if !s.first() {
+		cs.ExporterCounters = nil
+	}
+}
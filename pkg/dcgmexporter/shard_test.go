@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShard_SystemInfo(t *testing.T) {
+	var sysInfo SystemInfo
+	sysInfo.InfoType = dcgm.FE_GPU
+	sysInfo.GPUCount = 5
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo.GPU = i
+	}
+	sysInfo.GPUs[3].GPUInstances = []GPUInstanceInfo{{EntityId: 1}, {EntityId: 2}}
+	sysInfo.gOpt = DeviceOptions{MajorRange: []int{0, 1, 2, 3, 4}, MinorRange: []int{1, 2}}
+
+	gpus := func(c *Config) ([]uint, []int, []int) {
+		restricted := newShard(c).systemInfo(sysInfo)
+		var ids []uint
+		for i := uint(0); i < restricted.GPUCount; i++ {
+			ids = append(ids, restricted.GPUs[i].DeviceInfo.GPU)
+		}
+		return ids, restricted.gOpt.MajorRange, restricted.gOpt.MinorRange
+	}
+
+	// The shards partition the GPUs, the GPU instances follow their GPU
+	ids, major, minor := gpus(&Config{ShardIndex: 1, ShardCount: 2, ShardBy: ShardByGPU})
+	assert.Equal(t, []uint{0, 2, 4}, ids)
+	assert.Equal(t, []int{0, 2, 4}, major)
+	assert.Empty(t, minor)
+
+	ids, major, minor = gpus(&Config{ShardIndex: 2, ShardCount: 2, ShardBy: ShardByGPU})
+	assert.Equal(t, []uint{1, 3}, ids)
+	assert.Equal(t, []int{1, 3}, major)
+	assert.Equal(t, []int{1, 2}, minor)
+
+	ids, _, _ = gpus(&Config{})
+	assert.Equal(t, []uint{0, 1, 2, 3, 4}, ids)
+}
+
+func TestApplyShard(t *testing.T) {
+	counterSet := func() *CounterSet {
+		return &CounterSet{
+			DCGMCounters: []Counter{
+				{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"},
+				{FieldID: dcgm.DCGM_FI_DRIVER_VERSION, FieldName: "DCGM_FI_DRIVER_VERSION", PromType: "label"},
+				{FieldID: dcgm.DCGM_FI_DEV_POWER_USAGE, FieldName: "DCGM_FI_DEV_POWER_USAGE", PromType: "gauge"},
+				{FieldID: dcgm.DCGM_FI_DEV_GPU_UTIL, FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"},
+			},
+			ExporterCounters: []Counter{{FieldName: dcgmExpGPUInfo, PromType: "gauge"}},
+		}
+	}
+	names := func(counters []Counter) []string {
+		var result []string
+		for _, counter := range counters {
+			result = append(result, counter.FieldName)
+		}
+		return result
+	}
+
+	cs := counterSet()
+	ApplyShard(cs, &Config{ShardIndex: 1, ShardCount: 2, ShardBy: ShardByField})
+	assert.Equal(t, []string{"DCGM_FI_DEV_GPU_TEMP", "DCGM_FI_DRIVER_VERSION", "DCGM_FI_DEV_GPU_UTIL"},
+		names(cs.DCGMCounters))
+	assert.Len(t, cs.ExporterCounters, 1)
+
+	// The label fields are kept by every shard, the exporter metrics by the first one
+	cs = counterSet()
+	ApplyShard(cs, &Config{ShardIndex: 2, ShardCount: 2, ShardBy: ShardByField})
+	assert.Equal(t, []string{"DCGM_FI_DRIVER_VERSION", "DCGM_FI_DEV_POWER_USAGE"}, names(cs.DCGMCounters))
+	assert.Empty(t, cs.ExporterCounters)
+
+	// The fields are not sharded with the GPUs
+	cs = counterSet()
+	ApplyShard(cs, &Config{ShardIndex: 2, ShardCount: 2, ShardBy: ShardByGPU})
+	assert.Equal(t, counterSet(), cs)
+}
+
+func TestShard_Label(t *testing.T) {
+	labels, err := newExternalLabels(&Config{ShardIndex: 2, ShardCount: 4, ShardBy: ShardByGPU})
+	require.NoError(t, err)
+	assert.Equal(t, "2/4", labels.labels[shardLabel])
+
+	labels, err = newExternalLabels(&Config{ShardIndex: 1, ShardCount: 1})
+	require.NoError(t, err)
+	assert.NotContains(t, labels.labels, shardLabel)
+}
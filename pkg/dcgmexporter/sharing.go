@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	dcgmExporterGPUSharingReplicas      = "DCGM_EXPORTER_GPU_SHARING_REPLICAS"
+	dcgmExporterContainerGPUMemoryQuota = "DCGM_EXPORTER_CONTAINER_GPU_MEMORY_QUOTA_MIB"
+
+	sharingAttribute = "sharing"
+
+	sharingMPS         = "mps"
+	sharingTimeSlicing = "time-slicing"
+
+	// hamiAllocatedDevicesAnnotation holds the devices HAMi allocated to every container of the pod, in the order of
+	// the containers, e.g. GPU-<UUID>,NVIDIA,8000,30:;, where 8000 is the memory quota in MiB
+	hamiAllocatedDevicesAnnotation = "hami.io/vgpu-devices-allocated"
+)
+
+// addSharingMetrics adds, for the shared GPUs, the number of replicas configured in the device plugin config and the
+// memory quota of every container using a replica, so that the oversubscription of the GPUs can be computed.
+func (p *PodMapper) addSharingMetrics(metrics MetricsByCounter, deviceToPods map[string][]PodInfo) error {
+	replicasCounter := Counter{
+		FieldName: dcgmExporterGPUSharingReplicas,
+		PromType:  "gauge",
+		Help:      "Number of replicas the GPU is shared into by the device plugin.",
+	}
+	quotaCounter := Counter{
+		FieldName: dcgmExporterContainerGPUMemoryQuota,
+		PromType:  "gauge",
+		Help:      "GPU memory quota of the container using a replica of the shared GPU (in MiB).",
+	}
+
+	var replicas, quotas []Metric
+	seen := make(map[string]bool)
+
+	for _, counterMetrics := range metrics {
+		for _, val := range counterMetrics {
+			deviceID, err := val.getIDOfType(p.Config.KubernetesGPUIdType)
+			if err != nil {
+				return err
+			}
+
+			if seen[deviceID] {
+				continue
+			}
+			seen[deviceID] = true
+
+			replicated := false
+			for _, podInfo := range deviceToPods[deviceID] {
+				if podInfo.VGPU == "" || !p.podFilter.matches(podInfo) {
+					continue
+				}
+
+				if podInfo.SharingReplicas > 0 && !replicated {
+					replicated = true
+
+					metric := deviceMetric(val, replicasCounter, strconv.Itoa(podInfo.SharingReplicas))
+					metric.Attributes[sharingAttribute] = podInfo.Sharing
+					replicas = append(replicas, metric)
+				}
+
+				quota, ok := p.containerMemoryQuota(podInfo, val.GPUUUID)
+				if !ok {
+					continue
+				}
+
+				metric := deviceMetric(val, quotaCounter, strconv.FormatUint(quota, 10))
+				p.setPodAttributes(metric.Attributes, podInfo)
+				quotas = append(quotas, metric)
+			}
+		}
+	}
+
+	if len(replicas) > 0 {
+		metrics[replicasCounter] = replicas
+	}
+	if len(quotas) > 0 {
+		metrics[quotaCounter] = quotas
+	}
+
+	return nil
+}
+
+// containerMemoryQuota returns the memory quota in MiB of the container on the shared GPU, the MPS pinned memory
+// limit or the memory allocated by HAMi. Time-slicing doesn't limit the memory.
+func (p *PodMapper) containerMemoryQuota(podInfo PodInfo, gpuUUID string) (uint64, bool) {
+	if limit, exists := podInfo.MPSAttributes[mpsPinnedMemoryLimitAttribute]; exists {
+		quota, err := strconv.ParseUint(limit, 10, 64)
+		return quota, err == nil
+	}
+
+	if p.podMetadata == nil {
+		return 0, false
+	}
+
+	meta, err := p.podMetadata.Get(podInfo.Namespace, podInfo.Name)
+	if err != nil {
+		logrus.WithError(err).Debug("Unable to get pod metadata")
+		return 0, false
+	}
+
+	allocated, exists := meta.Annotations[hamiAllocatedDevicesAnnotation]
+	if !exists {
+		return 0, false
+	}
+
+	containers, err := p.podMetadata.GetContainers(podInfo.Namespace, podInfo.Name)
+	if err != nil {
+		return 0, false
+	}
+
+	for i, container := range containers {
+		if container != podInfo.Container {
+			continue
+		}
+
+		quota, err := parseHAMiMemoryQuota(allocated, i, gpuUUID)
+		if err != nil {
+			logrus.WithError(err).Debugf("Unable to parse the HAMi devices of pod '%s/%s'", podInfo.Namespace,
+				podInfo.Name)
+			return 0, false
+		}
+		return quota, quota > 0
+	}
+
+	return 0, false
+}
+
+// parseHAMiMemoryQuota returns the memory in MiB allocated by HAMi on the GPU to the container at the index, 0 when
+// none is.
+func parseHAMiMemoryQuota(annotation string, containerIndex int, gpuUUID string) (uint64, error) {
+	containers := strings.Split(annotation, ";")
+	if containerIndex >= len(containers) {
+		return 0, nil
+	}
+
+	for _, device := range strings.Split(containers[containerIndex], ":") {
+		if device == "" {
+			continue
+		}
+
+		fields := strings.Split(device, ",")
+		if len(fields) < 3 {
+			return 0, fmt.Errorf("malformed device '%s'", device)
+		}
+		if fields[0] != gpuUUID {
+			continue
+		}
+
+		return strconv.ParseUint(fields[2], 10, 64)
+	}
+
+	return 0, nil
+}
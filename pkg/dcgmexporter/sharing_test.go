@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	sysOS "os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	podresourcesv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/testutils"
+)
+
+func TestParseHAMiMemoryQuota(t *testing.T) {
+	annotation := "GPU-0,NVIDIA,8000,30:GPU-1,NVIDIA,4000,0:;;GPU-1,NVIDIA,2000,0:;"
+
+	for _, tt := range []struct {
+		container int
+		gpu       string
+		want      uint64
+	}{
+		{container: 0, gpu: "GPU-0", want: 8000},
+		{container: 0, gpu: "GPU-1", want: 4000},
+		{container: 1, gpu: "GPU-0", want: 0},
+		{container: 2, gpu: "GPU-1", want: 2000},
+		{container: 5, gpu: "GPU-1", want: 0},
+	} {
+		quota, err := parseHAMiMemoryQuota(annotation, tt.container, tt.gpu)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, quota, "container %d, %s", tt.container, tt.gpu)
+	}
+
+	_, err := parseHAMiMemoryQuota("GPU-0,NVIDIA:;", 0, "GPU-0")
+	assert.Error(t, err)
+}
+
+func TestProcessPodMapper_WithSharingMetrics(t *testing.T) {
+	testutils.RequireLinux(t)
+
+	gpuUUID := "GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5"
+
+	tests := []struct {
+		name         string
+		config       func(configFile string) *Config
+		resourceName string
+		deviceIDs    []string
+		wantReplicas []Metric
+		wantQuotas   []Metric
+	}{
+		{
+			name: "time-slicing",
+			config: func(configFile string) *Config {
+				return &Config{DevicePluginConfig: configFile}
+			},
+			resourceName: nvidiaResourceName + sharedResourceSuffix,
+			deviceIDs:    []string{gpuUUID + "::0", gpuUUID + "::1"},
+			wantReplicas: []Metric{{Value: "4", Attributes: map[string]string{sharingAttribute: sharingTimeSlicing}}},
+		},
+		{
+			name: "hami",
+			config: func(string) *Config {
+				return &Config{KubernetesDeviceIDParsers: []string{"hami"}}
+			},
+			resourceName: nvidiaResourceName,
+			deviceIDs:    []string{gpuUUID + "-0"},
+			wantQuotas: []Metric{{Value: "8000", Attributes: map[string]string{
+				podAttribute:       "gpu-pod-0",
+				namespaceAttribute: "default",
+				containerAttribute: "default",
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, cleanup := CreateTmpDir(t)
+			defer cleanup()
+
+			configFile := tmpDir + "/config.yaml"
+			require.NoError(t, sysOS.WriteFile(configFile, []byte(`
+version: v1
+sharing:
+  timeSlicing:
+    renameByDefault: true
+    resources:
+    - name: nvidia.com/gpu
+      replicas: 4
+`), 0o600))
+
+			getKubeClientHook = func() (kubernetes.Interface, error) {
+				return fake.NewSimpleClientset(&v1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        "gpu-pod-0",
+						Namespace:   "default",
+						Annotations: map[string]string{hamiAllocatedDevicesAnnotation: gpuUUID + ",NVIDIA,8000,30:;"},
+					},
+					Spec: v1.PodSpec{Containers: []v1.Container{{Name: "default"}}},
+				}), nil
+			}
+			defer func() {
+				getKubeClientHook = getKubeClient
+			}()
+
+			socketPath := tmpDir + "/kubelet.sock"
+			server := grpc.NewServer()
+			podresourcesv1.RegisterPodResourcesListerServer(server,
+				NewPodResourcesV1MockServer(tt.resourceName, tt.deviceIDs))
+
+			cleanup = StartMockServer(t, server, socketPath)
+			defer cleanup()
+
+			config := tt.config(configFile)
+			config.KubernetesGPUIdType = GPUUID
+			config.PodResourcesKubeletSocket = socketPath
+			config.KubernetesSharingMetrics = true
+
+			podMapper, err := NewPodMapper(config)
+			require.NoError(t, err)
+			defer podMapper.Close()
+			if podMapper.podMetadata != nil {
+				waitForPodMetadata(t, podMapper.podMetadata)
+			}
+
+			counter := Counter{FieldID: 155, FieldName: "DCGM_FI_DEV_POWER_USAGE", PromType: "gauge"}
+			metrics := MetricsByCounter{
+				counter: {{GPU: "0", GPUUUID: gpuUUID, Value: "42", Counter: counter, Attributes: map[string]string{}}},
+			}
+
+			require.NoError(t, podMapper.Process(metrics, SystemInfo{}))
+
+			assertSharingMetrics(t, tt.wantReplicas, metrics, dcgmExporterGPUSharingReplicas)
+			assertSharingMetrics(t, tt.wantQuotas, metrics, dcgmExporterContainerGPUMemoryQuota)
+		})
+	}
+}
+
+func assertSharingMetrics(t *testing.T, want []Metric, metrics MetricsByCounter, name string) {
+	t.Helper()
+
+	var got []Metric
+	for counter, counterMetrics := range metrics {
+		if counter.FieldName == name {
+			got = counterMetrics
+		}
+	}
+
+	require.Len(t, got, len(want), name)
+	for i := range want {
+		assert.Equal(t, "0", got[i].GPU)
+		assert.Equal(t, want[i].Value, got[i].Value)
+		assert.Equal(t, want[i].Attributes, got[i].Attributes)
+	}
+}
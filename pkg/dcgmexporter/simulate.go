@@ -0,0 +1,420 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	simulatedModel           = "NVIDIA A100-SXM4-80GB"
+	simulatedInstancesPerGPU = 8
+	simulatedLabelValue      = "simulated"
+	simulatedFieldTypeInt64  = "int64"
+	simulatedFieldTypeDouble = "double"
+	simulatedDefaultGaugeMax = 100
+	simulatedProfilingPrefix = "DCGM_FI_PROF_"
+)
+
+// SimulationSpec describes the GPUs of a simulated node and the values of their fields.
+type SimulationSpec struct {
+	// Seed makes the random values reproducible, the current time is used when it is zero
+	Seed   int64                          `yaml:"seed"`
+	GPUs   []SimulatedGPU                 `yaml:"gpus"`
+	Fields map[string]SimulatedFieldValue `yaml:"fields"`
+}
+
+// SimulatedGPU describes Count identical GPUs, split in MIG instances when MIG is set.
+type SimulatedGPU struct {
+	Count int    `yaml:"count"`
+	Model string `yaml:"model"`
+	// UUID is only allowed for a single GPU, the UUIDs are generated otherwise
+	UUID string                 `yaml:"uuid"`
+	MIG  []SimulatedGPUInstance `yaml:"mig"`
+}
+
+// SimulatedGPUInstance describes Count MIG instances of a profile, e.g. 1g.10gb.
+type SimulatedGPUInstance struct {
+	Profile string `yaml:"profile"`
+	Count   int    `yaml:"count"`
+}
+
+// SimulatedFieldValue describes the values of a field. The values are replayed in a loop when Values is set, they are
+// random between Min and Max otherwise, and a counter is increased by a random value between Min and Max.
+type SimulatedFieldValue struct {
+	Type   string   `yaml:"type"`
+	Min    *float64 `yaml:"min"`
+	Max    *float64 `yaml:"max"`
+	Values []string `yaml:"values"`
+}
+
+// LoadSimulationSpec reads and checks a simulation spec file.
+func LoadSimulationSpec(filename string) (*SimulationSpec, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open simulation spec '%s'; err: %w", filename, err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read simulation spec '%s'; err: %w", filename, err)
+	}
+
+	spec := &SimulationSpec{}
+	if err := yaml.UnmarshalStrict(content, spec); err != nil {
+		return nil, fmt.Errorf("invalid simulation spec '%s'; err: %w", filename, err)
+	}
+
+	if err := spec.validate(); err != nil {
+		return nil, fmt.Errorf("invalid simulation spec '%s'; err: %w", filename, err)
+	}
+
+	return spec, nil
+}
+
+func (s *SimulationSpec) validate() error {
+	if len(s.GPUs) == 0 {
+		s.GPUs = []SimulatedGPU{{Count: 1}}
+	}
+
+	count := 0
+	for i, gpu := range s.GPUs {
+		if gpu.Count == 0 {
+			s.GPUs[i].Count = 1
+		}
+		if gpu.Count < 0 {
+			return fmt.Errorf("gpus[%d]: count must be positive", i)
+		}
+		if gpu.UUID != "" && s.GPUs[i].Count != 1 {
+			return fmt.Errorf("gpus[%d]: uuid requires a count of 1", i)
+		}
+		for j, instance := range gpu.MIG {
+			if instance.Profile == "" || instance.Count < 0 {
+				return fmt.Errorf("gpus[%d].mig[%d]: profile and positive count are required", i, j)
+			}
+			if instance.Count == 0 {
+				s.GPUs[i].MIG[j].Count = 1
+			}
+		}
+		count += s.GPUs[i].Count
+	}
+
+	if count > int(dcgm.MAX_NUM_DEVICES) {
+		return fmt.Errorf("%d GPUs simulated, at most %d are supported", count, dcgm.MAX_NUM_DEVICES)
+	}
+
+	for name, field := range s.Fields {
+		if _, exists := dcgm.DCGM_FI[name]; !exists {
+			return fmt.Errorf("fields: unknown DCGM field '%s'", name)
+		}
+		if field.Type != "" && field.Type != simulatedFieldTypeInt64 && field.Type != simulatedFieldTypeDouble {
+			return fmt.Errorf("fields: %s: unknown type '%s'", name, field.Type)
+		}
+		if field.Min != nil && field.Max != nil && *field.Min > *field.Max {
+			return fmt.Errorf("fields: %s: min is greater than max", name)
+		}
+	}
+
+	return nil
+}
+
+// SystemInfo returns the GPUs of the spec, the GPUs with MIG instances have MIG enabled.
+func (s *SimulationSpec) SystemInfo(gOpt DeviceOptions) (SystemInfo, error) {
+	sysInfo := SystemInfo{InfoType: dcgm.FE_GPU}
+
+	for _, gpu := range s.GPUs {
+		model := gpu.Model
+		if model == "" {
+			model = simulatedModel
+		}
+
+		for n := 0; n < gpu.Count; n++ {
+			id := sysInfo.GPUCount
+			uuid := gpu.UUID
+			if uuid == "" {
+				uuid = fmt.Sprintf("GPU-00000000-0000-0000-0000-%012d", id)
+			}
+
+			info := GPUInfo{
+				DeviceInfo: dcgm.Device{
+					GPU:  id,
+					UUID: uuid,
+					PCI:  dcgm.PCIInfo{BusID: fmt.Sprintf("00000000:%02X:00.0", id+1)},
+					Identifiers: dcgm.DeviceIdentifiers{
+						Brand: "NVIDIA",
+						Model: model,
+					},
+				},
+			}
+
+			for _, instance := range gpu.MIG {
+				for k := 0; k < instance.Count; k++ {
+					instanceID := uint(len(info.GPUInstances))
+					info.GPUInstances = append(info.GPUInstances, GPUInstanceInfo{
+						Info: dcgm.MigEntityInfo{
+							GpuUuid:        uuid,
+							NvmlGpuIndex:   id,
+							NvmlInstanceId: instanceID,
+						},
+						ProfileName: instance.Profile,
+						EntityId:    id*simulatedInstancesPerGPU + instanceID,
+					})
+				}
+			}
+			info.MigEnabled = len(info.GPUInstances) > 0
+
+			sysInfo.GPUs[id] = info
+			sysInfo.GPUCount++
+		}
+	}
+
+	NormalizeMigInfo(&sysInfo)
+
+	gOpt, err := resolveDeviceUUIDs(sysInfo, gOpt)
+	if err != nil {
+		return sysInfo, err
+	}
+	sysInfo.gOpt = gOpt
+
+	return sysInfo, VerifyDevicePresence(&sysInfo, gOpt)
+}
+
+// ProfilingMetricGroups returns a metric group with all the profiling fields, for the simulation and the replay, as
+// they do not query the metric groups of the GPUs.
+func ProfilingMetricGroups() []dcgm.MetricGroup {
+	group := dcgm.MetricGroup{}
+	for _, fieldID := range dcgm.DCGM_FI {
+		if fieldID >= dcpFieldsStart && fieldID < cpuFieldsStart {
+			group.FieldIds = append(group.FieldIds, uint(fieldID))
+		}
+	}
+
+	return []dcgm.MetricGroup{group}
+}
+
+// NewSimulatedEntityGroupTypeSystemInfo returns the GPUs of the spec with the GPU fields of the counters; the NvSwitch
+// and CPU fields are not simulated.
+func NewSimulatedEntityGroupTypeSystemInfo(
+	c []Counter, config *Config, spec *SimulationSpec,
+) (*FieldEntityGroupTypeSystemInfo, error) {
+	sysInfo, err := spec.SystemInfo(config.GPUDevices)
+	if err != nil {
+		return nil, err
+	}
+
+	var deviceFields []dcgm.Short
+	for _, counter := range c {
+		if strings.HasPrefix(counter.FieldName, "DCGM_FI_DEV_NVSWITCH_") || counter.FieldID >= cpuFieldsStart {
+			continue
+		}
+		deviceFields = append(deviceFields, counter.FieldID)
+	}
+
+	e := NewEntityGroupTypeSystemInfo(c, config)
+	if ShouldMonitorDeviceType(deviceFields, dcgm.FE_GPU) {
+		e.items[dcgm.FE_GPU] = FieldEntityGroupTypeSystemInfoItem{
+			SystemInfo:   sysInfo,
+			DeviceFields: deviceFields,
+		}
+	}
+
+	return e, nil
+}
+
+// NewSimulatedCollector returns a collector constructor reading the values of the fields from the simulator instead
+// of DCGM.
+func NewSimulatedCollector(spec *SimulationSpec) DCGMCollectorConstructor {
+	return func(
+		c []Counter, hostname string, config *Config, item FieldEntityGroupTypeSystemInfoItem,
+	) (*DCGMCollector, func(), error) {
+		if item.isEmpty() {
+			return nil, func() {}, fmt.Errorf("fieldEntityGroupTypeSystemInfo is empty")
+		}
+
+		collector := &DCGMCollector{
+			Counters:     c,
+			DeviceFields: item.DeviceFields,
+			SysInfo:      item.SystemInfo,
+			Hostname:     hostname,
+			source:       newSimulator(spec, c),
+			// The values are simulated one entity after the other, so that the seed reproduces them
+			workers: 1,
+		}
+
+		if config != nil {
+			collector.UseOldNamespace = config.UseOldNamespace
+			collector.ReplaceBlanksInModelName = config.ReplaceBlanksInModelName
+			collector.aggregator = newFieldAggregator(config)
+			collector.resets = newCounterResets(config)
+			if config.MonotonicCounters {
+				collector.Counters = monotonicCounters(c)
+			}
+			if config.EnergyCounters {
+				collector.Counters = energyCounters(collector.Counters)
+				collector.energyJoules = true
+			}
+			if config.MetricNames == MetricNamesPrometheus {
+				collector.Counters, collector.unitScales = prometheusCounters(collector.Counters)
+			}
+		}
+
+		return collector, func() {}, nil
+	}
+}
+
+type simulatedKey struct {
+	entity dcgm.GroupEntityPair
+	field  dcgm.Short
+}
+
+// simulator generates the values of the fields, the counters keep increasing between the collections.
+type simulator struct {
+	sync.Mutex
+	spec     *SimulationSpec
+	counters map[dcgm.Short]Counter
+	rand     *rand.Rand
+	steps    map[simulatedKey]int
+	totals   map[simulatedKey]float64
+}
+
+func newSimulator(spec *SimulationSpec, c []Counter) *simulator {
+	seed := spec.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	counters := make(map[dcgm.Short]Counter, len(c))
+	for _, counter := range c {
+		counters[counter.FieldID] = counter
+	}
+
+	return &simulator{
+		spec:     spec,
+		counters: counters,
+		rand:     rand.New(rand.NewSource(seed)),
+		steps:    map[simulatedKey]int{},
+		totals:   map[simulatedKey]float64{},
+	}
+}
+
+func (s *simulator) latestValues(
+	entity dcgm.GroupEntityPair, _ uint, fields []dcgm.Short,
+) ([]dcgm.FieldValue_v1, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now().UnixMicro()
+	values := make([]dcgm.FieldValue_v1, 0, len(fields))
+	for _, fieldID := range fields {
+		value := s.value(simulatedKey{entity: entity, field: fieldID})
+		value.FieldId = uint(fieldID)
+		value.Ts = now
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func (s *simulator) collected(SystemInfo) {}
+
+func (s *simulator) value(key simulatedKey) dcgm.FieldValue_v1 {
+	counter := s.counters[key.field]
+	spec := s.spec.Fields[counter.FieldName]
+
+	if counter.PromType == "label" {
+		value := simulatedLabelValue
+		if len(spec.Values) > 0 {
+			value = spec.Values[s.steps[key]%len(spec.Values)]
+			s.steps[key]++
+		}
+		return stringFieldValue(value)
+	}
+
+	var value float64
+	switch {
+	case len(spec.Values) > 0:
+		value, _ = strconv.ParseFloat(spec.Values[s.steps[key]%len(spec.Values)], 64)
+		s.steps[key]++
+	case counter.PromType == "counter":
+		s.totals[key] += s.random(spec, 0, simulatedDefaultGaugeMax)
+		value = s.totals[key]
+	case counter.PromType == bitmaskPromType:
+		value = s.random(spec, 0, 0)
+	case strings.HasPrefix(counter.FieldName, simulatedProfilingPrefix):
+		value = s.random(spec, 0, 1)
+	default:
+		value = s.random(spec, 0, simulatedDefaultGaugeMax)
+	}
+
+	fieldType := spec.Type
+	if fieldType == "" {
+		fieldType = simulatedFieldTypeInt64
+		if strings.HasPrefix(counter.FieldName, simulatedProfilingPrefix) {
+			fieldType = simulatedFieldTypeDouble
+		}
+	}
+
+	if fieldType == simulatedFieldTypeDouble {
+		return doubleFieldValue(value)
+	}
+
+	return int64FieldValue(int64(math.Round(value)))
+}
+
+func (s *simulator) random(spec SimulatedFieldValue, min, max float64) float64 {
+	if spec.Min != nil {
+		min = *spec.Min
+	}
+	if spec.Max != nil {
+		max = *spec.Max
+	}
+	if max < min {
+		max = min
+	}
+
+	return min + s.rand.Float64()*(max-min)
+}
+
+func int64FieldValue(v int64) dcgm.FieldValue_v1 {
+	value := dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_INT64}
+	binary.NativeEndian.PutUint64(value.Value[:], uint64(v))
+	return value
+}
+
+func doubleFieldValue(v float64) dcgm.FieldValue_v1 {
+	value := dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_DOUBLE}
+	binary.NativeEndian.PutUint64(value.Value[:], math.Float64bits(v))
+	return value
+}
+
+func stringFieldValue(v string) dcgm.FieldValue_v1 {
+	value := dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_STRING}
+	copy(value.Value[:len(value.Value)-1], v)
+	return value
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	sysOS "os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSimulationSpec(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "simulation.yaml")
+	require.NoError(t, sysOS.WriteFile(path, []byte(content), 0o644))
+
+	return path
+}
+
+func TestLoadSimulationSpec_Example(t *testing.T) {
+	spec, err := LoadSimulationSpec("../../etc/simulation.yaml")
+	require.NoError(t, err)
+
+	sysInfo, err := spec.SystemInfo(DeviceOptions{Flex: true})
+	require.NoError(t, err)
+	assert.Equal(t, uint(3), sysInfo.GPUCount)
+	assert.Len(t, sysInfo.GPUs[2].GPUInstances, 3)
+	assert.Equal(t, "GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5", sysInfo.GPUs[2].DeviceInfo.UUID)
+}
+
+func TestLoadSimulationSpec_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "unknown option",
+			content: "gpu: []\n",
+			wantErr: "field gpu not found",
+		},
+		{
+			name:    "uuid of several GPUs",
+			content: "gpus: [{count: 2, uuid: GPU-1}]\n",
+			wantErr: "uuid requires a count of 1",
+		},
+		{
+			name:    "MIG instance without profile",
+			content: "gpus: [{mig: [{count: 2}]}]\n",
+			wantErr: "profile and positive count are required",
+		},
+		{
+			name:    "unknown field",
+			content: "fields: {DCGM_FI_DEV_GPU_TEMPERATURE: {min: 1}}\n",
+			wantErr: "unknown DCGM field 'DCGM_FI_DEV_GPU_TEMPERATURE'",
+		},
+		{
+			name:    "min greater than max",
+			content: "fields: {DCGM_FI_DEV_GPU_TEMP: {min: 10, max: 1}}\n",
+			wantErr: "min is greater than max",
+		},
+		{
+			name:    "too many GPUs",
+			content: "gpus: [{count: 100}]\n",
+			wantErr: "at most",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadSimulationSpec(writeSimulationSpec(t, tt.content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestSimulatedCollector(t *testing.T) {
+	spec, err := LoadSimulationSpec(writeSimulationSpec(t, `
+seed: 1
+gpus:
+- count: 1
+  model: NVIDIA T4
+- uuid: GPU-mig
+  mig:
+  - profile: 1g.10gb
+    count: 2
+fields:
+  DCGM_FI_DEV_GPU_TEMP: {min: 30, max: 40}
+  DCGM_FI_DEV_XID_ERRORS: {values: [0, 79]}
+`))
+	require.NoError(t, err)
+
+	counters := []Counter{
+		{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_DEV_XID_ERRORS, FieldName: "DCGM_FI_DEV_XID_ERRORS", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION, FieldName: "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION",
+			PromType: "counter"},
+		{FieldID: dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE, FieldName: "DCGM_FI_PROF_GR_ENGINE_ACTIVE", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_DRIVER_VERSION, FieldName: "DCGM_FI_DRIVER_VERSION", PromType: "label"},
+		{FieldID: dcgm.DCGM_FI_DEV_CPU_UTIL_TOTAL, FieldName: "DCGM_FI_DEV_CPU_UTIL_TOTAL", PromType: "gauge"},
+	}
+
+	config := &Config{GPUDevices: DeviceOptions{Flex: true}}
+	systemInfo, err := NewSimulatedEntityGroupTypeSystemInfo(counters, config, spec)
+	require.NoError(t, err)
+
+	item, exists := systemInfo.Get(dcgm.FE_GPU)
+	require.True(t, exists)
+	assert.NotContains(t, item.DeviceFields, dcgm.Short(dcgm.DCGM_FI_DEV_CPU_UTIL_TOTAL))
+
+	collector, cleanup, err := NewSimulatedCollector(spec)(counters, "node", config, item)
+	require.NoError(t, err)
+	defer cleanup()
+
+	var energy []float64
+	for i := 0; i < 2; i++ {
+		metrics, err := collector.GetMetrics()
+		require.NoError(t, err)
+
+		temps := metrics[counters[0]]
+		// The GPU and the two MIG instances of the second GPU
+		require.Len(t, temps, 3)
+		assert.Equal(t, "NVIDIA T4", temps[0].GPUModelName)
+		assert.Equal(t, "GPU-mig", temps[1].GPUUUID)
+		assert.Equal(t, "1g.10gb", temps[1].MigProfile)
+		assert.Equal(t, "1", temps[2].GPUInstanceID)
+		assert.Equal(t, "simulated", temps[0].Labels["DCGM_FI_DRIVER_VERSION"])
+
+		for _, m := range temps {
+			v, err := strconv.Atoi(m.Value)
+			require.NoError(t, err)
+			assert.True(t, v >= 30 && v <= 40, "temperature %d out of range", v)
+		}
+
+		assert.Equal(t, []string{"0", "79"}[i], metrics[counters[1]][0].Value)
+
+		activity, err := strconv.ParseFloat(metrics[counters[3]][0].Value, 64)
+		require.NoError(t, err)
+		assert.True(t, activity >= 0 && activity <= 1)
+
+		v, err := strconv.ParseFloat(metrics[counters[2]][0].Value, 64)
+		require.NoError(t, err)
+		energy = append(energy, v)
+	}
+
+	assert.GreaterOrEqual(t, energy[1], energy[0], "counters must not decrease")
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sinkTimeout bounds the time a sink can spend writing the metrics of a collection.
+var sinkTimeout = 10 * time.Second
+
+// MetricsSink receives the metrics of every collection, in addition to the Prometheus endpoint.
+type MetricsSink interface {
+	Name() string
+	Write(ctx context.Context, metrics MetricsByCounter, timestamp time.Time) error
+	Close() error
+}
+
+type sinkBatch struct {
+	metrics   MetricsByCounter
+	timestamp time.Time
+}
+
+// sinkWriter writes to a sink in its own goroutine, so a slow sink doesn't delay the collection. Batches
+// arriving while the sink is still busy are dropped.
+type sinkWriter struct {
+	sink    MetricsSink
+	batches chan sinkBatch
+}
+
+func getSinks(c *Config, hostname string) ([]MetricsSink, error) {
+	var sinks []MetricsSink
+
+	if c.OTLPEndpoint != "" {
+		otlpSink, err := NewOTLPSink(c, hostname)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, otlpSink)
+	}
+
+	if c.StatsDAddress != "" {
+		statsdSink, err := NewStatsDSink(c)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, statsdSink)
+	}
+
+	if len(c.KafkaBrokers) > 0 {
+		kafkaSink, err := NewKafkaSink(c, hostname)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, kafkaSink)
+	}
+
+	if len(c.WebhookURLs) > 0 {
+		webhookSink, err := NewWebhookSink(c, hostname)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, webhookSink)
+	}
+
+	return sinks, nil
+}
+
+func newSinkWriters(sinks []MetricsSink) []*sinkWriter {
+	writers := make([]*sinkWriter, 0, len(sinks))
+	for _, sink := range sinks {
+		writers = append(writers, &sinkWriter{
+			sink:    sink,
+			batches: make(chan sinkBatch, 1),
+		})
+	}
+
+	return writers
+}
+
+func (s *sinkWriter) run(stop chan interface{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for {
+		select {
+		case <-stop:
+			if err := s.sink.Close(); err != nil {
+				logrus.WithError(err).Warnf("Failed to close sink '%s'", s.sink.Name())
+			}
+			return
+		case batch := <-s.batches:
+			ctx, cancel := context.WithTimeout(context.Background(), sinkTimeout)
+			err := s.sink.Write(ctx, batch.metrics, batch.timestamp)
+			cancel()
+			if err != nil {
+				logrus.WithError(err).Warnf("Failed to write metrics to sink '%s'", s.sink.Name())
+			}
+		}
+	}
+}
+
+func (s *sinkWriter) offer(batch sinkBatch) {
+	select {
+	case s.batches <- batch:
+	default:
+		logrus.Warnf("Sink '%s' is busy, skipping metrics", s.sink.Name())
+	}
+}
+
+// mergeMetrics appends the metrics of src to dst.
+func mergeMetrics(dst, src MetricsByCounter) {
+	for counter, metrics := range src {
+		dst[counter] = append(dst[counter], metrics...)
+	}
+}
+
+// metricAttributes returns the attributes of the metric matching its Prometheus labels, except the GPU UUID
+// and the hostname.
+func metricAttributes(metric Metric) map[string]string {
+	attributes := map[string]string{}
+
+	if metric.GPU != "" {
+		attributes["gpu"] = metric.GPU
+	}
+	if metric.GPUDevice != "" {
+		attributes["device"] = metric.GPUDevice
+	}
+	if metric.GPUModelName != "" {
+		attributes["modelName"] = metric.GPUModelName
+	}
+	if metric.GPUPCIBusID != "" {
+		attributes["pci_bus_id"] = metric.GPUPCIBusID
+	}
+	if metric.GPUInstanceID != "" {
+		attributes["GPU_I_PROFILE"] = metric.MigProfile
+		attributes["GPU_I_ID"] = metric.GPUInstanceID
+	}
+	if metric.ComputeInstanceID != "" {
+		attributes["GPU_CI_ID"] = metric.ComputeInstanceID
+	}
+
+	for k, v := range metric.Labels {
+		attributes[k] = v
+	}
+	for k, v := range metric.Attributes {
+		attributes[k] = v
+	}
+
+	return attributes
+}
+
+func sortedCounters(metrics MetricsByCounter) []Counter {
+	counters := make([]Counter, 0, len(metrics))
+	for counter := range metrics {
+		counters = append(counters, counter)
+	}
+	sort.Slice(counters, func(i, j int) bool { return counters[i].FieldName < counters[j].FieldName })
+
+	return counters
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSink struct {
+	written chan MetricsByCounter
+	block   chan struct{}
+	closed  bool
+}
+
+func (s *fakeSink) Name() string {
+	return "fake"
+}
+
+func (s *fakeSink) Write(_ context.Context, metrics MetricsByCounter, _ time.Time) error {
+	<-s.block
+	s.written <- metrics
+	return nil
+}
+
+func (s *fakeSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestSinkWriter(t *testing.T) {
+	sink := &fakeSink{
+		written: make(chan MetricsByCounter, 10),
+		block:   make(chan struct{}),
+	}
+	writer := newSinkWriters([]MetricsSink{sink})[0]
+
+	var wg sync.WaitGroup
+	stop := make(chan interface{})
+	wg.Add(1)
+	go writer.run(stop, &wg)
+
+	counter := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP"}
+	first := MetricsByCounter{counter: {{Value: "1"}}}
+
+	writer.offer(sinkBatch{metrics: first})
+	require.Eventually(t, func() bool { return len(writer.batches) == 0 }, time.Second, time.Millisecond)
+
+	// The sink is busy with the first batch, the third one is dropped
+	writer.offer(sinkBatch{metrics: MetricsByCounter{counter: {{Value: "2"}}}})
+	writer.offer(sinkBatch{metrics: MetricsByCounter{counter: {{Value: "3"}}}})
+
+	close(sink.block)
+	assert.Equal(t, first, <-sink.written)
+	assert.Equal(t, "2", (<-sink.written)[counter][0].Value)
+
+	close(stop)
+	wg.Wait()
+	assert.True(t, sink.closed)
+	assert.Empty(t, sink.written)
+}
+
+func TestMergeMetrics(t *testing.T) {
+	gpuCounter := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP"}
+	cpuCounter := Counter{FieldName: "DCGM_FI_DEV_CPU_TEMP_CURRENT"}
+
+	dst := MetricsByCounter{gpuCounter: {{GPU: "0"}}}
+	mergeMetrics(dst, MetricsByCounter{
+		gpuCounter: {{GPU: "1"}},
+		cpuCounter: {{GPU: "0"}},
+	})
+
+	assert.Equal(t, MetricsByCounter{
+		gpuCounter: {{GPU: "0"}, {GPU: "1"}},
+		cpuCounter: {{GPU: "0"}},
+	}, dst)
+}
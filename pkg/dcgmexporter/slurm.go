@@ -0,0 +1,310 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	slurmJobIDAttribute     = "job_id"
+	slurmUserAttribute      = "user"
+	slurmPartitionAttribute = "partition"
+)
+
+var slurmAttributes = []string{slurmJobIDAttribute, slurmUserAttribute, slurmPartitionAttribute}
+
+// slurmCommandTimeout bounds the time spent querying the Slurm controller on every collection.
+var slurmCommandTimeout = 5 * time.Second
+
+var slurmCommandHook = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).Output()
+}
+
+var (
+	slurmJobIDRegex     = regexp.MustCompile(`(?:^|\s)JobId=(\S+)`)
+	slurmUserRegex      = regexp.MustCompile(`(?:^|\s)UserId=([^\s(]+)`)
+	slurmPartitionRegex = regexp.MustCompile(`(?:^|\s)Partition=(\S+)`)
+	// The details of the allocation on every group of nodes, e.g. Nodes=node[1-2] CPU_IDs=0-7 Mem=0 GRES=gpu:2(IDX:0-1)
+	slurmNodesRegex  = regexp.MustCompile(`(?:^|\s)Nodes=(\S+) CPU_IDs=\S+ Mem=\S+ GRES=(\S*)`)
+	slurmGPUIDXRegex = regexp.MustCompile(`gpu[^(,]*\(IDX:([0-9,\-]+)\)`)
+)
+
+type slurmJob struct {
+	ID        string
+	User      string
+	Partition string
+	// GPUs are the indexes of the GPUs of the node allocated to the job
+	GPUs []string
+}
+
+// slurmMapper adds the Slurm jobs running on the GPUs to the attributes of the GPU metrics. The jobs are read
+// from squeue and scontrol on every collection.
+type slurmMapper struct {
+	Config     *Config
+	nodeName   string
+	attributes []string
+}
+
+func newSlurmMapper(c *Config) (*slurmMapper, error) {
+	attributes := c.SlurmJobLabels
+	if len(attributes) == 0 {
+		attributes = slurmAttributes
+	}
+	for _, attribute := range attributes {
+		if !slices.Contains(slurmAttributes, attribute) {
+			return nil, fmt.Errorf("invalid Slurm job label '%s'; supported labels are %s", attribute,
+				strings.Join(slurmAttributes, ", "))
+		}
+	}
+
+	nodeName, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	// Slurm node names are short host names by default
+	nodeName, _, _ = strings.Cut(nodeName, ".")
+
+	logrus.Infof("Slurm job mapping is enabled for the node %q", nodeName)
+
+	return &slurmMapper{
+		Config:     c,
+		nodeName:   nodeName,
+		attributes: attributes,
+	}, nil
+}
+
+func (p *slurmMapper) Name() string {
+	return "slurmMapper"
+}
+
+func (p *slurmMapper) Process(metrics MetricsByCounter, _ SystemInfo) error {
+	ctx, cancel := context.WithTimeout(context.Background(), slurmCommandTimeout)
+	defer cancel()
+
+	jobs, err := getSlurmJobs(ctx, p.nodeName)
+	if err != nil {
+		logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(),
+			"Unable to get the Slurm jobs of the node. Ignoring.")
+		return nil
+	}
+
+	gpuToJobs := map[string][]slurmJob{}
+	for _, job := range jobs {
+		for _, gpu := range job.GPUs {
+			gpuToJobs[gpu] = append(gpuToJobs[gpu], job)
+		}
+	}
+
+	mapping := fmt.Sprintf("%+v", gpuToJobs)
+	logSampled(logrus.WithField("mapping", mapping), logrus.DebugLevel, mapping, "GPU to Slurm job mapping")
+
+	for counter := range metrics {
+		var modifiedMetrics []Metric
+		for _, metric := range metrics[counter] {
+			jobs, exists := gpuToJobs[metric.GPU]
+			if !exists {
+				modifiedMetrics = append(modifiedMetrics, metric)
+				continue
+			}
+
+			for _, job := range jobs {
+				modifiedMetric := metric.withAttributes()
+				p.setAttributes(modifiedMetric.Attributes, job)
+				modifiedMetrics = append(modifiedMetrics, modifiedMetric)
+			}
+		}
+		metrics[counter] = modifiedMetrics
+	}
+
+	return nil
+}
+
+func (p *slurmMapper) setAttributes(attributes map[string]string, job slurmJob) {
+	for _, attribute := range p.attributes {
+		switch attribute {
+		case slurmJobIDAttribute:
+			attributes[attribute] = job.ID
+		case slurmUserAttribute:
+			attributes[attribute] = job.User
+		case slurmPartitionAttribute:
+			attributes[attribute] = job.Partition
+		}
+	}
+}
+
+// getSlurmJobs returns the jobs running on the node with the GPUs of the node allocated to them.
+func getSlurmJobs(ctx context.Context, nodeName string) ([]slurmJob, error) {
+	out, err := slurmCommandHook(ctx, "squeue", "--noheader", "--states=RUNNING", "--format=%A",
+		"--nodelist="+nodeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the jobs with squeue; err: %w", err)
+	}
+
+	var jobs []slurmJob
+	for _, id := range strings.Fields(string(out)) {
+		out, err := slurmCommandHook(ctx, "scontrol", "show", "job", "--details", "--oneliner", id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the job '%s' with scontrol; err: %w", id, err)
+		}
+
+		job, err := parseSlurmJob(string(out), nodeName)
+		if err != nil {
+			return nil, err
+		}
+		if len(job.GPUs) > 0 {
+			jobs = append(jobs, job)
+		}
+	}
+
+	return jobs, nil
+}
+
+// parseSlurmJob parses the output of scontrol show job --details --oneliner, keeping the GPUs of the node.
+func parseSlurmJob(out string, nodeName string) (slurmJob, error) {
+	var job slurmJob
+
+	match := slurmJobIDRegex.FindStringSubmatch(out)
+	if match == nil {
+		return job, fmt.Errorf("unable to parse the Slurm job '%s'", strings.TrimSpace(out))
+	}
+	job.ID = match[1]
+
+	if match := slurmUserRegex.FindStringSubmatch(out); match != nil {
+		job.User = match[1]
+	}
+	if match := slurmPartitionRegex.FindStringSubmatch(out); match != nil {
+		job.Partition = match[1]
+	}
+
+	for _, nodes := range slurmNodesRegex.FindAllStringSubmatch(out, -1) {
+		hosts, err := expandSlurmHostlist(nodes[1])
+		if err != nil {
+			return job, err
+		}
+		if !slices.Contains(hosts, nodeName) {
+			continue
+		}
+
+		for _, gres := range slurmGPUIDXRegex.FindAllStringSubmatch(nodes[2], -1) {
+			gpus, err := expandSlurmRanges(gres[1])
+			if err != nil {
+				return job, fmt.Errorf("unable to parse the GPUs of the Slurm job '%s'; err: %w", job.ID, err)
+			}
+			job.GPUs = append(job.GPUs, gpus...)
+		}
+	}
+
+	return job, nil
+}
+
+// expandSlurmHostlist expands a Slurm hostlist expression, e.g. node[1-2,05],gpu to node1,node2,node05,gpu.
+func expandSlurmHostlist(hostlist string) ([]string, error) {
+	var hosts []string
+
+	for hostlist != "" {
+		// The hosts are separated by the commas outside of the brackets
+		end, depth := len(hostlist), 0
+		for i, c := range hostlist {
+			if c == '[' {
+				depth++
+			} else if c == ']' {
+				depth--
+			} else if c == ',' && depth == 0 {
+				end = i
+				break
+			}
+		}
+
+		expanded, err := expandSlurmHost(hostlist[:end])
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, expanded...)
+
+		hostlist = strings.TrimPrefix(hostlist[end:], ",")
+	}
+
+	return hosts, nil
+}
+
+func expandSlurmHost(host string) ([]string, error) {
+	open := strings.Index(host, "[")
+	if open < 0 {
+		return []string{host}, nil
+	}
+	closing := strings.Index(host[open:], "]")
+	if closing < 0 {
+		return nil, fmt.Errorf("invalid Slurm hostlist '%s'", host)
+	}
+	closing += open
+
+	values, err := expandSlurmRanges(host[open+1 : closing])
+	if err != nil {
+		return nil, fmt.Errorf("invalid Slurm hostlist '%s'; err: %w", host, err)
+	}
+
+	suffixes, err := expandSlurmHost(host[closing+1:])
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	for _, value := range values {
+		for _, suffix := range suffixes {
+			hosts = append(hosts, host[:open]+value+suffix)
+		}
+	}
+
+	return hosts, nil
+}
+
+// expandSlurmRanges expands a list of ranges, e.g. 0-2,5 to 0,1,2,5. The zero padding of the ranges is kept.
+func expandSlurmRanges(ranges string) ([]string, error) {
+	var values []string
+
+	for _, r := range strings.Split(ranges, ",") {
+		first, last, found := strings.Cut(r, "-")
+		if !found {
+			last = first
+		}
+
+		start, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range '%s'", r)
+		}
+		end, err := strconv.Atoi(last)
+		if err != nil || end < start {
+			return nil, fmt.Errorf("invalid range '%s'", r)
+		}
+
+		for i := start; i <= end; i++ {
+			values = append(values, fmt.Sprintf("%0*d", len(first), i))
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandSlurmHostlist(t *testing.T) {
+	tests := []struct {
+		hostlist string
+		want     []string
+		wantErr  bool
+	}{
+		{hostlist: "node1", want: []string{"node1"}},
+		{hostlist: "node[1-3,05],gpu", want: []string{"node1", "node2", "node3", "node05", "gpu"}},
+		{hostlist: "rack[1-2]-n[01-02]", want: []string{"rack1-n01", "rack1-n02", "rack2-n01", "rack2-n02"}},
+		{hostlist: "node[1-", wantErr: true},
+		{hostlist: "node[3-1]", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.hostlist, func(t *testing.T) {
+			got, err := expandSlurmHostlist(tt.hostlist)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseSlurmJob(t *testing.T) {
+	out := "JobId=42 JobName=train UserId=alice(1000) GroupId=alice(1000) Partition=gpu NumNodes=2 " +
+		"NodeList=node[1-2] JOB_GRES=gpu:a100:3 Nodes=node1 CPU_IDs=0-7 Mem=0 GRES=gpu:a100:2(IDX:0,2) " +
+		"Nodes=node2 CPU_IDs=0-3 Mem=0 GRES=gpu:a100:1(IDX:1) Command=/bin/train\n"
+
+	job, err := parseSlurmJob(out, "node1")
+	require.NoError(t, err)
+	assert.Equal(t, slurmJob{ID: "42", User: "alice", Partition: "gpu", GPUs: []string{"0", "2"}}, job)
+
+	job, err = parseSlurmJob(out, "node3")
+	require.NoError(t, err)
+	assert.Empty(t, job.GPUs)
+
+	_, err = parseSlurmJob("slurm_load_jobs error: Invalid job id specified", "node1")
+	assert.Error(t, err)
+}
+
+func TestSlurmMapper_Process(t *testing.T) {
+	defer func(hook func(context.Context, string, ...string) ([]byte, error)) {
+		slurmCommandHook = hook
+	}(slurmCommandHook)
+
+	jobs := map[string]string{
+		"7": "JobId=7 UserId=bob(1001) Partition=debug Nodes=node1 CPU_IDs=0 Mem=0 GRES=gpu:1(IDX:1)",
+		"8": "JobId=8 UserId=carol(1002) Partition=batch Nodes=node1 CPU_IDs=1 Mem=0 GRES=",
+	}
+	slurmCommandHook = func(_ context.Context, name string, args ...string) ([]byte, error) {
+		switch name {
+		case "squeue":
+			assert.Contains(t, args, "--nodelist=node1")
+			return []byte("7\n8\n"), nil
+		case "scontrol":
+			return []byte(jobs[args[len(args)-1]]), nil
+		}
+		return nil, fmt.Errorf("unexpected command %s %s", name, strings.Join(args, " "))
+	}
+
+	counter := Counter{FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"}
+	newMetrics := func() MetricsByCounter {
+		return MetricsByCounter{counter: {
+			{Counter: counter, GPU: "0", Value: "1", Attributes: map[string]string{}},
+			{Counter: counter, GPU: "1", Value: "2", Attributes: map[string]string{}},
+		}}
+	}
+
+	mapper := &slurmMapper{nodeName: "node1", attributes: []string{slurmJobIDAttribute, slurmUserAttribute}}
+
+	metrics := newMetrics()
+	require.NoError(t, mapper.Process(metrics, SystemInfo{}))
+	require.Len(t, metrics[counter], 2)
+	assert.Empty(t, metrics[counter][0].Attributes)
+	assert.Equal(t, map[string]string{slurmJobIDAttribute: "7", slurmUserAttribute: "bob"},
+		metrics[counter][1].Attributes)
+
+	// The metrics are left unchanged when Slurm is not reachable
+	slurmCommandHook = func(context.Context, string, ...string) ([]byte, error) {
+		return nil, errors.New("slurm_load_jobs error: Unable to contact slurm controller")
+	}
+	metrics = newMetrics()
+	require.NoError(t, mapper.Process(metrics, SystemInfo{}))
+	assert.Equal(t, newMetrics(), metrics)
+}
+
+func TestNewSlurmMapper_InvalidLabel(t *testing.T) {
+	_, err := newSlurmMapper(&Config{SlurmJobLabels: []string{"account"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// socketWatcher reports the creation and removal of a socket file using inotify on its directory.
+// Events are read without blocking when changed is called, so no goroutine is needed.
+type socketWatcher struct {
+	fd   int
+	name string
+}
+
+func newSocketWatcher(socketPath string) (*socketWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("failure initializing inotify; err: %w", err)
+	}
+
+	mask := uint32(unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF)
+	if _, err := unix.InotifyAddWatch(fd, filepath.Dir(socketPath), mask); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failure watching '%s'; err: %w", filepath.Dir(socketPath), err)
+	}
+
+	return &socketWatcher{
+		fd:   fd,
+		name: filepath.Base(socketPath),
+	}, nil
+}
+
+// changed returns true if the socket was created or removed since the last call.
+func (w *socketWatcher) changed() bool {
+	changed := false
+	buf := make([]byte, 4096)
+
+	for {
+		n, err := unix.Read(w.fd, buf)
+		if err != nil || n <= 0 {
+			if err != nil && !errors.Is(err, unix.EAGAIN) {
+				// The watch is broken, reconnect to be on the safe side.
+				return true
+			}
+			return changed
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+
+			name := string(bytes.TrimRight(buf[nameStart:nameEnd], "\x00"))
+			if name == w.name || event.Mask&(unix.IN_DELETE_SELF|unix.IN_IGNORED) != 0 {
+				changed = true
+			}
+
+			offset = nameEnd
+		}
+	}
+}
+
+func (w *socketWatcher) close() {
+	unix.Close(w.fd)
+}
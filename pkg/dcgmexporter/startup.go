@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// startupState is a state of the startup of the exporter, it only moves forward.
+type startupState int
+
+const (
+	// startupCollecting waits for the first complete collection
+	startupCollecting startupState = iota
+	// startupMapping waits for the pod mapper to attribute the metrics of a complete collection
+	startupMapping
+	startupReady
+)
+
+func (s startupState) String() string {
+	switch s {
+	case startupCollecting:
+		return "waiting for the first complete collection"
+	case startupMapping:
+		return "waiting for the pod mapping"
+	case startupReady:
+		return "ready"
+	}
+	return "unknown"
+}
+
+// Startup gates the readiness of the exporter until a collection completed and, with Kubernetes, the pod mapper
+// attributed its metrics, so that the scrapes don't get empty or unattributed metrics while a large MIG system is
+// starting. The pipeline moves it forward, the server reports it.
+type Startup struct {
+	mtx   sync.Mutex
+	state startupState
+	// podMapping is set when the pod mapper must succeed before the exporter is ready
+	podMapping bool
+}
+
+func NewStartup(c *Config) *Startup {
+	return &Startup{podMapping: c.Kubernetes}
+}
+
+// collected moves the startup forward after a complete collection, podsMapped is set when the pod mapper attributed
+// its metrics.
+func (s *Startup) collected(podsMapped bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	state := s.state
+	switch {
+	case state == startupReady:
+		return
+	case s.podMapping && !podsMapped:
+		state = startupMapping
+	default:
+		state = startupReady
+	}
+
+	if state != s.state {
+		logrus.Infof("Exporter startup: %s", state)
+		s.state = state
+	}
+}
+
+// Ready returns whether the exporter is ready, and the state of the startup.
+func (s *Startup) Ready() (bool, string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.state == startupReady, s.state.String()
+}
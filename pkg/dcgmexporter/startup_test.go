@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartup(t *testing.T) {
+	startup := NewStartup(&Config{Kubernetes: true})
+	ready, state := startup.Ready()
+	assert.False(t, ready)
+	assert.Equal(t, startupCollecting.String(), state)
+
+	// The collection completed without the pod mapping
+	startup.collected(false)
+	ready, state = startup.Ready()
+	assert.False(t, ready)
+	assert.Equal(t, startupMapping.String(), state)
+
+	startup.collected(true)
+	ready, _ = startup.Ready()
+	assert.True(t, ready)
+
+	// The startup never goes back
+	startup.collected(false)
+	ready, _ = startup.Ready()
+	assert.True(t, ready)
+
+	// Without Kubernetes, the first complete collection is enough
+	startup = NewStartup(&Config{})
+	startup.collected(false)
+	ready, _ = startup.Ready()
+	assert.True(t, ready)
+}
+
+func TestMetricsServer_Startup(t *testing.T) {
+	request := func(handler http.HandlerFunc, target string) (int, string) {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	server, cleanup, err := NewMetricsServer(&Config{}, nil, NewRegistry())
+	require.NoError(t, err)
+	defer cleanup()
+
+	// Without the gating, the exporter is ready once it collected metrics
+	code, _ := request(server.Ready, "/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	server.updateMetrics("DCGM_FI_DEV_GPU_TEMP{gpu=\"0\"} 40\n")
+	code, _ = request(server.Ready, "/ready")
+	assert.Equal(t, http.StatusOK, code)
+
+	// With the gating, the metrics are not served until the pod mapping completed
+	startup := NewStartup(&Config{Kubernetes: true})
+	server.SetStartup(startup)
+	startup.collected(false)
+
+	code, body := request(server.Ready, "/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, startupMapping.String())
+	code, _ = request(server.Metrics, "/metrics")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	startup.collected(true)
+	code, _ = request(server.Ready, "/ready")
+	assert.Equal(t, http.StatusOK, code)
+	code, body = request(server.Metrics, "/metrics")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "DCGM_FI_DEV_GPU_TEMP")
+}
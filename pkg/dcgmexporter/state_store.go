@@ -0,0 +1,235 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	sysOS "os"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+// stateSaveInterval is the interval at which the state is saved, it is also saved when the exporter stops.
+const stateSaveInterval = time.Minute
+
+// stateStore persists the cumulative counters of the exporter in a JSON file, e.g. the offsets of the monotonic
+// counters and the health incidents, so that they keep increasing across the restarts of the exporter. The entries
+// that are not updated for the retention are dropped, e.g. the entries of GPUs moved to another node.
+type stateStore struct {
+	sync.Mutex
+	path      string
+	retention time.Duration
+	now       func() time.Time
+	entries   map[string]stateEntry
+	// dirty is set until the changes are saved, changes counts them so that a change made during a save is saved again
+	dirty   bool
+	changes uint64
+}
+
+type stateEntry struct {
+	Values  []float64 `json:"values"`
+	Updated time.Time `json:"updated"`
+}
+
+var (
+	persistentStateMutex sync.Mutex
+	persistentState      *stateStore
+)
+
+// OpenStateStore loads the state of the file, which is created when it is missing, and saves the state every minute
+// until the returned cleanup function is called.
+func OpenStateStore(path string, retention time.Duration) (func(), error) {
+	store := &stateStore{
+		path:      path,
+		retention: retention,
+		now:       time.Now,
+		entries:   map[string]stateEntry{},
+	}
+	if err := store.load(); err != nil {
+		return func() {}, err
+	}
+	logrus.Infof("Loaded %d entries of the state of '%s'", len(store.entries), path)
+
+	persistentStateMutex.Lock()
+	persistentState = store
+	persistentStateMutex.Unlock()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(stateSaveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := store.save(); err != nil {
+					logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(), "Unable to save the state")
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+
+		persistentStateMutex.Lock()
+		persistentState = nil
+		persistentStateMutex.Unlock()
+
+		if err := store.save(); err != nil {
+			logrus.WithError(err).Warn("Unable to save the state")
+		}
+	}, nil
+}
+
+// getStateStore returns the state store, it is nil when the state is not persisted.
+func getStateStore() *stateStore {
+	persistentStateMutex.Lock()
+	defer persistentStateMutex.Unlock()
+
+	return persistentState
+}
+
+func (s *stateStore) load() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not open state '%s'; err: %w", s.path, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("could not read state '%s'; err: %w", s.path, err)
+	}
+
+	if err := json.Unmarshal(data, &s.entries); err != nil {
+		return fmt.Errorf("could not parse state '%s'; err: %w", s.path, err)
+	}
+	s.expire()
+
+	return nil
+}
+
+// save writes the state to a temporary file renamed over the state file, so that a crash leaves the previous state.
+func (s *stateStore) save() error {
+	s.Lock()
+	if s.expire() {
+		s.markDirtyLocked()
+	}
+	if !s.dirty {
+		s.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(s.entries)
+	changes := s.changes
+	s.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// The state stays dirty until it is written, so that a failed save is retried
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("could not write state '%s'; err: %w", tmp, err)
+	}
+
+	if err := sysOS.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("could not replace state '%s'; err: %w", s.path, err)
+	}
+
+	s.Lock()
+	if s.changes == changes {
+		s.dirty = false
+	}
+	s.Unlock()
+
+	return nil
+}
+
+func (s *stateStore) markDirtyLocked() {
+	s.dirty = true
+	s.changes++
+}
+
+// expire drops the entries older than the retention, it returns whether entries were dropped.
+func (s *stateStore) expire() bool {
+	if s.retention <= 0 {
+		return false
+	}
+
+	expired := false
+	for key, entry := range s.entries {
+		if s.now().Sub(entry.Updated) > s.retention {
+			delete(s.entries, key)
+			expired = true
+		}
+	}
+
+	return expired
+}
+
+func (s *stateStore) get(key string) ([]float64, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	entry, exists := s.entries[key]
+	return entry.Values, exists
+}
+
+func (s *stateStore) set(key string, values ...float64) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.entries[key] = stateEntry{Values: values, Updated: s.now()}
+	s.markDirtyLocked()
+}
+
+func (s *stateStore) delete(key string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, exists := s.entries[key]; exists {
+		delete(s.entries, key)
+		s.markDirtyLocked()
+	}
+}
+
+// entityStateKey identifies an entity across the restarts of the exporter, the GPUs by their UUID and the MIG
+// instances by the UUID and the instance ID of their GPU, as the entity IDs of DCGM can change.
+func entityStateKey(mi MonitoringInfo) string {
+	switch {
+	case mi.InstanceInfo != nil:
+		return fmt.Sprintf("%s/%d", mi.DeviceInfo.UUID, mi.InstanceInfo.Info.NvmlInstanceId)
+	case mi.Entity.EntityGroupId == dcgm.FE_GPU:
+		return mi.DeviceInfo.UUID
+	default:
+		return fmt.Sprintf("%s/%d/%d", mi.Entity.EntityGroupId, mi.ParentId, mi.Entity.EntityId)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	sysOS "os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	now := time.Unix(1000, 0)
+	newStore := func() *stateStore {
+		return &stateStore{
+			path:      path,
+			retention: time.Hour,
+			now:       func() time.Time { return now },
+			entries:   map[string]stateEntry{},
+		}
+	}
+
+	store := newStore()
+	require.NoError(t, store.load())
+	// Nothing is written until the state changes
+	require.NoError(t, store.save())
+	_, err := sysOS.Stat(path)
+	assert.True(t, sysOS.IsNotExist(err))
+
+	store.set("old", 1)
+	now = now.Add(30 * time.Minute)
+	store.set("new", 2, 3)
+	require.NoError(t, store.save())
+
+	// The entries not updated for the retention are dropped
+	now = now.Add(45 * time.Minute)
+	loaded := newStore()
+	require.NoError(t, loaded.load())
+	_, exists := loaded.get("old")
+	assert.False(t, exists)
+	values, exists := loaded.get("new")
+	assert.True(t, exists)
+	assert.Equal(t, []float64{2, 3}, values)
+
+	require.NoError(t, sysOS.WriteFile(path, []byte("{"), 0o644))
+	assert.ErrorContains(t, loaded.load(), "could not parse state")
+}
+
+func TestStateStore_SaveRetry(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	store := &stateStore{
+		path:    filepath.Join(dir, "state.json"),
+		now:     time.Now,
+		entries: map[string]stateEntry{},
+	}
+
+	// The state is saved again after a failed write, without another change
+	store.set("gpu", 1)
+	assert.ErrorContains(t, store.save(), "could not write state")
+
+	require.NoError(t, sysOS.Mkdir(dir, 0o755))
+	require.NoError(t, store.save())
+
+	loaded := &stateStore{path: store.path, now: time.Now, entries: map[string]stateEntry{}}
+	require.NoError(t, loaded.load())
+	values, exists := loaded.get("gpu")
+	assert.True(t, exists)
+	assert.Equal(t, []float64{1}, values)
+	assert.False(t, store.dirty)
+}
+
+func TestCounterResets_StateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	mi := MonitoringInfo{
+		Entity:     dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU, EntityId: 0},
+		DeviceInfo: dcgm.Device{GPU: 0, UUID: "GPU-0"},
+		ParentId:   PARENT_ID_IGNORED,
+	}
+
+	read := func(resets *counterResets, replays int64) string {
+		value := int64FieldValue(replays)
+		value.FieldId = uint(dcgm.DCGM_FI_DEV_PCIE_REPLAY_COUNTER)
+		return ToString(resets.adjust(mi, []dcgm.FieldValue_v1{value})[0])
+	}
+
+	cleanup, err := OpenStateStore(path, 0)
+	require.NoError(t, err)
+	resets := newCounterResets(&Config{MonotonicCounters: true})
+	assert.Equal(t, "10", read(resets, 10))
+	// The GPU was reset
+	assert.Equal(t, "12", read(resets, 2))
+	cleanup()
+	assert.Nil(t, getStateStore())
+
+	// The counter continues after the restart of the exporter, and after a reset while it was stopped
+	cleanup, err = OpenStateStore(path, 0)
+	require.NoError(t, err)
+	defer cleanup()
+	resets = newCounterResets(&Config{MonotonicCounters: true})
+	assert.Equal(t, "13", read(resets, 1))
+	assert.Equal(t, "15", read(resets, 3))
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dcgmExporterStatsDSendFailuresTotal = "DCGM_EXPORTER_STATSD_SEND_FAILURES_TOTAL"
+
+	// statsdUDPPacketSize keeps UDP packets below the usual MTU, unix sockets accept larger datagrams
+	statsdUDPPacketSize  = 1432
+	statsdUnixPacketSize = 8192
+)
+
+var statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// StatsDSink sends the metrics of every collection to a StatsD server, the metric attributes are sent as
+// DogStatsD tags.
+type StatsDSink struct {
+	conn       net.Conn
+	prefix     string
+	tags       []string
+	packetSize int
+}
+
+// NewStatsDSink creates a StatsDSink for an address like udp://host:8125 or unix:///path/to/dsd.socket.
+func NewStatsDSink(c *Config) (*StatsDSink, error) {
+	network, address, ok := strings.Cut(c.StatsDAddress, "://")
+	if !ok {
+		network, address = "udp", c.StatsDAddress
+	}
+
+	packetSize := statsdUDPPacketSize
+	switch network {
+	case "udp":
+	case "unix", "unixgram":
+		network = "unixgram"
+		packetSize = statsdUnixPacketSize
+	default:
+		return nil, fmt.Errorf("invalid StatsD address '%s'; supported schemes: udp, unix", c.StatsDAddress)
+	}
+
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to StatsD address '%s'; err: %w", c.StatsDAddress, err)
+	}
+
+	return &StatsDSink{
+		conn:       conn,
+		prefix:     c.StatsDPrefix,
+		tags:       c.StatsDTags,
+		packetSize: packetSize,
+	}, nil
+}
+
+func (s *StatsDSink) Name() string {
+	return "statsd"
+}
+
+func (s *StatsDSink) Write(ctx context.Context, metrics MetricsByCounter, _ time.Time) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.conn.SetWriteDeadline(deadline)
+	}
+
+	var packet []byte
+	var failures int
+	var lastErr error
+
+	flush := func() {
+		if len(packet) == 0 {
+			return
+		}
+		if _, err := s.conn.Write(packet); err != nil {
+			failures++
+			lastErr = err
+		}
+		packet = packet[:0]
+	}
+
+	for _, counter := range sortedCounters(metrics) {
+		for _, metric := range metrics[counter] {
+			line, ok := s.formatLine(counter, metric)
+			if !ok {
+				continue
+			}
+
+			if len(packet) > 0 && len(packet)+1+len(line) > s.packetSize {
+				flush()
+			}
+			if len(packet) > 0 {
+				packet = append(packet, '\n')
+			}
+			packet = append(packet, line...)
+		}
+	}
+	flush()
+
+	if failures > 0 {
+		selfMetrics.AddCounter(dcgmExporterStatsDSendFailuresTotal,
+			"Number of packets that couldn't be sent to the StatsD server.", nil, float64(failures))
+		return fmt.Errorf("failed to send %d packets to StatsD; err: %w", failures, lastErr)
+	}
+
+	return nil
+}
+
+func (s *StatsDSink) Close() error {
+	return s.conn.Close()
+}
+
+// formatLine formats the metric as a DogStatsD gauge. DCGM counters are cumulative, so they are sent as
+// gauges too, StatsD counters would be summed.
+func (s *StatsDSink) formatLine(counter Counter, metric Metric) (string, bool) {
+	if _, err := strconv.ParseFloat(metric.Value, 64); err != nil {
+		return "", false
+	}
+
+	attributes := metricAttributes(metric)
+	if metric.GPUUUID != "" {
+		uuidAttribute := metric.UUID
+		if uuidAttribute == "" {
+			uuidAttribute = "UUID"
+		}
+		attributes[uuidAttribute] = metric.GPUUUID
+	}
+	if metric.Hostname != "" {
+		attributes["Hostname"] = metric.Hostname
+	}
+
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tags := make([]string, 0, len(s.tags)+len(keys))
+	tags = append(tags, s.tags...)
+	for _, k := range keys {
+		tags = append(tags, statsdTagReplacer.Replace(k)+":"+statsdTagReplacer.Replace(attributes[k]))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(s.prefix)
+	sb.WriteString(counter.FieldName)
+	sb.WriteString(":")
+	sb.WriteString(metric.Value)
+	sb.WriteString("|g")
+	if len(tags) > 0 {
+		sb.WriteString("|#")
+		sb.WriteString(strings.Join(tags, ","))
+	}
+
+	return sb.String(), true
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/testutils"
+)
+
+func readStatsDPackets(t *testing.T, conn net.PacketConn, n int) []string {
+	t.Helper()
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	var packets []string
+	buf := make([]byte, 65536)
+	for i := 0; i < n; i++ {
+		size, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		packets = append(packets, string(buf[:size]))
+	}
+
+	return packets
+}
+
+func TestStatsDSink_WriteUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink, err := NewStatsDSink(&Config{
+		StatsDAddress: "udp://" + conn.LocalAddr().String(),
+		StatsDPrefix:  "gpu.",
+		StatsDTags:    []string{"env:prod"},
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	gauge := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+	counter := Counter{FieldName: "DCGM_FI_DEV_XID_ERRORS", PromType: "counter"}
+
+	metrics := MetricsByCounter{
+		gauge: {
+			{
+				GPU:        "0",
+				GPUUUID:    "GPU-0",
+				UUID:       "UUID",
+				Hostname:   "node",
+				Value:      "42",
+				Attributes: map[string]string{"pod": "a,b|c"},
+			},
+		},
+		counter: {
+			{GPU: "0", GPUUUID: "GPU-0", UUID: "UUID", Value: "3"},
+			{GPU: "0", GPUUUID: "GPU-0", UUID: "UUID", Value: "not a number"},
+		},
+	}
+
+	require.NoError(t, sink.Write(context.Background(), metrics, time.Now()))
+
+	packets := readStatsDPackets(t, conn, 1)
+	assert.Equal(t, strings.Join([]string{
+		"gpu.DCGM_FI_DEV_GPU_TEMP:42|g|#env:prod,Hostname:node,UUID:GPU-0,gpu:0,pod:a_b_c",
+		"gpu.DCGM_FI_DEV_XID_ERRORS:3|g|#env:prod,UUID:GPU-0,gpu:0",
+	}, "\n"), packets[0])
+}
+
+func TestStatsDSink_WriteUnix(t *testing.T) {
+	testutils.RequireLinux(t)
+
+	socketPath := filepath.Join(t.TempDir(), "dsd.socket")
+	conn, err := net.ListenPacket("unixgram", socketPath)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink, err := NewStatsDSink(&Config{StatsDAddress: "unix://" + socketPath})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	gauge := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+	metrics := MetricsByCounter{gauge: {{GPU: "0", Value: "42"}}}
+
+	require.NoError(t, sink.Write(context.Background(), metrics, time.Now()))
+	assert.Equal(t, []string{"DCGM_FI_DEV_GPU_TEMP:42|g|#gpu:0"}, readStatsDPackets(t, conn, 1))
+}
+
+func TestStatsDSink_PacketSize(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink, err := NewStatsDSink(&Config{StatsDAddress: conn.LocalAddr().String()})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	gauge := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+	metrics := MetricsByCounter{}
+	for i := 0; i < 100; i++ {
+		metrics[gauge] = append(metrics[gauge], Metric{GPU: fmt.Sprint(i), Value: "42"})
+	}
+
+	require.NoError(t, sink.Write(context.Background(), metrics, time.Now()))
+
+	var lines int
+	for _, packet := range readStatsDPackets(t, conn, 3) {
+		assert.LessOrEqual(t, len(packet), statsdUDPPacketSize)
+		lines += len(strings.Split(packet, "\n"))
+	}
+	assert.Equal(t, 100, lines)
+}
+
+func TestNewStatsDSink_InvalidAddress(t *testing.T) {
+	_, err := NewStatsDSink(&Config{StatsDAddress: "tcp://localhost:8125"})
+	assert.Error(t, err)
+}
@@ -25,6 +25,8 @@ import (
 	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
 	"github.com/bits-and-blooms/bitset"
 	"github.com/sirupsen/logrus"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
 )
 
 var (
@@ -34,6 +36,9 @@ var (
 	dcgmAddEntityToGroup        = dcgm.AddEntityToGroup
 	dcgmCreateGroup             = dcgm.CreateGroup
 	dcgmGetCpuHierarchy         = dcgm.GetCpuHierarchy
+
+	nvmlGetGPUInstanceProfileInfoHook = nvmlprovider.GetGPUInstanceProfileInfo
+	nvmlGetBoardPartNumberHook        = nvmlprovider.GetBoardPartNumber
 )
 
 type ComputeInstanceInfo struct {
@@ -47,12 +52,19 @@ type GPUInstanceInfo struct {
 	ProfileName      string
 	EntityId         uint
 	ComputeInstances []ComputeInstanceInfo
+	// MemorySizeMB and MultiprocessorCount are the capacity of the profile, they are 0 when NVML cannot tell it
+	MemorySizeMB        uint64
+	MultiprocessorCount uint32
 }
 
 type GPUInfo struct {
 	DeviceInfo   dcgm.Device
 	GPUInstances []GPUInstanceInfo
 	MigEnabled   bool
+	// NUMANode is the NUMA node of the GPU, it is empty when the platform does not report it
+	NUMANode string
+	// BoardPartNumber is the part number of the board of the GPU, it is empty until PopulateBoardPartNumbers
+	BoardPartNumber string
 }
 
 type SwitchInfo struct {
@@ -133,6 +145,111 @@ func PopulateMigProfileNames(sysInfo *SystemInfo, entities []dcgm.GroupEntityPai
 	return SetMigProfileNames(sysInfo, values)
 }
 
+// PopulateMigProfileCapacities sets the memory and the SM count of the GPU instances from the profiles known to NVML.
+func PopulateMigProfileCapacities(sysInfo *SystemInfo) {
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		gpu := &sysInfo.GPUs[i]
+		for j := range gpu.GPUInstances {
+			instance := &gpu.GPUInstances[j]
+			info, err := nvmlGetGPUInstanceProfileInfoHook(gpu.DeviceInfo.UUID, instance.Info.NvmlInstanceId)
+			if err != nil {
+				logrus.WithError(err).Warnf("Unable to get the profile capacity of GPU instance %d of GPU %d",
+					instance.Info.NvmlInstanceId, gpu.DeviceInfo.GPU)
+				continue
+			}
+
+			instance.MemorySizeMB = info.MemorySizeMB
+			instance.MultiprocessorCount = info.MultiprocessorCount
+		}
+	}
+}
+
+// PopulateBoardPartNumbers sets the part numbers of the boards of the GPUs known to NVML.
+func PopulateBoardPartNumbers(sysInfo *SystemInfo) {
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		gpu := &sysInfo.GPUs[i]
+		partNumber, err := nvmlGetBoardPartNumberHook(gpu.DeviceInfo.UUID)
+		if err != nil {
+			logrus.WithError(err).Warnf("Unable to get the board part number of GPU %d", gpu.DeviceInfo.GPU)
+			continue
+		}
+
+		gpu.BoardPartNumber = partNumber
+	}
+}
+
+// NormalizeMigInfo completes the GPU and the compute instances so that every collector labels the metrics of a GPU
+// instance the same way. The instances get the UUID of their GPU, and the profile names DCGM didn't report are named
+// like dcgmi does, after the slices and the memory of the profile for the GPU instances, e.g. 3g.40gb, and after
+// their slices of the GPU instance for the compute instances, e.g. 1c.3g.40gb.
+func NormalizeMigInfo(sysInfo *SystemInfo) {
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		gpu := &sysInfo.GPUs[i]
+		for j := range gpu.GPUInstances {
+			instance := &gpu.GPUInstances[j]
+			if instance.Info.GpuUuid == "" {
+				instance.Info.GpuUuid = gpu.DeviceInfo.UUID
+			}
+			if instance.ProfileName == "" {
+				instance.ProfileName = migProfileName(instance.Info.NvmlProfileSlices, instance.MemorySizeMB)
+			}
+			if instance.ProfileName == "" {
+				logrus.Warnf("Unable to name the profile of GPU instance %d of GPU %d", instance.Info.NvmlInstanceId,
+					gpu.DeviceInfo.GPU)
+			}
+
+			for k := range instance.ComputeInstances {
+				computeInstance := &instance.ComputeInstances[k]
+				if computeInstance.InstanceInfo.GpuUuid == "" {
+					computeInstance.InstanceInfo.GpuUuid = gpu.DeviceInfo.UUID
+				}
+				if computeInstance.ProfileName != "" || instance.ProfileName == "" {
+					continue
+				}
+
+				slices := computeInstance.InstanceInfo.NvmlProfileSlices
+				if slices == 0 || slices == instance.Info.NvmlProfileSlices {
+					computeInstance.ProfileName = instance.ProfileName
+				} else {
+					computeInstance.ProfileName = fmt.Sprintf("%dc.%s", slices, instance.ProfileName)
+				}
+			}
+		}
+	}
+}
+
+// migProfileName names a GPU instance profile after its slices and its memory rounded up to the GB, it is empty when
+// the slices are unknown.
+func migProfileName(slices uint, memorySizeMB uint64) string {
+	if slices == 0 {
+		return ""
+	}
+	if memorySizeMB == 0 {
+		return fmt.Sprintf("%dg", slices)
+	}
+
+	return fmt.Sprintf("%dg.%dgb", slices, (memorySizeMB+1023)/1024)
+}
+
+// setMigLabels sets the MIG labels of the metric of an entity, they are cleared for the entities that aren't GPU
+// instances. The compute instance is only set when the GPU instance has a single one, the metrics are otherwise
+// those of all its compute instances.
+func setMigLabels(m *Metric, instance *GPUInstanceInfo) {
+	if instance == nil {
+		m.MigProfile = ""
+		m.GPUInstanceID = ""
+		m.ComputeInstanceID = ""
+		return
+	}
+
+	m.MigProfile = instance.ProfileName
+	m.GPUInstanceID = fmt.Sprintf("%d", instance.Info.NvmlInstanceId)
+	m.ComputeInstanceID = ""
+	if len(instance.ComputeInstances) == 1 {
+		m.ComputeInstanceID = fmt.Sprintf("%d", instance.ComputeInstances[0].InstanceInfo.NvmlComputeInstanceId)
+	}
+}
+
 func GPUIdExists(sysInfo *SystemInfo, gpuId int) bool {
 	for i := uint(0); i < sysInfo.GPUCount; i++ {
 		if sysInfo.GPUs[i].DeviceInfo.GPU == uint(gpuId) {
@@ -243,6 +360,59 @@ func VerifySwitchDevicePresence(sysInfo *SystemInfo, sOpt DeviceOptions) error {
 	return nil
 }
 
+// resolveDeviceUUIDs adds the GPUs and the GPU instances selected by their UUID to the ranges of the options.
+func resolveDeviceUUIDs(sysInfo SystemInfo, gOpt DeviceOptions) (DeviceOptions, error) {
+	for _, uuid := range gOpt.UUIDs {
+		if !strings.HasPrefix(uuid, MIG_UUID_PREFIX) {
+			gpuID, ok := gpuIDOfUUID(sysInfo, uuid)
+			if !ok {
+				return gOpt, fmt.Errorf("couldn't find requested GPU '%s'", uuid)
+			}
+			if !slices.Contains(gOpt.MajorRange, gpuID) {
+				gOpt.MajorRange = append(gOpt.MajorRange, gpuID)
+			}
+			continue
+		}
+
+		migDevice, err := nvmlGetMIGDeviceInfoByIDHook(uuid)
+		if err != nil {
+			return gOpt, fmt.Errorf("couldn't find requested GPU instance '%s': %w", uuid, err)
+		}
+
+		gpuID, ok := gpuIDOfUUID(sysInfo, migDevice.ParentUUID)
+		if !ok {
+			return gOpt, fmt.Errorf("couldn't find the GPU '%s' of the requested GPU instance '%s'",
+				migDevice.ParentUUID, uuid)
+		}
+
+		found := false
+		for _, instance := range sysInfo.GPUs[gpuID].GPUInstances {
+			if instance.Info.NvmlInstanceId == uint(migDevice.GPUInstanceID) {
+				found = true
+				if !slices.Contains(gOpt.MinorRange, int(instance.EntityId)) {
+					gOpt.MinorRange = append(gOpt.MinorRange, int(instance.EntityId))
+				}
+			}
+		}
+		if !found {
+			return gOpt, fmt.Errorf("couldn't find requested GPU instance '%s'", uuid)
+		}
+	}
+
+	return gOpt, nil
+}
+
+// gpuIDOfUUID returns the index of the GPU with the UUID.
+func gpuIDOfUUID(sysInfo SystemInfo, uuid string) (int, bool) {
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		if sysInfo.GPUs[i].DeviceInfo.UUID == uuid {
+			return int(i), true
+		}
+	}
+
+	return 0, false
+}
+
 func VerifyDevicePresence(sysInfo *SystemInfo, gOpt DeviceOptions) error {
 	if gOpt.Flex {
 		return nil
@@ -380,6 +550,8 @@ func InitializeGPUInfo(sysInfo SystemInfo, gOpt DeviceOptions, useFakeGPUs bool)
 		}
 	}
 
+	PopulateGPUNUMANodes(&sysInfo)
+
 	hierarchy, err := dcgmGetGpuInstanceHierarchy()
 	if err != nil {
 		return sysInfo, err
@@ -417,6 +589,14 @@ func InitializeGPUInfo(sysInfo SystemInfo, gOpt DeviceOptions, useFakeGPUs bool)
 		if err != nil {
 			return sysInfo, err
 		}
+
+		PopulateMigProfileCapacities(&sysInfo)
+		NormalizeMigInfo(&sysInfo)
+	}
+
+	gOpt, err = resolveDeviceUUIDs(sysInfo, gOpt)
+	if err != nil {
+		return sysInfo, err
 	}
 
 	sysInfo.gOpt = gOpt
@@ -582,6 +762,47 @@ func CreateGroupFromSystemInfo(sysInfo SystemInfo) (dcgm.GroupHandle, func(), er
 	}, nil
 }
 
+// GetMIGParentGPUs returns the GPUs of the monitored MIG instances.
+func GetMIGParentGPUs(sysInfo SystemInfo) []uint {
+	var gpus []uint
+
+	for _, mi := range GetMonitoredEntities(sysInfo) {
+		if mi.InstanceInfo != nil && !slices.Contains(gpus, mi.DeviceInfo.GPU) {
+			gpus = append(gpus, mi.DeviceInfo.GPU)
+		}
+	}
+
+	return gpus
+}
+
+// CreateMIGParentGroupFromSystemInfo creates a group of the GPUs of the monitored MIG instances, to watch the
+// fields that DCGM reports for GPUs only.
+func CreateMIGParentGroupFromSystemInfo(sysInfo SystemInfo) (dcgm.GroupHandle, func(), error) {
+	groupID, err := dcgmCreateGroup(fmt.Sprintf("gpu-collector-mig-parent-group-%d", rand.Uint64()))
+	if err != nil {
+		return dcgm.GroupHandle{}, func() {}, err
+	}
+
+	cleanup := func() {
+		err := dcgm.DestroyGroup(groupID)
+		if err != nil && !strings.Contains(err.Error(), DCGM_ST_NOT_CONFIGURED) {
+			logrus.WithFields(logrus.Fields{
+				LoggerGroupIDKey: groupID,
+				logrus.ErrorKey:  err,
+			}).Warn("can not destroy group")
+		}
+	}
+
+	for _, gpu := range GetMIGParentGPUs(sysInfo) {
+		err := dcgmAddEntityToGroup(groupID, dcgm.FE_GPU, gpu)
+		if err != nil {
+			return groupID, cleanup, err
+		}
+	}
+
+	return groupID, cleanup, nil
+}
+
 func AddAllGPUs(sysInfo SystemInfo) []MonitoringInfo {
 	var monitoring []MonitoringInfo
 
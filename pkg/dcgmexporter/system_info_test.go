@@ -17,9 +17,11 @@
 package dcgmexporter
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
 	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -139,6 +141,22 @@ func TestMonitoredEntities(t *testing.T) {
 	}
 }
 
+func TestGetMIGParentGPUs(t *testing.T) {
+	sysInfo := SpoofSystemInfo()
+	sysInfo.gOpt.Flex = true
+
+	// A second instance on GPU 1 doesn't duplicate its parent
+	sysInfo.GPUs[1].GPUInstances = append(sysInfo.GPUs[1].GPUInstances, GPUInstanceInfo{EntityId: 15})
+	require.Equal(t, []uint{0, 1}, GetMIGParentGPUs(sysInfo))
+
+	// GPUs without MIG instances are monitored directly
+	sysInfo.GPUs[0].GPUInstances = nil
+	require.Equal(t, []uint{1}, GetMIGParentGPUs(sysInfo))
+
+	sysInfo.GPUs[1].GPUInstances = nil
+	require.Empty(t, GetMIGParentGPUs(sysInfo))
+}
+
 func TestVerifyDevicePresence(t *testing.T) {
 	sysInfo := SpoofSystemInfo()
 	var dOpt DeviceOptions
@@ -170,6 +188,45 @@ func TestVerifyDevicePresence(t *testing.T) {
 	require.Equal(t, err, nil, "Expected to have no error, but found %s", err)
 }
 
+func TestResolveDeviceUUIDs(t *testing.T) {
+	sysInfo := SpoofSystemInfo()
+	sysInfo.GPUs[0].DeviceInfo.UUID = "GPU-0000"
+	sysInfo.GPUs[1].DeviceInfo.UUID = "GPU-0001"
+
+	nvmlGetMIGDeviceInfoByIDHook = func(uuid string) (*nvmlprovider.MIGDeviceInfo, error) {
+		if uuid == "MIG-0001" {
+			return &nvmlprovider.MIGDeviceInfo{ParentUUID: "GPU-0001", GPUInstanceID: 1}, nil
+		}
+		return nil, errors.New("not found")
+	}
+	defer func() {
+		nvmlGetMIGDeviceInfoByIDHook = nvmlprovider.GetMIGDeviceInfoByID
+	}()
+
+	// The GPUs and the GPU instances are added to the ranges once
+	gOpt, err := resolveDeviceUUIDs(sysInfo, DeviceOptions{
+		MajorRange: []int{0},
+		UUIDs:      []string{"GPU-0000", "GPU-0001", "MIG-0001"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1}, gOpt.MajorRange)
+	assert.Equal(t, []int{14}, gOpt.MinorRange)
+	require.NoError(t, VerifyDevicePresence(&sysInfo, gOpt))
+
+	sysInfo.gOpt = gOpt
+	var entities []uint
+	for _, mi := range GetMonitoredEntities(sysInfo) {
+		entities = append(entities, mi.Entity.EntityId)
+	}
+	assert.Equal(t, []uint{0, 1, 14}, entities)
+
+	_, err = resolveDeviceUUIDs(sysInfo, DeviceOptions{UUIDs: []string{"GPU-0002"}})
+	assert.ErrorContains(t, err, "couldn't find requested GPU 'GPU-0002'")
+
+	_, err = resolveDeviceUUIDs(sysInfo, DeviceOptions{UUIDs: []string{"MIG-0002"}})
+	assert.ErrorContains(t, err, "couldn't find requested GPU instance 'MIG-0002'")
+}
+
 func TestMonitoredSwitches(t *testing.T) {
 	sysInfo := SpoofSwitchSystemInfo()
 
@@ -669,3 +726,70 @@ func TestSetMigProfileNames(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizeMigInfo(t *testing.T) {
+	sysInfo := SystemInfo{GPUCount: 1}
+	sysInfo.GPUs[0].DeviceInfo = dcgm.Device{GPU: 0, UUID: "GPU-0"}
+	sysInfo.GPUs[0].MigEnabled = true
+	sysInfo.GPUs[0].GPUInstances = []GPUInstanceInfo{
+		{
+			// DCGM didn't report the profile name
+			Info:         dcgm.MigEntityInfo{NvmlInstanceId: 1, NvmlProfileSlices: 3},
+			MemorySizeMB: 40192,
+			ComputeInstances: []ComputeInstanceInfo{
+				{InstanceInfo: dcgm.MigEntityInfo{NvmlInstanceId: 1, NvmlComputeInstanceId: 0, NvmlProfileSlices: 1}},
+				{InstanceInfo: dcgm.MigEntityInfo{NvmlInstanceId: 1, NvmlComputeInstanceId: 1, NvmlProfileSlices: 2}},
+			},
+		},
+		{
+			Info:        dcgm.MigEntityInfo{GpuUuid: "GPU-0", NvmlInstanceId: 2, NvmlProfileSlices: 1},
+			ProfileName: "1g.10gb",
+			ComputeInstances: []ComputeInstanceInfo{
+				{InstanceInfo: dcgm.MigEntityInfo{NvmlInstanceId: 2, NvmlComputeInstanceId: 0, NvmlProfileSlices: 1}},
+			},
+		},
+		{
+			Info: dcgm.MigEntityInfo{NvmlInstanceId: 3},
+		},
+	}
+
+	NormalizeMigInfo(&sysInfo)
+
+	instances := sysInfo.GPUs[0].GPUInstances
+	assert.Equal(t, "GPU-0", instances[0].Info.GpuUuid)
+	assert.Equal(t, "3g.40gb", instances[0].ProfileName)
+	assert.Equal(t, "1c.3g.40gb", instances[0].ComputeInstances[0].ProfileName)
+	assert.Equal(t, "2c.3g.40gb", instances[0].ComputeInstances[1].ProfileName)
+	assert.Equal(t, "GPU-0", instances[0].ComputeInstances[1].InstanceInfo.GpuUuid)
+	assert.Equal(t, "1g.10gb", instances[1].ProfileName)
+	assert.Equal(t, "1g.10gb", instances[1].ComputeInstances[0].ProfileName)
+	assert.Empty(t, instances[2].ProfileName)
+}
+
+func TestSetMigLabels(t *testing.T) {
+	instance := &GPUInstanceInfo{
+		Info:        dcgm.MigEntityInfo{GpuUuid: "GPU-0", NvmlInstanceId: 2},
+		ProfileName: "1g.10gb",
+		ComputeInstances: []ComputeInstanceInfo{
+			{InstanceInfo: dcgm.MigEntityInfo{NvmlInstanceId: 2, NvmlComputeInstanceId: 1}},
+		},
+	}
+
+	var m Metric
+	setMigLabels(&m, instance)
+	assert.Equal(t, "1g.10gb", m.MigProfile)
+	assert.Equal(t, "2", m.GPUInstanceID)
+	assert.Equal(t, "1", m.ComputeInstanceID)
+
+	// The metrics of a GPU instance with several compute instances are not those of one of them
+	instance.ComputeInstances = append(instance.ComputeInstances,
+		ComputeInstanceInfo{InstanceInfo: dcgm.MigEntityInfo{NvmlInstanceId: 2, NvmlComputeInstanceId: 2}})
+	setMigLabels(&m, instance)
+	assert.Equal(t, "2", m.GPUInstanceID)
+	assert.Empty(t, m.ComputeInstanceID)
+
+	setMigLabels(&m, nil)
+	assert.Empty(t, m.MigProfile)
+	assert.Empty(t, m.GPUInstanceID)
+	assert.Empty(t, m.ComputeInstanceID)
+}
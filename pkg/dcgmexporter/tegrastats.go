@@ -0,0 +1,286 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+const (
+	tegrastatsSource = "tegrastats"
+	tegraModel       = "NVIDIA Tegra"
+)
+
+var (
+	tegraModelFile  = "/proc/device-tree/model"
+	tegraSerialFile = "/proc/device-tree/serial-number"
+
+	startTegrastatsHook = startTegrastats
+)
+
+// tegrastatsFields are the fields collected from tegrastats on the Jetson modules, whose integrated GPU is not
+// supported by DCGM. The memory of the GPU is the memory of the module.
+var tegrastatsFields = map[dcgm.Short]bool{
+	dcgm.DCGM_FI_DEV_GPU_UTIL:    true,
+	dcgm.DCGM_FI_DEV_FB_USED:     true,
+	dcgm.DCGM_FI_DEV_FB_FREE:     true,
+	dcgm.DCGM_FI_DEV_GPU_TEMP:    true,
+	dcgm.DCGM_FI_DEV_POWER_USAGE: true,
+}
+
+var (
+	tegrastatsRAMRegex   = regexp.MustCompile(`\bRAM (\d+)/(\d+)MB`)
+	tegrastatsGR3DRegex  = regexp.MustCompile(`\bGR3D_FREQ (\d+)%`)
+	tegrastatsTempRegex  = regexp.MustCompile(`(?i)\bgpu@(-?[\d.]+)C`)
+	tegrastatsPowerRegex = regexp.MustCompile(`\b(?:VDD_GPU_SOC|VDD_GPU|POM_5V_GPU|GPU) (\d+)(?:mW)?/`)
+)
+
+// tegraStats holds the statistics of a line of tegrastats, the statistics missing on the module are nil.
+type tegraStats struct {
+	// ramUsed and ramTotal are in MiB
+	ramUsed  *int64
+	ramTotal *int64
+	// gpuUtil is the load of the GPU in %
+	gpuUtil *int64
+	// gpuTemp is in C
+	gpuTemp *float64
+	// gpuPower is in mW
+	gpuPower *int64
+}
+
+// parseTegrastats returns the statistics of a line of tegrastats, e.g.
+// "RAM 2217/7620MB (lfb 1x4MB) ... GR3D_FREQ 12% ... gpu@47.5C ... VDD_GPU_SOC 1602mW/1602mW ...".
+func parseTegrastats(line string) (tegraStats, error) {
+	var stats tegraStats
+
+	parseInt := func(s string) *int64 {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil
+		}
+		return &v
+	}
+
+	if m := tegrastatsRAMRegex.FindStringSubmatch(line); m != nil {
+		stats.ramUsed, stats.ramTotal = parseInt(m[1]), parseInt(m[2])
+	}
+	if m := tegrastatsGR3DRegex.FindStringSubmatch(line); m != nil {
+		stats.gpuUtil = parseInt(m[1])
+	}
+	if m := tegrastatsTempRegex.FindStringSubmatch(line); m != nil {
+		if v, err := strconv.ParseFloat(m[1], 64); err == nil {
+			stats.gpuTemp = &v
+		}
+	}
+	if m := tegrastatsPowerRegex.FindStringSubmatch(line); m != nil {
+		stats.gpuPower = parseInt(m[1])
+	}
+
+	if stats.ramUsed == nil && stats.gpuUtil == nil {
+		return stats, fmt.Errorf("unexpected tegrastats output '%s'", line)
+	}
+
+	return stats, nil
+}
+
+// NewTegrastatsEntityGroupTypeSystemInfo returns the integrated GPU of the Jetson module with the fields of the
+// counters that tegrastats collects.
+func NewTegrastatsEntityGroupTypeSystemInfo(c []Counter, config *Config) (*FieldEntityGroupTypeSystemInfo, error) {
+	return newSourceEntityGroupTypeSystemInfo(c, config, []nvmlprovider.DeviceInfo{tegraDevice()}, tegrastatsFields,
+		tegrastatsSource)
+}
+
+// tegraDevice returns the integrated GPU of the module, identified by the model and the serial number of the module
+// as it has no UUID.
+func tegraDevice() nvmlprovider.DeviceInfo {
+	readDeviceTree := func(path string) string {
+		file, err := os.Open(path)
+		if err != nil {
+			return ""
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(bytes.TrimRight(data, "\x00")))
+	}
+
+	device := nvmlprovider.DeviceInfo{Name: readDeviceTree(tegraModelFile), UUID: "GPU-tegra"}
+	if device.Name == "" {
+		device.Name = tegraModel
+	}
+	if serial := readDeviceTree(tegraSerialFile); serial != "" {
+		device.UUID += "-" + serial
+	}
+
+	return device
+}
+
+// NewTegrastatsCollector returns a collector constructor reading the values of the fields from tegrastats, run with
+// the collect interval, instead of DCGM. The metrics are labeled with source="tegrastats".
+func NewTegrastatsCollector(path string) DCGMCollectorConstructor {
+	return func(
+		c []Counter, hostname string, config *Config, item FieldEntityGroupTypeSystemInfoItem,
+	) (*DCGMCollector, func(), error) {
+		if item.isEmpty() {
+			return nil, func() {}, fmt.Errorf("fieldEntityGroupTypeSystemInfo is empty")
+		}
+
+		interval := time.Second
+		if config != nil && config.CollectInterval > 0 {
+			interval = collectTickInterval(config)
+		}
+
+		source, err := newTegrastatsFieldSource(path, interval)
+		if err != nil {
+			return nil, func() {}, err
+		}
+
+		collector := newSourceCollector(c, hostname, config, item, source, tegrastatsSource)
+		collector.Cleanups = []func(){source.close}
+
+		return collector, func() { collector.Cleanup() }, nil
+	}
+}
+
+// startTegrastats runs tegrastats with the given interval, the returned function stops it.
+func startTegrastats(path string, interval time.Duration) (io.Reader, func(), error) {
+	cmd := exec.Command(path, "--interval", strconv.FormatInt(interval.Milliseconds(), 10))
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("failed to run '%s'; err: %w", path, err)
+	}
+
+	return out, func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}, nil
+}
+
+// tegrastatsFieldSource reads the values of the fields from the last line of tegrastats.
+type tegrastatsFieldSource struct {
+	mtx   sync.Mutex
+	stats *tegraStats
+	stop  func()
+}
+
+func newTegrastatsFieldSource(path string, interval time.Duration) (*tegrastatsFieldSource, error) {
+	out, stop, err := startTegrastatsHook(path, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &tegrastatsFieldSource{stop: stop}
+	go s.read(out)
+
+	return s, nil
+}
+
+// read keeps the statistics of the last line of tegrastats until it exits.
+func (s *tegrastatsFieldSource) read(out io.Reader) {
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		stats, err := parseTegrastats(scanner.Text())
+		if err != nil {
+			logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(), "Unable to parse the tegrastats output")
+			continue
+		}
+
+		s.mtx.Lock()
+		s.stats = &stats
+		s.mtx.Unlock()
+	}
+}
+
+func (s *tegrastatsFieldSource) latestValues(
+	entity dcgm.GroupEntityPair, _ uint, fields []dcgm.Short,
+) ([]dcgm.FieldValue_v1, error) {
+	if entity.EntityGroupId != dcgm.FE_GPU || entity.EntityId != 0 {
+		return nil, fmt.Errorf("no GPU %d in tegrastats", entity.EntityId)
+	}
+
+	s.mtx.Lock()
+	stats := s.stats
+	s.mtx.Unlock()
+
+	values := make([]dcgm.FieldValue_v1, 0, len(fields))
+	for _, fieldID := range fields {
+		// The values are blank until tegrastats printed its first line
+		value := int64FieldValue(dcgm.DCGM_FT_INT64_BLANK)
+		if stats != nil {
+			value = tegrastatsFieldValue(fieldID, stats)
+		}
+		value.FieldId = uint(fieldID)
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func (s *tegrastatsFieldSource) collected(SystemInfo) {}
+
+func (s *tegrastatsFieldSource) close() {
+	s.stop()
+}
+
+// tegrastatsFieldValue returns the value of the field in the units of DCGM, blank when the module doesn't report it.
+func tegrastatsFieldValue(fieldID dcgm.Short, stats *tegraStats) dcgm.FieldValue_v1 {
+	switch fieldID {
+	case dcgm.DCGM_FI_DEV_GPU_UTIL:
+		if stats.gpuUtil != nil {
+			return int64FieldValue(*stats.gpuUtil)
+		}
+	case dcgm.DCGM_FI_DEV_FB_USED:
+		if stats.ramUsed != nil {
+			return int64FieldValue(*stats.ramUsed)
+		}
+	case dcgm.DCGM_FI_DEV_FB_FREE:
+		if stats.ramUsed != nil && stats.ramTotal != nil {
+			return int64FieldValue(*stats.ramTotal - *stats.ramUsed)
+		}
+	case dcgm.DCGM_FI_DEV_GPU_TEMP:
+		if stats.gpuTemp != nil {
+			return int64FieldValue(int64(*stats.gpuTemp))
+		}
+	case dcgm.DCGM_FI_DEV_POWER_USAGE:
+		if stats.gpuPower != nil {
+			return doubleFieldValue(float64(*stats.gpuPower) / 1000)
+		}
+	}
+
+	return int64FieldValue(dcgm.DCGM_FT_INT64_BLANK)
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"io"
+	sysOS "os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTegrastats(t *testing.T) {
+	ptr := func(v int64) *int64 { return &v }
+	temp := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name string
+		line string
+		want tegraStats
+	}{
+		{
+			name: "Orin",
+			line: "RAM 2217/7620MB (lfb 1x4MB) SWAP 0/3810MB (cached 0MB) CPU [2%@1420,1%@1420] EMC_FREQ 0% " +
+				"GR3D_FREQ 12% cpu@48.5C soc2@47.75C gpu@47.5C tj@49.5C VDD_GPU_SOC 1602mW/1602mW VDD_CPU_CV 400mW/400mW",
+			want: tegraStats{ramUsed: ptr(2217), ramTotal: ptr(7620), gpuUtil: ptr(12), gpuTemp: temp(47.5),
+				gpuPower: ptr(1602)},
+		},
+		{
+			name: "Xavier",
+			line: "RAM 1780/31920MB (lfb 7105x4MB) CPU [1%@1190,off] EMC_FREQ 0% GR3D_FREQ 0% AUX@31C CPU@33C " +
+				"GPU@32C GPU 0mW/0mW CPU 311mW/311mW",
+			want: tegraStats{ramUsed: ptr(1780), ramTotal: ptr(31920), gpuUtil: ptr(0), gpuTemp: temp(32),
+				gpuPower: ptr(0)},
+		},
+		{
+			name: "Nano",
+			line: "RAM 1504/3964MB (lfb 104x4MB) CPU [3%@102,2%@102] EMC_FREQ 0%@204 GR3D_FREQ 0%@76 PLL@30C " +
+				"GPU@28.5C POM_5V_IN 1014/1014 POM_5V_GPU 0/0",
+			want: tegraStats{ramUsed: ptr(1504), ramTotal: ptr(3964), gpuUtil: ptr(0), gpuTemp: temp(28.5),
+				gpuPower: ptr(0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTegrastats(tt.line)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := parseTegrastats("unexpected")
+	assert.Error(t, err)
+}
+
+func TestTegrastatsCollector(t *testing.T) {
+	dir := t.TempDir()
+	defer func(model, serial string) {
+		tegraModelFile, tegraSerialFile = model, serial
+	}(tegraModelFile, tegraSerialFile)
+	tegraModelFile = filepath.Join(dir, "model")
+	tegraSerialFile = filepath.Join(dir, "serial-number")
+	require.NoError(t, sysOS.WriteFile(tegraModelFile, []byte("NVIDIA Jetson AGX Orin\x00"), 0o600))
+	require.NoError(t, sysOS.WriteFile(tegraSerialFile, []byte("1423021000000\x00"), 0o600))
+
+	r, w := io.Pipe()
+	stopped := false
+	defer func(start func(string, time.Duration) (io.Reader, func(), error)) {
+		startTegrastatsHook = start
+	}(startTegrastatsHook)
+	startTegrastatsHook = func(path string, interval time.Duration) (io.Reader, func(), error) {
+		assert.Equal(t, "/usr/bin/tegrastats", path)
+		assert.Equal(t, 5*time.Second, interval)
+		return r, func() {
+			stopped = true
+			_ = w.Close()
+		}, nil
+	}
+
+	counters := []Counter{
+		{FieldID: dcgm.DCGM_FI_DEV_GPU_UTIL, FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_DEV_FB_FREE, FieldName: "DCGM_FI_DEV_FB_FREE", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_DEV_POWER_USAGE, FieldName: "DCGM_FI_DEV_POWER_USAGE", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_DEV_SM_CLOCK, FieldName: "DCGM_FI_DEV_SM_CLOCK", PromType: "gauge"},
+	}
+
+	config := &Config{CollectInterval: 5000, GPUDevices: DeviceOptions{Flex: true}}
+	systemInfo, err := NewTegrastatsEntityGroupTypeSystemInfo(counters, config)
+	require.NoError(t, err)
+
+	item, exists := systemInfo.Get(dcgm.FE_GPU)
+	require.True(t, exists)
+	assert.NotContains(t, item.DeviceFields, dcgm.Short(dcgm.DCGM_FI_DEV_SM_CLOCK))
+
+	collector, cleanup, err := NewTegrastatsCollector("/usr/bin/tegrastats")(counters, "node", config, item)
+	require.NoError(t, err)
+
+	// Nothing is exported until tegrastats printed a line
+	metrics, err := collector.GetMetrics()
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	_, err = w.Write([]byte("RAM 2217/7620MB GR3D_FREQ 12% gpu@47.5C VDD_GPU_SOC 1602mW/1602mW\n"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		metrics, err = collector.GetMetrics()
+		return err == nil && len(metrics) == 3
+	}, time.Second, 10*time.Millisecond)
+
+	for counter, want := range map[Counter]string{
+		counters[0]: "12",
+		counters[1]: "5403",
+		counters[2]: "1.602000",
+	} {
+		require.Len(t, metrics[counter], 1)
+		metric := metrics[counter][0]
+		assert.Equal(t, want, metric.Value)
+		assert.Equal(t, "GPU-tegra-1423021000000", metric.GPUUUID)
+		assert.Equal(t, "NVIDIA Jetson AGX Orin", metric.GPUModelName)
+		assert.Equal(t, tegrastatsSource, metric.Attributes[sourceAttribute])
+	}
+
+	cleanup()
+	assert.True(t, stopped)
+}
@@ -0,0 +1,28 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package testing provides fakes of the DCGM devices and of the kubelet, so that the transforms and the sinks built
+// on the dcgmexporter package can be unit tested against realistic data, without GPUs nor a cluster.
+//
+// A test typically describes the node with NewSystemInfo, generates the field values of its GPUs with NewMetrics and
+// serves the pods of the node with NewPodResourcesServer:
+//
+//	sysInfo := testing.NewSystemInfo().WithGPU("GPU-0").WithGPU("GPU-1").Build()
+//	metrics := testing.NewMetrics(sysInfo).WithCounters(testing.Counters...).Build()
+//
+//	kubelet := testing.NewPodResourcesServer().WithPod("default", "trainer", "main", "nvidia.com/gpu", "GPU-0")
+//	stop, err := kubelet.Start(socketPath)
+package testing
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package testing
+
+import (
+	"fmt"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+
+	"github.com/NVIDIA/dcgm-exporter/pkg/dcgmexporter"
+)
+
+// FieldValue is a counter with the value generated for every device.
+type FieldValue struct {
+	Counter dcgmexporter.Counter
+	Value   string
+}
+
+// Counters are common fields with the values of a GPU running a training job.
+var Counters = []FieldValue{
+	{
+		Counter: dcgmexporter.Counter{FieldID: dcgm.DCGM_FI_DEV_SM_CLOCK, FieldName: "DCGM_FI_DEV_SM_CLOCK",
+			PromType: "gauge", Help: "SM clock frequency (in MHz)."},
+		Value: "1410",
+	},
+	{
+		Counter: dcgmexporter.Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP",
+			PromType: "gauge", Help: "GPU temperature (in C)."},
+		Value: "62",
+	},
+	{
+		Counter: dcgmexporter.Counter{FieldID: dcgm.DCGM_FI_DEV_POWER_USAGE, FieldName: "DCGM_FI_DEV_POWER_USAGE",
+			PromType: "gauge", Help: "Power draw (in W)."},
+		Value: "312.5",
+	},
+	{
+		Counter: dcgmexporter.Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_UTIL, FieldName: "DCGM_FI_DEV_GPU_UTIL",
+			PromType: "gauge", Help: "GPU utilization (in %)."},
+		Value: "87",
+	},
+	{
+		Counter: dcgmexporter.Counter{FieldID: dcgm.DCGM_FI_DEV_FB_USED, FieldName: "DCGM_FI_DEV_FB_USED",
+			PromType: "gauge", Help: "Framebuffer memory used (in MiB)."},
+		Value: "61440",
+	},
+	{
+		Counter: dcgmexporter.Counter{FieldID: dcgm.DCGM_FI_DEV_XID_ERRORS, FieldName: "DCGM_FI_DEV_XID_ERRORS",
+			PromType: "gauge", Help: "Value of the last XID error encountered."},
+		Value: "0",
+	},
+}
+
+// MetricsBuilder generates the field values of the devices of a fake node, as the collectors report them.
+type MetricsBuilder struct {
+	sysInfo  dcgmexporter.SystemInfo
+	hostname string
+	values   []FieldValue
+}
+
+// NewMetrics returns a builder of the metrics of the GPUs, and of their MIG instances, of the node.
+func NewMetrics(sysInfo dcgmexporter.SystemInfo) *MetricsBuilder {
+	return &MetricsBuilder{sysInfo: sysInfo, hostname: "node"}
+}
+
+// WithHostname sets the hostname of the metrics, node by default.
+func (b *MetricsBuilder) WithHostname(hostname string) *MetricsBuilder {
+	b.hostname = hostname
+	return b
+}
+
+// WithCounters adds counters with the same value for every device.
+func (b *MetricsBuilder) WithCounters(values ...FieldValue) *MetricsBuilder {
+	b.values = append(b.values, values...)
+	return b
+}
+
+// WithCounter adds a counter with the value for every device.
+func (b *MetricsBuilder) WithCounter(counter dcgmexporter.Counter, value string) *MetricsBuilder {
+	return b.WithCounters(FieldValue{Counter: counter, Value: value})
+}
+
+// Build returns the metrics of every device for every counter. The MIG instances report the metrics of the GPUs
+// they partition, which report none.
+func (b *MetricsBuilder) Build() dcgmexporter.MetricsByCounter {
+	metrics := dcgmexporter.MetricsByCounter{}
+
+	for _, value := range b.values {
+		for i := uint(0); i < b.sysInfo.GPUCount; i++ {
+			gpu := b.sysInfo.GPUs[i]
+
+			metric := dcgmexporter.Metric{
+				Counter:      value.Counter,
+				Value:        value.Value,
+				UUID:         "UUID",
+				GPU:          fmt.Sprintf("%d", gpu.DeviceInfo.GPU),
+				GPUUUID:      gpu.DeviceInfo.UUID,
+				GPUDevice:    fmt.Sprintf("nvidia%d", gpu.DeviceInfo.GPU),
+				GPUModelName: gpu.DeviceInfo.Identifiers.Model,
+				GPUPCIBusID:  gpu.DeviceInfo.PCI.BusID,
+				Hostname:     b.hostname,
+				Labels:       map[string]string{},
+				Attributes:   map[string]string{},
+			}
+
+			if len(gpu.GPUInstances) == 0 {
+				metrics[value.Counter] = append(metrics[value.Counter], metric)
+				continue
+			}
+
+			for _, instance := range gpu.GPUInstances {
+				metric.MigProfile = instance.ProfileName
+				metric.GPUInstanceID = fmt.Sprintf("%d", instance.Info.NvmlInstanceId)
+				metric.Labels = map[string]string{}
+				metric.Attributes = map[string]string{}
+				metrics[value.Counter] = append(metrics[value.Counter], metric)
+			}
+		}
+	}
+
+	return metrics
+}
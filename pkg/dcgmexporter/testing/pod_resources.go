@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package testing
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// NvidiaResourceName is the resource of the GPUs advertised by the NVIDIA device plugin.
+const NvidiaResourceName = "nvidia.com/gpu"
+
+// PodResourcesServer is a fake of the kubelet pod-resources API, serving the devices assigned to the containers of
+// its pods.
+type PodResourcesServer struct {
+	podresourcesapi.UnimplementedPodResourcesListerServer
+
+	mtx         sync.Mutex
+	pods        []*podresourcesapi.PodResources
+	allocatable map[string][]string
+}
+
+// NewPodResourcesServer returns a fake kubelet without pods.
+func NewPodResourcesServer() *PodResourcesServer {
+	return &PodResourcesServer{allocatable: map[string][]string{}}
+}
+
+// WithPod assigns the devices of the resource to a container of a pod. The devices are also allocatable.
+func (s *PodResourcesServer) WithPod(
+	namespace, name, container, resourceName string, deviceIDs ...string,
+) *PodResourcesServer {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var pod *podresourcesapi.PodResources
+	for _, p := range s.pods {
+		if p.GetNamespace() == namespace && p.GetName() == name {
+			pod = p
+		}
+	}
+	if pod == nil {
+		pod = &podresourcesapi.PodResources{Name: name, Namespace: namespace}
+		s.pods = append(s.pods, pod)
+	}
+
+	pod.Containers = append(pod.Containers, &podresourcesapi.ContainerResources{
+		Name: container,
+		Devices: []*podresourcesapi.ContainerDevices{
+			{ResourceName: resourceName, DeviceIds: deviceIDs},
+		},
+	})
+	s.allocatable[resourceName] = append(s.allocatable[resourceName], deviceIDs...)
+	return s
+}
+
+// WithAllocatable adds devices of the resource the kubelet can assign, without assigning them.
+func (s *PodResourcesServer) WithAllocatable(resourceName string, deviceIDs ...string) *PodResourcesServer {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.allocatable[resourceName] = append(s.allocatable[resourceName], deviceIDs...)
+	return s
+}
+
+// RemovePods removes all the pods, e.g. to test the transforms once the workloads completed. The devices stay
+// allocatable.
+func (s *PodResourcesServer) RemovePods() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.pods = nil
+}
+
+func (s *PodResourcesServer) List(
+	context.Context, *podresourcesapi.ListPodResourcesRequest,
+) (*podresourcesapi.ListPodResourcesResponse, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return &podresourcesapi.ListPodResourcesResponse{PodResources: s.pods}, nil
+}
+
+func (s *PodResourcesServer) GetAllocatableResources(
+	context.Context, *podresourcesapi.AllocatableResourcesRequest,
+) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var devices []*podresourcesapi.ContainerDevices
+	for resourceName, deviceIDs := range s.allocatable {
+		devices = append(devices, &podresourcesapi.ContainerDevices{ResourceName: resourceName, DeviceIds: deviceIDs})
+	}
+
+	return &podresourcesapi.AllocatableResourcesResponse{Devices: devices}, nil
+}
+
+// Start serves the pod-resources API on the Unix socket, it returns a function stopping the server.
+func (s *PodResourcesServer) Start(socket string) (func(), error) {
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on '%s'; err: %w", socket, err)
+	}
+
+	server := grpc.NewServer()
+	podresourcesapi.RegisterPodResourcesListerServer(server, s)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = server.Serve(l)
+	}()
+
+	return func() {
+		server.Stop()
+		<-stopped
+	}, nil
+}
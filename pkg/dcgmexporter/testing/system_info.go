@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package testing
+
+import (
+	"fmt"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+
+	"github.com/NVIDIA/dcgm-exporter/pkg/dcgmexporter"
+)
+
+// DefaultModelName is the model of the GPUs added without options.
+const DefaultModelName = "NVIDIA A100-SXM4-80GB"
+
+// SystemInfoBuilder describes the GPUs of a fake node.
+type SystemInfoBuilder struct {
+	sysInfo dcgmexporter.SystemInfo
+}
+
+// NewSystemInfo returns a builder of a node without GPUs.
+func NewSystemInfo() *SystemInfoBuilder {
+	return &SystemInfoBuilder{sysInfo: dcgmexporter.SystemInfo{InfoType: dcgm.FE_GPU}}
+}
+
+// WithGPU adds a GPU, numbered after the GPUs already added, with its UUID and a PCI bus ID derived from its number.
+func (b *SystemInfoBuilder) WithGPU(uuid string) *SystemInfoBuilder {
+	return b.WithDevice(dcgm.Device{UUID: uuid})
+}
+
+// WithDevice adds a GPU described by the device, numbered after the GPUs already added. The model and the PCI bus ID
+// are set when they are empty.
+func (b *SystemInfoBuilder) WithDevice(device dcgm.Device) *SystemInfoBuilder {
+	gpu := b.sysInfo.GPUCount
+	if gpu >= dcgm.MAX_NUM_DEVICES {
+		panic(fmt.Sprintf("a node has at most %d GPUs", dcgm.MAX_NUM_DEVICES))
+	}
+
+	device.GPU = gpu
+	if device.Identifiers.Model == "" {
+		device.Identifiers.Model = DefaultModelName
+	}
+	if device.PCI.BusID == "" {
+		device.PCI.BusID = fmt.Sprintf("00000000:%02X:00.0", 0x10+gpu)
+	}
+
+	b.sysInfo.GPUs[gpu].DeviceInfo = device
+	b.sysInfo.GPUCount++
+	return b
+}
+
+// WithGPUInstance partitions the last GPU added with a MIG instance of the profile, e.g. 1g.10gb. The instances are
+// numbered per GPU and their entities across the node, as DCGM does.
+func (b *SystemInfoBuilder) WithGPUInstance(profileName string) *SystemInfoBuilder {
+	if b.sysInfo.GPUCount == 0 {
+		panic("a GPU instance needs a GPU")
+	}
+
+	entityID := uint(0)
+	for i := uint(0); i < b.sysInfo.GPUCount; i++ {
+		entityID += uint(len(b.sysInfo.GPUs[i].GPUInstances))
+	}
+
+	gpu := &b.sysInfo.GPUs[b.sysInfo.GPUCount-1]
+	gpu.MigEnabled = true
+	gpu.GPUInstances = append(gpu.GPUInstances, dcgmexporter.GPUInstanceInfo{
+		Info: dcgm.MigEntityInfo{
+			GpuUuid:        gpu.DeviceInfo.UUID,
+			NvmlGpuIndex:   gpu.DeviceInfo.GPU,
+			NvmlInstanceId: uint(len(gpu.GPUInstances)),
+		},
+		ProfileName: profileName,
+		EntityId:    entityID,
+	})
+	return b
+}
+
+// Build returns the description of the node.
+func (b *SystemInfoBuilder) Build() dcgmexporter.SystemInfo {
+	return b.sysInfo
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package testing_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/testutils"
+	"github.com/NVIDIA/dcgm-exporter/pkg/dcgmexporter"
+	dcgmtesting "github.com/NVIDIA/dcgm-exporter/pkg/dcgmexporter/testing"
+)
+
+func TestSystemInfoBuilder(t *testing.T) {
+	sysInfo := dcgmtesting.NewSystemInfo().
+		WithGPU("GPU-0").
+		WithGPU("GPU-1").WithGPUInstance("1g.10gb").WithGPUInstance("3g.40gb").
+		Build()
+
+	require.Equal(t, uint(2), sysInfo.GPUCount)
+	assert.Equal(t, uint(1), sysInfo.GPUs[1].DeviceInfo.GPU)
+	assert.Equal(t, "00000000:11:00.0", sysInfo.GPUs[1].DeviceInfo.PCI.BusID)
+	assert.Equal(t, dcgmtesting.DefaultModelName, sysInfo.GPUs[1].DeviceInfo.Identifiers.Model)
+	assert.False(t, sysInfo.GPUs[0].MigEnabled)
+	require.Len(t, sysInfo.GPUs[1].GPUInstances, 2)
+	assert.Equal(t, uint(1), sysInfo.GPUs[1].GPUInstances[1].Info.NvmlInstanceId)
+	assert.Equal(t, uint(1), sysInfo.GPUs[1].GPUInstances[1].EntityId)
+
+	metrics := dcgmtesting.NewMetrics(sysInfo).WithCounters(dcgmtesting.Counters...).Build()
+	require.Len(t, metrics, len(dcgmtesting.Counters))
+	for _, value := range dcgmtesting.Counters {
+		counterMetrics := metrics[value.Counter]
+		require.Len(t, counterMetrics, 3)
+		assert.Equal(t, "GPU-0", counterMetrics[0].GPUUUID)
+		assert.Empty(t, counterMetrics[0].MigProfile)
+		assert.Equal(t, "1g.10gb", counterMetrics[1].MigProfile)
+		assert.Equal(t, "1", counterMetrics[2].GPUInstanceID)
+		assert.Equal(t, value.Value, counterMetrics[2].Value)
+	}
+}
+
+func TestPodResourcesServer(t *testing.T) {
+	testutils.RequireLinux(t)
+
+	socket := filepath.Join(t.TempDir(), "kubelet.sock")
+	kubelet := dcgmtesting.NewPodResourcesServer().
+		WithPod("default", "trainer", "main", dcgmtesting.NvidiaResourceName, "GPU-0").
+		WithAllocatable(dcgmtesting.NvidiaResourceName, "GPU-1")
+	stop, err := kubelet.Start(socket)
+	require.NoError(t, err)
+	defer stop()
+
+	sysInfo := dcgmtesting.NewSystemInfo().WithGPU("GPU-0").WithGPU("GPU-1").Build()
+	metrics := dcgmtesting.NewMetrics(sysInfo).WithCounters(dcgmtesting.Counters...).Build()
+
+	podMapper, err := dcgmexporter.NewPodMapper(&dcgmexporter.Config{
+		KubernetesGPUIdType:       dcgmexporter.GPUUID,
+		PodResourcesKubeletSocket: socket,
+	})
+	require.NoError(t, err)
+	require.NoError(t, podMapper.Process(metrics, sysInfo))
+
+	for _, value := range dcgmtesting.Counters {
+		counterMetrics := metrics[value.Counter]
+		require.Len(t, counterMetrics, 2)
+		assert.Equal(t, "trainer", counterMetrics[0].Attributes["pod"])
+		assert.Equal(t, "default", counterMetrics[0].Attributes["namespace"])
+		assert.Equal(t, "main", counterMetrics[0].Attributes["container"])
+		assert.NotContains(t, counterMetrics[1].Attributes, "pod")
+	}
+
+	kubelet.RemovePods()
+	metrics = dcgmtesting.NewMetrics(sysInfo).WithCounters(dcgmtesting.Counters...).Build()
+	require.NoError(t, podMapper.Process(metrics, sysInfo))
+	for _, counterMetrics := range metrics {
+		assert.NotContains(t, counterMetrics[0].Attributes, "pod")
+	}
+}
@@ -0,0 +1,62 @@
+//go:build transformplugins
+
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"plugin"
+
+	"github.com/sirupsen/logrus"
+)
+
+// NewTransformSymbol is the symbol the Go plugins of --transform-plugins export to create their transform, a
+// func(*dcgmexporter.Config) (dcgmexporter.Transform, error). The plugins must be built with the same Go version and
+// dependencies as the exporter.
+//
+// Go plugins are only supported by the exporter built with the transformplugins tag, since importing the plugin
+// package binds the symbols of the NVML library at startup unless the binary is linked with -z lazy.
+const NewTransformSymbol = "NewTransform"
+
+// loadTransformPlugin creates the transform of the Go plugin at path.
+func loadTransformPlugin(path string, c *Config) (Transform, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the transform plugin '%s'; err: %w", path, err)
+	}
+
+	symbol, err := p.Lookup(NewTransformSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transform plugin '%s'; err: %w", path, err)
+	}
+
+	newTransform, ok := symbol.(func(*Config) (Transform, error))
+	if !ok {
+		return nil, fmt.Errorf("invalid transform plugin '%s'; %s is a %T, not a func(*Config) (Transform, error)",
+			path, NewTransformSymbol, symbol)
+	}
+
+	transform, err := newTransform(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the transform of the plugin '%s'; err: %w", path, err)
+	}
+
+	logrus.Infof("Loaded the transform %q of the plugin %q", transform.Name(), path)
+
+	return transform, nil
+}
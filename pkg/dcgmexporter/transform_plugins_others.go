@@ -0,0 +1,27 @@
+//go:build !transformplugins
+
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import "fmt"
+
+// loadTransformPlugin fails without the transformplugins tag, see transform_plugins.go.
+func loadTransformPlugin(path string, _ *Config) (Transform, error) {
+	return nil, fmt.Errorf("failed to open the transform plugin '%s'; the exporter is built without the "+
+		"transformplugins tag", path)
+}
@@ -18,11 +18,18 @@ package dcgmexporter
 
 import (
 	"fmt"
+	"maps"
+	"net"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
+	"time"
 
 	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/gorilla/mux"
 	"github.com/prometheus/exporter-toolkit/web"
 )
 
@@ -31,16 +38,30 @@ var (
 	FailedToConvert = "ERROR - FAILED TO CONVERT TO STRING"
 
 	nvidiaResourceName      = "nvidia.com/gpu"
+	nvidiaResourcePrefix    = "nvidia.com/"
 	nvidiaMigResourcePrefix = "nvidia.com/mig-"
 	MIG_UUID_PREFIX         = "MIG-"
+	GPU_UUID_PREFIX         = "GPU-"
 
 	// Note standard resource attributes
 	podAttribute       = "pod"
 	namespaceAttribute = "namespace"
 	containerAttribute = "container"
+	ownerKindAttribute = "owner_kind"
+	ownerNameAttribute = "owner_name"
+	allocatedAttribute = "allocated"
+	vgpuAttribute      = "vgpu"
+
+	mpsAttribute                       = "mps"
+	mpsActiveThreadPercentageAttribute = "mps_active_thread_percentage"
+	mpsPinnedMemoryLimitAttribute      = "mps_pinned_memory_limit_mib"
 
 	hpcJobAttribute = "hpc_job"
 
+	// Exemplar labels, their names and values must stay below 128 characters
+	exemplarPodUIDLabel      = "pod_uid"
+	exemplarContainerIDLabel = "container_id"
+
 	oldPodAttribute       = "pod_name"
 	oldNamespaceAttribute = "pod_namespace"
 	oldContainerAttribute = "container_name"
@@ -48,8 +69,14 @@ var (
 	undefinedConfigMapData = "none"
 )
 
+// Transform is a step of the pipeline modifying the metrics of every collection before they are exported, e.g. to
+// attribute them to pods. The transforms run in a chain, each one seeing the changes of the previous ones. External
+// transforms are loaded from Go plugins and executables, see --transform-plugins and --transform-hooks.
 type Transform interface {
+	// Process updates, adds or removes the metrics of the entities of sysInfo in place. An error stops the
+	// collection.
 	Process(metrics MetricsByCounter, sysInfo SystemInfo) error
+	// Name identifies the transform in the logs and the timings of the debug status.
 	Name() string
 }
 
@@ -62,6 +89,7 @@ type MetricsPipeline struct {
 	linkMetricsFormat    *template.Template
 	cpuMetricsFormat     *template.Template
 	cpuCoreMetricsFormat *template.Template
+	podMetricsFormat     *template.Template
 
 	counters        []Counter
 	gpuCollector    *DCGMCollector
@@ -69,6 +97,20 @@ type MetricsPipeline struct {
 	linkCollector   *DCGMCollector
 	cpuCollector    *DCGMCollector
 	coreCollector   *DCGMCollector
+
+	sinks []*sinkWriter
+	// registry is set when the exporter metrics are gathered in every collection instead of every scrape
+	registry *Registry
+
+	// timings holds the duration of the last run of the collectors and the transformations by name
+	timingsMtx sync.Mutex
+	timings    map[string]time.Duration
+
+	// startup is set when the readiness of the exporter is gated on the first complete collection
+	startup *Startup
+
+	// fabricLeader is set when the switches and the links are only published by the leader of the NVSwitch domain
+	fabricLeader *FabricLeader
 }
 
 type DCGMCollector struct {
@@ -79,6 +121,33 @@ type DCGMCollector struct {
 	SysInfo                  SystemInfo
 	Hostname                 string
 	ReplaceBlanksInModelName bool
+	// source replaces DCGM in the simulation, record and replay modes
+	source fieldValuesSource
+	// aggregator is nil when no field is aggregated
+	aggregator *fieldAggregator
+	// resets is nil when the monotonic counters are disabled
+	resets *counterResets
+	// energyJoules converts the energy consumption from mJ to J
+	energyJoules bool
+	// unitScales converts the values of the fields to the base unit of their metric, it is nil with the legacy names
+	unitScales map[dcgm.Short]float64
+	// unsupportedFields holds, by GPU, the profiling fields the GPU does not support, they are neither watched nor read
+	unsupportedFields map[uint]map[dcgm.Short]bool
+	// workers is the number of entities whose field values are read concurrently
+	workers int
+	// sampleTimestamps exports the time DCGM sampled the values, sampleAge their age at the time returned by now
+	sampleTimestamps SampleTimestamps
+	sampleAge        bool
+	now              func() time.Time
+	// sourceLabel labels the metrics with their source when they are not collected with DCGM
+	sourceLabel string
+}
+
+// fieldValuesSource reads the latest values of the fields of an entity instead of DCGM.
+type fieldValuesSource interface {
+	latestValues(entity dcgm.GroupEntityPair, parentID uint, fields []dcgm.Short) ([]dcgm.FieldValue_v1, error)
+	// collected is called at the end of every collection
+	collected(sysInfo SystemInfo)
 }
 
 type Counter struct {
@@ -102,10 +171,29 @@ type Metric struct {
 
 	MigProfile    string
 	GPUInstanceID string
-	Hostname      string
+	// ComputeInstanceID is set for the GPU instances with a single compute instance
+	ComputeInstanceID string
+	Hostname          string
+	// Suffix is appended to the name of the counter for the samples of the histograms, i.e. _bucket, _sum and _count
+	Suffix string
 
 	Labels     map[string]string
 	Attributes map[string]string
+	// Exemplar holds the labels of the OpenMetrics exemplar attached to the sample, e.g. the pod UID
+	Exemplar map[string]string
+	// ExemplarTimestamp is the time DCGM sampled the value, attached to the exemplar when it is set
+	ExemplarTimestamp time.Time
+}
+
+// withAttributes returns a copy of the metric with its own attributes, so that the copies of a metric sharing a GPU
+// are attributed independently. The labels and the exemplar are shared, they are replaced and never modified.
+func (m Metric) withAttributes() Metric {
+	m.Attributes = maps.Clone(m.Attributes)
+	if m.Attributes == nil {
+		m.Attributes = map[string]string{}
+	}
+
+	return m
 }
 
 func (m Metric) getIDOfType(idType KubernetesGPUIDType) (string, error) {
@@ -122,32 +210,129 @@ func (m Metric) getIDOfType(idType KubernetesGPUIDType) (string, error) {
 	return "", fmt.Errorf("unsupported KubernetesGPUIDType for MetricID '%s'", idType)
 }
 
+// HasExemplar returns whether an OpenMetrics exemplar is attached to the sample.
+func (m Metric) HasExemplar() bool {
+	return m.Exemplar != nil || !m.ExemplarTimestamp.IsZero()
+}
+
+// ExemplarTime formats the timestamp of the exemplar in seconds, it is empty when the exemplar has no timestamp.
+func (m Metric) ExemplarTime() string {
+	if m.ExemplarTimestamp.IsZero() {
+		return ""
+	}
+	return formatSampleTime(m.ExemplarTimestamp)
+}
+
+// ExemplarLabels formats the labels of the exemplar as an OpenMetrics label set, without the braces.
+func (m Metric) ExemplarLabels() string {
+	keys := make([]string, 0, len(m.Exemplar))
+	for k := range m.Exemplar {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	labels := make([]string, 0, len(keys))
+	for _, k := range keys {
+		labels = append(labels, k+`="`+escapeLabelValue(m.Exemplar[k])+`"`)
+	}
+
+	return strings.Join(labels, ",")
+}
+
 var promMetricType = map[string]bool{
 	"gauge":     true,
 	"counter":   true,
 	"histogram": true,
 	"summary":   true,
 	"label":     true,
+	"bitmask":   true,
 }
 
 type MetricsServer struct {
 	sync.Mutex
 
 	server      *http.Server
+	router      *mux.Router
 	webConfig   *web.FlagConfig
 	metrics     string
 	metricsChan chan string
 	registry    *Registry
+	// exemplars is set when the metrics hold exemplars, they are only served in the OpenMetrics format
+	exemplars bool
+	// openMetricsConverter converts the metrics of every collection when OpenMetrics is enabled, and
+	// openMetricsScrape the exporter metrics of every scrape
+	openMetricsConverter *openMetricsConverter
+	openMetricsScrape    *openMetricsConverter
+	openMetricsText      string
+	// listener is set when the metrics are served on a Unix domain socket
+	listener net.Listener
+	// backgroundCollection is set when the exporter metrics are gathered by the pipeline, with the DCGM metrics
+	backgroundCollection bool
+	// scrapeCache holds the exporter metrics of the last scrape, served again until they are older than
+	// scrapeCacheMaxAge; it is disabled when the age is zero
+	scrapeCache       scrapeCache
+	scrapeCacheMaxAge time.Duration
+	// startup is set when the readiness, and the scrapes, are gated on the startup of the exporter
+	startup *Startup
+	// counterGroups holds the names of the counters of every group the scrapes can select
+	counterGroups map[string][]string
+	// namespaceLabels are the labels the namespace of the pods is exported with, for the namespace scopes
+	namespaceLabels []string
+}
+
+// scrapeCache is the rendering of the exporter metrics of a scrape.
+type scrapeCache struct {
+	sync.Mutex
+	text       string
+	gatheredAt time.Time
 }
 
 type PodMapper struct {
-	Config *Config
+	Config      *Config
+	kubelet     *kubeletClient
+	podMetadata *podMetadataCache
+	useV1alpha1 atomic.Bool
+	// mpsResources maps the resource names shared with MPS to their number of replicas
+	mpsResources map[string]int
+	// timeSlicingResources maps the resource names shared with time-slicing to their number of replicas, they are
+	// only loaded for the sharing metrics
+	timeSlicingResources map[string]int
+	// deviceIDParsers decode the device IDs of the enabled third-party device plugins
+	deviceIDParsers []DeviceIDParser
+	// detectResources attributes the other nvidia.com resources whose device IDs are the IDs of GPUs
+	detectResources bool
+	podFilter       *podFilter
+	// strategy decides which pods the metrics of a device are attributed to
+	strategy deviceMappingStrategy
+	// migStrategy is the MIG strategy of the device plugin, it is empty when it is unknown
+	migStrategy MIGStrategy
+	// attributeNames names the attributes describing the pods
+	attributeNames podAttributeNames
+	// allocations holds when the devices were allocated to the containers, it is nil when the allocation duration
+	// is not exported
+	allocations *podAllocations
+
+	// deviceToPods holds the mapping of the last run for the debug and mapping endpoints, and sysInfo the devices
+	// it was made for
+	deviceToPodsMtx sync.Mutex
+	deviceToPods    map[string][]PodInfo
+	sysInfo         SystemInfo
+	// mapped is set once the pods of the kubelet were mapped to the devices
+	mapped atomic.Bool
 }
 
 type PodInfo struct {
 	Name      string
 	Namespace string
 	Container string
+	// VGPU is the replica of the GPU held by the container when the GPU is shared
+	VGPU string
+	// MPSAttributes holds the MPS limits of the container when the GPU is shared with MPS
+	MPSAttributes map[string]string
+	// Sharing is the sharing of the GPU configured in the device plugin config, mps or time-slicing, and
+	// SharingReplicas its number of replicas; they are only set for the sharing metrics
+	Sharing         string
+	SharingReplicas int
 }
 
 // MetricsByCounter represents a map where each Counter is associated with a slice of Metric objects
@@ -157,4 +342,12 @@ type MetricsByCounter map[Counter][]Metric
 type CounterSet struct {
 	DCGMCounters     []Counter
 	ExporterCounters []Counter
+	// CollectIntervals holds the interval of the DCGM counters with a fourth column
+	CollectIntervals map[dcgm.Short]time.Duration
+	// Aggregations holds the aggregation of the DCGM counters with a fifth column
+	Aggregations map[dcgm.Short]string
+	// Groups holds the names of the counters of every group of their sixth column
+	Groups map[string][]string
+	// Histograms holds the upper bounds of the buckets of the DCGM counters of the histogram type
+	Histograms map[dcgm.Short][]float64
 }
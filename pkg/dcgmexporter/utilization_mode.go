@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+const dcgmExporterUtilizationMode = "DCGM_EXPORTER_UTILIZATION_MODE"
+
+// profilingUtilizationCounters are the profiling counters measuring the utilization of the legacy fields more
+// accurately, by legacy field.
+var profilingUtilizationCounters = map[dcgm.Short]Counter{
+	dcgm.DCGM_FI_DEV_GPU_UTIL: {
+		FieldID:   dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE,
+		FieldName: "DCGM_FI_PROF_GR_ENGINE_ACTIVE",
+		PromType:  "gauge",
+		Help:      "Ratio of time the graphics engine is active (in %).",
+	},
+	dcgm.DCGM_FI_DEV_MEM_COPY_UTIL: {
+		FieldID:   dcgm.DCGM_FI_PROF_DRAM_ACTIVE,
+		FieldName: "DCGM_FI_PROF_DRAM_ACTIVE",
+		PromType:  "gauge",
+		Help:      "Ratio of cycles the device memory interface is active sending or receiving data (in %).",
+	},
+}
+
+// ApplyUtilizationMode replaces the legacy utilization counters by their profiling counters, or adds them, when the
+// GPUs support the profiling fields, so that a counters file fits a fleet with GPUs of every generation. It returns
+// the mode in effect, which is exported by DCGM_EXPORTER_UTILIZATION_MODE.
+func ApplyUtilizationMode(cs *CounterSet, c *Config) UtilizationMode {
+	mode := c.UtilizationMode
+	if mode == "" {
+		mode = UtilizationModeLegacy
+	}
+
+	if mode != UtilizationModeLegacy && !profilingUtilizationSupported(c) {
+		logrus.Infof("The profiling utilization fields are not supported, the %s utilization mode falls back to %s",
+			mode, UtilizationModeLegacy)
+		mode = UtilizationModeLegacy
+	}
+
+	if mode != UtilizationModeLegacy {
+		cs.DCGMCounters = profilingUtilization(cs, mode)
+	}
+
+	for _, m := range []UtilizationMode{UtilizationModeLegacy, UtilizationModeProfiling, UtilizationModeBoth} {
+		value := 0.0
+		if m == mode {
+			value = 1
+		}
+		selfMetrics.SetGauge(dcgmExporterUtilizationMode,
+			"Utilization fields exported, legacy, profiling or both, the value is 1 for the mode in effect.",
+			map[string]string{"mode": string(m)}, value)
+	}
+
+	return mode
+}
+
+func profilingUtilizationSupported(c *Config) bool {
+	for _, counter := range profilingUtilizationCounters {
+		if !fieldIsSupported(uint(counter.FieldID), c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func profilingUtilization(cs *CounterSet, mode UtilizationMode) []Counter {
+	exists := map[dcgm.Short]bool{}
+	for _, counter := range cs.DCGMCounters {
+		exists[counter.FieldID] = true
+	}
+
+	counters := make([]Counter, 0, len(cs.DCGMCounters))
+	for _, counter := range cs.DCGMCounters {
+		profiling, isLegacy := profilingUtilizationCounters[counter.FieldID]
+		if !isLegacy || counter.PromType == "label" {
+			counters = append(counters, counter)
+			continue
+		}
+
+		if mode == UtilizationModeBoth {
+			counters = append(counters, counter)
+		}
+
+		if exists[profiling.FieldID] {
+			continue
+		}
+		exists[profiling.FieldID] = true
+		counters = append(counters, profiling)
+
+		// The profiling field is collected like the legacy one
+		if interval, ok := cs.CollectIntervals[counter.FieldID]; ok {
+			cs.setCollectInterval(profiling.FieldID, interval)
+		}
+		if aggregation, ok := cs.Aggregations[counter.FieldID]; ok {
+			cs.setAggregation(profiling.FieldID, aggregation)
+		}
+		cs.addToGroups(profiling.FieldName, cs.groupsOf(counter.FieldName))
+	}
+
+	return counters
+}
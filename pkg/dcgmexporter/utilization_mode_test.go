@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyUtilizationMode(t *testing.T) {
+	gpuUtil := Counter{dcgm.DCGM_FI_DEV_GPU_UTIL, "DCGM_FI_DEV_GPU_UTIL", "gauge", "GPU utilization (in %)."}
+	memUtil := Counter{dcgm.DCGM_FI_DEV_MEM_COPY_UTIL, "DCGM_FI_DEV_MEM_COPY_UTIL", "gauge", "Memory utilization (in %)."}
+	temp := Counter{dcgm.DCGM_FI_DEV_GPU_TEMP, "DCGM_FI_DEV_GPU_TEMP", "gauge", "GPU temperature (in C)."}
+	grActive := profilingUtilizationCounters[dcgm.DCGM_FI_DEV_GPU_UTIL]
+	dramActive := profilingUtilizationCounters[dcgm.DCGM_FI_DEV_MEM_COPY_UTIL]
+
+	profilingConfig := func(mode UtilizationMode) *Config {
+		return &Config{
+			UtilizationMode: mode,
+			CollectDCP:      true,
+			MetricGroups:    ProfilingMetricGroups(),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		config   *Config
+		wantMode UtilizationMode
+		want     []Counter
+	}{
+		{
+			name:     "legacy",
+			config:   profilingConfig(UtilizationModeLegacy),
+			wantMode: UtilizationModeLegacy,
+			want:     []Counter{gpuUtil, memUtil, temp},
+		},
+		{
+			name:     "profiling",
+			config:   profilingConfig(UtilizationModeProfiling),
+			wantMode: UtilizationModeProfiling,
+			want:     []Counter{grActive, dramActive, temp},
+		},
+		{
+			name:     "both",
+			config:   profilingConfig(UtilizationModeBoth),
+			wantMode: UtilizationModeBoth,
+			want:     []Counter{gpuUtil, grActive, memUtil, dramActive, temp},
+		},
+		{
+			name:     "profiling not supported",
+			config:   &Config{UtilizationMode: UtilizationModeProfiling},
+			wantMode: UtilizationModeLegacy,
+			want:     []Counter{gpuUtil, memUtil, temp},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := &CounterSet{DCGMCounters: []Counter{gpuUtil, memUtil, temp}}
+			cs.setCollectInterval(dcgm.DCGM_FI_DEV_GPU_UTIL, time.Second)
+
+			assert.Equal(t, tt.wantMode, ApplyUtilizationMode(cs, tt.config))
+			assert.Equal(t, tt.want, cs.DCGMCounters)
+
+			if tt.wantMode != UtilizationModeLegacy {
+				assert.Equal(t, time.Second, cs.CollectIntervals[dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE])
+			}
+
+			for _, mode := range []UtilizationMode{UtilizationModeLegacy, UtilizationModeProfiling, UtilizationModeBoth} {
+				value, _ := selfMetrics.Value(dcgmExporterUtilizationMode, map[string]string{"mode": string(mode)})
+				assert.Equal(t, mode == tt.wantMode, value == 1, mode)
+			}
+		})
+	}
+
+	// The profiling fields of the counters file are not duplicated
+	cs := &CounterSet{DCGMCounters: []Counter{gpuUtil, grActive}}
+	ApplyUtilizationMode(cs, profilingConfig(UtilizationModeProfiling))
+	assert.Equal(t, []Counter{grActive}, cs.DCGMCounters)
+}
@@ -17,9 +17,8 @@
 package dcgmexporter
 
 import (
-	"bytes"
-	"encoding/gob"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 )
@@ -38,28 +37,28 @@ func WaitWithTimeout(wg *sync.WaitGroup, timeout time.Duration) error {
 	}
 }
 
-func deepCopy[T any](src T) (dst T, err error) {
-	var buf bytes.Buffer
-
-	defer func() {
-		if r := recover(); r != nil {
-			// If there was a panic, return the zero value of T and the error.
-			dst = *new(T)
-			err = fmt.Errorf("panic occurred: %v", r)
+// sanitizeLabelName converts an arbitrary string, like a Kubernetes label key, into a valid Prometheus label name.
+func sanitizeLabelName(name string) string {
+	var sb strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			sb.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				sb.WriteRune('_')
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('_')
 		}
-	}()
-
-	// Create an encoder and send a value.
-	err = gob.NewEncoder(&buf).Encode(src)
-	if err != nil {
-		return *new(T), err
 	}
+	return sb.String()
+}
 
-	// Create a new instance of the type T and decode into that.
-	err = gob.NewDecoder(&buf).Decode(&dst)
-	if err != nil {
-		return *new(T), err
-	}
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
 
-	return dst, nil
+// escapeLabelValue escapes a label value according to the Prometheus text exposition format.
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
 }
@@ -46,17 +46,24 @@ func TestWaitWithTimeout(t *testing.T) {
 	})
 }
 
-func TestDeepCopy(t *testing.T) {
-	t.Run("Return error when pointer value is nil", func(t *testing.T) {
-		got, err := deepCopy[*struct{}](nil)
-		assert.Nil(t, got)
-		assert.Error(t, err)
-	})
+func TestSanitizeLabelName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "Valid name", in: "team", want: "team"},
+		{name: "Kubernetes label key with prefix", in: "app.kubernetes.io/name", want: "app_kubernetes_io_name"},
+		{name: "Leading digit", in: "1team", want: "_1team"},
+		{name: "Dashes", in: "cost-center", want: "cost_center"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sanitizeLabelName(tt.in))
+		})
+	}
+}
 
-	t.Run("Return error when src is unsupported type", func(t *testing.T) {
-		ch := make(chan int)
-		got, err := deepCopy(ch)
-		assert.Nil(t, got)
-		assert.Error(t, err)
-	})
+func TestEscapeLabelValue(t *testing.T) {
+	assert.Equal(t, `say \"hi\"\n\\o/`, escapeLabelValue("say \"hi\"\n\\o/"))
 }
@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+// CounterIssue is a problem found in a line of the counters file.
+type CounterIssue struct {
+	Line    int
+	Field   string
+	Message string
+	// Warning is set for the problems that do not prevent the exporter from starting
+	Warning bool
+}
+
+func (i CounterIssue) String() string {
+	level := "error"
+	if i.Warning {
+		level = "warning"
+	}
+
+	if i.Field == "" {
+		return fmt.Sprintf("line %d: %s: %s", i.Line, level, i.Message)
+	}
+
+	return fmt.Sprintf("line %d: %s: %s: %s", i.Line, level, i.Field, i.Message)
+}
+
+// ValidateCountersFile checks the fields of the counters file against the DCGM field database. The profiling fields
+// are checked against the metric groups of the configuration when gpuDetected is set. The included files are checked
+// to exist, not validated.
+func ValidateCountersFile(filename string, c *Config, gpuDetected bool) ([]CounterIssue, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+
+	var issues []CounterIssue
+	firstLines := map[string]int{}
+
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			issues = append(issues, CounterIssue{Line: parseErr.Line, Message: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := r.FieldPos(0)
+
+		for j := range record {
+			record[j] = strings.Trim(record[j], " ")
+		}
+
+		if isCounterInclude(record) {
+			include := includedCounterFile(record, filename)
+			if include == "" {
+				issues = append(issues, CounterIssue{Line: line, Message: "the include has no file"})
+			} else if _, err := os.Stat(include); err != nil {
+				issues = append(issues, CounterIssue{Line: line, Message: fmt.Sprintf("invalid include; %v", err)})
+			}
+			continue
+		}
+
+		if len(record) < 3 || len(record) > 6 {
+			issues = append(issues, CounterIssue{
+				Line:    line,
+				Message: fmt.Sprintf("expected 3 to 6 fields, found %d", len(record)),
+			})
+			continue
+		}
+
+		name, promType := record[0], record[1]
+
+		if first, exists := firstLines[name]; exists {
+			issues = append(issues, CounterIssue{
+				Line:    line,
+				Field:   name,
+				Message: fmt.Sprintf("duplicated field, first defined on line %d", first),
+			})
+			continue
+		}
+		firstLines[name] = line
+
+		issues = append(issues, validateCounter(line, name, promType, c, gpuDetected)...)
+
+		if len(record) >= 4 {
+			if _, err := parseCollectInterval(record[3]); err != nil {
+				issues = append(issues, CounterIssue{
+					Line:    line,
+					Field:   name,
+					Message: fmt.Sprintf("invalid collect interval '%s'", record[3]),
+				})
+			}
+		}
+
+		if promType == histogramPromType {
+			if _, err := parseHistogramBuckets(column(record, 4)); err != nil {
+				issues = append(issues, CounterIssue{
+					Line:    line,
+					Field:   name,
+					Message: fmt.Sprintf("invalid histogram buckets; %v", err),
+				})
+			}
+		} else if len(record) >= 5 {
+			if _, err := parseAggregation(record[4], promType); err != nil {
+				issues = append(issues, CounterIssue{
+					Line:    line,
+					Field:   name,
+					Message: fmt.Sprintf("invalid aggregation; %v", err),
+				})
+			}
+		}
+
+		if len(record) == 6 {
+			if _, err := parseCounterGroups(record[5]); err != nil {
+				issues = append(issues, CounterIssue{
+					Line:    line,
+					Field:   name,
+					Message: fmt.Sprintf("invalid groups; %v", err),
+				})
+			}
+		}
+	}
+
+	return issues, nil
+}
+
+func validateCounter(line int, name, promType string, c *Config, gpuDetected bool) []CounterIssue {
+	fieldID, ok := dcgm.DCGM_FI[name]
+	if !ok {
+		fieldID, ok = dcgm.OLD_DCGM_FI[name]
+	}
+
+	if !ok {
+		if _, exists := DCGMFields[name]; exists {
+			return nil
+		}
+
+		return []CounterIssue{{Line: line, Field: name, Message: "unknown DCGM field"}}
+	}
+
+	var issues []CounterIssue
+
+	if _, ok := promMetricType[promType]; !ok {
+		issues = append(issues, CounterIssue{
+			Line:    line,
+			Field:   name,
+			Message: fmt.Sprintf("unknown Prometheus metric type '%s'", promType),
+		})
+	} else if promType == bitmaskPromType && !isBitmaskSupported(fieldID) {
+		issues = append(issues, CounterIssue{Line: line, Field: name, Message: "field cannot be decoded as a bitmask"})
+	}
+
+	isProfiling := fieldID >= dcpFieldsStart && fieldID < cpuFieldsStart
+	switch {
+	case isProfiling && !gpuDetected:
+		issues = append(issues, CounterIssue{
+			Line:    line,
+			Field:   name,
+			Message: "profiling field not checked, no GPU detected",
+			Warning: true,
+		})
+	case isProfiling && !fieldIsSupported(uint(fieldID), c):
+		issues = append(issues, CounterIssue{
+			Line:    line,
+			Field:   name,
+			Message: "profiling field not supported by the GPU",
+		})
+	}
+
+	return issues
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	sysOS "os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCountersFile(t *testing.T) {
+	collectorsFile := filepath.Join(t.TempDir(), "counters.csv")
+	require.NoError(t, sysOS.WriteFile(collectorsFile, []byte(`# Format
+# DCGM FIELD, Prometheus metric type, help message
+DCGM_FI_DEV_GPU_TEMP, gauge, GPU temperature (in C).
+DCGM_FI_DEV_GPU_TEMPERATURE, gauge, GPU temperature (in C).
+DCGM_FI_DEV_POWER_USAGE, gauge
+DCGM_FI_DEV_GPU_TEMP, gauge, GPU temperature (in C).
+DCGM_FI_DEV_SM_CLOCK, gauges, SM clock frequency (in MHz).
+DCGM_FI_DEV_MEM_CLOCK, bitmask, Memory clock frequency (in MHz).
+DCGM_FI_PROF_GR_ENGINE_ACTIVE, gauge, Ratio of time the graphics engine is active.
+DCGM_FI_PROF_PIPE_TENSOR_ACTIVE, gauge, Ratio of cycles the tensor (HMMA) pipe is active.
+DCGM_EXP_XID_ERRORS_COUNT, gauge, Count of XID Errors within user-specified time window.
+DCGM_FI_DEV_POWER_USAGE, gauge, Power draw (in W)., 1s
+DCGM_FI_DEV_FB_FREE, gauge, Framebuffer memory free (in MiB)., often
+DCGM_FI_DEV_FB_USED, gauge, Framebuffer memory used (in MiB)., 1s, max
+DCGM_FI_DEV_GPU_UTIL, gauge, GPU utilization (in %)., , median
+`), 0o644))
+
+	issues, err := ValidateCountersFile(collectorsFile, &Config{}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []CounterIssue{
+		{Line: 4, Field: "DCGM_FI_DEV_GPU_TEMPERATURE", Message: "unknown DCGM field"},
+		{Line: 5, Message: "expected 3 to 6 fields, found 2"},
+		{Line: 6, Field: "DCGM_FI_DEV_GPU_TEMP", Message: "duplicated field, first defined on line 3"},
+		{Line: 7, Field: "DCGM_FI_DEV_SM_CLOCK", Message: "unknown Prometheus metric type 'gauges'"},
+		{Line: 8, Field: "DCGM_FI_DEV_MEM_CLOCK", Message: "field cannot be decoded as a bitmask"},
+		{Line: 9, Field: "DCGM_FI_PROF_GR_ENGINE_ACTIVE", Message: "profiling field not checked, no GPU detected", Warning: true},
+		{Line: 10, Field: "DCGM_FI_PROF_PIPE_TENSOR_ACTIVE", Message: "profiling field not checked, no GPU detected", Warning: true},
+		{Line: 13, Field: "DCGM_FI_DEV_FB_FREE", Message: "invalid collect interval 'often'"},
+		{Line: 15, Field: "DCGM_FI_DEV_GPU_UTIL", Message: "invalid aggregation; unknown aggregation 'median', expected one of: avg, max, min, sum"},
+	}, issues)
+
+	// The profiling fields are checked against the metric groups of the detected GPU
+	config := &Config{
+		CollectDCP:   true,
+		MetricGroups: []dcgm.MetricGroup{{FieldIds: []uint{uint(dcgm.DCGM_FI["DCGM_FI_PROF_GR_ENGINE_ACTIVE"])}}},
+	}
+	issues, err = ValidateCountersFile(collectorsFile, config, true)
+	require.NoError(t, err)
+	assert.Contains(t, issues,
+		CounterIssue{Line: 10, Field: "DCGM_FI_PROF_PIPE_TENSOR_ACTIVE", Message: "profiling field not supported by the GPU"})
+	assert.NotContains(t, issues,
+		CounterIssue{Line: 9, Field: "DCGM_FI_PROF_GR_ENGINE_ACTIVE", Message: "profiling field not supported by the GPU"})
+
+	assert.Equal(t, "line 4: error: DCGM_FI_DEV_GPU_TEMPERATURE: unknown DCGM field", issues[0].String())
+}
+
+func TestValidateCountersFile_Includes(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, sysOS.WriteFile(filepath.Join(dir, "base.csv"), []byte(`DCGM_FI_DEV_GPU_TEMP, gauge, GPU temperature (in C).
+`), 0o644))
+	collectorsFile := filepath.Join(dir, "counters.csv")
+	require.NoError(t, sysOS.WriteFile(collectorsFile, []byte(`include: base.csv
+include: missing.csv
+include:
+DCGM_FI_DEV_GPU_TEMP, gauge, GPU temperature (in C)., 30s
+`), 0o644))
+
+	issues, err := ValidateCountersFile(collectorsFile, &Config{}, false)
+	require.NoError(t, err)
+	require.Len(t, issues, 2)
+	assert.Equal(t, 2, issues[0].Line)
+	assert.Contains(t, issues[0].Message, "invalid include")
+	assert.Equal(t, CounterIssue{Line: 3, Message: "the include has no file"}, issues[1])
+}
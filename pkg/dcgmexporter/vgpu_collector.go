@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+const (
+	vgpuInstanceLabel = "vgpu_instance"
+	vgpuUUIDLabel     = "vgpu_uuid"
+	vgpuVMIDLabel     = "vm_id"
+)
+
+var nvmlGetVGPUInstancesHook = nvmlprovider.GetVGPUInstances
+
+// vgpuCollector exports the utilization, the framebuffer usage and the license status of the vGPU instances
+// running on the GPUs of a vGPU host, labeled with the VM owning them.
+type vgpuCollector struct {
+	expCollector
+
+	utilizationCounter   *Counter
+	fbUsedCounter        *Counter
+	licenseStatusCounter *Counter
+}
+
+// IsDCGMExpVGPUEnabled checks if one of the DCGM_EXP_VGPU_* counters exists
+func IsDCGMExpVGPUEnabled(counters []Counter) bool {
+	return slices.ContainsFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpVGPUUtilization || c.FieldName == dcgmExpVGPUFBUsed ||
+			c.FieldName == dcgmExpVGPULicenseStatus
+	})
+}
+
+func NewVGPUCollector(counters []Counter,
+	hostname string,
+	config *Config,
+	fieldEntityGroupTypeSystemInfo FieldEntityGroupTypeSystemInfoItem) (Collector, error) {
+	if !IsDCGMExpVGPUEnabled(counters) {
+		logrus.Error(dcgmExpVGPUUtilization + " collector is disabled")
+		return nil, fmt.Errorf(dcgmExpVGPUUtilization + " collector is disabled")
+	}
+
+	transformations, err := getTransformations(config)
+	if err != nil {
+		return nil, err
+	}
+
+	collector := vgpuCollector{
+		expCollector: expCollector{
+			sysInfo:         fieldEntityGroupTypeSystemInfo.SystemInfo,
+			hostname:        hostname,
+			config:          config,
+			transformations: transformations,
+		},
+	}
+
+	for i := range counters {
+		switch counters[i].FieldName {
+		case dcgmExpVGPUUtilization:
+			collector.utilizationCounter = &counters[i]
+		case dcgmExpVGPUFBUsed:
+			collector.fbUsedCounter = &counters[i]
+		case dcgmExpVGPULicenseStatus:
+			collector.licenseStatusCounter = &counters[i]
+		}
+	}
+
+	return &collector, nil
+}
+
+func (c *vgpuCollector) GetMetrics() (MetricsByCounter, error) {
+	uuid := "UUID"
+	if c.config.UseOldNamespace {
+		uuid = "uuid"
+	}
+
+	metrics := make(MetricsByCounter)
+	checked := map[uint]bool{}
+
+	for _, mi := range GetMonitoredEntities(c.sysInfo) {
+		if checked[mi.DeviceInfo.GPU] {
+			continue
+		}
+		checked[mi.DeviceInfo.GPU] = true
+
+		// The vGPUs run on the GPUs, not on their MIG instances
+		mi.InstanceInfo = nil
+
+		instances, err := nvmlGetVGPUInstancesHook(mi.DeviceInfo.UUID)
+		if err != nil {
+			logSampled(logrus.WithError(err), logrus.WarnLevel, err.Error(),
+				"Unable to get vGPU instances of GPU %d", mi.DeviceInfo.GPU)
+			continue
+		}
+
+		for _, instance := range instances {
+			values := []struct {
+				counter *Counter
+				value   int
+			}{
+				{c.utilizationCounter, int(instance.SMUtil)},
+				// In MiB, like DCGM_FI_DEV_FB_USED
+				{c.fbUsedCounter, int(instance.FBUsage / 1024 / 1024)},
+				{c.licenseStatusCounter, instance.LicenseStatus},
+			}
+
+			for _, v := range values {
+				if v.counter == nil {
+					continue
+				}
+
+				m := c.createMetric(map[string]string{
+					vgpuInstanceLabel: fmt.Sprint(instance.ID),
+					vgpuUUIDLabel:     instance.UUID,
+					vgpuVMIDLabel:     instance.VMID,
+				}, mi, uuid, v.value)
+				m.Counter = *v.counter
+				metrics[m.Counter] = append(metrics[m.Counter], m)
+			}
+		}
+	}
+
+	for _, transform := range c.transformations {
+		err := transform.Process(metrics, c.sysInfo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform metrics for transform '%s'; err: %v", transform.Name(), err)
+		}
+	}
+
+	return metrics, nil
+}
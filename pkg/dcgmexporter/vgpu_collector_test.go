@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+func TestVGPUCollector_GetMetrics(t *testing.T) {
+	utilizationCounter := Counter{FieldName: dcgmExpVGPUUtilization, PromType: "gauge"}
+	fbUsedCounter := Counter{FieldName: dcgmExpVGPUFBUsed, PromType: "gauge"}
+
+	sysInfo := SystemInfo{
+		GPUCount: 2,
+		gOpt:     DeviceOptions{Flex: true},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i, UUID: fmt.Sprintf("GPU-%d", i)}
+	}
+
+	defer func() {
+		nvmlGetVGPUInstancesHook = nvmlprovider.GetVGPUInstances
+	}()
+	nvmlGetVGPUInstancesHook = func(uuid string) ([]nvmlprovider.VGPUInstanceInfo, error) {
+		if uuid != "GPU-1" {
+			return nil, nil
+		}
+		return []nvmlprovider.VGPUInstanceInfo{
+			{ID: 7, UUID: "vgpu-7", VMID: "vm-a", FBUsage: 2048 * 1024 * 1024, LicenseStatus: 1, SMUtil: 42},
+			{ID: 8, UUID: "vgpu-8", VMID: "vm-b", FBUsage: 512 * 1024 * 1024, LicenseStatus: 0, SMUtil: 3},
+		}, nil
+	}
+
+	collector, err := NewVGPUCollector([]Counter{utilizationCounter, fbUsedCounter}, "node", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{SystemInfo: sysInfo})
+	require.NoError(t, err)
+	defer collector.Cleanup()
+
+	metrics, err := collector.GetMetrics()
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	require.Len(t, metrics[utilizationCounter], 2)
+	require.Len(t, metrics[fbUsedCounter], 2)
+
+	m := metrics[utilizationCounter][0]
+	assert.Equal(t, "42", m.Value)
+	assert.Equal(t, "GPU-1", m.GPUUUID)
+	assert.Equal(t, "node", m.Hostname)
+	assert.Equal(t, map[string]string{
+		vgpuInstanceLabel: "7",
+		vgpuUUIDLabel:     "vgpu-7",
+		vgpuVMIDLabel:     "vm-a",
+	}, m.Labels)
+
+	assert.Equal(t, "2048", metrics[fbUsedCounter][0].Value)
+	assert.Equal(t, "vm-b", metrics[fbUsedCounter][1].Labels[vgpuVMIDLabel])
+	assert.Equal(t, "512", metrics[fbUsedCounter][1].Value)
+}
+
+func TestNewVGPUCollector_Disabled(t *testing.T) {
+	_, err := NewVGPUCollector([]Counter{{FieldName: dcgmExpXIDErrorsCount}}, "node", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{})
+	assert.Error(t, err)
+}
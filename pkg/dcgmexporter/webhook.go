@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/avast/retry-go/v4"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	dcgmExporterWebhookFailuresTotal = "DCGM_EXPORTER_WEBHOOK_FAILURES_TOTAL"
+
+	// webhookSignatureHeader holds the HMAC-SHA256 of the body, signed with the webhook secret
+	webhookSignatureHeader = "X-DCGM-Exporter-Signature"
+)
+
+var (
+	webhookTimeout    = 10 * time.Second
+	webhookMinBackoff = 500 * time.Millisecond
+	webhookMaxBackoff = 10 * time.Second
+)
+
+// webhookPayload is the JSON body posted to the webhooks for a condition of a device.
+type webhookPayload struct {
+	Timestamp     int64        `json:"timestamp"`
+	Hostname      string       `json:"hostname"`
+	GPU           string       `json:"gpu"`
+	GPUUUID       string       `json:"gpu_uuid"`
+	GPUInstanceID string       `json:"gpu_instance_id,omitempty"`
+	ModelName     string       `json:"model_name"`
+	Pods          []webhookPod `json:"pods"`
+	Reason        string       `json:"reason"`
+	Value         float64      `json:"value"`
+	Message       string       `json:"message"`
+}
+
+type webhookPod struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// WebhookSink posts a JSON payload to the configured webhooks on XID errors, double bit ECC errors, thermal
+// violations and health watch changes found in the metrics of a collection, e.g. to page on GPU failures without
+// an alerting pipeline.
+type WebhookSink struct {
+	urls       []string
+	client     *http.Client
+	hostname   string
+	secret     []byte
+	maxRetries uint
+	conditions *gpuConditionTracker
+}
+
+func NewWebhookSink(c *Config, hostname string) (*WebhookSink, error) {
+	for _, u := range c.WebhookURLs {
+		if _, err := url.ParseRequestURI(u); err != nil {
+			return nil, fmt.Errorf("invalid webhook URL '%s'; err: %w", u, err)
+		}
+	}
+
+	var secret []byte
+	if c.WebhookSecretFile != "" {
+		s, err := readPasswordFile(c.WebhookSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		secret = []byte(s)
+	}
+
+	attributeNames, err := newPodAttributeNames(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebhookSink{
+		urls:       c.WebhookURLs,
+		client:     &http.Client{Timeout: webhookTimeout},
+		hostname:   hostname,
+		secret:     secret,
+		maxRetries: c.WebhookMaxRetries,
+		conditions: newGPUConditionTracker(attributeNames, gpuCondition.changed),
+	}, nil
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (s *WebhookSink) Write(ctx context.Context, metrics MetricsByCounter, timestamp time.Time) error {
+	conditions, devices := s.conditions.update(metrics)
+
+	var errs []error
+	for _, condition := range conditions {
+		body, err := json.Marshal(s.payload(devices[condition.device], condition, timestamp))
+		if err != nil {
+			return err
+		}
+
+		for _, u := range s.urls {
+			if err := s.post(ctx, u, body); err != nil {
+				selfMetrics.AddCounter(dcgmExporterWebhookFailuresTotal,
+					"Number of GPU events that couldn't be posted to a webhook.", nil, 1)
+				errs = append(errs, fmt.Errorf("failed to post the %s event to the webhook '%s'; err: %w",
+					condition.reason, u, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *WebhookSink) Close() error {
+	return nil
+}
+
+func (s *WebhookSink) payload(device *gpuConditionDevice, condition gpuCondition, timestamp time.Time) webhookPayload {
+	payload := webhookPayload{
+		Timestamp:     timestamp.UnixMilli(),
+		Hostname:      s.hostname,
+		GPU:           device.metric.GPU,
+		GPUUUID:       device.metric.GPUUUID,
+		GPUInstanceID: device.metric.GPUInstanceID,
+		ModelName:     device.metric.GPUModelName,
+		Pods:          []webhookPod{},
+		Reason:        condition.reason,
+		Value:         condition.value,
+		Message:       condition.message,
+	}
+
+	for _, pod := range device.sortedPods() {
+		payload.Pods = append(payload.Pods, webhookPod{Name: pod, Namespace: device.pods[pod]})
+	}
+
+	return payload
+}
+
+// post sends the body to the webhook, retrying with an exponential backoff on failures.
+func (s *WebhookSink) post(ctx context.Context, u string, body []byte) error {
+	return retry.Do(
+		func() error {
+			return s.send(ctx, u, body)
+		},
+		retry.Context(ctx),
+		retry.Attempts(s.maxRetries+1),
+		retry.Delay(webhookMinBackoff),
+		retry.MaxDelay(webhookMaxBackoff),
+		retry.DelayType(retry.BackOffDelay),
+		retry.LastErrorOnly(true),
+		retry.OnRetry(func(n uint, err error) {
+			logrus.WithError(err).Debugf("Retrying webhook '%s', attempt %d", u, n+1)
+		}),
+	)
+}
+
+func (s *WebhookSink) send(ctx context.Context, u string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return retry.Unrecoverable(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "dcgm-exporter")
+	if len(s.secret) > 0 {
+		req.Header.Set(webhookSignatureHeader, "sha256="+webhookSignature(s.secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("webhook returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(msg))
+
+	// Client errors, except throttling, won't succeed on retry
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return retry.Unrecoverable(err)
+	}
+
+	return err
+}
+
+// webhookSignature returns the hex encoded HMAC-SHA256 of the body.
+func webhookSignature(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	sysOS "os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSink(t *testing.T) {
+	webhookMinBackoff, webhookMaxBackoff = time.Millisecond, time.Millisecond
+	defer func() {
+		webhookMinBackoff, webhookMaxBackoff = 500*time.Millisecond, 10*time.Second
+	}()
+
+	var mtx sync.Mutex
+	var payloads []webhookPayload
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		// The first request fails and is retried
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "sha256="+webhookSignature([]byte("secret"), body), r.Header.Get(webhookSignatureHeader))
+
+		var payload webhookPayload
+		require.NoError(t, json.Unmarshal(body, &payload))
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, sysOS.WriteFile(secretFile, []byte("secret\n"), 0o600))
+
+	sink, err := NewWebhookSink(&Config{
+		WebhookURLs:       []string{server.URL},
+		WebhookSecretFile: secretFile,
+		WebhookMaxRetries: 1,
+	}, "node")
+	require.NoError(t, err)
+
+	thermalCounter := Counter{FieldID: dcgm.DCGM_FI_DEV_THERMAL_VIOLATION, FieldName: "DCGM_FI_DEV_THERMAL_VIOLATION",
+		PromType: "counter"}
+	write := func(xid, thermal string, health int) []webhookPayload {
+		metrics := kubernetesEventsMetrics(xid, "0", health)
+		metrics[thermalCounter] = []Metric{{Counter: thermalCounter, Value: thermal, GPU: "1", GPUUUID: "GPU-1"}}
+		require.NoError(t, sink.Write(context.Background(), metrics, time.UnixMilli(1000)))
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		written := payloads
+		payloads = nil
+		return written
+	}
+
+	// The errors before the exporter started are not posted, the health watch failures are
+	assert.Equal(t, []webhookPayload{{
+		Timestamp: 1000,
+		Hostname:  "node",
+		GPU:       "1",
+		GPUUUID:   "GPU-1",
+		Pods:      []webhookPod{},
+		Reason:    gpuHealthFailReason,
+		Value:     healthResultFail,
+		Message:   "The DCGM_HEALTH_WATCH_MEM health watch failed on GPU 1 (GPU-1)",
+	}}, write("43", "100", healthResultFail))
+	assert.Equal(t, 2, requests)
+
+	// A new XID error, a thermal violation and the recovery of the health watch are posted
+	written := write("79", "200", healthResultPass)
+	require.Len(t, written, 3)
+	assert.Equal(t, gpuXIDErrorReason, written[0].Reason)
+	assert.Equal(t, float64(79), written[0].Value)
+	assert.Equal(t, []webhookPod{{Name: "trainer-0", Namespace: "training"}, {Name: "trainer-1", Namespace: "training"}},
+		written[0].Pods)
+	assert.Equal(t, gpuThermalViolationReason, written[1].Reason)
+	assert.Equal(t, "GPU-1", written[1].GPUUUID)
+	assert.Equal(t, gpuHealthPassReason, written[2].Reason)
+
+	// The conditions that did not change are not posted again
+	assert.Empty(t, write("79", "200", healthResultPass))
+}
+
+func TestWebhookSink_ClientError(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink(&Config{WebhookURLs: []string{server.URL}, WebhookMaxRetries: 3}, "node")
+	require.NoError(t, err)
+
+	// Client errors are not retried
+	err = sink.Write(context.Background(), kubernetesEventsMetrics("0", "0", healthResultFail), time.Now())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "400 Bad Request")
+	assert.Equal(t, 1, requests)
+
+	_, err = NewWebhookSink(&Config{WebhookURLs: []string{"not a url"}}, "node")
+	assert.Error(t, err)
+}